@@ -0,0 +1,1686 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: admin.proto
+
+package proto
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type ListInstancesReq struct {
+	ByNamespace          bool     `protobuf:"varint,1,opt,name=by_namespace,json=byNamespace,proto3" json:"by_namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListInstancesReq) Reset()         { *m = ListInstancesReq{} }
+func (m *ListInstancesReq) String() string { return proto.CompactTextString(m) }
+func (*ListInstancesReq) ProtoMessage()    {}
+func (*ListInstancesReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{0}
+}
+
+func (m *ListInstancesReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListInstancesReq.Unmarshal(m, b)
+}
+func (m *ListInstancesReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListInstancesReq.Marshal(b, m, deterministic)
+}
+func (m *ListInstancesReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListInstancesReq.Merge(m, src)
+}
+func (m *ListInstancesReq) XXX_Size() int {
+	return xxx_messageInfo_ListInstancesReq.Size(m)
+}
+func (m *ListInstancesReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListInstancesReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListInstancesReq proto.InternalMessageInfo
+
+func (m *ListInstancesReq) GetByNamespace() bool {
+	if m != nil {
+		return m.ByNamespace
+	}
+	return false
+}
+
+type ListInstancesResp struct {
+	Instances            []*Instance       `protobuf:"bytes,1,rep,name=instances,proto3" json:"instances,omitempty"`
+	Namespaces           []*NamespaceUsage `protobuf:"bytes,2,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ListInstancesResp) Reset()         { *m = ListInstancesResp{} }
+func (m *ListInstancesResp) String() string { return proto.CompactTextString(m) }
+func (*ListInstancesResp) ProtoMessage()    {}
+func (*ListInstancesResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{1}
+}
+
+func (m *ListInstancesResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListInstancesResp.Unmarshal(m, b)
+}
+func (m *ListInstancesResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListInstancesResp.Marshal(b, m, deterministic)
+}
+func (m *ListInstancesResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListInstancesResp.Merge(m, src)
+}
+func (m *ListInstancesResp) XXX_Size() int {
+	return xxx_messageInfo_ListInstancesResp.Size(m)
+}
+func (m *ListInstancesResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListInstancesResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListInstancesResp proto.InternalMessageInfo
+
+func (m *ListInstancesResp) GetInstances() []*Instance {
+	if m != nil {
+		return m.Instances
+	}
+	return nil
+}
+
+func (m *ListInstancesResp) GetNamespaces() []*NamespaceUsage {
+	if m != nil {
+		return m.Namespaces
+	}
+	return nil
+}
+
+type NamespaceUsage struct {
+	Namespace            string   `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Vms                  uint32   `protobuf:"varint,2,opt,name=vms,proto3" json:"vms,omitempty"`
+	MemSizeMib           uint64   `protobuf:"varint,3,opt,name=mem_size_mib,json=memSizeMib,proto3" json:"mem_size_mib,omitempty"`
+	MaxVms               uint32   `protobuf:"varint,4,opt,name=max_vms,json=maxVms,proto3" json:"max_vms,omitempty"`
+	MaxMemSizeMib        uint64   `protobuf:"varint,5,opt,name=max_mem_size_mib,json=maxMemSizeMib,proto3" json:"max_mem_size_mib,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NamespaceUsage) Reset()         { *m = NamespaceUsage{} }
+func (m *NamespaceUsage) String() string { return proto.CompactTextString(m) }
+func (*NamespaceUsage) ProtoMessage()    {}
+func (*NamespaceUsage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{2}
+}
+
+func (m *NamespaceUsage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NamespaceUsage.Unmarshal(m, b)
+}
+func (m *NamespaceUsage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NamespaceUsage.Marshal(b, m, deterministic)
+}
+func (m *NamespaceUsage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NamespaceUsage.Merge(m, src)
+}
+func (m *NamespaceUsage) XXX_Size() int {
+	return xxx_messageInfo_NamespaceUsage.Size(m)
+}
+func (m *NamespaceUsage) XXX_DiscardUnknown() {
+	xxx_messageInfo_NamespaceUsage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NamespaceUsage proto.InternalMessageInfo
+
+func (m *NamespaceUsage) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *NamespaceUsage) GetVms() uint32 {
+	if m != nil {
+		return m.Vms
+	}
+	return 0
+}
+
+func (m *NamespaceUsage) GetMemSizeMib() uint64 {
+	if m != nil {
+		return m.MemSizeMib
+	}
+	return 0
+}
+
+func (m *NamespaceUsage) GetMaxVms() uint32 {
+	if m != nil {
+		return m.MaxVms
+	}
+	return 0
+}
+
+func (m *NamespaceUsage) GetMaxMemSizeMib() uint64 {
+	if m != nil {
+		return m.MaxMemSizeMib
+	}
+	return 0
+}
+
+type Instance struct {
+	ContainerId          string   `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	VmId                 string   `protobuf:"bytes,2,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	Revision             string   `protobuf:"bytes,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	Image                string   `protobuf:"bytes,4,opt,name=image,proto3" json:"image,omitempty"`
+	GuestIp              string   `protobuf:"bytes,5,opt,name=guest_ip,json=guestIp,proto3" json:"guest_ip,omitempty"`
+	GuestPort            string   `protobuf:"bytes,6,opt,name=guest_port,json=guestPort,proto3" json:"guest_port,omitempty"`
+	MemSizeMib           uint32   `protobuf:"varint,7,opt,name=mem_size_mib,json=memSizeMib,proto3" json:"mem_size_mib,omitempty"`
+	VcpuCount            uint32   `protobuf:"varint,8,opt,name=vcpu_count,json=vcpuCount,proto3" json:"vcpu_count,omitempty"`
+	BootType             string   `protobuf:"bytes,9,opt,name=boot_type,json=bootType,proto3" json:"boot_type,omitempty"`
+	StartTimeUnixNano    int64    `protobuf:"varint,10,opt,name=start_time_unix_nano,json=startTimeUnixNano,proto3" json:"start_time_unix_nano,omitempty"`
+	UptimeMs             int64    `protobuf:"varint,11,opt,name=uptime_ms,json=uptimeMs,proto3" json:"uptime_ms,omitempty"`
+	State                string   `protobuf:"bytes,12,opt,name=state,proto3" json:"state,omitempty"`
+	Namespace            string   `protobuf:"bytes,13,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Instance) Reset()         { *m = Instance{} }
+func (m *Instance) String() string { return proto.CompactTextString(m) }
+func (*Instance) ProtoMessage()    {}
+func (*Instance) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{3}
+}
+
+func (m *Instance) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Instance.Unmarshal(m, b)
+}
+func (m *Instance) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Instance.Marshal(b, m, deterministic)
+}
+func (m *Instance) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Instance.Merge(m, src)
+}
+func (m *Instance) XXX_Size() int {
+	return xxx_messageInfo_Instance.Size(m)
+}
+func (m *Instance) XXX_DiscardUnknown() {
+	xxx_messageInfo_Instance.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Instance proto.InternalMessageInfo
+
+func (m *Instance) GetContainerId() string {
+	if m != nil {
+		return m.ContainerId
+	}
+	return ""
+}
+
+func (m *Instance) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func (m *Instance) GetRevision() string {
+	if m != nil {
+		return m.Revision
+	}
+	return ""
+}
+
+func (m *Instance) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *Instance) GetGuestIp() string {
+	if m != nil {
+		return m.GuestIp
+	}
+	return ""
+}
+
+func (m *Instance) GetGuestPort() string {
+	if m != nil {
+		return m.GuestPort
+	}
+	return ""
+}
+
+func (m *Instance) GetMemSizeMib() uint32 {
+	if m != nil {
+		return m.MemSizeMib
+	}
+	return 0
+}
+
+func (m *Instance) GetVcpuCount() uint32 {
+	if m != nil {
+		return m.VcpuCount
+	}
+	return 0
+}
+
+func (m *Instance) GetBootType() string {
+	if m != nil {
+		return m.BootType
+	}
+	return ""
+}
+
+func (m *Instance) GetStartTimeUnixNano() int64 {
+	if m != nil {
+		return m.StartTimeUnixNano
+	}
+	return 0
+}
+
+func (m *Instance) GetUptimeMs() int64 {
+	if m != nil {
+		return m.UptimeMs
+	}
+	return 0
+}
+
+func (m *Instance) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Instance) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+type DescribeInstanceReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DescribeInstanceReq) Reset()         { *m = DescribeInstanceReq{} }
+func (m *DescribeInstanceReq) String() string { return proto.CompactTextString(m) }
+func (*DescribeInstanceReq) ProtoMessage()    {}
+func (*DescribeInstanceReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{4}
+}
+
+func (m *DescribeInstanceReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DescribeInstanceReq.Unmarshal(m, b)
+}
+func (m *DescribeInstanceReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DescribeInstanceReq.Marshal(b, m, deterministic)
+}
+func (m *DescribeInstanceReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DescribeInstanceReq.Merge(m, src)
+}
+func (m *DescribeInstanceReq) XXX_Size() int {
+	return xxx_messageInfo_DescribeInstanceReq.Size(m)
+}
+func (m *DescribeInstanceReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_DescribeInstanceReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DescribeInstanceReq proto.InternalMessageInfo
+
+func (m *DescribeInstanceReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type DescribeInstanceResp struct {
+	Instance             *Instance   `protobuf:"bytes,1,opt,name=instance,proto3" json:"instance,omitempty"`
+	SnapshotLineage      []*Snapshot `protobuf:"bytes,2,rep,name=snapshot_lineage,json=snapshotLineage,proto3" json:"snapshot_lineage,omitempty"`
+	Events               []*Event    `protobuf:"bytes,3,rep,name=events,proto3" json:"events,omitempty"`
+	BootPhases           []*Latency  `protobuf:"bytes,4,rep,name=boot_phases,json=bootPhases,proto3" json:"boot_phases,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *DescribeInstanceResp) Reset()         { *m = DescribeInstanceResp{} }
+func (m *DescribeInstanceResp) String() string { return proto.CompactTextString(m) }
+func (*DescribeInstanceResp) ProtoMessage()    {}
+func (*DescribeInstanceResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{5}
+}
+
+func (m *DescribeInstanceResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DescribeInstanceResp.Unmarshal(m, b)
+}
+func (m *DescribeInstanceResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DescribeInstanceResp.Marshal(b, m, deterministic)
+}
+func (m *DescribeInstanceResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DescribeInstanceResp.Merge(m, src)
+}
+func (m *DescribeInstanceResp) XXX_Size() int {
+	return xxx_messageInfo_DescribeInstanceResp.Size(m)
+}
+func (m *DescribeInstanceResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_DescribeInstanceResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DescribeInstanceResp proto.InternalMessageInfo
+
+func (m *DescribeInstanceResp) GetInstance() *Instance {
+	if m != nil {
+		return m.Instance
+	}
+	return nil
+}
+
+func (m *DescribeInstanceResp) GetSnapshotLineage() []*Snapshot {
+	if m != nil {
+		return m.SnapshotLineage
+	}
+	return nil
+}
+
+func (m *DescribeInstanceResp) GetEvents() []*Event {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *DescribeInstanceResp) GetBootPhases() []*Latency {
+	if m != nil {
+		return m.BootPhases
+	}
+	return nil
+}
+
+type Snapshot struct {
+	VmId                 string   `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	Image                string   `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	CreatedUnixNano      int64    `protobuf:"varint,3,opt,name=created_unix_nano,json=createdUnixNano,proto3" json:"created_unix_nano,omitempty"`
+	Loads                uint32   `protobuf:"varint,4,opt,name=loads,proto3" json:"loads,omitempty"`
+	Name                 string   `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Snapshot) Reset()         { *m = Snapshot{} }
+func (m *Snapshot) String() string { return proto.CompactTextString(m) }
+func (*Snapshot) ProtoMessage()    {}
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{6}
+}
+
+func (m *Snapshot) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Snapshot.Unmarshal(m, b)
+}
+func (m *Snapshot) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Snapshot.Marshal(b, m, deterministic)
+}
+func (m *Snapshot) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Snapshot.Merge(m, src)
+}
+func (m *Snapshot) XXX_Size() int {
+	return xxx_messageInfo_Snapshot.Size(m)
+}
+func (m *Snapshot) XXX_DiscardUnknown() {
+	xxx_messageInfo_Snapshot.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Snapshot proto.InternalMessageInfo
+
+func (m *Snapshot) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func (m *Snapshot) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *Snapshot) GetCreatedUnixNano() int64 {
+	if m != nil {
+		return m.CreatedUnixNano
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLoads() uint32 {
+	if m != nil {
+		return m.Loads
+	}
+	return 0
+}
+
+func (m *Snapshot) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type Event struct {
+	TimeUnixNano         int64    `protobuf:"varint,1,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Type                 string   `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Message              string   `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Warning              bool     `protobuf:"varint,4,opt,name=warning,proto3" json:"warning,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+func (*Event) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{7}
+}
+
+func (m *Event) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Event.Unmarshal(m, b)
+}
+func (m *Event) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Event.Marshal(b, m, deterministic)
+}
+func (m *Event) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Event.Merge(m, src)
+}
+func (m *Event) XXX_Size() int {
+	return xxx_messageInfo_Event.Size(m)
+}
+func (m *Event) XXX_DiscardUnknown() {
+	xxx_messageInfo_Event.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Event proto.InternalMessageInfo
+
+func (m *Event) GetTimeUnixNano() int64 {
+	if m != nil {
+		return m.TimeUnixNano
+	}
+	return 0
+}
+
+func (m *Event) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Event) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Event) GetWarning() bool {
+	if m != nil {
+		return m.Warning
+	}
+	return false
+}
+
+type InstanceOpReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InstanceOpReq) Reset()         { *m = InstanceOpReq{} }
+func (m *InstanceOpReq) String() string { return proto.CompactTextString(m) }
+func (*InstanceOpReq) ProtoMessage()    {}
+func (*InstanceOpReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{8}
+}
+
+func (m *InstanceOpReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InstanceOpReq.Unmarshal(m, b)
+}
+func (m *InstanceOpReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InstanceOpReq.Marshal(b, m, deterministic)
+}
+func (m *InstanceOpReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InstanceOpReq.Merge(m, src)
+}
+func (m *InstanceOpReq) XXX_Size() int {
+	return xxx_messageInfo_InstanceOpReq.Size(m)
+}
+func (m *InstanceOpReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_InstanceOpReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InstanceOpReq proto.InternalMessageInfo
+
+func (m *InstanceOpReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type SnapshotInstanceReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotInstanceReq) Reset()         { *m = SnapshotInstanceReq{} }
+func (m *SnapshotInstanceReq) String() string { return proto.CompactTextString(m) }
+func (*SnapshotInstanceReq) ProtoMessage()    {}
+func (*SnapshotInstanceReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{9}
+}
+
+func (m *SnapshotInstanceReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotInstanceReq.Unmarshal(m, b)
+}
+func (m *SnapshotInstanceReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotInstanceReq.Marshal(b, m, deterministic)
+}
+func (m *SnapshotInstanceReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotInstanceReq.Merge(m, src)
+}
+func (m *SnapshotInstanceReq) XXX_Size() int {
+	return xxx_messageInfo_SnapshotInstanceReq.Size(m)
+}
+func (m *SnapshotInstanceReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotInstanceReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotInstanceReq proto.InternalMessageInfo
+
+func (m *SnapshotInstanceReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SnapshotInstanceReq) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type InstanceOpResp struct {
+	Instance             *Instance  `protobuf:"bytes,1,opt,name=instance,proto3" json:"instance,omitempty"`
+	LatencyUs            int64      `protobuf:"varint,2,opt,name=latency_us,json=latencyUs,proto3" json:"latency_us,omitempty"`
+	Phases               []*Latency `protobuf:"bytes,3,rep,name=phases,proto3" json:"phases,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *InstanceOpResp) Reset()         { *m = InstanceOpResp{} }
+func (m *InstanceOpResp) String() string { return proto.CompactTextString(m) }
+func (*InstanceOpResp) ProtoMessage()    {}
+func (*InstanceOpResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{10}
+}
+
+func (m *InstanceOpResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InstanceOpResp.Unmarshal(m, b)
+}
+func (m *InstanceOpResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InstanceOpResp.Marshal(b, m, deterministic)
+}
+func (m *InstanceOpResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InstanceOpResp.Merge(m, src)
+}
+func (m *InstanceOpResp) XXX_Size() int {
+	return xxx_messageInfo_InstanceOpResp.Size(m)
+}
+func (m *InstanceOpResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_InstanceOpResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InstanceOpResp proto.InternalMessageInfo
+
+func (m *InstanceOpResp) GetInstance() *Instance {
+	if m != nil {
+		return m.Instance
+	}
+	return nil
+}
+
+func (m *InstanceOpResp) GetLatencyUs() int64 {
+	if m != nil {
+		return m.LatencyUs
+	}
+	return 0
+}
+
+func (m *InstanceOpResp) GetPhases() []*Latency {
+	if m != nil {
+		return m.Phases
+	}
+	return nil
+}
+
+type Latency struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Us                   float64  `protobuf:"fixed64,2,opt,name=us,proto3" json:"us,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Latency) Reset()         { *m = Latency{} }
+func (m *Latency) String() string { return proto.CompactTextString(m) }
+func (*Latency) ProtoMessage()    {}
+func (*Latency) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{11}
+}
+
+func (m *Latency) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Latency.Unmarshal(m, b)
+}
+func (m *Latency) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Latency.Marshal(b, m, deterministic)
+}
+func (m *Latency) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Latency.Merge(m, src)
+}
+func (m *Latency) XXX_Size() int {
+	return xxx_messageInfo_Latency.Size(m)
+}
+func (m *Latency) XXX_DiscardUnknown() {
+	xxx_messageInfo_Latency.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Latency proto.InternalMessageInfo
+
+func (m *Latency) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Latency) GetUs() float64 {
+	if m != nil {
+		return m.Us
+	}
+	return 0
+}
+
+type KeyValue struct {
+	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KeyValue) Reset()         { *m = KeyValue{} }
+func (m *KeyValue) String() string { return proto.CompactTextString(m) }
+func (*KeyValue) ProtoMessage()    {}
+func (*KeyValue) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{12}
+}
+
+func (m *KeyValue) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KeyValue.Unmarshal(m, b)
+}
+func (m *KeyValue) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KeyValue.Marshal(b, m, deterministic)
+}
+func (m *KeyValue) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyValue.Merge(m, src)
+}
+func (m *KeyValue) XXX_Size() int {
+	return xxx_messageInfo_KeyValue.Size(m)
+}
+func (m *KeyValue) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyValue.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KeyValue proto.InternalMessageInfo
+
+func (m *KeyValue) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *KeyValue) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type ValidateFunctionSpecReq struct {
+	Envs                 []*KeyValue `protobuf:"bytes,1,rep,name=envs,proto3" json:"envs,omitempty"`
+	Annotations          []*KeyValue `protobuf:"bytes,2,rep,name=annotations,proto3" json:"annotations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ValidateFunctionSpecReq) Reset()         { *m = ValidateFunctionSpecReq{} }
+func (m *ValidateFunctionSpecReq) String() string { return proto.CompactTextString(m) }
+func (*ValidateFunctionSpecReq) ProtoMessage()    {}
+func (*ValidateFunctionSpecReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{13}
+}
+
+func (m *ValidateFunctionSpecReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ValidateFunctionSpecReq.Unmarshal(m, b)
+}
+func (m *ValidateFunctionSpecReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ValidateFunctionSpecReq.Marshal(b, m, deterministic)
+}
+func (m *ValidateFunctionSpecReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidateFunctionSpecReq.Merge(m, src)
+}
+func (m *ValidateFunctionSpecReq) XXX_Size() int {
+	return xxx_messageInfo_ValidateFunctionSpecReq.Size(m)
+}
+func (m *ValidateFunctionSpecReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidateFunctionSpecReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidateFunctionSpecReq proto.InternalMessageInfo
+
+func (m *ValidateFunctionSpecReq) GetEnvs() []*KeyValue {
+	if m != nil {
+		return m.Envs
+	}
+	return nil
+}
+
+func (m *ValidateFunctionSpecReq) GetAnnotations() []*KeyValue {
+	if m != nil {
+		return m.Annotations
+	}
+	return nil
+}
+
+type ValidateFunctionSpecResp struct {
+	Valid                bool           `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	Problems             []*SpecProblem `protobuf:"bytes,2,rep,name=problems,proto3" json:"problems,omitempty"`
+	Warnings             []string       `protobuf:"bytes,3,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ValidateFunctionSpecResp) Reset()         { *m = ValidateFunctionSpecResp{} }
+func (m *ValidateFunctionSpecResp) String() string { return proto.CompactTextString(m) }
+func (*ValidateFunctionSpecResp) ProtoMessage()    {}
+func (*ValidateFunctionSpecResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{14}
+}
+
+func (m *ValidateFunctionSpecResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ValidateFunctionSpecResp.Unmarshal(m, b)
+}
+func (m *ValidateFunctionSpecResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ValidateFunctionSpecResp.Marshal(b, m, deterministic)
+}
+func (m *ValidateFunctionSpecResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidateFunctionSpecResp.Merge(m, src)
+}
+func (m *ValidateFunctionSpecResp) XXX_Size() int {
+	return xxx_messageInfo_ValidateFunctionSpecResp.Size(m)
+}
+func (m *ValidateFunctionSpecResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidateFunctionSpecResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidateFunctionSpecResp proto.InternalMessageInfo
+
+func (m *ValidateFunctionSpecResp) GetValid() bool {
+	if m != nil {
+		return m.Valid
+	}
+	return false
+}
+
+func (m *ValidateFunctionSpecResp) GetProblems() []*SpecProblem {
+	if m != nil {
+		return m.Problems
+	}
+	return nil
+}
+
+func (m *ValidateFunctionSpecResp) GetWarnings() []string {
+	if m != nil {
+		return m.Warnings
+	}
+	return nil
+}
+
+type SpecProblem struct {
+	Field                string   `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Message              string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SpecProblem) Reset()         { *m = SpecProblem{} }
+func (m *SpecProblem) String() string { return proto.CompactTextString(m) }
+func (*SpecProblem) ProtoMessage()    {}
+func (*SpecProblem) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{15}
+}
+
+func (m *SpecProblem) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SpecProblem.Unmarshal(m, b)
+}
+func (m *SpecProblem) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SpecProblem.Marshal(b, m, deterministic)
+}
+func (m *SpecProblem) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SpecProblem.Merge(m, src)
+}
+func (m *SpecProblem) XXX_Size() int {
+	return xxx_messageInfo_SpecProblem.Size(m)
+}
+func (m *SpecProblem) XXX_DiscardUnknown() {
+	xxx_messageInfo_SpecProblem.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SpecProblem proto.InternalMessageInfo
+
+func (m *SpecProblem) GetField() string {
+	if m != nil {
+		return m.Field
+	}
+	return ""
+}
+
+func (m *SpecProblem) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type SetLogLevelReq struct {
+	Component            string   `protobuf:"bytes,1,opt,name=component,proto3" json:"component,omitempty"`
+	Level                string   `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetLogLevelReq) Reset()         { *m = SetLogLevelReq{} }
+func (m *SetLogLevelReq) String() string { return proto.CompactTextString(m) }
+func (*SetLogLevelReq) ProtoMessage()    {}
+func (*SetLogLevelReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{16}
+}
+
+func (m *SetLogLevelReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetLogLevelReq.Unmarshal(m, b)
+}
+func (m *SetLogLevelReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetLogLevelReq.Marshal(b, m, deterministic)
+}
+func (m *SetLogLevelReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetLogLevelReq.Merge(m, src)
+}
+func (m *SetLogLevelReq) XXX_Size() int {
+	return xxx_messageInfo_SetLogLevelReq.Size(m)
+}
+func (m *SetLogLevelReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetLogLevelReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetLogLevelReq proto.InternalMessageInfo
+
+func (m *SetLogLevelReq) GetComponent() string {
+	if m != nil {
+		return m.Component
+	}
+	return ""
+}
+
+func (m *SetLogLevelReq) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+type SetLogLevelResp struct {
+	Levels               []*LogLevel `protobuf:"bytes,1,rep,name=levels,proto3" json:"levels,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *SetLogLevelResp) Reset()         { *m = SetLogLevelResp{} }
+func (m *SetLogLevelResp) String() string { return proto.CompactTextString(m) }
+func (*SetLogLevelResp) ProtoMessage()    {}
+func (*SetLogLevelResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{17}
+}
+
+func (m *SetLogLevelResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetLogLevelResp.Unmarshal(m, b)
+}
+func (m *SetLogLevelResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetLogLevelResp.Marshal(b, m, deterministic)
+}
+func (m *SetLogLevelResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetLogLevelResp.Merge(m, src)
+}
+func (m *SetLogLevelResp) XXX_Size() int {
+	return xxx_messageInfo_SetLogLevelResp.Size(m)
+}
+func (m *SetLogLevelResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetLogLevelResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetLogLevelResp proto.InternalMessageInfo
+
+func (m *SetLogLevelResp) GetLevels() []*LogLevel {
+	if m != nil {
+		return m.Levels
+	}
+	return nil
+}
+
+type LogLevel struct {
+	Component            string   `protobuf:"bytes,1,opt,name=component,proto3" json:"component,omitempty"`
+	Level                string   `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LogLevel) Reset()         { *m = LogLevel{} }
+func (m *LogLevel) String() string { return proto.CompactTextString(m) }
+func (*LogLevel) ProtoMessage()    {}
+func (*LogLevel) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{18}
+}
+
+func (m *LogLevel) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogLevel.Unmarshal(m, b)
+}
+func (m *LogLevel) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogLevel.Marshal(b, m, deterministic)
+}
+func (m *LogLevel) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogLevel.Merge(m, src)
+}
+func (m *LogLevel) XXX_Size() int {
+	return xxx_messageInfo_LogLevel.Size(m)
+}
+func (m *LogLevel) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogLevel.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogLevel proto.InternalMessageInfo
+
+func (m *LogLevel) GetComponent() string {
+	if m != nil {
+		return m.Component
+	}
+	return ""
+}
+
+func (m *LogLevel) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+type SetAdmissionReq struct {
+	Mode                 string   `protobuf:"bytes,1,opt,name=mode,proto3" json:"mode,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetAdmissionReq) Reset()         { *m = SetAdmissionReq{} }
+func (m *SetAdmissionReq) String() string { return proto.CompactTextString(m) }
+func (*SetAdmissionReq) ProtoMessage()    {}
+func (*SetAdmissionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{19}
+}
+
+func (m *SetAdmissionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetAdmissionReq.Unmarshal(m, b)
+}
+func (m *SetAdmissionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetAdmissionReq.Marshal(b, m, deterministic)
+}
+func (m *SetAdmissionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetAdmissionReq.Merge(m, src)
+}
+func (m *SetAdmissionReq) XXX_Size() int {
+	return xxx_messageInfo_SetAdmissionReq.Size(m)
+}
+func (m *SetAdmissionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetAdmissionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetAdmissionReq proto.InternalMessageInfo
+
+func (m *SetAdmissionReq) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+type SetAdmissionResp struct {
+	Mode                 string   `protobuf:"bytes,1,opt,name=mode,proto3" json:"mode,omitempty"`
+	Previous             string   `protobuf:"bytes,2,opt,name=previous,proto3" json:"previous,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetAdmissionResp) Reset()         { *m = SetAdmissionResp{} }
+func (m *SetAdmissionResp) String() string { return proto.CompactTextString(m) }
+func (*SetAdmissionResp) ProtoMessage()    {}
+func (*SetAdmissionResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{20}
+}
+
+func (m *SetAdmissionResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetAdmissionResp.Unmarshal(m, b)
+}
+func (m *SetAdmissionResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetAdmissionResp.Marshal(b, m, deterministic)
+}
+func (m *SetAdmissionResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetAdmissionResp.Merge(m, src)
+}
+func (m *SetAdmissionResp) XXX_Size() int {
+	return xxx_messageInfo_SetAdmissionResp.Size(m)
+}
+func (m *SetAdmissionResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetAdmissionResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetAdmissionResp proto.InternalMessageInfo
+
+func (m *SetAdmissionResp) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *SetAdmissionResp) GetPrevious() string {
+	if m != nil {
+		return m.Previous
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ListInstancesReq)(nil), "admin.ListInstancesReq")
+	proto.RegisterType((*ListInstancesResp)(nil), "admin.ListInstancesResp")
+	proto.RegisterType((*NamespaceUsage)(nil), "admin.NamespaceUsage")
+	proto.RegisterType((*Instance)(nil), "admin.Instance")
+	proto.RegisterType((*DescribeInstanceReq)(nil), "admin.DescribeInstanceReq")
+	proto.RegisterType((*DescribeInstanceResp)(nil), "admin.DescribeInstanceResp")
+	proto.RegisterType((*Snapshot)(nil), "admin.Snapshot")
+	proto.RegisterType((*Event)(nil), "admin.Event")
+	proto.RegisterType((*InstanceOpReq)(nil), "admin.InstanceOpReq")
+	proto.RegisterType((*SnapshotInstanceReq)(nil), "admin.SnapshotInstanceReq")
+	proto.RegisterType((*InstanceOpResp)(nil), "admin.InstanceOpResp")
+	proto.RegisterType((*Latency)(nil), "admin.Latency")
+	proto.RegisterType((*KeyValue)(nil), "admin.KeyValue")
+	proto.RegisterType((*ValidateFunctionSpecReq)(nil), "admin.ValidateFunctionSpecReq")
+	proto.RegisterType((*ValidateFunctionSpecResp)(nil), "admin.ValidateFunctionSpecResp")
+	proto.RegisterType((*SpecProblem)(nil), "admin.SpecProblem")
+	proto.RegisterType((*SetLogLevelReq)(nil), "admin.SetLogLevelReq")
+	proto.RegisterType((*SetLogLevelResp)(nil), "admin.SetLogLevelResp")
+	proto.RegisterType((*LogLevel)(nil), "admin.LogLevel")
+	proto.RegisterType((*SetAdmissionReq)(nil), "admin.SetAdmissionReq")
+	proto.RegisterType((*SetAdmissionResp)(nil), "admin.SetAdmissionResp")
+}
+
+func init() {
+	proto.RegisterFile("admin.proto", fileDescriptor_73a7fc70dcc2027c)
+}
+
+var fileDescriptor_73a7fc70dcc2027c = []byte{
+	// 1149 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0x6d, 0x6f, 0xdb, 0xb6,
+	0x13, 0xff, 0xcb, 0x8f, 0xd2, 0xf9, 0x21, 0x2e, 0xeb, 0xfe, 0xa3, 0xb9, 0xcd, 0x9a, 0x69, 0xed,
+	0x1a, 0x6c, 0x68, 0x8a, 0x65, 0xe8, 0x8b, 0x15, 0x68, 0xb7, 0x76, 0xd9, 0x86, 0xa0, 0x49, 0x1b,
+	0x28, 0x4d, 0x80, 0xed, 0x8d, 0x40, 0xcb, 0x4c, 0x4a, 0xcc, 0xa4, 0x18, 0x93, 0xf2, 0xe2, 0x62,
+	0x2f, 0xf7, 0x6e, 0xc0, 0x3e, 0xc5, 0xbe, 0xca, 0xbe, 0xc2, 0x3e, 0xcf, 0x40, 0x8a, 0x52, 0x64,
+	0x57, 0x29, 0xb0, 0xbc, 0x32, 0xef, 0xee, 0x77, 0xc7, 0xe3, 0xdd, 0xef, 0x4e, 0x86, 0x0e, 0x9e,
+	0x30, 0xca, 0xb7, 0xc5, 0x2c, 0x51, 0x09, 0x6a, 0x1a, 0x21, 0x78, 0x0c, 0x83, 0x7d, 0x2a, 0xd5,
+	0x1e, 0x97, 0x0a, 0xf3, 0x98, 0xc8, 0x90, 0x9c, 0xa3, 0x4f, 0xa0, 0x3b, 0x5e, 0x44, 0x1c, 0x33,
+	0x22, 0x05, 0x8e, 0x89, 0xef, 0x6c, 0x3a, 0x5b, 0x6e, 0xd8, 0x19, 0x2f, 0x5e, 0xe5, 0xaa, 0x60,
+	0x01, 0x37, 0x56, 0xdc, 0xa4, 0x40, 0x0f, 0xc1, 0xa3, 0xb9, 0xc2, 0x77, 0x36, 0xeb, 0x5b, 0x9d,
+	0x9d, 0xb5, 0xed, 0xec, 0xce, 0x1c, 0x18, 0x5e, 0x22, 0xd0, 0x63, 0x80, 0xe2, 0x0e, 0xe9, 0xd7,
+	0x0c, 0xfe, 0x96, 0xc5, 0x17, 0x37, 0x1d, 0x4b, 0x7c, 0x46, 0xc2, 0x12, 0x30, 0xf8, 0xcb, 0x81,
+	0xfe, 0xb2, 0x19, 0xdd, 0x01, 0x6f, 0x39, 0x5b, 0x2f, 0xbc, 0x54, 0xa0, 0x01, 0xd4, 0xe7, 0x4c,
+	0x5f, 0xe0, 0x6c, 0xf5, 0x42, 0x7d, 0x44, 0x9b, 0xd0, 0x65, 0x84, 0x45, 0x92, 0xbe, 0x23, 0x11,
+	0xa3, 0x63, 0xbf, 0xbe, 0xe9, 0x6c, 0x35, 0x42, 0x60, 0x84, 0x1d, 0xd1, 0x77, 0xe4, 0x80, 0x8e,
+	0xd1, 0x3a, 0xb4, 0x19, 0xbe, 0x88, 0xb4, 0x5f, 0xc3, 0xf8, 0xb5, 0x18, 0xbe, 0x38, 0x61, 0x12,
+	0x3d, 0x80, 0x81, 0x36, 0x2c, 0xb9, 0x37, 0x8d, 0x7b, 0x8f, 0xe1, 0x8b, 0x83, 0x22, 0x42, 0xf0,
+	0x67, 0x1d, 0xdc, 0xfc, 0xd5, 0xba, 0xa2, 0x71, 0xc2, 0x15, 0xa6, 0x9c, 0xcc, 0x22, 0x3a, 0xb1,
+	0x39, 0x76, 0x0a, 0xdd, 0xde, 0x04, 0xdd, 0x84, 0xe6, 0x9c, 0x69, 0x5b, 0xcd, 0xd8, 0x1a, 0x73,
+	0xb6, 0x37, 0x41, 0x23, 0x70, 0x67, 0x64, 0x4e, 0x25, 0x4d, 0xb8, 0x49, 0xd2, 0x0b, 0x0b, 0x19,
+	0x0d, 0xa1, 0x49, 0x19, 0x3e, 0x23, 0x26, 0x41, 0x2f, 0xcc, 0x04, 0xf4, 0x11, 0xb8, 0x67, 0x29,
+	0x91, 0x2a, 0xa2, 0xc2, 0xe4, 0xe5, 0x85, 0x6d, 0x23, 0xef, 0x09, 0xb4, 0x01, 0x90, 0x99, 0x44,
+	0x32, 0x53, 0x7e, 0x2b, 0x2b, 0x93, 0xd1, 0x1c, 0x26, 0x33, 0xf5, 0x5e, 0x51, 0xda, 0xe6, 0xdd,
+	0xe5, 0xa2, 0x6c, 0x00, 0xcc, 0x63, 0x91, 0x46, 0x71, 0x92, 0x72, 0xe5, 0xbb, 0xc6, 0xee, 0x69,
+	0xcd, 0x77, 0x5a, 0x81, 0x6e, 0x83, 0x37, 0x4e, 0x12, 0x15, 0xa9, 0x85, 0x20, 0xbe, 0x97, 0x65,
+	0xab, 0x15, 0x6f, 0x16, 0x82, 0xa0, 0x47, 0x30, 0x94, 0x0a, 0xcf, 0x54, 0xa4, 0x28, 0x23, 0x51,
+	0xca, 0xe9, 0x45, 0xc4, 0x31, 0x4f, 0x7c, 0xd8, 0x74, 0xb6, 0xea, 0xe1, 0x0d, 0x63, 0x7b, 0x43,
+	0x19, 0x39, 0xe6, 0xf4, 0xe2, 0x15, 0xe6, 0x89, 0x8e, 0x96, 0x0a, 0x03, 0x66, 0xd2, 0xef, 0x18,
+	0x94, 0x9b, 0x29, 0x0e, 0xa4, 0x7e, 0xbb, 0x54, 0x58, 0x11, 0xbf, 0x9b, 0xbd, 0xdd, 0x08, 0xcb,
+	0x34, 0xe8, 0xad, 0xd0, 0x20, 0xb8, 0x0f, 0x37, 0x77, 0x89, 0x8c, 0x67, 0x74, 0x4c, 0x0a, 0x36,
+	0x92, 0x73, 0xd4, 0x87, 0x5a, 0xd1, 0x90, 0x1a, 0x9d, 0x04, 0xff, 0x38, 0x30, 0x7c, 0x1f, 0x27,
+	0x05, 0xfa, 0x02, 0xdc, 0x9c, 0xbb, 0x06, 0x5e, 0x41, 0xee, 0x02, 0x80, 0x9e, 0xc0, 0x40, 0x72,
+	0x2c, 0xe4, 0xdb, 0x44, 0x45, 0x53, 0xca, 0x89, 0xee, 0x53, 0x6d, 0x69, 0x22, 0x8e, 0xac, 0x39,
+	0x5c, 0xcb, 0x81, 0xfb, 0x19, 0x0e, 0xdd, 0x83, 0x16, 0x99, 0x13, 0xae, 0xa4, 0x5f, 0x37, 0x1e,
+	0x5d, 0xeb, 0xf1, 0xbd, 0x56, 0x86, 0xd6, 0x86, 0x1e, 0x41, 0xc7, 0x54, 0x5b, 0xbc, 0xc5, 0x92,
+	0x68, 0x96, 0x6a, 0x68, 0xdf, 0x42, 0xf7, 0xb1, 0x22, 0x3c, 0x5e, 0x84, 0xa0, 0x21, 0x87, 0x06,
+	0x11, 0xfc, 0xe1, 0x80, 0x9b, 0x5f, 0x7a, 0xc9, 0x36, 0xa7, 0xc4, 0xb6, 0x82, 0x51, 0xb5, 0x32,
+	0xa3, 0x3e, 0x87, 0x1b, 0xf1, 0x8c, 0x60, 0x45, 0x26, 0xa5, 0xb6, 0xd5, 0x4d, 0x43, 0xd6, 0xac,
+	0xa1, 0x68, 0xda, 0x10, 0x9a, 0xd3, 0x04, 0x4f, 0xf2, 0xa1, 0xc9, 0x04, 0x84, 0xa0, 0xa1, 0xdb,
+	0x60, 0xf9, 0x68, 0xce, 0x41, 0x0a, 0x4d, 0xf3, 0x1e, 0x74, 0x0f, 0xfa, 0x2b, 0x94, 0x70, 0x4c,
+	0xec, 0xae, 0x2a, 0xb3, 0x01, 0x41, 0xc3, 0xd0, 0xca, 0x0e, 0x87, 0x3e, 0x23, 0x1f, 0xda, 0x8c,
+	0x48, 0xbd, 0x00, 0xec, 0x6c, 0xe4, 0xa2, 0xb6, 0xfc, 0x8a, 0x67, 0x9c, 0xf2, 0x33, 0x93, 0x88,
+	0x1b, 0xe6, 0x62, 0x70, 0x17, 0x7a, 0x79, 0xb7, 0x5e, 0x8b, 0xaa, 0xf6, 0x7f, 0x0d, 0x37, 0xf3,
+	0x22, 0x7d, 0x80, 0x25, 0xc5, 0x93, 0x6a, 0xa5, 0x27, 0xfd, 0xee, 0x40, 0xbf, 0x1c, 0xfc, 0xbf,
+	0x72, 0x66, 0x03, 0x60, 0x9a, 0xf5, 0x2d, 0x4a, 0xb3, 0x75, 0x55, 0x0f, 0x3d, 0xab, 0x39, 0x96,
+	0xe8, 0x33, 0x68, 0xd9, 0x5e, 0xd7, 0x2b, 0x7b, 0x6d, 0xad, 0xc1, 0x43, 0x68, 0x5b, 0x55, 0x91,
+	0xa5, 0x73, 0x99, 0xa5, 0x7e, 0x89, 0x8d, 0xee, 0x84, 0xb5, 0x54, 0x06, 0x3b, 0xe0, 0xbe, 0x24,
+	0x8b, 0x13, 0x3c, 0x4d, 0xcd, 0xa6, 0xfc, 0x85, 0x2c, 0x2c, 0x5c, 0x1f, 0x75, 0x43, 0xe7, 0xda,
+	0x94, 0x53, 0xc2, 0x08, 0xc1, 0x39, 0xac, 0x9f, 0xe0, 0x29, 0x9d, 0x60, 0x45, 0x7e, 0x48, 0x79,
+	0xac, 0x68, 0xc2, 0x8f, 0x04, 0x89, 0x75, 0xa1, 0x3e, 0x85, 0x06, 0xe1, 0xf3, 0xd5, 0xf5, 0x9f,
+	0xdf, 0x10, 0x1a, 0x23, 0xfa, 0x12, 0x3a, 0x98, 0xf3, 0x44, 0x61, 0xed, 0x29, 0xfd, 0x5a, 0x35,
+	0xb6, 0x8c, 0x09, 0x7e, 0x03, 0xbf, 0xfa, 0x4a, 0x29, 0x6c, 0x92, 0xb6, 0x3f, 0x6e, 0x98, 0x09,
+	0x68, 0x1b, 0x5c, 0x31, 0x4b, 0xc6, 0x53, 0xc2, 0xf2, 0x1b, 0x50, 0x3e, 0x7a, 0x82, 0xc4, 0x87,
+	0x99, 0x29, 0x2c, 0x30, 0x7a, 0xd7, 0x5a, 0x96, 0x64, 0x15, 0xf6, 0xc2, 0x42, 0x0e, 0x9e, 0x42,
+	0xa7, 0xe4, 0xa4, 0x2f, 0x3c, 0xa5, 0x64, 0x9a, 0x13, 0x22, 0x13, 0xca, 0x7c, 0xac, 0x2d, 0xf1,
+	0x31, 0xd8, 0x85, 0xfe, 0x11, 0x51, 0xfb, 0xc9, 0xd9, 0x3e, 0x99, 0x93, 0xa9, 0x2e, 0xd3, 0x1d,
+	0xf0, 0xe2, 0x84, 0x89, 0x84, 0x13, 0xae, 0xf2, 0x2f, 0x56, 0xa1, 0x30, 0x63, 0xa4, 0x91, 0x79,
+	0xd5, 0x8d, 0x10, 0x3c, 0x81, 0xb5, 0xa5, 0x28, 0x52, 0xa0, 0x07, 0xd0, 0x32, 0xb6, 0xd5, 0x7a,
+	0x17, 0x20, 0x6b, 0x0e, 0x9e, 0x81, 0x9b, 0xeb, 0xae, 0x75, 0xf7, 0x7d, 0x73, 0xf7, 0xf3, 0x09,
+	0xa3, 0x52, 0x7f, 0x7c, 0xf4, 0x13, 0x10, 0x34, 0x58, 0x32, 0x29, 0xc8, 0xa5, 0xcf, 0xc1, 0x0b,
+	0x18, 0x2c, 0xc3, 0xa4, 0xa8, 0xc2, 0xe9, 0x5a, 0x0b, 0xfd, 0x21, 0x4b, 0x2c, 0x15, 0xbd, 0xb0,
+	0x90, 0x77, 0xfe, 0x6e, 0x42, 0x53, 0x47, 0xe0, 0x68, 0x17, 0x7a, 0x4b, 0x7f, 0x32, 0xd0, 0x7a,
+	0xfe, 0xbc, 0x95, 0x7f, 0x2c, 0x23, 0xbf, 0xda, 0x20, 0x45, 0xf0, 0x3f, 0x74, 0x00, 0x83, 0xd5,
+	0x7d, 0x8e, 0x46, 0x16, 0x5f, 0xf1, 0x41, 0x18, 0xdd, 0xbe, 0xd2, 0x66, 0xc2, 0x3d, 0x83, 0xde,
+	0x21, 0x4e, 0xe5, 0x65, 0xac, 0xe1, 0xca, 0x44, 0x9b, 0xbd, 0x32, 0xba, 0x55, 0xa1, 0x35, 0xfe,
+	0xdf, 0x40, 0x3f, 0x24, 0x32, 0x65, 0xd7, 0x0e, 0xf0, 0x23, 0x0c, 0x56, 0x37, 0x54, 0xf1, 0x9e,
+	0x8a, 0xd5, 0x75, 0x75, 0xa0, 0x6f, 0x61, 0xed, 0xf5, 0xe9, 0xa9, 0x5e, 0xd1, 0xd7, 0x4d, 0xe5,
+	0x29, 0x74, 0x5f, 0xd2, 0xe9, 0xf4, 0xba, 0xee, 0x3f, 0xc1, 0xb0, 0x6a, 0xa6, 0xd1, 0xc7, 0xd6,
+	0xe1, 0x8a, 0x1d, 0x33, 0xba, 0xfb, 0x41, 0xbb, 0xed, 0x52, 0xa7, 0x34, 0x2b, 0x28, 0x4f, 0x61,
+	0x79, 0x0a, 0x47, 0xff, 0xaf, 0x52, 0x1b, 0xff, 0xe7, 0xd0, 0x2d, 0x13, 0x19, 0x95, 0x90, 0xe5,
+	0x21, 0x18, 0xad, 0x57, 0xea, 0x75, 0x88, 0x17, 0xed, 0x9f, 0x9b, 0xe6, 0x9f, 0xf6, 0xb8, 0x65,
+	0x7e, 0xbe, 0xfa, 0x77, 0x00, 0xb0, 0x70, 0xd9, 0x07, 0x7f, 0x0b, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminClient interface {
+	ListInstances(ctx context.Context, in *ListInstancesReq, opts ...grpc.CallOption) (*ListInstancesResp, error)
+	DescribeInstance(ctx context.Context, in *DescribeInstanceReq, opts ...grpc.CallOption) (*DescribeInstanceResp, error)
+	PauseInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error)
+	ResumeInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error)
+	SnapshotInstance(ctx context.Context, in *SnapshotInstanceReq, opts ...grpc.CallOption) (*InstanceOpResp, error)
+	OffloadInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error)
+	KillInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error)
+	ValidateFunctionSpec(ctx context.Context, in *ValidateFunctionSpecReq, opts ...grpc.CallOption) (*ValidateFunctionSpecResp, error)
+	SetLogLevel(ctx context.Context, in *SetLogLevelReq, opts ...grpc.CallOption) (*SetLogLevelResp, error)
+	SetAdmission(ctx context.Context, in *SetAdmissionReq, opts ...grpc.CallOption) (*SetAdmissionResp, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListInstances(ctx context.Context, in *ListInstancesReq, opts ...grpc.CallOption) (*ListInstancesResp, error) {
+	out := new(ListInstancesResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/ListInstances", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DescribeInstance(ctx context.Context, in *DescribeInstanceReq, opts ...grpc.CallOption) (*DescribeInstanceResp, error) {
+	out := new(DescribeInstanceResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/DescribeInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PauseInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error) {
+	out := new(InstanceOpResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/PauseInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResumeInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error) {
+	out := new(InstanceOpResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/ResumeInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SnapshotInstance(ctx context.Context, in *SnapshotInstanceReq, opts ...grpc.CallOption) (*InstanceOpResp, error) {
+	out := new(InstanceOpResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/SnapshotInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) OffloadInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error) {
+	out := new(InstanceOpResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/OffloadInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) KillInstance(ctx context.Context, in *InstanceOpReq, opts ...grpc.CallOption) (*InstanceOpResp, error) {
+	out := new(InstanceOpResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/KillInstance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ValidateFunctionSpec(ctx context.Context, in *ValidateFunctionSpecReq, opts ...grpc.CallOption) (*ValidateFunctionSpecResp, error) {
+	out := new(ValidateFunctionSpecResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/ValidateFunctionSpec", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetLogLevel(ctx context.Context, in *SetLogLevelReq, opts ...grpc.CallOption) (*SetLogLevelResp, error) {
+	out := new(SetLogLevelResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/SetLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetAdmission(ctx context.Context, in *SetAdmissionReq, opts ...grpc.CallOption) (*SetAdmissionResp, error) {
+	out := new(SetAdmissionResp)
+	err := c.cc.Invoke(ctx, "/admin.Admin/SetAdmission", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+type AdminServer interface {
+	ListInstances(context.Context, *ListInstancesReq) (*ListInstancesResp, error)
+	DescribeInstance(context.Context, *DescribeInstanceReq) (*DescribeInstanceResp, error)
+	PauseInstance(context.Context, *InstanceOpReq) (*InstanceOpResp, error)
+	ResumeInstance(context.Context, *InstanceOpReq) (*InstanceOpResp, error)
+	SnapshotInstance(context.Context, *SnapshotInstanceReq) (*InstanceOpResp, error)
+	OffloadInstance(context.Context, *InstanceOpReq) (*InstanceOpResp, error)
+	KillInstance(context.Context, *InstanceOpReq) (*InstanceOpResp, error)
+	ValidateFunctionSpec(context.Context, *ValidateFunctionSpecReq) (*ValidateFunctionSpecResp, error)
+	SetLogLevel(context.Context, *SetLogLevelReq) (*SetLogLevelResp, error)
+	SetAdmission(context.Context, *SetAdmissionReq) (*SetAdmissionResp, error)
+}
+
+// UnimplementedAdminServer can be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (*UnimplementedAdminServer) ListInstances(ctx context.Context, req *ListInstancesReq) (*ListInstancesResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListInstances not implemented")
+}
+func (*UnimplementedAdminServer) DescribeInstance(ctx context.Context, req *DescribeInstanceReq) (*DescribeInstanceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeInstance not implemented")
+}
+func (*UnimplementedAdminServer) PauseInstance(ctx context.Context, req *InstanceOpReq) (*InstanceOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseInstance not implemented")
+}
+func (*UnimplementedAdminServer) ResumeInstance(ctx context.Context, req *InstanceOpReq) (*InstanceOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeInstance not implemented")
+}
+func (*UnimplementedAdminServer) SnapshotInstance(ctx context.Context, req *SnapshotInstanceReq) (*InstanceOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SnapshotInstance not implemented")
+}
+func (*UnimplementedAdminServer) OffloadInstance(ctx context.Context, req *InstanceOpReq) (*InstanceOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OffloadInstance not implemented")
+}
+func (*UnimplementedAdminServer) KillInstance(ctx context.Context, req *InstanceOpReq) (*InstanceOpResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KillInstance not implemented")
+}
+func (*UnimplementedAdminServer) ValidateFunctionSpec(ctx context.Context, req *ValidateFunctionSpecReq) (*ValidateFunctionSpecResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateFunctionSpec not implemented")
+}
+func (*UnimplementedAdminServer) SetLogLevel(ctx context.Context, req *SetLogLevelReq) (*SetLogLevelResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
+func (*UnimplementedAdminServer) SetAdmission(ctx context.Context, req *SetAdmissionReq) (*SetAdmissionResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAdmission not implemented")
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_ListInstances_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListInstancesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListInstances(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/ListInstances",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListInstances(ctx, req.(*ListInstancesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DescribeInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeInstanceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/DescribeInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeInstance(ctx, req.(*DescribeInstanceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PauseInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstanceOpReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PauseInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/PauseInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PauseInstance(ctx, req.(*InstanceOpReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ResumeInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstanceOpReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ResumeInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/ResumeInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ResumeInstance(ctx, req.(*InstanceOpReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SnapshotInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotInstanceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SnapshotInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SnapshotInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SnapshotInstance(ctx, req.(*SnapshotInstanceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_OffloadInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstanceOpReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).OffloadInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/OffloadInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).OffloadInstance(ctx, req.(*InstanceOpReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_KillInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstanceOpReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).KillInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/KillInstance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).KillInstance(ctx, req.(*InstanceOpReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ValidateFunctionSpec_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateFunctionSpecReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ValidateFunctionSpec(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/ValidateFunctionSpec",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ValidateFunctionSpec(ctx, req.(*ValidateFunctionSpecReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetLogLevel(ctx, req.(*SetLogLevelReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetAdmission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetAdmissionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetAdmission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetAdmission",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetAdmission(ctx, req.(*SetAdmissionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListInstances",
+			Handler:    _Admin_ListInstances_Handler,
+		},
+		{
+			MethodName: "DescribeInstance",
+			Handler:    _Admin_DescribeInstance_Handler,
+		},
+		{
+			MethodName: "PauseInstance",
+			Handler:    _Admin_PauseInstance_Handler,
+		},
+		{
+			MethodName: "ResumeInstance",
+			Handler:    _Admin_ResumeInstance_Handler,
+		},
+		{
+			MethodName: "SnapshotInstance",
+			Handler:    _Admin_SnapshotInstance_Handler,
+		},
+		{
+			MethodName: "OffloadInstance",
+			Handler:    _Admin_OffloadInstance_Handler,
+		},
+		{
+			MethodName: "KillInstance",
+			Handler:    _Admin_KillInstance_Handler,
+		},
+		{
+			MethodName: "ValidateFunctionSpec",
+			Handler:    _Admin_ValidateFunctionSpec_Handler,
+		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _Admin_SetLogLevel_Handler,
+		},
+		{
+			MethodName: "SetAdmission",
+			Handler:    _Admin_SetAdmission_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
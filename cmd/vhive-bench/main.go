@@ -0,0 +1,122 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// vhive-bench measures the latency of the cold starts of the VMs of a function
+// image through the code paths of the vHive CRI service, reporting the
+// percentiles of each phase of the starts as JSON or CSV.
+//
+// Usage:
+//
+//	vhive-bench -image <image> [-count N] [-concurrency N] [-snapshots [-restore] [-upf [-lazy]]] [-format json|csv] [-o file]
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/ease-lab/vhive/cri"
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	image := flag.String("image", "", "Function image of the VMs")
+	count := flag.Int("count", 10, "Number of VMs started in each mode")
+	concurrency := flag.Int("concurrency", 0, "Number of VMs started at once in the concurrent mode (0 starts all of them at once)")
+	snapshotter := flag.String("ss", "devmapper", "snapshotter name")
+	hostIface := flag.String("hostIface", "", "Host net-interface for the VMs to bind to for internet access")
+	isSnapshotsEnabled := flag.Bool("snapshots", false, "Enable VM snapshots")
+	restore := flag.Bool("restore", false, "Also measure the restores of the VMs from their snapshots (requires -snapshots)")
+	isUPFEnabled := flag.Bool("upf", false, "Restore the VMs with user-level page faults, i.e., REAP (requires -snapshots)")
+	isLazyMode := flag.Bool("lazy", false, "Enable lazy serving mode when UPFs are enabled")
+	guestAgentPort := flag.Uint("guestAgentPort", 0, "Vsock port of the guest agent in the VMs, whose readiness is then measured (0 disables it)")
+	configPath := flag.String("config", "", "YAML file of the configuration of the VMs (empty uses the defaults)")
+	format := flag.String("format", "json", "Format of the report (json or csv)")
+	output := flag.String("o", "", "File of the report (empty writes it on stdout)")
+	debug := flag.Bool("dbg", false, "Enable debug logging")
+
+	flag.Parse()
+
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	switch {
+	case *image == "":
+		log.Fatal("-image is required")
+	case *format != "json" && *format != "csv":
+		log.Fatalf("unknown report format %q", *format)
+	case (*restore || *isUPFEnabled) && !*isSnapshotsEnabled:
+		log.Fatal("-restore and -upf require -snapshots")
+	case *isLazyMode && !*isUPFEnabled:
+		log.Fatal("-lazy requires -upf")
+	}
+
+	config := cri.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if config, err = cri.LoadConfig(*configPath); err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+	}
+
+	orch := ctriface.NewOrchestrator(*snapshotter, *hostIface,
+		ctriface.WithTestModeOn(false),
+		ctriface.WithSnapshots(*isSnapshotsEnabled),
+		ctriface.WithUPF(*isUPFEnabled),
+		ctriface.WithLazyMode(*isLazyMode),
+	)
+	defer orch.Cleanup()
+
+	report, err := cri.RunColdStartBench(context.Background(), orch, cri.BenchConfig{
+		Image:          *image,
+		Count:          *count,
+		Concurrency:    *concurrency,
+		Restore:        *restore,
+		GuestAgentPort: uint32(*guestAgentPort),
+		Config:         config,
+	})
+	if err != nil {
+		log.Fatalf("benchmark failed: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("failed to create report: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "csv" {
+		err = report.WriteCSV(w)
+	} else {
+		err = report.WriteJSON(w)
+	}
+	if err != nil {
+		log.Errorf("failed to write report: %v", err)
+	}
+}
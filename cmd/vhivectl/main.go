@@ -0,0 +1,398 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// vhivectl inspects the function instances of a vHive node through its admin service.
+//
+// Usage:
+//
+//	vhivectl [-sock path] instances list [--by-namespace]
+//	vhivectl [-sock path] instances describe <container or VM ID>
+//	vhivectl [-sock path] instances pause|resume|offload|kill <container or VM ID>
+//	vhivectl [-sock path] instances snapshot <container or VM ID> [name]
+//	vhivectl [-sock path] validate [-env KEY=VALUE]... [-annotation KEY=VALUE]...
+//	vhivectl [-sock path] loglevel <component> <level>
+//	vhivectl [-sock path] admission open|drain|closed
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const usage = `usage: vhivectl [-sock path] instances list [--by-namespace]
+       vhivectl [-sock path] instances describe <container or VM ID>
+       vhivectl [-sock path] instances pause|resume|offload|kill <container or VM ID>
+       vhivectl [-sock path] instances snapshot <container or VM ID> [name]
+       vhivectl [-sock path] validate [-env KEY=VALUE]... [-annotation KEY=VALUE]...
+       vhivectl [-sock path] loglevel <component> <level>
+       vhivectl [-sock path] admission open|drain|closed`
+
+func main() {
+	sock := flag.String("sock", "/etc/firecracker-containerd/vhive-admin.sock", "Socket address of the vHive admin service")
+	timeout := flag.Duration("timeout", 10*time.Second, "Timeout of the requests to the admin service")
+	tlsCA := flag.String("tlsCA", "", "CA of the certificate of the admin service, connecting over TLS if set")
+	tlsCert := flag.String("tlsCert", "", "Client certificate presented to the admin service")
+	tlsKey := flag.String("tlsKey", "", "Key of -tlsCert")
+	tlsServerName := flag.String("tlsServerName", "localhost", "Name of the admin service in its certificate")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	args := flag.Args()
+	validate := len(args) > 0 && args[0] == "validate"
+	logLevel := len(args) == 3 && args[0] == "loglevel"
+	admission := len(args) == 2 && args[0] == "admission"
+	if !validate && !logLevel && !admission && (len(args) < 2 || args[0] != "instances") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var specReq *adminpb.ValidateFunctionSpecReq
+	if validate {
+		var err error
+		if specReq, err = parseSpecArgs(args[1:]); err != nil {
+			fmt.Fprintln(flag.CommandLine.Output(), err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	creds := grpc.WithInsecure()
+	if *tlsCA != "" {
+		tlsConfig, err := clientTLSConfig(*tlsCA, *tlsCert, *tlsKey, *tlsServerName)
+		if err != nil {
+			log.Fatalf("invalid TLS configuration: %v", err)
+		}
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+
+	conn, err := grpc.DialContext(ctx, "unix://"+*sock, creds, grpc.WithBlock())
+	if err != nil {
+		log.Fatalf("failed to connect to the admin service at %s: %v", *sock, err)
+	}
+	defer conn.Close()
+
+	client := adminpb.NewAdminClient(conn)
+
+	switch {
+	case validate:
+		var valid bool
+		if valid, err = validateSpec(ctx, client, specReq, os.Stdout); err == nil && !valid {
+			os.Exit(1)
+		}
+	case logLevel:
+		err = setLogLevel(ctx, client, args[1], args[2], os.Stdout)
+	case admission:
+		err = setAdmission(ctx, client, args[1], os.Stdout)
+	case args[1] == "list" && len(args) == 2:
+		err = listInstances(ctx, client, false, os.Stdout)
+	case args[1] == "list" && len(args) == 3 && args[2] == "--by-namespace":
+		err = listInstances(ctx, client, true, os.Stdout)
+	case args[1] == "describe" && len(args) == 3:
+		err = describeInstance(ctx, client, args[2], os.Stdout)
+	case args[1] == "snapshot" && (len(args) == 3 || len(args) == 4):
+		name := ""
+		if len(args) == 4 {
+			name = args[3]
+		}
+		err = printOp(client.SnapshotInstance(ctx, &adminpb.SnapshotInstanceReq{Id: args[2], Name: name}))
+	case args[1] == "pause" && len(args) == 3:
+		err = printOp(client.PauseInstance(ctx, &adminpb.InstanceOpReq{Id: args[2]}))
+	case args[1] == "resume" && len(args) == 3:
+		err = printOp(client.ResumeInstance(ctx, &adminpb.InstanceOpReq{Id: args[2]}))
+	case args[1] == "offload" && len(args) == 3:
+		err = printOp(client.OffloadInstance(ctx, &adminpb.InstanceOpReq{Id: args[2]}))
+	case args[1] == "kill" && len(args) == 3:
+		err = printOp(client.KillInstance(ctx, &adminpb.InstanceOpReq{Id: args[2]}))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// clientTLSConfig returns the TLS config trusting the CA of the admin service,
+// presenting the client certificate if set
+func clientTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no valid certificate in %s", caFile)
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+		ServerName: serverName,
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// printOp prints the outcome of a lifecycle operation with its latency
+func printOp(resp *adminpb.InstanceOpResp, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if inst := resp.GetInstance(); inst != nil {
+		fmt.Printf("VM %s is %s\n", inst.VmId, inst.State)
+	}
+	fmt.Printf("Latency: %s\n", time.Duration(resp.LatencyUs)*time.Microsecond)
+	for _, phase := range resp.GetPhases() {
+		fmt.Printf("  %s: %s\n", phase.Name, time.Duration(phase.Us*float64(time.Microsecond)))
+	}
+
+	return nil
+}
+
+// listInstances prints the instances of the node, one per line, followed
+// by the usage of each namespace if byNamespace is set
+func listInstances(ctx context.Context, client adminpb.AdminClient, byNamespace bool, w io.Writer) error {
+	resp, err := client.ListInstances(ctx, &adminpb.ListInstancesReq{ByNamespace: byNamespace})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tVM\tREVISION\tIMAGE\tGUEST\tMEMORY (MiB)\tVCPUS\tBOOT\tUPTIME\tSTATE")
+
+	for _, inst := range resp.GetInstances() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			orNone(inst.ContainerId), inst.VmId, inst.Revision, inst.Image, guestAddr(inst),
+			inst.MemSizeMib, inst.VcpuCount, inst.BootType, uptime(inst), inst.State)
+	}
+	if err := tw.Flush(); err != nil || !byNamespace {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tVMS\tMAX VMS\tMEMORY (MiB)\tMAX MEMORY (MiB)")
+
+	for _, ns := range resp.GetNamespaces() {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\n", orNone(ns.Namespace),
+			ns.Vms, orUnlimited(uint64(ns.MaxVms)), ns.MemSizeMib, orUnlimited(ns.MaxMemSizeMib))
+	}
+
+	return tw.Flush()
+}
+
+// describeInstance prints an instance with its snapshot lineage and recent events
+func describeInstance(ctx context.Context, client adminpb.AdminClient, id string, w io.Writer) error {
+	resp, err := client.DescribeInstance(ctx, &adminpb.DescribeInstanceReq{Id: id})
+	if err != nil {
+		return err
+	}
+
+	inst := resp.GetInstance()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Container:\t%s\n", orNone(inst.ContainerId))
+	fmt.Fprintf(tw, "VM:\t%s\n", inst.VmId)
+	fmt.Fprintf(tw, "Revision:\t%s\n", inst.Revision)
+	fmt.Fprintf(tw, "Image:\t%s\n", inst.Image)
+	fmt.Fprintf(tw, "Guest:\t%s\n", guestAddr(inst))
+	fmt.Fprintf(tw, "Memory (MiB):\t%d\n", inst.MemSizeMib)
+	fmt.Fprintf(tw, "vCPUs:\t%d\n", inst.VcpuCount)
+	fmt.Fprintf(tw, "Boot:\t%s\n", inst.BootType)
+	fmt.Fprintf(tw, "Started:\t%s\n", formatTime(inst.StartTimeUnixNano))
+	fmt.Fprintf(tw, "Uptime:\t%s\n", uptime(inst))
+	fmt.Fprintf(tw, "State:\t%s\n", inst.State)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nSnapshot lineage:")
+	if len(resp.GetSnapshotLineage()) == 0 {
+		fmt.Fprintln(w, "  <none>")
+	}
+	for _, snap := range resp.GetSnapshotLineage() {
+		fmt.Fprintf(w, "  %s  VM %s of %s, loaded %d times\n",
+			formatTime(snap.CreatedUnixNano), snap.VmId, snap.Image, snap.Loads)
+	}
+
+	if len(resp.GetBootPhases()) > 0 {
+		fmt.Fprintln(w, "\nBoot phases:")
+		for _, phase := range resp.GetBootPhases() {
+			fmt.Fprintf(w, "  %s: %s\n", phase.Name, time.Duration(phase.Us*float64(time.Microsecond)).Round(time.Microsecond))
+		}
+	}
+
+	fmt.Fprintln(w, "\nEvents:")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, event := range resp.GetEvents() {
+		eventType := "Normal"
+		if event.Warning {
+			eventType = "Warning"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", formatTime(event.TimeUnixNano), eventType, event.Type, event.Message)
+	}
+
+	return tw.Flush()
+}
+
+// keyValues collects the KEY=VALUE pairs of a repeated flag
+type keyValues []*adminpb.KeyValue
+
+func (kvs *keyValues) String() string {
+	return ""
+}
+
+func (kvs *keyValues) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("%q is not a KEY=VALUE pair", value)
+	}
+
+	*kvs = append(*kvs, &adminpb.KeyValue{Key: parts[0], Value: parts[1]})
+	return nil
+}
+
+// parseSpecArgs parses the environment and the annotations of the spec to validate
+func parseSpecArgs(args []string) (*adminpb.ValidateFunctionSpecReq, error) {
+	var envs, annotations keyValues
+
+	// Errors are printed with the usage of vhivectl
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&envs, "env", "Environment variable of the user container, as KEY=VALUE")
+	fs.Var(&annotations, "annotation", "Annotation of the user container, as KEY=VALUE")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	return &adminpb.ValidateFunctionSpecReq{Envs: envs, Annotations: annotations}, nil
+}
+
+// validateSpec prints the problems and the warnings of the spec of a function,
+// returning whether it is valid
+func validateSpec(ctx context.Context, client adminpb.AdminClient, req *adminpb.ValidateFunctionSpecReq, w io.Writer) (bool, error) {
+	resp, err := client.ValidateFunctionSpec(ctx, req)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.Valid {
+		fmt.Fprintln(w, "The function spec is valid")
+	}
+	for _, p := range resp.GetProblems() {
+		fmt.Fprintf(w, "Error: %s: %s\n", p.Field, p.Message)
+	}
+	for _, warning := range resp.GetWarnings() {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+
+	return resp.Valid, nil
+}
+
+// setLogLevel changes the log level of a component, printing the levels of all the components
+func setLogLevel(ctx context.Context, client adminpb.AdminClient, component, level string, w io.Writer) error {
+	resp, err := client.SetLogLevel(ctx, &adminpb.SetLogLevelReq{Component: component, Level: level})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tLEVEL")
+	for _, l := range resp.GetLevels() {
+		fmt.Fprintf(tw, "%s\t%s\n", l.Component, l.Level)
+	}
+
+	return tw.Flush()
+}
+
+// setAdmission sets the admission mode of the node, printing the change
+func setAdmission(ctx context.Context, client adminpb.AdminClient, mode string, w io.Writer) error {
+	resp, err := client.SetAdmission(ctx, &adminpb.SetAdmissionReq{Mode: mode})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Admission mode set to %s, was %s\n", resp.GetMode(), resp.GetPrevious())
+	return nil
+}
+
+func guestAddr(inst *adminpb.Instance) string {
+	if inst.GuestIp == "" {
+		return "<none>"
+	}
+	return inst.GuestIp + ":" + inst.GuestPort
+}
+
+func uptime(inst *adminpb.Instance) time.Duration {
+	return (time.Duration(inst.UptimeMs) * time.Millisecond).Round(time.Second)
+}
+
+func formatTime(unixNano int64) string {
+	return time.Unix(0, unixNano).Format(time.RFC3339)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+func orUnlimited(max uint64) string {
+	if max == 0 {
+		return "<unlimited>"
+	}
+	return fmt.Sprint(max)
+}
@@ -0,0 +1,271 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// adminServer serves the admin API from the instances of the coordinator
+type adminServer struct {
+	adminpb.UnimplementedAdminServer
+	coordinator *coordinator
+	// service validates the specs of functions
+	service *Service
+}
+
+// RegisterAdmin registers the admin service on the given gRPC server
+func (s *Service) RegisterAdmin(server *grpc.Server) {
+	adminpb.RegisterAdminServer(server, &adminServer{coordinator: s.coordinator, service: s})
+}
+
+// ListInstances lists the active and offloaded function instances
+func (a *adminServer) ListInstances(ctx context.Context, req *adminpb.ListInstancesReq) (*adminpb.ListInstancesResp, error) {
+	infos := a.coordinator.ListInstances()
+
+	resp := &adminpb.ListInstancesResp{Instances: make([]*adminpb.Instance, 0, len(infos))}
+	for _, info := range infos {
+		resp.Instances = append(resp.Instances, instanceToProto(info))
+	}
+
+	if req.GetByNamespace() {
+		for _, usage := range a.coordinator.NamespaceUsages() {
+			resp.Namespaces = append(resp.Namespaces, &adminpb.NamespaceUsage{
+				Namespace:     usage.Namespace,
+				Vms:           usage.VMs,
+				MemSizeMib:    usage.MemoryMib,
+				MaxVms:        usage.Quota.MaxVMs,
+				MaxMemSizeMib: usage.Quota.MaxMemoryMib,
+			})
+		}
+	}
+
+	return resp, nil
+}
+
+// DescribeInstance describes the instance with the given container or VM ID
+func (a *adminServer) DescribeInstance(ctx context.Context, req *adminpb.DescribeInstanceReq) (*adminpb.DescribeInstanceResp, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "instance ID is empty")
+	}
+
+	details, ok := a.coordinator.DescribeInstance(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "instance %s not found", req.GetId())
+	}
+
+	resp := &adminpb.DescribeInstanceResp{Instance: instanceToProto(details.VMInfo)}
+	for _, snap := range details.SnapshotLineage {
+		resp.SnapshotLineage = append(resp.SnapshotLineage, &adminpb.Snapshot{
+			VmId:            snap.VMID,
+			Image:           snap.Image,
+			CreatedUnixNano: snap.Created.UnixNano(),
+			Loads:           snap.Loads,
+			Name:            snap.Name,
+		})
+	}
+	for _, event := range details.Events {
+		resp.Events = append(resp.Events, &adminpb.Event{
+			TimeUnixNano: event.Time.UnixNano(),
+			Type:         event.Type,
+			Message:      event.Message,
+			Warning:      event.Warning,
+		})
+	}
+	if trace := details.BootTrace; trace != nil {
+		for name, ms := range trace.PhasesMs {
+			resp.BootPhases = append(resp.BootPhases, &adminpb.Latency{Name: name, Us: ms * 1000})
+		}
+		sort.Slice(resp.BootPhases, func(i, j int) bool {
+			return resp.BootPhases[i].Name < resp.BootPhases[j].Name
+		})
+	}
+
+	return resp, nil
+}
+
+// PauseInstance pauses the running VM of an instance
+func (a *adminServer) PauseInstance(ctx context.Context, req *adminpb.InstanceOpReq) (*adminpb.InstanceOpResp, error) {
+	return a.instanceOp(ctx, req.GetId(), func(ctx context.Context, id string) (*metrics.Metric, error) {
+		return a.coordinator.PauseInstance(ctx, id)
+	})
+}
+
+// ResumeInstance resumes the paused or offloaded VM of an instance
+func (a *adminServer) ResumeInstance(ctx context.Context, req *adminpb.InstanceOpReq) (*adminpb.InstanceOpResp, error) {
+	return a.instanceOp(ctx, req.GetId(), func(ctx context.Context, id string) (*metrics.Metric, error) {
+		return a.coordinator.ResumeInstance(ctx, id)
+	})
+}
+
+// SnapshotInstance creates a named snapshot of the VM of an instance
+func (a *adminServer) SnapshotInstance(ctx context.Context, req *adminpb.SnapshotInstanceReq) (*adminpb.InstanceOpResp, error) {
+	return a.instanceOp(ctx, req.GetId(), func(ctx context.Context, id string) (*metrics.Metric, error) {
+		return a.coordinator.SnapshotInstance(ctx, id, req.GetName())
+	})
+}
+
+// OffloadInstance offloads the VM of an instance
+func (a *adminServer) OffloadInstance(ctx context.Context, req *adminpb.InstanceOpReq) (*adminpb.InstanceOpResp, error) {
+	return a.instanceOp(ctx, req.GetId(), func(ctx context.Context, id string) (*metrics.Metric, error) {
+		return a.coordinator.OffloadInstance(ctx, id)
+	})
+}
+
+// KillInstance stops the VM of an instance
+func (a *adminServer) KillInstance(ctx context.Context, req *adminpb.InstanceOpReq) (*adminpb.InstanceOpResp, error) {
+	return a.instanceOp(ctx, req.GetId(), func(ctx context.Context, id string) (*metrics.Metric, error) {
+		return a.coordinator.KillInstance(ctx, id)
+	})
+}
+
+// ValidateFunctionSpec reports all the problems of the spec of a function
+func (a *adminServer) ValidateFunctionSpec(ctx context.Context, req *adminpb.ValidateFunctionSpecReq) (*adminpb.ValidateFunctionSpecResp, error) {
+	r := &criapi.CreateContainerRequest{
+		Config: &criapi.ContainerConfig{
+			Metadata:    &criapi.ContainerMetadata{Name: userContainerName},
+			Annotations: make(map[string]string),
+		},
+	}
+	for _, kv := range req.GetEnvs() {
+		r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: kv.GetKey(), Value: kv.GetValue()})
+	}
+	for _, kv := range req.GetAnnotations() {
+		r.Config.Annotations[kv.GetKey()] = kv.GetValue()
+	}
+
+	spec, err := a.service.parseFunctionSpec(r, a.coordinator.config.get())
+
+	var problems SpecErrors
+	if err != nil && !errors.As(err, &problems) {
+		return nil, err
+	}
+
+	resp := &adminpb.ValidateFunctionSpecResp{Valid: err == nil}
+	for _, p := range problems {
+		resp.Problems = append(resp.Problems, &adminpb.SpecProblem{Field: p.Field, Message: p.Message})
+	}
+	if spec != nil {
+		resp.Warnings = spec.warnings
+	}
+
+	return resp, nil
+}
+
+// SetLogLevel changes the log level of a component, which a reload of the
+// config file resets to the level of the file
+func (a *adminServer) SetLogLevel(ctx context.Context, req *adminpb.SetLogLevelReq) (*adminpb.SetLogLevelResp, error) {
+	level, err := logging.ParseLevel(req.GetComponent(), req.GetLevel())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := logging.SetLevel(req.GetComponent(), level); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.WithFields(log.Fields{"component": req.GetComponent(), "level": level}).Info("log level changed through the admin API")
+
+	levels := logging.Levels()
+	resp := &adminpb.SetLogLevelResp{}
+	for _, component := range logging.Components() {
+		resp.Levels = append(resp.Levels, &adminpb.LogLevel{Component: component, Level: levels[component].String()})
+	}
+
+	return resp, nil
+}
+
+// SetAdmission sets which containers the node accepts
+func (a *adminServer) SetAdmission(ctx context.Context, req *adminpb.SetAdmissionReq) (*adminpb.SetAdmissionResp, error) {
+	mode, err := ParseAdmissionMode(req.GetMode())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	previous, err := a.service.SetAdmission(mode)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	log.WithFields(log.Fields{"mode": mode, "previous": previous}).Info("admission mode set through the admin API")
+
+	return &adminpb.SetAdmissionResp{Mode: mode.String(), Previous: previous.String()}, nil
+}
+
+// instanceOp runs a lifecycle operation on an instance on behalf of the admin,
+// reporting its latency and the instance after the operation
+func (a *adminServer) instanceOp(ctx context.Context, id string, op func(ctx context.Context, id string) (*metrics.Metric, error)) (*adminpb.InstanceOpResp, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "instance ID is empty")
+	}
+
+	containerID, fi := a.coordinator.findInstance(id)
+
+	tStart := time.Now()
+	m, err := op(withAuditActor(ctx, AuditActorAdmin), id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &adminpb.InstanceOpResp{LatencyUs: time.Since(tStart).Microseconds()}
+	if fi != nil {
+		resp.Instance = instanceToProto(fi.info(containerID, time.Now()))
+	}
+
+	for name, us := range m.MetricMap {
+		resp.Phases = append(resp.Phases, &adminpb.Latency{Name: name, Us: us})
+	}
+	sort.Slice(resp.Phases, func(i, j int) bool {
+		return resp.Phases[i].Name < resp.Phases[j].Name
+	})
+
+	return resp, nil
+}
+
+func instanceToProto(info VMInfo) *adminpb.Instance {
+	return &adminpb.Instance{
+		ContainerId:       info.ContainerID,
+		VmId:              info.VMID,
+		Revision:          info.Revision,
+		Image:             info.Image,
+		GuestIp:           info.GuestIP,
+		GuestPort:         info.GuestPort,
+		MemSizeMib:        info.MemSizeMib,
+		VcpuCount:         info.VcpuCount,
+		BootType:          info.BootType,
+		StartTimeUnixNano: info.StartTime.UnixNano(),
+		UptimeMs:          info.Uptime.Milliseconds(),
+		State:             info.State,
+		Namespace:         info.Namespace,
+	}
+}
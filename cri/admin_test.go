@@ -0,0 +1,389 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newAdminClient(t *testing.T, s *Service) adminpb.AdminClient {
+	sockPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	lis, err := net.Listen("unix", sockPath)
+	require.NoError(t, err, "failed to listen on admin socket")
+
+	server := grpc.NewServer()
+	s.RegisterAdmin(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("unix://"+sockPath, grpc.WithInsecure())
+	require.NoError(t, err, "failed to dial admin socket")
+	t.Cleanup(func() { conn.Close() })
+
+	return adminpb.NewAdminClient(conn)
+}
+
+func TestAdminListInstances(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(nil, orch)
+	c := s.coordinator
+	ctx := context.Background()
+
+	for _, containerID := range []string{"ctr1", "ctr2", "ctr3"} {
+		fi, err := c.startVM(ctx, "img", ctriface.WithPrefault(true))
+		require.NoError(t, err, "could not start VM")
+
+		fi.revisionID = "img-00001"
+		require.NoError(t, c.insertActive("pod", containerID, fi), "could not insert mapping")
+	}
+
+	// Offload the VM of ctr3 and load it back for ctr4, offloading ctr2 for good
+	require.NoError(t, c.stopVM(ctx, "ctr3"))
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not load VM")
+	require.Equal(t, "3", fi.vmID, "idle VM was not loaded")
+	require.NoError(t, c.insertActive("pod", "ctr4", fi))
+	require.NoError(t, c.stopVM(ctx, "ctr2"))
+
+	client := newAdminClient(t, s)
+
+	resp, err := client.ListInstances(ctx, &adminpb.ListInstancesReq{})
+	require.NoError(t, err, "ListInstances failed")
+	require.Len(t, resp.Instances, 3, "wrong number of instances")
+
+	type row struct{ containerID, vmID, bootType, state string }
+	var rows []row
+	for _, inst := range resp.Instances {
+		rows = append(rows, row{inst.ContainerId, inst.VmId, inst.BootType, inst.State})
+
+		require.Equal(t, "img", inst.Image)
+		require.Equal(t, "img-00001", inst.Revision)
+		require.Equal(t, "190.128.0."+inst.VmId, inst.GuestIp)
+		require.Equal(t, defaultGuestPort, inst.GuestPort)
+		require.EqualValues(t, 256, inst.MemSizeMib)
+		require.EqualValues(t, 1, inst.VcpuCount)
+		require.NotZero(t, inst.StartTimeUnixNano)
+		require.True(t, inst.UptimeMs >= 0, "negative uptime")
+	}
+
+	require.Equal(t, []row{
+		{"", "2", bootCold, vmStateOffloaded},
+		{"ctr1", "1", bootCold, vmStateRunning},
+		{"ctr4", "3", bootSnapshot, vmStateRunning},
+	}, rows)
+}
+
+func TestAdminDescribeInstance(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(nil, orch)
+	c := s.coordinator
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+	require.NoError(t, c.stopVM(ctx, "ctr1"))
+
+	fi, err = c.startVM(ctx, "img")
+	require.NoError(t, err, "could not load VM")
+	require.NoError(t, c.insertActive("pod", "ctr2", fi))
+
+	client := newAdminClient(t, s)
+
+	// By container and by VM ID
+	for _, id := range []string{"ctr2", fi.vmID} {
+		resp, err := client.DescribeInstance(ctx, &adminpb.DescribeInstanceReq{Id: id})
+		require.NoError(t, err, "DescribeInstance failed")
+
+		require.Equal(t, "ctr2", resp.Instance.ContainerId)
+		require.Equal(t, fi.vmID, resp.Instance.VmId)
+		require.Equal(t, bootSnapshot, resp.Instance.BootType)
+		require.Equal(t, vmStateRunning, resp.Instance.State)
+
+		require.Len(t, resp.SnapshotLineage, 1, "wrong snapshot lineage")
+		require.Equal(t, fi.vmID, resp.SnapshotLineage[0].VmId)
+		require.Equal(t, "img", resp.SnapshotLineage[0].Image)
+		require.EqualValues(t, 1, resp.SnapshotLineage[0].Loads)
+		require.NotZero(t, resp.SnapshotLineage[0].CreatedUnixNano)
+
+		require.Len(t, resp.BootPhases, int(metrics.NumPhases), "wrong boot phases")
+		require.True(t, sort.SliceIsSorted(resp.BootPhases, func(i, j int) bool {
+			return resp.BootPhases[i].Name < resp.BootPhases[j].Name
+		}), "boot phases are not sorted")
+
+		var types []string
+		for _, event := range resp.Events {
+			types = append(types, event.Type)
+		}
+		require.Equal(t, []string{
+			eventCreated, eventBooted, eventVMStarted, eventAttached,
+			eventPaused, eventSnapshotted, eventOffloaded, eventRestored, eventVMStarted, eventAttached,
+		}, types)
+	}
+
+	_, err = client.DescribeInstance(ctx, &adminpb.DescribeInstanceReq{Id: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err), "missing instance was found")
+
+	_, err = client.DescribeInstance(ctx, &adminpb.DescribeInstanceReq{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "empty ID was accepted")
+}
+
+func phaseNames(resp *adminpb.InstanceOpResp) []string {
+	var names []string
+	for _, phase := range resp.Phases {
+		names = append(names, phase.Name)
+	}
+	return names
+}
+
+func TestAdminInstanceLifecycle(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(nil, orch)
+	c := s.coordinator
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+
+	client := newAdminClient(t, s)
+	req := &adminpb.InstanceOpReq{Id: "ctr1"}
+
+	requireIllegal := func(err error, msg string) {
+		t.Helper()
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), msg)
+	}
+
+	_, err = client.ResumeInstance(ctx, req)
+	requireIllegal(err, "running VM was resumed")
+
+	resp, err := client.PauseInstance(ctx, req)
+	require.NoError(t, err, "PauseInstance failed")
+	require.Equal(t, vmStatePaused, resp.Instance.State)
+	require.Equal(t, []string{metrics.PauseVM}, phaseNames(resp))
+	require.True(t, resp.LatencyUs >= 0, "negative latency")
+
+	_, err = client.PauseInstance(ctx, req)
+	requireIllegal(err, "paused VM was paused")
+
+	// A paused VM is snapshotted as is
+	resp, err = client.SnapshotInstance(ctx, &adminpb.SnapshotInstanceReq{Id: "ctr1", Name: "paused"})
+	require.NoError(t, err, "SnapshotInstance failed")
+	require.Equal(t, vmStatePaused, resp.Instance.State)
+	require.Equal(t, []string{metrics.CreateSnapshot}, phaseNames(resp))
+
+	resp, err = client.ResumeInstance(ctx, req)
+	require.NoError(t, err, "ResumeInstance failed")
+	require.Equal(t, vmStateRunning, resp.Instance.State)
+	require.Equal(t, []string{metrics.FcResume}, phaseNames(resp))
+
+	// A running VM is paused for the snapshot and resumed afterwards
+	resp, err = client.SnapshotInstance(ctx, &adminpb.SnapshotInstanceReq{Id: fi.vmID, Name: "running"})
+	require.NoError(t, err, "SnapshotInstance failed")
+	require.Equal(t, vmStateRunning, resp.Instance.State)
+	require.Equal(t, []string{metrics.CreateSnapshot, metrics.FcResume, metrics.PauseVM}, phaseNames(resp))
+
+	resp, err = client.OffloadInstance(ctx, req)
+	require.NoError(t, err, "OffloadInstance failed")
+	require.Equal(t, vmStateOffloaded, resp.Instance.State)
+	require.Contains(t, phaseNames(resp), metrics.OffloadVM)
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of offloaded VM is committed")
+
+	_, err = client.PauseInstance(ctx, req)
+	requireIllegal(err, "offloaded VM was paused")
+	_, err = client.SnapshotInstance(ctx, &adminpb.SnapshotInstanceReq{Id: "ctr1"})
+	requireIllegal(err, "offloaded VM was snapshotted")
+	_, err = client.OffloadInstance(ctx, req)
+	requireIllegal(err, "offloaded VM was offloaded")
+
+	// The VM of a container is loaded back on resume
+	resp, err = client.ResumeInstance(ctx, req)
+	require.NoError(t, err, "ResumeInstance failed")
+	require.Equal(t, vmStateRunning, resp.Instance.State)
+	require.Equal(t, bootSnapshot, resp.Instance.BootType)
+
+	desc, err := client.DescribeInstance(ctx, &adminpb.DescribeInstanceReq{Id: "ctr1"})
+	require.NoError(t, err, "DescribeInstance failed")
+	var names []string
+	for _, snap := range desc.SnapshotLineage {
+		names = append(names, snap.Name)
+	}
+	require.Equal(t, []string{"paused", "running", ""}, names, "wrong snapshot lineage")
+
+	resp, err = client.KillInstance(ctx, req)
+	require.NoError(t, err, "KillInstance failed")
+	require.Equal(t, vmStateStopped, resp.Instance.State)
+	require.Equal(t, []string{metrics.StopVM}, phaseNames(resp))
+	require.Equal(t, 1, orch.Stopped[fi.vmID], "VM was not stopped")
+	require.False(t, c.isActive("ctr1"), "killed instance is active")
+
+	_, err = client.KillInstance(ctx, req)
+	require.Equal(t, codes.NotFound, status.Code(err), "killed instance was found")
+
+	// The container is removed later by kubelet
+	require.NoError(t, c.stopVM(ctx, "ctr1"))
+}
+
+func TestAdminIdleInstance(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(nil, orch)
+	c := s.coordinator
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+	require.NoError(t, c.stopVM(ctx, "ctr1"))
+
+	client := newAdminClient(t, s)
+	req := &adminpb.InstanceOpReq{Id: fi.vmID}
+
+	// Idle VMs are only loaded for new containers
+	_, err = client.ResumeInstance(ctx, req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "idle VM was resumed")
+
+	_, err = client.KillInstance(ctx, req)
+	require.NoError(t, err, "KillInstance failed")
+	require.Nil(t, c.getIdleInstance("img"), "killed VM is idle")
+}
+
+func TestAdminOffloadWithoutSnapshots(t *testing.T) {
+	s := newTestService(nil, fakes.NewOrchestrator())
+	ctx := context.Background()
+
+	fi, err := s.coordinator.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, s.coordinator.insertActive("pod", "ctr1", fi))
+
+	client := newAdminClient(t, s)
+
+	_, err = client.OffloadInstance(ctx, &adminpb.InstanceOpReq{Id: "ctr1"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "VM was offloaded without snapshots")
+}
+
+func TestAdminConcurrentOps(t *testing.T) {
+	s := newTestService(nil, fakes.NewOrchestrator())
+	ctx := context.Background()
+
+	fi, err := s.coordinator.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, s.coordinator.insertActive("pod", "ctr1", fi))
+
+	client := newAdminClient(t, s)
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := client.PauseInstance(ctx, &adminpb.InstanceOpReq{Id: "ctr1"})
+			errs <- err
+		}()
+	}
+
+	paused := 0
+	for i := 0; i < n; i++ {
+		if err := <-errs; err == nil {
+			paused++
+		} else {
+			require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		}
+	}
+	require.Equal(t, 1, paused, "VM was paused more than once")
+}
+
+func TestAdminSetLogLevel(t *testing.T) {
+	s := newTestService(nil, fakes.NewOrchestrator())
+	ctx := context.Background()
+	hook := captureLogs(t, logging.Snapshots, log.InfoLevel)
+
+	client := newAdminClient(t, s)
+
+	resp, err := client.SetLogLevel(ctx, &adminpb.SetLogLevelReq{Component: logging.Snapshots, Level: "debug"})
+	require.NoError(t, err, "failed to set the log level")
+
+	levels := make(map[string]string)
+	for _, l := range resp.GetLevels() {
+		levels[l.GetComponent()] = l.GetLevel()
+	}
+	require.Len(t, levels, len(logging.Components()), "levels of all the components were not returned")
+	require.Equal(t, "debug", levels[logging.Snapshots], "level of the snapshots was not changed")
+	require.Equal(t, "info", levels[logging.CRI], "level of the CRI was changed")
+
+	snapLog.Debug("prefetched snapshot")
+	require.NotNil(t, findEntry(hook, "prefetched snapshot"), "debug entry of the snapshots was not logged after the change")
+
+	for _, req := range []*adminpb.SetLogLevelReq{
+		{Component: "scheduler", Level: "debug"},
+		{Component: logging.Snapshots, Level: "verbose"},
+	} {
+		_, err = client.SetLogLevel(ctx, req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "invalid log level %v was set", req)
+	}
+}
+
+func TestAdminSetAdmission(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	ctx := context.Background()
+
+	client := newAdminClient(t, s)
+
+	resp, err := client.SetAdmission(ctx, &adminpb.SetAdmissionReq{Mode: "drain"})
+	require.NoError(t, err, "failed to set the admission mode")
+	require.Equal(t, "drain", resp.GetMode())
+	require.Equal(t, "open", resp.GetPrevious())
+	require.True(t, s.IsDraining(), "node is not draining")
+
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.Equal(t, ErrNodeDraining, err, "user container was created on a draining node")
+
+	_, err = client.SetAdmission(ctx, &adminpb.SetAdmissionReq{Mode: "cordoned"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "unknown mode was set")
+	require.Equal(t, AdmissionDrain, s.Admission())
+
+	resp, err = client.SetAdmission(ctx, &adminpb.SetAdmissionReq{Mode: "open"})
+	require.NoError(t, err)
+	require.Equal(t, "drain", resp.GetPrevious())
+	require.False(t, s.IsDraining())
+}
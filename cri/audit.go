@@ -0,0 +1,313 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The actors of the lifecycle operations in the audit log
+const (
+	AuditActorCRI   = "cri"
+	AuditActorAdmin = "admin"
+	// AuditActorVhive is vHive itself, e.g., scaling to zero or evicting VMs
+	AuditActorVhive = "vhive"
+)
+
+// The lifecycle operations in the audit log
+const (
+	auditCreateRequested  = "CreateRequested"
+	auditContainerCreated = "ContainerCreated"
+	auditVMStarted        = "VMStarted"
+	auditVMPaused         = "VMPaused"
+	auditVMResumed        = "VMResumed"
+	auditSnapshotTaken    = "SnapshotTaken"
+	auditSnapshotRestored = "SnapshotRestored"
+	auditVMOffloaded      = "VMOffloaded"
+	auditVMStopped        = "VMStopped"
+	auditVMExited         = "VMExited"
+	auditVMRestarted      = "VMRestarted"
+)
+
+// AuditRecord is a line of the audit log, recording a lifecycle operation
+// on a VM, successful or not
+type AuditRecord struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Actor string    `json:"actor"`
+
+	SandboxID   string `json:"sandboxID,omitempty"`
+	ContainerID string `json:"containerID,omitempty"`
+	VMID        string `json:"vmID,omitempty"`
+	Revision    string `json:"revision,omitempty"`
+	Image       string `json:"image,omitempty"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+	MemSizeMib  uint32 `json:"memSizeMib,omitempty"`
+	GuestIP     string `json:"guestIP,omitempty"`
+	Snapshot    string `json:"snapshot,omitempty"`
+
+	// Error is the failure of the operation, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLog writes the lifecycle operations on the VMs as JSON lines,
+// separately from the debug logs. A nil AuditLog discards them.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is the file of the audit log, nil if it is written on stdout
+	file *rotatingFile
+	now  func() time.Time
+}
+
+// OpenAuditLog opens the audit log at path, or on stdout if path is "-".
+// The file is rotated once it exceeds maxSizeMiB, keeping maxBackups old files
+// named path.1 (the most recent) to path.<maxBackups>. A maxSizeMiB of 0 disables rotation.
+func OpenAuditLog(path string, maxSizeMiB, maxBackups int) (*AuditLog, error) {
+	if path == "-" {
+		return newAuditLog(os.Stdout), nil
+	}
+
+	f, err := openRotatingFile(path, int64(maxSizeMiB)<<20, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newAuditLog(f)
+	a.file = f
+
+	return a, nil
+}
+
+func newAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w, now: time.Now}
+}
+
+// Close closes the file of the audit log
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	return a.file.Close()
+}
+
+// record writes a record, completing it with the time, the failure of the
+// operation and the actor and revision of the context unless already set
+func (a *AuditLog) record(ctx context.Context, rec AuditRecord, err error) {
+	if a == nil {
+		return
+	}
+
+	src := auditSourceOf(ctx)
+	if rec.Actor == "" {
+		rec.Actor = src.actor
+	}
+	if rec.Revision == "" {
+		rec.Revision = src.revision
+	}
+	if rec.SandboxID == "" {
+		rec.SandboxID = src.sandboxID
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rec.Time = a.now()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.WithError(err).Error("failed to serialize audit record")
+		return
+	}
+
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		log.WithError(err).Error("failed to write audit record")
+	}
+}
+
+// auditSource is who requested the operations of a context, and for which revision
+type auditSource struct {
+	actor     string
+	revision  string
+	sandboxID string
+}
+
+type auditSourceKey struct{}
+
+// withAuditActor attributes the operations of the context to actor
+func withAuditActor(ctx context.Context, actor string) context.Context {
+	src := auditSourceOf(ctx)
+	src.actor = actor
+
+	return context.WithValue(ctx, auditSourceKey{}, src)
+}
+
+// withAuditPod attributes the operations of the context to the pod of a revision
+func withAuditPod(ctx context.Context, sandboxID, revision string) context.Context {
+	src := auditSourceOf(ctx)
+	src.sandboxID = sandboxID
+	src.revision = revision
+
+	return context.WithValue(ctx, auditSourceKey{}, src)
+}
+
+// auditSourceOf returns the source of the operations of the context,
+// vHive itself if none was set
+func auditSourceOf(ctx context.Context) auditSource {
+	if src, ok := ctx.Value(auditSourceKey{}).(auditSource); ok {
+		return src
+	}
+
+	return auditSource{actor: AuditActorVhive}
+}
+
+// auditInstance records an operation on the VM of an instance
+func (c *coordinator) auditInstance(ctx context.Context, event string, fi *funcInstance, err error) {
+	c.audit.record(ctx, instanceAuditRecord(event, fi), err)
+}
+
+// instanceAuditRecord returns the record of an operation on the VM of an instance
+func instanceAuditRecord(event string, fi *funcInstance) AuditRecord {
+	rec := AuditRecord{
+		Event:      event,
+		VMID:       fi.vmID,
+		Revision:   fi.revisionID,
+		Image:      fi.image,
+		MemSizeMib: fi.vmOpts.MemSizeMib,
+	}
+	if resp := fi.startVMResponse; resp != nil {
+		rec.GuestIP = resp.GuestIP
+		rec.ImageDigest = resp.ImageDigest
+	}
+
+	return rec
+}
+
+// rotatingFile is a file moved aside once it exceeds its maximum size
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+
+	r.f = f
+	r.size = info.Size()
+
+	return nil
+}
+
+// Write writes p, rotating the file first if p does not fit in it.
+// Each write is a whole line, so lines are never split across files.
+// If the rotation fails, p is still written to the current file.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			log.WithError(err).WithField("path", r.path).Error("failed to rotate log")
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// rotate shifts the backups, dropping the oldest, and reopens the file,
+// which is a new one unless the backups could not be shifted
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	shiftErr := r.shiftBackups()
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	return shiftErr
+}
+
+func (r *rotatingFile) shiftBackups() error {
+	if r.maxBackups == 0 {
+		return os.Remove(r.path)
+	}
+
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(r.path, r.backup(1))
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
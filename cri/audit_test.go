@@ -0,0 +1,273 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+var auditTime = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestAuditLog returns an audit log in memory with a fixed clock
+func newTestAuditLog() (*AuditLog, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	a := newAuditLog(buf)
+	a.now = func() time.Time { return auditTime }
+
+	return a, buf
+}
+
+// parseAuditLog parses the lines of an audit log, failing on any line
+// that does not follow the schema of the audit records
+func parseAuditLog(t *testing.T, data []byte) []AuditRecord {
+	t.Helper()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		var rec AuditRecord
+		require.NoError(t, dec.Decode(&rec), "audit line does not follow the schema: %s", scanner.Text())
+		require.False(t, rec.Time.IsZero(), "audit record without time: %s", scanner.Text())
+		require.NotEmpty(t, rec.Event, "audit record without event: %s", scanner.Text())
+		require.Contains(t, []string{AuditActorCRI, AuditActorAdmin, AuditActorVhive}, rec.Actor, "unknown actor: %s", scanner.Text())
+
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+// auditRecords returns the records of the audit log written so far
+func auditRecords(t *testing.T, a *AuditLog, buf *bytes.Buffer) []AuditRecord {
+	a.mu.Lock()
+	data := append([]byte(nil), buf.Bytes()...)
+	a.mu.Unlock()
+
+	return parseAuditLog(t, data)
+}
+
+func auditEvents(records []AuditRecord) []string {
+	var events []string
+	for _, rec := range records {
+		events = append(events, rec.Event)
+	}
+	return events
+}
+
+func TestAuditLogCRILifecycle(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+	audit, buf := newTestAuditLog()
+	WithAuditLog(audit)(s)
+
+	ctx := context.Background()
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: "ctr1"})
+	require.NoError(t, err, "container removal failed")
+	require.Eventually(t, func() bool {
+		return len(auditRecords(t, audit, buf)) == 4
+	}, time.Second, 10*time.Millisecond, "VM stop was not recorded")
+
+	records := auditRecords(t, audit, buf)
+	require.Equal(t, []string{auditCreateRequested, auditVMStarted, auditContainerCreated, auditVMStopped}, auditEvents(records))
+
+	for _, rec := range records {
+		require.Equal(t, auditTime, rec.Time)
+		require.Equal(t, AuditActorCRI, rec.Actor)
+		require.Equal(t, "img-00001", rec.Revision)
+		require.Empty(t, rec.Error)
+	}
+
+	started := records[1]
+	require.Equal(t, "pod", started.SandboxID)
+	require.Equal(t, "1", started.VMID)
+	require.Equal(t, "img", started.Image)
+	require.Equal(t, "sha256:img", started.ImageDigest)
+	require.EqualValues(t, defaultMemSizeMib, started.MemSizeMib)
+	require.Equal(t, "190.128.0.1", started.GuestIP)
+
+	require.Equal(t, "ctr1", records[2].ContainerID)
+	require.Equal(t, "1", records[3].VMID)
+}
+
+func TestAuditLogFailures(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.StartErr = errInjected
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	audit, buf := newTestAuditLog()
+	WithAuditLog(audit)(s)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.Error(t, err, "container creation did not fail")
+
+	records := auditRecords(t, audit, buf)
+	require.Equal(t, []string{auditCreateRequested, auditVMStarted, auditContainerCreated}, auditEvents(records))
+
+	require.Empty(t, records[0].Error)
+	require.Contains(t, records[1].Error, errInjected.Error(), "failed VM start was not recorded")
+	require.Equal(t, "img-00001", records[1].Revision)
+	require.NotEmpty(t, records[2].Error, "failed creation was not recorded")
+	require.Empty(t, records[2].ContainerID)
+
+	t.Run("Invalid spec", func(t *testing.T) {
+		audit, buf := newTestAuditLog()
+		WithAuditLog(audit)(s)
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "Invalid Image"))
+		require.Error(t, err, "container creation did not fail")
+
+		records := auditRecords(t, audit, buf)
+		require.Equal(t, []string{auditCreateRequested, auditContainerCreated}, auditEvents(records))
+		require.Equal(t, "pod2", records[1].SandboxID)
+		require.Contains(t, records[1].Error, "invalid function spec")
+	})
+}
+
+func TestAuditLogAdminOperations(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(nil, orch)
+	c := s.coordinator
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+	fi.revisionID = "img-00001"
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+
+	audit, buf := newTestAuditLog()
+	WithAuditLog(audit)(s)
+
+	client := newAdminClient(t, s)
+	req := &adminpb.InstanceOpReq{Id: "ctr1"}
+
+	_, err = client.PauseInstance(ctx, req)
+	require.NoError(t, err, "PauseInstance failed")
+	_, err = client.SnapshotInstance(ctx, &adminpb.SnapshotInstanceReq{Id: "ctr1", Name: "paused"})
+	require.NoError(t, err, "SnapshotInstance failed")
+	_, err = client.ResumeInstance(ctx, req)
+	require.NoError(t, err, "ResumeInstance failed")
+	_, err = client.OffloadInstance(ctx, req)
+	require.NoError(t, err, "OffloadInstance failed")
+	_, err = client.ResumeInstance(ctx, req)
+	require.NoError(t, err, "ResumeInstance failed")
+	_, err = client.KillInstance(ctx, req)
+	require.NoError(t, err, "KillInstance failed")
+
+	// The VM of the pod is stopped by kubelet afterwards
+	require.NoError(t, c.stopVM(ctx, "ctr1"))
+
+	records := auditRecords(t, audit, buf)
+	require.Equal(t, []string{
+		auditVMPaused,
+		auditSnapshotTaken,
+		auditVMResumed,
+		auditSnapshotTaken,
+		auditVMOffloaded,
+		auditSnapshotRestored,
+		auditVMStopped,
+	}, auditEvents(records))
+
+	for _, rec := range records {
+		require.Equal(t, AuditActorAdmin, rec.Actor)
+		require.Equal(t, fi.vmID, rec.VMID)
+		require.Equal(t, "img-00001", rec.Revision)
+		require.Empty(t, rec.Error)
+	}
+	require.Equal(t, "paused", records[1].Snapshot)
+}
+
+func TestAuditLogActor(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, AuditActorVhive, auditSourceOf(ctx).actor, "operations are not attributed to vHive by default")
+
+	ctx = withAuditPod(withAuditActor(ctx, AuditActorCRI), "pod", "rev")
+	require.Equal(t, auditSource{actor: AuditActorCRI, sandboxID: "pod", revision: "rev"}, auditSourceOf(ctx))
+
+	// A nil audit log discards the records
+	var a *AuditLog
+	a.record(ctx, AuditRecord{Event: auditVMStarted}, nil)
+	require.NoError(t, a.Close())
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	f, err := openRotatingFile(path, 512, 2)
+	require.NoError(t, err, "could not open audit log")
+	audit := newAuditLog(f)
+	audit.file = f
+
+	for i := 0; i < 40; i++ {
+		audit.record(context.Background(), AuditRecord{Event: auditVMStarted, VMID: "vm", Image: "img"}, nil)
+	}
+	require.NoError(t, audit.Close())
+
+	total := 0
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		data, err := ioutil.ReadFile(name)
+		require.NoError(t, err, "%s is missing", name)
+		require.LessOrEqual(t, len(data), 512, "%s was not rotated", name)
+
+		records := parseAuditLog(t, data)
+		require.NotEmpty(t, records, "%s is empty", name)
+		total += len(records)
+	}
+	require.Less(t, total, 40, "old audit logs were not dropped")
+
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err), "too many audit logs were kept")
+
+	// The size of an existing audit log counts towards its rotation
+	f, err = openRotatingFile(path, 512, 2)
+	require.NoError(t, err, "could not reopen audit log")
+	require.NotZero(t, f.size)
+	require.NoError(t, f.Close())
+}
+
+func TestOpenAuditLogStdout(t *testing.T) {
+	a, err := OpenAuditLog("-", 0, 0)
+	require.NoError(t, err)
+	require.Nil(t, a.file)
+	require.NoError(t, a.Close(), "stdout was closed")
+}
@@ -0,0 +1,109 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+)
+
+// batchStartConcurrency is the number of VMs of a batch booting at once
+const batchStartConcurrency = 8
+
+// startVMBatch starts count VMs of the image of a revision at once, e.g.,
+// for a scaler deploying a function at scale. The image is resolved once:
+// unless it is on the node, the VMs are started one at a time until one pulls
+// and unpacks it, then the others boot concurrently from the cached image,
+// sharing its unpacked base rootfs in the snapshotter. The VMs are not attached
+// to containers. The started VMs are returned even if others failed to start.
+func (c *coordinator) startVMBatch(ctx context.Context, revision, image string, count int, opts ...ctriface.StartVMOption) ([]*funcInstance, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid number of VMs %d", count)
+	}
+
+	ctx = withAuditPod(ctx, "", revision)
+	logger := coordLog.WithFields(log.Fields{"revision": revision, "image": image, "count": count})
+
+	var (
+		mu        sync.Mutex
+		instances = make([]*funcInstance, 0, count)
+		failed    int
+		firstErr  error
+	)
+
+	start := func() error {
+		fi, err := c.startVM(ctx, image, opts...)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			return err
+		}
+		fi.revisionID = revision
+		instances = append(instances, fi)
+		return nil
+	}
+
+	remaining := count
+	hinted := ctriface.NewStartVMOptions(opts...).ImageCached
+	for ; remaining > 0 && !hinted && !c.images.has(image); remaining-- {
+		// The other VMs would fail the same way if the image cannot be pulled
+		if err := start(); err != nil {
+			logger.WithError(err).Error("failed to resolve the image of the batch")
+			return instances, err
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, batchStartConcurrency)
+	)
+	for i := 0; i < remaining; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_ = start()
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		logger.WithError(firstErr).Errorf("failed to start %d VMs of the batch", failed)
+		return instances, fmt.Errorf("failed to start %d of %d VMs: %w", failed, count, firstErr)
+	}
+
+	logger.Debug("started batch of VMs")
+	return instances, nil
+}
@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartVMBatch(t *testing.T) {
+	ctx := context.Background()
+	memSizeMib := uint64(ctriface.NewStartVMOptions().MemSizeMib)
+
+	t.Run("ImageResolvedOnce", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+
+		instances, err := c.startVMBatch(ctx, "rev1", "img", 5)
+		require.NoError(t, err, "failed to start batch")
+		require.Len(t, instances, 5, "unexpected number of VMs")
+		require.Equal(t, 1, orch.Pulled["img"], "image was not resolved once")
+
+		vmIDs := make(map[string]bool)
+		for _, fi := range instances {
+			vmIDs[fi.vmID] = true
+			require.Equal(t, "rev1", fi.revisionID, "revision of the VM was not set")
+		}
+		require.Len(t, vmIDs, 5, "VMs of the batch are not distinct")
+		require.Equal(t, 5, orch.NumStarted(), "unexpected number of started VMs")
+		require.EqualValues(t, 5*memSizeMib, c.mem.stats().CommittedMib)
+	})
+
+	t.Run("CachedImage", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+		c.images.add("img")
+
+		instances, err := c.startVMBatch(ctx, "rev1", "img", 3)
+		require.NoError(t, err, "failed to start batch")
+		require.Len(t, instances, 3, "unexpected number of VMs")
+		require.Zero(t, orch.Pulled["img"], "cached image was pulled")
+	})
+
+	t.Run("ImageFails", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+		c.faults = newFaultRegistry()
+		require.NoError(t, c.faults.arm(FaultTapCreate, -1))
+
+		instances, err := c.startVMBatch(ctx, "rev1", "img", 5)
+		require.Error(t, err, "batch started despite the failure")
+		require.Empty(t, instances, "VMs were started")
+		require.EqualValues(t, 1, c.faults.status()[FaultTapCreate].Fired, "VMs were started after the first failed")
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.MaxRunning = 3
+		c := newCoordinator(orch)
+
+		instances, err := c.startVMBatch(ctx, "rev1", "img", 5)
+		require.Error(t, err, "batch started beyond the memory limit")
+		require.Len(t, instances, 3, "started VMs were not returned")
+		require.EqualValues(t, 3*memSizeMib, c.mem.stats().CommittedMib, "memory of the failed VMs was not released")
+	})
+
+	t.Run("InvalidCount", func(t *testing.T) {
+		_, err := newCoordinator(fakes.NewOrchestrator()).startVMBatch(ctx, "rev1", "img", 0)
+		require.Error(t, err, "empty batch was started")
+	})
+}
@@ -0,0 +1,319 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/stat"
+)
+
+// The modes of the cold-start benchmark
+const (
+	BenchSequential = "sequential"
+	BenchConcurrent = "concurrent"
+)
+
+// The kinds of VM starts measured by the cold-start benchmark
+const (
+	BenchCold    = "cold"
+	BenchRestore = "restore"
+)
+
+// BenchTotal is the phase of the benchmark covering the whole VM start
+const BenchTotal = "Total"
+
+// BenchConfig configures a cold-start benchmark
+type BenchConfig struct {
+	// Image is the function image of the VMs
+	Image string
+	// Count is the number of VMs started in each mode
+	Count int
+	// Concurrency is the number of VMs started at once in the concurrent mode, Count if 0
+	Concurrency int
+	// Restore also measures the restores of the VMs from their snapshots,
+	// which requires the orchestrator to have snapshots enabled
+	Restore bool
+	// GuestAgentPort is the vsock port of the guest agent in the VMs, whose
+	// readiness is then measured, 0 if the guest agent is disabled
+	GuestAgentPort uint32
+	// VMOptions are the options of the VMs, e.g., their size
+	VMOptions []ctriface.StartVMOption
+	// Config configures the VMs, the defaults if zero
+	Config Config
+}
+
+// PhaseStats are the percentiles of the latency of a phase of the VM starts
+type PhaseStats struct {
+	Phase   string  `json:"phase"`
+	Samples int     `json:"samples"`
+	P50Us   float64 `json:"p50Us"`
+	P95Us   float64 `json:"p95Us"`
+	P99Us   float64 `json:"p99Us"`
+}
+
+// BenchRun is the result of the VM starts of a kind in a mode
+type BenchRun struct {
+	Mode     string       `json:"mode"`
+	Kind     string       `json:"kind"`
+	Failures int          `json:"failures"`
+	Phases   []PhaseStats `json:"phases"`
+}
+
+// BenchReport is the result of a cold-start benchmark
+type BenchReport struct {
+	Image string     `json:"image"`
+	Count int        `json:"count"`
+	Runs  []BenchRun `json:"runs"`
+}
+
+// RunColdStartBench starts cfg.Count VMs of cfg.Image one after the other,
+// then cfg.Concurrency at once, through the code paths of the CRI service,
+// and reports the percentiles of the latency of each phase of their starts.
+// With cfg.Restore, the VMs of each mode are offloaded and restored from their
+// snapshots before being stopped, and their restores are reported too.
+func RunColdStartBench(ctx context.Context, orch *ctriface.Orchestrator, cfg BenchConfig) (*BenchReport, error) {
+	if orch == nil {
+		return nil, errors.New("orch must be non nil")
+	}
+
+	cfg.Config.Defaults()
+	if err := cfg.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	c := newCoordinator(orch)
+	c.guestAgentPort = cfg.GuestAgentPort
+	c.config.set(cfg.Config)
+
+	return c.runBench(ctx, cfg)
+}
+
+func (c *coordinator) runBench(ctx context.Context, cfg BenchConfig) (*BenchReport, error) {
+	switch {
+	case cfg.Image == "":
+		return nil, errors.New("image is empty")
+	case cfg.Count < 1:
+		return nil, errors.New("count must be positive")
+	case cfg.Concurrency < 0:
+		return nil, errors.New("concurrency must not be negative")
+	case cfg.Restore && (c.orch == nil || !c.orch.GetSnapshotsEnabled()):
+		return nil, errors.New("restores require snapshots to be enabled")
+	}
+
+	report := &BenchReport{Image: cfg.Image, Count: cfg.Count}
+
+	for _, mode := range []string{BenchSequential, BenchConcurrent} {
+		concurrency := 1
+		if mode == BenchConcurrent {
+			concurrency = cfg.Concurrency
+			if concurrency == 0 {
+				concurrency = cfg.Count
+			}
+		}
+
+		logger := log.WithFields(log.Fields{"mode": mode, "image": cfg.Image, "count": cfg.Count})
+		logger.Info("measuring cold starts")
+
+		instances, run := c.benchStarts(ctx, cfg, cfg.Count, concurrency, func(fi *funcInstance) *metrics.Metric {
+			return fi.bootTrace.Metric()
+		})
+		run.Mode, run.Kind = mode, BenchCold
+		report.Runs = append(report.Runs, run)
+
+		if cfg.Restore {
+			// The VMs that failed to offload are not restored but stopped
+			var offloaded, failed []*funcInstance
+			for _, fi := range instances {
+				if err := c.releaseVM(ctx, fi); err != nil {
+					fi.logger.WithError(err).Error("failed to offload VM")
+					failed = append(failed, fi)
+					continue
+				}
+				offloaded = append(offloaded, fi)
+			}
+
+			logger.Info("measuring restores")
+
+			instances, run = c.benchStarts(ctx, cfg, len(offloaded), concurrency, func(fi *funcInstance) *metrics.Metric {
+				return mergeMetrics(fi.restoreMetric)
+			})
+			run.Mode, run.Kind = mode, BenchRestore
+			report.Runs = append(report.Runs, run)
+
+			instances = append(instances, failed...)
+		}
+
+		c.benchStop(ctx, instances)
+	}
+
+	return report, nil
+}
+
+// benchStarts starts count VMs, up to concurrency at once, returning the
+// instances started and the latency of the phases returned by phases
+func (c *coordinator) benchStarts(ctx context.Context, cfg BenchConfig, count, concurrency int, phases func(fi *funcInstance) *metrics.Metric) ([]*funcInstance, BenchRun) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		instances []*funcInstance
+		samples   []*metrics.Metric
+		failures  int
+		sem       = make(chan struct{}, concurrency)
+	)
+
+	for i := 0; i < count; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			tStart := time.Now()
+			fi, err := c.startVM(ctx, cfg.Image, cfg.VMOptions...)
+			total := time.Since(tStart)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.WithError(err).Warn("failed to start VM")
+				failures++
+				return
+			}
+
+			m := phases(fi)
+			m.MetricMap[BenchTotal] = metrics.ToUS(total)
+
+			instances = append(instances, fi)
+			samples = append(samples, m)
+		}()
+	}
+
+	wg.Wait()
+
+	return instances, newBenchRun(samples, failures)
+}
+
+// benchStop stops the VMs of the benchmark
+func (c *coordinator) benchStop(ctx context.Context, instances []*funcInstance) {
+	for _, fi := range instances {
+		c.disconnectAgent(ctx, fi, true)
+		if err := c.orchStopVM(ctx, fi); err != nil {
+			fi.logger.WithError(err).Error("failed to stop VM")
+		}
+	}
+}
+
+// newBenchRun computes the percentiles of each phase of the samples,
+// the phases being sorted by name with the total last
+func newBenchRun(samples []*metrics.Metric, failures int) BenchRun {
+	byPhase := make(map[string][]float64)
+	for _, m := range samples {
+		for phase, us := range m.MetricMap {
+			byPhase[phase] = append(byPhase[phase], us)
+		}
+	}
+
+	var names []string
+	for phase := range byPhase {
+		if phase != BenchTotal {
+			names = append(names, phase)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := byPhase[BenchTotal]; ok {
+		names = append(names, BenchTotal)
+	}
+
+	run := BenchRun{Failures: failures, Phases: []PhaseStats{}}
+	for _, phase := range names {
+		us := byPhase[phase]
+		sort.Float64s(us)
+
+		run.Phases = append(run.Phases, PhaseStats{
+			Phase:   phase,
+			Samples: len(us),
+			P50Us:   stat.Quantile(0.5, stat.Empirical, us, nil),
+			P95Us:   stat.Quantile(0.95, stat.Empirical, us, nil),
+			P99Us:   stat.Quantile(0.99, stat.Empirical, us, nil),
+		})
+	}
+
+	return run
+}
+
+// WriteJSON writes the report as an indented JSON document
+func (r *BenchReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report as CSV, a row per phase of each run
+func (r *BenchReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"image", "mode", "kind", "failures", "phase", "samples", "p50Us", "p95Us", "p99Us"}); err != nil {
+		return err
+	}
+
+	for _, run := range r.Runs {
+		for _, p := range run.Phases {
+			row := []string{
+				r.Image,
+				run.Mode,
+				run.Kind,
+				strconv.Itoa(run.Failures),
+				p.Phase,
+				strconv.Itoa(p.Samples),
+				strconv.FormatFloat(p.P50Us, 'f', 1, 64),
+				strconv.FormatFloat(p.P95Us, 'f', 1, 64),
+				strconv.FormatFloat(p.P99Us, 'f', 1, 64),
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func benchPhases(run BenchRun) []string {
+	var phases []string
+	for _, p := range run.Phases {
+		phases = append(phases, p.Phase)
+	}
+	return phases
+}
+
+func TestColdStartBench(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	orch.BootDelay = 4 * time.Millisecond
+	c := newCoordinator(orch)
+
+	report, err := c.runBench(context.Background(), BenchConfig{Image: "img", Count: 4, Concurrency: 2, Restore: true})
+	require.NoError(t, err, "benchmark failed")
+
+	type runKey struct{ mode, kind string }
+	var runs []runKey
+	for _, run := range report.Runs {
+		runs = append(runs, runKey{run.Mode, run.Kind})
+		require.Zero(t, run.Failures, "VM starts failed")
+
+		for _, p := range run.Phases {
+			require.Equal(t, 4, p.Samples, "wrong number of samples of %s", p.Phase)
+			require.True(t, p.P50Us <= p.P95Us && p.P95Us <= p.P99Us, "percentiles of %s are not sorted", p.Phase)
+		}
+
+		total := run.Phases[len(run.Phases)-1]
+		require.Equal(t, BenchTotal, total.Phase, "total is not the last phase")
+
+		if run.Kind == BenchCold {
+			require.Equal(t, []string{metrics.AllocateVM, metrics.BootVM, metrics.GetImage, BenchTotal}, benchPhases(run))
+			require.GreaterOrEqual(t, total.P50Us, metrics.ToUS(orch.BootDelay), "boot time was not measured")
+		} else {
+			require.Contains(t, benchPhases(run), metrics.FcResume, "restore phases were not measured")
+		}
+	}
+	require.Equal(t, []runKey{
+		{BenchSequential, BenchCold},
+		{BenchSequential, BenchRestore},
+		{BenchConcurrent, BenchCold},
+		{BenchConcurrent, BenchRestore},
+	}, runs)
+
+	require.Equal(t, 8, orch.NumStarted(), "restores booted VMs")
+	require.Zero(t, orch.Running(), "VMs were not stopped")
+	require.Zero(t, c.mem.stats().CommittedMib, "memory of the VMs was not released")
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+	var decoded BenchReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded), "invalid JSON report")
+	require.Equal(t, *report, decoded)
+
+	buf.Reset()
+	require.NoError(t, report.WriteCSV(&buf))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err, "invalid CSV report")
+	require.Len(t, rows, 1+4+4+2*len(report.Runs[1].Phases), "wrong number of CSV rows")
+}
+
+func TestColdStartBenchFailures(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.MaxRunning = 3
+	c := newCoordinator(orch)
+
+	report, err := c.runBench(context.Background(), BenchConfig{Image: "img", Count: 4})
+	require.NoError(t, err, "benchmark failed")
+
+	for _, run := range report.Runs {
+		require.Equal(t, 1, run.Failures, "failed VM start was not counted")
+		require.Equal(t, 3, run.Phases[0].Samples)
+	}
+
+	_, err = c.runBench(context.Background(), BenchConfig{Image: "img", Count: 1, Restore: true})
+	require.Error(t, err, "restores were measured without snapshots")
+	_, err = c.runBench(context.Background(), BenchConfig{Image: "img"})
+	require.Error(t, err, "benchmark ran without VMs")
+}
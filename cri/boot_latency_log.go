@@ -0,0 +1,129 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BootLatencyRecord is a line of the boot latency log, recording the
+// breakdown of the cold start of a VM, successful or not
+type BootLatencyRecord struct {
+	Time     time.Time `json:"time"`
+	VMID     string    `json:"vmID"`
+	Revision string    `json:"revision,omitempty"`
+	Image    string    `json:"image"`
+
+	// TotalMs is the time from the start of the boot to the last phase
+	TotalMs float64 `json:"totalMs"`
+	// PhasesMs is the time spent in each phase of the boot, by phase name
+	PhasesMs map[string]float64 `json:"phasesMs"`
+
+	// Error is the failure of the boot, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// BootLatencyLog writes the breakdown of each cold start as JSON lines,
+// separately from the debug logs. A nil BootLatencyLog discards them.
+type BootLatencyLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is the file of the log, nil if it is written on stdout
+	file *rotatingFile
+	now  func() time.Time
+}
+
+// OpenBootLatencyLog opens the boot latency log at path, or on stdout if path
+// is "-", rotating it like the audit log
+func OpenBootLatencyLog(path string, maxSizeMiB, maxBackups int) (*BootLatencyLog, error) {
+	if path == "-" {
+		return newBootLatencyLog(os.Stdout), nil
+	}
+
+	f, err := openRotatingFile(path, int64(maxSizeMiB)<<20, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	l := newBootLatencyLog(f)
+	l.file = f
+
+	return l, nil
+}
+
+func newBootLatencyLog(w io.Writer) *BootLatencyLog {
+	return &BootLatencyLog{w: w, now: time.Now}
+}
+
+// Close closes the file of the boot latency log
+func (l *BootLatencyLog) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+// record writes a record, completing it with the time, the failure of the
+// boot and the revision of the context unless already set
+func (l *BootLatencyLog) record(ctx context.Context, rec BootLatencyRecord, err error) {
+	if l == nil {
+		return
+	}
+
+	if rec.Revision == "" {
+		rec.Revision = auditSourceOf(ctx).revision
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Time = l.now()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.WithError(err).Error("failed to serialize boot latency record")
+		return
+	}
+
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		log.WithError(err).Error("failed to write boot latency record")
+	}
+}
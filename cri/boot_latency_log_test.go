@@ -0,0 +1,120 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// parseBootLatencyLog parses the lines of a boot latency log, failing on any
+// line that does not follow the schema of the records
+func parseBootLatencyLog(t *testing.T, data []byte) []BootLatencyRecord {
+	t.Helper()
+
+	var records []BootLatencyRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		var rec BootLatencyRecord
+		require.NoError(t, dec.Decode(&rec), "boot latency line does not follow the schema: %s", scanner.Text())
+		require.False(t, rec.Time.IsZero(), "boot latency record without time: %s", scanner.Text())
+
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+func TestBootLatencyLog(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 20 * time.Millisecond
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	buf := new(bytes.Buffer)
+	WithBootLatencyLog(newBootLatencyLog(buf))(s)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	orch.StartErr = errInjected
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.Error(t, err, "container creation did not fail")
+
+	records := parseBootLatencyLog(t, buf.Bytes())
+	require.Len(t, records, 2, "boots were not recorded")
+
+	booted := records[0]
+	require.Equal(t, "1", booted.VMID)
+	require.Equal(t, "img", booted.Image)
+	require.Equal(t, "img-00001", booted.Revision)
+	require.Empty(t, booted.Error)
+	require.Len(t, booted.PhasesMs, int(metrics.NumPhases), "boot phases are missing")
+
+	var sum float64
+	for _, ms := range booted.PhasesMs {
+		sum += ms
+	}
+	require.InDelta(t, booted.TotalMs, sum, 0.001, "boot phases do not sum to the total")
+	require.GreaterOrEqual(t, booted.TotalMs, float64(20), "total does not include the boot")
+
+	require.Contains(t, records[1].Error, errInjected.Error(), "failed boot was not recorded")
+}
+
+func TestBootLatencyLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boot.log")
+
+	f, err := openRotatingFile(path, 512, 1)
+	require.NoError(t, err, "could not open boot latency log")
+	l := newBootLatencyLog(f)
+	l.file = f
+
+	for i := 0; i < 20; i++ {
+		l.record(context.Background(), BootLatencyRecord{VMID: "vm", Image: "img", PhasesMs: map[string]float64{"other": 1}}, nil)
+	}
+	require.NoError(t, l.Close())
+
+	for _, name := range []string{path, path + ".1"} {
+		data, err := ioutil.ReadFile(name)
+		require.NoError(t, err, "%s is missing", name)
+		require.LessOrEqual(t, len(data), 512, "%s was not rotated", name)
+		require.NotEmpty(t, parseBootLatencyLog(t, data), "%s is empty", name)
+	}
+
+	_, err = os.Stat(path + ".2")
+	require.True(t, os.IsNotExist(err), "too many boot latency logs were kept")
+}
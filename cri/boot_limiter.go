@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BootLimitStats reports the VM boots in flight on the node and the ones
+// waiting for a slot
+type BootLimitStats struct {
+	MaxInFlight int `json:"maxInFlight"`
+	InFlight    int `json:"inFlight"`
+	Queued      int `json:"queued"`
+	// Delayed counts the boots that waited for a slot, Rejected the ones that
+	// found the queue full or did not get a slot within the queue timeout
+	Delayed  uint64 `json:"delayed"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// bootLimiter bounds the VMs booting at once on the node, so that a burst of
+// creations of user containers does not thrash the host. The boots in excess
+// wait for a slot, up to maxQueue of them for at most queueTimeout, and the
+// others are rejected.
+type bootLimiter struct {
+	slots chan struct{}
+
+	maxQueue     int
+	queueTimeout time.Duration
+
+	mu    sync.Mutex
+	stats BootLimitStats
+}
+
+func newBootLimiter(maxInFlight, maxQueue int, queueTimeout time.Duration) *bootLimiter {
+	return &bootLimiter{
+		slots:        make(chan struct{}, maxInFlight),
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		stats:        BootLimitStats{MaxInFlight: maxInFlight},
+	}
+}
+
+// acquire takes a boot slot, waiting for one if the boot can be queued, and
+// returns the function that gives it back. It fails with ResourceExhausted if
+// the queue is full or no slot frees up within the queue timeout.
+func (l *bootLimiter) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+		l.started()
+		return l.release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.stats.Queued >= l.maxQueue {
+		l.stats.Rejected++
+		inFlight := l.stats.InFlight
+		l.mu.Unlock()
+
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"%d VMs are already booting on the node and %d are queued", inFlight, l.maxQueue)
+	}
+	l.stats.Queued++
+	l.stats.Delayed++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case l.slots <- struct{}{}:
+	case <-timer.C:
+		err = status.Errorf(codes.ResourceExhausted, "no VM boot slot freed up on the node within %s", l.queueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	l.stats.Queued--
+	if err != nil {
+		l.stats.Rejected++
+	}
+	l.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.started()
+	return l.release, nil
+}
+
+func (l *bootLimiter) started() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.InFlight++
+}
+
+func (l *bootLimiter) release() {
+	l.mu.Lock()
+	l.stats.InFlight--
+	l.mu.Unlock()
+
+	<-l.slots
+}
+
+func (l *bootLimiter) getStats() BootLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
@@ -0,0 +1,165 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// gatedOrchestrator holds the boots of the VMs until they are let through,
+// recording how many were booting at once
+type gatedOrchestrator struct {
+	*fakes.Orchestrator
+
+	gate chan struct{}
+
+	mu         sync.Mutex
+	booting    int
+	maxBooting int
+}
+
+func (o *gatedOrchestrator) StartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	o.mu.Lock()
+	o.booting++
+	if o.booting > o.maxBooting {
+		o.maxBooting = o.booting
+	}
+	o.mu.Unlock()
+
+	<-o.gate
+
+	o.mu.Lock()
+	o.booting--
+	o.mu.Unlock()
+
+	return o.Orchestrator.StartVM(ctx, vmID, imageName, opts...)
+}
+
+func (o *gatedOrchestrator) getBooting() (booting, maxBooting int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.booting, o.maxBooting
+}
+
+func TestBootLimitSerializesBoots(t *testing.T) {
+	orch := &gatedOrchestrator{Orchestrator: fakes.NewOrchestrator(), gate: make(chan struct{})}
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+	s.bootLimiter = newBootLimiter(2, 10, time.Minute)
+
+	const creates = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, creates)
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.CreateContainer(context.Background(), newUserContainerRequest(fmt.Sprintf("pod%d", i), "img"))
+			errs <- err
+		}(i)
+	}
+
+	require.Eventually(t, func() bool {
+		stats := s.BootLimitStats()
+		return stats.InFlight == 2 && stats.Queued == creates-2
+	}, 5*time.Second, 10*time.Millisecond, "boots in excess of the limit were not queued")
+
+	booting, _ := orch.getBooting()
+	require.Equal(t, 2, booting, "more VMs than the limit are booting")
+
+	// The control-plane containers are not limited
+	_, err := s.CreateContainer(context.Background(), &criapi.CreateContainerRequest{
+		PodSandboxId: "pod0",
+		Config:       &criapi.ContainerConfig{Metadata: &criapi.ContainerMetadata{Name: "istio-proxy"}},
+	})
+	require.NoError(t, err, "control-plane container was throttled")
+
+	for i := 0; i < creates; i++ {
+		orch.gate <- struct{}{}
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err, "container creation failed")
+	}
+
+	_, maxBooting := orch.getBooting()
+	require.Equal(t, 2, maxBooting, "boots were not limited")
+
+	stats := s.BootLimitStats()
+	require.Zero(t, stats.InFlight, "boot slots were leaked")
+	require.Zero(t, stats.Queued, "queued boots were leaked")
+	require.EqualValues(t, creates-2, stats.Delayed, "delayed boots were not counted")
+}
+
+func TestBootLimitRejects(t *testing.T) {
+	cases := []struct {
+		name         string
+		maxQueue     int
+		queueTimeout time.Duration
+		expectMsg    string
+	}{
+		{name: "Queue full", maxQueue: 0, queueTimeout: time.Minute, expectMsg: "already booting"},
+		{name: "Queue timeout", maxQueue: 1, queueTimeout: 50 * time.Millisecond, expectMsg: "within"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := newBootLimiter(1, c.maxQueue, c.queueTimeout)
+
+			release, err := l.acquire(context.Background())
+			require.NoError(t, err, "free slot was not acquired")
+
+			_, err = l.acquire(context.Background())
+			require.Error(t, err, "boot in excess was not rejected")
+			require.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error code")
+			require.Contains(t, err.Error(), c.expectMsg, "unexpected error")
+
+			release()
+
+			release, err = l.acquire(context.Background())
+			require.NoError(t, err, "released slot was not acquired")
+			release()
+
+			stats := l.getStats()
+			require.EqualValues(t, 1, stats.Rejected, "rejection was not counted")
+			require.Zero(t, stats.InFlight, "boot slots were leaked")
+			require.Zero(t, stats.Queued, "queued boots were leaked")
+		})
+	}
+}
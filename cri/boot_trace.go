@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// BootTrace records when each phase of the cold start of a VM completed
+type BootTrace struct {
+	Start            time.Time `json:"start"`
+	NetworkAllocated time.Time `json:"networkAllocated"`
+	ImageResolved    time.Time `json:"imageResolved"`
+	VMBooted         time.Time `json:"vmBooted"`
+	// AgentReady is zero if the guest agent is disabled or did not become ready
+	AgentReady time.Time `json:"agentReady"`
+	// FirecrackerVersion is the firecracker release that booted the VM,
+	// empty if the releases of the node are not configured
+	FirecrackerVersion string `json:"firecrackerVersion,omitempty"`
+	// MemoryBacking is the backing of the guest memory selected for the VM,
+	// hugepages taking effect once the VM is restored from its snapshot
+	MemoryBacking string `json:"memoryBacking"`
+	// PhasesMs is the time spent in each phase of the boot in milliseconds,
+	// by the name of the phase, summing to the time until the last phase
+	PhasesMs map[string]float64 `json:"phasesMs,omitempty"`
+}
+
+const (
+	memoryBackingAnonymous = "anonymous"
+	memoryBackingHugepages = "hugepages"
+)
+
+// newBootTrace builds the trace of a VM started at start and booted at booted
+// from the durations of the phases measured by the orchestrator
+func newBootTrace(start, booted time.Time, startVMMetric *metrics.Metric) *BootTrace {
+	t := &BootTrace{Start: start, VMBooted: booted}
+
+	var allocate, getImage float64
+	if startVMMetric != nil {
+		allocate = startVMMetric.MetricMap[metrics.AllocateVM]
+		getImage = startVMMetric.MetricMap[metrics.GetImage]
+	}
+
+	// The phases run in this order inside StartVM, which ends with the boot
+	t.NetworkAllocated = minTime(start.Add(usToDuration(allocate)), booted)
+	t.ImageResolved = minTime(t.NetworkAllocated.Add(usToDuration(getImage)), booted)
+
+	return t
+}
+
+// Metric returns the duration of each phase in microseconds, under the
+// AllocateVM, GetImage, BootVM and, if the guest agent became ready, GuestReady names
+func (t *BootTrace) Metric() *metrics.Metric {
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.AllocateVM] = metrics.ToUS(t.NetworkAllocated.Sub(t.Start))
+	m.MetricMap[metrics.GetImage] = metrics.ToUS(t.ImageResolved.Sub(t.NetworkAllocated))
+	m.MetricMap[metrics.BootVM] = metrics.ToUS(t.VMBooted.Sub(t.ImageResolved))
+	if !t.AgentReady.IsZero() {
+		m.MetricMap[metrics.GuestReady] = metrics.ToUS(t.AgentReady.Sub(t.VMBooted))
+	}
+
+	return m
+}
+
+// fields returns the duration of each phase for logging
+func (t *BootTrace) fields() log.Fields {
+	names := map[string]string{
+		metrics.AllocateVM: "network",
+		metrics.GetImage:   "image",
+		metrics.BootVM:     "boot",
+		metrics.GuestReady: "agent",
+	}
+
+	f := log.Fields{}
+	for phase, us := range t.Metric().MetricMap {
+		f[names[phase]] = usToDuration(us)
+	}
+	if t.FirecrackerVersion != "" {
+		f["firecracker"] = t.FirecrackerVersion
+	}
+	if t.MemoryBacking != "" {
+		f["memory"] = t.MemoryBacking
+	}
+
+	return f
+}
+
+func usToDuration(us float64) time.Duration {
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return b
+	}
+
+	return a
+}
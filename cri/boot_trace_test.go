@@ -0,0 +1,146 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func requireMonotonic(t *testing.T, trace *BootTrace, withAgent bool) {
+	phases := []time.Time{trace.Start, trace.NetworkAllocated, trace.ImageResolved, trace.VMBooted}
+	if withAgent {
+		phases = append(phases, trace.AgentReady)
+	} else {
+		require.True(t, trace.AgentReady.IsZero(), "agent ready without an agent")
+	}
+
+	for i, phase := range phases {
+		require.False(t, phase.IsZero(), "phase %d is not populated", i)
+		if i > 0 {
+			require.True(t, phase.After(phases[i-1]), "phase %d does not follow phase %d", i, i-1)
+		}
+	}
+}
+
+// requirePhases checks that the boot was attributed to all its phases,
+// which sum to about the time until the VM was ready
+func requirePhases(t *testing.T, trace *BootTrace, ready time.Time) {
+	require.Len(t, trace.PhasesMs, int(metrics.NumPhases), "boot phases are missing")
+
+	var sum float64
+	for p := metrics.Phase(0); p < metrics.NumPhases; p++ {
+		ms, ok := trace.PhasesMs[p.String()]
+		require.True(t, ok, "phase %s is missing", p)
+		sum += ms
+	}
+
+	total := float64(ready.Sub(trace.Start)) / float64(time.Millisecond)
+	require.InDelta(t, total, sum, 5, "boot phases do not sum to the boot time")
+}
+
+func TestBootTrace(t *testing.T) {
+	dir := t.TempDir()
+	agentPath := filepath.Join(dir, "agent.sock")
+
+	lis, err := net.Listen("unix", agentPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	server := grpc.NewServer()
+	guestagent.NewServer(nil).Register(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	t.Run("WithoutAgent", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.BootDelay = 20 * time.Millisecond
+		c := newCoordinator(orch)
+
+		fi, err := c.startVM(context.Background(), "image")
+		require.NoError(t, err, "failed to start VM")
+		require.NotNil(t, fi.bootTrace, "boot trace was not recorded")
+		requireMonotonic(t, fi.bootTrace, false)
+		requirePhases(t, fi.bootTrace, fi.bootTrace.VMBooted)
+		require.Zero(t, fi.bootTrace.PhasesMs[metrics.PhaseGuestReady.String()], "guest ready without an agent")
+	})
+
+	t.Run("WithAgent", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.BootDelay = 20 * time.Millisecond
+		orch.VsockPath = agentPath
+		c := newCoordinator(orch)
+		c.guestAgentPort = 52
+		c.agentDialer = func(vsockPath string, port uint32) guestagent.Dialer {
+			return guestagent.UnixDialer(vsockPath)
+		}
+
+		fi, err := c.startVM(context.Background(), "image")
+		require.NoError(t, err, "failed to start VM")
+		defer fi.agent.Close()
+
+		require.NotNil(t, fi.bootTrace, "boot trace was not recorded")
+		requireMonotonic(t, fi.bootTrace, true)
+		requirePhases(t, fi.bootTrace, fi.bootTrace.AgentReady)
+		for _, phase := range []metrics.Phase{metrics.PhaseTapSetup, metrics.PhaseImageResolve, metrics.PhaseDevmapper, metrics.PhaseFirecrackerAPI, metrics.PhaseGuestReady} {
+			require.NotZero(t, fi.bootTrace.PhasesMs[phase.String()], "no time attributed to phase %s", phase)
+		}
+
+		// The breakdown is part of the description of the instance
+		require.NoError(t, c.insertActive("pod", "ctr1", fi))
+		details, ok := c.DescribeInstance("ctr1")
+		require.True(t, ok, "instance was not found")
+		require.Equal(t, fi.bootTrace.PhasesMs, details.BootTrace.PhasesMs, "boot phases are not described")
+	})
+}
+
+func TestContainerStatusBootTrace(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	resp, err := s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: "ctr1"})
+	require.NoError(t, err, "container status failed")
+	require.NotContains(t, resp.GetInfo(), bootTraceInfoKey, "boot trace in non-verbose status")
+
+	resp, err = s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: "ctr1", Verbose: true})
+	require.NoError(t, err, "container status failed")
+	require.Contains(t, resp.GetInfo(), bootTraceInfoKey, "boot trace missing from verbose status")
+
+	var trace BootTrace
+	require.NoError(t, json.Unmarshal([]byte(resp.GetInfo()[bootTraceInfoKey]), &trace), "malformed boot trace")
+	require.False(t, trace.VMBooted.IsZero(), "boot trace is not populated")
+}
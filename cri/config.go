@@ -0,0 +1,307 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ease-lab/vhive/logging"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// The defaults of the fields of Config
+const (
+	defaultMemSizeMib           = 256
+	defaultVcpuCount            = 1
+	defaultGuestPort            = "50051"
+	defaultStartTimeout         = 40 * time.Second
+	defaultAgentReadyTimeout    = 2 * time.Second
+	defaultGuestReadyTimeout    = 10 * time.Second
+	defaultAgentShutdownTimeout = 2 * time.Second
+	defaultClockSyncTimeout     = 2 * time.Second
+	defaultProbePeriod          = 10 * time.Second
+	defaultProbeThreshold       = 3
+	defaultCPUBoostWindow       = 10 * time.Second
+	defaultVMConfigWaitTimeout  = time.Minute
+	defaultDrainGracePeriod     = 30 * time.Second
+	defaultPostBootHookTimeout  = 10 * time.Second
+)
+
+// maxVcpuCount is the largest number of vCPUs of a Firecracker VM
+const maxVcpuCount = 32
+
+// Config is the configuration of the VMs of the functions, set with WithConfig
+// and reloaded from its file without restarting vHive
+type Config struct {
+	// MemSizeMib is the guest memory size of the VMs
+	MemSizeMib uint32 `yaml:"memSizeMib"`
+	// VcpuCount is the number of vCPUs of the VMs
+	VcpuCount uint32 `yaml:"vcpuCount"`
+	// GuestPort is the port the functions serve on in their VMs
+	GuestPort string `yaml:"guestPort"`
+	// StartTimeout bounds the cold start of a VM
+	StartTimeout time.Duration `yaml:"startTimeout"`
+	// AgentReadyTimeout bounds how long a cold start waits for the guest agent
+	AgentReadyTimeout time.Duration `yaml:"agentReadyTimeout"`
+	// GuestReadyTimeout bounds how long StartContainer waits for the guest
+	// agent of the VM of a user container
+	GuestReadyTimeout time.Duration `yaml:"guestReadyTimeout"`
+	// AgentShutdownTimeout bounds how long a stopping VM waits for the guest
+	// agent to shut down the function gracefully
+	AgentShutdownTimeout time.Duration `yaml:"agentShutdownTimeout"`
+	// ClockSyncTimeout bounds how long a resumed VM waits for the guest agent
+	// to sync its clock
+	ClockSyncTimeout time.Duration `yaml:"clockSyncTimeout"`
+	// ProbePeriod is the period of the probes of the functions
+	// without the vhive.io/probe-period annotation
+	ProbePeriod time.Duration `yaml:"probePeriod"`
+	// ProbeFailureThreshold is the number of consecutive failed probes marking
+	// unhealthy the functions without the vhive.io/probe-failure-threshold annotation
+	ProbeFailureThreshold int32 `yaml:"probeFailureThreshold"`
+	// CPUBoostWindow is the longest CPU boost of the cold starts
+	// without the vhive.io/cpu-boost-window annotation
+	CPUBoostWindow time.Duration `yaml:"cpuBoostWindow"`
+	// VMConfigWaitTimeout bounds how long a queue-proxy created before its
+	// user container waits for the VM of its pod
+	VMConfigWaitTimeout time.Duration `yaml:"vmConfigWaitTimeout"`
+	// AllowDebugInit lets the user containers boot their VMs into another
+	// command than the guest init with GUEST_INIT_CMD, for debugging only
+	AllowDebugInit bool `yaml:"allowDebugInit"`
+	// DrainGracePeriod bounds how long a stopping user container waits for
+	// the requests in flight to its VM before the VM is stopped
+	DrainGracePeriod time.Duration `yaml:"drainGracePeriod"`
+	// TotalMemBudgetMib bounds the guest memory committed to the running
+	// VMs of the node, 0 for no budget
+	TotalMemBudgetMib uint64 `yaml:"totalMemBudgetMib"`
+	// PostBootHook is run on the host once the VM of a user container is
+	// attached to it, none by default
+	PostBootHook PostBootHook `yaml:"postBootHook"`
+	// NamespaceQuotas bound the active VMs of the Kubernetes namespaces, by
+	// namespace, "*" being the quota of the namespaces without their own
+	NamespaceQuotas map[string]NamespaceQuota `yaml:"namespaceQuotas"`
+	// MockLatencies are the latencies of the VM operations of the mock backend
+	MockLatencies MockLatencies `yaml:"mockLatencies"`
+	// LogLevels are the log levels of the components of vHive, e.g.,
+	// coordinator: debug, the others logging at the level set by -dbg
+	LogLevels map[string]string `yaml:"logLevels"`
+}
+
+// DefaultConfig returns the configuration used without a config file
+func DefaultConfig() Config {
+	var c Config
+	c.Defaults()
+	return c
+}
+
+// Defaults sets the fields of the configuration left to zero to their defaults
+func (c *Config) Defaults() {
+	if c.MemSizeMib == 0 {
+		c.MemSizeMib = defaultMemSizeMib
+	}
+	if c.VcpuCount == 0 {
+		c.VcpuCount = defaultVcpuCount
+	}
+	if c.GuestPort == "" {
+		c.GuestPort = defaultGuestPort
+	}
+	if c.StartTimeout == 0 {
+		c.StartTimeout = defaultStartTimeout
+	}
+	if c.AgentReadyTimeout == 0 {
+		c.AgentReadyTimeout = defaultAgentReadyTimeout
+	}
+	if c.GuestReadyTimeout == 0 {
+		c.GuestReadyTimeout = defaultGuestReadyTimeout
+	}
+	if c.AgentShutdownTimeout == 0 {
+		c.AgentShutdownTimeout = defaultAgentShutdownTimeout
+	}
+	if c.ClockSyncTimeout == 0 {
+		c.ClockSyncTimeout = defaultClockSyncTimeout
+	}
+	if c.ProbePeriod == 0 {
+		c.ProbePeriod = defaultProbePeriod
+	}
+	if c.ProbeFailureThreshold == 0 {
+		c.ProbeFailureThreshold = defaultProbeThreshold
+	}
+	if c.CPUBoostWindow == 0 {
+		c.CPUBoostWindow = defaultCPUBoostWindow
+	}
+	if c.VMConfigWaitTimeout == 0 {
+		c.VMConfigWaitTimeout = defaultVMConfigWaitTimeout
+	}
+	if c.DrainGracePeriod == 0 {
+		c.DrainGracePeriod = defaultDrainGracePeriod
+	}
+	if c.PostBootHook.Timeout == 0 {
+		c.PostBootHook.Timeout = defaultPostBootHookTimeout
+	}
+}
+
+// Validate checks that the configuration can be used to start VMs
+func (c Config) Validate() error {
+	if c.MemSizeMib == 0 {
+		return errors.New("memSizeMib must be positive")
+	}
+	if c.VcpuCount == 0 || c.VcpuCount > maxVcpuCount {
+		return errors.Errorf("vcpuCount must be between 1 and %d", maxVcpuCount)
+	}
+	if port, err := strconv.Atoi(c.GuestPort); err != nil || port < 1 || port > 65535 {
+		return errors.Errorf("invalid guestPort %q", c.GuestPort)
+	}
+	if c.ProbeFailureThreshold < 1 {
+		return errors.New("probeFailureThreshold must be positive")
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"startTimeout", c.StartTimeout},
+		{"agentReadyTimeout", c.AgentReadyTimeout},
+		{"guestReadyTimeout", c.GuestReadyTimeout},
+		{"agentShutdownTimeout", c.AgentShutdownTimeout},
+		{"clockSyncTimeout", c.ClockSyncTimeout},
+		{"probePeriod", c.ProbePeriod},
+		{"cpuBoostWindow", c.CPUBoostWindow},
+		{"vmConfigWaitTimeout", c.VMConfigWaitTimeout},
+		{"drainGracePeriod", c.DrainGracePeriod},
+		{"postBootHook.timeout", c.PostBootHook.Timeout},
+	} {
+		if d.value <= 0 {
+			return errors.Errorf("%s must be positive", d.name)
+		}
+	}
+
+	if _, ok := c.NamespaceQuotas[""]; ok {
+		return errors.New("namespaceQuotas has an empty namespace")
+	}
+
+	if err := c.PostBootHook.validate(); err != nil {
+		return errors.Wrap(err, "invalid postBootHook")
+	}
+
+	if err := c.MockLatencies.validate(); err != nil {
+		return errors.Wrap(err, "invalid mockLatencies")
+	}
+
+	if _, err := logging.ParseLevels(c.LogLevels); err != nil {
+		return errors.Wrap(err, "invalid logLevels")
+	}
+
+	return nil
+}
+
+// LoadConfig reads and validates the YAML configuration file at path
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "failed to read config")
+	}
+
+	cfg := DefaultConfig()
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return Config{}, errors.Wrapf(err, "failed to parse config %s", path)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, errors.Wrapf(err, "invalid config %s", path)
+	}
+
+	return cfg, nil
+}
+
+// configStore holds the current configuration, which is swapped as a whole
+// so that every operation sees a consistent snapshot of it
+type configStore struct {
+	v atomic.Value
+}
+
+func newConfigStore(cfg Config) *configStore {
+	s := &configStore{}
+	s.set(cfg)
+	return s
+}
+
+// get returns the current configuration, which must not be modified
+func (s *configStore) get() *Config {
+	return s.v.Load().(*Config)
+}
+
+func (s *configStore) set(cfg Config) {
+	s.v.Store(&cfg)
+}
+
+// WithConfig sets the initial configuration of the VMs, with the fields
+// left to zero set to their defaults. NewService fails if it is invalid.
+func WithConfig(cfg Config) ServiceOption {
+	return func(s *Service) {
+		cfg.Defaults()
+		s.coordinator.config.set(cfg)
+	}
+}
+
+// Config returns the current configuration of the VMs
+func (s *Service) Config() Config {
+	return *s.coordinator.config.get()
+}
+
+// ReloadConfig replaces the configuration of the VMs with the one in the file
+// at path. The VMs that are starting keep the configuration they started with,
+// and an invalid file leaves the current configuration in place.
+func (s *Service) ReloadConfig(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		log.WithError(err).Error("failed to reload config, keeping the current one")
+		return err
+	}
+
+	s.coordinator.config.set(cfg)
+	applyLogLevels(cfg)
+	log.WithField("config", cfg).Info("reloaded config")
+
+	return nil
+}
+
+// applyLogLevels sets the log levels of the components to the ones of a valid
+// configuration, overriding the ones set with the admin service
+func applyLogLevels(cfg Config) {
+	levels, err := logging.ParseLevels(cfg.LogLevels)
+	if err != nil {
+		log.WithError(err).Error("invalid log levels")
+		return
+	}
+
+	logging.ResetLevels(levels)
+}
@@ -0,0 +1,290 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/logging"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600), "failed to write config")
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := Config{VcpuCount: 2, ProbePeriod: time.Minute}
+	cfg.Defaults()
+
+	expect := DefaultConfig()
+	expect.VcpuCount = 2
+	expect.ProbePeriod = time.Minute
+	require.Equal(t, expect, cfg, "set fields were overridden or unset fields were not defaulted")
+
+	require.Equal(t, Config{
+		MemSizeMib:            defaultMemSizeMib,
+		VcpuCount:             defaultVcpuCount,
+		GuestPort:             defaultGuestPort,
+		StartTimeout:          defaultStartTimeout,
+		AgentReadyTimeout:     defaultAgentReadyTimeout,
+		GuestReadyTimeout:     defaultGuestReadyTimeout,
+		AgentShutdownTimeout:  defaultAgentShutdownTimeout,
+		ClockSyncTimeout:      defaultClockSyncTimeout,
+		ProbePeriod:           defaultProbePeriod,
+		ProbeFailureThreshold: defaultProbeThreshold,
+		CPUBoostWindow:        defaultCPUBoostWindow,
+		VMConfigWaitTimeout:   defaultVMConfigWaitTimeout,
+		DrainGracePeriod:      defaultDrainGracePeriod,
+		PostBootHook:          PostBootHook{Timeout: defaultPostBootHookTimeout},
+	}, DefaultConfig(), "unexpected defaults")
+	require.NoError(t, DefaultConfig().Validate(), "defaults are invalid")
+
+	// WithConfig defaults the fields left to zero
+	s := newTestService(nil, fakes.NewOrchestrator())
+	WithConfig(Config{GuestPort: "8080"})(s)
+	require.Equal(t, "8080", s.Config().GuestPort, "guest port was not set")
+	require.Equal(t, defaultStartTimeout, s.Config().StartTimeout, "start timeout was not defaulted")
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		modify    func(cfg *Config)
+		expectErr string
+	}{
+		{name: "Zero memory", modify: func(cfg *Config) { cfg.MemSizeMib = 0 }, expectErr: "memSizeMib"},
+		{name: "Zero vCPUs", modify: func(cfg *Config) { cfg.VcpuCount = 0 }, expectErr: "vcpuCount"},
+		{name: "Too many vCPUs", modify: func(cfg *Config) { cfg.VcpuCount = maxVcpuCount + 1 }, expectErr: "vcpuCount"},
+		{name: "Port out of range", modify: func(cfg *Config) { cfg.GuestPort = "65536" }, expectErr: "guestPort"},
+		{name: "Port not a number", modify: func(cfg *Config) { cfg.GuestPort = "http" }, expectErr: "guestPort"},
+		{name: "Zero threshold", modify: func(cfg *Config) { cfg.ProbeFailureThreshold = 0 }, expectErr: "probeFailureThreshold"},
+		{name: "Negative start timeout", modify: func(cfg *Config) { cfg.StartTimeout = -time.Second }, expectErr: "startTimeout"},
+		{name: "Zero guest ready timeout", modify: func(cfg *Config) { cfg.GuestReadyTimeout = 0 }, expectErr: "guestReadyTimeout"},
+		{name: "Zero shutdown timeout", modify: func(cfg *Config) { cfg.AgentShutdownTimeout = 0 }, expectErr: "agentShutdownTimeout"},
+		{name: "Zero probe period", modify: func(cfg *Config) { cfg.ProbePeriod = 0 }, expectErr: "probePeriod"},
+		{name: "Zero boost window", modify: func(cfg *Config) { cfg.CPUBoostWindow = 0 }, expectErr: "cpuBoostWindow"},
+		{name: "Negative VM config wait timeout", modify: func(cfg *Config) { cfg.VMConfigWaitTimeout = -time.Second }, expectErr: "vmConfigWaitTimeout"},
+		{name: "Unknown hook variable", modify: func(cfg *Config) { cfg.PostBootHook.Command = []string{"register", "{{.PodIP}}"} }, expectErr: "postBootHook"},
+		{name: "Malformed hook", modify: func(cfg *Config) { cfg.PostBootHook.Command = []string{"register", "{{.GuestIP"} }, expectErr: "postBootHook"},
+		{name: "Empty hook command", modify: func(cfg *Config) { cfg.PostBootHook.Command = []string{"", "{{.GuestIP}}"} }, expectErr: "postBootHook"},
+		{name: "Empty quota namespace", modify: func(cfg *Config) { cfg.NamespaceQuotas = map[string]NamespaceQuota{"": {MaxVMs: 1}} }, expectErr: "namespaceQuotas"},
+		{name: "Negative mock latency", modify: func(cfg *Config) { cfg.MockLatencies.Load = -time.Second }, expectErr: "mockLatencies"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			c.modify(&cfg)
+
+			err := cfg.Validate()
+			require.Error(t, err, "invalid config was accepted")
+			require.Contains(t, err.Error(), c.expectErr, "error does not name the invalid field")
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cases := []struct {
+		name      string
+		content   string
+		expectErr bool
+		expect    func(cfg *Config)
+	}{
+		{name: "Empty", content: "", expect: func(cfg *Config) {}},
+		{
+			name:    "Partial",
+			content: "memSizeMib: 512\nvcpuCount: 2\nstartTimeout: 1m\n",
+			expect: func(cfg *Config) {
+				cfg.MemSizeMib = 512
+				cfg.VcpuCount = 2
+				cfg.StartTimeout = time.Minute
+			},
+		},
+		{name: "Guest port", content: "guestPort: 8080\n", expect: func(cfg *Config) { cfg.GuestPort = "8080" }},
+		{
+			name:    "Post-boot hook",
+			content: "postBootHook:\n  command: [/usr/bin/register, \"{{.GuestIP}}\"]\n  fatal: true\n",
+			expect: func(cfg *Config) {
+				cfg.PostBootHook.Command = []string{"/usr/bin/register", "{{.GuestIP}}"}
+				cfg.PostBootHook.Fatal = true
+			},
+		},
+		{
+			name:    "Namespace quotas",
+			content: "namespaceQuotas:\n  tenant-a: {maxVMs: 10, maxMemoryMib: 4096}\n  \"*\": {maxVMs: 2}\n",
+			expect: func(cfg *Config) {
+				cfg.NamespaceQuotas = map[string]NamespaceQuota{
+					"tenant-a": {MaxVMs: 10, MaxMemoryMib: 4096},
+					"*":        {MaxVMs: 2},
+				}
+			},
+		},
+		{
+			name:    "Mock latencies",
+			content: "mockLatencies:\n  boot: 125ms\n  load: 10ms\n",
+			expect: func(cfg *Config) {
+				cfg.MockLatencies = MockLatencies{Boot: 125 * time.Millisecond, Load: 10 * time.Millisecond}
+			},
+		},
+		{name: "Unknown field", content: "memSizeMiB: 512\n", expectErr: true},
+		{name: "Malformed", content: "vcpuCount: [1\n", expectErr: true},
+		{name: "Zero memory", content: "memSizeMib: 0\n", expectErr: true},
+		{name: "Too many vCPUs", content: "vcpuCount: 64\n", expectErr: true},
+		{name: "Invalid port", content: "guestPort: http\n", expectErr: true},
+		{name: "Negative timeout", content: "clockSyncTimeout: -1s\n", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeConfig(t, path, c.content)
+
+			cfg, err := LoadConfig(path)
+			if c.expectErr {
+				require.Error(t, err, "invalid config was loaded")
+				return
+			}
+			require.NoError(t, err, "failed to load config")
+
+			expect := DefaultConfig()
+			c.expect(&expect)
+			require.Equal(t, expect, cfg, "unexpected config")
+		})
+	}
+
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err, "missing config was loaded")
+}
+
+func TestReloadConfig(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig(t, path, "memSizeMib: 512\nvcpuCount: 2\nguestPort: 8080\n")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload valid config")
+	require.EqualValues(t, 512, s.Config().MemSizeMib, "config was not reloaded")
+
+	writeConfig(t, path, "memSizeMib: 1024\nvcpuCount: 0\n")
+	require.Error(t, s.ReloadConfig(path), "invalid config was reloaded")
+	require.EqualValues(t, 512, s.Config().MemSizeMib, "invalid config replaced the current one")
+
+	// New VMs are started with the reloaded config
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	opts := orch.StartOpts["1"]
+	require.EqualValues(t, 512, opts.MemSizeMib, "VM was not started with the reloaded memory size")
+	require.EqualValues(t, 2, opts.VcpuCount, "VM was not started with the reloaded vCPU count")
+
+	vmConfig, err := s.getPodVMConfig(context.Background(), "pod")
+	require.NoError(t, err, "VM config was not stored")
+	require.Equal(t, "8080", vmConfig.guestPort, "VM config does not have the reloaded guest port")
+}
+
+func TestConfigConcurrentReads(t *testing.T) {
+	small := DefaultConfig()
+	large := DefaultConfig()
+	large.MemSizeMib, large.VcpuCount = 1024, 4
+
+	store := newConfigStore(small)
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// A snapshot is never a mix of the old and the new config
+				cfg := store.get()
+				if cfg.MemSizeMib == small.MemSizeMib {
+					require.Equal(t, small.VcpuCount, cfg.VcpuCount, "torn config snapshot")
+				} else {
+					require.Equal(t, large.VcpuCount, cfg.VcpuCount, "torn config snapshot")
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			store.set(large)
+		} else {
+			store.set(small)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestReloadConfigLogLevels(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	t.Cleanup(func() { logging.ResetLevels(nil) })
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig(t, path, "logLevels:\n  coordinator: debug\n  network: warn\n")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload valid config")
+
+	levels := logging.Levels()
+	require.Equal(t, log.DebugLevel, levels[logging.Coordinator], "level of the coordinator was not set")
+	require.Equal(t, log.WarnLevel, levels[logging.Network], "level of the network was not set")
+	require.Equal(t, log.InfoLevel, levels[logging.CRI], "level of the CRI was changed")
+
+	// A reload resets the levels changed at runtime to the ones of the file
+	require.NoError(t, logging.SetLevel(logging.CRI, log.TraceLevel))
+	writeConfig(t, path, "logLevels:\n  network: error\n")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload valid config")
+
+	levels = logging.Levels()
+	require.Equal(t, log.InfoLevel, levels[logging.Coordinator], "level of the coordinator was not reset")
+	require.Equal(t, log.InfoLevel, levels[logging.CRI], "level of the CRI changed at runtime was not reset")
+	require.Equal(t, log.ErrorLevel, levels[logging.Network], "level of the network was not reloaded")
+
+	for _, content := range []string{
+		"logLevels:\n  scheduler: debug\n",
+		"logLevels:\n  network: verbose\n",
+	} {
+		writeConfig(t, path, content)
+		require.Error(t, s.ReloadConfig(path), "config with invalid log levels %q was reloaded", content)
+	}
+	require.Equal(t, log.ErrorLevel, logging.Levels()[logging.Network], "invalid config changed the log levels")
+}
@@ -0,0 +1,350 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// connProxyAnnotation routes the traffic of the queue-proxy to the VM
+	// through a connection proxy on the host, for its connection metrics
+	connProxyAnnotation = "vhive.io/connection-proxy"
+	// connProxyDialTimeout bounds the connection of the proxy to the guest
+	connProxyDialTimeout = time.Second
+	// connProxyBufferSize is the size of the buffer of each direction of a connection
+	connProxyBufferSize = 32 * 1024
+)
+
+// ConnProxyStats are the connection metrics of the proxy of a VM
+type ConnProxyStats struct {
+	ContainerID       string `json:"containerID"`
+	VMID              string `json:"vmID"`
+	Revision          string `json:"revision"`
+	Address           string `json:"address"`
+	ActiveConnections int64  `json:"activeConnections"`
+	Connections       uint64 `json:"connections"`
+	ConnectFailures   uint64 `json:"connectFailures"`
+	BytesToGuest      uint64 `json:"bytesToGuest"`
+	BytesFromGuest    uint64 `json:"bytesFromGuest"`
+}
+
+// connProxy forwards the TCP connections accepted on a host port to the
+// function in a VM, counting the connections, their failures and their bytes.
+// The bytes are copied through a buffer as they arrive, so that the proxy
+// only adds the latency of a copy to each request.
+type connProxy struct {
+	// The counters first, for the alignment of the atomic operations
+	active          int64
+	connections     uint64
+	connectFailures uint64
+	bytesToGuest    uint64
+	bytesFromGuest  uint64
+
+	listener net.Listener
+	target   string
+	logger   *log.Entry
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// newConnProxy listens on a free port of the given host address and
+// forwards the connections to the target address of the guest
+func newConnProxy(listenIP, target string, logger *log.Entry) (*connProxy, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(listenIP, "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &connProxy{
+		listener: listener,
+		target:   target,
+		logger:   logger.WithFields(log.Fields{"proxy": listener.Addr().String(), "target": target}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.serve()
+
+	return p, nil
+}
+
+// addr returns the host and the port the proxy listens on
+func (p *connProxy) addr() (host, port string) {
+	host, port, _ = net.SplitHostPort(p.listener.Addr().String())
+	return host, port
+}
+
+func (p *connProxy) serve() {
+	defer p.wg.Done()
+
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+
+			if !closed {
+				p.logger.WithError(err).Error("connection proxy stopped accepting connections")
+			}
+			return
+		}
+
+		atomic.AddUint64(&p.connections, 1)
+
+		p.wg.Add(1)
+		go p.handle(client)
+	}
+}
+
+func (p *connProxy) handle(client net.Conn) {
+	defer p.wg.Done()
+
+	guest, err := net.DialTimeout("tcp", p.target, connProxyDialTimeout)
+	if err != nil {
+		atomic.AddUint64(&p.connectFailures, 1)
+		p.logger.WithError(err).Debug("failed to connect to the guest")
+		client.Close()
+		return
+	}
+
+	if !p.track(client, guest) {
+		client.Close()
+		guest.Close()
+		return
+	}
+	defer p.untrack(client, guest)
+
+	atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+
+	done := make(chan struct{})
+	go func() {
+		p.pipe(guest, client, &p.bytesToGuest)
+		close(done)
+	}()
+	p.pipe(client, guest, &p.bytesFromGuest)
+	<-done
+
+	client.Close()
+	guest.Close()
+}
+
+// pipe copies src to dst until src is closed, then closes dst for writing
+// so that the other side sees the end of the stream. On an error, both
+// connections are closed, which also ends the copy in the other direction.
+func (p *connProxy) pipe(dst, src net.Conn, counter *uint64) {
+	buf := make([]byte, connProxyBufferSize)
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			atomic.AddUint64(counter, uint64(n))
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				err = werr
+			}
+		}
+
+		if err == io.EOF {
+			if tcp, ok := dst.(*net.TCPConn); ok {
+				_ = tcp.CloseWrite()
+				return
+			}
+		}
+		if err != nil {
+			dst.Close()
+			src.Close()
+			return
+		}
+	}
+}
+
+// track registers the connections for close, returning false if the proxy is closed
+func (p *connProxy) track(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+
+	return true
+}
+
+func (p *connProxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range conns {
+		delete(p.conns, c)
+	}
+}
+
+// close stops accepting connections and closes the open ones
+func (p *connProxy) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+
+	p.listener.Close()
+	for c := range p.conns {
+		c.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *connProxy) stats() ConnProxyStats {
+	return ConnProxyStats{
+		Address:           p.listener.Addr().String(),
+		ActiveConnections: atomic.LoadInt64(&p.active),
+		Connections:       atomic.LoadUint64(&p.connections),
+		ConnectFailures:   atomic.LoadUint64(&p.connectFailures),
+		BytesToGuest:      atomic.LoadUint64(&p.bytesToGuest),
+		BytesFromGuest:    atomic.LoadUint64(&p.bytesFromGuest),
+	}
+}
+
+// getConnProxy returns whether the traffic to the VM goes through a connection proxy
+func getConnProxy(r *criapi.CreateContainerRequest) (bool, error) {
+	value, ok := getAnnotations(r)[connProxyAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation %q", connProxyAnnotation, value)
+	}
+
+	return enabled, nil
+}
+
+// startConnProxy starts the connection proxy of the instance, to its guest port.
+// The proxy of an instance is set under the lock of the coordinator, for its metrics.
+func (c *coordinator) startConnProxy(fi *funcInstance) error {
+	target := net.JoinHostPort(fi.startVMResponse.GuestIP, fi.guestPort)
+
+	proxy, err := newConnProxy(c.connProxyIP, target, fi.logger)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	fi.connProxy = proxy
+	c.Unlock()
+
+	fi.logger.WithField("proxy", proxy.listener.Addr().String()).Debug("started connection proxy")
+
+	return nil
+}
+
+// closeConnProxy closes the connection proxy of the instance, if any
+func (c *coordinator) closeConnProxy(fi *funcInstance) {
+	c.Lock()
+	proxy := fi.connProxy
+	fi.connProxy = nil
+	c.Unlock()
+
+	if proxy != nil {
+		proxy.close()
+	}
+}
+
+// ConnProxyStats returns the connection metrics of the proxies of the active
+// VMs, sorted by container ID
+func (s *Service) ConnProxyStats() []ConnProxyStats {
+	s.coordinator.Lock()
+	var stats []ConnProxyStats
+	for containerID, fi := range s.coordinator.activeInstances {
+		if proxy := fi.connProxy; proxy != nil {
+			st := proxy.stats()
+			st.ContainerID, st.VMID, st.Revision = containerID, fi.vmID, fi.revisionID
+			stats = append(stats, st)
+		}
+	}
+	s.coordinator.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ContainerID < stats[j].ContainerID })
+
+	return stats
+}
+
+// writeConnProxyMetrics writes the metrics of the connection proxies in the
+// Prometheus text format, nothing if there is no proxy
+func writeConnProxyMetrics(w io.Writer, stats []ConnProxyStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(st *ConnProxyStats) string
+	}{
+		{"vhive_proxy_active_connections", "Open connections to the VM through its proxy.", "gauge",
+			func(st *ConnProxyStats) string { return strconv.FormatInt(st.ActiveConnections, 10) }},
+		{"vhive_proxy_connections_total", "Connections accepted by the proxy of the VM.", "counter",
+			func(st *ConnProxyStats) string { return strconv.FormatUint(st.Connections, 10) }},
+		{"vhive_proxy_connect_failures_total", "Connections of the proxy of the VM that failed to reach the guest.", "counter",
+			func(st *ConnProxyStats) string { return strconv.FormatUint(st.ConnectFailures, 10) }},
+		{"vhive_proxy_to_guest_bytes_total", "Bytes forwarded to the guest by the proxy of the VM.", "counter",
+			func(st *ConnProxyStats) string { return strconv.FormatUint(st.BytesToGuest, 10) }},
+		{"vhive_proxy_from_guest_bytes_total", "Bytes forwarded from the guest by the proxy of the VM.", "counter",
+			func(st *ConnProxyStats) string { return strconv.FormatUint(st.BytesFromGuest, 10) }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+		for i := range stats {
+			if _, err := fmt.Fprintf(w, "%s{revision=%q,vm=%q} %s\n",
+				m.name, stats[i].Revision, stats[i].VMID, m.value(&stats[i])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
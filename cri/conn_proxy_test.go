@@ -0,0 +1,273 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// startEchoServer starts a TCP server echoing every line, returning its address
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "failed to start echo server")
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func echo(t *testing.T, conn net.Conn, reader *bufio.Reader, msg string) {
+	_, err := conn.Write([]byte(msg + "\n"))
+	require.NoError(t, err, "failed to write")
+
+	reply, err := reader.ReadString('\n')
+	require.NoError(t, err, "failed to read")
+	require.Equal(t, msg+"\n", reply, "reply does not match")
+}
+
+func dialProxy(t *testing.T, p *connProxy) net.Conn {
+	host, port := p.addr()
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	require.NoError(t, err, "failed to connect to the proxy")
+
+	return conn
+}
+
+func TestConnProxyForwards(t *testing.T) {
+	p, err := newConnProxy("127.0.0.1", startEchoServer(t), log.NewEntry(log.StandardLogger()))
+	require.NoError(t, err, "failed to start proxy")
+	defer p.close()
+
+	conn := dialProxy(t, p)
+	reader := bufio.NewReader(conn)
+	echo(t, conn, reader, "hello")
+
+	// A payload larger than the buffer of the proxy
+	large := strings.Repeat("x", 3*connProxyBufferSize)
+	echo(t, conn, reader, large)
+
+	require.Equal(t, int64(1), p.stats().ActiveConnections, "connection is not active")
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool { return p.stats().ActiveConnections == 0 }, time.Second, 10*time.Millisecond,
+		"connection is still active")
+
+	stats := p.stats()
+	require.Equal(t, uint64(1), stats.Connections)
+	require.Equal(t, uint64(0), stats.ConnectFailures)
+	require.Equal(t, uint64(len("hello\n")+len(large)+1), stats.BytesToGuest)
+	require.Equal(t, stats.BytesToGuest, stats.BytesFromGuest)
+}
+
+func TestConnProxyHalfClose(t *testing.T) {
+	p, err := newConnProxy("127.0.0.1", startEchoServer(t), log.NewEntry(log.StandardLogger()))
+	require.NoError(t, err, "failed to start proxy")
+	defer p.close()
+
+	conn := dialProxy(t, p)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+	// The end of the request reaches the guest, which ends its response
+	reply, err := ioutil.ReadAll(conn)
+	require.NoError(t, err, "response was not ended")
+	require.Equal(t, "request", string(reply))
+}
+
+func TestConnProxyConnectFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	p, err := newConnProxy("127.0.0.1", closedAddr, log.NewEntry(log.StandardLogger()))
+	require.NoError(t, err, "failed to start proxy")
+	defer p.close()
+
+	conn := dialProxy(t, p)
+	defer conn.Close()
+
+	// The client sees the connection closed
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "connection to a closed port was not closed")
+
+	stats := p.stats()
+	require.Equal(t, uint64(1), stats.Connections)
+	require.Equal(t, uint64(1), stats.ConnectFailures)
+	require.Equal(t, int64(0), stats.ActiveConnections)
+}
+
+func TestConnProxyClose(t *testing.T) {
+	p, err := newConnProxy("127.0.0.1", startEchoServer(t), log.NewEntry(log.StandardLogger()))
+	require.NoError(t, err, "failed to start proxy")
+
+	conn := dialProxy(t, p)
+	defer conn.Close()
+	echo(t, conn, bufio.NewReader(conn), "hello")
+
+	p.close()
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "active connection was not closed")
+	require.Equal(t, int64(0), p.stats().ActiveConnections)
+
+	host, port := p.addr()
+	_, err = net.Dial("tcp", net.JoinHostPort(host, port))
+	require.Error(t, err, "closed proxy accepted a connection")
+
+	// Closing twice is a no-op
+	p.close()
+}
+
+func TestConnProxyLatency(t *testing.T) {
+	const rounds = 200
+
+	target := startEchoServer(t)
+	p, err := newConnProxy("127.0.0.1", target, log.NewEntry(log.StandardLogger()))
+	require.NoError(t, err, "failed to start proxy")
+	defer p.close()
+
+	median := func(conn net.Conn) time.Duration {
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		durations := make([]time.Duration, rounds)
+		for i := range durations {
+			start := time.Now()
+			echo(t, conn, reader, "ping")
+			durations[i] = time.Since(start)
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		return durations[rounds/2]
+	}
+
+	direct, err := net.Dial("tcp", target)
+	require.NoError(t, err)
+
+	directRTT := median(direct)
+	proxiedRTT := median(dialProxy(t, p))
+	t.Logf("median round trip: direct %v, through the proxy %v", directRTT, proxiedRTT)
+
+	// The proxy adds about 100us per round trip, the bound is loose for the shared CI runners
+	require.Less(t, int64(proxiedRTT-directRTT), int64(time.Millisecond), "proxy adds too much latency")
+}
+
+func TestCreateContainerConnProxy(t *testing.T) {
+	target := startEchoServer(t)
+	guestIP, guestPort, err := net.SplitHostPort(target)
+	require.NoError(t, err)
+
+	orch := fakes.NewOrchestrator()
+	orch.GuestIP = guestIP
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	WithConnectionProxy("127.0.0.1")(s)
+
+	cfg := s.coordinator.config.get()
+	cfg.GuestPort = guestPort
+	s.coordinator.config.set(*cfg)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Annotations = map[string]string{connProxyAnnotation: "true"}
+	resp, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "user container creation failed")
+
+	qp := newQueueProxyRequest("pod")
+	_, err = s.CreateContainer(context.Background(), qp)
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	addr, _ := getEnv(qp, guestIPEnv)
+	port, _ := getEnv(qp, guestPortEnv)
+	require.Equal(t, "127.0.0.1", addr, "queue-proxy does not reach the proxy")
+	require.NotEqual(t, guestPort, port, "queue-proxy reaches the guest directly")
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(addr, port))
+	require.NoError(t, err, "failed to connect to the proxy")
+	echo(t, conn, bufio.NewReader(conn), "hello")
+
+	stats := s.ConnProxyStats()
+	require.Len(t, stats, 1)
+	require.Equal(t, resp.ContainerId, stats[0].ContainerID)
+	require.Equal(t, "img-00001", stats[0].Revision)
+	require.Equal(t, int64(1), stats[0].ActiveConnections)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeConnProxyMetrics(&buf, stats))
+	require.Contains(t, buf.String(), `vhive_proxy_active_connections{revision="img-00001",vm="1"} 1`)
+
+	_, err = s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: resp.ContainerId})
+	require.NoError(t, err, "container removal failed")
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "connection through the proxy was not closed")
+	require.Empty(t, s.ConnProxyStats(), "proxy of the removed container is still listed")
+
+	_, err = net.Dial("tcp", net.JoinHostPort(addr, port))
+	require.Error(t, err, "proxy of the removed container still accepts connections")
+}
+
+func TestCreateContainerConnProxyDisabled(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Annotations = map[string]string{connProxyAnnotation: "true"}
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "user container creation failed")
+
+	qp := newQueueProxyRequest("pod")
+	_, err = s.CreateContainer(context.Background(), qp)
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	addr, _ := getEnv(qp, guestIPEnv)
+	require.Equal(t, "190.128.0.1", addr, "queue-proxy does not reach the guest directly")
+	require.Empty(t, s.ConnProxyStats())
+}
@@ -25,8 +25,18 @@ package cri
 import (
 	"context"
 	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/taps"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
@@ -36,21 +46,93 @@ const (
 	guestIPEnv        = "GUEST_ADDR"
 	guestPortEnv      = "GUEST_PORT"
 	guestImageEnv     = "GUEST_IMAGE"
-	guestPortValue    = "50051"
+	guestPrefaultEnv  = "GUEST_PREFAULT"
+	guestKernelEnv    = "GUEST_KERNEL_IMAGE"
+	revisionEnv       = "K_REVISION"
+
+	// guestImageCachedEnv asserts that the guest image was pre-pulled on the node
+	guestImageCachedEnv = "GUEST_IMAGE_CACHED"
+	// guestClockSyncEnv disables syncing the guest clock of resumed VMs if false
+	guestClockSyncEnv = "GUEST_CLOCK_SYNC"
+	// guestRootfsVerifyEnv is the expected digest of the guest rootfs, which
+	// the VMs of the function verify before they boot
+	guestRootfsVerifyEnv = "GUEST_ROOTFS_VERIFY"
+	// guestNetBandwidthEnv and guestNetOpsEnv limit the egress and the ingress
+	// of the VMs of the function, in megabits and in packets per second
+	guestNetBandwidthEnv = "GUEST_NET_BW_MBPS"
+	guestNetOpsEnv       = "GUEST_NET_OPS"
+	// guestIOBandwidthEnv and guestIOOpsEnv limit the I/O of each drive of the
+	// VMs of the function, in megabytes and in operations per second
+	guestIOBandwidthEnv = "GUEST_IO_BW_MBPS"
+	guestIOOpsEnv       = "GUEST_IO_OPS"
+	// guestSwapEnv is the size in MiB of the swap file provisioned in the
+	// rootfs of the function before it starts, none if 0
+	guestSwapEnv = "GUEST_SWAP_MIB"
+	// guestREAPEnv restores the VMs of the function with REAP, recording the
+	// working set of their guest memory once and prefetching it on the restores
+	guestREAPEnv = "GUEST_REAP"
+	// guestREAPEagerEnv restores the VMs of the function with REAP, waiting
+	// for their working set to be installed before they serve requests
+	guestREAPEagerEnv = "GUEST_REAP_EAGER"
+
+	// hugepagesAnnotation backs the guest memory of the revision with hugepages
+	hugepagesAnnotation = "vhive.io/hugepages"
+	// guestHugepagesEnv backs the guest memory of the function with hugepages,
+	// like hugepagesAnnotation
+	guestHugepagesEnv = "GUEST_HUGEPAGES"
+	// cpuBoostAnnotation multiplies the CPU quota of the VMs of the revision
+	// during their cold start, until their first response or the boost window
+	cpuBoostAnnotation       = "vhive.io/cpu-boost"
+	cpuBoostWindowAnnotation = "vhive.io/cpu-boost-window"
+	maxCPUBoostFactor        = 8
+	// egressPolicyAnnotation restricts the egress of the VMs of the revision
+	// to a comma-separated list of <CIDR>[:<port>[/tcp|udp]] destinations
+	egressPolicyAnnotation = "vhive.io/egress-policy"
+	// keepGuestEnvAnnotation keeps the guest address and port set in the
+	// queue-proxy of the revision instead of injecting those of its VM
+	keepGuestEnvAnnotation = "vhive.io/keep-guest-env"
+
+	// qpAllowDegradedEnv lets the queue-proxy be created without a ready VM,
+	// so that it reports the backend as down instead of failing the whole pod
+	qpAllowDegradedEnv = "QP_ALLOW_DEGRADED"
+	// degradedGuestAddrEnv carries the sentinel address to a degraded queue-proxy
+	degradedGuestAddrEnv = "GUEST_DEGRADED_ADDR"
+	// degradedGuestIP is a sentinel unreachable address (TEST-NET-1, RFC 5737)
+	degradedGuestIP = "192.0.2.1"
+
+	// scaleToZeroEnv opts the function in to having its idle VMs offloaded
+	scaleToZeroEnv = "SCALE_TO_ZERO"
 )
 
+// degradedDeadlineMargin is the time left before the CRI deadline
+// to create a degraded queue-proxy
+const degradedDeadlineMargin = time.Second
+
 // CreateContainer starts a container or a VM, depending on the name
 // if the name matches "user-container", the cri plugin starts a VM, assigning it an IP,
 // otherwise starts a regular container
 func (s *Service) CreateContainer(ctx context.Context, r *criapi.CreateContainerRequest) (*criapi.CreateContainerResponse, error) {
-	log.Debugf("CreateContainer within sandbox %q for container %+v",
+	criLog.Debugf("CreateContainer within sandbox %q for container %+v",
 		r.GetPodSandboxId(), r.GetConfig().GetMetadata())
 
 	config := r.GetConfig()
 	containerName := config.GetMetadata().GetName()
 
+	if s.Admission() == AdmissionClosed {
+		criLog.WithFields(log.Fields{"sandboxID": r.GetPodSandboxId(), "container": containerName}).
+			Warn("rejected the creation of a container, the node is closed")
+		return nil, ErrNodeClosed
+	}
+
 	if containerName == userContainerName {
-		return s.createUserContainer(ctx, r)
+		resp, shared, err := s.creates.do(ctx, r, s.now(), func(ctx context.Context) (*criapi.CreateContainerResponse, error) {
+			return s.createUserContainer(ctx, r)
+		})
+		if shared {
+			criLog.WithFields(log.Fields{"sandboxID": r.GetPodSandboxId(), "attempt": config.GetMetadata().GetAttempt()}).
+				Info("deduplicated a retry of the creation of the user container")
+		}
+		return resp, err
 	}
 	if containerName == queueProxyName {
 		return s.createQueueProxy(ctx, r)
@@ -60,84 +142,534 @@ func (s *Service) CreateContainer(ctx context.Context, r *criapi.CreateContainer
 	return s.stockRuntimeClient.CreateContainer(ctx, r)
 }
 
-func (s *Service) createUserContainer(ctx context.Context, r *criapi.CreateContainerRequest) (*criapi.CreateContainerResponse, error) {
+func (s *Service) createUserContainer(ctx context.Context, r *criapi.CreateContainerRequest) (resp *criapi.CreateContainerResponse, retErr error) {
+	// The VM outlives the request, so its operations have their own context,
+	// except its start, which is cancelled with the creation, e.g., by StopPodSandbox
+	revision, revisionErr := NewFunctionSpec(r.GetConfig()).Revision()
+	ctx = logging.WithFields(ctx, log.Fields{"sandboxID": r.GetPodSandboxId(), "revision": revision})
+	logger := logging.FromContext(ctx, logging.Coordinator)
+	vmCtx := withAuditPod(withAuditActor(logging.WithFields(context.Background(), logging.Fields(ctx)), AuditActorCRI), r.GetPodSandboxId(), revision)
+	startCtx := withAuditPod(withAuditActor(ctx, AuditActorCRI), r.GetPodSandboxId(), revision)
+
+	image, _ := NewFunctionSpec(r.GetConfig()).Image()
+	s.coordinator.audit.record(vmCtx, AuditRecord{Event: auditCreateRequested, Image: image}, nil)
+	defer func() {
+		// A queue-proxy created first must not wait for a VM that never comes
+		if retErr != nil {
+			s.failPodVMConfig(r.GetPodSandboxId(), retErr)
+		}
+	}()
+	defer func() {
+		s.coordinator.audit.record(vmCtx, AuditRecord{
+			Event:       auditContainerCreated,
+			ContainerID: resp.GetContainerId(),
+			Image:       image,
+		}, retErr)
+	}()
+
+	if s.IsDraining() {
+		logger.Warn("rejected the creation of a user container, the node is draining")
+		return nil, ErrNodeDraining
+	}
+
+	s.scaleHints.arrived(revision)
+
+	// A request without a revision is rejected with the rest of its spec below
+	if s.createLimiter != nil && revisionErr == nil {
+		if err := s.createLimiter.wait(ctx, revision); err != nil {
+			logger.WithError(err).Warn("creation of the user container is throttled")
+			return nil, err
+		}
+	}
+
+	// A sandbox of a runtime handler runs the function in its container, an
+	// invalid sandbox is reported with the rest of the spec below
+	if backend, err := s.getSandboxBackend(getAnnotations(r)); err == nil && backend.RuntimeHandler() != "" {
+		return s.createSandboxedContainer(ctx, r)
+	}
+
 	var (
 		stockResp *criapi.CreateContainerResponse
 		stockErr  error
 		stockDone = make(chan struct{})
 	)
 
+	stockCtx, cancelStock := context.WithCancel(ctx)
+	defer cancelStock()
+
 	go func() {
 		defer close(stockDone)
-		stockResp, stockErr = s.stockRuntimeClient.CreateContainer(ctx, r)
+		if stockErr = s.coordinator.faults.fire(FaultStockCreate); stockErr == nil {
+			stockResp, stockErr = s.stockRuntimeClient.CreateContainer(stockCtx, r)
+		}
+		if stockErr == nil {
+			s.creates.setPlaceholder(ctx, stockResp.GetContainerId())
+		}
+	}()
+
+	defer func() {
+		// The placeholder UC is only kept if the VM is fully set up, otherwise
+		// its creation is cancelled or, if it already completed, the placeholder
+		// is removed so that no untracked container is left behind
+		if retErr == nil {
+			return
+		}
+
+		cancelStock()
+		<-stockDone
+
+		if stockErr != nil {
+			return
+		}
+
+		req := &criapi.RemoveContainerRequest{ContainerId: stockResp.GetContainerId()}
+		if _, err := s.stockRuntimeClient.RemoveContainer(context.Background(), req); err != nil {
+			logger.WithError(err).Errorf("failed to remove placeholder container %s after failure", req.ContainerId)
+		}
 	}()
 
+	spec, err := s.parseFunctionSpec(r, s.coordinator.config.get())
+	if err != nil {
+		return nil, logSpecError(logger, r, err)
+	}
+	for _, warning := range spec.warnings {
+		logger.Warn(warning)
+	}
+	s.scaleHints.setWarmPool(spec.revision, spec.warmPool)
+
+	pod := s.getPodMetadata(r)
+	releaseQuota, err := s.coordinator.admitNamespace(pod.Namespace, spec.memSizeMib)
+	if err != nil {
+		logger.WithError(err).Warn("rejected the creation of a user container")
+		return nil, err
+	}
+	// Once the container is created, its VM counts towards the quota as active
+	defer releaseQuota()
+
+	// An image hinted to be on the node is used as pulled, without the registry
+	if s.imageDigests != nil && !spec.imageCached {
+		pinned, digest, err := s.imageDigests.pin(ctx, spec.image)
+		if err != nil {
+			logger.WithError(err).Error("failed to resolve the digest of the guest image")
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		logger.WithFields(log.Fields{"image": spec.image, "digest": digest}).Debug("pinned the guest image")
+		spec.image = pinned
+	}
+
 	config := r.GetConfig()
-	guestImage, err := getGuestImage(config)
+	proj, err := newProjection(s.projectionDir, config.GetMounts())
 	if err != nil {
-		log.WithError(err).Error()
+		logger.WithError(err).Error("failed to project volumes")
 		return nil, err
 	}
 
-	funcInst, err := s.coordinator.startVM(context.Background(), guestImage)
+	disk, err := s.coordinator.acquireExtraDisk(spec.revision, r)
 	if err != nil {
-		log.WithError(err).Error("failed to start VM")
+		logger.WithError(err).Error("failed to acquire extra disk")
+		if err := proj.remove(); err != nil {
+			logger.WithError(err).Error("failed to remove projection after failure")
+		}
 		return nil, err
 	}
 
-	vmConfig := &VMConfig{guestIP: funcInst.startVMResponse.GuestIP, guestPort: guestPortValue}
-	s.insertPodVMConfig(r.GetPodSandboxId(), vmConfig)
+	vmOpts := []ctriface.StartVMOption{
+		ctriface.WithMachineConfig(spec.vcpuCount, spec.memSizeMib),
+		ctriface.WithPrefault(spec.prefault),
+		ctriface.WithHugepages(spec.hugepages),
+		ctriface.WithNetRateLimit(spec.netRateLimit),
+		ctriface.WithIORateLimit(spec.ioRateLimit),
+		ctriface.WithKernelImage(spec.kernel),
+		ctriface.WithImageCached(spec.imageCached),
+		ctriface.WithCPUBoost(spec.boostFactor, spec.boostWindow),
+		ctriface.WithEnv(spec.env),
+		ctriface.WithMetadata(&mmdsDocument{Vhive: mmdsVhive{Pod: pod}}),
+		ctriface.WithHostname(getGuestHostname(pod, r.GetPodSandboxId())),
+	}
+	if spec.reap {
+		// The working set is recorded once for all the VMs of the revision
+		vmOpts = append(vmOpts, ctriface.WithREAP(spec.revision))
+	}
+	if proj != nil {
+		vmOpts = append(vmOpts, proj.vmOption())
+	}
+	if disk != nil {
+		vmOpts = append(vmOpts, disk.vmOption())
+	}
+	if len(spec.virtiofs) > 0 {
+		vmOpts = append(vmOpts, ctriface.WithVirtiofsMounts(spec.virtiofs))
+	}
+	if spec.firecrackerBinary != "" {
+		vmOpts = append(vmOpts, ctriface.WithFirecracker(spec.firecracker, spec.firecrackerBinary))
+	}
+	if spec.rootfsDigest != "" {
+		vmOpts = append(vmOpts, ctriface.WithRootfsDigest(spec.rootfsDigest))
+	}
+	if spec.egressPolicy != nil {
+		vmOpts = append(vmOpts, ctriface.WithEgressPolicy(spec.egressPolicy))
+	}
+	if spec.guestSwapMib > 0 {
+		vmOpts = append(vmOpts, ctriface.WithGuestSwap(spec.guestSwapMib))
+	}
+	if len(spec.initCmd) > 0 {
+		logger.WithField("initCmd", spec.initCmd).Warn("DEBUG INIT: booting the VM into a command instead of the guest init, the function will not run")
+		vmOpts = append(vmOpts, ctriface.WithInitCmd(spec.initCmd))
+	}
+
+	// A VM parked by a removed container of the revision is adopted rather than booting one
+	var funcInst *funcInstance
+	if disk == nil && len(spec.initCmd) == 0 {
+		funcInst = s.coordinator.adoptVM(vmCtx, newSlotKey(spec.revision, spec.image, spec.guestPort, ctriface.NewStartVMOptions(vmOpts...)))
+	}
+
+	if funcInst == nil {
+		tBoot := time.Now()
+		if funcInst, err = s.bootVM(ctx, startCtx, spec.image, vmOpts); err != nil {
+			logger.WithError(err).Error("failed to start VM")
+			if err := proj.remove(); err != nil {
+				logger.WithError(err).Error("failed to remove projection after failure")
+			}
+			if err := s.coordinator.disks.release(disk); err != nil {
+				logger.WithError(err).Error("failed to release extra disk after failure")
+			}
+			return nil, startErrorStatus(err)
+		}
+		s.scaleHints.booted(spec.revision, time.Since(tBoot))
+	}
+
+	logger = logger.WithField("vmID", funcInst.vmID)
+
+	funcInst.revisionID = spec.revision
+	funcInst.namespace = pod.Namespace
+	funcInst.guestPort = spec.guestPort
+	funcInst.extraDisk = disk
+	funcInst.scaleToZero = spec.scaleToZero
+	funcInst.probe = spec.probe
+	funcInst.clockSync = spec.clockSync
+	funcInst.reapEager = spec.reapEager
+	atomic.StoreInt32(&funcInst.probeFailures, 0)
+
+	// An instance loaded from a snapshot or adopted keeps the projection it was booted with
+	if funcInst.projection == nil {
+		funcInst.projection = proj
+	} else if err := proj.remove(); err != nil {
+		logger.WithError(err).Error("failed to remove unused projection")
+	}
+
+	defer func() {
+		// The VM, its tap and its IP are only kept if the container is fully created
+		if retErr != nil {
+			if err := s.coordinator.releaseVM(vmCtx, funcInst); err != nil {
+				funcInst.logger.WithError(err).Error("failed to release VM after failure")
+			}
+		}
+	}()
+
+	// A creation cancelled once its VM booted releases the VM
+	if err := ctx.Err(); err != nil {
+		logger.Warn("creation of the user container was cancelled")
+		return nil, contextStatus(err)
+	}
+
+	podID := r.GetPodSandboxId()
+	vmConfig := &VMConfig{guestIP: funcInst.startVMResponse.GuestIP, guestPort: spec.guestPort}
+	if spec.transport == guestTransportVsock {
+		if vmConfig, err = vsockVMConfig(funcInst, spec.guestPort); err != nil {
+			logger.WithError(err).Error("failed to reach VM over vsock")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+
+	// The queue-proxy reaches the VM through its connection proxy
+	if spec.connProxy {
+		if err := s.coordinator.startConnProxy(funcInst); err != nil {
+			logger.WithError(err).Error("failed to start connection proxy")
+			return nil, err
+		}
+		vmConfig.guestIP, vmConfig.guestPort = funcInst.connProxy.addr()
+	}
 
 	// Wait for placeholder UC to be created
 	<-stockDone
 
 	// Check for error from container creation
 	if stockErr != nil {
-		log.WithError(stockErr).Error("failed to create container")
+		logger.WithError(stockErr).Error("failed to create container")
 		return nil, stockErr
 	}
-	
+
 	containerdID := stockResp.ContainerId
-	err = s.coordinator.insertActive(containerdID, funcInst)
+	logger = logger.WithField("containerID", containerdID)
+	err = s.coordinator.insertActive(podID, containerdID, funcInst)
 	if err != nil {
-		log.WithError(err).Error("failed to insert active VM")
+		logger.WithError(err).Error("failed to insert active VM")
 		return nil, err
 	}
 
-	return stockResp, stockErr
+	hookVars := PostBootHookVars{ContainerID: containerdID, GuestIP: funcInst.startVMResponse.GuestIP, Revision: spec.revision}
+	if err := s.coordinator.runPostBootHook(ctx, hookVars); err != nil {
+		s.coordinator.forgetInstance(containerdID, funcInst)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// The queue-proxy waiting for the VM is only woken once the user container
+	// is registered, a VM released by a failure before would be handed to it
+	vmConfig.containerID = containerdID
+	if err := s.insertPodVMConfig(podID, vmConfig); err != nil {
+		logger.WithError(err).Error("failed to store VM config")
+		s.coordinator.forgetInstance(containerdID, funcInst)
+		return nil, err
+	}
+
+	funcInst.history.attach(PodRef{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID}, s.eventRecorder)
+
+	if spec.probe != nil {
+		s.startProbe(containerdID, funcInst, spec.probe)
+	}
+
+	if s.microVMs != nil && !s.microVMs.Acquire(containerdID) {
+		logger.Warn("no microVM slot is free, the node is oversubscribed")
+	}
+
+	logger.Debug("created the user container")
+
+	return stockResp, nil
+}
+
+// bootVM starts a VM for a user container once the boot limiter, if any,
+// lets it boot. The wait for a slot is bounded by the request context.
+func (s *Service) bootVM(ctx, startCtx context.Context, image string, vmOpts []ctriface.StartVMOption) (*funcInstance, error) {
+	if s.bootLimiter != nil {
+		release, err := s.bootLimiter.acquire(ctx)
+		if err != nil {
+			logging.FromContext(ctx, logging.Coordinator).WithError(err).Warn("boot of the VM is throttled")
+			return nil, err
+		}
+		defer release()
+	}
+
+	return s.coordinator.startVM(startCtx, image, vmOpts...)
 }
 
 func (s *Service) createQueueProxy(ctx context.Context, r *criapi.CreateContainerRequest) (*criapi.CreateContainerResponse, error) {
-	vmConfig, err := s.getPodVMConfig(r.GetPodSandboxId())
+	allowDegraded, err := NewFunctionSpec(r.GetConfig()).Bool(qpAllowDegradedEnv, false)
+	if err != nil {
+		criLog.WithError(err).Error()
+		return nil, err
+	}
+
+	keepGuestEnv, err := getKeepGuestEnv(r)
 	if err != nil {
-		log.WithError(err).Error()
+		criLog.WithError(err).Error()
+		return nil, err
+	}
+
+	var vmConfig *VMConfig
+	if allowDegraded {
+		vmConfig = s.waitPodVMConfig(ctx, r.GetPodSandboxId())
+	} else if vmConfig, err = s.getPodVMConfig(ctx, r.GetPodSandboxId()); err != nil {
+		criLog.WithError(err).Error()
 		return nil, err
 	}
 
 	s.removePodVMConfig(r.GetPodSandboxId())
 
-	guestIPKeyVal := &criapi.KeyValue{Key: guestIPEnv, Value: vmConfig.guestIP}
-	guestPortKeyVal := &criapi.KeyValue{Key: guestPortEnv, Value: vmConfig.guestPort}
-	r.Config.Envs = append(r.Config.Envs, guestIPKeyVal, guestPortKeyVal)
+	switch {
+	case keepGuestEnv:
+		criLog.Debugf("keeping the guest environment of the queue-proxy of pod %s", r.GetPodSandboxId())
+	case vmConfig == nil:
+		criLog.Warnf("VM of pod %s is not ready, creating degraded queue-proxy", r.GetPodSandboxId())
+		r.Config.Envs = mergeEnvs(r.GetPodSandboxId(), r.Config.Envs, []*criapi.KeyValue{
+			{Key: guestIPEnv, Value: ""},
+			{Key: guestPortEnv, Value: s.coordinator.config.get().GuestPort},
+			{Key: degradedGuestAddrEnv, Value: degradedGuestIP},
+		})
+	default:
+		envs, mounts := queueProxyGuestEnvs(vmConfig)
+		r.Config.Envs = mergeEnvs(r.GetPodSandboxId(), r.Config.Envs, envs)
+		r.Config.Mounts = append(r.Config.Mounts, mounts...)
+	}
 
 	resp, err := s.stockRuntimeClient.CreateContainer(ctx, r)
 	if err != nil {
-		log.WithError(err).Error("stock containerd failed to start UC")
+		criLog.WithError(err).Error("stock containerd failed to start UC")
 		return nil, err
 	}
 
 	return resp, nil
 }
 
-func getGuestImage(config *criapi.ContainerConfig) (string, error) {
-	envs := config.GetEnvs()
+// mergeEnvs sets the injected environment variables in the environment of the
+// queue-proxy of the pod, in place of the values of those that are already set
+func mergeEnvs(podID string, envs, injected []*criapi.KeyValue) []*criapi.KeyValue {
+	pending := make(map[string]*criapi.KeyValue, len(injected))
+	for _, kv := range injected {
+		pending[kv.GetKey()] = kv
+	}
+
+	merged := make([]*criapi.KeyValue, 0, len(envs)+len(injected))
+	replaced := make(map[string]bool, len(injected))
 	for _, kv := range envs {
-		if kv.GetKey() == guestImageEnv {
-			return kv.GetValue(), nil
+		inj, ok := pending[kv.GetKey()]
+		if !ok {
+			merged = append(merged, kv)
+			continue
+		}
+
+		criLog.Infof("replacing %s=%q of the queue-proxy of pod %s with %q (annotate with %s to keep it)",
+			kv.GetKey(), kv.GetValue(), podID, inj.GetValue(), keepGuestEnvAnnotation)
+		// Duplicates of the key are dropped, so that the injected value is the only one
+		if !replaced[kv.GetKey()] {
+			replaced[kv.GetKey()] = true
+			merged = append(merged, inj)
+		}
+	}
+
+	for _, kv := range injected {
+		if !replaced[kv.GetKey()] {
+			merged = append(merged, kv)
+		}
+	}
+
+	return merged
+}
+
+// getKeepGuestEnv returns whether the guest environment set in the queue-proxy
+// is kept instead of being replaced with that of the VM
+func getKeepGuestEnv(r *criapi.CreateContainerRequest) (bool, error) {
+	value, ok := getAnnotations(r)[keepGuestEnvAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	keep, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation %q", keepGuestEnvAnnotation, value)
+	}
+
+	return keep, nil
+}
+
+// waitPodVMConfig waits for the VM config of the pod until shortly before the
+// deadline of the request, or up to the VMConfigWaitTimeout of the config without
+// deadline, returning nil if the VM does not become ready in time
+func (s *Service) waitPodVMConfig(ctx context.Context, podID string) *VMConfig {
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline.Add(-degradedDeadlineMargin))
+		// A deadline within the margin still leaves the VM half of the time left
+		if timeout <= 0 {
+			timeout = time.Until(deadline) / 2
 		}
+	}
+
+	vmConfig, err := s.waitPodVMSignal(ctx, podID, timeout)
+	if err != nil {
+		criLog.WithError(err).Debugf("VM of pod %s is not ready", podID)
+		return nil
+	}
+
+	return vmConfig
+}
+
+// startErrorStatus converts a failure to start a VM into a gRPC status
+// with a code depending on the phase that failed, leaving other errors unchanged
+func startErrorStatus(err error) error {
+	var se *StartError
+	if !errors.As(err, &se) {
+		return err
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(se, ErrImagePull) && ctriface.IsImageNotCached(se):
+		code = codes.FailedPrecondition
+	case ctriface.IsRootfsIntegrity(se):
+		// Pulling the image again does not fix a rootfs that was tampered with
+		code = codes.FailedPrecondition
+	case errors.Is(se, ErrImagePull), errors.Is(se, ErrNetworkSetup):
+		code = codes.Unavailable
+	case errors.Is(se, ErrGuestTimeout):
+		code = codes.DeadlineExceeded
+	case errors.Is(se, ErrStartCancelled):
+		code = codes.Canceled
+	case isOutOfMemory(se.Err):
+		code = codes.ResourceExhausted
+	}
+
+	return status.Error(code, se.Error())
+}
+
+// getGuestKernel returns the guest kernel selected by the user container, which
+// must be allow-listed, or an empty path for the default kernel
+func (s *Service) getGuestKernel(config *criapi.ContainerConfig) (string, error) {
+	for _, kv := range config.GetEnvs() {
+		if kv.GetKey() != guestKernelEnv || kv.GetValue() == "" {
+			continue
+		}
+
+		path := filepath.Clean(kv.GetValue())
+		if !s.kernelAllowList[path] {
+			return "", fmt.Errorf("guest kernel %q selected by %s is not allow-listed", kv.GetValue(), guestKernelEnv)
+		}
+
+		return path, nil
+	}
+
+	return "", nil
+}
 
+// getGuestHugepages returns whether the guest memory should be backed by hugepages
+func getGuestHugepages(r *criapi.CreateContainerRequest) (bool, error) {
+	value, ok := getAnnotations(r)[hugepagesAnnotation]
+	if !ok {
+		return false, nil
 	}
 
-	return "", errors.New("failed to provide non empty guest image in user container config")
+	hugepages, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s annotation %q", hugepagesAnnotation, value)
+	}
+
+	return hugepages, nil
+}
+
+// getEgressPolicy returns the egress policy of the VM, nil if its egress
+// is not restricted
+func getEgressPolicy(r *criapi.CreateContainerRequest) (*taps.EgressPolicy, error) {
+	value, ok := getAnnotations(r)[egressPolicyAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	policy, err := taps.ParseEgressPolicy(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation %q: %v", egressPolicyAnnotation, value, err)
+	}
+
+	return policy, nil
+}
+
+// getCPUBoost returns the factor and the window of the CPU boost of the VM
+// during its cold start, a factor of 1 if there is no boost
+func getCPUBoost(r *criapi.CreateContainerRequest, defaultWindow time.Duration) (float64, time.Duration, error) {
+	annotations := getAnnotations(r)
+
+	factor, window := 1.0, defaultWindow
+
+	if value, ok := annotations[cpuBoostAnnotation]; ok {
+		var err error
+		if factor, err = strconv.ParseFloat(value, 64); err != nil || factor < 1 || factor > maxCPUBoostFactor {
+			return 0, 0, fmt.Errorf("invalid %s annotation %q, must be between 1 and %d", cpuBoostAnnotation, value, maxCPUBoostFactor)
+		}
+	}
+
+	if value, ok := annotations[cpuBoostWindowAnnotation]; ok {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			return 0, 0, fmt.Errorf("invalid %s annotation %q", cpuBoostWindowAnnotation, value)
+		}
+	}
 
+	return factor, window, nil
 }
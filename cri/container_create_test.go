@@ -0,0 +1,1041 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/logging"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestCreateUserContainerReleasesVMOnFailure(t *testing.T) {
+	cases := []struct {
+		name          string
+		inject        func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient)
+		request       func(r *criapi.CreateContainerRequest)
+		expectErr     bool
+		expectCode    codes.Code
+		expectStarted int
+		expectStopped int
+	}{
+		{
+			name:          "Success",
+			inject:        func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {},
+			expectStarted: 1,
+		},
+		{
+			name: "Node is draining",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				require.NoError(t, s.SetDraining(true))
+			},
+			expectErr:  true,
+			expectCode: codes.Unavailable,
+		},
+		{
+			name:   "Spec is invalid",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {},
+			request: func(r *criapi.CreateContainerRequest) {
+				r.Config.Envs = r.Config.Envs[1:]
+			},
+			expectErr:  true,
+			expectCode: codes.InvalidArgument,
+		},
+		{
+			name: "Volume projection fails",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				s.projectionDir = filepath.Join(t.TempDir(), "missing")
+			},
+			request: func(r *criapi.CreateContainerRequest) {
+				r.Config.Mounts = []*criapi.Mount{{
+					HostPath:      "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~secret/token",
+					ContainerPath: "/var/run/secrets/token",
+				}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "Extra disk creation fails",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				// The disks cannot be created under a regular file
+				file := filepath.Join(t.TempDir(), "file")
+				require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+				s.coordinator.disks = newDiskManager(file, DiskCleanupDelete)
+			},
+			request: func(r *criapi.CreateContainerRequest) {
+				r.Config.Annotations = map[string]string{extraDiskSizeAnnotation: "1"}
+			},
+			expectErr: true,
+		},
+		{
+			name: "VM config is invalid",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				orch.GuestIP = "not-an-ip"
+			},
+			expectErr:     true,
+			expectStarted: 1,
+			expectStopped: 1,
+		},
+		{
+			name: "VM boot fails",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				orch.StartErr = errInjected
+			},
+			expectErr: true,
+		},
+		{
+			name: "Stock container creation fails",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				stock.CreateErr = errInjected
+			},
+			expectErr:     true,
+			expectStarted: 1,
+			expectStopped: 1,
+		},
+		{
+			name: "Active instance insertion fails",
+			inject: func(s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+				// The stock client returns "ctr1" for the first container
+				err := s.coordinator.insertActive("pod", "ctr1", newFuncInstance("0", "img", nil))
+				require.NoError(t, err, "could not insert mapping")
+			},
+			expectErr:     true,
+			expectStarted: 1,
+			expectStopped: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			stock := &fakes.StockRuntimeClient{}
+			s := newTestService(stock, orch)
+			c.inject(s, orch, stock)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.request != nil {
+				c.request(r)
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				if c.expectCode != codes.OK {
+					require.Equal(t, c.expectCode, status.Code(err), "unexpected error code")
+				}
+			} else {
+				require.NoError(t, err, "container creation failed")
+			}
+
+			require.Equal(t, c.expectStarted, orch.NumStarted(), "unexpected number of started VMs")
+			require.Equal(t, c.expectStopped, orch.NumStopped("1"), "VM was not released exactly once")
+
+			_, err = s.getPodVMConfig(context.Background(), "pod")
+			require.Equal(t, c.expectErr, err != nil, "pod VM config was leaked or lost")
+
+			if c.expectErr {
+				require.Empty(t, stock.Leaked(), "placeholder container was leaked")
+				require.Zero(t, s.MemoryStats().CommittedMib, "memory of the VM was leaked")
+			}
+		})
+	}
+}
+
+func TestNewServiceWithStockClients(t *testing.T) {
+	stock := &fakes.StockRuntimeClient{}
+	s, err := NewService(fakes.NewOrchestrator(), WithStockClients(stock, nil), WithPodVMConfigTTL(0))
+	require.NoError(t, err, "failed to create service")
+	defer s.Shutdown()
+
+	require.Equal(t, stock, s.stockRuntimeClient, "stock runtime client was not injected")
+	require.NotNil(t, s.stockImageClient, "stock image client was not dialed")
+}
+
+func TestNewServiceWithSubsetStockClients(t *testing.T) {
+	// The clients only implement the methods vHive relies on
+	stock := struct{ StockRuntimeClient }{&fakes.StockRuntimeClient{}}
+	image := struct{ StockImageClient }{&fakes.StockImageClient{}}
+	s, err := NewService(fakes.NewOrchestrator(), WithStockClients(stock, image), WithPodVMConfigTTL(0))
+	require.NoError(t, err, "failed to create service")
+	defer s.Shutdown()
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "failed to create container")
+
+	_, err = s.ListContainers(context.Background(), &criapi.ListContainersRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err), "request was passed through")
+	_, err = s.ListImages(context.Background(), &criapi.ListImagesRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err), "request was passed through")
+}
+
+func TestCreateUserContainerPlaceholderOnVMFailure(t *testing.T) {
+	t.Run("Cancelled", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.StartErr = errInjected
+		stock := &fakes.StockRuntimeClient{CreateDelay: time.Minute}
+		s := newTestService(stock, orch)
+
+		tStart := time.Now()
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.Error(t, err, "container creation did not fail")
+		require.Less(t, int64(time.Since(tStart)), int64(time.Minute), "in-flight placeholder creation was not cancelled")
+		require.Empty(t, stock.Created, "placeholder container was created")
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.StartErr = errInjected
+		orch.BootDelay = 50 * time.Millisecond
+		stock := &fakes.StockRuntimeClient{}
+		s := newTestService(stock, orch)
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.Error(t, err, "container creation did not fail")
+		require.Equal(t, []string{"ctr1"}, stock.Created, "placeholder container was not created")
+		require.Equal(t, []string{"ctr1"}, stock.Removed, "placeholder container was not removed")
+	})
+}
+
+func TestCreateUserContainerPrefault(t *testing.T) {
+	cases := []struct {
+		name           string
+		value          string
+		expectErr      bool
+		expectPrefault bool
+	}{
+		{name: "Unset"},
+		{name: "Enabled", value: "true", expectPrefault: true},
+		{name: "Disabled", value: "false"},
+		{name: "Invalid", value: "maybe", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestPrefaultEnv, Value: c.value})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectPrefault, orch.StartOpts["1"].Prefault, "prefault was not passed to the orchestrator")
+		})
+	}
+}
+
+func TestCreateUserContainerREAP(t *testing.T) {
+	cases := []struct {
+		name        string
+		env         string
+		value       string
+		snapshots   bool
+		expectErr   bool
+		expectTrace string
+		expectEager bool
+	}{
+		{name: "Unset", snapshots: true},
+		{name: "Enabled", value: "true", snapshots: true, expectTrace: "img-00001"},
+		{name: "Disabled", value: "false", snapshots: true},
+		{name: "WithoutSnapshots", value: "true"},
+		{name: "Invalid", value: "maybe", snapshots: true, expectErr: true},
+		{name: "Eager", env: guestREAPEagerEnv, value: "true", snapshots: true, expectTrace: "img-00001", expectEager: true},
+		{name: "EagerWithoutSnapshots", env: guestREAPEagerEnv, value: "true"},
+		{name: "EagerInvalid", env: guestREAPEagerEnv, value: "soon", snapshots: true, expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = c.snapshots
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			env := guestREAPEnv
+			if c.env != "" {
+				env = c.env
+			}
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: env, Value: c.value})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectTrace, orch.StartOpts["1"].REAPTrace, "REAP trace was not passed to the orchestrator")
+
+			fi, ok := s.coordinator.getInstance("ctr1")
+			require.True(t, ok, "instance not found")
+			require.Equal(t, c.expectEager, fi.reapEager, "eager REAP was not set on the instance")
+		})
+	}
+}
+
+func TestCreateUserContainerKernel(t *testing.T) {
+	cases := []struct {
+		name         string
+		value        string
+		expectErr    bool
+		expectKernel string
+	}{
+		{name: "Default"},
+		{name: "Allowed", value: "/var/lib/vhive/kernels/vmlinux-5.10", expectKernel: "/var/lib/vhive/kernels/vmlinux-5.10"},
+		{name: "AllowedUnclean", value: "/var/lib/vhive/kernels/../kernels/vmlinux-5.10", expectKernel: "/var/lib/vhive/kernels/vmlinux-5.10"},
+		{name: "Disallowed", value: "/tmp/vmlinux", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+			WithKernelAllowList([]string{"/var/lib/vhive/kernels/vmlinux-5.10"})(s)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestKernelEnv, Value: c.value})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectKernel, orch.StartOpts["1"].KernelImagePath, "kernel was not passed to the orchestrator")
+		})
+	}
+}
+
+func newQueueProxyRequest(podID string, envs ...*criapi.KeyValue) *criapi.CreateContainerRequest {
+	return &criapi.CreateContainerRequest{
+		PodSandboxId: podID,
+		Config: &criapi.ContainerConfig{
+			Metadata: &criapi.ContainerMetadata{Name: queueProxyName},
+			Envs:     envs,
+		},
+	}
+}
+
+func getEnv(r *criapi.CreateContainerRequest, key string) (string, bool) {
+	for _, kv := range r.GetConfig().GetEnvs() {
+		if kv.GetKey() == key {
+			return kv.GetValue(), true
+		}
+	}
+
+	return "", false
+}
+
+func TestCreateQueueProxyDegraded(t *testing.T) {
+	allow := &criapi.KeyValue{Key: qpAllowDegradedEnv, Value: "true"}
+
+	t.Run("NotAllowed", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		// Without QP_ALLOW_DEGRADED, the queue-proxy waits for the VM until its deadline
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := s.CreateContainer(ctx, newQueueProxyRequest("pod"))
+		require.Error(t, err, "queue-proxy was created without a VM")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		r := newQueueProxyRequest("pod", &criapi.KeyValue{Key: qpAllowDegradedEnv, Value: "maybe"})
+		_, err := s.CreateContainer(context.Background(), r)
+		require.Error(t, err, "invalid QP_ALLOW_DEGRADED was accepted")
+	})
+
+	t.Run("Degraded", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		ctx, cancel := context.WithTimeout(context.Background(), degradedDeadlineMargin+200*time.Millisecond)
+		defer cancel()
+
+		r := newQueueProxyRequest("pod", allow)
+		_, err := s.CreateContainer(ctx, r)
+		require.NoError(t, err, "degraded queue-proxy creation failed")
+
+		addr, ok := getEnv(r, guestIPEnv)
+		require.True(t, ok, "guest address was not set")
+		require.Empty(t, addr, "guest address of a degraded queue-proxy is not empty")
+
+		sentinel, _ := getEnv(r, degradedGuestAddrEnv)
+		require.Equal(t, degradedGuestIP, sentinel, "sentinel address was not set")
+	})
+
+	// waitVM creates the queue-proxy with ctx, and the user container once the queue-proxy waits
+	waitVM := func(t *testing.T, ctx context.Context) *criapi.CreateContainerRequest {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		r := newQueueProxyRequest("pod", allow)
+		qpErr := make(chan error, 1)
+		go func() {
+			_, err := s.CreateContainer(ctx, r)
+			qpErr <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			s.Lock()
+			defer s.Unlock()
+			return s.podVMSignals["pod"] != nil
+		}, 5*time.Second, time.Millisecond, "queue-proxy is not waiting for the VM")
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "user container creation failed")
+		require.NoError(t, <-qpErr, "queue-proxy creation failed")
+
+		return r
+	}
+
+	t.Run("WaitsWithoutDeadline", func(t *testing.T) {
+		r := waitVM(t, context.Background())
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.1", addr, "queue-proxy without deadline did not wait for the VM")
+	})
+
+	t.Run("WaitsWithinMargin", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), degradedDeadlineMargin/2)
+		defer cancel()
+
+		r := waitVM(t, ctx)
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.1", addr, "queue-proxy with a deadline within the margin did not wait for the VM")
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "user container creation failed")
+
+		r := newQueueProxyRequest("pod", allow)
+		_, err = s.CreateContainer(context.Background(), r)
+		require.NoError(t, err, "queue-proxy creation failed")
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.1", addr, "guest address was not set")
+
+		_, ok := getEnv(r, degradedGuestAddrEnv)
+		require.False(t, ok, "queue-proxy of a ready VM is degraded")
+	})
+
+	t.Run("BecomesReady", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		ctx, cancel := context.WithTimeout(context.Background(), degradedDeadlineMargin+2*time.Second)
+		defer cancel()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			require.NoError(t, s.insertPodVMConfig("pod", &VMConfig{guestIP: "190.128.0.7", guestPort: defaultGuestPort}))
+		}()
+
+		r := newQueueProxyRequest("pod", allow)
+		_, err := s.CreateContainer(ctx, r)
+		require.NoError(t, err, "queue-proxy creation failed")
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.7", addr, "queue-proxy did not wait for the VM")
+	})
+}
+
+func TestCreateQueueProxyGuestEnv(t *testing.T) {
+	cases := []struct {
+		name       string
+		envs       []*criapi.KeyValue
+		annotation string
+		expectErr  bool
+		expectAddr string
+		expectPort string
+	}{
+		{
+			name:       "Absent",
+			expectAddr: "190.128.0.1",
+			expectPort: defaultGuestPort,
+		},
+		{
+			name: "Present",
+			envs: []*criapi.KeyValue{
+				{Key: guestIPEnv, Value: "10.0.0.1"},
+				{Key: guestPortEnv, Value: "8080"},
+				{Key: guestIPEnv, Value: "10.0.0.2"},
+			},
+			expectAddr: "190.128.0.1",
+			expectPort: defaultGuestPort,
+		},
+		{
+			name: "Keep",
+			envs: []*criapi.KeyValue{
+				{Key: guestIPEnv, Value: "10.0.0.1"},
+				{Key: guestPortEnv, Value: "8080"},
+			},
+			annotation: "true",
+			expectAddr: "10.0.0.1",
+			expectPort: "8080",
+		},
+		{
+			name:       "KeepDisabled",
+			envs:       []*criapi.KeyValue{{Key: guestIPEnv, Value: "10.0.0.1"}},
+			annotation: "false",
+			expectAddr: "190.128.0.1",
+			expectPort: defaultGuestPort,
+		},
+		{
+			name:       "Invalid",
+			annotation: "always",
+			expectErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+			_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+			require.NoError(t, err, "user container creation failed")
+
+			r := newQueueProxyRequest("pod", c.envs...)
+			if c.annotation != "" {
+				r.Config.Annotations = map[string]string{keepGuestEnvAnnotation: c.annotation}
+			}
+
+			_, err = s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "invalid annotation was accepted")
+				return
+			}
+			require.NoError(t, err, "queue-proxy creation failed")
+
+			counts := make(map[string]int)
+			for _, kv := range r.GetConfig().GetEnvs() {
+				counts[kv.GetKey()]++
+			}
+			require.Equal(t, 1, counts[guestIPEnv], "guest address is not set exactly once")
+			require.Equal(t, 1, counts[guestPortEnv], "guest port is not set exactly once")
+
+			addr, _ := getEnv(r, guestIPEnv)
+			require.Equal(t, c.expectAddr, addr, "wrong guest address")
+			port, _ := getEnv(r, guestPortEnv)
+			require.Equal(t, c.expectPort, port, "wrong guest port")
+		})
+	}
+}
+
+func TestCreateUserContainerHugepages(t *testing.T) {
+	cases := []struct {
+		name            string
+		annotation      string
+		env             string
+		expectErr       bool
+		expectHugepages bool
+	}{
+		{name: "Unset"},
+		{name: "Enabled", annotation: "true", expectHugepages: true},
+		{name: "Disabled", annotation: "false"},
+		{name: "Invalid", annotation: "2M", expectErr: true},
+		{name: "EnvEnabled", env: "true", expectHugepages: true},
+		{name: "EnvDisabled", env: "false"},
+		{name: "EnvInvalid", env: "2M", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.annotation != "" {
+				r.Config.Annotations = map[string]string{hugepagesAnnotation: c.annotation}
+			}
+			if c.env != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestHugepagesEnv, Value: c.env})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectHugepages, orch.StartOpts["1"].Hugepages, "hugepages were not passed to the orchestrator")
+
+			fi, ok := s.coordinator.getInstance("ctr1")
+			require.True(t, ok, "instance not found")
+
+			backing := memoryBackingAnonymous
+			if c.expectHugepages {
+				backing = memoryBackingHugepages
+			}
+			require.Equal(t, backing, fi.bootTrace.MemoryBacking, "memory backing not in boot trace")
+		})
+	}
+}
+
+func TestCreateUserContainerHugepagesExhausted(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.StartErr = status.Error(codes.ResourceExhausted,
+		"not enough 2 MiB hugepages on the host for 256 MiB of guest memory: 128 needed, 64 free, 0 reserved by other VMs (raise vm.nr_hugepages)")
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestHugepagesEnv, Value: "true"})
+
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Error(t, err, "container creation did not fail")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, err.Error(), "not enough 2 MiB hugepages", "the cause was not reported")
+	requireNoLeaks(t, s, orch, stock)
+}
+
+func TestCreateUserContainerNetRateLimit(t *testing.T) {
+	cases := []struct {
+		name        string
+		bandwidth   string
+		ops         string
+		expectLimit ctriface.NetRateLimit
+		expectErr   bool
+	}{
+		{name: "Unset"},
+		{name: "Bandwidth", bandwidth: "100", expectLimit: ctriface.NetRateLimit{BandwidthMbps: 100}},
+		{name: "Ops", ops: "5000", expectLimit: ctriface.NetRateLimit{OpsPerSec: 5000}},
+		{name: "Both", bandwidth: "10", ops: "1000", expectLimit: ctriface.NetRateLimit{BandwidthMbps: 10, OpsPerSec: 1000}},
+		{name: "Zero", bandwidth: "0", ops: "0"},
+		{name: "NegativeBandwidth", bandwidth: "-1", expectErr: true},
+		{name: "NegativeOps", ops: "-100", expectErr: true},
+		{name: "Invalid", bandwidth: "1Gbps", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.bandwidth != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestNetBandwidthEnv, Value: c.bandwidth})
+			}
+			if c.ops != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestNetOpsEnv, Value: c.ops})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectLimit, orch.StartOpts["1"].NetRateLimit, "rate limit was not passed to the orchestrator")
+		})
+	}
+}
+
+func TestCreateUserContainerIORateLimit(t *testing.T) {
+	cases := []struct {
+		name        string
+		bandwidth   string
+		ops         string
+		expectLimit ctriface.IORateLimit
+		expectErr   bool
+	}{
+		{name: "Unset"},
+		{name: "Bandwidth", bandwidth: "50", expectLimit: ctriface.IORateLimit{BandwidthMBps: 50}},
+		{name: "Ops", ops: "2000", expectLimit: ctriface.IORateLimit{OpsPerSec: 2000}},
+		{name: "Both", bandwidth: "20", ops: "500", expectLimit: ctriface.IORateLimit{BandwidthMBps: 20, OpsPerSec: 500}},
+		{name: "NegativeBandwidth", bandwidth: "-5", expectErr: true},
+		{name: "NegativeOps", ops: "-1", expectErr: true},
+		{name: "Invalid", ops: "1.5", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.bandwidth != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestIOBandwidthEnv, Value: c.bandwidth})
+			}
+			if c.ops != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestIOOpsEnv, Value: c.ops})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectLimit, orch.StartOpts["1"].IORateLimit, "rate limit was not passed to the orchestrator")
+			require.Zero(t, orch.StartOpts["1"].NetRateLimit, "I/O limit was applied to the network")
+		})
+	}
+}
+
+func TestCreateUserContainerGuestSwap(t *testing.T) {
+	cases := []struct {
+		name       string
+		value      string
+		expectSwap uint32
+		expectErr  bool
+	}{
+		{name: "Unset"},
+		{name: "Zero", value: "0"},
+		{name: "Swap", value: "512", expectSwap: 512},
+		{name: "Negative", value: "-64", expectErr: true},
+		{name: "Invalid", value: "1G", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestSwapEnv, Value: c.value})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectSwap, orch.StartOpts["1"].GuestSwapMib, "swap was not passed to the orchestrator")
+			require.NotContains(t, orch.StartOpts["1"].Env, guestSwapEnv+"="+c.value, "swap env was passed to the guest")
+		})
+	}
+}
+
+func TestCreateUserContainerEgressPolicy(t *testing.T) {
+	cases := []struct {
+		name         string
+		value        string
+		expectPolicy string
+		expectErr    bool
+	}{
+		{name: "Unset"},
+		{name: "Policy", value: "10.96.0.10:53/udp,10.20.0.0/16", expectPolicy: "10.96.0.10/32:53/udp,10.20.0.0/16"},
+		{name: "InvalidDestination", value: "example.com", expectErr: true},
+		{name: "InvalidPort", value: "10.0.0.1:0", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.SandboxConfig = &criapi.PodSandboxConfig{Annotations: map[string]string{egressPolicyAnnotation: c.value}}
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectPolicy, orch.StartOpts["1"].EgressPolicy.String(), "policy was not passed to the orchestrator")
+		})
+	}
+}
+
+func TestCreateUserContainerRootfsVerify(t *testing.T) {
+	const rootfsDigest = "sha256:4c1e5b6d1d1b8d1ab3b1f3e0cd6b9f7c2a0e8f5d4c3b2a1908f7e6d5c4b3a291"
+
+	cases := []struct {
+		name       string
+		value      string
+		expectCode codes.Code
+	}{
+		{name: "Unset"},
+		{name: "Matching", value: rootfsDigest},
+		{name: "Mismatching", value: "sha256:" + strings.Repeat("0", 64), expectCode: codes.FailedPrecondition},
+		{name: "Invalid", value: "md5:d41d8cd98f00b204e9800998ecf8427e", expectCode: codes.InvalidArgument},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.RootfsDigest = rootfsDigest
+			stock := &fakes.StockRuntimeClient{}
+			s := newTestService(stock, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestRootfsVerifyEnv, Value: c.value})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectCode != codes.OK {
+				require.Equal(t, c.expectCode, status.Code(err), "unexpected error: %v", err)
+				require.Zero(t, orch.NumStarted(), "VM was booted")
+				requireNoLeaks(t, s, orch, stock)
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.value, orch.StartOpts["1"].RootfsDigest, "rootfs digest was not passed to the orchestrator")
+		})
+	}
+}
+
+func TestCreateUserContainerCPUBoost(t *testing.T) {
+	cases := []struct {
+		name         string
+		annotations  map[string]string
+		expectErr    bool
+		expectFactor float64
+		expectWindow time.Duration
+	}{
+		{name: "Unset", expectFactor: 1, expectWindow: defaultCPUBoostWindow},
+		{name: "DefaultWindow", annotations: map[string]string{cpuBoostAnnotation: "2.5"}, expectFactor: 2.5, expectWindow: defaultCPUBoostWindow},
+		{name: "Window", annotations: map[string]string{cpuBoostAnnotation: "4", cpuBoostWindowAnnotation: "30s"}, expectFactor: 4, expectWindow: 30 * time.Second},
+		{name: "FactorTooLow", annotations: map[string]string{cpuBoostAnnotation: "0.5"}, expectErr: true},
+		{name: "FactorTooHigh", annotations: map[string]string{cpuBoostAnnotation: "16"}, expectErr: true},
+		{name: "InvalidWindow", annotations: map[string]string{cpuBoostAnnotation: "2", cpuBoostWindowAnnotation: "-1s"}, expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			r.Config.Annotations = c.annotations
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			require.Equal(t, c.expectFactor, orch.StartOpts["1"].CPUBoostFactor, "boost factor was not passed to the orchestrator")
+			require.Equal(t, c.expectWindow, orch.StartOpts["1"].CPUBoostWindow, "boost window was not passed to the orchestrator")
+		})
+	}
+}
+
+func TestCreateUserContainerImageCached(t *testing.T) {
+	cases := []struct {
+		name          string
+		onNode        bool
+		hint          string
+		expectErr     bool
+		expectCode    codes.Code
+		expectStarted int
+		expectPulled  int
+	}{
+		{name: "Cached present", onNode: true, hint: "true", expectStarted: 1},
+		{name: "Cached missing with hint", hint: "true", expectErr: true, expectCode: codes.FailedPrecondition},
+		{name: "Not cached", expectStarted: 1, expectPulled: 1},
+		{name: "Invalid hint", onNode: true, hint: "maybe", expectErr: true, expectCode: codes.InvalidArgument},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.Images = map[string]bool{"img": c.onNode}
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.hint != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestImageCachedEnv, Value: c.hint})
+			}
+
+			_, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Equal(t, c.expectCode, status.Code(err), "unexpected error code")
+			} else {
+				require.NoError(t, err, "container creation failed")
+			}
+			require.Equal(t, c.expectStarted, orch.NumStarted(), "unexpected number of started VMs")
+			require.Equal(t, c.expectPulled, orch.Pulled["img"], "unexpected number of pulls")
+		})
+	}
+}
+
+func TestCoordinatorImageCache(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.Images = map[string]bool{}
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 1, orch.Pulled["img"], "image was not pulled")
+	require.True(t, s.coordinator.images.has("img"), "image was not cached")
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 1, orch.Pulled["img"], "cached image was pulled")
+	require.True(t, orch.StartOpts["2"].ImageCached, "cached image was not passed to the orchestrator")
+
+	// The image was removed from the node behind the coordinator's back
+	orch.Lock()
+	delete(orch.Images, "img")
+	orch.Unlock()
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod3", "img"))
+	require.NoError(t, err, "container creation did not fall back to pulling")
+	require.Equal(t, 2, orch.Pulled["img"], "removed image was not pulled")
+	require.True(t, s.coordinator.images.has("img"), "pulled image was not cached")
+}
+
+func TestCreateUserContainerClockSync(t *testing.T) {
+	cases := []struct {
+		name            string
+		value           string
+		expectErr       bool
+		expectClockSync bool
+	}{
+		{name: "Unset", expectClockSync: true},
+		{name: "Enabled", value: "true", expectClockSync: true},
+		{name: "Disabled", value: "false"},
+		{name: "Invalid", value: "maybe", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestClockSyncEnv, Value: c.value})
+			}
+
+			resp, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			fi, ok := s.coordinator.getInstance(resp.GetContainerId())
+			require.True(t, ok, "instance is not active")
+			require.Equal(t, c.expectClockSync, fi.clockSync, "unexpected clock sync setting")
+		})
+	}
+}
+
+// captureLogs records the entries of a component logged at the given level or
+// above until the end of the test
+func captureLogs(t *testing.T, component string, level log.Level) *logtest.Hook {
+	l := logging.Logger(component).Logger
+	hook := logtest.NewLocal(l)
+	old := l.ReplaceHooks(log.LevelHooks{})
+	l.AddHook(hook)
+	require.NoError(t, logging.SetLevel(component, level), "failed to set the log level")
+
+	t.Cleanup(func() {
+		l.ReplaceHooks(old)
+		logging.ResetLevels(nil)
+	})
+
+	return hook
+}
+
+func findEntry(hook *logtest.Hook, msg string) *log.Entry {
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == msg {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func TestCreateUserContainerLogFields(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	coordinator := captureLogs(t, logging.Coordinator, log.DebugLevel)
+	cri := captureLogs(t, logging.CRI, log.InfoLevel)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	// The start of the VM logs with the fields of the request that started it
+	started := findEntry(coordinator, "creating fresh instance")
+	require.NotNil(t, started, "start of the VM was not logged")
+	require.Equal(t, "pod", started.Data["sandboxID"], "start of the VM does not carry the sandbox")
+	require.Equal(t, "img-00001", started.Data["revision"], "start of the VM does not carry the revision")
+	require.Equal(t, "1", started.Data["vmID"], "start of the VM does not carry the VM")
+
+	created := findEntry(coordinator, "created the user container")
+	require.NotNil(t, created, "creation of the user container was not logged")
+	require.Equal(t, log.Fields{
+		"component":   logging.Coordinator,
+		"sandboxID":   "pod",
+		"revision":    "img-00001",
+		"vmID":        "1",
+		"containerID": resp.GetContainerId(),
+	}, created.Data, "creation of the user container does not carry its fields")
+
+	// Debugging the coordinator does not log the debug entries of the CRI passthrough
+	require.Empty(t, cri.AllEntries(), "debug entries of the CRI were logged")
+}
@@ -25,18 +25,29 @@ package cri
 import (
 	"context"
 
-	log "github.com/sirupsen/logrus"
 	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
 // RemoveContainer removes a container or a VM
 func (s *Service) RemoveContainer(ctx context.Context, r *criapi.RemoveContainerRequest) (*criapi.RemoveContainerResponse, error) {
-	log.Debugf("RemoveContainer for %q", r.GetContainerId())
+	criLog.Debugf("RemoveContainer for %q", r.GetContainerId())
 	containerID := r.GetContainerId()
 
+	s.creates.forget(containerID)
+
+	// The placeholder of a user container whose VM is still starting
+	if s.creates.cancelContainer(containerID) {
+		criLog.WithField("containerID", containerID).Info("cancelled the creation of the removed container")
+	}
+
 	go func() {
-		if err := s.coordinator.stopVM(context.Background(), containerID); err != nil {
-			log.WithError(err).Error("failed to stop microVM")
+		ctx := withAuditActor(context.Background(), AuditActorCRI)
+		if err := s.coordinator.removeVM(ctx, containerID); err != nil {
+			criLog.WithError(err).Error("failed to stop microVM")
+		}
+
+		if s.microVMs != nil {
+			s.microVMs.Release(containerID)
 		}
 	}()
 
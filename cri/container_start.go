@@ -0,0 +1,52 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// StartContainer starts the container. The container of a VM with a guest
+// agent is started once the agent is ready, so that kubelet does not consider
+// the function running before it can be reached.
+func (s *Service) StartContainer(ctx context.Context, r *criapi.StartContainerRequest) (*criapi.StartContainerResponse, error) {
+	criLog.Debugf("StartContainer for %q", r.GetContainerId())
+
+	if fi, ok := s.coordinator.getInstance(r.GetContainerId()); ok && fi.agent != nil {
+		timeout := s.coordinator.config.get().GuestReadyTimeout
+		if err := s.coordinator.waitAgentReady(ctx, fi, timeout); err != nil {
+			fi.logger.WithError(err).Error("guest agent is not ready, failing the start of the container")
+			fi.history.warn(eventNotReady, "guest agent was not ready within %s: %v", timeout, err)
+			return nil, status.Errorf(codes.Unavailable,
+				"guest agent of VM %s is not ready after %s: %v (check that the function image runs the guest agent "+
+					"on vsock port %d, or raise guestReadyTimeout in the vHive config)",
+				fi.vmID, timeout, err, s.coordinator.guestAgentPort)
+		}
+	}
+
+	return s.stockRuntimeClient.StartContainer(ctx, r)
+}
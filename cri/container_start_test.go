@@ -0,0 +1,112 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// newAgentService returns a service whose VMs connect to a guest agent
+// served on a unix socket, and the gRPC server of the agent
+func newAgentService(t *testing.T, stock *fakes.StockRuntimeClient) (*Service, *grpc.Server) {
+	agentPath := filepath.Join(t.TempDir(), "agent.sock")
+
+	lis, err := net.Listen("unix", agentPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	server := grpc.NewServer()
+	guestagent.NewServer(nil).Register(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	orch := fakes.NewOrchestrator()
+	orch.VsockPath = agentPath
+
+	s := newTestService(stock, orch)
+	s.coordinator.guestAgentPort = 52
+	s.coordinator.agentDialer = func(vsockPath string, port uint32) guestagent.Dialer {
+		return guestagent.UnixDialer(vsockPath)
+	}
+	WithConfig(Config{GuestReadyTimeout: 200 * time.Millisecond})(s)
+
+	return s, server
+}
+
+func TestStartContainer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Ready", func(t *testing.T) {
+		stock := &fakes.StockRuntimeClient{}
+		s, _ := newAgentService(t, stock)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+
+		_, err = s.StartContainer(ctx, &criapi.StartContainerRequest{ContainerId: "ctr1"})
+		require.NoError(t, err, "container with a ready guest agent was not started")
+		require.Equal(t, []string{"ctr1"}, stock.Started, "container was not started")
+	})
+
+	t.Run("NotReady", func(t *testing.T) {
+		stock := &fakes.StockRuntimeClient{}
+		s, server := newAgentService(t, stock)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+
+		server.Stop()
+
+		_, err = s.StartContainer(ctx, &criapi.StartContainerRequest{ContainerId: "ctr1"})
+		require.Error(t, err, "container with an unreachable guest agent was started")
+		require.Equal(t, codes.Unavailable, status.Code(err), "unexpected error code")
+		require.Contains(t, err.Error(), "guestReadyTimeout", "error does not tell how to fix it")
+		require.Empty(t, stock.Started, "container was started")
+
+		details, ok := s.coordinator.DescribeInstance("ctr1")
+		require.True(t, ok, "instance not found")
+		require.Equal(t, eventNotReady, details.Events[len(details.Events)-1].Type, "not ready event was not recorded")
+	})
+
+	t.Run("Plain container", func(t *testing.T) {
+		stock := &fakes.StockRuntimeClient{}
+		s := newTestService(stock, fakes.NewOrchestrator())
+
+		_, err := s.StartContainer(ctx, &criapi.StartContainerRequest{ContainerId: "queue-proxy"})
+		require.NoError(t, err, "plain container was not started")
+		require.Equal(t, []string{"queue-proxy"}, stock.Started, "plain container was not forwarded")
+	})
+}
@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// ContainerStats returns stats of the container. If the container does not
+// exist, the call returns an error. The CPU and the memory usage of a user
+// container are the ones of its VM rather than of its placeholder container.
+func (s *Service) ContainerStats(ctx context.Context, r *criapi.ContainerStatsRequest) (*criapi.ContainerStatsResponse, error) {
+	criLog.Debugf("ContainerStats for %q", r.GetContainerId())
+
+	resp, err := s.stockRuntimeClient.ContainerStats(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.GetStats() != nil {
+		s.setVMStats(ctx, resp.Stats)
+	}
+
+	return resp, nil
+}
+
+// ListContainerStats returns stats of all running containers, with the CPU
+// and the memory usage of the VMs for the user containers.
+func (s *Service) ListContainerStats(ctx context.Context, r *criapi.ListContainerStatsRequest) (*criapi.ListContainerStatsResponse, error) {
+	criLog.Tracef("ListContainerStats with filter %+v", r.GetFilter())
+
+	resp, err := s.stockRuntimeClient.ListContainerStats(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stats := range resp.GetStats() {
+		s.setVMStats(ctx, stats)
+	}
+
+	return resp, nil
+}
+
+// setVMStats replaces the CPU and the memory usage of a user container with
+// the ones of the firecracker process of its VM. They are left out if they
+// cannot be read rather than reporting the usage of the placeholder container.
+func (s *Service) setVMStats(ctx context.Context, stats *criapi.ContainerStats) {
+	if s.coordinator.orch == nil {
+		return
+	}
+
+	fi, ok := s.coordinator.getInstance(stats.GetAttributes().GetId())
+	if !ok {
+		return
+	}
+
+	vmStats, err := s.coordinator.orch.GetVMStats(ctx, fi.vmID)
+	if err != nil {
+		fi.logger.WithError(err).Warn("failed to get the resource usage of the VM")
+		stats.Cpu, stats.Memory = nil, nil
+		return
+	}
+
+	timestamp := vmStats.Timestamp.UnixNano()
+	stats.Cpu = &criapi.CpuUsage{
+		Timestamp:            timestamp,
+		UsageCoreNanoSeconds: &criapi.UInt64Value{Value: vmStats.CPUUsageNanos},
+	}
+	stats.Memory = &criapi.MemoryUsage{
+		Timestamp:       timestamp,
+		WorkingSetBytes: &criapi.UInt64Value{Value: vmStats.MemoryRSSBytes},
+	}
+}
@@ -0,0 +1,82 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestContainerStatsVM(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	// ctr1 and ctr3 are user containers in VMs 1 and 2, ctr2 is the queue-proxy of ctr1
+	for _, r := range []*criapi.CreateContainerRequest{
+		newUserContainerRequest("pod1", "img"),
+		newQueueProxyRequest("pod1"),
+		newUserContainerRequest("pod2", "img"),
+	} {
+		_, err := s.CreateContainer(ctx, r)
+		require.NoError(t, err, "container creation failed")
+	}
+
+	orch.Lock()
+	orch.VMStats = map[string]*ctriface.VMStats{"1": {CPUUsageNanos: 2e9, MemoryRSSBytes: 64 << 20, Timestamp: now}}
+	orch.Unlock()
+
+	resp, err := s.ContainerStats(ctx, &criapi.ContainerStatsRequest{ContainerId: "ctr1"})
+	require.NoError(t, err)
+	require.Equal(t, "ctr1", resp.GetStats().GetAttributes().GetId())
+	require.EqualValues(t, 2e9, resp.GetStats().GetCpu().GetUsageCoreNanoSeconds().GetValue(), "CPU usage is not the one of the VM")
+	require.EqualValues(t, 64<<20, resp.GetStats().GetMemory().GetWorkingSetBytes().GetValue(), "memory usage is not the one of the VM")
+	require.Equal(t, now.UnixNano(), resp.GetStats().GetCpu().GetTimestamp())
+
+	// A plain container reports the stats of the stock containerd
+	resp, err = s.ContainerStats(ctx, &criapi.ContainerStatsRequest{ContainerId: "ctr2"})
+	require.NoError(t, err)
+	require.Equal(t, fakes.PlaceholderStats("ctr2"), resp.GetStats())
+
+	list, err := s.ListContainerStats(ctx, &criapi.ListContainerStatsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetStats(), 3)
+
+	stats := make(map[string]*criapi.ContainerStats)
+	for _, st := range list.GetStats() {
+		stats[st.GetAttributes().GetId()] = st
+	}
+	require.EqualValues(t, 2e9, stats["ctr1"].GetCpu().GetUsageCoreNanoSeconds().GetValue(), "CPU usage is not the one of the VM")
+	require.Equal(t, fakes.PlaceholderStats("ctr2"), stats["ctr2"])
+	// The usage of a VM that cannot be read is left out rather than the one of its placeholder
+	require.Nil(t, stats["ctr3"].GetCpu())
+	require.Nil(t, stats["ctr3"].GetMemory())
+	require.Equal(t, "ctr3", stats["ctr3"].GetAttributes().GetId())
+}
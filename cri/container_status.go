@@ -0,0 +1,102 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	agentUnreachableReason  = "GuestAgentUnreachable"
+	agentUnreachableMessage = "guest agent is unreachable over vsock"
+	guestUnhealthyMessage   = "function in the VM failed its health checks"
+	// bootTraceInfoKey is the key of the cold start timings in the verbose status info
+	bootTraceInfoKey = "vhiveBootTrace"
+	// numaNodeInfoKey is the key of the NUMA node of the VM in the verbose status info
+	numaNodeInfoKey = "vhiveNUMANode"
+	// bootInfoKey is the key of how the VM was started in the verbose status info
+	bootInfoKey = "vhiveBoot"
+)
+
+// ContainerStatus returns status of the container. If the container is not
+// present, returns an error. The status of a user container is annotated if
+// the guest agent of its VM is unreachable or the VM is unhealthy, and the verbose status includes
+// the cold start timings, the NUMA node of the VM and how the VM was started.
+func (s *Service) ContainerStatus(ctx context.Context, r *criapi.ContainerStatusRequest) (*criapi.ContainerStatusResponse, error) {
+	criLog.Tracef("ContainerStatus for %q", r.GetContainerId())
+
+	resp, err := s.stockRuntimeClient.ContainerStatus(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, ok := s.coordinator.getInstance(r.GetContainerId())
+	if !ok || resp.GetStatus() == nil {
+		return resp, nil
+	}
+
+	if fi.agent != nil && !fi.agent.Reachable() {
+		resp.Status.Reason = agentUnreachableReason
+		resp.Status.Message = agentUnreachableMessage
+	} else if fi.isUnhealthy() {
+		resp.Status.Reason = guestUnhealthyReason
+		resp.Status.Message = guestUnhealthyMessage
+	}
+
+	if r.GetVerbose() && fi.bootTrace != nil {
+		trace, err := json.Marshal(fi.bootTrace)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Info == nil {
+			resp.Info = make(map[string]string)
+		}
+		resp.Info[bootTraceInfoKey] = string(trace)
+	}
+
+	if boot := fi.history.lastBoot(); r.GetVerbose() && boot != nil {
+		info, err := json.Marshal(boot)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Info == nil {
+			resp.Info = make(map[string]string)
+		}
+		resp.Info[bootInfoKey] = string(info)
+	}
+
+	if r.GetVerbose() && fi.startVMResponse != nil && fi.startVMResponse.NUMANode >= 0 {
+		if resp.Info == nil {
+			resp.Info = make(map[string]string)
+		}
+		resp.Info[numaNodeInfoKey] = strconv.Itoa(fi.startVMResponse.NUMANode)
+	}
+
+	return resp, nil
+}
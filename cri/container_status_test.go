@@ -0,0 +1,133 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestContainerStatusGuestAgent(t *testing.T) {
+	dir := t.TempDir()
+	agentPath := filepath.Join(dir, "agent.sock")
+
+	lis, err := net.Listen("unix", agentPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	server := grpc.NewServer()
+	guestagent.NewServer(nil).Register(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	reachable, err := guestagent.NewChannel(guestagent.UnixDialer(agentPath), guestagent.WithHealthInterval(50*time.Millisecond))
+	require.NoError(t, err, "failed to create channel")
+	defer reachable.Close()
+
+	unreachable, err := guestagent.NewChannel(guestagent.UnixDialer(filepath.Join(dir, "missing.sock")), guestagent.WithHealthInterval(50*time.Millisecond))
+	require.NoError(t, err, "failed to create channel")
+	defer unreachable.Close()
+
+	for containerID, agent := range map[string]*guestagent.Channel{"up": reachable, "down": unreachable, "none": nil} {
+		fi := newFuncInstance(containerID, "image", nil)
+		fi.agent = agent
+		require.NoError(t, s.coordinator.insertActive("pod", containerID, fi))
+	}
+
+	require.Eventually(t, reachable.Reachable, 5*time.Second, 50*time.Millisecond, "agent is not reachable")
+
+	testCases := []struct {
+		containerID string
+		reason      string
+	}{
+		{containerID: "up"},
+		{containerID: "down", reason: agentUnreachableReason},
+		{containerID: "none"},
+		{containerID: "stock"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.containerID, func(t *testing.T) {
+			resp, err := s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: tc.containerID})
+			require.NoError(t, err)
+			require.Equal(t, criapi.ContainerState_CONTAINER_RUNNING, resp.GetStatus().GetState())
+			require.Equal(t, tc.reason, resp.GetStatus().GetReason())
+		})
+	}
+}
+
+func TestContainerStatusNUMANode(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	for containerID, node := range map[string]int{"placed": 1, "unplaced": -1} {
+		fi := newFuncInstance(containerID, "image", &ctriface.StartVMResponse{NUMANode: node})
+		require.NoError(t, s.coordinator.insertActive("pod", containerID, fi))
+	}
+
+	resp, err := s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: "placed", Verbose: true})
+	require.NoError(t, err)
+	require.Equal(t, "1", resp.GetInfo()[numaNodeInfoKey], "NUMA node missing from verbose status")
+
+	resp, err = s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: "placed"})
+	require.NoError(t, err)
+	require.NotContains(t, resp.GetInfo(), numaNodeInfoKey, "NUMA node in non-verbose status")
+
+	resp, err = s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: "unplaced", Verbose: true})
+	require.NoError(t, err)
+	require.NotContains(t, resp.GetInfo(), numaNodeInfoKey, "NUMA node of an unplaced VM")
+}
+
+func TestContainerStatusBootInfo(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	status, err := s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: resp.ContainerId, Verbose: true})
+	require.NoError(t, err)
+	require.Contains(t, status.GetInfo(), bootInfoKey, "boot missing from verbose status")
+
+	var boot BootInfo
+	require.NoError(t, json.Unmarshal([]byte(status.GetInfo()[bootInfoKey]), &boot))
+	require.Equal(t, bootCold, boot.Type)
+	require.Positive(t, boot.DurationMs, "boot duration was not recorded")
+	require.Nil(t, boot.SnapshotSource)
+
+	status, err = s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: resp.ContainerId})
+	require.NoError(t, err)
+	require.NotContains(t, status.GetInfo(), bootInfoKey, "boot in non-verbose status")
+}
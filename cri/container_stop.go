@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// drainPollPeriod is how often a stopping VM is checked for requests in flight
+const drainPollPeriod = 10 * time.Millisecond
+
+// ErrInstanceDraining rejects the requests to the VM of a stopping container. It is
+// Unavailable, so that the request is retried on another instance of the function.
+var ErrInstanceDraining = status.Error(codes.Unavailable, "container is stopping, its VM does not accept new requests")
+
+// StopContainer stops a running container. The VM of a user container first stops
+// accepting requests and serves the ones in flight, up to the drain grace period
+// of the config or the timeout of the request if shorter, before it is stopped.
+func (s *Service) StopContainer(ctx context.Context, r *criapi.StopContainerRequest) (*criapi.StopContainerResponse, error) {
+	criLog.Debugf("StopContainer for %q with timeout %d (s)", r.GetContainerId(), r.GetTimeout())
+	containerID := r.GetContainerId()
+
+	grace := s.coordinator.config.get().DrainGracePeriod
+	if timeout := time.Duration(r.GetTimeout()) * time.Second; timeout > 0 && timeout < grace {
+		grace = timeout
+	}
+
+	if s.coordinator.drainInstance(ctx, containerID, grace) {
+		ctx := withAuditActor(context.Background(), AuditActorCRI)
+		if err := s.coordinator.removeVM(ctx, containerID); err != nil {
+			criLog.WithError(err).Error("failed to stop microVM")
+		}
+	}
+
+	return s.stockRuntimeClient.StopContainer(ctx, r)
+}
+
+// drainInstance stops the VM of the container from accepting requests and waits
+// for the ones in flight, up to the grace period. It returns false if the
+// container has no VM.
+func (c *coordinator) drainInstance(ctx context.Context, containerID string, grace time.Duration) bool {
+	c.Lock()
+	fi, ok := c.activeInstances[containerID]
+	if ok {
+		// under the lock, so that no request is admitted once the drain starts
+		atomic.StoreInt32(&fi.draining, 1)
+	}
+	c.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	logger := fi.logger.WithField("containerID", containerID)
+	if !fi.isServing() {
+		return true
+	}
+
+	logger.WithField("inFlight", atomic.LoadInt64(&fi.inFlight)).Info("draining the requests in flight before stopping the VM")
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(drainPollPeriod)
+	defer ticker.Stop()
+
+	for fi.isServing() {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			logger.WithField("inFlight", atomic.LoadInt64(&fi.inFlight)).
+				Warn("stopping the VM with requests in flight, the drain grace period is over")
+			return true
+		case <-ctx.Done():
+			logger.WithError(ctx.Err()).Warn("stopping the VM with requests in flight, the request was cancelled")
+			return true
+		}
+	}
+
+	return true
+}
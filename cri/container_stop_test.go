@@ -0,0 +1,110 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestStopContainerDrainsInFlight(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+	containerID := resp.GetContainerId()
+
+	done, err := s.AdmitInvocation(containerID)
+	require.NoError(t, err, "request was not admitted")
+
+	stopped := make(chan error, 1)
+	go func() {
+		_, err := s.StopContainer(context.Background(), &criapi.StopContainerRequest{ContainerId: containerID})
+		stopped <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := s.AdmitInvocation(containerID)
+		return err == ErrInstanceDraining
+	}, time.Second, time.Millisecond, "stopping container admitted a new request")
+
+	select {
+	case <-stopped:
+		t.Fatal("container was stopped with a request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Zero(t, orch.NumStopped("1"), "VM was stopped with a request in flight")
+
+	done()
+
+	select {
+	case err := <-stopped:
+		require.NoError(t, err, "failed to stop container")
+	case <-time.After(time.Second):
+		t.Fatal("container was not stopped once its requests were served")
+	}
+	require.Equal(t, 1, orch.NumStopped("1"), "VM was not stopped")
+}
+
+func TestStopContainerDrainGracePeriod(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	cfg := DefaultConfig()
+	cfg.DrainGracePeriod = 50 * time.Millisecond
+	s.coordinator.config.set(cfg)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	// The request is never served
+	_ = s.TrackInvocation(resp.GetContainerId())
+
+	start := time.Now()
+	_, err = s.StopContainer(context.Background(), &criapi.StopContainerRequest{ContainerId: resp.GetContainerId(), Timeout: 10})
+	require.NoError(t, err, "failed to stop container")
+
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(cfg.DrainGracePeriod), "VM was stopped before the grace period")
+	require.Less(t, int64(time.Since(start)), int64(time.Second), "VM was stopped after the grace period")
+	require.Equal(t, 1, orch.NumStopped("1"), "VM was not stopped after the grace period")
+}
+
+func TestStopContainerWithoutVM(t *testing.T) {
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, fakes.NewOrchestrator())
+
+	_, err := s.StopContainer(context.Background(), &criapi.StopContainerRequest{ContainerId: "queue-proxy"})
+	require.NoError(t, err, "failed to stop container")
+	require.Equal(t, []string{"queue-proxy"}, stock.Stopped, "container was not stopped by the stock runtime")
+
+	done, err := s.AdmitInvocation("queue-proxy")
+	require.NoError(t, err, "request to a container without a VM was rejected")
+	done()
+}
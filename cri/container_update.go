@@ -0,0 +1,142 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// minCPUQuotaUs is the smallest CFS quota of a cgroup
+const minCPUQuotaUs = 1000
+
+// UpdateContainerResources updates ContainerConfig of the container. The
+// resources of a user container are applied to its VM instead of the
+// placeholder container, see updateResources.
+func (s *Service) UpdateContainerResources(ctx context.Context, r *criapi.UpdateContainerResourcesRequest) (*criapi.UpdateContainerResourcesResponse, error) {
+	criLog.Debugf("UpdateContainerResources for %q with %+v", r.GetContainerId(), r.GetLinux())
+
+	if handled, err := s.coordinator.updateResources(ctx, r.GetContainerId(), r.GetLinux()); handled {
+		if err != nil {
+			criLog.WithError(err).WithField("containerID", r.GetContainerId()).Error("failed to update the resources of the VM")
+			return nil, err
+		}
+		return &criapi.UpdateContainerResourcesResponse{}, nil
+	}
+
+	return s.stockRuntimeClient.UpdateContainerResources(ctx, r)
+}
+
+// updateResources applies the resources of a user container to its running VM,
+// returning false if the container has no VM. The memory limit is the guest
+// memory left to the VM by its balloon, which cannot grow beyond the boot memory
+// of the VM, and the CPU limit is the CPU quota of the VM, at most its vCPU count.
+// The changes that cannot be applied are rejected with the VM left unchanged.
+func (c *coordinator) updateResources(ctx context.Context, containerID string, res *criapi.LinuxContainerResources) (bool, error) {
+	fi, ok := c.getInstance(containerID)
+	if !ok {
+		return false, nil
+	}
+
+	fi.opMu.Lock()
+	defer fi.opMu.Unlock()
+
+	if state, _ := fi.history.get(); state != vmStateRunning {
+		return true, status.Errorf(codes.FailedPrecondition,
+			"the resources of container %s cannot be updated, its VM %s is %s", containerID, fi.vmID, state)
+	}
+
+	bootMib, vcpus := fi.vmOpts.MemSizeMib, float64(fi.vmOpts.VcpuCount)
+
+	memTargetMib := bootMib
+	if limit := res.GetMemoryLimitInBytes(); limit > 0 {
+		if limit>>20 > int64(bootMib) {
+			return true, status.Errorf(codes.InvalidArgument,
+				"the memory limit of container %s (%d MiB) exceeds the boot memory of its VM (%d MiB), the guest memory cannot grow beyond it",
+				containerID, limit>>20, bootMib)
+		}
+		if memTargetMib = uint32(limit >> 20); memTargetMib == 0 {
+			return true, status.Errorf(codes.InvalidArgument,
+				"the memory limit of container %s (%d bytes) is below 1 MiB", containerID, limit)
+		}
+	}
+
+	cpuQuota := vcpus
+	if quota, period := res.GetCpuQuota(), res.GetCpuPeriod(); quota > 0 && period > 0 {
+		if quota < minCPUQuotaUs {
+			return true, status.Errorf(codes.InvalidArgument,
+				"the CPU quota of container %s (%dus) is below the minimum of %dus", containerID, quota, minCPUQuotaUs)
+		}
+		// The VM cannot use more CPUs than its vCPUs
+		if cpus := float64(quota) / float64(period); cpus < vcpus {
+			cpuQuota = cpus
+		}
+	}
+
+	// The quota is kept in thousandths of CPUs
+	cpuQuota = math.Round(cpuQuota*1000) / 1000
+
+	curMib, curQuota := fi.getResources()
+
+	var update ctriface.VMResources
+	if memTargetMib != curMib {
+		update.MemSizeMib = memTargetMib
+	}
+	if cpuQuota != curQuota {
+		update.CPUQuota = cpuQuota
+	}
+	if update == (ctriface.VMResources{}) {
+		return true, nil
+	}
+
+	if update.MemSizeMib != 0 {
+		if err := c.mem.resize(fi.vmID, memTargetMib); err != nil {
+			return true, err
+		}
+	}
+
+	if !c.withoutOrchestrator {
+		if err := c.orch.UpdateVMResources(ctx, fi.vmID, update); err != nil {
+			if update.MemSizeMib != 0 {
+				// The memory of the VM is unchanged
+				_ = c.mem.resize(fi.vmID, curMib)
+			}
+			return true, err
+		}
+	}
+
+	atomic.StoreUint32(&fi.memTargetMib, memTargetMib)
+	atomic.StoreInt64(&fi.cpuMillis, int64(cpuQuota*1000))
+
+	fi.history.record(eventResized, "resized to %d MiB of guest memory and %g CPUs", memTargetMib, cpuQuota)
+	fi.logger.WithFields(log.Fields{"memTargetMib": memTargetMib, "cpuQuota": cpuQuota}).Info("updated the resources of the VM")
+
+	return true, nil
+}
@@ -0,0 +1,141 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newUpdateRequest(containerID string, memMib, cpuQuota int64) *criapi.UpdateContainerResourcesRequest {
+	return &criapi.UpdateContainerResourcesRequest{
+		ContainerId: containerID,
+		Linux: &criapi.LinuxContainerResources{
+			MemoryLimitInBytes: memMib << 20,
+			CpuPeriod:          100000,
+			CpuQuota:           cpuQuota,
+		},
+	}
+}
+
+func TestUpdateContainerResources(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	cfg := DefaultConfig()
+	cfg.VcpuCount = 2
+	s.coordinator.config.set(cfg)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+	containerID := resp.GetContainerId()
+
+	// Shrink
+	_, err = s.UpdateContainerResources(context.Background(), newUpdateRequest(containerID, 128, 50000))
+	require.NoError(t, err, "failed to shrink the VM")
+
+	vm := s.coordinator.ListActive()[0]
+	require.EqualValues(t, 128, vm.MemTargetMib, "memory target was not recorded")
+	require.Equal(t, 0.5, vm.CPUQuota, "CPU quota was not recorded")
+	require.EqualValues(t, 256, vm.MemSizeMib, "boot memory changed")
+	require.EqualValues(t, 128, s.MemoryStats().CommittedMib, "reclaimed memory is still committed")
+
+	// Grow back within the boot resources, a CPU limit above the vCPUs leaves them unthrottled
+	_, err = s.UpdateContainerResources(context.Background(), newUpdateRequest(containerID, 256, 400000))
+	require.NoError(t, err, "failed to grow the VM")
+
+	vm = s.coordinator.ListActive()[0]
+	require.EqualValues(t, 256, vm.MemTargetMib, "memory target was not recorded")
+	require.Equal(t, 2.0, vm.CPUQuota, "CPU quota was not recorded")
+	require.EqualValues(t, 256, s.MemoryStats().CommittedMib, "grown memory is not committed")
+
+	// Unchanged resources are not applied again
+	_, err = s.UpdateContainerResources(context.Background(), newUpdateRequest(containerID, 0, 0))
+	require.NoError(t, err, "failed to update the VM")
+
+	require.Equal(t, []ctriface.VMResources{
+		{MemSizeMib: 128, CPUQuota: 0.5},
+		{MemSizeMib: 256, CPUQuota: 2},
+	}, orch.Resources["1"], "unexpected updates of the VM")
+	require.Empty(t, stock.Updated, "placeholder container was updated")
+
+	details, ok := s.coordinator.DescribeInstance(containerID)
+	require.True(t, ok, "instance not found")
+	require.Equal(t, eventResized, details.Events[len(details.Events)-1].Type, "resize was not recorded")
+}
+
+func TestUpdateContainerResourcesRejected(t *testing.T) {
+	cases := []struct {
+		name       string
+		memMib     int64
+		cpuQuota   int64
+		updateErr  error
+		expectCode codes.Code
+	}{
+		{name: "Memory beyond boot memory", memMib: 512, expectCode: codes.InvalidArgument},
+		{name: "CPU quota below minimum", cpuQuota: 500, expectCode: codes.InvalidArgument},
+		{
+			name:       "Orchestrator rejects",
+			memMib:     128,
+			updateErr:  status.Error(codes.Unimplemented, "no balloon device"),
+			expectCode: codes.Unimplemented,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.UpdateErr = c.updateErr
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+			require.NoError(t, err, "container creation failed")
+
+			_, err = s.UpdateContainerResources(context.Background(), newUpdateRequest(resp.GetContainerId(), c.memMib, c.cpuQuota))
+			require.Equal(t, c.expectCode, status.Code(err), "unexpected error code")
+
+			vm := s.coordinator.ListActive()[0]
+			require.EqualValues(t, 256, vm.MemTargetMib, "memory target changed")
+			require.Equal(t, 1.0, vm.CPUQuota, "CPU quota changed")
+			require.EqualValues(t, 256, s.MemoryStats().CommittedMib, "committed memory changed")
+			require.Empty(t, orch.Resources, "VM was updated")
+		})
+	}
+}
+
+func TestUpdateContainerResourcesWithoutVM(t *testing.T) {
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, fakes.NewOrchestrator())
+
+	_, err := s.UpdateContainerResources(context.Background(), newUpdateRequest("queue-proxy", 64, 0))
+	require.NoError(t, err, "failed to update container")
+	require.Equal(t, []string{"queue-proxy"}, stock.Updated, "container was not updated by the stock runtime")
+}
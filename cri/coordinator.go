@@ -25,23 +25,117 @@ package cri
 import (
 	"context"
 	"errors"
-	"strconv"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/go-multierror/multierror"
 	log "github.com/sirupsen/logrus"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
+// Orchestrator is the subset of the ctriface.Orchestrator API that the
+// coordinator starts, stops, snapshots and looks up the VMs with
+type Orchestrator interface {
+	StartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error)
+	StopSingleVM(ctx context.Context, vmID string) error
+	RestartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error)
+	PauseVM(ctx context.Context, vmID string) error
+	ResumeVM(ctx context.Context, vmID string) (*metrics.Metric, error)
+	CreateSnapshot(ctx context.Context, vmID string) error
+	LoadSnapshot(ctx context.Context, vmID string) (*metrics.Metric, error)
+	PrepareRestore(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error)
+	Offload(ctx context.Context, vmID string) error
+	EndCPUBoost(vmID string) (*metrics.Metric, error)
+	UpdateVMResources(ctx context.Context, vmID string, res ctriface.VMResources) error
+	GetSnapshotsEnabled() bool
+	GetSnapshotFiles(vmID string) (snapFile, memFile string)
+	GetWorkingSetFile(vmID string) string
+	GetWorkingSetCorruptions() uint64
+	GetWorkingSetPrefetches() (prefetched, missed uint64)
+	WaitWorkingSet(ctx context.Context, vmID string) (*metrics.Metric, error)
+	GetVMStats(ctx context.Context, vmID string) (*ctriface.VMStats, error)
+	HasVM(vmID string) bool
+}
+
+const agentReadyPollInterval = 50 * time.Millisecond
+
 type coordinator struct {
 	sync.Mutex
-	orch   *ctriface.Orchestrator
-	nextID uint64
+	orch  Orchestrator
+	vmIDs *vmIDAllocator
 
 	activeInstances     map[string]*funcInstance
 	idleInstances       map[string][]*funcInstance
 	withoutOrchestrator bool
+
+	// guestAgentPort is the vsock port the guest agent listens on, 0 if disabled
+	guestAgentPort uint32
+	agentDialer    func(vsockPath string, port uint32) guestagent.Dialer
+
+	disks *diskManager
+
+	// evictionEnabled allows evicting the least-recently-used idle VM
+	// when a VM fails to start for lack of memory
+	evictionEnabled bool
+
+	mem *memoryAccountant
+
+	// healthStop and healthDone control the health checker, nil if it is not running
+	healthStop chan struct{}
+	healthDone chan struct{}
+
+	// offloading counts the VMs of each image being scaled to zero,
+	// offloaded is closed and replaced when one of them is offloaded
+	offloading map[string]int
+	offloaded  chan struct{}
+	snapStats  *snapshotStats
+	// prefetcher reads the snapshot files into the page cache before the
+	// restores, nil if they are not prefetched
+	prefetcher *snapshotPrefetcher
+
+	// events bounds the events kept by all the instances
+	events *eventBudget
+
+	images        *imageCache
+	startFailures *startFailureStats
+
+	// config is the current configuration of the VMs
+	config *configStore
+	// quotas tracks the VMs being created towards the quotas of their namespace
+	quotas *namespaceQuotas
+
+	// audit records the lifecycle operations on the VMs, nil if disabled
+	audit *AuditLog
+	// bootLatency records the breakdown of the cold starts, nil if disabled
+	bootLatency *BootLatencyLog
+
+	// faults injects failures for testing, nil if disabled
+	faults *faultRegistry
+
+	// snapStore keeps the snapshots of the VMs off the node, nil if disabled
+	snapStore SnapshotStore
+	// snapPeer transfers the snapshots of the VMs between the nodes, nil if disabled
+	snapPeer *snapshotPeer
+
+	// exitHandlers are called when a VM exits unexpectedly, see OnVMExit
+	exitHandlers []func(VMExitEvent)
+
+	// parking keeps the VMs of the removed containers for the next containers
+	// of their revision, nil if slot reuse is disabled
+	parking *vmParking
+
+	// connProxyIP is the host address of the connection proxies of the VMs,
+	// empty if they are disabled
+	connProxyIP string
+
+	// runHook runs the post-boot hook, replaced in the tests
+	runHook func(ctx context.Context, name string, args ...string) ([]byte, error)
 }
 
 type coordinatorOption func(*coordinator)
@@ -53,12 +147,26 @@ func withoutOrchestrator() coordinatorOption {
 	}
 }
 
-func newCoordinator(orch *ctriface.Orchestrator, opts ...coordinatorOption) *coordinator {
+func newCoordinator(orch Orchestrator, opts ...coordinatorOption) *coordinator {
 	c := &coordinator{
 		activeInstances: make(map[string]*funcInstance),
 		idleInstances:   make(map[string][]*funcInstance),
 		orch:            orch,
+		vmIDs:           &vmIDAllocator{},
+		disks:           newDiskManager(defaultExtraDiskDir, DiskCleanupDelete),
+		agentDialer:     guestagent.VsockDialer,
+		mem:             newMemoryAccountant(0, 0),
+		offloading:      make(map[string]int),
+		snapStats:       newSnapshotStats(),
+		events:          newEventBudget(maxTotalEvents),
+		images:          newImageCache(),
+		startFailures:   newStartFailureStats(),
+		config:          newConfigStore(DefaultConfig()),
+		quotas:          newNamespaceQuotas(),
+		runHook:         runCommand,
+		offloaded:       make(chan struct{}),
 	}
+	c.mem.budgetMib = func() uint64 { return c.config.get().TotalMemBudgetMib }
 
 	for _, opt := range opts {
 		opt(c)
@@ -68,22 +176,65 @@ func newCoordinator(orch *ctriface.Orchestrator, opts ...coordinatorOption) *coo
 }
 
 func (c *coordinator) getIdleInstance(image string) *funcInstance {
+	fi, _, _ := c.getRestorableInstance(context.Background(), image, nil)
+	return fi
+}
+
+// getRestorableInstance takes the first idle instance of the image whose
+// snapshot a VM with the given options can be restored from, any if nil.
+// It also returns whether idle instances were skipped because another
+// firecracker release took their snapshot. Waiting for the VMs of the image
+// being scaled to zero, it fails with the error of ctx once it is done.
+func (c *coordinator) getRestorableInstance(ctx context.Context, image string, vmOpts *ctriface.StartVMOptions) (_ *funcInstance, versionMismatch bool, _ error) {
 	c.Lock()
 	defer c.Unlock()
 
+	// A VM being scaled to zero is restored rather than racing it with a new boot
+	for len(c.idleInstances[image]) == 0 && c.offloading[image] > 0 {
+		offloaded := c.offloaded
+		c.Unlock()
+		select {
+		case <-offloaded:
+		case <-ctx.Done():
+			c.Lock()
+			return nil, false, ctx.Err()
+		}
+		c.Lock()
+	}
+
 	idles, ok := c.idleInstances[image]
 	if !ok {
 		c.idleInstances[image] = []*funcInstance{}
-		return nil
+		return nil, false, nil
 	}
 
-	if len(idles) != 0 {
-		fi := idles[0]
-		c.idleInstances[image] = idles[1:]
-		return fi
+	var want vmShape
+	if vmOpts != nil {
+		want = newVMShape(vmOpts)
 	}
 
-	return nil
+	for i, fi := range idles {
+		if vmOpts != nil {
+			// The snapshot of a VM restores its size, kernel, rate limits and
+			// tap, and only stands for the rootfs digest it verified at boot,
+			// like a parked VM
+			shape := newVMShape(fi.vmOpts)
+			shape.firecracker = want.firecracker
+			if shape != want {
+				continue
+			}
+			// It only loads in the firecracker release that took it
+			if fi.vmOpts.FirecrackerVersion != vmOpts.FirecrackerVersion {
+				versionMismatch = true
+				continue
+			}
+		}
+
+		c.idleInstances[image] = append(idles[:i:i], idles[i+1:]...)
+		return fi, false, nil
+	}
+
+	return nil, versionMismatch, nil
 }
 
 func (c *coordinator) setIdleInstance(fi *funcInstance) {
@@ -98,13 +249,70 @@ func (c *coordinator) setIdleInstance(fi *funcInstance) {
 	c.idleInstances[fi.image] = append(c.idleInstances[fi.image], fi)
 }
 
-func (c *coordinator) startVM(ctx context.Context, image string) (*funcInstance, error) {
-	if fi := c.getIdleInstance(image); c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
-		err := c.orchLoadInstance(ctx, fi)
-		return fi, err
+func (c *coordinator) startVM(ctx context.Context, image string, opts ...ctriface.StartVMOption) (*funcInstance, error) {
+	vmOpts := ctriface.NewStartVMOptions(opts...)
+
+	// A VM booted into a debug init is never restored from the snapshots of the image
+	if len(vmOpts.InitCmd) > 0 {
+		return c.orchStartVM(ctx, image, opts...)
+	}
+
+	fi, versionMismatch, err := c.getRestorableInstance(ctx, image, vmOpts)
+	if err != nil {
+		return nil, err
+	}
+	if versionMismatch {
+		logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"image": image, "version": vmOpts.FirecrackerVersion}).
+			Info("idle VMs were snapshotted by another firecracker release, booting a VM instead")
+		c.snapStats.versionFallback()
+	}
+	if fi == nil && c.orch != nil && c.orch.GetSnapshotsEnabled() {
+		// Without an idle VM on the node, a snapshot taken by any node is restored
+		fi = c.storedInstance(ctx, image, vmOpts, opts...)
+	}
+
+	if c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
+		fi.opMu.Lock()
+		defer fi.opMu.Unlock()
+
+		if err := c.mem.commit(fi.vmID, fi.vmOpts.MemSizeMib); err != nil {
+			c.setIdleInstance(fi)
+			return nil, err
+		}
+
+		tStart := time.Now()
+		_, err := c.orchLoadInstance(ctx, fi)
+		if errors.Is(err, ErrSnapshotIncompatible) {
+			// Detected before loading the snapshot, the VM is booted again
+			if err := c.orchStopVM(detachedContext{ctx}, fi); err != nil {
+				fi.logger.WithError(err).Error("failed to stop VM with incompatible snapshot")
+			}
+			c.snapStats.versionFallback()
+			return c.orchStartVM(ctx, image, opts...)
+		}
+		if errors.Is(err, ErrSnapshotCorrupt) {
+			// The VM is booted again, and its snapshot pushed anew once it is offloaded
+			if err := c.orchStopVM(detachedContext{ctx}, fi); err != nil {
+				fi.logger.WithError(err).Error("failed to stop VM with corrupt snapshot")
+			}
+			return c.orchStartVM(ctx, image, opts...)
+		}
+
+		restoreTime := time.Since(tStart)
+		c.snapStats.restored(restoreTime, c.prefetcher != nil, reapMode(fi), err)
+		if err != nil {
+			// A VM whose snapshot fails to load or whose restore is cancelled is
+			// stopped rather than leaked
+			if err := c.orchStopVM(detachedContext{ctx}, fi); err != nil {
+				fi.logger.WithError(err).Error("failed to stop VM after failed restore")
+			}
+			return nil, err
+		}
+		fi.history.started(bootSnapshot, restoreTime)
+		return fi, nil
 	}
 
-	return c.orchStartVM(ctx, image)
+	return c.orchStartVM(ctx, image, opts...)
 }
 
 func (c *coordinator) stopVM(ctx context.Context, containerID string) error {
@@ -119,13 +327,234 @@ func (c *coordinator) stopVM(ctx context.Context, containerID string) error {
 		return nil
 	}
 
-	if c.orch != nil && c.orch.GetSnapshotsEnabled() {
+	return c.releaseVM(ctx, fi)
+}
+
+// acquireExtraDisk returns the extra disk requested by the user container, if any.
+// A VM restored from a snapshot cannot get a new drive, so extra disks require snapshots to be off.
+func (c *coordinator) acquireExtraDisk(revision string, r *criapi.CreateContainerRequest) (*extraDisk, error) {
+	if _, ok := getAnnotations(r)[extraDiskSizeAnnotation]; ok && c.orch != nil && c.orch.GetSnapshotsEnabled() {
+		return nil, errors.New("extra disks are not supported with snapshots")
+	}
+
+	return c.disks.acquire(revision, r)
+}
+
+// releaseVM frees the VM of an instance, together with its tap and IP,
+// offloading it instead if snapshots are enabled
+func (c *coordinator) releaseVM(ctx context.Context, fi *funcInstance) error {
+	fi.opMu.Lock()
+	defer fi.opMu.Unlock()
+
+	c.closeConnProxy(fi)
+
+	// A VM booted into a debug init is not offloaded for the next VMs of its image
+	state, _ := fi.history.get()
+	if c.orch != nil && c.orch.GetSnapshotsEnabled() && state != vmStateDead && !fi.isDebugInit() {
+		// The function keeps running in the snapshot, the next restore resumes it
+		c.disconnectAgent(ctx, fi, false)
+		if state == vmStateOffloaded {
+			// Offloaded through the admin API already
+			c.setIdleInstance(fi)
+			return nil
+		}
+
 		return c.orchOffloadInstance(ctx, fi)
 	}
 
+	c.disconnectAgent(ctx, fi, true)
 	return c.orchStopVM(ctx, fi)
 }
 
+// sandboxContainers returns the containers of the sandbox with an active VM
+func (c *coordinator) sandboxContainers(sandboxID string) []string {
+	c.Lock()
+	defer c.Unlock()
+
+	var containerIDs []string
+	for containerID, fi := range c.activeInstances {
+		if fi.sandboxID == sandboxID {
+			containerIDs = append(containerIDs, containerID)
+		}
+	}
+	sort.Strings(containerIDs)
+
+	return containerIDs
+}
+
+func (c *coordinator) getInstance(containerID string) (*funcInstance, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	fi, ok := c.activeInstances[containerID]
+	return fi, ok
+}
+
+// CountByRevision returns the number of active VMs of each revision,
+// as a snapshot taken with the lock held
+func (c *coordinator) CountByRevision() map[string]int {
+	c.Lock()
+	defer c.Unlock()
+
+	counts := make(map[string]int)
+	for _, fi := range c.activeInstances {
+		if fi.revisionID != "" {
+			counts[fi.revisionID]++
+		}
+	}
+
+	return counts
+}
+
+// VMInfo describes an active VM. MemTargetMib is the guest memory left by the
+// balloon and CPUQuota the CPU time in CPUs, as set by UpdateContainerResources.
+// BootTrace is a copy of the cold start of the VM, nil if it is not known.
+type VMInfo struct {
+	ContainerID  string        `json:"containerID"`
+	VMID         string        `json:"vmID"`
+	Image        string        `json:"image"`
+	ImageDigest  string        `json:"imageDigest,omitempty"`
+	Revision     string        `json:"revision"`
+	Namespace    string        `json:"namespace,omitempty"`
+	GuestIP      string        `json:"guestIP"`
+	GuestPort    string        `json:"guestPort"`
+	MemSizeMib   uint32        `json:"memSizeMib"`
+	VcpuCount    uint32        `json:"vcpuCount"`
+	MemTargetMib uint32        `json:"memTargetMib"`
+	CPUQuota     float64       `json:"cpuQuota"`
+	BootType     string        `json:"bootType"`
+	StartTime    time.Time     `json:"startTime"`
+	Uptime       time.Duration `json:"uptime"`
+	State        string        `json:"state"`
+	BootTrace    *BootTrace    `json:"bootTrace,omitempty"`
+}
+
+// InstanceDetails describes a function instance with its history
+type InstanceDetails struct {
+	VMInfo
+	SnapshotLineage []SnapshotRecord `json:"snapshotLineage"`
+	Events          []InstanceEvent  `json:"events"`
+}
+
+const (
+	vmStateRunning      = "running"
+	vmStatePaused       = "paused"
+	vmStateOffloaded    = "offloaded"
+	vmStateStopped      = "stopped"
+	vmStateUnresponsive = "unresponsive"
+	vmStateUnhealthy    = "unhealthy"
+	vmStateDead         = "dead"
+)
+
+// ListActive returns a snapshot of the active VMs, sorted by container ID
+func (c *coordinator) ListActive() []VMInfo {
+	c.Lock()
+	active := make(map[string]*funcInstance, len(c.activeInstances))
+	for containerID, fi := range c.activeInstances {
+		active[containerID] = fi
+	}
+	c.Unlock()
+
+	now := time.Now()
+	infos := make([]VMInfo, 0, len(active))
+
+	for containerID, fi := range active {
+		infos = append(infos, fi.info(containerID, now))
+	}
+
+	sortVMInfos(infos)
+
+	return infos
+}
+
+// ListInstances returns a snapshot of the active VMs and of the idle
+// or parked ones waiting for a container, sorted by container and VM ID
+func (c *coordinator) ListInstances() []VMInfo {
+	infos := c.ListActive()
+	now := time.Now()
+
+	c.Lock()
+	for _, idles := range c.idleInstances {
+		for _, fi := range idles {
+			infos = append(infos, fi.info("", now))
+		}
+	}
+	c.Unlock()
+
+	if c.parking != nil {
+		for _, fi := range c.parking.instances() {
+			infos = append(infos, fi.info("", now))
+		}
+	}
+
+	sortVMInfos(infos)
+
+	return infos
+}
+
+// DescribeInstance returns the instance with the given container or VM ID,
+// including its snapshot lineage and recent events
+func (c *coordinator) DescribeInstance(id string) (InstanceDetails, bool) {
+	containerID, fi := c.findInstance(id)
+	if fi == nil {
+		return InstanceDetails{}, false
+	}
+
+	details := InstanceDetails{VMInfo: fi.info(containerID, time.Now())}
+	details.SnapshotLineage, details.Events = fi.history.copy()
+
+	return details, true
+}
+
+// findInstance looks up an active instance by container or VM ID,
+// then an idle one by VM ID
+func (c *coordinator) findInstance(id string) (string, *funcInstance) {
+	c.Lock()
+	defer c.Unlock()
+
+	if fi, ok := c.activeInstances[id]; ok {
+		return id, fi
+	}
+
+	for containerID, fi := range c.activeInstances {
+		if fi.vmID == id {
+			return containerID, fi
+		}
+	}
+
+	for _, idles := range c.idleInstances {
+		for _, fi := range idles {
+			if fi.vmID == id {
+				return "", fi
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func sortVMInfos(infos []VMInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ContainerID != infos[j].ContainerID {
+			return infos[i].ContainerID < infos[j].ContainerID
+		}
+		return infos[i].VMID < infos[j].VMID
+	})
+}
+
+// activeContainers returns the IDs of the containers with an active VM
+func (c *coordinator) activeContainers() map[string]bool {
+	c.Lock()
+	defer c.Unlock()
+
+	active := make(map[string]bool, len(c.activeInstances))
+	for containerID := range c.activeInstances {
+		active[containerID] = true
+	}
+
+	return active
+}
+
 // for testing
 func (c *coordinator) isActive(containerID string) bool {
 	c.Lock()
@@ -135,11 +564,11 @@ func (c *coordinator) isActive(containerID string) bool {
 	return ok
 }
 
-func (c *coordinator) insertActive(containerID string, fi *funcInstance) error {
+func (c *coordinator) insertActive(sandboxID, containerID string, fi *funcInstance) error {
 	c.Lock()
 	defer c.Unlock()
 
-	logger := log.WithFields(log.Fields{"containerID": containerID, "vmID": fi.vmID})
+	logger := coordLog.WithFields(log.Fields{"containerID": containerID, "vmID": fi.vmID})
 
 	if fi, present := c.activeInstances[containerID]; present {
 		logger.Errorf("entry for container already exists with vmID %s" + fi.vmID)
@@ -147,58 +576,163 @@ func (c *coordinator) insertActive(containerID string, fi *funcInstance) error {
 	}
 
 	c.activeInstances[containerID] = fi
+	fi.sandboxID = sandboxID
+	fi.history.record(eventAttached, "attached to container %s", containerID)
 	return nil
 }
 
-func (c *coordinator) orchStartVM(ctx context.Context, image string) (*funcInstance, error) {
-	vmID := strconv.Itoa(int(atomic.AddUint64(&c.nextID, 1)))
-	logger := log.WithFields(
-		log.Fields{
-			"vmID":  vmID,
-			"image": image,
-		},
-	)
+func (c *coordinator) orchStartVM(ctx context.Context, image string, opts ...ctriface.StartVMOption) (*funcInstance, error) {
+	logger := logging.FromContext(ctx, logging.Coordinator).WithField("image", image)
+
+	vmID, err := c.newVMID(logger)
+	if err != nil {
+		logger.WithError(err).Error("failed to allocate a vmID")
+		return nil, err
+	}
+	logger = logger.WithField("vmID", vmID)
 
 	logger.Debug("creating fresh instance")
 
+	cfg := c.config.get()
+
 	var (
-		resp *ctriface.StartVMResponse
-		err  error
+		resp          *ctriface.StartVMResponse
+		startVMMetric *metrics.Metric
 	)
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*40)
+	memSizeMib := ctriface.NewStartVMOptions(opts...).MemSizeMib
+	err = c.mem.commit(vmID, memSizeMib)
+	if err != nil && c.evictionEnabled && c.evictLRU(ctx, vmID) {
+		err = c.mem.commit(vmID, memSizeMib)
+	}
+	if err != nil {
+		logger.WithError(err).Error("coordinator refused to start VM")
+		c.audit.record(ctx, AuditRecord{Event: auditVMStarted, VMID: vmID, Image: image, MemSizeMib: memSizeMib}, err)
+		return nil, err
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, cfg.StartTimeout)
 	defer cancel()
 
+	tStart := time.Now()
+	rec := metrics.NewPhaseRecorder(tStart)
 	if !c.withoutOrchestrator {
-		resp, _, err = c.orch.StartVM(ctxTimeout, vmID, image)
+		// The recorder is not the last option, which orchStartVMImage may strip
+		recOpts := append([]ctriface.StartVMOption{ctriface.WithPhaseRecorder(rec)}, opts...)
+		resp, startVMMetric, err = c.orchStartVMImage(ctxTimeout, vmID, image, recOpts...)
+		if err != nil && c.evictionEnabled && isOutOfMemory(err) && c.evictLRU(ctx, vmID) {
+			logger.WithError(err).Warn("retrying to start VM after eviction")
+			resp, startVMMetric, err = c.orchStartVMImage(ctxTimeout, vmID, image, recOpts...)
+		}
+		rec.Mark(metrics.PhaseOther)
 		if err != nil {
-			logger.WithError(err).Error("coordinator failed to start VM")
+			se := newStartError(err)
+			se.VMID = vmID
+			if errors.Is(se, ErrStartCancelled) {
+				logger.WithField("phase", se.Phase).Info("start of the VM was cancelled")
+			} else {
+				c.startFailures.failed(se.Phase)
+				logger.WithError(err).WithField("phase", se.Phase).Error("coordinator failed to start VM")
+			}
+			c.mem.release(vmID)
+			err = se
 		}
 	}
 
 	fi := newFuncInstance(vmID, image, resp)
+	fi.history.budget = c.events
+	fi.vmOpts = ctriface.NewStartVMOptions(opts...)
+	fi.bootTrace = newBootTrace(tStart, time.Now(), startVMMetric)
+	fi.bootTrace.FirecrackerVersion = fi.vmOpts.FirecrackerVersion
+	fi.bootTrace.MemoryBacking = memoryBackingAnonymous
+	if fi.vmOpts.Hugepages {
+		fi.bootTrace.MemoryBacking = memoryBackingHugepages
+	}
+	if err == nil {
+		c.connectAgent(fi)
+		if fi.agent != nil {
+			if err := c.waitAgentReady(ctx, fi, cfg.AgentReadyTimeout); err != nil {
+				fi.logger.WithError(err).Warn("guest agent did not become ready")
+			} else {
+				fi.bootTrace.AgentReady = time.Now()
+				rec.MarkAt(metrics.PhaseGuestReady, fi.bootTrace.AgentReady)
+			}
+		}
+		logger.WithFields(fi.bootTrace.fields()).Info("cold start phases")
+		fi.history.record(eventCreated, "VM %s created for image %s", vmID, image)
+		fi.history.record(eventBooted, "VM booted in %s", fi.bootTrace.VMBooted.Sub(fi.bootTrace.Start).Round(time.Millisecond))
+		fi.history.started(bootCold, fi.bootTrace.VMBooted.Sub(fi.bootTrace.Start))
+		c.watchVMExit(fi)
+	}
+	fi.bootTrace.PhasesMs = rec.Milliseconds()
+	c.auditInstance(ctx, auditVMStarted, fi, err)
+	c.bootLatency.record(ctx, BootLatencyRecord{
+		VMID:     vmID,
+		Revision: fi.revisionID,
+		Image:    image,
+		TotalMs:  float64(rec.Total()) / float64(time.Millisecond),
+		PhasesMs: fi.bootTrace.PhasesMs,
+	}, err)
+
 	logger.Debug("successfully created fresh instance")
 	return fi, err
 }
 
-func (c *coordinator) orchLoadInstance(ctx context.Context, fi *funcInstance) error {
+func (c *coordinator) orchLoadInstance(ctx context.Context, fi *funcInstance) (_ *metrics.Metric, err error) {
 	fi.logger.Debug("found idle instance to load")
 
+	defer func() {
+		c.auditInstance(ctx, auditSnapshotRestored, fi, err)
+	}()
+
+	tStart := time.Now()
+	if err := c.pullSnapshot(ctx, fi); err != nil {
+		fi.logger.WithError(err).Error("failed to load VM")
+		return nil, err
+	}
+
+	if c.prefetcher != nil {
+		snapFile, memFile := c.orch.GetSnapshotFiles(fi.vmID)
+		c.prefetcher.prefetch(snapFile, memFile, c.orch.GetWorkingSetFile(fi.vmID))
+	}
+
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
-	if _, err := c.orch.LoadSnapshot(ctxTimeout, fi.vmID); err != nil {
+	if err := c.faults.fire(FaultSnapshotLoad); err != nil {
 		fi.logger.WithError(err).Error("failed to load VM")
-		return err
+		return nil, err
 	}
 
-	if _, err := c.orch.ResumeVM(ctxTimeout, fi.vmID); err != nil {
+	loadMetric, err := c.orch.LoadSnapshot(ctxTimeout, fi.vmID)
+	if err != nil {
 		fi.logger.WithError(err).Error("failed to load VM")
-		return err
+		return nil, err
+	}
+
+	resumeMetric, err := c.orch.ResumeVM(ctxTimeout, fi.vmID)
+	if err != nil {
+		fi.logger.WithError(err).Error("failed to load VM")
+		return nil, err
 	}
 
+	var waitMetric *metrics.Metric
+	if reapMode(fi) == reapEager {
+		// The first request finds the working set in the guest memory rather than faulting it in
+		var waitErr error
+		if waitMetric, waitErr = c.orch.WaitWorkingSet(ctxTimeout, fi.vmID); waitErr != nil {
+			fi.logger.WithError(waitErr).Warn("failed to wait for the working set, installing it lazily")
+		}
+	}
+
+	atomic.StoreInt32(&fi.exitExpected, 0)
+	c.connectAgent(fi)
+	fi.history.snapshotLoaded(time.Since(tStart))
+	syncMetric := c.syncClock(ctx, fi)
+
 	fi.logger.Debug("successfully loaded idle instance")
-	return nil
+	fi.restoreMetric = mergeMetrics(loadMetric, resumeMetric, waitMetric, syncMetric)
+	return fi.restoreMetric, nil
 }
 
 func (c *coordinator) orchCreateSnapshot(ctx context.Context, fi *funcInstance) error {
@@ -209,12 +743,19 @@ func (c *coordinator) orchCreateSnapshot(ctx context.Context, fi *funcInstance)
 			ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*60)
 			defer cancel()
 
+			defer func() {
+				c.auditInstance(ctx, auditSnapshotTaken, fi, err)
+			}()
+
 			fi.logger.Debug("creating instance snapshot on first time offloading")
 
-			err = c.orch.PauseVM(ctxTimeout, fi.vmID)
-			if err != nil {
-				fi.logger.WithError(err).Error("failed to pause VM")
-				return
+			if state, _ := fi.history.get(); state != vmStatePaused {
+				err = c.orch.PauseVM(ctxTimeout, fi.vmID)
+				if err != nil {
+					fi.logger.WithError(err).Error("failed to pause VM")
+					return
+				}
+				fi.history.setState(vmStatePaused, eventPaused, "paused to create snapshot")
 			}
 
 			err = c.orch.CreateSnapshot(ctxTimeout, fi.vmID)
@@ -222,6 +763,12 @@ func (c *coordinator) orchCreateSnapshot(ctx context.Context, fi *funcInstance)
 				fi.logger.WithError(err).Error("failed to create snapshot")
 				return
 			}
+			fi.history.snapshotCreated(fi.snapshotRecord(""))
+
+			// The VM is still restored from its local snapshot if the push fails
+			if err := c.pushSnapshot(ctx, fi); err != nil {
+				fi.logger.WithError(err).Warn("failed to push snapshot to the snapshot store")
+			}
 		},
 	)
 
@@ -238,24 +785,168 @@ func (c *coordinator) orchOffloadInstance(ctx context.Context, fi *funcInstance)
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	if err := c.orch.Offload(ctxTimeout, fi.vmID); err != nil {
+	atomic.StoreInt32(&fi.exitExpected, 1)
+	err := c.orch.Offload(ctxTimeout, fi.vmID)
+	if err != nil {
 		fi.logger.WithError(err).Error("failed to offload instance")
 	}
+	c.auditInstance(ctx, auditVMOffloaded, fi, err)
+
+	c.mem.release(fi.vmID)
+	fi.history.setState(vmStateOffloaded, eventOffloaded, "offloaded, memory released")
+	fi.history.detach()
+	c.snapStats.offloaded()
 
 	c.setIdleInstance(fi)
 
 	return nil
 }
 
-func (c *coordinator) orchStopVM(ctx context.Context, fi *funcInstance) error {
-	if c.withoutOrchestrator {
-		return nil
+func (c *coordinator) orchStopVM(ctx context.Context, fi *funcInstance) (err error) {
+	defer func() {
+		c.auditInstance(ctx, auditVMStopped, fi, err)
+	}()
+
+	var errs []error
+
+	atomic.StoreInt32(&fi.exitExpected, 1)
+	// A VM that failed to restart in place was released already
+	if !c.withoutOrchestrator && atomic.LoadInt32(&fi.vmReleased) == 0 {
+		if err := c.orch.StopSingleVM(ctx, fi.vmID); err != nil {
+			fi.logger.WithError(err).Error("failed to stop VM for instance")
+			errs = append(errs, err)
+		}
+	}
+
+	// The reservation is released even if the stop failed, the instance
+	// being dropped by the callers either way
+	c.mem.release(fi.vmID)
+	if len(errs) == 0 {
+		fi.history.setState(vmStateStopped, eventStopped, "VM stopped")
+	}
+	fi.history.detach()
+	fi.history.release()
+
+	// Every release step runs, so that a failed one does not leak the next
+	if err := fi.projection.remove(); err != nil {
+		fi.logger.WithError(err).Error("failed to remove projection image")
+		errs = append(errs, err)
+	}
+
+	if err := c.disks.release(fi.extraDisk); err != nil {
+		fi.logger.WithError(err).Error("failed to release extra disk")
+		errs = append(errs, err)
+	}
+
+	return multierror.New(errs)
+}
+
+// endCPUBoost throttles down the VM of an instance that served its first
+// response, if it was booted with a CPU boost
+func (c *coordinator) endCPUBoost(fi *funcInstance) {
+	if c.withoutOrchestrator || c.orch == nil || fi.vmOpts.CPUBoostFactor <= 1 {
+		return
+	}
+
+	m, err := c.orch.EndCPUBoost(fi.vmID)
+	if err != nil {
+		fi.logger.WithError(err).Debug("failed to end CPU boost")
+		return
+	}
+
+	boosted := usToDuration(m.MetricMap[metrics.CPUBoost])
+	fi.logger.WithField("boosted", boosted).Debug("CPU boost ended on first response")
+	fi.history.record(eventCPUBoostEnded, "CPU boost ended after %s", boosted)
+}
+
+// connectAgent opens the control channel to the guest agent of the instance.
+// Failures are not fatal since the function may be served without the agent.
+func (c *coordinator) connectAgent(fi *funcInstance) {
+	if c.guestAgentPort == 0 || fi.startVMResponse == nil || fi.startVMResponse.VsockPath == "" {
+		return
+	}
+
+	agent, err := guestagent.NewChannel(c.agentDialer(fi.startVMResponse.VsockPath, c.guestAgentPort))
+	if err != nil {
+		fi.logger.WithError(err).Warn("failed to create guest agent channel")
+		return
 	}
 
-	if err := c.orch.StopSingleVM(ctx, fi.vmID); err != nil {
-		fi.logger.WithError(err).Error("failed to stop VM for instance")
+	fi.agent = agent
+}
+
+// waitAgentReady waits for the first successful health check of the guest
+// agent of a VM, which must be connected, returning the last failed check
+// if the agent is not ready in time
+func (c *coordinator) waitAgentReady(ctx context.Context, fi *funcInstance, timeout time.Duration) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.faults.fire(FaultGuestReady); err != nil {
+		<-ctxTimeout.Done()
 		return err
 	}
 
-	return nil
+	for {
+		err := fi.agent.Health(ctxTimeout)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctxTimeout.Done():
+			return err
+		case <-time.After(agentReadyPollInterval):
+		}
+	}
+}
+
+// syncClock sets the guest clock of a resumed or restored VM, which stood
+// still while the VM was paused, to the wall clock of the host. Failures are
+// not fatal since the guest may run without the agent.
+func (c *coordinator) syncClock(ctx context.Context, fi *funcInstance) *metrics.Metric {
+	m := metrics.NewMetric()
+	if !fi.clockSync || fi.agent == nil {
+		return m
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, c.config.get().ClockSyncTimeout)
+	defer cancel()
+
+	tStart := time.Now()
+	skew, err := fi.agent.SyncClock(ctxTimeout, time.Now())
+	if err != nil {
+		fi.logger.WithError(err).Warn("failed to sync the guest clock")
+		fi.history.warn(eventClockSyncFailed, "failed to sync the guest clock: %v", err)
+		return m
+	}
+	m.MetricMap[metrics.SyncClock] = metrics.ToUS(time.Since(tStart))
+
+	fi.logger.WithField("skew", skew).Debug("synced the guest clock")
+
+	return m
+}
+
+// disconnectAgent closes the control channel, first asking the guest agent to
+// shut down the function gracefully if the VM is stopped. The guest of a VM
+// being offloaded is not shut down, it would be snapshotted shutting down.
+func (c *coordinator) disconnectAgent(ctx context.Context, fi *funcInstance, shutdown bool) {
+	if fi.agent == nil {
+		return
+	}
+
+	if shutdown {
+		timeout := c.config.get().AgentShutdownTimeout
+
+		ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		if err := fi.agent.Shutdown(ctxTimeout, timeout); err != nil {
+			fi.logger.WithError(err).Debug("guest agent did not acknowledge shutdown")
+		}
+	}
+
+	if err := fi.agent.Close(); err != nil {
+		fi.logger.WithError(err).Warn("failed to close guest agent channel")
+	}
 }
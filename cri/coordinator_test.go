@@ -24,11 +24,19 @@ package cri
 
 import (
 	"context"
+	"net"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/ease-lab/vhive/metrics"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 )
 
 func TestStartStop(t *testing.T) {
@@ -36,7 +44,7 @@ func TestStartStop(t *testing.T) {
 	fi, err := coord.startVM(context.Background(), containerID)
 	require.NoError(t, err, "could not start VM")
 
-	err = coord.insertActive(containerID, fi)
+	err = coord.insertActive("pod", containerID, fi)
 	require.NoError(t, err, "could not insert mapping")
 
 	present := coord.isActive(containerID)
@@ -63,7 +71,7 @@ func TestParallelStartStop(t *testing.T) {
 			fi, err := coord.startVM(context.Background(), containerID)
 			require.NoError(t, err, "could not start VM")
 
-			err = coord.insertActive(containerID, fi)
+			err = coord.insertActive("pod", containerID, fi)
 			require.NoError(t, err, "could not insert mapping")
 
 			present := coord.isActive(containerID)
@@ -79,3 +87,188 @@ func TestParallelStartStop(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestListActive(t *testing.T) {
+	c := newCoordinator(fakes.NewOrchestrator())
+
+	for _, containerID := range []string{"ctr2", "ctr1"} {
+		fi, err := c.startVM(context.Background(), "img", ctriface.WithPrefault(true))
+		require.NoError(t, err, "could not start VM")
+
+		fi.revisionID = "img-00001"
+		require.NoError(t, c.insertActive("pod", containerID, fi), "could not insert mapping")
+	}
+
+	vms := c.ListActive()
+	require.Len(t, vms, 2, "wrong number of active VMs")
+
+	for i, vm := range vms {
+		require.Equal(t, "ctr"+strconv.Itoa(i+1), vm.ContainerID, "VMs are not sorted")
+		require.Equal(t, "img", vm.Image)
+		require.Equal(t, "img-00001", vm.Revision)
+		require.Equal(t, "190.128.0."+vm.VMID, vm.GuestIP)
+		require.EqualValues(t, 256, vm.MemSizeMib)
+		require.EqualValues(t, 1, vm.VcpuCount)
+		require.Equal(t, vmStateRunning, vm.State)
+		require.True(t, vm.Uptime >= 0, "negative uptime")
+	}
+
+	// The listing is a copy of the active instances
+	require.NoError(t, c.stopVM(context.Background(), "ctr1"))
+	require.Len(t, vms, 2, "listing changed after a VM was stopped")
+	require.Len(t, c.ListActive(), 1, "stopped VM is listed")
+}
+
+// startClockAgent serves a stub guest agent recording the clock syncs
+func startClockAgent(t *testing.T) (string, chan time.Time) {
+	agentPath := filepath.Join(t.TempDir(), "agent.sock")
+
+	lis, err := net.Listen("unix", agentPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	synced := make(chan time.Time, 10)
+	server := grpc.NewServer()
+	guestagent.NewServer(nil, guestagent.WithClockSetter(func(now time.Time) error {
+		synced <- now
+		return nil
+	})).Register(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	return agentPath, synced
+}
+
+func TestSyncClockOnResume(t *testing.T) {
+	for _, clockSync := range []bool{true, false} {
+		t.Run("ClockSync="+strconv.FormatBool(clockSync), func(t *testing.T) {
+			agentPath, synced := startClockAgent(t)
+
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = true
+			orch.VsockPath = agentPath
+			c := newCoordinator(orch)
+			c.guestAgentPort = 52
+			c.agentDialer = func(vsockPath string, port uint32) guestagent.Dialer {
+				return guestagent.UnixDialer(vsockPath)
+			}
+			ctx := context.Background()
+
+			fi, err := c.startVM(ctx, "img")
+			require.NoError(t, err, "failed to start VM")
+			fi.clockSync = clockSync
+			require.NoError(t, c.insertActive("pod", "ctr", fi))
+			require.Empty(t, synced, "clock was synced on a cold start")
+
+			requireSynced := func(m *metrics.Metric, op string) {
+				if !clockSync {
+					require.Empty(t, synced, "clock was synced after %s while disabled", op)
+					if m != nil {
+						require.NotContains(t, m.MetricMap, metrics.SyncClock, "clock sync was measured while disabled")
+					}
+					return
+				}
+
+				select {
+				case now := <-synced:
+					require.WithinDuration(t, time.Now(), now, time.Minute, "clock was set to a stale time")
+				default:
+					t.Fatalf("clock was not synced after %s", op)
+				}
+				if m != nil {
+					require.Contains(t, m.MetricMap, metrics.SyncClock, "clock sync was not measured")
+				}
+			}
+
+			_, err = c.PauseInstance(ctx, "ctr")
+			require.NoError(t, err, "failed to pause VM")
+			m, err := c.ResumeInstance(ctx, "ctr")
+			require.NoError(t, err, "failed to resume VM")
+			requireSynced(m, "resume")
+
+			// Restore for the next container
+			require.NoError(t, c.stopVM(ctx, "ctr"), "failed to offload VM")
+			restored, err := c.startVM(ctx, "img")
+			require.NoError(t, err, "failed to restore VM")
+			require.Equal(t, fi, restored, "VM was not restored")
+			requireSynced(nil, "restore")
+		})
+	}
+}
+
+func TestShutdownGuestOnStopOnly(t *testing.T) {
+	for _, snapshots := range []bool{true, false} {
+		t.Run("Snapshots="+strconv.FormatBool(snapshots), func(t *testing.T) {
+			agentPath := filepath.Join(t.TempDir(), "agent.sock")
+			lis, err := net.Listen("unix", agentPath)
+			require.NoError(t, err, "failed to listen on agent socket")
+
+			shutdowns := make(chan time.Duration, 1)
+			server := grpc.NewServer()
+			guestagent.NewServer(func(timeout time.Duration) { shutdowns <- timeout }).Register(server)
+			go func() {
+				_ = server.Serve(lis)
+			}()
+			defer server.Stop()
+
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = snapshots
+			orch.VsockPath = agentPath
+			c := newCoordinator(orch)
+			c.guestAgentPort = 52
+			c.agentDialer = func(vsockPath string, port uint32) guestagent.Dialer {
+				return guestagent.UnixDialer(vsockPath)
+			}
+			ctx := context.Background()
+
+			fi, err := c.startVM(ctx, "img")
+			require.NoError(t, err, "failed to start VM")
+			require.NoError(t, c.insertActive("pod", "ctr", fi))
+			require.NoError(t, c.stopVM(ctx, "ctr"), "failed to release VM")
+
+			if snapshots {
+				require.Never(t, func() bool { return len(shutdowns) > 0 }, 200*time.Millisecond, 20*time.Millisecond,
+					"guest of an offloaded VM was shut down")
+				return
+			}
+			require.Eventually(t, func() bool { return len(shutdowns) > 0 }, 5*time.Second, 20*time.Millisecond,
+				"guest of a stopped VM was not shut down")
+		})
+	}
+}
+
+func TestRestoreMatchesVMShape(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opt  ctriface.StartVMOption
+	}{
+		{"Kernel", ctriface.WithKernelImage("/var/lib/vhive/kernels/vmlinux-5.10")},
+		{"MachineConfig", ctriface.WithMachineConfig(2, 512)},
+		{"Hugepages", ctriface.WithHugepages(true)},
+		{"GuestSwap", ctriface.WithGuestSwap(128)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = true
+			c := newCoordinator(orch)
+
+			fi, err := c.startVM(ctx, "img")
+			require.NoError(t, err, "failed to start VM")
+			require.NoError(t, c.insertActive("pod", "ctr1", fi))
+			require.NoError(t, c.stopVM(ctx, "ctr1"), "failed to offload VM")
+
+			booted, err := c.startVM(ctx, "img", tt.opt)
+			require.NoError(t, err, "failed to boot VM")
+			require.NotEqual(t, fi.vmID, booted.vmID, "VM was restored from the snapshot of another VM shape")
+
+			restored, err := c.startVM(ctx, "img")
+			require.NoError(t, err, "failed to restore VM")
+			require.Equal(t, fi, restored, "VM of the same shape was not restored")
+		})
+	}
+}
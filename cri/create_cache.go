@@ -0,0 +1,231 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// createCacheTTL is how long the response to the creation of a user
+// container is returned to the retries of the request, once it completes
+const createCacheTTL = 2 * time.Minute
+
+// createTimeout bounds the creation of a user container, which outlives the
+// request that started it, matching the default runtime request timeout of kubelet
+const createTimeout = 2 * time.Minute
+
+// createKey identifies a container of a pod across the retries of its creation
+type createKey struct {
+	sandboxID string
+	name      string
+	attempt   uint32
+}
+
+func getCreateKey(r *criapi.CreateContainerRequest) createKey {
+	metadata := r.GetConfig().GetMetadata()
+
+	return createKey{sandboxID: r.GetPodSandboxId(), name: metadata.GetName(), attempt: metadata.GetAttempt()}
+}
+
+// createCall is the creation of a container, shared with the retries of its request
+type createCall struct {
+	done chan struct{}
+	resp *criapi.CreateContainerResponse
+	err  error
+	// expires is zero until the call succeeds
+	expires time.Time
+
+	// cancel aborts the creation while it is in flight
+	cancel context.CancelFunc
+	// placeholderID is the stock container created for the call, once
+	// it is created, which kubelet may remove before the call completes
+	placeholderID string
+}
+
+// createCache deduplicates the retries of the creation of user containers,
+// so that a retried request does not boot a second VM for the same container
+type createCache struct {
+	sync.Mutex
+	calls map[createKey]*createCall
+	ttl   time.Duration
+	// timeout bounds each creation, independently of the requests waiting for it
+	timeout time.Duration
+}
+
+func newCreateCache(ttl time.Duration) *createCache {
+	return &createCache{calls: make(map[createKey]*createCall), ttl: ttl, timeout: createTimeout}
+}
+
+// do calls create for the request unless an identical one is in flight or
+// succeeded within the TTL, in which case it returns the same response.
+// Failures are not cached, so that the request is retried.
+//
+// The creation runs detached from the cancellation of the request that started it:
+// kubelet retries a request that timed out, and the retry joins the creation
+// instead of failing with it and booting a second VM.
+func (c *createCache) do(ctx context.Context, r *criapi.CreateContainerRequest, now time.Time,
+	create func(ctx context.Context) (*criapi.CreateContainerResponse, error)) (_ *criapi.CreateContainerResponse, shared bool, _ error) {
+	key := getCreateKey(r)
+
+	c.Lock()
+	c.expireLocked(now)
+
+	call, shared := c.calls[key]
+	if !shared {
+		runCtx, cancel := context.WithTimeout(detachedContext{ctx}, c.timeout)
+		call = &createCall{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = call
+		go c.run(withCreateKey(runCtx, key), key, call, now, create)
+	}
+	c.Unlock()
+
+	select {
+	case <-call.done:
+		return call.resp, shared, call.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+func (c *createCache) run(ctx context.Context, key createKey, call *createCall, now time.Time,
+	create func(ctx context.Context) (*criapi.CreateContainerResponse, error)) {
+	defer call.cancel()
+
+	tStart := time.Now()
+	call.resp, call.err = create(ctx)
+
+	c.Lock()
+	if call.err != nil {
+		delete(c.calls, key)
+	} else {
+		// The TTL runs from the completion, a creation may take up to the
+		// TTL and its retries come after
+		call.expires = now.Add(time.Since(tStart) + c.ttl)
+	}
+	c.Unlock()
+
+	close(call.done)
+}
+
+// detachedContext carries the values of a request, such as its audit
+// fields, without its deadline and cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+type createKeyCtxKey struct{}
+
+func withCreateKey(ctx context.Context, key createKey) context.Context {
+	return context.WithValue(ctx, createKeyCtxKey{}, key)
+}
+
+// setPlaceholder records the stock container created for the creation running
+// with ctx, so that its removal cancels the creation
+func (c *createCache) setPlaceholder(ctx context.Context, containerID string) {
+	key, ok := ctx.Value(createKeyCtxKey{}).(createKey)
+	if !ok {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if call, ok := c.calls[key]; ok {
+		call.placeholderID = containerID
+	}
+}
+
+// cancelPod cancels the creations of the containers of the pod in flight,
+// returning how many were cancelled
+func (c *createCache) cancelPod(sandboxID string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	var n int
+	for key, call := range c.calls {
+		if key.sandboxID == sandboxID && call.expires.IsZero() {
+			call.cancel()
+			n++
+		}
+	}
+
+	return n
+}
+
+// cancelContainer cancels the creation in flight of the container whose
+// placeholder is the given stock container, returning whether there was one
+func (c *createCache) cancelContainer(containerID string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, call := range c.calls {
+		if call.placeholderID == containerID && call.expires.IsZero() {
+			call.cancel()
+			return true
+		}
+	}
+
+	return false
+}
+
+// contextStatus returns the status of a creation ended by its context
+func contextStatus(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	return status.Error(codes.Canceled, err.Error())
+}
+
+// forget drops the response of the creation of a removed container
+func (c *createCache) forget(containerID string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for key, call := range c.calls {
+		if !call.expires.IsZero() && call.resp.GetContainerId() == containerID {
+			delete(c.calls, key)
+		}
+	}
+}
+
+func (c *createCache) expireLocked(now time.Time) {
+	for key, call := range c.calls {
+		if !call.expires.IsZero() && now.After(call.expires) {
+			delete(c.calls, key)
+		}
+	}
+}
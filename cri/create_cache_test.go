@@ -0,0 +1,365 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestCreateContainerDeduplicatesRetries(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 50 * time.Millisecond
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	var (
+		wg    sync.WaitGroup
+		ids   [2]string
+		errs  [2]error
+		start = make(chan struct{})
+	)
+
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+			ids[i], errs[i] = resp.GetContainerId(), err
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	require.NoError(t, errs[0], "container creation failed")
+	require.NoError(t, errs[1], "retried container creation failed")
+	require.Equal(t, 1, orch.NumStarted(), "a second VM was started for the retry")
+	require.Equal(t, ids[0], ids[1], "retry returned another container")
+
+	// A later retry also gets the same container
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "retried container creation failed")
+	require.Equal(t, ids[0], resp.GetContainerId(), "retry returned another container")
+	require.Equal(t, 1, orch.NumStarted(), "a second VM was started for the retry")
+}
+
+func TestCreateContainerOverlappingRetries(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 50 * time.Millisecond
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	const retries = 8
+
+	var (
+		wg   sync.WaitGroup
+		ids  [retries]string
+		errs [retries]error
+	)
+
+	// The retries arrive while the first creation is in flight
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+
+			resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+			ids[i], errs[i] = resp.GetContainerId(), err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range ids {
+		require.NoError(t, errs[i], "container creation failed")
+		require.Equal(t, ids[0], ids[i], "retry returned another container")
+	}
+	require.Equal(t, 1, orch.NumStarted(), "a second VM was started for the retries")
+
+	require.Equal(t, 1, orch.Running(), "unexpected number of VMs")
+}
+
+func TestCreateContainerOutlivesTimedOutRequest(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 100 * time.Millisecond
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.Equal(t, context.DeadlineExceeded, err, "request did not give up with its context")
+
+	// The retry of kubelet joins the creation started by the timed out request
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "retried container creation failed")
+	require.Equal(t, 1, orch.NumStarted(), "a second VM was started for the retry")
+}
+
+func TestCreateContainerRetriesStockFailure(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{CreateErr: errInjected}
+	s := newTestService(stock, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Error(t, err, "container creation did not fail")
+
+	// The VM of the failed attempt is never registered, so it is stopped
+	requireNoLeaks(t, s, orch, stock)
+
+	stock.CreateErr = nil
+
+	_, err = s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "retried container creation failed")
+	require.Equal(t, 2, orch.NumStarted(), "VM was not started for the retry")
+
+	require.Equal(t, 1, orch.Running(), "unexpected number of VMs")
+}
+
+func TestCreateContainerRetryKeys(t *testing.T) {
+	cases := []struct {
+		name          string
+		retry         func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest
+		expectStarted int
+	}{
+		{
+			name: "Identical",
+			retry: func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest {
+				return r
+			},
+			expectStarted: 1,
+		},
+		{
+			name: "Next attempt",
+			retry: func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest {
+				r = newUserContainerRequest("pod", "img")
+				r.Config.Metadata.Attempt = 1
+				return r
+			},
+			expectStarted: 2,
+		},
+		{
+			name: "Other pod",
+			retry: func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest {
+				return newUserContainerRequest("other", "img")
+			},
+			expectStarted: 2,
+		},
+		{
+			name: "Expired",
+			retry: func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest {
+				s.now = func() time.Time { return time.Now().Add(2 * createCacheTTL) }
+				return r
+			},
+			expectStarted: 2,
+		},
+		{
+			name: "Removed",
+			retry: func(s *Service, r *criapi.CreateContainerRequest) *criapi.CreateContainerRequest {
+				_, err := s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: "ctr1"})
+				require.NoError(t, err, "failed to remove container")
+				return r
+			},
+			expectStarted: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			_, err := s.CreateContainer(context.Background(), r)
+			require.NoError(t, err, "container creation failed")
+
+			_, err = s.CreateContainer(context.Background(), c.retry(s, r))
+			require.NoError(t, err, "retried container creation failed")
+			require.Equal(t, c.expectStarted, orch.NumStarted(), "unexpected number of started VMs")
+		})
+	}
+}
+
+func TestCreateContainerRetriesFailures(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.StartErr = errInjected
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Error(t, err, "container creation did not fail")
+
+	orch.Lock()
+	orch.StartErr = nil
+	orch.Unlock()
+
+	_, err = s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "failure was returned to the retry")
+	require.Equal(t, 1, orch.NumStarted(), "VM was not started for the retry")
+}
+
+func TestCreateCacheSlowCreation(t *testing.T) {
+	c := newCreateCache(50 * time.Millisecond)
+	r := newUserContainerRequest("pod", "img")
+
+	resp, shared, err := c.do(context.Background(), r, time.Now(), func(context.Context) (*criapi.CreateContainerResponse, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &criapi.CreateContainerResponse{ContainerId: "ctr1"}, nil
+	})
+	require.NoError(t, err)
+	require.False(t, shared)
+
+	// The creation took longer than the TTL, whose retry still gets its response
+	retried, shared, err := c.do(context.Background(), r, time.Now(), func(context.Context) (*criapi.CreateContainerResponse, error) {
+		return &criapi.CreateContainerResponse{ContainerId: "ctr2"}, nil
+	})
+	require.NoError(t, err)
+	require.True(t, shared, "retry of a slow creation created the container again")
+	require.Equal(t, resp, retried)
+}
+
+func TestCreateCacheWaiterCancelled(t *testing.T) {
+	c := newCreateCache(createCacheTTL)
+	r := newUserContainerRequest("pod", "img")
+
+	release := make(chan struct{})
+	go func() {
+		_, _, _ = c.do(context.Background(), r, time.Now(), func(context.Context) (*criapi.CreateContainerResponse, error) {
+			<-release
+			return &criapi.CreateContainerResponse{ContainerId: "ctr1"}, nil
+		})
+	}()
+	defer close(release)
+
+	require.Eventually(t, func() bool {
+		c.Lock()
+		defer c.Unlock()
+		return len(c.calls) == 1
+	}, time.Second, time.Millisecond, "creation did not start")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, shared, err := c.do(ctx, r, time.Now(), func(context.Context) (*criapi.CreateContainerResponse, error) {
+		t.Fatal("retry created the container again")
+		return nil, nil
+	})
+	require.True(t, shared, "retry was not deduplicated")
+	require.Equal(t, context.DeadlineExceeded, err, "retry did not give up with its context")
+}
+
+func TestStopPodSandboxCancelsBoot(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 10 * time.Second
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		errs <- err
+	}()
+
+	// The memory of the VM is committed right before it boots
+	require.Eventually(t, func() bool {
+		return s.MemoryStats().CommittedMib > 0
+	}, time.Second, time.Millisecond, "VM did not start booting")
+
+	// Another pod is not affected
+	require.Zero(t, s.creates.cancelPod("other-pod"), "creation of another pod was cancelled")
+
+	tStop := time.Now()
+	_, err := s.StopPodSandbox(context.Background(), &criapi.StopPodSandboxRequest{PodSandboxId: "pod"})
+	require.NoError(t, err, "pod stop failed")
+
+	select {
+	case err := <-errs:
+		require.Equal(t, codes.Canceled, status.Code(err), "unexpected error %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("creation was not cancelled")
+	}
+	require.Less(t, int64(time.Since(tStop)), int64(time.Second), "the boot was not cut short")
+
+	orch.Lock()
+	require.Equal(t, 1, orch.Cancelled, "boot was not cancelled")
+	orch.Unlock()
+	require.Zero(t, orch.NumStarted(), "VM was started")
+	require.Zero(t, s.coordinator.startFailures.get().Total, "cancellation was counted as a start failure")
+	requireNoLeaks(t, s, orch, stock)
+
+	// The pod can be recreated once its creation is unwound
+	orch.BootDelay = 0
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed after cancellation")
+}
+
+func TestRemovePlaceholderCancelsBoot(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.BootDelay = 10 * time.Second
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		errs <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		stock.Lock()
+		defer stock.Unlock()
+		return len(stock.Created) == 1 && s.MemoryStats().CommittedMib > 0
+	}, time.Second, time.Millisecond, "VM did not start booting")
+
+	stock.Lock()
+	placeholderID := stock.Created[0]
+	stock.Unlock()
+
+	require.False(t, s.creates.cancelContainer("unknown"), "creation of another container was cancelled")
+
+	_, err := s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: placeholderID})
+	require.NoError(t, err, "container removal failed")
+
+	select {
+	case err := <-errs:
+		require.Equal(t, codes.Canceled, status.Code(err), "unexpected error %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("creation was not cancelled")
+	}
+
+	require.Zero(t, orch.NumStarted(), "VM was started")
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of the VM was leaked")
+	require.Empty(t, s.coordinator.ListInstances(), "instance was leaked")
+}
@@ -0,0 +1,173 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// revisionBucket is the token bucket of the creations of the user
+// containers of a revision
+type revisionBucket struct {
+	tokens float64
+	last   time.Time
+	// queued is the number of creations waiting for a token
+	queued int
+}
+
+// createLimiter paces the creations of the user containers of each revision
+// with a token bucket, so that a burst of pods of the same revision does not
+// boot all their VMs at once. The creations in excess of the burst wait for
+// a token, up to a cap, and the others are rejected.
+type createLimiter struct {
+	sync.Mutex
+
+	rate     float64
+	burst    int
+	maxQueue int
+
+	buckets map[string]*revisionBucket
+	stats   map[string]*RevisionThrottleStats
+	now     func() time.Time
+}
+
+// RevisionThrottleStats counts the creations of user containers of a revision
+// that were delayed or rejected by the rate limit
+type RevisionThrottleStats struct {
+	Delayed  uint64 `json:"delayed"`
+	Rejected uint64 `json:"rejected"`
+}
+
+func newCreateLimiter(rate float64, burst, maxQueue int) *createLimiter {
+	return &createLimiter{
+		rate:     rate,
+		burst:    burst,
+		maxQueue: maxQueue,
+		buckets:  make(map[string]*revisionBucket),
+		stats:    make(map[string]*RevisionThrottleStats),
+		now:      time.Now,
+	}
+}
+
+// wait takes a token of the revision, waiting for one if the creation can be
+// queued. It fails with ResourceExhausted if the queue of the revision is full
+// or the token would only be available after the deadline of the request.
+func (l *createLimiter) wait(ctx context.Context, revision string) error {
+	l.Lock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	b, ok := l.buckets[revision]
+	if !ok {
+		b = &revisionBucket{tokens: float64(l.burst), last: now}
+		l.buckets[revision] = b
+	}
+
+	b.tokens = l.refilled(b, now)
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		l.Unlock()
+		return nil
+	}
+
+	delay := time.Duration(-b.tokens / l.rate * float64(time.Second))
+	deadline, hasDeadline := ctx.Deadline()
+	if b.queued >= l.maxQueue || (hasDeadline && now.Add(delay).After(deadline)) {
+		b.tokens++
+		l.statsLocked(revision).Rejected++
+		queued := b.queued
+		l.Unlock()
+
+		return status.Errorf(codes.ResourceExhausted,
+			"creation of the containers of revision %s is rate-limited to %g/s, %d are already queued", revision, l.rate, queued)
+	}
+
+	b.queued++
+	l.statsLocked(revision).Delayed++
+	l.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.Lock()
+	b.queued--
+	if err != nil {
+		// The token is given back to the creations queued behind
+		b.tokens++
+	}
+	l.Unlock()
+
+	return err
+}
+
+// refilled returns the tokens of the bucket at now
+func (l *createLimiter) refilled(b *revisionBucket, now time.Time) float64 {
+	return math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// pruneLocked forgets the buckets that are full again
+func (l *createLimiter) pruneLocked(now time.Time) {
+	for revision, b := range l.buckets {
+		if b.queued == 0 && l.refilled(b, now) >= float64(l.burst) {
+			delete(l.buckets, revision)
+		}
+	}
+}
+
+func (l *createLimiter) statsLocked(revision string) *RevisionThrottleStats {
+	stats, ok := l.stats[revision]
+	if !ok {
+		stats = &RevisionThrottleStats{}
+		l.stats[revision] = stats
+	}
+
+	return stats
+}
+
+func (l *createLimiter) getStats() map[string]RevisionThrottleStats {
+	l.Lock()
+	defer l.Unlock()
+
+	stats := make(map[string]RevisionThrottleStats, len(l.stats))
+	for revision, s := range l.stats {
+		stats[revision] = *s
+	}
+
+	return stats
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateLimiterBurst(t *testing.T) {
+	const (
+		rate     = 20
+		interval = time.Second / rate
+	)
+
+	l := newCreateLimiter(rate, 2, 3)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		passed   []time.Duration
+		rejected []codes.Code
+	)
+
+	tStart := time.Now()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := l.wait(context.Background(), "rev")
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				rejected = append(rejected, status.Code(err))
+				return
+			}
+			passed = append(passed, time.Since(tStart))
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, passed, 5, "the burst and the queue were not let through")
+	require.Equal(t, []codes.Code{codes.ResourceExhausted, codes.ResourceExhausted, codes.ResourceExhausted,
+		codes.ResourceExhausted, codes.ResourceExhausted}, rejected, "the requests beyond the queue were not rejected")
+
+	// The burst passes at once and the queued requests are paced by the rate
+	sort.Slice(passed, func(i, j int) bool { return passed[i] < passed[j] })
+	for i, d := range passed[2:] {
+		require.GreaterOrEqual(t, int64(d), int64(time.Duration(i+1)*interval-interval/5),
+			"queued request %d was not paced", i)
+	}
+
+	require.Equal(t, map[string]RevisionThrottleStats{"rev": {Delayed: 3, Rejected: 5}}, l.getStats())
+
+	// Other revisions have their own bucket
+	require.NoError(t, l.wait(context.Background(), "other"), "other revision was throttled")
+}
+
+func TestCreateLimiterDeadline(t *testing.T) {
+	l := newCreateLimiter(1, 1, 10)
+	require.NoError(t, l.wait(context.Background(), "rev"))
+
+	// The next token is a second away, after the deadline of the request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	tStart := time.Now()
+	err := l.wait(ctx, "rev")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "request that would miss its deadline was queued")
+	require.Less(t, int64(time.Since(tStart)), int64(50*time.Millisecond), "request was not rejected at once")
+}
+
+func TestCreateLimiterCancel(t *testing.T) {
+	l := newCreateLimiter(10, 1, 10)
+	require.NoError(t, l.wait(context.Background(), "rev"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	require.Equal(t, context.Canceled, l.wait(ctx, "rev"), "cancelled request was not interrupted")
+
+	// The token of the cancelled request goes to the next one
+	tStart := time.Now()
+	require.NoError(t, l.wait(context.Background(), "rev"))
+	require.Less(t, int64(time.Since(tStart)), int64(150*time.Millisecond), "token of the cancelled request was lost")
+}
+
+func TestCreateUserContainerRateLimit(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	WithCreateRateLimit(0.1, 1, 0)(s)
+	ctx := context.Background()
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "first container was throttled")
+
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+	require.Error(t, err, "burst of containers was not throttled")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error code")
+
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod3", "other"))
+	require.NoError(t, err, "container of another revision was throttled")
+
+	require.Equal(t, 2, orch.NumStarted(), "VM was started for a throttled container")
+	require.Equal(t, map[string]RevisionThrottleStats{"img-00001": {Rejected: 1}}, s.CreateThrottleStats())
+}
@@ -0,0 +1,206 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+//go:generate go run cri_v1_conversion_gen.go
+
+const (
+	// criV1Version is the CRI version of the kubelets of Kubernetes 1.26 and later
+	criV1Version = "v1"
+)
+
+// The v1 CRI API is a copy of v1alpha2 with the same messages, extended with
+// new fields and methods since. The v1 services are served by the v1alpha2
+// implementation of the service, converting the v1 requests into v1alpha2 and
+// the v1alpha2 responses back into v1 field by field with the generated
+// converters of cri_v1_conversion.go. The fields and the methods added in v1
+// after the vendored k8s.io/cri-api are unknown to the v1 services, i.e., the
+// fields are dropped and the methods are answered with Unimplemented. Both
+// versions share all the interception logic and are forwarded to the stock
+// containerd in v1alpha2.
+
+// v1RuntimeService serves the v1 runtime service with the v1alpha2 one
+type v1RuntimeService struct {
+	*Service
+}
+
+// v1ImageService serves the v1 image service with the v1alpha2 one
+type v1ImageService struct {
+	*Service
+}
+
+// registerV1 registers the v1 runtime and image services on the server
+func (s *Service) registerV1(server *grpc.Server) {
+	v1.RegisterRuntimeServiceServer(server, v1RuntimeService{s})
+	v1.RegisterImageServiceServer(server, v1ImageService{s})
+}
+
+// Version returns the version of the runtime and v1 as its API version
+func (s v1RuntimeService) Version(ctx context.Context, r *v1.VersionRequest) (*v1.VersionResponse, error) {
+	resp, err := s.Service.Version(ctx, fromV1VersionRequest(r))
+	if err != nil {
+		return nil, err
+	}
+
+	v1Resp := toV1VersionResponse(resp)
+	v1Resp.RuntimeApiVersion = criV1Version
+
+	return v1Resp, nil
+}
+
+func (s v1RuntimeService) RunPodSandbox(ctx context.Context, r *v1.RunPodSandboxRequest) (*v1.RunPodSandboxResponse, error) {
+	resp, err := s.Service.RunPodSandbox(ctx, fromV1RunPodSandboxRequest(r))
+	return toV1RunPodSandboxResponse(resp), err
+}
+
+func (s v1RuntimeService) StopPodSandbox(ctx context.Context, r *v1.StopPodSandboxRequest) (*v1.StopPodSandboxResponse, error) {
+	resp, err := s.Service.StopPodSandbox(ctx, fromV1StopPodSandboxRequest(r))
+	return toV1StopPodSandboxResponse(resp), err
+}
+
+func (s v1RuntimeService) RemovePodSandbox(ctx context.Context, r *v1.RemovePodSandboxRequest) (*v1.RemovePodSandboxResponse, error) {
+	resp, err := s.Service.RemovePodSandbox(ctx, fromV1RemovePodSandboxRequest(r))
+	return toV1RemovePodSandboxResponse(resp), err
+}
+
+func (s v1RuntimeService) PodSandboxStatus(ctx context.Context, r *v1.PodSandboxStatusRequest) (*v1.PodSandboxStatusResponse, error) {
+	resp, err := s.Service.PodSandboxStatus(ctx, fromV1PodSandboxStatusRequest(r))
+	return toV1PodSandboxStatusResponse(resp), err
+}
+
+func (s v1RuntimeService) ListPodSandbox(ctx context.Context, r *v1.ListPodSandboxRequest) (*v1.ListPodSandboxResponse, error) {
+	resp, err := s.Service.ListPodSandbox(ctx, fromV1ListPodSandboxRequest(r))
+	return toV1ListPodSandboxResponse(resp), err
+}
+
+func (s v1RuntimeService) CreateContainer(ctx context.Context, r *v1.CreateContainerRequest) (*v1.CreateContainerResponse, error) {
+	resp, err := s.Service.CreateContainer(ctx, fromV1CreateContainerRequest(r))
+	return toV1CreateContainerResponse(resp), err
+}
+
+func (s v1RuntimeService) StartContainer(ctx context.Context, r *v1.StartContainerRequest) (*v1.StartContainerResponse, error) {
+	resp, err := s.Service.StartContainer(ctx, fromV1StartContainerRequest(r))
+	return toV1StartContainerResponse(resp), err
+}
+
+func (s v1RuntimeService) StopContainer(ctx context.Context, r *v1.StopContainerRequest) (*v1.StopContainerResponse, error) {
+	resp, err := s.Service.StopContainer(ctx, fromV1StopContainerRequest(r))
+	return toV1StopContainerResponse(resp), err
+}
+
+func (s v1RuntimeService) RemoveContainer(ctx context.Context, r *v1.RemoveContainerRequest) (*v1.RemoveContainerResponse, error) {
+	resp, err := s.Service.RemoveContainer(ctx, fromV1RemoveContainerRequest(r))
+	return toV1RemoveContainerResponse(resp), err
+}
+
+func (s v1RuntimeService) ListContainers(ctx context.Context, r *v1.ListContainersRequest) (*v1.ListContainersResponse, error) {
+	resp, err := s.Service.ListContainers(ctx, fromV1ListContainersRequest(r))
+	return toV1ListContainersResponse(resp), err
+}
+
+func (s v1RuntimeService) ContainerStatus(ctx context.Context, r *v1.ContainerStatusRequest) (*v1.ContainerStatusResponse, error) {
+	resp, err := s.Service.ContainerStatus(ctx, fromV1ContainerStatusRequest(r))
+	return toV1ContainerStatusResponse(resp), err
+}
+
+func (s v1RuntimeService) UpdateContainerResources(ctx context.Context, r *v1.UpdateContainerResourcesRequest) (*v1.UpdateContainerResourcesResponse, error) {
+	resp, err := s.Service.UpdateContainerResources(ctx, fromV1UpdateContainerResourcesRequest(r))
+	return toV1UpdateContainerResourcesResponse(resp), err
+}
+
+func (s v1RuntimeService) ReopenContainerLog(ctx context.Context, r *v1.ReopenContainerLogRequest) (*v1.ReopenContainerLogResponse, error) {
+	resp, err := s.Service.ReopenContainerLog(ctx, fromV1ReopenContainerLogRequest(r))
+	return toV1ReopenContainerLogResponse(resp), err
+}
+
+func (s v1RuntimeService) ExecSync(ctx context.Context, r *v1.ExecSyncRequest) (*v1.ExecSyncResponse, error) {
+	resp, err := s.Service.ExecSync(ctx, fromV1ExecSyncRequest(r))
+	return toV1ExecSyncResponse(resp), err
+}
+
+func (s v1RuntimeService) Exec(ctx context.Context, r *v1.ExecRequest) (*v1.ExecResponse, error) {
+	resp, err := s.Service.Exec(ctx, fromV1ExecRequest(r))
+	return toV1ExecResponse(resp), err
+}
+
+func (s v1RuntimeService) Attach(ctx context.Context, r *v1.AttachRequest) (*v1.AttachResponse, error) {
+	resp, err := s.Service.Attach(ctx, fromV1AttachRequest(r))
+	return toV1AttachResponse(resp), err
+}
+
+func (s v1RuntimeService) PortForward(ctx context.Context, r *v1.PortForwardRequest) (*v1.PortForwardResponse, error) {
+	resp, err := s.Service.PortForward(ctx, fromV1PortForwardRequest(r))
+	return toV1PortForwardResponse(resp), err
+}
+
+func (s v1RuntimeService) ContainerStats(ctx context.Context, r *v1.ContainerStatsRequest) (*v1.ContainerStatsResponse, error) {
+	resp, err := s.Service.ContainerStats(ctx, fromV1ContainerStatsRequest(r))
+	return toV1ContainerStatsResponse(resp), err
+}
+
+func (s v1RuntimeService) ListContainerStats(ctx context.Context, r *v1.ListContainerStatsRequest) (*v1.ListContainerStatsResponse, error) {
+	resp, err := s.Service.ListContainerStats(ctx, fromV1ListContainerStatsRequest(r))
+	return toV1ListContainerStatsResponse(resp), err
+}
+
+func (s v1RuntimeService) UpdateRuntimeConfig(ctx context.Context, r *v1.UpdateRuntimeConfigRequest) (*v1.UpdateRuntimeConfigResponse, error) {
+	resp, err := s.Service.UpdateRuntimeConfig(ctx, fromV1UpdateRuntimeConfigRequest(r))
+	return toV1UpdateRuntimeConfigResponse(resp), err
+}
+
+func (s v1RuntimeService) Status(ctx context.Context, r *v1.StatusRequest) (*v1.StatusResponse, error) {
+	resp, err := s.Service.Status(ctx, fromV1StatusRequest(r))
+	return toV1StatusResponse(resp), err
+}
+
+func (s v1ImageService) ListImages(ctx context.Context, r *v1.ListImagesRequest) (*v1.ListImagesResponse, error) {
+	resp, err := s.Service.ListImages(ctx, fromV1ListImagesRequest(r))
+	return toV1ListImagesResponse(resp), err
+}
+
+func (s v1ImageService) ImageStatus(ctx context.Context, r *v1.ImageStatusRequest) (*v1.ImageStatusResponse, error) {
+	resp, err := s.Service.ImageStatus(ctx, fromV1ImageStatusRequest(r))
+	return toV1ImageStatusResponse(resp), err
+}
+
+func (s v1ImageService) PullImage(ctx context.Context, r *v1.PullImageRequest) (*v1.PullImageResponse, error) {
+	resp, err := s.Service.PullImage(ctx, fromV1PullImageRequest(r))
+	return toV1PullImageResponse(resp), err
+}
+
+func (s v1ImageService) RemoveImage(ctx context.Context, r *v1.RemoveImageRequest) (*v1.RemoveImageResponse, error) {
+	resp, err := s.Service.RemoveImage(ctx, fromV1RemoveImageRequest(r))
+	return toV1RemoveImageResponse(resp), err
+}
+
+func (s v1ImageService) ImageFsInfo(ctx context.Context, r *v1.ImageFsInfoRequest) (*v1.ImageFsInfoResponse, error) {
+	resp, err := s.Service.ImageFsInfo(ctx, fromV1ImageFsInfoRequest(r))
+	return toV1ImageFsInfoResponse(resp), err
+}
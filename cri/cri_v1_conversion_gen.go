@@ -0,0 +1,214 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build ignore
+// +build ignore
+
+// This program generates cri_v1_conversion.go, the field-by-field converters
+// between the messages of the v1 and v1alpha2 CRI services. Run it with
+// go generate in the cri directory after updating k8s.io/cri-api.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	_ "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const output = "cri_v1_conversion.go"
+
+// generator writes the converters of the messages reachable from the
+// requests and responses of the services, in both directions
+type generator struct {
+	buf      bytes.Buffer
+	messages map[string]reflect.Type
+}
+
+func main() {
+	g := &generator{messages: make(map[string]reflect.Type)}
+	for _, service := range []interface{}{(*v1.RuntimeServiceServer)(nil), (*v1.ImageServiceServer)(nil)} {
+		iface := reflect.TypeOf(service).Elem()
+		for i := 0; i < iface.NumMethod(); i++ {
+			// The methods are func(context.Context, *Request) (*Response, error)
+			method := iface.Method(i).Type
+			g.collect(method.In(1).Elem())
+			g.collect(method.Out(0).Elem())
+		}
+	}
+
+	names := make([]string, 0, len(g.messages))
+	for name := range g.messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lic, err := ioutil.ReadFile("cri_v1.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.buf.WriteString(string(lic[:bytes.Index(lic, []byte("package cri"))]))
+	g.buf.WriteString("// Code generated by cri_v1_conversion_gen.go. DO NOT EDIT.\n\n")
+	g.buf.WriteString("package cri\n\nimport (\n")
+	g.buf.WriteString("\tv1 \"k8s.io/cri-api/pkg/apis/runtime/v1\"\n")
+	g.buf.WriteString("\tcriapi \"k8s.io/cri-api/pkg/apis/runtime/v1alpha2\"\n)\n")
+
+	for _, name := range names {
+		g.convert(g.messages[name], "fromV1", "v1", "criapi")
+		g.convert(g.messages[name], "toV1", "criapi", "v1")
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// collect adds the message t of v1 and the messages of its fields, checking
+// that v1alpha2 has the same message with the same fields
+func (g *generator) collect(t reflect.Type) {
+	if _, ok := g.messages[t.Name()]; ok {
+		return
+	}
+	g.messages[t.Name()] = t
+
+	alpha, ok := v1alpha2Type(t.Name())
+	if !ok {
+		log.Fatalf("message %s of v1 is not in v1alpha2", t.Name())
+	}
+
+	v1Fields, alphaFields := fields(t), fields(alpha)
+	if len(v1Fields) != len(alphaFields) {
+		log.Fatalf("message %s has %d fields in v1 and %d in v1alpha2", t.Name(), len(v1Fields), len(alphaFields))
+	}
+	for i, f := range v1Fields {
+		af := alphaFields[i]
+		if f.Name != af.Name || f.Type.Kind() != af.Type.Kind() {
+			log.Fatalf("field %s.%s of v1 does not match %s of v1alpha2", t.Name(), f.Name, af.Name)
+		}
+
+		if elem := messageElem(f.Type); elem != nil {
+			g.collect(elem)
+		}
+	}
+}
+
+// v1alpha2Type returns the message of v1alpha2 with the given name, looked
+// up in the protobuf types registered by the package
+func v1alpha2Type(name string) (reflect.Type, bool) {
+	t := proto.MessageType("runtime.v1alpha2." + name)
+	if t == nil {
+		return nil, false
+	}
+
+	return t.Elem(), true
+}
+
+// fields returns the fields of the message t, without the internal ones of protobuf
+func fields(t reflect.Type) []reflect.StructField {
+	var fs []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); !strings.HasPrefix(f.Name, "XXX_") {
+			fs = append(fs, f)
+		}
+	}
+
+	return fs
+}
+
+// messageElem returns the message of a field holding messages, nil otherwise
+func messageElem(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return t.Elem()
+	case reflect.Slice, reflect.Map:
+		if t.Elem().Kind() == reflect.Ptr {
+			return t.Elem().Elem()
+		}
+	}
+
+	return nil
+}
+
+// isEnum returns whether t is an enum of the CRI package
+func isEnum(t reflect.Type) bool {
+	return t.Kind() == reflect.Int32 && t.PkgPath() != ""
+}
+
+// convert writes the converter prefix<Message> of the message t from package
+// from to package to
+func (g *generator) convert(t reflect.Type, prefix, from, to string) {
+	name := t.Name()
+	fmt.Fprintf(&g.buf, "\nfunc %s%s(in *%s.%s) *%s.%s {\n", prefix, name, from, name, to, name)
+	fmt.Fprintf(&g.buf, "if in == nil {\nreturn nil\n}\n\nout := &%s.%s{}\n", to, name)
+
+	for _, f := range fields(t) {
+		ft := f.Type
+		switch {
+		case ft.Kind() == reflect.Ptr:
+			fmt.Fprintf(&g.buf, "out.%s = %s%s(in.%s)\n", f.Name, prefix, ft.Elem().Name(), f.Name)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr:
+			fmt.Fprintf(&g.buf, "if in.%s != nil {\nout.%s = make([]*%s.%s, 0, len(in.%s))\n", f.Name, f.Name, to, ft.Elem().Elem().Name(), f.Name)
+			fmt.Fprintf(&g.buf, "for _, v := range in.%s {\nout.%s = append(out.%s, %s%s(v))\n}\n}\n", f.Name, f.Name, f.Name, prefix, ft.Elem().Elem().Name())
+		case ft.Kind() == reflect.Map && ft.Elem().Kind() == reflect.Ptr:
+			fmt.Fprintf(&g.buf, "if in.%s != nil {\nout.%s = make(map[%s]*%s.%s, len(in.%s))\n", f.Name, f.Name, ft.Key(), to, ft.Elem().Elem().Name(), f.Name)
+			fmt.Fprintf(&g.buf, "for k, v := range in.%s {\nout.%s[k] = %s%s(v)\n}\n}\n", f.Name, f.Name, prefix, ft.Elem().Elem().Name())
+		case ft.Kind() == reflect.Slice && isEnum(ft.Elem()):
+			fmt.Fprintf(&g.buf, "if in.%s != nil {\nout.%s = make([]%s.%s, 0, len(in.%s))\n", f.Name, f.Name, to, ft.Elem().Name(), f.Name)
+			fmt.Fprintf(&g.buf, "for _, v := range in.%s {\nout.%s = append(out.%s, %s.%s(v))\n}\n}\n", f.Name, f.Name, f.Name, to, ft.Elem().Name())
+		case isEnum(ft):
+			fmt.Fprintf(&g.buf, "out.%s = %s.%s(in.%s)\n", f.Name, to, ft.Name(), f.Name)
+		case ft.PkgPath() == "" && isScalar(ft):
+			// Scalars, and the slices and maps of scalars, which are shared
+			fmt.Fprintf(&g.buf, "out.%s = in.%s\n", f.Name, f.Name)
+		default:
+			log.Fatalf("field %s.%s has the unsupported type %s", name, f.Name, ft)
+		}
+	}
+
+	g.buf.WriteString("\nreturn out\n}\n")
+}
+
+// isScalar returns whether t is a scalar or a slice or map of scalars
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String:
+		return t.PkgPath() == ""
+	case reflect.Slice:
+		return isScalar(t.Elem()) || t.Elem().Kind() == reflect.Uint8
+	case reflect.Map:
+		return isScalar(t.Key()) && isScalar(t.Elem())
+	}
+
+	return false
+}
@@ -0,0 +1,790 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// v1Conversion converts the messages of a method between v1 and v1alpha2
+type v1Conversion struct {
+	v1, v1alpha2 interface{}
+	fromV1, toV1 func(interface{}) interface{}
+}
+
+// v1Conversions are the conversions of the requests and responses of all
+// the methods of the v1 services
+func v1Conversions() []v1Conversion {
+	return []v1Conversion{
+		{
+			v1:       &v1.VersionRequest{},
+			v1alpha2: &criapi.VersionRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1VersionRequest(m.(*v1.VersionRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1VersionRequest(m.(*criapi.VersionRequest))
+			},
+		},
+		{
+			v1:       &v1.VersionResponse{},
+			v1alpha2: &criapi.VersionResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1VersionResponse(m.(*v1.VersionResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1VersionResponse(m.(*criapi.VersionResponse))
+			},
+		},
+		{
+			v1:       &v1.RunPodSandboxRequest{},
+			v1alpha2: &criapi.RunPodSandboxRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RunPodSandboxRequest(m.(*v1.RunPodSandboxRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RunPodSandboxRequest(m.(*criapi.RunPodSandboxRequest))
+			},
+		},
+		{
+			v1:       &v1.RunPodSandboxResponse{},
+			v1alpha2: &criapi.RunPodSandboxResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RunPodSandboxResponse(m.(*v1.RunPodSandboxResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RunPodSandboxResponse(m.(*criapi.RunPodSandboxResponse))
+			},
+		},
+		{
+			v1:       &v1.StopPodSandboxRequest{},
+			v1alpha2: &criapi.StopPodSandboxRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StopPodSandboxRequest(m.(*v1.StopPodSandboxRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StopPodSandboxRequest(m.(*criapi.StopPodSandboxRequest))
+			},
+		},
+		{
+			v1:       &v1.StopPodSandboxResponse{},
+			v1alpha2: &criapi.StopPodSandboxResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StopPodSandboxResponse(m.(*v1.StopPodSandboxResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StopPodSandboxResponse(m.(*criapi.StopPodSandboxResponse))
+			},
+		},
+		{
+			v1:       &v1.RemovePodSandboxRequest{},
+			v1alpha2: &criapi.RemovePodSandboxRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemovePodSandboxRequest(m.(*v1.RemovePodSandboxRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemovePodSandboxRequest(m.(*criapi.RemovePodSandboxRequest))
+			},
+		},
+		{
+			v1:       &v1.RemovePodSandboxResponse{},
+			v1alpha2: &criapi.RemovePodSandboxResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemovePodSandboxResponse(m.(*v1.RemovePodSandboxResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemovePodSandboxResponse(m.(*criapi.RemovePodSandboxResponse))
+			},
+		},
+		{
+			v1:       &v1.PodSandboxStatusRequest{},
+			v1alpha2: &criapi.PodSandboxStatusRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PodSandboxStatusRequest(m.(*v1.PodSandboxStatusRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PodSandboxStatusRequest(m.(*criapi.PodSandboxStatusRequest))
+			},
+		},
+		{
+			v1:       &v1.PodSandboxStatusResponse{},
+			v1alpha2: &criapi.PodSandboxStatusResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PodSandboxStatusResponse(m.(*v1.PodSandboxStatusResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PodSandboxStatusResponse(m.(*criapi.PodSandboxStatusResponse))
+			},
+		},
+		{
+			v1:       &v1.ListPodSandboxRequest{},
+			v1alpha2: &criapi.ListPodSandboxRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListPodSandboxRequest(m.(*v1.ListPodSandboxRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListPodSandboxRequest(m.(*criapi.ListPodSandboxRequest))
+			},
+		},
+		{
+			v1:       &v1.ListPodSandboxResponse{},
+			v1alpha2: &criapi.ListPodSandboxResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListPodSandboxResponse(m.(*v1.ListPodSandboxResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListPodSandboxResponse(m.(*criapi.ListPodSandboxResponse))
+			},
+		},
+		{
+			v1:       &v1.CreateContainerRequest{},
+			v1alpha2: &criapi.CreateContainerRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1CreateContainerRequest(m.(*v1.CreateContainerRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1CreateContainerRequest(m.(*criapi.CreateContainerRequest))
+			},
+		},
+		{
+			v1:       &v1.CreateContainerResponse{},
+			v1alpha2: &criapi.CreateContainerResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1CreateContainerResponse(m.(*v1.CreateContainerResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1CreateContainerResponse(m.(*criapi.CreateContainerResponse))
+			},
+		},
+		{
+			v1:       &v1.StartContainerRequest{},
+			v1alpha2: &criapi.StartContainerRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StartContainerRequest(m.(*v1.StartContainerRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StartContainerRequest(m.(*criapi.StartContainerRequest))
+			},
+		},
+		{
+			v1:       &v1.StartContainerResponse{},
+			v1alpha2: &criapi.StartContainerResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StartContainerResponse(m.(*v1.StartContainerResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StartContainerResponse(m.(*criapi.StartContainerResponse))
+			},
+		},
+		{
+			v1:       &v1.StopContainerRequest{},
+			v1alpha2: &criapi.StopContainerRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StopContainerRequest(m.(*v1.StopContainerRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StopContainerRequest(m.(*criapi.StopContainerRequest))
+			},
+		},
+		{
+			v1:       &v1.StopContainerResponse{},
+			v1alpha2: &criapi.StopContainerResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StopContainerResponse(m.(*v1.StopContainerResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StopContainerResponse(m.(*criapi.StopContainerResponse))
+			},
+		},
+		{
+			v1:       &v1.RemoveContainerRequest{},
+			v1alpha2: &criapi.RemoveContainerRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemoveContainerRequest(m.(*v1.RemoveContainerRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemoveContainerRequest(m.(*criapi.RemoveContainerRequest))
+			},
+		},
+		{
+			v1:       &v1.RemoveContainerResponse{},
+			v1alpha2: &criapi.RemoveContainerResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemoveContainerResponse(m.(*v1.RemoveContainerResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemoveContainerResponse(m.(*criapi.RemoveContainerResponse))
+			},
+		},
+		{
+			v1:       &v1.ListContainersRequest{},
+			v1alpha2: &criapi.ListContainersRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListContainersRequest(m.(*v1.ListContainersRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListContainersRequest(m.(*criapi.ListContainersRequest))
+			},
+		},
+		{
+			v1:       &v1.ListContainersResponse{},
+			v1alpha2: &criapi.ListContainersResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListContainersResponse(m.(*v1.ListContainersResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListContainersResponse(m.(*criapi.ListContainersResponse))
+			},
+		},
+		{
+			v1:       &v1.ContainerStatusRequest{},
+			v1alpha2: &criapi.ContainerStatusRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ContainerStatusRequest(m.(*v1.ContainerStatusRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ContainerStatusRequest(m.(*criapi.ContainerStatusRequest))
+			},
+		},
+		{
+			v1:       &v1.ContainerStatusResponse{},
+			v1alpha2: &criapi.ContainerStatusResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ContainerStatusResponse(m.(*v1.ContainerStatusResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ContainerStatusResponse(m.(*criapi.ContainerStatusResponse))
+			},
+		},
+		{
+			v1:       &v1.UpdateContainerResourcesRequest{},
+			v1alpha2: &criapi.UpdateContainerResourcesRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1UpdateContainerResourcesRequest(m.(*v1.UpdateContainerResourcesRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1UpdateContainerResourcesRequest(m.(*criapi.UpdateContainerResourcesRequest))
+			},
+		},
+		{
+			v1:       &v1.UpdateContainerResourcesResponse{},
+			v1alpha2: &criapi.UpdateContainerResourcesResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1UpdateContainerResourcesResponse(m.(*v1.UpdateContainerResourcesResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1UpdateContainerResourcesResponse(m.(*criapi.UpdateContainerResourcesResponse))
+			},
+		},
+		{
+			v1:       &v1.ReopenContainerLogRequest{},
+			v1alpha2: &criapi.ReopenContainerLogRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ReopenContainerLogRequest(m.(*v1.ReopenContainerLogRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ReopenContainerLogRequest(m.(*criapi.ReopenContainerLogRequest))
+			},
+		},
+		{
+			v1:       &v1.ReopenContainerLogResponse{},
+			v1alpha2: &criapi.ReopenContainerLogResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ReopenContainerLogResponse(m.(*v1.ReopenContainerLogResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ReopenContainerLogResponse(m.(*criapi.ReopenContainerLogResponse))
+			},
+		},
+		{
+			v1:       &v1.ExecSyncRequest{},
+			v1alpha2: &criapi.ExecSyncRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ExecSyncRequest(m.(*v1.ExecSyncRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ExecSyncRequest(m.(*criapi.ExecSyncRequest))
+			},
+		},
+		{
+			v1:       &v1.ExecSyncResponse{},
+			v1alpha2: &criapi.ExecSyncResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ExecSyncResponse(m.(*v1.ExecSyncResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ExecSyncResponse(m.(*criapi.ExecSyncResponse))
+			},
+		},
+		{
+			v1:       &v1.ExecRequest{},
+			v1alpha2: &criapi.ExecRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ExecRequest(m.(*v1.ExecRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ExecRequest(m.(*criapi.ExecRequest))
+			},
+		},
+		{
+			v1:       &v1.ExecResponse{},
+			v1alpha2: &criapi.ExecResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ExecResponse(m.(*v1.ExecResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ExecResponse(m.(*criapi.ExecResponse))
+			},
+		},
+		{
+			v1:       &v1.AttachRequest{},
+			v1alpha2: &criapi.AttachRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1AttachRequest(m.(*v1.AttachRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1AttachRequest(m.(*criapi.AttachRequest))
+			},
+		},
+		{
+			v1:       &v1.AttachResponse{},
+			v1alpha2: &criapi.AttachResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1AttachResponse(m.(*v1.AttachResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1AttachResponse(m.(*criapi.AttachResponse))
+			},
+		},
+		{
+			v1:       &v1.PortForwardRequest{},
+			v1alpha2: &criapi.PortForwardRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PortForwardRequest(m.(*v1.PortForwardRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PortForwardRequest(m.(*criapi.PortForwardRequest))
+			},
+		},
+		{
+			v1:       &v1.PortForwardResponse{},
+			v1alpha2: &criapi.PortForwardResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PortForwardResponse(m.(*v1.PortForwardResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PortForwardResponse(m.(*criapi.PortForwardResponse))
+			},
+		},
+		{
+			v1:       &v1.ContainerStatsRequest{},
+			v1alpha2: &criapi.ContainerStatsRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ContainerStatsRequest(m.(*v1.ContainerStatsRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ContainerStatsRequest(m.(*criapi.ContainerStatsRequest))
+			},
+		},
+		{
+			v1:       &v1.ContainerStatsResponse{},
+			v1alpha2: &criapi.ContainerStatsResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ContainerStatsResponse(m.(*v1.ContainerStatsResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ContainerStatsResponse(m.(*criapi.ContainerStatsResponse))
+			},
+		},
+		{
+			v1:       &v1.ListContainerStatsRequest{},
+			v1alpha2: &criapi.ListContainerStatsRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListContainerStatsRequest(m.(*v1.ListContainerStatsRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListContainerStatsRequest(m.(*criapi.ListContainerStatsRequest))
+			},
+		},
+		{
+			v1:       &v1.ListContainerStatsResponse{},
+			v1alpha2: &criapi.ListContainerStatsResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListContainerStatsResponse(m.(*v1.ListContainerStatsResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListContainerStatsResponse(m.(*criapi.ListContainerStatsResponse))
+			},
+		},
+		{
+			v1:       &v1.UpdateRuntimeConfigRequest{},
+			v1alpha2: &criapi.UpdateRuntimeConfigRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1UpdateRuntimeConfigRequest(m.(*v1.UpdateRuntimeConfigRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1UpdateRuntimeConfigRequest(m.(*criapi.UpdateRuntimeConfigRequest))
+			},
+		},
+		{
+			v1:       &v1.UpdateRuntimeConfigResponse{},
+			v1alpha2: &criapi.UpdateRuntimeConfigResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1UpdateRuntimeConfigResponse(m.(*v1.UpdateRuntimeConfigResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1UpdateRuntimeConfigResponse(m.(*criapi.UpdateRuntimeConfigResponse))
+			},
+		},
+		{
+			v1:       &v1.StatusRequest{},
+			v1alpha2: &criapi.StatusRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StatusRequest(m.(*v1.StatusRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StatusRequest(m.(*criapi.StatusRequest))
+			},
+		},
+		{
+			v1:       &v1.StatusResponse{},
+			v1alpha2: &criapi.StatusResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1StatusResponse(m.(*v1.StatusResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1StatusResponse(m.(*criapi.StatusResponse))
+			},
+		},
+		{
+			v1:       &v1.ListImagesRequest{},
+			v1alpha2: &criapi.ListImagesRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListImagesRequest(m.(*v1.ListImagesRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListImagesRequest(m.(*criapi.ListImagesRequest))
+			},
+		},
+		{
+			v1:       &v1.ListImagesResponse{},
+			v1alpha2: &criapi.ListImagesResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ListImagesResponse(m.(*v1.ListImagesResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ListImagesResponse(m.(*criapi.ListImagesResponse))
+			},
+		},
+		{
+			v1:       &v1.ImageStatusRequest{},
+			v1alpha2: &criapi.ImageStatusRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ImageStatusRequest(m.(*v1.ImageStatusRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ImageStatusRequest(m.(*criapi.ImageStatusRequest))
+			},
+		},
+		{
+			v1:       &v1.ImageStatusResponse{},
+			v1alpha2: &criapi.ImageStatusResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ImageStatusResponse(m.(*v1.ImageStatusResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ImageStatusResponse(m.(*criapi.ImageStatusResponse))
+			},
+		},
+		{
+			v1:       &v1.PullImageRequest{},
+			v1alpha2: &criapi.PullImageRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PullImageRequest(m.(*v1.PullImageRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PullImageRequest(m.(*criapi.PullImageRequest))
+			},
+		},
+		{
+			v1:       &v1.PullImageResponse{},
+			v1alpha2: &criapi.PullImageResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1PullImageResponse(m.(*v1.PullImageResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1PullImageResponse(m.(*criapi.PullImageResponse))
+			},
+		},
+		{
+			v1:       &v1.RemoveImageRequest{},
+			v1alpha2: &criapi.RemoveImageRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemoveImageRequest(m.(*v1.RemoveImageRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemoveImageRequest(m.(*criapi.RemoveImageRequest))
+			},
+		},
+		{
+			v1:       &v1.RemoveImageResponse{},
+			v1alpha2: &criapi.RemoveImageResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1RemoveImageResponse(m.(*v1.RemoveImageResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1RemoveImageResponse(m.(*criapi.RemoveImageResponse))
+			},
+		},
+		{
+			v1:       &v1.ImageFsInfoRequest{},
+			v1alpha2: &criapi.ImageFsInfoRequest{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ImageFsInfoRequest(m.(*v1.ImageFsInfoRequest))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ImageFsInfoRequest(m.(*criapi.ImageFsInfoRequest))
+			},
+		},
+		{
+			v1:       &v1.ImageFsInfoResponse{},
+			v1alpha2: &criapi.ImageFsInfoResponse{},
+			fromV1: func(m interface{}) interface{} {
+				return fromV1ImageFsInfoResponse(m.(*v1.ImageFsInfoResponse))
+			},
+			toV1: func(m interface{}) interface{} {
+				return toV1ImageFsInfoResponse(m.(*criapi.ImageFsInfoResponse))
+			},
+		},
+	}
+}
+
+// fillMessage sets all the fields of the message m, including the ones of
+// its nested messages, to distinct non-zero values
+func fillMessage(m interface{}) {
+	n := 0
+	fillValue(reflect.ValueOf(m).Elem(), &n)
+}
+
+func fillValue(v reflect.Value, n *int) {
+	*n++
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && !isProtoInternal(v.Type().Field(i).Name) {
+				fillValue(v.Field(i), n)
+			}
+		}
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem(), n)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fillValue(v.Index(i), n)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := 0; i < 2; i++ {
+			key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			fillValue(key, n)
+			fillValue(elem, n)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		v.SetString(fmt.Sprintf("value%d", *n))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int32:
+		// The enums are set to their second value
+		if v.Type().PkgPath() != "" {
+			v.SetInt(1)
+		} else {
+			v.SetInt(int64(*n))
+		}
+	case reflect.Int64:
+		v.SetInt(int64(*n))
+	case reflect.Uint8, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(*n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(*n) + 0.5)
+	default:
+		panic(fmt.Sprintf("cannot fill a %s", v.Type()))
+	}
+}
+
+// isProtoInternal returns whether the field is internal to protobuf
+func isProtoInternal(name string) bool {
+	return len(name) > 4 && name[:4] == "XXX_"
+}
+
+// requireSameFields requires the fields of the messages of both versions to
+// hold the same values, comparing the enums by their numbers
+func requireSameFields(t *testing.T, expected, actual reflect.Value, path string) {
+	t.Helper()
+
+	switch expected.Kind() {
+	case reflect.Ptr:
+		require.Equal(t, expected.IsNil(), actual.IsNil(), "%s was not converted", path)
+		if !expected.IsNil() {
+			requireSameFields(t, expected.Elem(), actual.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < expected.NumField(); i++ {
+			name := expected.Type().Field(i).Name
+			if isProtoInternal(name) {
+				continue
+			}
+
+			field := actual.FieldByName(name)
+			require.True(t, field.IsValid(), "%s.%s is missing", path, name)
+			requireSameFields(t, expected.Field(i), field, path+"."+name)
+		}
+	case reflect.Slice:
+		if expected.Type().Elem().Kind() == reflect.Uint8 {
+			require.Equal(t, expected.Bytes(), actual.Bytes(), "%s was not converted", path)
+			return
+		}
+		require.Equal(t, expected.Len(), actual.Len(), "%s was not converted", path)
+		for i := 0; i < expected.Len(); i++ {
+			requireSameFields(t, expected.Index(i), actual.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		require.Equal(t, expected.Len(), actual.Len(), "%s was not converted", path)
+		for _, key := range expected.MapKeys() {
+			elem := actual.MapIndex(key)
+			require.True(t, elem.IsValid(), "%s[%v] was not converted", path, key)
+			requireSameFields(t, expected.MapIndex(key), elem, fmt.Sprintf("%s[%v]", path, key))
+		}
+	default:
+		require.Equal(t, expected.Interface(), actual.Convert(expected.Type()).Interface(), "%s was not converted", path)
+	}
+}
+
+func TestV1Conversion(t *testing.T) {
+	for _, c := range v1Conversions() {
+		c := c
+		t.Run(reflect.TypeOf(c.v1).Elem().Name(), func(t *testing.T) {
+			t.Run("FromV1", func(t *testing.T) {
+				fillMessage(c.v1)
+
+				converted := c.fromV1(c.v1)
+				requireSameFields(t, reflect.ValueOf(c.v1), reflect.ValueOf(converted), "v1")
+				require.Equal(t, c.v1, c.toV1(converted), "message did not round-trip")
+			})
+
+			t.Run("ToV1", func(t *testing.T) {
+				fillMessage(c.v1alpha2)
+
+				converted := c.toV1(c.v1alpha2)
+				requireSameFields(t, reflect.ValueOf(c.v1alpha2), reflect.ValueOf(converted), "v1alpha2")
+				require.Equal(t, c.v1alpha2, c.fromV1(converted), "message did not round-trip")
+			})
+
+			t.Run("Nil", func(t *testing.T) {
+				require.True(t, reflect.ValueOf(c.fromV1(reflect.Zero(reflect.TypeOf(c.v1)).Interface())).IsNil())
+				require.True(t, reflect.ValueOf(c.toV1(reflect.Zero(reflect.TypeOf(c.v1alpha2)).Interface())).IsNil())
+			})
+		})
+	}
+}
+
+func TestV1ConversionCoversServices(t *testing.T) {
+	converted := make(map[string]bool)
+	for _, c := range v1Conversions() {
+		converted[reflect.TypeOf(c.v1).Elem().Name()] = true
+	}
+
+	for _, service := range []interface{}{(*v1.RuntimeServiceServer)(nil), (*v1.ImageServiceServer)(nil)} {
+		iface := reflect.TypeOf(service).Elem()
+		for i := 0; i < iface.NumMethod(); i++ {
+			method := iface.Method(i)
+			require.True(t, converted[method.Type.In(1).Elem().Name()], "request of %s is not converted", method.Name)
+			require.True(t, converted[method.Type.Out(0).Elem().Name()], "response of %s is not converted", method.Name)
+		}
+	}
+}
+
+func TestCRIDualRegistration(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	server := grpc.NewServer()
+	s.Register(server)
+
+	info := server.GetServiceInfo()
+	for _, name := range []string{
+		"runtime.v1alpha2.RuntimeService", "runtime.v1alpha2.ImageService",
+		"runtime.v1.RuntimeService", "runtime.v1.ImageService",
+	} {
+		require.Contains(t, info, name, "%s is not registered", name)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	require.NoError(t, err, "failed to dial the service")
+	defer conn.Close()
+
+	ctx := context.Background()
+
+	// A kubelet of Kubernetes 1.25 or earlier
+	v1alpha2, err := criapi.NewRuntimeServiceClient(conn).Version(ctx, &criapi.VersionRequest{Version: "v1alpha2"})
+	require.NoError(t, err, "v1alpha2 Version failed")
+	require.Equal(t, "v1alpha2", v1alpha2.RuntimeApiVersion)
+
+	// A kubelet of Kubernetes 1.26 or later
+	v1Client := v1.NewRuntimeServiceClient(conn)
+	version, err := v1Client.Version(ctx, &v1.VersionRequest{Version: "v1"})
+	require.NoError(t, err, "v1 Version failed")
+	require.Equal(t, criV1Version, version.RuntimeApiVersion, "v1 API version was not reported")
+	require.Equal(t, "containerd", version.RuntimeName, "runtime name was lost")
+
+	created, err := v1Client.CreateContainer(ctx, toV1CreateContainerRequest(newUserContainerRequest("pod", "img")))
+	require.NoError(t, err, "v1 CreateContainer failed")
+	require.True(t, s.coordinator.isActive(created.ContainerId), "v1 CreateContainer did not start a VM")
+	require.Equal(t, 1, orch.NumStarted(), "v1 CreateContainer did not start a VM")
+
+	// The methods added in v1 are not served
+	err = conn.Invoke(ctx, "/runtime.v1.RuntimeService/ListPodSandboxStats", &v1.ListContainerStatsRequest{}, &v1.ListContainerStatsResponse{})
+	require.Equal(t, codes.Unimplemented, status.Code(err), "unexpected error of a method added in v1")
+}
@@ -0,0 +1,254 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// defaultProbeCheckTimeout bounds the health checks of the probes
+	// that do not set their own timeout
+	defaultProbeCheckTimeout = 2 * time.Second
+
+	livenessProbe  = "healthz"
+	readinessProbe = "readyz"
+
+	probeStatusOK      = "ok"
+	probeStatusFailing = "failing"
+)
+
+// HealthCheck is a check of the liveness or readiness of the daemon, which
+// fails if Check returns an error or does not return within Timeout
+type HealthCheck struct {
+	Name string
+	// Timeout bounds the check, defaultProbeCheckTimeout if 0
+	Timeout time.Duration
+	Check   func(ctx context.Context) error
+}
+
+// HealthCheckResult is the outcome of a health check of a probe
+type HealthCheckResult struct {
+	Name       string  `json:"name"`
+	Healthy    bool    `json:"healthy"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// HealthReport is the aggregate status of a probe with the results of its checks
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// daemonHealth runs the checks of the liveness and readiness probes of the
+// daemon, keeping the outcome of the last run of each check for the metrics
+type daemonHealth struct {
+	liveness  []HealthCheck
+	readiness []HealthCheck
+
+	mu sync.Mutex
+	// last is whether each check of each probe was healthy on its last run
+	last map[string]map[string]bool
+}
+
+func newDaemonHealth() *daemonHealth {
+	return &daemonHealth{last: make(map[string]map[string]bool)}
+}
+
+// WithHealthChecks adds checks to the liveness (/healthz) and readiness
+// (/readyz) probes of the daemon, on top of the built-in ones
+func WithHealthChecks(liveness, readiness []HealthCheck) ServiceOption {
+	return func(s *Service) {
+		s.health.liveness = append(s.health.liveness, liveness...)
+		s.health.readiness = append(s.health.readiness, readiness...)
+	}
+}
+
+// stockRuntimeCheck is the built-in readiness check of the stock containerd,
+// to which the CRI requests of the non-function containers are forwarded
+func (s *Service) stockRuntimeCheck() HealthCheck {
+	return HealthCheck{
+		Name: "stock_runtime",
+		Check: func(ctx context.Context) error {
+			_, err := s.stockRuntimeClient.Version(ctx, &criapi.VersionRequest{})
+			return err
+		},
+	}
+}
+
+// probe runs the checks of the probe concurrently, each within its own
+// timeout, and reports the probe as failing if any check failed
+func (h *daemonHealth) probe(ctx context.Context, probe string, checks []HealthCheck) HealthReport {
+	report := HealthReport{
+		Status: probeStatusOK,
+		Checks: make([]HealthCheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Checks[i] = runHealthCheck(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.last[probe] == nil {
+		h.last[probe] = make(map[string]bool)
+	}
+	for _, res := range report.Checks {
+		if !res.Healthy {
+			report.Status = probeStatusFailing
+		}
+		h.last[probe][res.Name] = res.Healthy
+	}
+
+	return report
+}
+
+// runHealthCheck runs the check within its timeout. A check ignoring its
+// context is reported as failed on timeout and left to return on its own.
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	res := HealthCheckResult{
+		Name:       check.Name,
+		Healthy:    err == nil,
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// Liveness runs the checks of the liveness probe of the daemon
+func (s *Service) Liveness(ctx context.Context) HealthReport {
+	return s.health.probe(ctx, livenessProbe, s.health.liveness)
+}
+
+// Readiness runs the checks of the readiness probe of the daemon
+func (s *Service) Readiness(ctx context.Context) HealthReport {
+	return s.health.probe(ctx, readinessProbe, append([]HealthCheck{s.stockRuntimeCheck()}, s.health.readiness...))
+}
+
+// HealthHandler returns the handler of the liveness (/healthz) and readiness
+// (/readyz) probes of the daemon, which respond with 200 if all the checks of
+// the probe pass and with 503 otherwise, along with the JSON report
+func (s *Service) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+livenessProbe, func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, s.Liveness(r.Context()))
+	})
+	mux.HandleFunc("/"+readinessProbe, func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, s.Readiness(r.Context()))
+	})
+
+	return mux
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	if report.Status != probeStatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, report)
+}
+
+// writeHealthMetrics writes whether each check of the probes was healthy on
+// its last run as the vhive_health_check_up gauge, nothing before any probe ran
+func (h *daemonHealth) writeHealthMetrics(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.last) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprint(w, "# HELP vhive_health_check_up Whether the health check of the probe passed on its last run.\n"+
+		"# TYPE vhive_health_check_up gauge\n"); err != nil {
+		return err
+	}
+
+	probes := make([]string, 0, len(h.last))
+	for probe := range h.last {
+		probes = append(probes, probe)
+	}
+	sort.Strings(probes)
+
+	for _, probe := range probes {
+		checks := make([]string, 0, len(h.last[probe]))
+		for check := range h.last[probe] {
+			checks = append(checks, check)
+		}
+		sort.Strings(checks)
+
+		for _, check := range checks {
+			up := 0
+			if h.last[probe][check] {
+				up = 1
+			}
+			if _, err := fmt.Fprintf(w, "vhive_health_check_up{probe=%q,check=%q} %d\n", probe, check, up); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+// getHealthReport probes the daemon and returns the status code and the report
+func getHealthReport(t *testing.T, s *Service, probe string) (int, HealthReport) {
+	server := httptest.NewServer(s.HealthHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/" + probe)
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var report HealthReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report), "failed to decode the report")
+
+	return resp.StatusCode, report
+}
+
+func TestHealthzWithoutChecks(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	code, report := getHealthReport(t, s, livenessProbe)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, probeStatusOK, report.Status)
+	require.Empty(t, report.Checks)
+}
+
+func TestReadyzToggles(t *testing.T) {
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, fakes.NewOrchestrator())
+
+	var free int32 = 1
+	WithHealthChecks(nil, []HealthCheck{{
+		Name: "network",
+		Check: func(ctx context.Context) error {
+			if atomic.LoadInt32(&free) == 0 {
+				return errors.New("no free IPs")
+			}
+			return nil
+		},
+	}})(s)
+
+	code, report := getHealthReport(t, s, readinessProbe)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, probeStatusOK, report.Status)
+	require.Len(t, report.Checks, 2)
+	require.Equal(t, "stock_runtime", report.Checks[0].Name)
+	require.True(t, report.Checks[0].Healthy)
+	require.Equal(t, "network", report.Checks[1].Name)
+	require.True(t, report.Checks[1].Healthy)
+
+	atomic.StoreInt32(&free, 0)
+
+	code, report = getHealthReport(t, s, readinessProbe)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, probeStatusFailing, report.Status)
+	require.True(t, report.Checks[0].Healthy)
+	require.False(t, report.Checks[1].Healthy)
+	require.Equal(t, "no free IPs", report.Checks[1].Error)
+
+	atomic.StoreInt32(&free, 1)
+	stock.VersionErr = errors.New("connection refused")
+
+	code, report = getHealthReport(t, s, readinessProbe)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, report.Checks[0].Healthy)
+	require.Contains(t, report.Checks[0].Error, "connection refused")
+	require.True(t, report.Checks[1].Healthy)
+
+	stock.VersionErr = nil
+
+	code, _ = getHealthReport(t, s, readinessProbe)
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestReadyzCheckTimeout(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	block := make(chan struct{})
+	defer close(block)
+
+	WithHealthChecks(nil, []HealthCheck{
+		{
+			Name:    "snapshotter",
+			Timeout: 50 * time.Millisecond,
+			Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		{
+			// A check ignoring its context still times out
+			Name:    "devmapper_pool",
+			Timeout: 50 * time.Millisecond,
+			Check: func(ctx context.Context) error {
+				<-block
+				return nil
+			},
+		},
+	})(s)
+
+	start := time.Now()
+	code, report := getHealthReport(t, s, readinessProbe)
+	require.Less(t, int64(time.Since(start)), int64(time.Second), "the checks must time out concurrently")
+
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, report.Checks, 3)
+	require.True(t, report.Checks[0].Healthy)
+	require.False(t, report.Checks[1].Healthy)
+	require.Equal(t, "timed out after 50ms", report.Checks[1].Error)
+	require.False(t, report.Checks[2].Healthy)
+	require.Contains(t, report.Checks[2].Error, "timed out")
+	require.GreaterOrEqual(t, report.Checks[2].DurationMs, float64(50))
+}
+
+func TestHealthMetrics(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	WithHealthChecks([]HealthCheck{{
+		Name:  "cri_server",
+		Check: func(ctx context.Context) error { return nil },
+	}}, []HealthCheck{{
+		Name:  "network",
+		Check: func(ctx context.Context) error { return errors.New("no free IPs") },
+	}})(s)
+
+	var sb strings.Builder
+	require.NoError(t, s.health.writeHealthMetrics(&sb))
+	require.Empty(t, sb.String(), "expected no metrics before any probe")
+
+	s.Liveness(context.Background())
+	s.Readiness(context.Background())
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), "# TYPE vhive_health_check_up gauge\n"+
+		`vhive_health_check_up{probe="healthz",check="cri_server"} 1`+"\n"+
+		`vhive_health_check_up{probe="readyz",check="network"} 0`+"\n"+
+		`vhive_health_check_up{probe="readyz",check="stock_runtime"} 1`+"\n")
+}
@@ -0,0 +1,204 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ease-lab/vhive/taps"
+)
+
+// debugFormatJSON is the ?format= of the debug endpoints that list their data
+// as JSON instead of the human-readable text
+const debugFormatJSON = "json"
+
+// DebugHandler returns the handler of the debug HTTP endpoints of the service.
+// The endpoints that are human-readable text by default serve the same data as
+// JSON with ?format=json, the other ones are JSON.
+func (s *Service) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vms", s.serveVMs)
+	mux.HandleFunc("/debug/memory", s.serveMemory)
+	mux.HandleFunc("/debug/scale-to-zero", s.serveScaleToZero)
+	mux.HandleFunc("/debug/start-failures", s.serveStartFailures)
+	mux.HandleFunc("/debug/create-throttle", s.serveCreateThrottle)
+	mux.HandleFunc("/debug/slot-reuse", s.serveSlotReuse)
+	mux.HandleFunc("/debug/boot-limit", s.serveBootLimit)
+	mux.HandleFunc("/debug/sandboxes", s.serveSandboxes)
+	mux.HandleFunc("/debug/revisions", s.serveRevisions)
+	mux.HandleFunc("/debug/restart", s.serveRestart)
+	mux.HandleFunc("/metrics", s.serveScaleHints)
+	if s.coordinator.faults != nil {
+		mux.HandleFunc("/debug/faults", s.serveFaults)
+	}
+
+	return mux
+}
+
+// serveVMs lists the active VMs, one per line, or as JSON with their boot traces
+func (s *Service) serveVMs(w http.ResponseWriter, r *http.Request) {
+	jsonFormat, err := isJSONFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jsonFormat {
+		writeJSON(w, s.coordinator.ListActive())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tVM\tREVISION\tIMAGE\tGUEST IP\tMEMORY (MiB)\tVCPUS\tUPTIME\tSTATE")
+
+	for _, vm := range s.coordinator.ListActive() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			vm.ContainerID, vm.VMID, vm.Revision, vm.Image, vm.GuestIP,
+			vm.MemSizeMib, vm.VcpuCount, vm.Uptime.Round(time.Second), vm.State)
+	}
+
+	tw.Flush()
+}
+
+// serveMemory reports the guest memory committed on the node as JSON
+func (s *Service) serveMemory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.MemoryStats())
+}
+
+// serveScaleToZero reports the offloads and restores of VMs as JSON
+func (s *Service) serveScaleToZero(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.ScaleToZeroStats())
+}
+
+// serveStartFailures reports the VMs that failed to start by phase as JSON
+func (s *Service) serveStartFailures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.StartFailureStats())
+}
+
+// serveCreateThrottle reports the creations of user containers delayed or
+// rejected by the rate limit, by revision, as JSON
+func (s *Service) serveCreateThrottle(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.CreateThrottleStats())
+}
+
+// serveSlotReuse reports the VMs parked and adopted by the containers of
+// their revision as JSON
+func (s *Service) serveSlotReuse(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.SlotReuseStats())
+}
+
+// serveBootLimit reports the VM boots in flight and queued as JSON
+func (s *Service) serveBootLimit(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.BootLimitStats())
+}
+
+// serveRevisions reports the number of active VMs of each revision as JSON
+func (s *Service) serveRevisions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.CountByRevision())
+}
+
+// serveSandboxes reports the sandbox backends and their capabilities as JSON
+func (s *Service) serveSandboxes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Sandboxes())
+}
+
+// serveScaleHints exposes the load of the revisions to the autoscaler, the
+// metrics of the connection proxies and the committed guest memory in the
+// Prometheus text format
+func (s *Service) serveScaleHints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := writeScaleHints(w, s.ScaleHints()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeConnProxyMetrics(w, s.ConnProxyStats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeMemoryMetrics(w, s.MemoryStats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writePreparedTapMetrics(w, s.PreparedTapStats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeREAPMetrics(w, s.ScaleToZeroStats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeAdmissionMetrics(w, s.Admission()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.health.writeHealthMetrics(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writePreparedTapMetrics writes the hits and misses of the prepared taps
+// in the Prometheus text format, nothing if they are disabled
+func writePreparedTapMetrics(w io.Writer, stats taps.PreparedTapStats) error {
+	if stats.Size == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "# HELP vhive_prepared_taps_ready Taps created ahead of the VMs and not taken yet.\n"+
+		"# TYPE vhive_prepared_taps_ready gauge\nvhive_prepared_taps_ready %d\n"+
+		"# HELP vhive_prepared_taps_hits_total VMs that took a prepared tap.\n"+
+		"# TYPE vhive_prepared_taps_hits_total counter\nvhive_prepared_taps_hits_total %d\n"+
+		"# HELP vhive_prepared_taps_misses_total VMs that created their tap as no prepared one was ready.\n"+
+		"# TYPE vhive_prepared_taps_misses_total counter\nvhive_prepared_taps_misses_total %d\n",
+		stats.Ready, stats.Hits, stats.Misses)
+
+	return err
+}
+
+// isJSONFormat returns whether the request asks for JSON with ?format=json
+// rather than the default text
+func isJSONFormat(r *http.Request) (bool, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "text":
+		return false, nil
+	case debugFormatJSON:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown format %q, expected text or %s", format, debugFormatJSON)
+	}
+}
+
+// writeJSON writes the value as the JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
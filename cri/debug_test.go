@@ -0,0 +1,196 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugVMs(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/vms")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 2, "expected a header and a VM")
+	require.Equal(t, []string{"ctr1", "1", "img-00001", "img", "190.128.0.1", "256", "1", "0s", "running"}, strings.Fields(lines[1]))
+}
+
+func TestDebugVMsJSON(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/vms?format=json")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var vms []VMInfo
+	require.NoError(t, json.Unmarshal(body, &vms), "response is not a list of VMs")
+	require.Len(t, vms, 1)
+	require.Equal(t, "ctr1", vms[0].ContainerID)
+	require.Equal(t, "1", vms[0].VMID)
+	require.Equal(t, "img-00001", vms[0].Revision)
+	require.Equal(t, "190.128.0.1", vms[0].GuestIP)
+	require.Equal(t, vmStateRunning, vms[0].State)
+	require.NotNil(t, vms[0].BootTrace, "boot trace is missing")
+	require.False(t, vms[0].BootTrace.VMBooted.Before(vms[0].BootTrace.Start), "boot trace is inconsistent")
+
+	// The field names are part of the interface of the tooling
+	var fields []map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &fields))
+	for _, key := range []string{"containerID", "vmID", "image", "revision", "guestIP", "state", "bootTrace"} {
+		require.Contains(t, fields[0], key)
+	}
+	require.Contains(t, fields[0]["bootTrace"], "vmBooted")
+}
+
+func TestDebugVMsUnknownFormat(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/vms?format=xml")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCountByRevision(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	require.Empty(t, s.CountByRevision())
+
+	for i, image := range []string{"img", "other", "img", "img", "other"} {
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest(fmt.Sprintf("pod%d", i), image))
+		require.NoError(t, err, "container creation failed")
+	}
+
+	require.Equal(t, map[string]int{"img-00001": 3, "other-00001": 2}, s.CountByRevision())
+
+	require.NoError(t, s.coordinator.stopVM(context.Background(), "ctr2"))
+	require.Equal(t, map[string]int{"img-00001": 3, "other-00001": 1}, s.CountByRevision())
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/revisions")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var counts map[string]int
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&counts))
+	require.Equal(t, map[string]int{"img-00001": 3, "other-00001": 1}, counts)
+}
+
+func TestVMInfoJSONRoundTrip(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	info := VMInfo{
+		ContainerID:  "ctr1",
+		VMID:         "1",
+		Image:        "img",
+		ImageDigest:  "sha256:abc",
+		Revision:     "img-00001",
+		GuestIP:      "190.128.0.1",
+		GuestPort:    defaultGuestPort,
+		MemSizeMib:   256,
+		VcpuCount:    2,
+		MemTargetMib: 128,
+		CPUQuota:     1.5,
+		BootType:     "cold",
+		StartTime:    start,
+		Uptime:       90 * time.Second,
+		State:        vmStateRunning,
+		BootTrace: &BootTrace{
+			Start:              start,
+			NetworkAllocated:   start.Add(10 * time.Millisecond),
+			ImageResolved:      start.Add(200 * time.Millisecond),
+			VMBooted:           start.Add(time.Second),
+			AgentReady:         start.Add(1500 * time.Millisecond),
+			FirecrackerVersion: "v0.24.0",
+		},
+	}
+
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+
+	var decoded VMInfo
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, info, decoded, "VM info does not round-trip")
+
+	// A VM without boot trace omits it
+	info.BootTrace = nil
+	data, err = json.Marshal(info)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "bootTrace")
+}
+
+func TestPreparedTapMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writePreparedTapMetrics(&buf, taps.PreparedTapStats{}))
+	require.Empty(t, buf.String(), "disabled prepared taps must not be published")
+
+	require.NoError(t, writePreparedTapMetrics(&buf, taps.PreparedTapStats{Size: 4, Ready: 3, Hits: 7, Misses: 2}))
+	require.Contains(t, buf.String(), "vhive_prepared_taps_ready 3\n")
+	require.Contains(t, buf.String(), "vhive_prepared_taps_hits_total 7\n")
+	require.Contains(t, buf.String(), "vhive_prepared_taps_misses_total 2\n")
+}
@@ -0,0 +1,176 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdmissionMode is which containers the node accepts, see SetAdmission
+type AdmissionMode int32
+
+const (
+	// AdmissionOpen accepts all the containers
+	AdmissionOpen AdmissionMode = iota
+	// AdmissionDrain rejects the user containers with ErrNodeDraining, e.g.,
+	// during an upgrade of vHive, so that they are placed on other nodes.
+	// The VMs already started keep serving until their pods terminate.
+	AdmissionDrain
+	// AdmissionClosed rejects all the containers with ErrNodeClosed
+	AdmissionClosed
+)
+
+var admissionModes = []string{"open", "drain", "closed"}
+
+// String returns the name of the mode
+func (m AdmissionMode) String() string {
+	if m < 0 || int(m) >= len(admissionModes) {
+		return fmt.Sprintf("AdmissionMode(%d)", int32(m))
+	}
+	return admissionModes[m]
+}
+
+// ParseAdmissionMode parses the name of an admission mode: open, drain or closed
+func ParseAdmissionMode(s string) (AdmissionMode, error) {
+	for i, name := range admissionModes {
+		if s == name {
+			return AdmissionMode(i), nil
+		}
+	}
+
+	return AdmissionOpen, errors.Errorf("unknown admission mode %q, expected %s", s, strings.Join(admissionModes, ", "))
+}
+
+// ErrNodeDraining rejects the user containers of a draining node. It is
+// Unavailable, so that kubelet retries the creation until the node is back.
+var ErrNodeDraining = status.Error(codes.Unavailable,
+	"node is draining, it does not accept new VMs, retry later or on another node")
+
+// ErrNodeClosed rejects all the containers of a closed node
+var ErrNodeClosed = status.Error(codes.Unavailable,
+	"node is closed, it does not accept new containers, retry later or on another node")
+
+// WithAdmissionState persists the admission mode in the state file at path,
+// so that a node drained for an upgrade is still drained when vHive restarts
+func WithAdmissionState(path string) ServiceOption {
+	return func(s *Service) {
+		s.admissionStatePath = path
+	}
+}
+
+// SetAdmission sets which containers the node accepts, returning the previous
+// mode. The containers are still stopped and removed in every mode. The mode
+// is only changed if it is persisted.
+func (s *Service) SetAdmission(mode AdmissionMode) (AdmissionMode, error) {
+	s.admissionMu.Lock()
+	defer s.admissionMu.Unlock()
+
+	if s.admissionStatePath != "" {
+		state := mode.String() + "\n"
+		if err := writeFileAtomic(s.admissionStatePath, strings.NewReader(state), int64(len(state))); err != nil {
+			return s.Admission(), errors.Wrap(err, "failed to persist the admission mode")
+		}
+	}
+
+	old := AdmissionMode(atomic.SwapInt32(&s.admission, int32(mode)))
+	if old != mode {
+		coordLog.WithFields(log.Fields{"mode": mode, "previous": old}).Info("admission mode changed")
+	}
+
+	return old, nil
+}
+
+// Admission returns which containers the node accepts
+func (s *Service) Admission() AdmissionMode {
+	return AdmissionMode(atomic.LoadInt32(&s.admission))
+}
+
+// loadAdmission restores the admission mode persisted at path, open if none
+func loadAdmission(path string) (AdmissionMode, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return AdmissionOpen, nil
+	}
+	if err != nil {
+		return AdmissionOpen, errors.Wrap(err, "failed to read the admission state")
+	}
+
+	mode, err := ParseAdmissionMode(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return AdmissionOpen, errors.Wrapf(err, "invalid admission state %s", path)
+	}
+
+	return mode, nil
+}
+
+// SetDraining cordons the node or puts it back in service. A draining node
+// keeps its VMs running but rejects the creation of user containers with
+// ErrNodeDraining, while the queue-proxies of the VMs already started and
+// the control-plane containers are still created. The mode is left unchanged
+// if it cannot be persisted.
+func (s *Service) SetDraining(draining bool) error {
+	mode := AdmissionOpen
+	if draining {
+		mode = AdmissionDrain
+	}
+
+	_, err := s.SetAdmission(mode)
+	return err
+}
+
+// IsDraining returns true if the node rejects the creation of user containers
+func (s *Service) IsDraining() bool {
+	return s.Admission() != AdmissionOpen
+}
+
+// writeAdmissionMetrics writes the admission mode of the node in the
+// Prometheus text format, 1 for the current mode and 0 for the others
+func writeAdmissionMetrics(w io.Writer, mode AdmissionMode) error {
+	if _, err := fmt.Fprint(w, "# HELP vhive_admission_mode The admission mode of the node, 1 for the current one.\n"+
+		"# TYPE vhive_admission_mode gauge\n"); err != nil {
+		return err
+	}
+
+	for i, name := range admissionModes {
+		value := 0
+		if AdmissionMode(i) == mode {
+			value = 1
+		}
+		if _, err := fmt.Fprintf(w, "vhive_admission_mode{mode=%q} %d\n", name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
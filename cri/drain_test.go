@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestDraining(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+	ctx := context.Background()
+
+	// The VM of pod1 is started before the node is cordoned
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	require.NoError(t, s.SetDraining(true))
+	require.True(t, s.IsDraining())
+
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+	require.True(t, errors.Is(err, ErrNodeDraining), "user container was created on a draining node")
+	require.Equal(t, codes.Unavailable, status.Code(err), "draining is not retriable")
+	require.Equal(t, 1, orch.NumStarted(), "VM was started on a draining node")
+	require.Equal(t, []string{"ctr1"}, stock.Created, "placeholder container was created on a draining node")
+
+	// The queue-proxy of the VM already started is still created
+	qp, err := s.CreateContainer(ctx, newQueueProxyRequest("pod1"))
+	require.NoError(t, err, "queue-proxy of a running VM was rejected")
+	require.Equal(t, "ctr2", qp.GetContainerId())
+
+	// So are the control-plane containers
+	r := &criapi.CreateContainerRequest{
+		PodSandboxId: "pod3",
+		Config:       &criapi.ContainerConfig{Metadata: &criapi.ContainerMetadata{Name: "kube-proxy"}},
+	}
+	_, err = s.CreateContainer(ctx, r)
+	require.NoError(t, err, "control-plane container was rejected")
+
+	require.True(t, s.coordinator.isActive("ctr1"), "VM of a draining node was stopped")
+
+	require.NoError(t, s.SetDraining(false))
+	require.False(t, s.IsDraining())
+
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "user container was rejected after draining")
+	require.Equal(t, 2, orch.NumStarted())
+}
+
+func TestAdmissionModes(t *testing.T) {
+	for _, tc := range []struct {
+		mode AdmissionMode
+		// expectUC is the error creating a user container, expectOther the one
+		// creating the queue-proxy of a running VM or a control-plane container
+		expectUC    error
+		expectOther error
+	}{
+		{mode: AdmissionOpen},
+		{mode: AdmissionDrain, expectUC: ErrNodeDraining},
+		{mode: AdmissionClosed, expectUC: ErrNodeClosed, expectOther: ErrNodeClosed},
+	} {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+			ctx := context.Background()
+
+			// The VM of pod1 is started before the mode is set
+			uc, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", "img"))
+			require.NoError(t, err, "container creation failed")
+
+			previous, err := s.SetAdmission(tc.mode)
+			require.NoError(t, err)
+			require.Equal(t, AdmissionOpen, previous)
+			require.Equal(t, tc.mode, s.Admission())
+
+			_, err = s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+			require.Equal(t, tc.expectUC, err, "unexpected creation of a user container")
+			if tc.expectUC != nil {
+				require.Equal(t, codes.Unavailable, status.Code(err), "a rejection is not retriable")
+			}
+
+			_, err = s.CreateContainer(ctx, newQueueProxyRequest("pod1"))
+			require.Equal(t, tc.expectOther, err, "unexpected creation of the queue-proxy of a running VM")
+
+			r := &criapi.CreateContainerRequest{
+				PodSandboxId: "pod3",
+				Config:       &criapi.ContainerConfig{Metadata: &criapi.ContainerMetadata{Name: "kube-proxy"}},
+			}
+			_, err = s.CreateContainer(ctx, r)
+			require.Equal(t, tc.expectOther, err, "unexpected creation of a control-plane container")
+
+			expectStarted := 1
+			if tc.expectUC == nil {
+				expectStarted = 2
+			}
+			require.Equal(t, expectStarted, orch.NumStarted())
+
+			// The VMs already started keep serving until their pods terminate
+			require.True(t, s.coordinator.isActive(uc.GetContainerId()), "running VM was stopped")
+			_, err = s.StopContainer(ctx, &criapi.StopContainerRequest{ContainerId: uc.GetContainerId()})
+			require.NoError(t, err, "container was not stopped")
+			_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: uc.GetContainerId()})
+			require.NoError(t, err, "container was not removed")
+			require.False(t, s.coordinator.isActive(uc.GetContainerId()), "VM of the removed container is still active")
+		})
+	}
+}
+
+func TestParseAdmissionMode(t *testing.T) {
+	for _, mode := range []AdmissionMode{AdmissionOpen, AdmissionDrain, AdmissionClosed} {
+		parsed, err := ParseAdmissionMode(mode.String())
+		require.NoError(t, err)
+		require.Equal(t, mode, parsed)
+	}
+
+	_, err := ParseAdmissionMode("cordoned")
+	require.Error(t, err)
+}
+
+func TestAdmissionPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admission")
+
+	mode, err := loadAdmission(path)
+	require.NoError(t, err, "missing state was not open")
+	require.Equal(t, AdmissionOpen, mode)
+
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	WithAdmissionState(path)(s)
+	_, err = s.SetAdmission(AdmissionDrain)
+	require.NoError(t, err)
+
+	// A restarted daemon is still draining
+	mode, err = loadAdmission(path)
+	require.NoError(t, err)
+	require.Equal(t, AdmissionDrain, mode)
+
+	require.NoError(t, s.SetDraining(false))
+	mode, err = loadAdmission(path)
+	require.NoError(t, err)
+	require.Equal(t, AdmissionOpen, mode)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("half-open\n"), 0600))
+	_, err = loadAdmission(path)
+	require.Error(t, err, "invalid state was loaded")
+
+	// A mode that cannot be persisted is not set
+	WithAdmissionState(filepath.Join(path, "admission"))(s)
+	_, err = s.SetAdmission(AdmissionClosed)
+	require.Error(t, err)
+	require.Equal(t, AdmissionOpen, s.Admission())
+
+	require.Error(t, s.SetDraining(true), "failure to persist draining was not reported")
+	require.False(t, s.IsDraining(), "node is draining without persisting it")
+}
+
+func TestAdmissionMetrics(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	_, err := s.SetAdmission(AdmissionDrain)
+	require.NoError(t, err)
+
+	var sb strings.Builder
+	require.NoError(t, writeAdmissionMetrics(&sb, s.Admission()))
+	require.Equal(t, "# HELP vhive_admission_mode The admission mode of the node, 1 for the current one.\n"+
+		"# TYPE vhive_admission_mode gauge\n"+
+		`vhive_admission_mode{mode="open"} 0`+"\n"+
+		`vhive_admission_mode{mode="drain"} 1`+"\n"+
+		`vhive_admission_mode{mode="closed"} 0`+"\n", sb.String())
+}
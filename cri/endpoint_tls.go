@@ -0,0 +1,299 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EndpointTLS configures the TLS of the admin, debug and snapshot peer
+// endpoints of vHive
+type EndpointTLS struct {
+	// CertFile and KeyFile are the certificate and the key of the endpoints,
+	// also presented by the node to the snapshot peers of the other nodes
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA the client certificates are verified against,
+	// the clients are not authenticated if empty. The snapshot peers of the
+	// other nodes are verified against it too, or the system roots if empty.
+	ClientCAFile string
+	// RequireClientCert rejects the clients without a certificate of ClientCAFile
+	RequireClientCert bool
+}
+
+// Enabled returns true if the endpoints are served over TLS
+func (c EndpointTLS) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientCAFile != "" || c.RequireClientCert
+}
+
+func (c EndpointTLS) validate() error {
+	switch {
+	case c.CertFile == "" || c.KeyFile == "":
+		return errors.New("both the certificate and the key of the endpoints must be set")
+	case c.RequireClientCert && c.ClientCAFile == "":
+		return errors.New("client certificates are required but their CA is not set")
+	}
+	return nil
+}
+
+// endpointCerts are the certificate of the endpoints and the CA of the
+// clients, reloaded when their files change, e.g., on rotation
+type endpointCerts struct {
+	sync.Mutex
+
+	cfg      EndpointTLS
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	// modTimes are the modification times of the files when they were loaded
+	modTimes map[string]time.Time
+}
+
+// NewEndpointTLS returns the TLS config of the endpoints, failing if the
+// certificates cannot be loaded. The certificate, the key and the client CA
+// are reloaded from their files on the first handshake after they change,
+// the previous ones being kept if the new files are invalid.
+func NewEndpointTLS(cfg EndpointTLS) (*tls.Config, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	certs := &endpointCerts{cfg: cfg}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: certs.configForClient,
+	}, nil
+}
+
+// NewPeerTLS returns the TLS config of the connections of the node to the
+// snapshot peers of the other nodes, presenting the certificate of the
+// endpoints and verifying theirs against the client CA, which is the CA of
+// the nodes. The certificates are reloaded as by NewEndpointTLS.
+func NewPeerTLS(cfg EndpointTLS) (*tls.Config, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	certs := &endpointCerts{cfg: cfg}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		GetClientCertificate: certs.clientCertificate,
+		// The peers are verified by verifyServer against the latest CA
+		// instead of a pool fixed at creation
+		InsecureSkipVerify: true,
+		VerifyConnection:   certs.verifyServer,
+	}, nil
+}
+
+func (c *endpointCerts) files() []string {
+	files := []string{c.cfg.CertFile, c.cfg.KeyFile}
+	if c.cfg.ClientCAFile != "" {
+		files = append(files, c.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// load loads the certificates if their files changed since they were loaded
+func (c *endpointCerts) load() error {
+	c.Lock()
+	defer c.Unlock()
+
+	modTimes := make(map[string]time.Time)
+	changed := c.cert == nil
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+		changed = changed || !info.ModTime().Equal(c.modTimes[file])
+	}
+	if !changed {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate of the endpoints: %w", err)
+	}
+
+	var clientCA *x509.CertPool
+	if c.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to load the client CA: %w", err)
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate in the client CA %s", c.cfg.ClientCAFile)
+		}
+	}
+
+	if c.cert != nil {
+		log.WithField("cert", c.cfg.CertFile).Info("reloaded the certificates of the endpoints")
+	}
+	c.cert, c.clientCA, c.modTimes = &cert, clientCA, modTimes
+
+	return nil
+}
+
+// configForClient returns the config of a handshake with the latest certificates
+func (c *endpointCerts) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if err := c.load(); err != nil {
+		log.WithError(err).Error("failed to reload the certificates of the endpoints, keeping the previous ones")
+	}
+
+	c.Lock()
+	cert, clientCA := c.cert, c.clientCA
+	c.Unlock()
+
+	peer := "unknown"
+	if hello.Conn != nil {
+		peer = hello.Conn.RemoteAddr().String()
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cert},
+		// The endpoints serve HTTP/1.1 and gRPC over HTTP/2
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if clientCA != nil {
+		// The client certificates are verified here rather than by the TLS
+		// stack so that the rejected clients are logged with their identity
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyClient(peer, clientCA, rawCerts)
+		}
+	}
+
+	return cfg, nil
+}
+
+// verifyClient verifies the certificate chain presented by a client
+func (c *endpointCerts) verifyClient(peer string, clientCA *x509.CertPool, rawCerts [][]byte) error {
+	logger := log.WithField("peer", peer)
+
+	if len(rawCerts) == 0 {
+		if !c.cfg.RequireClientCert {
+			return nil
+		}
+		logger.Warn("rejected client without a certificate")
+		return errors.New("client certificate required")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			logger.WithError(err).Warn("rejected client with an invalid certificate")
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	logger = logger.WithField("subject", certs[0].Subject.String())
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         clientCA,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		logger.WithError(err).Warn("rejected client with an untrusted certificate")
+		return err
+	}
+	logger.Debug("authenticated client")
+
+	return nil
+}
+
+// clientCertificate returns the latest certificate presented to the peers
+func (c *endpointCerts) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if err := c.load(); err != nil {
+		log.WithError(err).Error("failed to reload the certificates of the endpoints, keeping the previous ones")
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.cert, nil
+}
+
+// verifyServer verifies the certificate chain presented by a peer for its address
+func (c *endpointCerts) verifyServer(cs tls.ConnectionState) error {
+	logger := log.WithField("peer", cs.ServerName)
+
+	c.Lock()
+	roots := c.clientCA
+	c.Unlock()
+
+	if roots == nil {
+		var err error
+		if roots, err = x509.SystemCertPool(); err != nil {
+			return fmt.Errorf("failed to load the system roots: %w", err)
+		}
+	}
+
+	if len(cs.PeerCertificates) == 0 {
+		logger.Warn("rejected peer without a certificate")
+		return errors.New("peer certificate required")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	logger = logger.WithField("subject", cs.PeerCertificates[0].Subject.String())
+	if _, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		logger.WithError(err).Warn("rejected peer with an untrusted certificate")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/cri/fakes"
+	peerpb "github.com/ease-lab/vhive/cri/proto"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// testCert is a self-signed or CA-signed test certificate
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+var testSerial int64
+
+// newTestCert returns a certificate of cn signed by ca, self-signed if ca is nil
+func newTestCert(t *testing.T, cn string, ca *testCert, usages ...x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		tmpl.ExtKeyUsage = usages
+	}
+
+	parent, signer := tmpl, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		tls:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert},
+	}
+}
+
+// write writes the certificate and its key in dir, returning their paths
+func (c *testCert) write(t *testing.T, dir, name string, modTime time.Time) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	return certFile, keyFile
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// endpointTLSFixture is a CA, a server certificate and a client certificate
+// of the CA on disk, with an HTTP endpoint served with their TLS config
+type endpointTLSFixture struct {
+	dir    string
+	ca     *testCert
+	server *testCert
+	client *testCert
+	cfg    EndpointTLS
+	addr   string
+}
+
+func newEndpointTLSFixture(t *testing.T, requireClientCert bool) *endpointTLSFixture {
+	f := &endpointTLSFixture{dir: t.TempDir()}
+	f.ca = newTestCert(t, "test-ca", nil)
+	f.server = newTestCert(t, "vhive", f.ca, x509.ExtKeyUsageServerAuth)
+	f.client = newTestCert(t, "operator", f.ca, x509.ExtKeyUsageClientAuth)
+
+	f.cfg.CertFile, f.cfg.KeyFile = f.server.write(t, f.dir, "server", time.Now().Add(-time.Minute))
+	f.cfg.ClientCAFile, _ = f.ca.write(t, f.dir, "ca", time.Now())
+	f.cfg.RequireClientCert = requireClientCert
+
+	tlsConfig, err := NewEndpointTLS(f.cfg)
+	require.NoError(t, err, "invalid TLS config")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}),
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		_ = srv.ServeTLS(lis, "", "")
+	}()
+	t.Cleanup(func() { srv.Close() })
+	f.addr = lis.Addr().String()
+
+	return f
+}
+
+// get requests the endpoint with the client certificates, returning the
+// certificate presented by the endpoint
+func (f *endpointTLSFixture) get(clientCerts ...tls.Certificate) (*x509.Certificate, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      f.ca.pool(),
+		Certificates: clientCerts,
+	}}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + f.addr + "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return resp.TLS.PeerCertificates[0], nil
+}
+
+// requireLogged requires an entry of the message with the given fields
+func requireLogged(t *testing.T, hook *logtest.Hook, msg string, fields logrus.Fields) {
+	t.Helper()
+
+	for _, entry := range hook.AllEntries() {
+		if entry.Message != msg {
+			continue
+		}
+		for k, v := range fields {
+			require.Equal(t, v, entry.Data[k], "wrong %s logged", k)
+		}
+		require.NotEmpty(t, entry.Data["peer"], "peer was not logged")
+		return
+	}
+	t.Fatalf("%q was not logged", msg)
+}
+
+func TestEndpointTLSClientCert(t *testing.T) {
+	f := newEndpointTLSFixture(t, true)
+
+	cert, err := f.get(f.client.tls)
+	require.NoError(t, err, "client with a certificate of the CA was rejected")
+	require.Equal(t, "vhive", cert.Subject.CommonName)
+
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	_, err = f.get()
+	require.Error(t, err, "client without a certificate was accepted")
+	requireLogged(t, hook, "rejected client without a certificate", nil)
+
+	untrusted := newTestCert(t, "intruder", nil)
+	_, err = f.get(untrusted.tls)
+	require.Error(t, err, "client with an untrusted certificate was accepted")
+	requireLogged(t, hook, "rejected client with an untrusted certificate", logrus.Fields{"subject": "CN=intruder"})
+}
+
+func TestEndpointTLSOptionalClientCert(t *testing.T) {
+	f := newEndpointTLSFixture(t, false)
+
+	_, err := f.get()
+	require.NoError(t, err, "client without a certificate was rejected")
+	_, err = f.get(f.client.tls)
+	require.NoError(t, err, "client with a certificate of the CA was rejected")
+	_, err = f.get(newTestCert(t, "intruder", nil).tls)
+	require.Error(t, err, "client with an untrusted certificate was accepted")
+}
+
+func TestEndpointTLSRotation(t *testing.T) {
+	f := newEndpointTLSFixture(t, true)
+
+	cert, err := f.get(f.client.tls)
+	require.NoError(t, err)
+	require.Equal(t, f.server.cert.SerialNumber, cert.SerialNumber)
+
+	// The rotated certificate is served from the next handshake
+	rotated := newTestCert(t, "vhive", f.ca, x509.ExtKeyUsageServerAuth)
+	rotated.write(t, f.dir, "server", time.Now())
+
+	cert, err = f.get(f.client.tls)
+	require.NoError(t, err, "client was rejected after the rotation")
+	require.Equal(t, rotated.cert.SerialNumber, cert.SerialNumber, "rotated certificate was not reloaded")
+
+	// An invalid certificate keeps the previous one
+	require.NoError(t, ioutil.WriteFile(f.cfg.CertFile, []byte("garbage"), 0600))
+	require.NoError(t, os.Chtimes(f.cfg.CertFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+
+	cert, err = f.get(f.client.tls)
+	require.NoError(t, err, "invalid certificate broke the endpoint")
+	require.Equal(t, rotated.cert.SerialNumber, cert.SerialNumber, "previous certificate was not kept")
+}
+
+func TestEndpointTLSAdmin(t *testing.T) {
+	f := newEndpointTLSFixture(t, true)
+	s := newTestService(nil, fakes.NewOrchestrator())
+
+	tlsConfig, err := NewEndpointTLS(f.cfg)
+	require.NoError(t, err)
+
+	sockPath := filepath.Join(t.TempDir(), "admin.sock")
+	lis, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	s.RegisterAdmin(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	list := func(clientCerts ...tls.Certificate) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		creds := credentials.NewTLS(&tls.Config{RootCAs: f.ca.pool(), Certificates: clientCerts, ServerName: "localhost"})
+		conn, err := grpc.DialContext(ctx, "unix://"+sockPath, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, err = adminpb.NewAdminClient(conn).ListInstances(ctx, &adminpb.ListInstancesReq{})
+		return err
+	}
+
+	require.NoError(t, list(f.client.tls), "client with a certificate of the CA was rejected")
+	require.Error(t, list(), "client without a certificate was accepted")
+}
+
+func TestEndpointTLSSnapshotPeers(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	// The nodes serve their peers and pull the snapshots of the others with the same certificate
+	node := func(name string, ca *testCert) EndpointTLS {
+		cert := newTestCert(t, name, ca, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)
+		cfg := EndpointTLS{RequireClientCert: true}
+		cfg.CertFile, cfg.KeyFile = cert.write(t, dir, name, time.Now())
+		cfg.ClientCAFile, _ = ca.write(t, dir, name+"-ca", time.Now())
+		return cfg
+	}
+
+	serverTLS, err := NewEndpointTLS(node("node1", ca))
+	require.NoError(t, err)
+
+	snapFile := filepath.Join(dir, "snap_file")
+	require.NoError(t, ioutil.WriteFile(snapFile, []byte("snapshot"), 0600))
+	holder := newSnapshotPeer("", 0, nil)
+	holder.announce("rev1/1/snap_file", snapFile)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	peerpb.RegisterSnapshotPeerServer(server, holder)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	fetch := func(tlsConfig *tls.Config) error {
+		return newSnapshotPeer("", 0, tlsConfig).fetch(context.Background(), lis.Addr().String(), "rev1/1/snap_file", filepath.Join(t.TempDir(), "snap_file"))
+	}
+
+	peerTLS, err := NewPeerTLS(node("node2", ca))
+	require.NoError(t, err)
+	require.NoError(t, fetch(peerTLS), "node with a certificate of the CA failed to pull")
+
+	require.Error(t, fetch(nil), "plaintext peer was served")
+
+	intruderTLS, err := NewPeerTLS(node("intruder", newTestCert(t, "intruder-ca", nil)))
+	require.NoError(t, err)
+	require.Error(t, fetch(intruderTLS), "node of another CA was served or trusted the node")
+}
+
+func TestEndpointTLSMisconfigured(t *testing.T) {
+	f := newEndpointTLSFixture(t, true)
+
+	for name, cfg := range map[string]EndpointTLS{
+		"MissingKey":        {CertFile: f.cfg.CertFile},
+		"MissingClientCA":   {CertFile: f.cfg.CertFile, KeyFile: f.cfg.KeyFile, RequireClientCert: true},
+		"MissingCertFile":   {CertFile: filepath.Join(f.dir, "missing.crt"), KeyFile: f.cfg.KeyFile},
+		"MismatchedKey":     {CertFile: f.cfg.CertFile, KeyFile: filepath.Join(f.dir, "ca.key")},
+		"InvalidClientCA":   {CertFile: f.cfg.CertFile, KeyFile: f.cfg.KeyFile, ClientCAFile: f.cfg.KeyFile},
+		"OnlyRequireClient": {RequireClientCert: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.True(t, cfg.Enabled(), "TLS was not enabled")
+			_, err := NewEndpointTLS(cfg)
+			require.Error(t, err, "invalid config was accepted")
+		})
+	}
+
+	require.False(t, EndpointTLS{}.Enabled(), "TLS was enabled without a config")
+}
@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// isOutOfMemory returns true if the VM failed to start because the host
+// does not have enough memory for it
+func isOutOfMemory(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Cause(err) == syscall.ENOMEM || status.Code(errors.Cause(err)) == codes.ResourceExhausted {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "cannot allocate memory") || strings.Contains(msg, "out of memory")
+}
+
+// errNoInstance is returned for the requests to a container without a VM
+var errNoInstance = errors.New("container has no VM")
+
+// trackInvocation marks the start of a request to the VM of the container,
+// returning the function that marks its end, or false if the container has no VM
+// or its VM is draining
+func (c *coordinator) trackInvocation(containerID string) (func(), bool) {
+	done, err := c.admitInvocation(containerID)
+	return done, err == nil
+}
+
+// admitInvocation marks the start of a request to the VM of the container,
+// returning the function that marks its end. It returns ErrInstanceDraining
+// if the container is stopping, and errNoInstance if the container has no VM.
+func (c *coordinator) admitInvocation(containerID string) (func(), error) {
+	c.Lock()
+	defer c.Unlock()
+
+	fi, ok := c.activeInstances[containerID]
+	if !ok {
+		return nil, errNoInstance
+	}
+	if fi.isDraining() {
+		return nil, ErrInstanceDraining
+	}
+
+	// under the lock, so that the VM is not picked for eviction in the meantime
+	fi.beginInvocation()
+
+	return func() {
+		fi.endInvocation()
+		fi.onceEndCPUBoost.Do(func() { c.endCPUBoost(fi) })
+	}, nil
+}
+
+// evictLRU frees the least-recently-used active VM without requests in flight,
+// other than the VM with the excluded ID, by offloading or stopping it.
+// It returns false if there was no VM to evict.
+func (c *coordinator) evictLRU(ctx context.Context, excludeVMID string) bool {
+	c.Lock()
+
+	var (
+		victimID string
+		victim   *funcInstance
+	)
+
+	for containerID, fi := range c.activeInstances {
+		if fi.vmID == excludeVMID || fi.isServing() {
+			continue
+		}
+
+		if victim == nil || fi.getLastInvocation().Before(victim.getLastInvocation()) {
+			victimID, victim = containerID, fi
+		}
+	}
+
+	if victim != nil {
+		delete(c.activeInstances, victimID)
+	}
+
+	c.Unlock()
+
+	if victim == nil {
+		return false
+	}
+
+	victim.logger.WithField("containerID", victimID).Warn("evicting least-recently-used VM under memory pressure")
+
+	// The eviction is attributed to vHive rather than to the pod whose VM needs the memory
+	ctx = context.WithValue(ctx, auditSourceKey{}, auditSource{actor: AuditActorVhive})
+	if err := c.releaseVM(ctx, victim); err != nil {
+		victim.logger.WithError(err).Error("failed to evict VM")
+	}
+
+	return true
+}
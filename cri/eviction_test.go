@@ -0,0 +1,134 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsOutOfMemory(t *testing.T) {
+	require.True(t, isOutOfMemory(status.Error(codes.ResourceExhausted, "no hugepages left")))
+	require.True(t, isOutOfMemory(errors.New("failed to create VM: Cannot allocate memory")))
+	require.False(t, isOutOfMemory(errInjected))
+	require.False(t, isOutOfMemory(nil))
+}
+
+func TestEvictionUnderMemoryPressure(t *testing.T) {
+	startActive := func(t *testing.T, c *coordinator, n int) {
+		for i := 1; i <= n; i++ {
+			fi, err := c.startVM(context.Background(), "img")
+			require.NoError(t, err, "could not start VM")
+			require.NoError(t, c.insertActive("pod", "ctr"+strconv.Itoa(i), fi), "could not insert mapping")
+		}
+	}
+
+	t.Run("EvictsLRU", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.MaxRunning = 3
+		c := newCoordinator(orch)
+		c.evictionEnabled = true
+
+		startActive(t, c, 3)
+
+		// ctr1 serves a request, ctr3 was invoked after ctr2 so ctr2 is the LRU
+		done, ok := c.trackInvocation("ctr1")
+		require.True(t, ok)
+		defer done()
+		time.Sleep(time.Millisecond)
+		done3, ok := c.trackInvocation("ctr3")
+		require.True(t, ok)
+		done3()
+
+		fi, err := c.startVM(context.Background(), "img")
+		require.NoError(t, err, "VM was not started after eviction")
+		require.Equal(t, "4", fi.vmID)
+
+		require.False(t, c.isActive("ctr2"), "LRU VM was not evicted")
+		require.True(t, c.isActive("ctr1"), "VM with requests in flight was evicted")
+		require.True(t, c.isActive("ctr3"), "more than one VM was evicted")
+		require.Equal(t, 1, orch.NumStopped("2"), "LRU VM was not stopped")
+		require.Equal(t, 0, orch.NumStopped("1")+orch.NumStopped("3"))
+	})
+
+	t.Run("NothingToEvict", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.MaxRunning = 1
+		c := newCoordinator(orch)
+		c.evictionEnabled = true
+
+		startActive(t, c, 1)
+		done, ok := c.trackInvocation("ctr1")
+		require.True(t, ok)
+		defer done()
+
+		_, err := c.startVM(context.Background(), "img")
+		require.Error(t, err, "VM was started beyond the memory limit")
+		require.True(t, c.isActive("ctr1"), "VM with requests in flight was evicted")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.MaxRunning = 1
+		c := newCoordinator(orch)
+
+		startActive(t, c, 1)
+
+		_, err := c.startVM(context.Background(), "img")
+		require.Error(t, err, "VM was started beyond the memory limit")
+		require.True(t, c.isActive("ctr1"), "VM was evicted with eviction disabled")
+	})
+}
+
+func TestCPUBoostEndsOnFirstResponse(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	c := newCoordinator(orch)
+
+	boosted, err := c.startVM(context.Background(), "img", ctriface.WithCPUBoost(2, time.Minute))
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", boosted), "could not insert mapping")
+
+	plain, err := c.startVM(context.Background(), "img")
+	require.NoError(t, err, "could not start VM")
+	require.NoError(t, c.insertActive("pod", "ctr2", plain), "could not insert mapping")
+
+	for i := 0; i < 3; i++ {
+		for _, containerID := range []string{"ctr1", "ctr2"} {
+			done, ok := c.trackInvocation(containerID)
+			require.True(t, ok)
+			done()
+		}
+	}
+
+	require.Equal(t, 1, orch.BoostEnded["1"], "boost was not ended exactly once")
+	require.Zero(t, orch.BoostEnded["2"], "boost of an unboosted VM was ended")
+}
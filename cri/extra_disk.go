@@ -0,0 +1,268 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/pkg/errors"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	extraDiskSizeAnnotation  = "vhive.io/extra-disk-size-gib"
+	extraDiskClaimAnnotation = "vhive.io/extra-disk-claim"
+	extraDiskPathAnnotation  = "vhive.io/extra-disk-path"
+
+	defaultExtraDiskDir   = "/var/lib/vhive/disks"
+	defaultExtraDiskClaim = "default"
+	defaultExtraDiskPath  = "/data"
+	extraDiskVMPath       = "/vhive/extra-disk"
+	maxExtraDiskSizeGiB   = 1024
+)
+
+// DiskCleanupPolicy defines what happens to an extra disk when its VM is stopped
+type DiskCleanupPolicy string
+
+const (
+	// DiskCleanupDelete deletes the extra disk with its VM
+	DiskCleanupDelete DiskCleanupPolicy = "delete"
+	// DiskCleanupRetain keeps the extra disk for the next VM of the same revision and claim
+	DiskCleanupRetain DiskCleanupPolicy = "retain"
+)
+
+// extraDisk is a sparse ext4 image attached to a VM as a second drive
+type extraDisk struct {
+	path          string
+	containerPath string
+}
+
+// diskManager creates the extra disks of the VMs, keyed by revision and claim,
+// making sure that a disk is attached to at most one VM at a time
+type diskManager struct {
+	sync.Mutex
+
+	dir    string
+	policy DiskCleanupPolicy
+	inUse  map[string]bool
+}
+
+func newDiskManager(dir string, policy DiskCleanupPolicy) *diskManager {
+	return &diskManager{
+		dir:    dir,
+		policy: policy,
+		inUse:  make(map[string]bool),
+	}
+}
+
+// extraDiskSpec is the extra disk requested by the annotations of a user container
+type extraDiskSpec struct {
+	sizeGiB       uint64
+	claim         string
+	containerPath string
+}
+
+// getExtraDisk returns the extra disk requested by the annotations of
+// the user container, nil if no disk is requested
+func getExtraDisk(revision string, r *criapi.CreateContainerRequest) (*extraDiskSpec, error) {
+	annotations := getAnnotations(r)
+
+	sizeStr, ok := annotations[extraDiskSizeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	sizeGiB, err := strconv.ParseUint(sizeStr, 10, 32)
+	if err != nil || sizeGiB == 0 || sizeGiB > maxExtraDiskSizeGiB {
+		return nil, errors.Errorf("invalid %s annotation %q", extraDiskSizeAnnotation, sizeStr)
+	}
+
+	spec := &extraDiskSpec{
+		sizeGiB:       sizeGiB,
+		claim:         defaultExtraDiskClaim,
+		containerPath: defaultExtraDiskPath,
+	}
+	if c, ok := annotations[extraDiskClaimAnnotation]; ok {
+		spec.claim = c
+	}
+	if p, ok := annotations[extraDiskPathAnnotation]; ok {
+		spec.containerPath = p
+	}
+
+	if err := validateDiskName(revision); err != nil {
+		return nil, errors.Wrap(err, "invalid revision")
+	}
+	if err := validateDiskName(spec.claim); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s annotation", extraDiskClaimAnnotation)
+	}
+	if !filepath.IsAbs(spec.containerPath) {
+		return nil, errors.Errorf("invalid %s annotation %q, must be an absolute path", extraDiskPathAnnotation, spec.containerPath)
+	}
+
+	return spec, nil
+}
+
+// acquire creates or reuses the extra disk requested by the annotations of
+// the user container, returning nil if no disk is requested
+func (m *diskManager) acquire(revision string, r *criapi.CreateContainerRequest) (_ *extraDisk, retErr error) {
+	spec, err := getExtraDisk(revision, r)
+	if spec == nil || err != nil {
+		return nil, err
+	}
+
+	d := &extraDisk{
+		path:          filepath.Join(m.dir, revision, spec.claim+".ext4"),
+		containerPath: spec.containerPath,
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.inUse[d.path] {
+		return nil, errors.Errorf("extra disk %s of revision %s is attached to another VM", spec.claim, revision)
+	}
+
+	if err := createExtraDisk(d.path, spec.sizeGiB); err != nil {
+		return nil, err
+	}
+
+	m.inUse[d.path] = true
+
+	return d, nil
+}
+
+// release detaches the disk, deleting it unless the policy is to retain disks.
+// It is a no-op for a nil disk.
+func (m *diskManager) release(d *extraDisk) error {
+	if d == nil {
+		return nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.inUse, d.path)
+
+	if m.policy == DiskCleanupRetain {
+		return nil
+	}
+
+	if err := os.Remove(d.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Remove the revision directory once its last disk is gone
+	if err := os.Remove(filepath.Dir(d.path)); err != nil && !os.IsNotExist(err) {
+		coordLog.WithError(err).Debug("revision disk directory is not empty")
+	}
+
+	return nil
+}
+
+// vmOption returns the option to attach the disk to a VM
+func (d *extraDisk) vmOption() ctriface.StartVMOption {
+	return ctriface.WithDriveMount(ctriface.DriveMount{
+		HostPath:      d.path,
+		VMPath:        extraDiskVMPath,
+		ContainerPath: d.containerPath,
+	})
+}
+
+// createExtraDisk creates a sparse ext4 image of the given size,
+// reusing the existing image at path
+func createExtraDisk(path string, sizeGiB uint64) error {
+	if fi, err := os.Stat(path); err == nil {
+		if size := uint64(fi.Size()); size != sizeGiB<<30 {
+			coordLog.Warnf("reusing extra disk %s of %d GiB instead of the requested %d GiB", path, size>>30, sizeGiB)
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "failed to create extra disk directory")
+	}
+
+	// The image is created aside so that a failure never leaves a half-formatted disk to be reused
+	tmpPath := path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to create extra disk")
+	}
+	err = f.Truncate(int64(sizeGiB << 30))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to size extra disk")
+	}
+
+	out, err := exec.Command("mkfs.ext4",
+		"-q", "-F",
+		"-E", "lazy_itable_init=1,lazy_journal_init=1",
+		tmpPath,
+	).CombinedOutput()
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to format extra disk: %s", strings.TrimSpace(string(out)))
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to create extra disk")
+	}
+
+	return nil
+}
+
+// validateDiskName checks that name can be used as a path component
+func validateDiskName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return errors.Errorf("%q is not a valid name", name)
+	}
+
+	return nil
+}
+
+// getAnnotations returns the annotations of the container, which override those of the pod
+func getAnnotations(r *criapi.CreateContainerRequest) map[string]string {
+	annotations := make(map[string]string)
+
+	for k, v := range r.GetSandboxConfig().GetAnnotations() {
+		annotations[k] = v
+	}
+	for k, v := range r.GetConfig().GetAnnotations() {
+		annotations[k] = v
+	}
+
+	return annotations
+}
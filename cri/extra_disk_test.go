@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newExtraDiskRequest(annotations map[string]string) *criapi.CreateContainerRequest {
+	r := newUserContainerRequest("pod", "img")
+	r.SandboxConfig = &criapi.PodSandboxConfig{Annotations: annotations}
+
+	return r
+}
+
+// writeDiskMarker writes a file into the filesystem of the disk
+func writeDiskMarker(t *testing.T, disk string) {
+	src := filepath.Join(t.TempDir(), "marker")
+	require.NoError(t, ioutil.WriteFile(src, []byte("state"), 0644))
+
+	out, err := exec.Command("debugfs", "-w", "-R", "write "+src+" marker", disk).CombinedOutput()
+	require.NoError(t, err, "failed to write marker: %s", out)
+}
+
+func diskHasMarker(t *testing.T, disk string) bool {
+	out, err := exec.Command("debugfs", "-R", "cat marker", disk).Output()
+	require.NoError(t, err, "failed to read marker")
+
+	return string(out) == "state"
+}
+
+func TestExtraDiskCreate(t *testing.T) {
+	requireExt4Tools(t)
+
+	m := newDiskManager(t.TempDir(), DiskCleanupDelete)
+
+	d, err := m.acquire("rev1", newExtraDiskRequest(map[string]string{extraDiskSizeAnnotation: "2"}))
+	require.NoError(t, err, "failed to acquire disk")
+	require.NotNil(t, d, "disk was not created")
+
+	require.Equal(t, filepath.Join(m.dir, "rev1", defaultExtraDiskClaim+".ext4"), d.path)
+	require.Equal(t, defaultExtraDiskPath, d.containerPath)
+
+	fi, err := os.Stat(d.path)
+	require.NoError(t, err, "disk does not exist")
+	require.EqualValues(t, 2<<30, fi.Size(), "wrong disk size")
+
+	// Sparse image
+	st := fi.Sys().(*syscall.Stat_t)
+	require.Less(t, st.Blocks*512, fi.Size()/10, "disk is not sparse")
+
+	out, err := exec.Command("debugfs", "-R", "stats", d.path).CombinedOutput()
+	require.NoError(t, err, "disk is not an ext4 filesystem: %s", out)
+}
+
+func TestExtraDiskNotRequested(t *testing.T) {
+	m := newDiskManager(t.TempDir(), DiskCleanupDelete)
+
+	d, err := m.acquire("rev1", newExtraDiskRequest(nil))
+	require.NoError(t, err)
+	require.Nil(t, d, "disk was created without the annotation")
+	require.NoError(t, m.release(d), "failed to release nil disk")
+}
+
+func TestExtraDiskInvalid(t *testing.T) {
+	m := newDiskManager(t.TempDir(), DiskCleanupDelete)
+
+	for _, annotations := range []map[string]string{
+		{extraDiskSizeAnnotation: "0"},
+		{extraDiskSizeAnnotation: "-1"},
+		{extraDiskSizeAnnotation: "lots"},
+		{extraDiskSizeAnnotation: "1", extraDiskClaimAnnotation: "../escape"},
+		{extraDiskSizeAnnotation: "1", extraDiskPathAnnotation: "relative"},
+	} {
+		_, err := m.acquire("rev1", newExtraDiskRequest(annotations))
+		require.Error(t, err, "invalid annotations %v were accepted", annotations)
+	}
+}
+
+func TestExtraDiskReuse(t *testing.T) {
+	requireExt4Tools(t)
+
+	m := newDiskManager(t.TempDir(), DiskCleanupRetain)
+	r := newExtraDiskRequest(map[string]string{
+		extraDiskSizeAnnotation:  "1",
+		extraDiskClaimAnnotation: "cache",
+		extraDiskPathAnnotation:  "/var/cache",
+	})
+
+	d, err := m.acquire("rev1", r)
+	require.NoError(t, err, "failed to acquire disk")
+	require.Equal(t, "/var/cache", d.containerPath)
+	writeDiskMarker(t, d.path)
+
+	_, err = m.acquire("rev1", r)
+	require.Error(t, err, "disk was attached to two VMs")
+
+	other, err := m.acquire("rev2", r)
+	require.NoError(t, err, "failed to acquire disk of another revision")
+	require.NotEqual(t, d.path, other.path, "revisions share a disk")
+	require.False(t, diskHasMarker(t, other.path), "disk of another revision has the state")
+
+	// VM restart
+	require.NoError(t, m.release(d), "failed to release disk")
+	require.FileExists(t, d.path, "retained disk was deleted")
+
+	again, err := m.acquire("rev1", r)
+	require.NoError(t, err, "failed to reacquire disk")
+	require.Equal(t, d.path, again.path, "disk was not reused")
+	require.True(t, diskHasMarker(t, again.path), "disk state was lost")
+}
+
+func TestExtraDiskDelete(t *testing.T) {
+	requireExt4Tools(t)
+
+	m := newDiskManager(t.TempDir(), DiskCleanupDelete)
+	r := newExtraDiskRequest(map[string]string{extraDiskSizeAnnotation: "1"})
+
+	d, err := m.acquire("rev1", r)
+	require.NoError(t, err, "failed to acquire disk")
+	writeDiskMarker(t, d.path)
+
+	require.NoError(t, m.release(d), "failed to release disk")
+	require.NoFileExists(t, d.path, "disk was not deleted")
+	require.NoDirExists(t, filepath.Dir(d.path), "revision directory was not deleted")
+
+	again, err := m.acquire("rev1", r)
+	require.NoError(t, err, "failed to acquire disk")
+	require.False(t, diskHasMarker(t, again.path), "deleted disk was reused")
+}
+
+func TestCreateUserContainerExtraDisk(t *testing.T) {
+	requireExt4Tools(t)
+
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.disks = newDiskManager(t.TempDir(), DiskCleanupDelete)
+
+	resp, err := s.CreateContainer(context.Background(), newExtraDiskRequest(map[string]string{extraDiskSizeAnnotation: "1"}))
+	require.NoError(t, err, "container creation failed")
+
+	mounts := orch.StartOpts["1"].DriveMounts
+	require.Len(t, mounts, 1, "disk was not passed to the orchestrator")
+	require.Equal(t, extraDiskVMPath, mounts[0].VMPath)
+	require.Equal(t, defaultExtraDiskPath, mounts[0].ContainerPath)
+	require.False(t, mounts[0].ReadOnly)
+	require.FileExists(t, mounts[0].HostPath)
+
+	require.NoError(t, s.coordinator.stopVM(context.Background(), resp.GetContainerId()))
+	require.NoFileExists(t, mounts[0].HostPath, "disk was not deleted with the VM")
+}
+
+func TestCreateUserContainerExtraDiskFailedStop(t *testing.T) {
+	requireExt4Tools(t)
+
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.disks = newDiskManager(t.TempDir(), DiskCleanupDelete)
+
+	resp, err := s.CreateContainer(context.Background(), newExtraDiskRequest(map[string]string{extraDiskSizeAnnotation: "1"}))
+	require.NoError(t, err, "container creation failed")
+	disk := orch.StartOpts["1"].DriveMounts[0].HostPath
+
+	orch.StopErr = errInjected
+	err = s.coordinator.stopVM(context.Background(), resp.GetContainerId())
+	require.True(t, errors.Is(err, errInjected), "failed stop was not returned: %v", err)
+	require.NoFileExists(t, disk, "disk of the VM that failed to stop was not deleted")
+	require.False(t, s.coordinator.disks.inUse[disk], "disk of the VM that failed to stop is still attached")
+}
@@ -0,0 +1,441 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package fakes holds the in-process stand-ins of the orchestrator of the VMs
+// and of the stock containerd CRI services that the CRI service of vHive is
+// injected with in tests.
+package fakes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+)
+
+// Orchestrator stands in for the ctriface.Orchestrator, recording the VMs it
+// is asked to start and stop
+type Orchestrator struct {
+	sync.Mutex
+
+	StartErr error
+	// StopErr fails the stops of the VMs, which are then left running
+	StopErr          error
+	BootDelay        time.Duration
+	SnapshotsEnabled bool
+	// MaxRunning simulates memory pressure by failing to start more VMs, 0 for no limit
+	MaxRunning int
+	VsockPath  string
+	// GuestIP is the IP of all the VMs if set, e.g., of a fake guest
+	GuestIP string
+	Started map[string]int
+	// Prepared counts the VMs prepared to restore a snapshot of another node
+	Prepared   map[string]int
+	Stopped    map[string]int
+	Restarted  map[string]int
+	StartOpts  map[string]*ctriface.StartVMOptions
+	BoostEnded map[string]int
+	// Images simulates the images on the node if set, otherwise all images are
+	Images map[string]bool
+	Pulled map[string]int
+	// RootfsDigest is the digest of the rootfs of all the images
+	RootfsDigest string
+	// SnapshotDir holds the snapshot files of the VMs if set, which
+	// are then written by CreateSnapshot and required by LoadSnapshot
+	SnapshotDir string
+	// exits receive the exit of the task of each running VM
+	exits map[string]chan ctriface.VMExit
+	// Resources are the updates of the resources of the VMs, rejected with UpdateErr if set
+	Resources map[string][]ctriface.VMResources
+	UpdateErr error
+	// Cancelled counts the starts cancelled during their boot
+	Cancelled int
+	// Live are the VMs running without having been started, e.g., by a previous daemon
+	Live map[string]bool
+	// WorkingSetCorruptions are the corrupt working set files found by the memory manager
+	WorkingSetCorruptions uint64
+	// PrefetchedPages and MissedPages are the pages of the working sets
+	// prefetched and missed by the memory manager
+	PrefetchedPages, MissedPages uint64
+	// WorkingSetWaits counts the waits for the working set of each VM, which
+	// block until WorkingSetInstalled is closed if it is set
+	WorkingSetWaits     map[string]int
+	WorkingSetInstalled chan struct{}
+	// VMStats are the resource usage of the VMs, which is unknown for the others
+	VMStats map[string]*ctriface.VMStats
+}
+
+// NewOrchestrator returns an orchestrator that runs no VMs
+func NewOrchestrator() *Orchestrator {
+	return &Orchestrator{
+		Started:    make(map[string]int),
+		Prepared:   make(map[string]int),
+		Stopped:    make(map[string]int),
+		Restarted:  make(map[string]int),
+		StartOpts:  make(map[string]*ctriface.StartVMOptions),
+		BoostEnded: make(map[string]int),
+		Pulled:     make(map[string]int),
+		exits:      make(map[string]chan ctriface.VMExit),
+		Resources:  make(map[string][]ctriface.VMResources),
+
+		WorkingSetWaits: make(map[string]int),
+	}
+}
+
+func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	tStart := time.Now()
+	select {
+	case <-ctx.Done():
+		o.Cancelled++
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: ctx.Err()}
+	case <-time.After(o.BootDelay):
+	}
+
+	// The boot delay is spread over the phases of the orchestrator
+	rec := ctriface.NewStartVMOptions(opts...).PhaseRecorder
+	for i, phase := range []metrics.Phase{metrics.PhaseTapSetup, metrics.PhaseImageResolve, metrics.PhaseDevmapper, metrics.PhaseFirecrackerAPI} {
+		rec.MarkAt(phase, tStart.Add(o.BootDelay*time.Duration(i+1)/4))
+	}
+
+	if o.StartErr != nil {
+		return nil, nil, o.StartErr
+	}
+
+	if o.hasVM(vmID) {
+		return nil, nil, fmt.Errorf("VM %s already exists", vmID)
+	}
+
+	if o.MaxRunning > 0 && o.running() >= o.MaxRunning {
+		return nil, nil, errors.New("failed to create VM: cannot allocate memory")
+	}
+
+	startOpts := ctriface.NewStartVMOptions(opts...)
+	if o.Images != nil && !o.Images[imageName] {
+		if startOpts.ImageCached {
+			err := fmt.Errorf("%s: %w", imageName, ctriface.ErrImageNotCached)
+			return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseImage, Err: err}
+		}
+		o.Images[imageName] = true
+	}
+	if !startOpts.ImageCached {
+		o.Pulled[imageName]++
+	}
+	if startOpts.RootfsDigest != "" && startOpts.RootfsDigest != o.RootfsDigest {
+		err := fmt.Errorf("%s: %w", imageName, ctriface.ErrRootfsIntegrity)
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseImage, Err: err}
+	}
+
+	o.Started[vmID]++
+	o.StartOpts[vmID] = startOpts
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.AllocateVM] = metrics.ToUS(o.BootDelay / 4)
+	m.MetricMap[metrics.GetImage] = metrics.ToUS(o.BootDelay / 4)
+
+	return o.newResponse(vmID, imageName), m, nil
+}
+
+// newResponse returns the response of the start of a VM, with the lock held
+func (o *Orchestrator) newResponse(vmID, imageName string) *ctriface.StartVMResponse {
+	guestIP := "190.128.0." + vmID
+	if o.GuestIP != "" {
+		guestIP = o.GuestIP
+	}
+
+	exited := make(chan ctriface.VMExit, 1)
+	o.exits[vmID] = exited
+
+	return &ctriface.StartVMResponse{
+		GuestIP:     guestIP,
+		VsockPath:   o.VsockPath,
+		ImageDigest: "sha256:" + imageName,
+		Exited:      exited,
+	}
+}
+
+// RestartVM leaves the VM as it was if its image is gone from the simulated
+// images, and releases it if the fresh boot fails with StartErr
+func (o *Orchestrator) RestartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if !o.hasVM(vmID) {
+		return nil, nil, fmt.Errorf("VM %s does not exist", vmID)
+	}
+	if o.Images != nil && !o.Images[imageName] {
+		err := fmt.Errorf("%s: %w", imageName, ctriface.ErrImageGone)
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseImage, Err: err}
+	}
+
+	o.exitLocked(vmID, ctriface.VMExit{ExitCode: 137, ExitedAt: time.Now()})
+	if o.StartErr != nil {
+		o.Stopped[vmID]++
+		return nil, nil, o.StartErr
+	}
+
+	o.Restarted[vmID]++
+	o.StartOpts[vmID] = ctriface.NewStartVMOptions(opts...)
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.StopVM] = metrics.ToUS(time.Millisecond)
+
+	return o.newResponse(vmID, imageName), m, nil
+}
+
+func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.StopErr != nil {
+		return o.StopErr
+	}
+
+	o.Stopped[vmID]++
+	o.exitLocked(vmID, ctriface.VMExit{ExitCode: 137, ExitedAt: time.Now()})
+
+	return nil
+}
+
+// Exit simulates the exit of the task of a VM, e.g., after its guest ran out of memory
+func (o *Orchestrator) Exit(vmID string, exit ctriface.VMExit) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.exitLocked(vmID, exit)
+}
+
+func (o *Orchestrator) exitLocked(vmID string, exit ctriface.VMExit) {
+	if exited, ok := o.exits[vmID]; ok {
+		exited <- exit
+		close(exited)
+		delete(o.exits, vmID)
+	}
+}
+
+func (o *Orchestrator) PauseVM(ctx context.Context, vmID string) error {
+	return nil
+}
+
+func (o *Orchestrator) ResumeVM(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.FcResume] = metrics.ToUS(time.Millisecond)
+
+	return m, nil
+}
+
+func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
+	if o.SnapshotDir == "" {
+		return nil
+	}
+
+	snapFile, memFile := o.GetSnapshotFiles(vmID)
+	if err := os.MkdirAll(filepath.Dir(snapFile), 0700); err != nil {
+		return err
+	}
+	for _, file := range []string{snapFile, memFile} {
+		if err := ioutil.WriteFile(file, []byte(filepath.Base(file)), 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	if o.SnapshotDir != "" {
+		snapFile, memFile := o.GetSnapshotFiles(vmID)
+		for _, file := range []string{snapFile, memFile} {
+			if data, err := ioutil.ReadFile(file); err != nil || string(data) != filepath.Base(file) {
+				return nil, fmt.Errorf("invalid snapshot file %s: %v", file, err)
+			}
+		}
+	}
+
+	return metrics.NewMetric(), nil
+}
+
+func (o *Orchestrator) PrepareRestore(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.StartErr != nil {
+		return nil, nil, o.StartErr
+	}
+	if o.hasVM(vmID) {
+		return nil, nil, fmt.Errorf("VM %s already exists", vmID)
+	}
+
+	o.Prepared[vmID]++
+	o.StartOpts[vmID] = ctriface.NewStartVMOptions(opts...)
+
+	return o.newResponse(vmID, imageName), metrics.NewMetric(), nil
+}
+
+func (o *Orchestrator) GetSnapshotFiles(vmID string) (snapFile, memFile string) {
+	return filepath.Join(o.SnapshotDir, vmID, "snap_file"), filepath.Join(o.SnapshotDir, vmID, "mem_file")
+}
+
+func (o *Orchestrator) GetWorkingSetFile(vmID string) string {
+	return filepath.Join(o.SnapshotDir, vmID, "working_set_pages")
+}
+
+func (o *Orchestrator) GetWorkingSetCorruptions() uint64 {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.WorkingSetCorruptions
+}
+
+func (o *Orchestrator) GetWorkingSetPrefetches() (prefetched, missed uint64) {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.PrefetchedPages, o.MissedPages
+}
+
+func (o *Orchestrator) WaitWorkingSet(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	o.Lock()
+	installed := o.WorkingSetInstalled
+	o.Unlock()
+
+	if installed != nil {
+		select {
+		case <-installed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	o.Lock()
+	defer o.Unlock()
+	o.WorkingSetWaits[vmID]++
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.InstallWorkingSet] = metrics.ToUS(time.Millisecond)
+
+	return m, nil
+}
+
+func (o *Orchestrator) GetVMStats(ctx context.Context, vmID string) (*ctriface.VMStats, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	stats, ok := o.VMStats[vmID]
+	if !ok {
+		return nil, fmt.Errorf("firecracker process of VM %s not found", vmID)
+	}
+
+	return stats, nil
+}
+
+func (o *Orchestrator) Offload(ctx context.Context, vmID string) error {
+	return nil
+}
+
+func (o *Orchestrator) UpdateVMResources(ctx context.Context, vmID string, res ctriface.VMResources) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.UpdateErr != nil {
+		return o.UpdateErr
+	}
+	o.Resources[vmID] = append(o.Resources[vmID], res)
+
+	return nil
+}
+
+func (o *Orchestrator) EndCPUBoost(vmID string) (*metrics.Metric, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.BoostEnded[vmID]++
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.CPUBoost] = metrics.ToUS(time.Millisecond)
+
+	return m, nil
+}
+
+func (o *Orchestrator) GetSnapshotsEnabled() bool {
+	return o.SnapshotsEnabled
+}
+
+func (o *Orchestrator) HasVM(vmID string) bool {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.hasVM(vmID)
+}
+
+// hasVM returns whether the VM runs, with the lock held
+func (o *Orchestrator) hasVM(vmID string) bool {
+	return o.Live[vmID] || o.Started[vmID]+o.Prepared[vmID] > o.Stopped[vmID]
+}
+
+// NumStarted returns the number of VMs started
+func (o *Orchestrator) NumStarted() int {
+	o.Lock()
+	defer o.Unlock()
+
+	n := 0
+	for _, cnt := range o.Started {
+		n += cnt
+	}
+
+	return n
+}
+
+// Running returns the number of VMs started and not stopped
+func (o *Orchestrator) Running() int {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.running()
+}
+
+// running returns the number of VMs started and not stopped, with the lock held
+func (o *Orchestrator) running() int {
+	n := 0
+	for vmID, cnt := range o.Started {
+		n += cnt - o.Stopped[vmID]
+	}
+
+	return n
+}
+
+// NumStopped returns the number of times the VM was stopped
+func (o *Orchestrator) NumStopped(vmID string) int {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.Stopped[vmID]
+}
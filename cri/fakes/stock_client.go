@@ -0,0 +1,237 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fakes
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// StockRuntimeClient stands in for the stock containerd CRI runtime service,
+// recording the containers and the sandboxes it is asked to manage
+type StockRuntimeClient struct {
+	sync.Mutex
+
+	CreateErr   error
+	CreateDelay time.Duration
+	VersionErr  error
+
+	nextID uint64
+
+	Created []string
+	Removed []string
+	Stopped []string
+	Started []string
+	Updated []string
+	// StoppedPods are the sandboxes stopped
+	StoppedPods []string
+}
+
+func (c *StockRuntimeClient) CreateContainer(ctx context.Context, r *criapi.CreateContainerRequest, opts ...grpc.CallOption) (*criapi.CreateContainerResponse, error) {
+	if c.CreateErr != nil {
+		return nil, c.CreateErr
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(c.CreateDelay):
+	}
+
+	id := "ctr" + strconv.FormatUint(atomic.AddUint64(&c.nextID, 1), 10)
+
+	c.Lock()
+	c.Created = append(c.Created, id)
+	c.Unlock()
+
+	return &criapi.CreateContainerResponse{ContainerId: id}, nil
+}
+
+func (c *StockRuntimeClient) RemoveContainer(ctx context.Context, r *criapi.RemoveContainerRequest, opts ...grpc.CallOption) (*criapi.RemoveContainerResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Removed = append(c.Removed, r.GetContainerId())
+
+	return &criapi.RemoveContainerResponse{}, nil
+}
+
+func (c *StockRuntimeClient) StopContainer(ctx context.Context, r *criapi.StopContainerRequest, opts ...grpc.CallOption) (*criapi.StopContainerResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Stopped = append(c.Stopped, r.GetContainerId())
+
+	return &criapi.StopContainerResponse{}, nil
+}
+
+func (c *StockRuntimeClient) StartContainer(ctx context.Context, r *criapi.StartContainerRequest, opts ...grpc.CallOption) (*criapi.StartContainerResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Started = append(c.Started, r.GetContainerId())
+
+	return &criapi.StartContainerResponse{}, nil
+}
+
+func (c *StockRuntimeClient) UpdateContainerResources(ctx context.Context, r *criapi.UpdateContainerResourcesRequest, opts ...grpc.CallOption) (*criapi.UpdateContainerResourcesResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Updated = append(c.Updated, r.GetContainerId())
+
+	return &criapi.UpdateContainerResourcesResponse{}, nil
+}
+
+// NumStopped returns the number of containers stopped
+func (c *StockRuntimeClient) NumStopped() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return len(c.Stopped)
+}
+
+// Leaked returns the containers that were created but not removed
+func (c *StockRuntimeClient) Leaked() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	removed := make(map[string]bool, len(c.Removed))
+	for _, id := range c.Removed {
+		removed[id] = true
+	}
+
+	var leaked []string
+	for _, id := range c.Created {
+		if !removed[id] {
+			leaked = append(leaked, id)
+		}
+	}
+
+	return leaked
+}
+
+func (c *StockRuntimeClient) ContainerStatus(ctx context.Context, r *criapi.ContainerStatusRequest, opts ...grpc.CallOption) (*criapi.ContainerStatusResponse, error) {
+	return &criapi.ContainerStatusResponse{
+		Status: &criapi.ContainerStatus{
+			Id:    r.GetContainerId(),
+			State: criapi.ContainerState_CONTAINER_RUNNING,
+		},
+	}, nil
+}
+
+// PlaceholderStats are the stats of all the containers, which are the ones of
+// the placeholder container for the user containers
+func PlaceholderStats(containerID string) *criapi.ContainerStats {
+	return &criapi.ContainerStats{
+		Attributes: &criapi.ContainerAttributes{Id: containerID},
+		Cpu:        &criapi.CpuUsage{Timestamp: 1, UsageCoreNanoSeconds: &criapi.UInt64Value{Value: 1}},
+		Memory:     &criapi.MemoryUsage{Timestamp: 1, WorkingSetBytes: &criapi.UInt64Value{Value: 1}},
+	}
+}
+
+func (c *StockRuntimeClient) ContainerStats(ctx context.Context, r *criapi.ContainerStatsRequest, opts ...grpc.CallOption) (*criapi.ContainerStatsResponse, error) {
+	return &criapi.ContainerStatsResponse{Stats: PlaceholderStats(r.GetContainerId())}, nil
+}
+
+func (c *StockRuntimeClient) ListContainerStats(ctx context.Context, r *criapi.ListContainerStatsRequest, opts ...grpc.CallOption) (*criapi.ListContainerStatsResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	resp := &criapi.ListContainerStatsResponse{}
+	for _, id := range c.Created {
+		resp.Stats = append(resp.Stats, PlaceholderStats(id))
+	}
+
+	return resp, nil
+}
+
+func (c *StockRuntimeClient) RunPodSandbox(ctx context.Context, r *criapi.RunPodSandboxRequest, opts ...grpc.CallOption) (*criapi.RunPodSandboxResponse, error) {
+	return &criapi.RunPodSandboxResponse{PodSandboxId: r.GetConfig().GetMetadata().GetUid()}, nil
+}
+
+func (c *StockRuntimeClient) StopPodSandbox(ctx context.Context, r *criapi.StopPodSandboxRequest, opts ...grpc.CallOption) (*criapi.StopPodSandboxResponse, error) {
+	c.Lock()
+	c.StoppedPods = append(c.StoppedPods, r.GetPodSandboxId())
+	c.Unlock()
+
+	return &criapi.StopPodSandboxResponse{}, nil
+}
+
+func (c *StockRuntimeClient) RemovePodSandbox(ctx context.Context, r *criapi.RemovePodSandboxRequest, opts ...grpc.CallOption) (*criapi.RemovePodSandboxResponse, error) {
+	return &criapi.RemovePodSandboxResponse{}, nil
+}
+
+// PodSandboxStatus reports all the sandboxes ready, without an IP
+func (c *StockRuntimeClient) PodSandboxStatus(ctx context.Context, r *criapi.PodSandboxStatusRequest, opts ...grpc.CallOption) (*criapi.PodSandboxStatusResponse, error) {
+	return &criapi.PodSandboxStatusResponse{
+		Status: &criapi.PodSandboxStatus{
+			Id:    r.GetPodSandboxId(),
+			State: criapi.PodSandboxState_SANDBOX_READY,
+		},
+	}, nil
+}
+
+func (c *StockRuntimeClient) Version(ctx context.Context, r *criapi.VersionRequest, opts ...grpc.CallOption) (*criapi.VersionResponse, error) {
+	if c.VersionErr != nil {
+		return nil, c.VersionErr
+	}
+
+	return &criapi.VersionResponse{
+		Version:           "0.1.0",
+		RuntimeName:       "containerd",
+		RuntimeVersion:    "v1.3.6",
+		RuntimeApiVersion: "v1alpha2",
+	}, nil
+}
+
+// StockImageClient stands in for the stock containerd CRI image service,
+// recording the pulled images
+type StockImageClient struct {
+	sync.Mutex
+
+	pulled []string
+}
+
+func (c *StockImageClient) PullImage(ctx context.Context, r *criapi.PullImageRequest, opts ...grpc.CallOption) (*criapi.PullImageResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.pulled = append(c.pulled, r.GetImage().GetImage())
+
+	return &criapi.PullImageResponse{ImageRef: r.GetImage().GetImage()}, nil
+}
+
+// Pulled returns the images pulled
+func (c *StockImageClient) Pulled() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	return append([]string(nil), c.pulled...)
+}
@@ -0,0 +1,142 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+var errInjected = errors.New("injected failure")
+
+// The fakes stand in for the orchestrator and the stock clients of the service
+var (
+	_ Orchestrator       = (*fakes.Orchestrator)(nil)
+	_ StockRuntimeClient = (*fakes.StockRuntimeClient)(nil)
+	_ StockImageClient   = (*fakes.StockImageClient)(nil)
+)
+
+// fakeSnapshotStore keeps the snapshot files in memory
+type fakeSnapshotStore struct {
+	sync.Mutex
+
+	files  map[string][]byte
+	gets   int
+	putErr error
+}
+
+func newFakeSnapshotStore() *fakeSnapshotStore {
+	return &fakeSnapshotStore{files: make(map[string][]byte)}
+}
+
+func (f *fakeSnapshotStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("read %d bytes of %d", len(data), size)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	if f.putErr != nil {
+		return f.putErr
+	}
+	f.files[key] = data
+
+	return nil
+}
+
+func (f *fakeSnapshotStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.gets++
+	data, ok := f.files[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrSnapshotNotFound)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *fakeSnapshotStore) Exists(ctx context.Context, key string) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	_, ok := f.files[key]
+	return ok, nil
+}
+
+func newTestService(stock StockRuntimeClient, orch Orchestrator) *Service {
+	return &Service{
+		stockRuntimeClient: stock,
+		coordinator:        newCoordinator(orch),
+		podVMConfigs:       make(map[string]*VMConfig),
+		podVMSignals:       make(map[string]*podVMSignal),
+		podMetadata:        make(map[string]*podMetadata),
+		metadataFilter:     &metadataFilter{labels: defaultMetadataLabels},
+		now:                time.Now,
+		stop:               make(chan struct{}),
+		creates:            newCreateCache(createCacheTTL),
+		scaleHints:         newScaleHints(),
+		health:             newDaemonHealth(),
+	}
+}
+
+// lookupPodVMConfig returns the VM config of the pod without waiting for it
+func lookupPodVMConfig(s *Service, podID string) (*VMConfig, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	vmConfig, ok := s.podVMConfigs[podID]
+	if !ok {
+		return nil, fmt.Errorf("VM config for pod %s does not exist", podID)
+	}
+
+	return vmConfig, nil
+}
+
+func newUserContainerRequest(podID, image string) *criapi.CreateContainerRequest {
+	return &criapi.CreateContainerRequest{
+		PodSandboxId: podID,
+		Config: &criapi.ContainerConfig{
+			Metadata: &criapi.ContainerMetadata{Name: userContainerName},
+			Envs: []*criapi.KeyValue{
+				{Key: guestImageEnv, Value: image},
+				{Key: revisionEnv, Value: image + "-00001"},
+			},
+		},
+	}
+}
@@ -0,0 +1,196 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The points at which faults can be injected, for testing the failure paths
+const (
+	// FaultStockCreate fails the creation of the placeholder container by the stock containerd
+	FaultStockCreate = "stock-create"
+	// FaultTapCreate fails the creation of the tap of a VM
+	FaultTapCreate = "tap-create"
+	// FaultBootHang hangs the boot of a VM until its start times out
+	FaultBootHang = "boot-hang"
+	// FaultSnapshotLoad fails the load of a VM snapshot as if it were corrupted
+	FaultSnapshotLoad = "snapshot-load"
+	// FaultGuestReady keeps the guest agent of a VM from becoming ready until the timeout
+	FaultGuestReady = "guest-ready"
+)
+
+var faultPoints = []string{FaultStockCreate, FaultTapCreate, FaultBootHang, FaultSnapshotLoad, FaultGuestReady}
+
+// ErrInjectedFault is the failure of an injected fault
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultStatus is the state of a fault point
+type FaultStatus struct {
+	// Armed is the number of times the fault fires, negative if it always fires
+	Armed int `json:"armed"`
+	// Fired is the number of times the fault fired
+	Fired uint64 `json:"fired"`
+}
+
+// faultRegistry holds the faults injected at the fault points.
+// A nil registry injects no faults, so that the points cost nothing when disabled.
+type faultRegistry struct {
+	sync.Mutex
+	points map[string]*FaultStatus
+}
+
+func newFaultRegistry() *faultRegistry {
+	f := &faultRegistry{points: make(map[string]*FaultStatus, len(faultPoints))}
+	for _, point := range faultPoints {
+		f.points[point] = &FaultStatus{}
+	}
+
+	return f
+}
+
+// arm makes the fault at point fire the next count times it is reached,
+// every time if count is negative, or disarms it if count is 0
+func (f *faultRegistry) arm(point string, count int) error {
+	f.Lock()
+	defer f.Unlock()
+
+	st, ok := f.points[point]
+	if !ok {
+		return fmt.Errorf("unknown fault point %q", point)
+	}
+	st.Armed = count
+
+	coordLog.WithFields(log.Fields{"point": point, "count": count}).Warn("fault injection changed")
+
+	return nil
+}
+
+// fire returns ErrInjectedFault if the fault at point is armed, using up one of its shots
+func (f *faultRegistry) fire(point string) error {
+	if f == nil {
+		return nil
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	st := f.points[point]
+	if st.Armed == 0 {
+		return nil
+	}
+	if st.Armed > 0 {
+		st.Armed--
+	}
+	st.Fired++
+
+	return fmt.Errorf("%w at %s", ErrInjectedFault, point)
+}
+
+func (f *faultRegistry) status() map[string]FaultStatus {
+	f.Lock()
+	defer f.Unlock()
+
+	status := make(map[string]FaultStatus, len(f.points))
+	for point, st := range f.points {
+		status[point] = *st
+	}
+
+	return status
+}
+
+// WithFaultInjection enables injecting faults at the fault points, through
+// InjectFault and the /debug/faults endpoint. It is meant for failure testing only.
+func WithFaultInjection(enabled bool) ServiceOption {
+	return func(s *Service) {
+		if enabled {
+			s.coordinator.faults = newFaultRegistry()
+		} else {
+			s.coordinator.faults = nil
+		}
+	}
+}
+
+// InjectFault makes the fault at point fire the next count times it is
+// reached, every time if count is negative, or disarms it if count is 0
+func (s *Service) InjectFault(point string, count int) error {
+	if s.coordinator.faults == nil {
+		return errors.New("fault injection is disabled")
+	}
+
+	return s.coordinator.faults.arm(point, count)
+}
+
+// FaultStatus returns the state of the fault points, nil if fault injection is disabled
+func (s *Service) FaultStatus() map[string]FaultStatus {
+	if s.coordinator.faults == nil {
+		return nil
+	}
+
+	return s.coordinator.faults.status()
+}
+
+// serveFaults reports the state of the fault points as JSON on GET, arms the
+// fault at the point form value on POST, for count times if given or else
+// once, and disarms all the faults on DELETE
+func (s *Service) serveFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		count := 1
+		if v := r.FormValue("count"); v != "" {
+			var err error
+			if count, err = strconv.Atoi(v); err != nil {
+				http.Error(w, fmt.Sprintf("invalid count %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.InjectFault(r.FormValue("point"), count); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		for _, point := range faultPoints {
+			if err := s.InjectFault(point, 0); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(s.FaultStatus()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
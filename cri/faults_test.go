@@ -0,0 +1,231 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// requireNoLeaks asserts that no VM, memory, pod VM config, instance or
+// placeholder container is left behind
+func requireNoLeaks(t *testing.T, s *Service, orch *fakes.Orchestrator, stock *fakes.StockRuntimeClient) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return orch.Running() == 0
+	}, time.Second, 10*time.Millisecond, "VM was leaked")
+
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of the VM was leaked")
+	require.Empty(t, s.coordinator.ListInstances(), "instance was leaked")
+	require.Empty(t, stock.Leaked(), "placeholder container was leaked")
+
+	s.Lock()
+	defer s.Unlock()
+	require.Empty(t, s.podVMConfigs, "pod VM config was leaked")
+}
+
+func TestFaultInjection(t *testing.T) {
+	ctx := context.Background()
+
+	// createAndRemove creates a user container, then removes it and its pod if it was created
+	createAndRemove := func(t *testing.T, s *Service) error {
+		resp, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		if err == nil {
+			_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: resp.GetContainerId()})
+			require.NoError(t, err, "container removal failed")
+			s.removePodVMConfig("pod")
+		}
+		return err
+	}
+
+	cases := []struct {
+		name          string
+		point         string
+		snapshots     bool
+		agent         bool
+		config        Config
+		run           func(t *testing.T, s *Service) error
+		expectCode    codes.Code
+		expectStarted int
+	}{
+		{
+			name:          "Stock container creation fails",
+			point:         FaultStockCreate,
+			run:           createAndRemove,
+			expectCode:    codes.Unknown,
+			expectStarted: 1,
+		},
+		{
+			name:       "Tap creation fails",
+			point:      FaultTapCreate,
+			run:        createAndRemove,
+			expectCode: codes.Unavailable,
+		},
+		{
+			name:       "Boot hangs",
+			point:      FaultBootHang,
+			config:     Config{StartTimeout: 50 * time.Millisecond},
+			run:        createAndRemove,
+			expectCode: codes.DeadlineExceeded,
+		},
+		{
+			name:      "Snapshot is corrupted",
+			point:     FaultSnapshotLoad,
+			snapshots: true,
+			run: func(t *testing.T, s *Service) error {
+				// The VM of the first pod is offloaded, then fails to be restored for the second
+				require.NoError(t, createAndRemove(t, s), "first container creation failed")
+				require.Eventually(t, func() bool {
+					return len(s.coordinator.ListInstances()) == 1 && len(s.coordinator.ListActive()) == 0
+				}, time.Second, 10*time.Millisecond, "VM was not offloaded")
+
+				_, err := s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+				return err
+			},
+			expectCode:    codes.Unknown,
+			expectStarted: 1,
+		},
+		{
+			name:   "Guest agent is not ready",
+			point:  FaultGuestReady,
+			agent:  true,
+			config: Config{AgentReadyTimeout: 20 * time.Millisecond, GuestReadyTimeout: 20 * time.Millisecond},
+			run: func(t *testing.T, s *Service) error {
+				resp, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+				require.NoError(t, err, "container creation failed")
+				_, startErr := s.StartContainer(ctx, &criapi.StartContainerRequest{ContainerId: resp.GetContainerId()})
+
+				// kubelet removes the container that failed to start
+				_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: resp.GetContainerId()})
+				require.NoError(t, err, "container removal failed")
+				s.removePodVMConfig("pod")
+
+				return startErr
+			},
+			expectCode:    codes.Unavailable,
+			expectStarted: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stock := &fakes.StockRuntimeClient{}
+
+			var (
+				s    *Service
+				orch *fakes.Orchestrator
+			)
+			if c.agent {
+				s, _ = newAgentService(t, stock)
+				orch = s.coordinator.orch.(*fakes.Orchestrator)
+			} else {
+				orch = fakes.NewOrchestrator()
+				s = newTestService(stock, orch)
+			}
+			orch.SnapshotsEnabled = c.snapshots
+			WithConfig(c.config)(s)
+			WithFaultInjection(true)(s)
+
+			require.NoError(t, s.InjectFault(c.point, -1))
+
+			err := c.run(t, s)
+			require.Equal(t, c.expectCode, status.Code(err), "unexpected error code")
+
+			require.Equal(t, c.expectStarted, orch.NumStarted(), "unexpected number of started VMs")
+			require.NotZero(t, s.FaultStatus()[c.point].Fired, "fault did not fire")
+
+			requireNoLeaks(t, s, orch, stock)
+		})
+	}
+}
+
+func TestFaultRegistry(t *testing.T) {
+	var disabled *faultRegistry
+	require.NoError(t, disabled.fire(FaultTapCreate), "disabled registry injected a fault")
+
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	require.Error(t, s.InjectFault(FaultTapCreate, 1), "fault was injected while disabled")
+	require.Nil(t, s.FaultStatus())
+
+	WithFaultInjection(true)(s)
+	require.Error(t, s.InjectFault("disk-full", 1), "unknown fault point was armed")
+
+	// A fault armed twice fires twice
+	require.NoError(t, s.InjectFault(FaultTapCreate, 2))
+	for i := 0; i < 3; i++ {
+		err := s.coordinator.faults.fire(FaultTapCreate)
+		require.Equal(t, i < 2, errors.Is(err, ErrInjectedFault), "fault fired wrongly on pass %d", i)
+	}
+	require.Equal(t, FaultStatus{Fired: 2}, s.FaultStatus()[FaultTapCreate])
+
+	t.Run("Debug endpoint", func(t *testing.T) {
+		server := httptest.NewServer(s.DebugHandler())
+		defer server.Close()
+
+		resp, err := http.PostForm(server.URL+"/debug/faults", url.Values{"point": {FaultBootHang}, "count": {"-1"}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, -1, s.FaultStatus()[FaultBootHang].Armed, "fault was not armed")
+
+		resp, err = http.PostForm(server.URL+"/debug/faults", url.Values{"point": {"disk-full"}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "unknown fault point was armed")
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/debug/faults", nil)
+		require.NoError(t, err)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var status map[string]FaultStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		require.Zero(t, status[FaultBootHang].Armed, "fault was not disarmed")
+		require.EqualValues(t, 2, status[FaultTapCreate].Fired)
+	})
+
+	t.Run("Disabled endpoint", func(t *testing.T) {
+		disabled := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+		server := httptest.NewServer(disabled.DebugHandler())
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/debug/faults")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, "fault endpoint is served while disabled")
+	})
+}
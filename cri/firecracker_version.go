@@ -0,0 +1,173 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// guestFirecrackerVersionEnv selects the firecracker release running the
+// VMs of the revision among the ones configured on the node
+const guestFirecrackerVersionEnv = "GUEST_FC_VERSION"
+
+// firecrackerVersions maps the firecracker releases available on the node
+// to their binaries
+type firecrackerVersions struct {
+	binaries       map[string]string
+	defaultVersion string
+}
+
+// ParseFirecrackerVersions parses the firecracker releases of the node,
+// given as <version>=<absolute path of the binary>, checking that their
+// binaries are executable files and that the default release, if any,
+// is one of them
+func ParseFirecrackerVersions(list []string, defaultVersion string) (map[string]string, error) {
+	binaries := make(map[string]string, len(list))
+	for _, e := range list {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || !filepath.IsAbs(kv[1]) {
+			return nil, fmt.Errorf("invalid firecracker version %q, expected <version>=<absolute path>", e)
+		}
+		if _, dup := binaries[kv[0]]; dup {
+			return nil, fmt.Errorf("duplicate firecracker version %q", kv[0])
+		}
+		if err := checkExecutable(kv[1]); err != nil {
+			return nil, fmt.Errorf("invalid binary of firecracker version %q: %w", kv[0], err)
+		}
+		binaries[kv[0]] = filepath.Clean(kv[1])
+	}
+
+	if _, ok := binaries[defaultVersion]; defaultVersion != "" && len(binaries) > 0 && !ok {
+		return nil, fmt.Errorf("default firecracker version %q is not one of the configured versions", defaultVersion)
+	}
+
+	return binaries, nil
+}
+
+func checkExecutable(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not an executable file", file)
+	}
+
+	return nil
+}
+
+// newestFirecrackerVersion returns the newest of the releases, comparing the
+// numbers of their dot-separated components, e.g., v1.0.0 is newer than v0.25.2
+func newestFirecrackerVersion(versions []string) string {
+	var newest string
+	for _, version := range versions {
+		if newest == "" || compareVersions(version, newest) > 0 {
+			newest = version
+		}
+	}
+
+	return newest
+}
+
+// compareVersions compares the numeric components of two versions, with an
+// optional v prefix, and then the versions as strings if they are equal
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, nb := versionNumber(pa[i]), versionNumber(pb[i])
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	if len(pa) != len(pb) {
+		if len(pa) < len(pb) {
+			return -1
+		}
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// versionNumber returns the number a version component starts with, e.g., 1 for 1-rc2
+func versionNumber(component string) int {
+	end := 0
+	for end < len(component) && component[end] >= '0' && component[end] <= '9' {
+		end++
+	}
+
+	n, _ := strconv.Atoi(component[:end])
+	return n
+}
+
+// available returns the sorted versions available on the node
+func (v *firecrackerVersions) available() []string {
+	versions := make([]string, 0, len(v.binaries))
+	for version := range v.binaries {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	return versions
+}
+
+// getGuestFirecracker returns the firecracker release selected for the VMs of
+// the function and its binary, the default release of the node if none is
+// selected. Both are empty if the node has no releases configured.
+func (s *Service) getGuestFirecracker(config *criapi.ContainerConfig) (version, binary string, err error) {
+	for _, kv := range config.GetEnvs() {
+		if kv.GetKey() == guestFirecrackerVersionEnv {
+			version = kv.GetValue()
+		}
+	}
+
+	if s.firecrackerVersions == nil {
+		if version != "" {
+			return "", "", fmt.Errorf("%s is set but no firecracker versions are configured on the node", guestFirecrackerVersionEnv)
+		}
+		return "", "", nil
+	}
+
+	if version == "" {
+		version = s.firecrackerVersions.defaultVersion
+	}
+	binary, ok := s.firecrackerVersions.binaries[version]
+	if !ok {
+		return "", "", fmt.Errorf("unknown %s %q, available versions: %s",
+			guestFirecrackerVersionEnv, version, strings.Join(s.firecrackerVersions.available(), ", "))
+	}
+
+	return version, binary, nil
+}
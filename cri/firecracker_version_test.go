@@ -0,0 +1,219 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newFirecrackerTestService(orch *fakes.Orchestrator) *Service {
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	WithFirecrackerVersions(map[string]string{
+		"v0.24.0": "/usr/local/bin/firecracker",
+		"v0.25.0": "/opt/firecracker/v0.25.0/firecracker",
+	}, "v0.24.0")(s)
+
+	return s
+}
+
+func newFirecrackerRequest(podID, version string) *criapi.CreateContainerRequest {
+	r := newUserContainerRequest(podID, "img")
+	if version != "" {
+		r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestFirecrackerVersionEnv, Value: version})
+	}
+	return r
+}
+
+// newFakeFirecracker creates an executable file standing for a firecracker binary
+func newFakeFirecracker(t *testing.T, dir, name string) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	require.NoError(t, ioutil.WriteFile(file, []byte("#!/bin/sh\n"), 0755))
+
+	return file
+}
+
+func TestParseFirecrackerVersions(t *testing.T) {
+	dir := t.TempDir()
+	v24 := newFakeFirecracker(t, dir, "firecracker")
+	v25 := newFakeFirecracker(t, dir, "fc/firecracker")
+
+	binaries, err := ParseFirecrackerVersions([]string{"v0.24.0=" + v24, "v0.25.0=" + dir + "/fc/../fc/firecracker"}, "v0.24.0")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"v0.24.0": v24, "v0.25.0": v25}, binaries)
+
+	binaries, err = ParseFirecrackerVersions(nil, "")
+	require.NoError(t, err)
+	require.Empty(t, binaries)
+
+	_, err = ParseFirecrackerVersions([]string{"v0.24.0=" + v24}, "")
+	require.NoError(t, err, "versions without default were rejected")
+
+	for _, list := range [][]string{
+		{"v0.24.0"},
+		{"=" + v24},
+		{"v0.24.0=firecracker"},
+		{"v0.24.0=" + v24, "v0.24.0=" + v25},
+	} {
+		_, err := ParseFirecrackerVersions(list, "v0.24.0")
+		require.Error(t, err, "invalid versions %v were accepted", list)
+	}
+
+	_, err = ParseFirecrackerVersions([]string{"v0.24.0=" + v24}, "v0.25.0")
+	require.Error(t, err, "unknown default version was accepted")
+}
+
+func TestParseFirecrackerVersionsMissingBinary(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "firecracker-noexec")
+	require.NoError(t, ioutil.WriteFile(notExecutable, nil, 0644))
+
+	for name, binary := range map[string]string{
+		"Missing":       filepath.Join(dir, "firecracker-missing"),
+		"NotExecutable": notExecutable,
+		"Directory":     dir,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFirecrackerVersions([]string{"v0.24.0=" + binary}, "v0.24.0")
+			require.Error(t, err, "binary %s was accepted", binary)
+			require.Contains(t, err.Error(), `firecracker version "v0.24.0"`, "version was not reported")
+		})
+	}
+}
+
+func TestNewestFirecrackerVersion(t *testing.T) {
+	require.Equal(t, "v0.25.2", newestFirecrackerVersion([]string{"v0.24.0", "v0.25.2", "v0.25.0"}))
+	require.Equal(t, "v1.0.0", newestFirecrackerVersion([]string{"v0.25.10", "v1.0.0", "v0.9.0"}))
+	require.Equal(t, "v0.25.10", newestFirecrackerVersion([]string{"v0.25.9", "v0.25.10"}), "versions compared as strings")
+	require.Equal(t, "1.1", newestFirecrackerVersion([]string{"v1.0.3", "1.1"}))
+	require.Empty(t, newestFirecrackerVersion(nil))
+
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	WithFirecrackerVersions(map[string]string{
+		"v0.24.0": "/usr/local/bin/firecracker",
+		"v0.25.0": "/opt/firecracker/v0.25.0/firecracker",
+	}, "")(s)
+	require.Equal(t, "v0.25.0", s.firecrackerVersions.defaultVersion, "fresh boots do not use the newest version")
+}
+
+func TestFirecrackerVersionSnapshots(t *testing.T) {
+	ctx := context.Background()
+
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	c := newCoordinator(orch)
+
+	withVersion := func(version string) ctriface.StartVMOption {
+		return ctriface.WithFirecracker(version, "/opt/firecracker/"+version+"/firecracker")
+	}
+
+	fi, err := c.startVM(ctx, "img", withVersion("v0.24.0"))
+	require.NoError(t, err, "failed to start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+	require.NoError(t, c.stopVM(ctx, "ctr1"), "failed to offload VM")
+
+	details, ok := c.DescribeInstance(fi.vmID)
+	require.True(t, ok)
+	require.Len(t, details.SnapshotLineage, 1)
+	require.Equal(t, "v0.24.0", details.SnapshotLineage[0].FirecrackerVersion, "version was not recorded in the snapshot")
+
+	// A VM of another release is booted rather than restored from the snapshot
+	booted, err := c.startVM(ctx, "img", withVersion("v0.25.0"))
+	require.NoError(t, err, "failed to fall back to a boot")
+	require.NotEqual(t, fi.vmID, booted.vmID, "VM was restored from the snapshot of another release")
+	require.Equal(t, "/opt/firecracker/v0.25.0/firecracker", orch.StartOpts[booted.vmID].FirecrackerBinary)
+	require.EqualValues(t, 1, c.snapStats.get().VersionFallbacks)
+
+	// The snapshot is kept for the VMs of its release
+	restored, err := c.startVM(ctx, "img", withVersion("v0.24.0"))
+	require.NoError(t, err, "failed to restore VM")
+	require.Equal(t, fi, restored, "VM was not restored from the snapshot of its release")
+	require.EqualValues(t, 1, c.snapStats.get().Restores)
+	require.EqualValues(t, 1, c.snapStats.get().VersionFallbacks)
+	require.Equal(t, 2, orch.NumStarted())
+}
+
+func TestFirecrackerVersionSelection(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Known", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newFirecrackerTestService(orch)
+
+		resp, err := s.CreateContainer(ctx, newFirecrackerRequest("pod1", "v0.25.0"))
+		require.NoError(t, err, "container creation failed")
+
+		fi, _ := s.coordinator.getInstance(resp.ContainerId)
+		opts := orch.StartOpts[fi.vmID]
+		require.Equal(t, "v0.25.0", opts.FirecrackerVersion)
+		require.Equal(t, "/opt/firecracker/v0.25.0/firecracker", opts.FirecrackerBinary)
+		require.Equal(t, "v0.25.0", fi.bootTrace.FirecrackerVersion, "version was not recorded in the boot trace")
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newFirecrackerTestService(orch)
+
+		resp, err := s.CreateContainer(ctx, newFirecrackerRequest("pod1", ""))
+		require.NoError(t, err, "container creation failed")
+
+		fi, _ := s.coordinator.getInstance(resp.ContainerId)
+		require.Equal(t, "/usr/local/bin/firecracker", orch.StartOpts[fi.vmID].FirecrackerBinary)
+		require.Equal(t, "v0.24.0", fi.bootTrace.FirecrackerVersion, "default version was not recorded in the boot trace")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newFirecrackerTestService(orch)
+
+		_, err := s.CreateContainer(ctx, newFirecrackerRequest("pod1", "v1.0.0"))
+		specErr, ok := err.(*SpecValidationError)
+		require.True(t, ok, "unexpected error: %v", err)
+		require.Equal(t, []string{guestFirecrackerVersionEnv}, specErr.Fields())
+		require.Contains(t, err.Error(), "available versions: v0.24.0, v0.25.0", "available versions were not listed")
+		require.Zero(t, orch.NumStarted(), "VM was started with an unknown version")
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+		resp, err := s.CreateContainer(ctx, newFirecrackerRequest("pod1", ""))
+		require.NoError(t, err, "container creation failed")
+		fi, _ := s.coordinator.getInstance(resp.ContainerId)
+		require.Empty(t, orch.StartOpts[fi.vmID].FirecrackerBinary, "binary was selected without versions")
+
+		_, err = s.CreateContainer(ctx, newFirecrackerRequest("pod2", "v0.24.0"))
+		_, ok := err.(*SpecValidationError)
+		require.True(t, ok, "version was accepted without versions: %v", err)
+	})
+}
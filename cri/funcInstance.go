@@ -24,28 +24,99 @@ package cri
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/ease-lab/vhive/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
 type funcInstance struct {
-	vmID                   string
-	image                  string
+	// inFlight is the number of requests being served by the VM,
+	// first for the alignment of the atomic operations
+	inFlight int64
+	// lastInvocation is the time in ns of the latest request to the VM
+	lastInvocation int64
+	// healthFailures is the number of consecutive failed health checks
+	healthFailures int32
+	// probeFailures is the number of consecutive failed probes of the function
+	probeFailures int32
+	// exitExpected is 1 while the VM is stopped or offloaded, when its exit is not a crash
+	exitExpected int32
+	// draining is 1 once the container is stopping, when the VM does not accept requests
+	draining int32
+	// boots counts the restarts in place of the VM, whose earlier exits are not crashes
+	boots int32
+	// vmReleased is 1 once the orchestrator released the VM that failed to restart
+	vmReleased int32
+	// memTargetMib is the guest memory left by the balloon and cpuMillis the CPU
+	// quota in thousandths of CPUs, 0 until the resources of the VM are updated
+	memTargetMib uint32
+	cpuMillis    int64
+
+	vmID       string
+	image      string
+	revisionID string
+	// snapshotID identifies the snapshot of the VM in the snapshot store,
+	// empty until it is pushed
+	snapshotID             string
+	sandboxID              string
+	namespace              string
+	startTime              time.Time
+	vmOpts                 *ctriface.StartVMOptions
 	logger                 *log.Entry
 	onceCreateSnapInstance *sync.Once
-	startVMResponse        *ctriface.StartVMResponse
+	// onceEndCPUBoost ends the CPU boost of the cold start on the first response
+	onceEndCPUBoost sync.Once
+	startVMResponse *ctriface.StartVMResponse
+	// agent is the control channel to the guest agent, nil if disabled
+	agent *guestagent.Channel
+	// projection is the image with the secrets and config maps of the VM, if any
+	projection *projection
+	// extraDisk is the scratch or persistent disk of the VM, if any
+	extraDisk *extraDisk
+	// bootTrace is the timing of the cold start of the VM
+	bootTrace *BootTrace
+	// restoreMetric is the timing of the latest restore of the VM from its snapshot
+	restoreMetric *metrics.Metric
+	// history is the state, snapshot lineage and recent events of the instance
+	history *instanceHistory
+	// opMu serializes the lifecycle operations on the VM
+	opMu sync.Mutex
+	// scaleToZero offloads the VM once it is idle for the scale-to-zero timeout
+	scaleToZero bool
+	// probe checks the health of the function in the VM, nil if disabled
+	probe *guestProbe
+	// clockSync syncs the guest clock when the VM is resumed or restored,
+	// as configured by the latest container of the instance
+	clockSync bool
+	// reapEager waits for the working set of the VM to be installed when it is
+	// restored with REAP, as configured by the latest container of the instance
+	reapEager bool
+	// guestPort is the port the function serves on in the VM
+	guestPort string
+	// connProxy forwards the traffic of the queue-proxy to the VM, nil if disabled
+	connProxy *connProxy
 }
 
 func newFuncInstance(vmID, image string, startVMResponse *ctriface.StartVMResponse) *funcInstance {
+	now := time.Now()
 	f := &funcInstance{
 		vmID:                   vmID,
 		image:                  image,
+		startTime:              now,
+		lastInvocation:         now.UnixNano(),
+		vmOpts:                 ctriface.NewStartVMOptions(),
 		onceCreateSnapInstance: new(sync.Once),
 		startVMResponse:        startVMResponse,
+		history:                newInstanceHistory(),
+		clockSync:              true,
+		guestPort:              defaultGuestPort,
 	}
 
-	f.logger = log.WithFields(
+	f.logger = coordLog.WithFields(
 		log.Fields{
 			"vmID":  vmID,
 			"image": image,
@@ -54,3 +125,118 @@ func newFuncInstance(vmID, image string, startVMResponse *ctriface.StartVMRespon
 
 	return f
 }
+
+// beginInvocation marks the start of a request served by the VM
+func (f *funcInstance) beginInvocation() {
+	atomic.AddInt64(&f.inFlight, 1)
+	atomic.StoreInt64(&f.lastInvocation, time.Now().UnixNano())
+}
+
+// endInvocation marks the end of a request served by the VM
+func (f *funcInstance) endInvocation() {
+	atomic.AddInt64(&f.inFlight, -1)
+}
+
+// getResources returns the guest memory left by the balloon and the CPU quota of the VM
+func (f *funcInstance) getResources() (memTargetMib uint32, cpuQuota float64) {
+	memTargetMib, cpuQuota = f.vmOpts.MemSizeMib, float64(f.vmOpts.VcpuCount)
+	if mib := atomic.LoadUint32(&f.memTargetMib); mib != 0 {
+		memTargetMib = mib
+	}
+	if millis := atomic.LoadInt64(&f.cpuMillis); millis != 0 {
+		cpuQuota = float64(millis) / 1000
+	}
+
+	return memTargetMib, cpuQuota
+}
+
+// isResized returns true if the resources of the VM differ from its boot resources
+func (f *funcInstance) isResized() bool {
+	memTargetMib, cpuQuota := f.getResources()
+	return memTargetMib != f.vmOpts.MemSizeMib || cpuQuota != float64(f.vmOpts.VcpuCount)
+}
+
+// isDraining returns true if the container of the VM is stopping
+func (f *funcInstance) isDraining() bool {
+	return atomic.LoadInt32(&f.draining) == 1
+}
+
+// isServing returns true if the VM has requests in flight
+func (f *funcInstance) isServing() bool {
+	return atomic.LoadInt64(&f.inFlight) > 0
+}
+
+// getLastInvocation returns the time of the latest request to the VM,
+// or of its start if it has not served any
+func (f *funcInstance) getLastInvocation() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&f.lastInvocation))
+}
+
+// recordHealth records the result of a health check of the VM, returning
+// true if the VM just became unhealthy
+func (f *funcInstance) recordHealth(healthy bool) bool {
+	if healthy {
+		atomic.StoreInt32(&f.healthFailures, 0)
+		return false
+	}
+
+	return atomic.AddInt32(&f.healthFailures, 1) == unhealthyThreshold
+}
+
+// isUnhealthy returns true if the latest health checks of the VM
+// or the latest probes of the function failed
+func (f *funcInstance) isUnhealthy() bool {
+	return atomic.LoadInt32(&f.healthFailures) >= unhealthyThreshold || f.isProbeFailing()
+}
+
+// info describes the instance, attached to the given container if any
+func (f *funcInstance) info(containerID string, now time.Time) VMInfo {
+	state, bootType := f.history.get()
+
+	info := VMInfo{
+		ContainerID: containerID,
+		VMID:        f.vmID,
+		Image:       f.image,
+		Revision:    f.revisionID,
+		Namespace:   f.namespace,
+		MemSizeMib:  f.vmOpts.MemSizeMib,
+		VcpuCount:   f.vmOpts.VcpuCount,
+		BootType:    bootType,
+		StartTime:   f.startTime,
+		Uptime:      now.Sub(f.startTime),
+		State:       state,
+	}
+	info.MemTargetMib, info.CPUQuota = f.getResources()
+
+	if f.startVMResponse != nil {
+		info.GuestIP = f.startVMResponse.GuestIP
+		info.ImageDigest = f.startVMResponse.ImageDigest
+		info.GuestPort = f.guestPort
+	}
+	if f.bootTrace != nil {
+		trace := *f.bootTrace
+		info.BootTrace = &trace
+	}
+
+	if state == vmStateRunning {
+		if f.agent != nil && !f.agent.Reachable() {
+			info.State = vmStateUnresponsive
+		}
+		if f.isUnhealthy() {
+			info.State = vmStateUnhealthy
+		}
+	}
+
+	return info
+}
+
+// snapshotRecord describes a snapshot taken now of the VM with the given name
+func (f *funcInstance) snapshotRecord(name string) SnapshotRecord {
+	return SnapshotRecord{Name: name, VMID: f.vmID, Image: f.image, FirecrackerVersion: f.vmOpts.FirecrackerVersion}
+}
+
+// isDebugInit returns true if the VM was booted into another command than
+// the guest init, see GUEST_INIT_CMD
+func (f *funcInstance) isDebugInit() bool {
+	return f.vmOpts != nil && len(f.vmOpts.InitCmd) > 0
+}
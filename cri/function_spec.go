@@ -0,0 +1,432 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/taps"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// SpecProblem is an invalid setting in the spec of a function
+type SpecProblem struct {
+	// Field is the environment variable or the annotation of the setting
+	Field   string
+	Message string
+}
+
+// SpecErrors lists all the problems found in the spec of a function
+type SpecErrors []SpecProblem
+
+func (e SpecErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, p := range e {
+		msgs = append(msgs, p.Message)
+	}
+
+	return "invalid function spec: " + strings.Join(msgs, "; ")
+}
+
+// SpecValidationError is an invalid spec of a user container, identifying
+// the container and listing all the problems of its spec. It is reported to
+// kubelet as InvalidArgument.
+type SpecValidationError struct {
+	SandboxID string
+	Container string
+	Attempt   uint32
+	Problems  SpecErrors
+}
+
+// newSpecValidationError attributes the problems of the spec of
+// the user container of r to the container
+func newSpecValidationError(r *criapi.CreateContainerRequest, problems SpecErrors) *SpecValidationError {
+	metadata := r.GetConfig().GetMetadata()
+	return &SpecValidationError{
+		SandboxID: r.GetPodSandboxId(),
+		Container: metadata.GetName(),
+		Attempt:   metadata.GetAttempt(),
+		Problems:  problems,
+	}
+}
+
+func (e *SpecValidationError) Error() string {
+	return fmt.Sprintf("container %s (attempt %d) of sandbox %s: %v", e.Container, e.Attempt, e.SandboxID, e.Problems)
+}
+
+// Unwrap returns the problems of the spec
+func (e *SpecValidationError) Unwrap() error {
+	return e.Problems
+}
+
+// GRPCStatus reports all the problems of the spec in one InvalidArgument status
+func (e *SpecValidationError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// Fields returns the environment variables and annotations with problems
+func (e *SpecValidationError) Fields() []string {
+	fields := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		fields = append(fields, p.Field)
+	}
+
+	return fields
+}
+
+// logSpecError logs why the spec of the user container of r is invalid and
+// returns the error reported to kubelet
+func logSpecError(logger *log.Entry, r *criapi.CreateContainerRequest, err error) error {
+	var problems SpecErrors
+	if !errors.As(err, &problems) {
+		logger.WithError(err).Error()
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	specErr := newSpecValidationError(r, problems)
+	logger.WithError(specErr).WithField("fields", specErr.Fields()).Error("invalid user container spec")
+
+	return specErr
+}
+
+// errMissingEnv is the problem of a required environment variable that is not set
+func errMissingEnv(key string) error {
+	return fmt.Errorf("%s is not set or empty in the user container config", key)
+}
+
+// FunctionSpec is the environment of a user container, which configures the
+// function in its VMs. Its methods parse and validate the settings of the
+// environment, each returning the default of the setting if it is unset.
+type FunctionSpec struct {
+	envs []*criapi.KeyValue
+}
+
+// NewFunctionSpec returns the spec of the function of the user container with config
+func NewFunctionSpec(config *criapi.ContainerConfig) FunctionSpec {
+	return FunctionSpec{envs: config.GetEnvs()}
+}
+
+// Image returns the image of the function
+func (f FunctionSpec) Image() (string, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() == guestImageEnv && kv.GetValue() != "" {
+			return kv.GetValue(), nil
+		}
+	}
+
+	return "", errMissingEnv(guestImageEnv)
+}
+
+// Revision returns the Knative revision of the function
+func (f FunctionSpec) Revision() (string, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() == revisionEnv && kv.GetValue() != "" {
+			return kv.GetValue(), nil
+		}
+	}
+
+	return "", errMissingEnv(revisionEnv)
+}
+
+// RootfsDigest returns the digest the guest rootfs is verified
+// against, empty if it is not verified
+func (f FunctionSpec) RootfsDigest() (string, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() == guestRootfsVerifyEnv {
+			if err := ctriface.ValidateRootfsDigest(kv.GetValue()); err != nil {
+				return "", fmt.Errorf("invalid %s: %w", guestRootfsVerifyEnv, err)
+			}
+
+			return kv.GetValue(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Bool returns the boolean value of the env key, def if unset
+func (f FunctionSpec) Bool(key string, def bool) (bool, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() != key {
+			continue
+		}
+
+		value, err := strconv.ParseBool(kv.GetValue())
+		if err != nil {
+			return false, fmt.Errorf("invalid %s value %q", key, kv.GetValue())
+		}
+
+		return value, nil
+	}
+
+	return def, nil
+}
+
+// RateLimit returns the network or I/O rate limit set by the env key, 0 if unset
+func (f FunctionSpec) RateLimit(key string) (uint64, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() != key || kv.GetValue() == "" {
+			continue
+		}
+
+		limit, err := strconv.ParseInt(kv.GetValue(), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value %q", key, kv.GetValue())
+		}
+		if limit < 0 {
+			return 0, fmt.Errorf("%s must not be negative, got %d", key, limit)
+		}
+
+		return uint64(limit), nil
+	}
+
+	return 0, nil
+}
+
+// SwapMib returns the size in MiB of the swap of the function, 0 for none
+func (f FunctionSpec) SwapMib() (uint32, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() != guestSwapEnv || kv.GetValue() == "" {
+			continue
+		}
+
+		mib, err := strconv.ParseUint(kv.GetValue(), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value %q, must be a size in MiB", guestSwapEnv, kv.GetValue())
+		}
+
+		return uint32(mib), nil
+	}
+
+	return 0, nil
+}
+
+// vmSpec is the configuration of the VMs of a function, set by
+// the environment and the annotations of its user container
+type vmSpec struct {
+	image       string
+	revision    string
+	vcpuCount   uint32
+	memSizeMib  uint32
+	guestPort   string
+	prefault    bool
+	reap        bool
+	reapEager   bool
+	imageCached bool
+	clockSync   bool
+	scaleToZero bool
+	kernel      string
+	hugepages   bool
+	boostFactor float64
+	boostWindow time.Duration
+	probe       *guestProbe
+	env         []string
+	disk        *extraDiskSpec
+	virtiofs    []ctriface.VirtiofsMount
+	initCmd     []string
+	// firecracker is the firecracker release of the VMs and its binary,
+	// empty if no releases are configured on the node
+	firecracker       string
+	firecrackerBinary string
+	// rootfsDigest is the expected digest of the guest rootfs, empty if not verified
+	rootfsDigest string
+	warmPool     warmPoolPolicy
+	connProxy    bool
+	// netRateLimit and ioRateLimit limit the network traffic and the drive
+	// I/O of the VMs, no limit if zero
+	netRateLimit ctriface.NetRateLimit
+	ioRateLimit  ctriface.IORateLimit
+	// guestSwapMib is the size of the swap file in the rootfs of the VMs, none if 0
+	guestSwapMib uint32
+	// transport is how the queue-proxy reaches the function, tcp or vsock
+	transport string
+	// egressPolicy restricts the egress of the VMs, nil if unrestricted
+	egressPolicy *taps.EgressPolicy
+	// sandbox is the backend running the function
+	sandbox sandboxBackend
+
+	// warnings are the settings that are valid but ignored on this node
+	warnings []string
+}
+
+// parseFunctionSpec parses and validates the spec of the function of a user
+// container with the defaults of cfg, returning SpecErrors with all its
+// problems if it is invalid. It does not start, reserve or look up any VM.
+func (s *Service) parseFunctionSpec(r *criapi.CreateContainerRequest, cfg *Config) (*vmSpec, error) {
+	var (
+		config = r.GetConfig()
+		fspec  = NewFunctionSpec(config)
+		spec   = &vmSpec{
+			vcpuCount:  cfg.VcpuCount,
+			memSizeMib: cfg.MemSizeMib,
+			guestPort:  cfg.GuestPort,
+		}
+		problems SpecErrors
+		err      error
+	)
+
+	check := func(field string, err error) {
+		if err != nil {
+			problems = append(problems, SpecProblem{Field: field, Message: err.Error()})
+		}
+	}
+
+	if spec.image, err = fspec.Image(); err == nil {
+		err = ctriface.ValidateImageName(spec.image)
+	}
+	check(guestImageEnv, err)
+
+	spec.revision, err = fspec.Revision()
+	check(revisionEnv, err)
+
+	spec.prefault, err = fspec.Bool(guestPrefaultEnv, false)
+	check(guestPrefaultEnv, err)
+
+	spec.reap, err = fspec.Bool(guestREAPEnv, false)
+	check(guestREAPEnv, err)
+
+	// Eager REAP is REAP whose restores wait for the working set
+	spec.reapEager, err = fspec.Bool(guestREAPEagerEnv, false)
+	check(guestREAPEagerEnv, err)
+	spec.reap = spec.reap || spec.reapEager
+
+	spec.imageCached, err = fspec.Bool(guestImageCachedEnv, false)
+	check(guestImageCachedEnv, err)
+
+	spec.clockSync, err = fspec.Bool(guestClockSyncEnv, true)
+	check(guestClockSyncEnv, err)
+
+	spec.rootfsDigest, err = fspec.RootfsDigest()
+	check(guestRootfsVerifyEnv, err)
+
+	spec.scaleToZero, err = fspec.Bool(scaleToZeroEnv, false)
+	check(scaleToZeroEnv, err)
+
+	spec.kernel, err = s.getGuestKernel(config)
+	check(guestKernelEnv, err)
+
+	spec.hugepages, err = getGuestHugepages(r)
+	check(hugepagesAnnotation, err)
+
+	// Either the annotation or the env enables hugepages
+	hugepagesEnv, err := fspec.Bool(guestHugepagesEnv, false)
+	check(guestHugepagesEnv, err)
+	spec.hugepages = spec.hugepages || hugepagesEnv
+
+	spec.netRateLimit.BandwidthMbps, err = fspec.RateLimit(guestNetBandwidthEnv)
+	check(guestNetBandwidthEnv, err)
+
+	spec.netRateLimit.OpsPerSec, err = fspec.RateLimit(guestNetOpsEnv)
+	check(guestNetOpsEnv, err)
+
+	spec.ioRateLimit.BandwidthMBps, err = fspec.RateLimit(guestIOBandwidthEnv)
+	check(guestIOBandwidthEnv, err)
+
+	spec.ioRateLimit.OpsPerSec, err = fspec.RateLimit(guestIOOpsEnv)
+	check(guestIOOpsEnv, err)
+
+	spec.guestSwapMib, err = fspec.SwapMib()
+	check(guestSwapEnv, err)
+
+	spec.boostFactor, spec.boostWindow, err = getCPUBoost(r, cfg.CPUBoostWindow)
+	check(cpuBoostAnnotation, err)
+
+	spec.probe, err = getGuestProbe(r, cfg)
+	check(probeAnnotation, err)
+
+	spec.warmPool, err = getWarmPool(r)
+	check(warmPoolAnnotation, err)
+
+	spec.connProxy, err = getConnProxy(r)
+	check(connProxyAnnotation, err)
+
+	spec.transport, err = fspec.Transport()
+	check(guestTransportEnv, err)
+	if spec.connProxy && spec.transport == guestTransportVsock {
+		check(connProxyAnnotation, errors.New("connection proxies reach the guest over TCP, not vsock"))
+	}
+
+	spec.egressPolicy, err = getEgressPolicy(r)
+	check(egressPolicyAnnotation, err)
+
+	spec.env, err = fspec.Env(spec.guestPort)
+	check("env", err)
+
+	spec.virtiofs, err = s.getGuestVirtiofsMounts(config)
+	check(guestVirtiofsMountsEnv, err)
+
+	spec.initCmd, err = fspec.InitCmd(cfg.AllowDebugInit)
+	check(guestInitCmdEnv, err)
+
+	spec.firecracker, spec.firecrackerBinary, err = s.getGuestFirecracker(config)
+	check(guestFirecrackerVersionEnv, err)
+
+	// The disk of a function is keyed by its revision, which is reported above if missing
+	if spec.revision != "" {
+		spec.disk, err = getExtraDisk(spec.revision, r)
+		check(extraDiskSizeAnnotation, err)
+	}
+
+	spec.sandbox, err = s.getSandboxBackend(getAnnotations(r))
+	check(sandboxAnnotation, err)
+	if spec.sandbox != nil {
+		problems = append(problems, checkSandboxCapabilities(spec)...)
+	}
+
+	snapshotsEnabled := s.coordinator.orch != nil && s.coordinator.orch.GetSnapshotsEnabled()
+	if spec.disk != nil && snapshotsEnabled {
+		check(extraDiskSizeAnnotation, errors.New("extra disks are not supported with snapshots"))
+	}
+	if spec.reap && spec.hugepages {
+		check(guestREAPEnv, errors.New("REAP is not supported with hugepages"))
+	}
+	if spec.reap && !snapshotsEnabled {
+		spec.reap, spec.reapEager = false, false
+		spec.warnings = append(spec.warnings,
+			fmt.Sprintf("%s is ignored, REAP requires snapshots", guestREAPEnv))
+	}
+	if spec.scaleToZero && (s.scaleToZeroTimeout == 0 || !snapshotsEnabled) {
+		spec.warnings = append(spec.warnings,
+			fmt.Sprintf("%s is ignored, scale-to-zero requires snapshots and an idle timeout", scaleToZeroEnv))
+	}
+
+	if spec.connProxy && s.coordinator.connProxyIP == "" {
+		spec.connProxy = false
+		spec.warnings = append(spec.warnings,
+			fmt.Sprintf("%s is ignored, connection proxies are disabled on the node", connProxyAnnotation))
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	return spec, nil
+}
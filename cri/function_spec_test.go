@@ -0,0 +1,350 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// newFunctionSpec returns the spec of a user container with the environment envs
+func newFunctionSpec(envs ...*criapi.KeyValue) FunctionSpec {
+	return NewFunctionSpec(&criapi.ContainerConfig{Envs: envs})
+}
+
+func TestFunctionSpecRequired(t *testing.T) {
+	spec := newFunctionSpec(
+		&criapi.KeyValue{Key: guestImageEnv, Value: "img"},
+		&criapi.KeyValue{Key: revisionEnv, Value: "img-00001"},
+	)
+
+	image, err := spec.Image()
+	require.NoError(t, err)
+	require.Equal(t, "img", image)
+
+	revision, err := spec.Revision()
+	require.NoError(t, err)
+	require.Equal(t, "img-00001", revision)
+
+	// Empty values are missing
+	spec = newFunctionSpec(&criapi.KeyValue{Key: guestImageEnv})
+	_, err = spec.Image()
+	require.EqualError(t, err, errMissingEnv(guestImageEnv).Error())
+	_, err = spec.Revision()
+	require.EqualError(t, err, errMissingEnv(revisionEnv).Error())
+
+	// A spec without a config has no environment
+	_, err = NewFunctionSpec(nil).Image()
+	require.Error(t, err, "image of a spec without a config was found")
+}
+
+func TestFunctionSpecBool(t *testing.T) {
+	cases := []struct {
+		name      string
+		envs      []*criapi.KeyValue
+		def       bool
+		expect    bool
+		expectErr bool
+	}{
+		{name: "UnsetDefaultFalse"},
+		{name: "UnsetDefaultTrue", def: true, expect: true},
+		{name: "True", envs: []*criapi.KeyValue{{Key: "FLAG", Value: "true"}}, expect: true},
+		{name: "False", envs: []*criapi.KeyValue{{Key: "FLAG", Value: "0"}}, def: true},
+		{name: "Invalid", envs: []*criapi.KeyValue{{Key: "FLAG", Value: "maybe"}}, expectErr: true},
+		{name: "OtherKey", envs: []*criapi.KeyValue{{Key: "OTHER", Value: "true"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			value, err := newFunctionSpec(c.envs...).Bool("FLAG", c.def)
+			if c.expectErr {
+				require.Error(t, err, "invalid value was accepted")
+				require.Contains(t, err.Error(), "FLAG", "error does not name the env")
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, c.expect, value)
+		})
+	}
+}
+
+func TestFunctionSpecRateLimit(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     string
+		expect    uint64
+		expectErr bool
+	}{
+		{name: "Unset"},
+		{name: "Limit", value: "100", expect: 100},
+		{name: "Zero", value: "0"},
+		{name: "Negative", value: "-1", expectErr: true},
+		{name: "Overflow", value: "4294967296", expectErr: true},
+		{name: "Invalid", value: "fast", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			limit, err := newFunctionSpec(&criapi.KeyValue{Key: guestNetOpsEnv, Value: c.value}).RateLimit(guestNetOpsEnv)
+			if c.expectErr {
+				require.Error(t, err, "invalid limit was accepted")
+				require.Contains(t, err.Error(), guestNetOpsEnv, "error does not name the env")
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, c.expect, limit)
+		})
+	}
+}
+
+func TestFunctionSpecSwapMib(t *testing.T) {
+	mib, err := newFunctionSpec().SwapMib()
+	require.NoError(t, err)
+	require.Zero(t, mib, "swap is enabled by default")
+
+	mib, err = newFunctionSpec(&criapi.KeyValue{Key: guestSwapEnv, Value: "256"}).SwapMib()
+	require.NoError(t, err)
+	require.Equal(t, uint32(256), mib)
+
+	for _, value := range []string{"-1", "1G", "4294967296"} {
+		_, err = newFunctionSpec(&criapi.KeyValue{Key: guestSwapEnv, Value: value}).SwapMib()
+		require.Error(t, err, "invalid swap %q was accepted", value)
+	}
+}
+
+func TestFunctionSpecRootfsDigest(t *testing.T) {
+	digest, err := newFunctionSpec().RootfsDigest()
+	require.NoError(t, err)
+	require.Empty(t, digest, "rootfs is verified by default")
+
+	digest, err = newFunctionSpec(&criapi.KeyValue{Key: guestRootfsVerifyEnv, Value: testDigest1}).RootfsDigest()
+	require.NoError(t, err)
+	require.Equal(t, testDigest1, digest)
+
+	// An empty digest is set but invalid
+	for _, value := range []string{"", "sha256:abc", "md5:" + strings.Repeat("1", 32)} {
+		_, err = newFunctionSpec(&criapi.KeyValue{Key: guestRootfsVerifyEnv, Value: value}).RootfsDigest()
+		require.Error(t, err, "invalid digest %q was accepted", value)
+	}
+}
+
+func TestFunctionSpecTransport(t *testing.T) {
+	transport, err := newFunctionSpec().Transport()
+	require.NoError(t, err)
+	require.Equal(t, guestTransportTCP, transport, "transport is not tcp by default")
+
+	transport, err = newFunctionSpec(&criapi.KeyValue{Key: guestTransportEnv, Value: guestTransportVsock}).Transport()
+	require.NoError(t, err)
+	require.Equal(t, guestTransportVsock, transport)
+
+	_, err = newFunctionSpec(&criapi.KeyValue{Key: guestTransportEnv, Value: "udp"}).Transport()
+	require.Error(t, err, "invalid transport was accepted")
+}
+
+func TestParseFunctionSpec(t *testing.T) {
+	cases := []struct {
+		name           string
+		envs           map[string]string
+		annotations    map[string]string
+		snapshots      bool
+		expectFields   []string
+		expectWarnings int
+	}{
+		{
+			name: "Valid",
+			envs: map[string]string{guestImageEnv: "ghcr.io/ease-lab/helloworld:var_workload", revisionEnv: "helloworld-00001"},
+		},
+		{
+			name: "Multiple invalid",
+			envs: map[string]string{
+				guestImageEnv:    "ease-lab/Hello World",
+				guestPrefaultEnv: "maybe",
+				guestKernelEnv:   "/tmp/vmlinux",
+			},
+			annotations: map[string]string{
+				cpuBoostAnnotation: "100",
+				probeAnnotation:    "udp",
+			},
+			expectFields: []string{guestImageEnv, revisionEnv, guestPrefaultEnv, guestKernelEnv, cpuBoostAnnotation, probeAnnotation},
+		},
+		{
+			name:         "Missing image",
+			envs:         map[string]string{revisionEnv: "helloworld-00001", scaleToZeroEnv: "yes"},
+			expectFields: []string{guestImageEnv, scaleToZeroEnv},
+		},
+		{
+			name:         "Extra disk with snapshots",
+			envs:         map[string]string{guestImageEnv: "img", revisionEnv: "img-00001", guestClockSyncEnv: "never"},
+			annotations:  map[string]string{extraDiskSizeAnnotation: "1"},
+			snapshots:    true,
+			expectFields: []string{guestClockSyncEnv, extraDiskSizeAnnotation},
+		},
+		{
+			name:         "REAP with hugepages",
+			envs:         map[string]string{guestImageEnv: "img", revisionEnv: "img-00001", guestREAPEnv: "true", guestHugepagesEnv: "true"},
+			snapshots:    true,
+			expectFields: []string{guestREAPEnv},
+		},
+		{
+			name:           "REAP without snapshots",
+			envs:           map[string]string{guestImageEnv: "img", revisionEnv: "img-00001", guestREAPEnv: "true"},
+			expectWarnings: 1,
+		},
+		{
+			name:           "Scale to zero without snapshots",
+			envs:           map[string]string{guestImageEnv: "img", revisionEnv: "img-00001", scaleToZeroEnv: "true"},
+			expectWarnings: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = c.snapshots
+			s := newTestService(nil, orch)
+
+			r := &criapi.CreateContainerRequest{
+				Config: &criapi.ContainerConfig{Annotations: c.annotations},
+			}
+			for k, v := range c.envs {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: k, Value: v})
+			}
+
+			spec, err := s.parseFunctionSpec(r, s.coordinator.config.get())
+			if len(c.expectFields) == 0 {
+				require.NoError(t, err, "valid spec was rejected")
+				require.Len(t, spec.warnings, c.expectWarnings, "unexpected warnings")
+				return
+			}
+
+			var problems SpecErrors
+			require.True(t, errors.As(err, &problems), "problems were not reported as SpecErrors")
+
+			var fields []string
+			for _, p := range problems {
+				fields = append(fields, p.Field)
+			}
+			require.ElementsMatch(t, c.expectFields, fields, "problems were not all reported")
+		})
+	}
+}
+
+func TestCreateUserContainerInvalidSpec(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs,
+		&criapi.KeyValue{Key: guestPrefaultEnv, Value: "maybe"},
+		&criapi.KeyValue{Key: guestImageCachedEnv, Value: "perhaps"},
+	)
+
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Error(t, err, "container creation did not fail")
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error code")
+
+	msg := status.Convert(err).Message()
+	require.True(t, strings.Contains(msg, guestPrefaultEnv) && strings.Contains(msg, guestImageCachedEnv),
+		"error does not list all the problems: %s", msg)
+	require.Contains(t, msg, "sandbox pod", "error does not identify the container")
+
+	var specErr *SpecValidationError
+	require.True(t, errors.As(err, &specErr), "problems were not reported as a SpecValidationError")
+	require.Equal(t, "pod", specErr.SandboxID)
+	require.Equal(t, userContainerName, specErr.Container)
+	require.ElementsMatch(t, []string{guestPrefaultEnv, guestImageCachedEnv}, specErr.Fields())
+	require.Equal(t, 0, orch.NumStarted(), "VM was started for an invalid spec")
+}
+
+func TestMissingEnvProblems(t *testing.T) {
+	s := newTestService(nil, fakes.NewOrchestrator())
+
+	r := &criapi.CreateContainerRequest{
+		PodSandboxId: "pod",
+		Config: &criapi.ContainerConfig{
+			Metadata: &criapi.ContainerMetadata{Name: userContainerName, Attempt: 2},
+			Envs:     []*criapi.KeyValue{{Key: guestImageEnv, Value: ""}},
+		},
+	}
+
+	_, err := s.parseFunctionSpec(r, s.coordinator.config.get())
+	var problems SpecErrors
+	require.True(t, errors.As(err, &problems), "problems were not reported as SpecErrors")
+
+	specErr := newSpecValidationError(r, problems)
+	require.ElementsMatch(t, []string{guestImageEnv, revisionEnv}, specErr.Fields())
+	for _, p := range problems {
+		require.Contains(t, p.Message, p.Field, "problem does not name its env key")
+	}
+	require.Contains(t, specErr.Error(), "attempt 2")
+	require.Equal(t, codes.InvalidArgument, status.Code(specErr))
+}
+
+func TestAdminValidateFunctionSpec(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(nil, orch)
+	client := newAdminClient(t, s)
+	ctx := context.Background()
+
+	resp, err := client.ValidateFunctionSpec(ctx, &adminpb.ValidateFunctionSpecReq{
+		Envs: []*adminpb.KeyValue{
+			{Key: guestImageEnv, Value: "img"},
+			{Key: revisionEnv, Value: "img-00001"},
+			{Key: scaleToZeroEnv, Value: "true"},
+		},
+	})
+	require.NoError(t, err, "failed to validate spec")
+	require.True(t, resp.Valid, "valid spec was rejected")
+	require.Empty(t, resp.Problems, "valid spec has problems")
+	require.Len(t, resp.Warnings, 1, "scale-to-zero without snapshots was not warned about")
+
+	resp, err = client.ValidateFunctionSpec(ctx, &adminpb.ValidateFunctionSpecReq{
+		Envs: []*adminpb.KeyValue{
+			{Key: guestImageEnv, Value: "img"},
+			{Key: guestClockSyncEnv, Value: "sometimes"},
+		},
+		Annotations: []*adminpb.KeyValue{
+			{Key: hugepagesAnnotation, Value: "lots"},
+		},
+	})
+	require.NoError(t, err, "failed to validate spec")
+	require.False(t, resp.Valid, "invalid spec was accepted")
+
+	var fields []string
+	for _, p := range resp.Problems {
+		fields = append(fields, p.Field)
+	}
+	require.ElementsMatch(t, []string{revisionEnv, guestClockSyncEnv, hugepagesAnnotation}, fields, "problems were not all reported")
+	require.Equal(t, 0, orch.NumStarted(), "VM was started for validation")
+}
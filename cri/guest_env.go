@@ -0,0 +1,83 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxGuestEnvSize is the limit on the total size of the environment
+	// passed to the function in the VM, well below the usual ARG_MAX
+	maxGuestEnvSize = 128 * 1024
+	// portEnv is the port Knative tells the user container to listen on
+	portEnv = "PORT"
+	// vHiveEnvPrefix is reserved for the environment consumed by vHive,
+	// e.g. GUEST_IMAGE, which is not passed to the guest
+	vHiveEnvPrefix = "GUEST_"
+)
+
+// Env returns the environment of the user container that is passed
+// to the function in the VM, in the KEY=VALUE form. Values are delivered verbatim,
+// including newlines and unicode, since the OCI spec of the guest container is JSON.
+//
+// The environment of the user container overrides the one of the image for the
+// same keys, except for the GUEST_* keys reserved for vHive, which never reach
+// the guest, and PORT, which is always the guest port the function listens on in the VM.
+func (f FunctionSpec) Env(guestPort string) ([]string, error) {
+	var (
+		env  []string
+		size int
+	)
+
+	for _, kv := range f.envs {
+		key, value := kv.GetKey(), kv.GetValue()
+		if strings.HasPrefix(key, vHiveEnvPrefix) {
+			continue
+		}
+
+		// The function serves on the guest port, not on the port of the placeholder container
+		if key == portEnv {
+			value = guestPort
+		}
+
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return nil, errors.Errorf("invalid environment variable name %q", key)
+		}
+		if strings.ContainsRune(value, 0) {
+			return nil, errors.Errorf("environment variable %s contains a NUL character", key)
+		}
+
+		entry := key + "=" + value
+		size += len(entry) + 1
+		if size > maxGuestEnvSize {
+			return nil, errors.Errorf("environment exceeds %d bytes", maxGuestEnvSize)
+		}
+
+		env = append(env, entry)
+	}
+
+	return env, nil
+}
@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/oci"
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGuestEnvRoundTrip(t *testing.T) {
+	userEnv := map[string]string{
+		"DATABASE_URL": "postgres://user:p=ss@db:5432/app?sslmode=disable",
+		"MULTILINE":    "-----BEGIN KEY-----\nabc\ndef\n-----END KEY-----\n",
+		"UNICODE":      "héllo, 世界 🚀",
+		"QUOTES":       `"double" 'single' \backslash $HOME`,
+		"EMPTY":        "",
+		"K_REVISION":   "img-00001",
+	}
+
+	config := &criapi.ContainerConfig{
+		Envs: []*criapi.KeyValue{
+			{Key: guestImageEnv, Value: "img"},
+			{Key: guestPrefaultEnv, Value: "true"},
+			{Key: portEnv, Value: "8080"},
+		},
+	}
+	for k, v := range userEnv {
+		config.Envs = append(config.Envs, &criapi.KeyValue{Key: k, Value: v})
+	}
+
+	env, err := NewFunctionSpec(config).Env(defaultGuestPort)
+	require.NoError(t, err, "failed to get guest env")
+
+	// The environment reaches the guest as part of the OCI spec of the function container
+	spec := &oci.Spec{Process: &specs.Process{Env: []string{"PATH=/usr/bin", "UNICODE=from image"}}}
+	vmOpts := ctriface.NewStartVMOptions(ctriface.WithEnv(env))
+	require.NoError(t, oci.WithEnv(vmOpts.Env)(context.Background(), nil, nil, spec))
+
+	data, err := json.Marshal(spec)
+	require.NoError(t, err, "failed to serialize spec")
+
+	var guestSpec oci.Spec
+	require.NoError(t, json.Unmarshal(data, &guestSpec), "failed to deserialize spec")
+
+	guestEnv := make(map[string]string)
+	for _, entry := range guestSpec.Process.Env {
+		kv := strings.SplitN(entry, "=", 2)
+		guestEnv[kv[0]] = kv[1]
+	}
+
+	for k, v := range userEnv {
+		require.Equal(t, v, guestEnv[k], "wrong value of %s", k)
+	}
+	require.Equal(t, "/usr/bin", guestEnv["PATH"], "image environment was lost")
+	require.Equal(t, defaultGuestPort, guestEnv[portEnv], "port is not the guest port")
+	require.NotContains(t, guestEnv, guestImageEnv, "vHive environment was passed")
+	require.NotContains(t, guestEnv, guestPrefaultEnv, "vHive environment was passed")
+}
+
+func TestGuestEnvInvalid(t *testing.T) {
+	cases := map[string]*criapi.KeyValue{
+		"Empty name":       {Key: "", Value: "v"},
+		"Name with equals": {Key: "A=B", Value: "v"},
+		"NUL in value":     {Key: "A", Value: "a\x00b"},
+		"Too large":        {Key: "A", Value: strings.Repeat("x", maxGuestEnvSize)},
+	}
+
+	for name, kv := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewFunctionSpec(&criapi.ContainerConfig{Envs: []*criapi.KeyValue{kv}}).Env(defaultGuestPort)
+			require.Error(t, err, "invalid environment was accepted")
+		})
+	}
+}
+
+func TestCreateUserContainerEnv(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs,
+		&criapi.KeyValue{Key: "GREETING", Value: "hello\nworld"},
+		&criapi.KeyValue{Key: "MY_VAR", Value: "42"},
+		&criapi.KeyValue{Key: "GUEST_CUSTOM", Value: "reserved"},
+	)
+
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+	require.Contains(t, orch.StartOpts["1"].Env, "GREETING=hello\nworld", "environment was not passed to the orchestrator")
+	require.Contains(t, orch.StartOpts["1"].Env, "MY_VAR=42", "environment was not passed to the orchestrator")
+	require.NotContains(t, orch.StartOpts["1"].Env, "GUEST_CUSTOM=reserved", "reserved environment was passed to the orchestrator")
+}
+
+func TestGuestEnvPrecedence(t *testing.T) {
+	config := &criapi.ContainerConfig{
+		Envs: []*criapi.KeyValue{
+			{Key: "MY_VAR", Value: "from container"},
+			{Key: "GUEST_CUSTOM", Value: "reserved"},
+			{Key: portEnv, Value: "8080"},
+		},
+	}
+
+	env, err := NewFunctionSpec(config).Env(defaultGuestPort)
+	require.NoError(t, err, "failed to get guest env")
+
+	spec := &oci.Spec{Process: &specs.Process{Env: []string{"MY_VAR=from image", "PORT=80", "GUEST_CUSTOM=from image"}}}
+	require.NoError(t, oci.WithEnv(env)(context.Background(), nil, nil, spec))
+
+	require.ElementsMatch(t, []string{"MY_VAR=from container", "PORT=" + defaultGuestPort, "GUEST_CUSTOM=from image"}, spec.Process.Env,
+		"user container environment does not take precedence over the image")
+}
@@ -0,0 +1,74 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import "strings"
+
+const (
+	// maxHostnameLen is the longest guest hostname, that of a DNS label (RFC 1123)
+	maxHostnameLen = 63
+	// shortIDLen is the length of the short container IDs, as shown by Docker
+	shortIDLen = 12
+)
+
+// getGuestHostname returns the hostname of the VM of a pod, <name>.<namespace>
+// or only the name of the pod if both do not fit in a DNS label. It falls back
+// to the short ID of the pod sandbox container if the pod metadata is unavailable.
+func getGuestHostname(pod *podMetadata, sandboxID string) string {
+	if name := sanitizeHostname(pod.Name); name != "" {
+		namespace := sanitizeHostname(pod.Namespace)
+		if namespace != "" && len(name)+1+len(namespace) <= maxHostnameLen {
+			return name + "." + namespace
+		}
+		return name
+	}
+
+	id := sanitizeHostname(sandboxID)
+	if len(id) > shortIDLen {
+		id = strings.TrimRight(id[:shortIDLen], "-")
+	}
+
+	return id
+}
+
+// sanitizeHostname turns s into a DNS label: lower-case letters, digits and
+// hyphens, without leading or trailing hyphens, of up to maxHostnameLen characters.
+// The other characters are replaced by hyphens.
+func sanitizeHostname(s string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+
+	label := strings.Trim(b.String(), "-")
+	if len(label) > maxHostnameLen {
+		label = strings.TrimRight(label[:maxHostnameLen], "-")
+	}
+
+	return label
+}
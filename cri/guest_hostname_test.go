@@ -0,0 +1,133 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGetGuestHostname(t *testing.T) {
+	longName := strings.Repeat("a", 70)
+	sandboxID := "4f1c0b2d9e8a7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b"
+
+	cases := []struct {
+		name      string
+		pod       podMetadata
+		sandboxID string
+		expected  string
+	}{
+		{
+			name:     "Name and namespace",
+			pod:      podMetadata{Name: "helloworld-00001-deployment-7f9c", Namespace: "default"},
+			expected: "helloworld-00001-deployment-7f9c.default",
+		},
+		{
+			name:     "Invalid characters",
+			pod:      podMetadata{Name: "Hello_World.v2", Namespace: "My Team"},
+			expected: "hello-world-v2.my-team",
+		},
+		{
+			name:     "Leading and trailing hyphens",
+			pod:      podMetadata{Name: "-_fn_-", Namespace: "--"},
+			expected: "fn",
+		},
+		{
+			name:     "Namespace does not fit",
+			pod:      podMetadata{Name: strings.Repeat("a", 60), Namespace: "default"},
+			expected: strings.Repeat("a", 60),
+		},
+		{
+			name:     "Name too long",
+			pod:      podMetadata{Name: longName, Namespace: "default"},
+			expected: longName[:maxHostnameLen],
+		},
+		{
+			name:     "Truncated before a hyphen",
+			pod:      podMetadata{Name: strings.Repeat("a", 62) + "-b"},
+			expected: strings.Repeat("a", 62),
+		},
+		{
+			name:      "No metadata",
+			sandboxID: sandboxID,
+			expected:  sandboxID[:shortIDLen],
+		},
+		{
+			name:      "Name without valid characters",
+			pod:       podMetadata{Name: "___", Namespace: "default"},
+			sandboxID: sandboxID,
+			expected:  sandboxID[:shortIDLen],
+		},
+		{
+			name: "Nothing",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hostname := getGuestHostname(&c.pod, c.sandboxID)
+			require.Equal(t, c.expected, hostname)
+			require.LessOrEqual(t, len(hostname), maxHostnameLen, "hostname is too long")
+		})
+	}
+}
+
+func TestCreateUserContainerHostname(t *testing.T) {
+	cases := []struct {
+		name     string
+		sandbox  *criapi.PodSandboxConfig
+		expected string
+	}{
+		{
+			name: "Pod metadata",
+			sandbox: &criapi.PodSandboxConfig{
+				Metadata: &criapi.PodSandboxMetadata{Name: "Helloworld_00001", Namespace: "default"},
+			},
+			expected: "helloworld-00001.default",
+		},
+		{
+			name:     "No pod metadata",
+			expected: "0123456789ab",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("0123456789abcdef", "img")
+			r.SandboxConfig = c.sandbox
+
+			_, err := s.CreateContainer(context.Background(), r)
+			require.NoError(t, err, "container creation failed")
+
+			require.Equal(t, c.expected, orch.StartOpts["1"].Hostname, "wrong guest hostname")
+		})
+	}
+}
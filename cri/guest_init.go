@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// guestInitCmdEnv boots the VM into the given command instead of the init of
+// the guest image, e.g., a shell for debugging. It is refused unless the
+// allowDebugInit configuration is set.
+const guestInitCmdEnv = "GUEST_INIT_CMD"
+
+// InitCmd returns the command the VM of the function boots into
+// instead of its init, nil if not overridden. The command is split on spaces
+// and passed on the kernel command line, so it cannot quote its arguments.
+func (f FunctionSpec) InitCmd(allowDebugInit bool) ([]string, error) {
+	var value string
+	for _, kv := range f.envs {
+		if kv.GetKey() == guestInitCmdEnv {
+			value = kv.GetValue()
+		}
+	}
+
+	cmd := strings.Fields(value)
+	if len(cmd) == 0 {
+		return nil, nil
+	}
+	if !allowDebugInit {
+		return nil, fmt.Errorf("%s is refused, the guest init may only be overridden with allowDebugInit configured", guestInitCmdEnv)
+	}
+	if !path.IsAbs(cmd[0]) {
+		return nil, fmt.Errorf("%s must start with an absolute path, got %q", guestInitCmdEnv, cmd[0])
+	}
+	for _, arg := range cmd {
+		if strings.ContainsAny(arg, "\"'\\") || strings.IndexFunc(arg, isNotPrintableASCII) >= 0 {
+			return nil, fmt.Errorf("%s argument %q must be printable ASCII without quotes or backslashes", guestInitCmdEnv, arg)
+		}
+	}
+
+	return cmd, nil
+}
+
+func isNotPrintableASCII(r rune) bool {
+	return r < '!' || r > '~'
+}
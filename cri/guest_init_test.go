@@ -0,0 +1,112 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newDebugInitRequest(podID, initCmd string) *criapi.CreateContainerRequest {
+	r := newUserContainerRequest(podID, "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestInitCmdEnv, Value: initCmd})
+	return r
+}
+
+func TestFunctionSpecInitCmd(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		allow    bool
+		expected []string
+		fails    bool
+	}{
+		{name: "Unset", allow: false},
+		{name: "Refused", value: "/bin/sh", allow: false, fails: true},
+		{name: "Shell", value: "/bin/sh", allow: true, expected: []string{"/bin/sh"}},
+		{name: "Arguments", value: " /bin/busybox  sh -i ", allow: true, expected: []string{"/bin/busybox", "sh", "-i"}},
+		{name: "Relative", value: "sh", allow: true, fails: true},
+		{name: "Quoted", value: `/bin/sh -c "echo hi"`, allow: true, fails: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := &criapi.ContainerConfig{}
+			if c.value != "" {
+				config.Envs = []*criapi.KeyValue{{Key: guestInitCmdEnv, Value: c.value}}
+			}
+
+			cmd, err := NewFunctionSpec(config).InitCmd(c.allow)
+			if c.fails {
+				require.Error(t, err, "invalid init command was accepted")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, cmd)
+		})
+	}
+}
+
+func TestDebugInitRefusedByDefault(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(context.Background(), newDebugInitRequest("pod1", "/bin/sh"))
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "debug init was not refused: %v", err)
+
+	specErr, ok := err.(*SpecValidationError)
+	require.True(t, ok, "unexpected error: %v", err)
+	require.Equal(t, []string{guestInitCmdEnv}, specErr.Fields())
+	require.Zero(t, orch.NumStarted(), "VM was started with a refused debug init")
+}
+
+func TestDebugInitAllowed(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	cfg := DefaultConfig()
+	cfg.AllowDebugInit = true
+	s.coordinator.config.set(cfg)
+
+	resp, err := s.CreateContainer(context.Background(), newDebugInitRequest("pod1", "/bin/sh -i"))
+	require.NoError(t, err, "container creation failed")
+
+	fi, ok := s.coordinator.getInstance(resp.ContainerId)
+	require.True(t, ok)
+	require.Equal(t, []string{"/bin/sh", "-i"}, orch.StartOpts[fi.vmID].InitCmd, "VM was not booted into the debug init")
+
+	// The debug VM is stopped rather than offloaded for the next VMs of the image
+	_, err = s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: resp.ContainerId})
+	require.NoError(t, err, "container removal failed")
+	require.Eventually(t, func() bool { return orch.NumStopped(fi.vmID) == 1 }, time.Second, time.Millisecond,
+		"debug VM was not stopped")
+	require.Nil(t, s.coordinator.getIdleInstance("img"), "debug VM was kept for reuse")
+}
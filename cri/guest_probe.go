@@ -0,0 +1,301 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// probeAnnotation probes the function in the VMs of the revision with
+	// a gRPC health check, a TCP connect or an HTTP GET
+	probeAnnotation          = "vhive.io/probe"
+	probePortAnnotation      = "vhive.io/probe-port"
+	probePathAnnotation      = "vhive.io/probe-path"
+	probePeriodAnnotation    = "vhive.io/probe-period"
+	probeThresholdAnnotation = "vhive.io/probe-failure-threshold"
+	// probeRestartAnnotation stops the container of an unhealthy instance,
+	// so that the restart policy of the pod applies
+	probeRestartAnnotation = "vhive.io/probe-restart"
+
+	probeGRPC = "grpc"
+	probeTCP  = "tcp"
+	probeHTTP = "http"
+
+	maxProbeTimeout = time.Second
+
+	// probeExecCommand is answered by vHive instead of the container, so that
+	// kubelet exec probes report the health of the function in the VM
+	probeExecCommand = "vhive-probe"
+
+	guestUnhealthyReason = "GuestUnhealthy"
+)
+
+// guestProbe checks the health of the function in a VM
+type guestProbe struct {
+	kind      string
+	port      string
+	path      string
+	period    time.Duration
+	threshold int32
+	restart   bool
+}
+
+// getGuestProbe returns the probe configured by the annotations of the
+// revision, nil if there is none. The settings without annotations are
+// taken from cfg, with the probe targeting the guest port.
+func getGuestProbe(r *criapi.CreateContainerRequest, cfg *Config) (*guestProbe, error) {
+	annotations := getAnnotations(r)
+
+	kind, ok := annotations[probeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	p := &guestProbe{
+		kind:      kind,
+		port:      cfg.GuestPort,
+		path:      "/",
+		period:    cfg.ProbePeriod,
+		threshold: cfg.ProbeFailureThreshold,
+	}
+
+	switch kind {
+	case probeGRPC, probeTCP, probeHTTP:
+	default:
+		return nil, fmt.Errorf("invalid %s annotation %q, must be %s, %s or %s", probeAnnotation, kind, probeGRPC, probeTCP, probeHTTP)
+	}
+
+	if value, ok := annotations[probePortAnnotation]; ok {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid %s annotation %q", probePortAnnotation, value)
+		}
+		p.port = value
+	}
+
+	if value, ok := annotations[probePathAnnotation]; ok {
+		if !strings.HasPrefix(value, "/") {
+			return nil, fmt.Errorf("invalid %s annotation %q, must be an absolute path", probePathAnnotation, value)
+		}
+		p.path = value
+	}
+
+	if value, ok := annotations[probePeriodAnnotation]; ok {
+		var err error
+		if p.period, err = time.ParseDuration(value); err != nil || p.period <= 0 {
+			return nil, fmt.Errorf("invalid %s annotation %q", probePeriodAnnotation, value)
+		}
+	}
+
+	if value, ok := annotations[probeThresholdAnnotation]; ok {
+		threshold, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || threshold < 1 {
+			return nil, fmt.Errorf("invalid %s annotation %q", probeThresholdAnnotation, value)
+		}
+		p.threshold = int32(threshold)
+	}
+
+	if value, ok := annotations[probeRestartAnnotation]; ok {
+		var err error
+		if p.restart, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation %q", probeRestartAnnotation, value)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *guestProbe) String() string {
+	if p.kind == probeHTTP {
+		return fmt.Sprintf("%s probe of port %s%s", p.kind, p.port, p.path)
+	}
+
+	return fmt.Sprintf("%s probe of port %s", p.kind, p.port)
+}
+
+// timeout returns the timeout of a single check
+func (p *guestProbe) timeout() time.Duration {
+	if p.period < maxProbeTimeout {
+		return p.period
+	}
+
+	return maxProbeTimeout
+}
+
+// probeHTTPClient does not keep the connections to the guests alive
+var probeHTTPClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// check probes the function in the VM with the given IP once
+func (p *guestProbe) check(ctx context.Context, guestIP string) error {
+	addr := net.JoinHostPort(guestIP, p.port)
+
+	switch p.kind {
+	case probeGRPC:
+		conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("health status is %s", resp.GetStatus())
+		}
+	case probeTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case probeHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+p.path, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := probeHTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("HTTP status is %d", resp.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+// startProbe probes the instance every period in the background,
+// for as long as it is attached to the container
+func (s *Service) startProbe(containerID string, fi *funcInstance, p *guestProbe) {
+	s.background.Add(1)
+
+	go func() {
+		defer s.background.Done()
+
+		ticker := time.NewTicker(p.period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if active, ok := s.coordinator.getInstance(containerID); !ok || active != fi {
+				return
+			}
+			if state, _ := fi.history.get(); state != vmStateRunning {
+				continue
+			}
+
+			if restarted := s.probeInstance(containerID, fi, p); restarted {
+				return
+			}
+		}
+	}()
+}
+
+// probeInstance probes the instance once, returning true if its container
+// was stopped to be restarted
+func (s *Service) probeInstance(containerID string, fi *funcInstance, p *guestProbe) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	err := p.check(ctx, fi.startVMResponse.GuestIP)
+	cancel()
+
+	unhealthy, recovered := fi.recordProbe(err == nil, p.threshold)
+	if recovered {
+		fi.logger.Info("function is healthy again")
+		fi.history.record(eventHealthy, "%s succeeded", p)
+	}
+	if !unhealthy {
+		return false
+	}
+
+	fi.logger.WithError(err).Warnf("%s failed %d consecutive times", p, p.threshold)
+	fi.history.warn(eventUnhealthy, "%s failed %d consecutive times: %v", p, p.threshold, err)
+
+	if !p.restart {
+		return false
+	}
+
+	fi.logger.Warn("stopping the container of the unhealthy function to restart it")
+	if _, err := s.stockRuntimeClient.StopContainer(context.Background(), &criapi.StopContainerRequest{ContainerId: containerID}); err != nil {
+		fi.logger.WithError(err).Error("failed to stop the container of the unhealthy function")
+		return false
+	}
+
+	return true
+}
+
+// recordProbe records the result of a probe of the function, returning
+// whether the function just became unhealthy or recovered
+func (f *funcInstance) recordProbe(healthy bool, threshold int32) (unhealthy, recovered bool) {
+	if healthy {
+		return false, atomic.SwapInt32(&f.probeFailures, 0) >= threshold
+	}
+
+	return atomic.AddInt32(&f.probeFailures, 1) == threshold, false
+}
+
+// isProbeFailing returns true if the latest probes of the function failed
+func (f *funcInstance) isProbeFailing() bool {
+	return f.probe != nil && atomic.LoadInt32(&f.probeFailures) >= f.probe.threshold
+}
+
+// execProbe answers the probe exec command for the container of a function
+// instance, returning false if the request is for another command or container
+func (s *Service) execProbe(r *criapi.ExecSyncRequest) (*criapi.ExecSyncResponse, bool) {
+	if len(r.GetCmd()) != 1 || r.GetCmd()[0] != probeExecCommand {
+		return nil, false
+	}
+
+	fi, ok := s.coordinator.getInstance(r.GetContainerId())
+	if !ok {
+		return nil, false
+	}
+
+	if fi.isUnhealthy() {
+		return &criapi.ExecSyncResponse{Stderr: []byte("function is unhealthy\n"), ExitCode: 1}, true
+	}
+
+	return &criapi.ExecSyncResponse{Stdout: []byte("function is healthy\n")}, true
+}
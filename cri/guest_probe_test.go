@@ -0,0 +1,289 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// fakeGuest serves the probes of a function whose health is toggled
+type fakeGuest struct {
+	healthy int32
+	addr    string
+	stop    func()
+	// toggle changes the health of the guest if set
+	toggle func(healthy bool)
+
+	mu  sync.Mutex
+	lis net.Listener
+}
+
+func newFakeGuest(t *testing.T, kind string) *fakeGuest {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "failed to listen")
+
+	g := &fakeGuest{healthy: 1, addr: lis.Addr().String(), lis: lis}
+
+	switch kind {
+	case probeGRPC:
+		hs := health.NewServer()
+		server := grpc.NewServer()
+		healthpb.RegisterHealthServer(server, hs)
+		go func() {
+			_ = server.Serve(lis)
+		}()
+
+		// The serving status follows the toggled health
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(5 * time.Millisecond):
+				}
+				status := healthpb.HealthCheckResponse_NOT_SERVING
+				if atomic.LoadInt32(&g.healthy) == 1 {
+					status = healthpb.HealthCheckResponse_SERVING
+				}
+				hs.SetServingStatus("", status)
+			}
+		}()
+		g.stop = func() { close(done); server.Stop() }
+	case probeTCP:
+		// The guest stops listening while it is unhealthy
+		g.toggle = func(healthy bool) {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+
+			if !healthy {
+				g.lis.Close()
+				return
+			}
+			lis, err := net.Listen("tcp", g.addr)
+			require.NoError(t, err, "failed to listen again")
+			g.lis = lis
+		}
+		g.stop = func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.lis.Close()
+		}
+	case probeHTTP:
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/healthz" || atomic.LoadInt32(&g.healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})}
+		go func() {
+			_ = server.Serve(lis)
+		}()
+		g.stop = func() { server.Close() }
+	}
+
+	t.Cleanup(g.stop)
+
+	return g
+}
+
+func (g *fakeGuest) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&g.healthy, v)
+
+	if g.toggle != nil {
+		g.toggle(healthy)
+	}
+}
+
+func (g *fakeGuest) port() string {
+	_, port, _ := net.SplitHostPort(g.addr)
+	return port
+}
+
+func newProbedContainerRequest(podID string, annotations map[string]string) *criapi.CreateContainerRequest {
+	r := newUserContainerRequest(podID, "img")
+	r.Config.Annotations = annotations
+	return r
+}
+
+func TestGetGuestProbe(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expectErr   bool
+		expect      *guestProbe
+	}{
+		{name: "Unset"},
+		{
+			name:        "Defaults",
+			annotations: map[string]string{probeAnnotation: probeGRPC},
+			expect:      &guestProbe{kind: probeGRPC, port: defaultGuestPort, path: "/", period: defaultProbePeriod, threshold: defaultProbeThreshold},
+		},
+		{
+			name: "Configured",
+			annotations: map[string]string{
+				probeAnnotation:          probeHTTP,
+				probePortAnnotation:      "8080",
+				probePathAnnotation:      "/healthz",
+				probePeriodAnnotation:    "2s",
+				probeThresholdAnnotation: "5",
+				probeRestartAnnotation:   "true",
+			},
+			expect: &guestProbe{kind: probeHTTP, port: "8080", path: "/healthz", period: 2 * time.Second, threshold: 5, restart: true},
+		},
+		{name: "Invalid kind", annotations: map[string]string{probeAnnotation: "exec"}, expectErr: true},
+		{name: "Invalid port", annotations: map[string]string{probeAnnotation: probeTCP, probePortAnnotation: "70000"}, expectErr: true},
+		{name: "Relative path", annotations: map[string]string{probeAnnotation: probeHTTP, probePathAnnotation: "healthz"}, expectErr: true},
+		{name: "Invalid period", annotations: map[string]string{probeAnnotation: probeTCP, probePeriodAnnotation: "0s"}, expectErr: true},
+		{name: "Invalid threshold", annotations: map[string]string{probeAnnotation: probeTCP, probeThresholdAnnotation: "0"}, expectErr: true},
+		{name: "Invalid restart", annotations: map[string]string{probeAnnotation: probeTCP, probeRestartAnnotation: "maybe"}, expectErr: true},
+	}
+
+	cfg := DefaultConfig()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := getGuestProbe(newProbedContainerRequest("pod", c.annotations), &cfg)
+			if c.expectErr {
+				require.Error(t, err, "invalid probe was accepted")
+				return
+			}
+
+			require.NoError(t, err, "failed to parse probe")
+			require.Equal(t, c.expect, p, "unexpected probe")
+		})
+	}
+}
+
+func TestGuestProbe(t *testing.T) {
+	for _, kind := range []string{probeGRPC, probeTCP, probeHTTP} {
+		t.Run(kind, func(t *testing.T) {
+			guest := newFakeGuest(t, kind)
+
+			orch := fakes.NewOrchestrator()
+			orch.GuestIP = "127.0.0.1"
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+			defer s.Shutdown()
+
+			r := newProbedContainerRequest("pod", map[string]string{
+				probeAnnotation:          kind,
+				probePortAnnotation:      guest.port(),
+				probePathAnnotation:      "/healthz",
+				probePeriodAnnotation:    "20ms",
+				probeThresholdAnnotation: "2",
+			})
+			resp, err := s.CreateContainer(context.Background(), r)
+			require.NoError(t, err, "container creation failed")
+			containerID := resp.GetContainerId()
+
+			reason := func() string {
+				resp, err := s.ContainerStatus(context.Background(), &criapi.ContainerStatusRequest{ContainerId: containerID})
+				require.NoError(t, err, "failed to get container status")
+				return resp.GetStatus().GetReason()
+			}
+			execProbe := func() int32 {
+				resp, err := s.ExecSync(context.Background(), &criapi.ExecSyncRequest{ContainerId: containerID, Cmd: []string{probeExecCommand}})
+				require.NoError(t, err, "probe exec failed")
+				return resp.GetExitCode()
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			require.Empty(t, reason(), "healthy function was reported unhealthy")
+			require.Zero(t, execProbe(), "probe exec of healthy function failed")
+
+			guest.setHealthy(false)
+			require.Eventually(t, func() bool {
+				return reason() == guestUnhealthyReason
+			}, 5*time.Second, 10*time.Millisecond, "unhealthy function was not reported")
+			require.Equal(t, int32(1), execProbe(), "probe exec of unhealthy function succeeded")
+
+			fi, ok := s.coordinator.getInstance(containerID)
+			require.True(t, ok, "instance is not active")
+			_, events := fi.history.copy()
+			require.Equal(t, eventUnhealthy, events[len(events)-1].Type, "unhealthy event was not recorded")
+			require.True(t, events[len(events)-1].Warning, "unhealthy event is not a warning")
+
+			guest.setHealthy(true)
+			require.Eventually(t, func() bool {
+				return reason() == ""
+			}, 5*time.Second, 10*time.Millisecond, "recovered function was still reported unhealthy")
+			require.Zero(t, execProbe(), "probe exec of recovered function failed")
+		})
+	}
+}
+
+func TestGuestProbeRestart(t *testing.T) {
+	guest := newFakeGuest(t, probeHTTP)
+	guest.setHealthy(false)
+
+	orch := fakes.NewOrchestrator()
+	orch.GuestIP = "127.0.0.1"
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+	defer s.Shutdown()
+
+	r := newProbedContainerRequest("pod", map[string]string{
+		probeAnnotation:          probeHTTP,
+		probePortAnnotation:      guest.port(),
+		probePeriodAnnotation:    "20ms",
+		probeThresholdAnnotation: "2",
+		probeRestartAnnotation:   "true",
+	})
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	require.Eventually(t, func() bool {
+		return stock.NumStopped() == 1
+	}, 5*time.Second, 10*time.Millisecond, "container of unhealthy function was not stopped")
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, stock.NumStopped(), "container was stopped more than once")
+}
+
+func TestExecProbeOtherCommand(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, ok := s.execProbe(&criapi.ExecSyncRequest{ContainerId: "ctr1", Cmd: []string{"ls"}})
+	require.False(t, ok, "other command was answered")
+	_, ok = s.execProbe(&criapi.ExecSyncRequest{ContainerId: "other", Cmd: []string{probeExecCommand}})
+	require.False(t, ok, "probe of other container was answered")
+}
@@ -0,0 +1,115 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"strconv"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// guestTransportEnv is how the queue-proxy reaches the function in the
+	// VM, over the tap network or over the vsock device of the VM
+	guestTransportEnv   = "GUEST_TRANSPORT"
+	guestTransportTCP   = "tcp"
+	guestTransportVsock = "vsock"
+
+	// guestVsockAddrEnv is the vsock address of the function, in the
+	// vsock://<CID>:<port> form, which the queue-proxy gets instead of guestIPEnv
+	guestVsockAddrEnv = "GUEST_VSOCK_ADDR"
+	// guestVsockPathEnv is the host-side Unix socket of the vsock device of the VM,
+	// mounted in the queue-proxy at the same path
+	guestVsockPathEnv = "GUEST_VSOCK_PATH"
+
+	// firstGuestCID is the lowest CID of a VM, the lower ones are reserved
+	// for the hypervisor, the loopback and the host
+	firstGuestCID = 3
+)
+
+// Transport returns the transport of the function, tcp by default
+func (f FunctionSpec) Transport() (string, error) {
+	for _, kv := range f.envs {
+		if kv.GetKey() != guestTransportEnv {
+			continue
+		}
+
+		switch kv.GetValue() {
+		case guestTransportTCP, guestTransportVsock:
+			return kv.GetValue(), nil
+		default:
+			return "", fmt.Errorf("invalid %s value %q, must be %s or %s",
+				guestTransportEnv, kv.GetValue(), guestTransportTCP, guestTransportVsock)
+		}
+	}
+
+	return guestTransportTCP, nil
+}
+
+// guestCID returns the vsock CID of the VM, unique on the node as its vmID.
+// The vsock devices of Firecracker are hybrid, i.e., the host connects to the
+// guest through the Unix socket of the device, the CID naming the VM.
+func guestCID(vmID string) (uint32, error) {
+	id, err := strconv.ParseUint(vmID, 10, 32)
+	if err != nil || id > uint64(^uint32(0))-firstGuestCID {
+		return 0, fmt.Errorf("vmID %q has no vsock CID", vmID)
+	}
+
+	return uint32(id) + firstGuestCID, nil
+}
+
+// vsockVMConfig returns the config of the queue-proxy reaching the function
+// in the VM over its vsock device
+func vsockVMConfig(fi *funcInstance, guestPort string) (*VMConfig, error) {
+	if fi.startVMResponse == nil || fi.startVMResponse.VsockPath == "" {
+		return nil, fmt.Errorf("VM %s has no vsock device", fi.vmID)
+	}
+
+	cid, err := guestCID(fi.vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VMConfig{vsockCID: cid, vsockPath: fi.startVMResponse.VsockPath, guestPort: guestPort}, nil
+}
+
+// queueProxyGuestEnvs returns the environment of the queue-proxy reaching the
+// function, and the mounts of the vsock device of the VM if it reaches it over vsock
+func queueProxyGuestEnvs(vmConfig *VMConfig) ([]*criapi.KeyValue, []*criapi.Mount) {
+	if vmConfig.vsockPath == "" {
+		return []*criapi.KeyValue{
+			{Key: guestIPEnv, Value: vmConfig.guestIP},
+			{Key: guestPortEnv, Value: vmConfig.guestPort},
+		}, nil
+	}
+
+	envs := []*criapi.KeyValue{
+		{Key: guestVsockAddrEnv, Value: vmConfig.vsockAddr()},
+		{Key: guestVsockPathEnv, Value: vmConfig.vsockPath},
+		{Key: guestPortEnv, Value: vmConfig.guestPort},
+	}
+	mounts := []*criapi.Mount{{ContainerPath: vmConfig.vsockPath, HostPath: vmConfig.vsockPath}}
+
+	return envs, mounts
+}
@@ -0,0 +1,132 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGuestCID(t *testing.T) {
+	cid, err := guestCID("1")
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), cid)
+
+	_, err = guestCID("vm")
+	require.Error(t, err)
+	_, err = guestCID("4294967295")
+	require.Error(t, err, "CID overflowed")
+}
+
+func TestQueueProxyGuestTransport(t *testing.T) {
+	const vsockPath = "/run/firecracker-containerd/1/firecracker.vsock"
+
+	for _, tc := range []struct {
+		name        string
+		transport   string
+		expectIP    string
+		expectVsock string
+	}{
+		{name: "Default", expectIP: "190.128.0.1"},
+		{name: "TCP", transport: guestTransportTCP, expectIP: "190.128.0.1"},
+		{name: "Vsock", transport: guestTransportVsock, expectVsock: "vsock://4:50051"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.VsockPath = vsockPath
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if tc.transport != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestTransportEnv, Value: tc.transport})
+			}
+			_, err := s.CreateContainer(context.Background(), r)
+			require.NoError(t, err, "user container creation failed")
+
+			qp := newQueueProxyRequest("pod")
+			_, err = s.CreateContainer(context.Background(), qp)
+			require.NoError(t, err, "queue-proxy creation failed")
+
+			port, _ := getEnv(qp, guestPortEnv)
+			require.Equal(t, defaultGuestPort, port)
+
+			addr, hasAddr := getEnv(qp, guestIPEnv)
+			vsockAddr, hasVsockAddr := getEnv(qp, guestVsockAddrEnv)
+			path, _ := getEnv(qp, guestVsockPathEnv)
+			if tc.expectVsock == "" {
+				require.Equal(t, tc.expectIP, addr)
+				require.False(t, hasVsockAddr, "queue-proxy got a vsock address over TCP")
+				require.Empty(t, qp.Config.Mounts)
+				return
+			}
+
+			require.False(t, hasAddr, "queue-proxy got a guest IP over vsock")
+			require.Equal(t, tc.expectVsock, vsockAddr)
+			require.Equal(t, vsockPath, path)
+			require.Equal(t, []*criapi.Mount{{ContainerPath: vsockPath, HostPath: vsockPath}}, qp.Config.Mounts,
+				"vsock device of the VM is not mounted in the queue-proxy")
+		})
+	}
+}
+
+func TestGuestTransportInvalid(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestTransportEnv, Value: "udp"})
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+	require.Zero(t, orch.NumStarted(), "VM was started")
+
+	// A connection proxy only reaches the guest at its IP
+	r = newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestTransportEnv, Value: guestTransportVsock})
+	r.Config.Annotations = map[string]string{connProxyAnnotation: "true"}
+	_, err = s.CreateContainer(context.Background(), r)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+
+	specErr, ok := err.(*SpecValidationError)
+	require.True(t, ok, "expected a spec validation error, got %v", err)
+	require.Equal(t, []string{connProxyAnnotation}, specErr.Fields())
+	require.Zero(t, orch.NumStarted(), "VM was started")
+}
+
+func TestGuestTransportVsockWithoutDevice(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestTransportEnv, Value: guestTransportVsock})
+	_, err := s.CreateContainer(context.Background(), r)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "unexpected error: %v", err)
+	require.Contains(t, err.Error(), "has no vsock device")
+	requireNoLeaks(t, s, orch, stock)
+}
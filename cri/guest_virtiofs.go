@@ -0,0 +1,102 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ease-lab/vhive/ctriface"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// guestVirtiofsMountsEnv lists the host directories shared with the VM, as a
+// JSON list of {"hostPath": ..., "guestPath": ..., "readOnly": ...}
+const guestVirtiofsMountsEnv = "GUEST_VIRTIOFS_MOUNTS"
+
+// virtiofsMountSpec is a mount of GUEST_VIRTIOFS_MOUNTS
+type virtiofsMountSpec struct {
+	HostPath  string `json:"hostPath"`
+	GuestPath string `json:"guestPath"`
+	// ReadOnly defaults to true, writable mounts must be allowed with WithWritableVirtiofsMounts
+	ReadOnly *bool `json:"readOnly"`
+}
+
+// getGuestVirtiofsMounts returns the host directories shared with the VM of
+// the function, checking that they exist and are read-only unless writable
+// mounts are allowed on the node
+func (s *Service) getGuestVirtiofsMounts(config *criapi.ContainerConfig) ([]ctriface.VirtiofsMount, error) {
+	var value string
+	for _, kv := range config.GetEnvs() {
+		if kv.GetKey() == guestVirtiofsMountsEnv {
+			value = kv.GetValue()
+		}
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var specs []virtiofsMountSpec
+	if err := json.Unmarshal([]byte(value), &specs); err != nil {
+		return nil, fmt.Errorf("invalid %s value: %v", guestVirtiofsMountsEnv, err)
+	}
+
+	mounts := make([]ctriface.VirtiofsMount, 0, len(specs))
+	guestPaths := make(map[string]bool, len(specs))
+
+	for _, spec := range specs {
+		if !filepath.IsAbs(spec.HostPath) {
+			return nil, fmt.Errorf("host path %q of %s is not absolute", spec.HostPath, guestVirtiofsMountsEnv)
+		}
+		if info, err := os.Stat(spec.HostPath); err != nil {
+			return nil, fmt.Errorf("host path %q of %s does not exist", spec.HostPath, guestVirtiofsMountsEnv)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("host path %q of %s is not a directory", spec.HostPath, guestVirtiofsMountsEnv)
+		}
+
+		guestPath := filepath.Clean(spec.GuestPath)
+		if !filepath.IsAbs(spec.GuestPath) || guestPath == "/" {
+			return nil, fmt.Errorf("guest path %q of %s is not an absolute path below /", spec.GuestPath, guestVirtiofsMountsEnv)
+		}
+		if guestPaths[guestPath] {
+			return nil, fmt.Errorf("guest path %q of %s is mounted twice", spec.GuestPath, guestVirtiofsMountsEnv)
+		}
+		guestPaths[guestPath] = true
+
+		readOnly := spec.ReadOnly == nil || *spec.ReadOnly
+		if !readOnly && !s.writableVirtiofs {
+			return nil, fmt.Errorf("writable mount of %q by %s is not allowed on this node", spec.HostPath, guestVirtiofsMountsEnv)
+		}
+
+		mounts = append(mounts, ctriface.VirtiofsMount{
+			HostPath:  filepath.Clean(spec.HostPath),
+			GuestPath: guestPath,
+			ReadOnly:  readOnly,
+		})
+	}
+
+	return mounts, nil
+}
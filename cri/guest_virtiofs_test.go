@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestGetGuestVirtiofsMounts(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+
+	cases := []struct {
+		name          string
+		value         string
+		allowWritable bool
+		expectErr     string
+		expect        []ctriface.VirtiofsMount
+	}{
+		{name: "Unset"},
+		{name: "Malformed JSON", value: `[{"hostPath": `, expectErr: "invalid GUEST_VIRTIOFS_MOUNTS"},
+		{name: "Not a list", value: `{"hostPath": "` + dir + `"}`, expectErr: "invalid GUEST_VIRTIOFS_MOUNTS"},
+		{name: "Relative host path", value: `[{"hostPath": "data", "guestPath": "/data"}]`, expectErr: "not absolute"},
+		{name: "Missing host path", value: `[{"hostPath": "` + dir + `/missing", "guestPath": "/data"}]`, expectErr: "does not exist"},
+		{name: "Host file", value: `[{"hostPath": "` + file + `", "guestPath": "/data"}]`, expectErr: "not a directory"},
+		{name: "Relative guest path", value: `[{"hostPath": "` + dir + `", "guestPath": "data"}]`, expectErr: "guest path"},
+		{name: "Guest root", value: `[{"hostPath": "` + dir + `", "guestPath": "/"}]`, expectErr: "guest path"},
+		{
+			name:      "Duplicate guest path",
+			value:     `[{"hostPath": "` + dir + `", "guestPath": "/data"}, {"hostPath": "` + dir + `", "guestPath": "/data/"}]`,
+			expectErr: "mounted twice",
+		},
+		{name: "Writable not allowed", value: `[{"hostPath": "` + dir + `", "guestPath": "/data", "readOnly": false}]`, expectErr: "not allowed"},
+		{
+			name:          "Writable allowed",
+			value:         `[{"hostPath": "` + dir + `", "guestPath": "/data", "readOnly": false}]`,
+			allowWritable: true,
+			expect:        []ctriface.VirtiofsMount{{HostPath: dir, GuestPath: "/data"}},
+		},
+		{
+			name:   "Single read-only mount",
+			value:  `[{"hostPath": "` + dir + `/", "guestPath": "/models"}]`,
+			expect: []ctriface.VirtiofsMount{{HostPath: dir, GuestPath: "/models", ReadOnly: true}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+			s.writableVirtiofs = c.allowWritable
+
+			config := &criapi.ContainerConfig{}
+			if c.value != "" {
+				config.Envs = []*criapi.KeyValue{{Key: guestVirtiofsMountsEnv, Value: c.value}}
+			}
+
+			mounts, err := s.getGuestVirtiofsMounts(config)
+			if c.expectErr != "" {
+				require.Error(t, err, "invalid mounts were accepted")
+				require.Contains(t, err.Error(), c.expectErr, "unexpected error")
+				return
+			}
+
+			require.NoError(t, err, "valid mounts were rejected")
+			require.Equal(t, c.expect, mounts, "unexpected mounts")
+		})
+	}
+}
+
+func TestCreateUserContainerVirtiofsMount(t *testing.T) {
+	dir := t.TempDir()
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{
+		Key:   guestVirtiofsMountsEnv,
+		Value: `[{"hostPath": "` + dir + `", "guestPath": "/models", "readOnly": true}]`,
+	})
+
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	require.Equal(t, []ctriface.VirtiofsMount{{HostPath: dir, GuestPath: "/models", ReadOnly: true}},
+		orch.StartOpts["1"].VirtiofsMounts, "mount was not passed to the VM")
+	require.NotContains(t, orch.StartOpts["1"].Env, guestVirtiofsMountsEnv+"="+r.Config.Envs[2].Value,
+		"mounts leaked into the guest environment")
+}
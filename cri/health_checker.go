@@ -0,0 +1,110 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// unhealthyThreshold is the number of consecutive failed health checks
+	// after which a VM is marked unhealthy
+	unhealthyThreshold = 3
+	healthCheckTimeout = time.Second
+)
+
+// startHealthChecker health-checks the guest agents of the active VMs
+// every interval, until stopHealthChecker is called
+func (c *coordinator) startHealthChecker(interval time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.healthStop != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.healthStop, c.healthDone = stop, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.checkHealth(stop)
+			}
+		}
+	}()
+}
+
+// stopHealthChecker stops the health checker and waits for it to return
+func (c *coordinator) stopHealthChecker() {
+	c.Lock()
+	stop, done := c.healthStop, c.healthDone
+	c.healthStop, c.healthDone = nil, nil
+	c.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+// checkHealth health-checks the guest agent of every active VM once,
+// giving up early if the checker is stopped
+func (c *coordinator) checkHealth(stop <-chan struct{}) {
+	c.Lock()
+	active := make([]*funcInstance, 0, len(c.activeInstances))
+	for _, fi := range c.activeInstances {
+		if fi.agent != nil {
+			active = append(active, fi)
+		}
+	}
+	c.Unlock()
+
+	for _, fi := range active {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := fi.agent.Health(ctx)
+		cancel()
+
+		if fi.recordHealth(err == nil) {
+			fi.logger.WithError(err).Warn("VM is unhealthy")
+			fi.history.warn(eventUnhealthy, "guest agent failed %d consecutive health checks", unhealthyThreshold)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/guestagent"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestHealthChecker(t *testing.T) {
+	dir := t.TempDir()
+	agentPath := filepath.Join(dir, "agent.sock")
+
+	lis, err := net.Listen("unix", agentPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	server := grpc.NewServer()
+	guestagent.NewServer(nil).Register(server)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	c := newCoordinator(fakes.NewOrchestrator())
+
+	for containerID, path := range map[string]string{"up": agentPath, "down": filepath.Join(dir, "missing.sock")} {
+		agent, err := guestagent.NewChannel(guestagent.UnixDialer(path), guestagent.WithHealthInterval(time.Hour))
+		require.NoError(t, err, "failed to create channel")
+		defer agent.Close()
+
+		fi := newFuncInstance(containerID, "image", nil)
+		fi.agent = agent
+		require.NoError(t, c.insertActive("pod", containerID, fi))
+	}
+
+	states := func() map[string]string {
+		s := make(map[string]string)
+		for _, vm := range c.ListActive() {
+			s[vm.ContainerID] = vm.State
+		}
+		return s
+	}
+
+	c.startHealthChecker(20 * time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return states()["down"] == vmStateUnhealthy
+	}, 10*time.Second, 20*time.Millisecond, "unreachable VM was not marked unhealthy")
+	require.Equal(t, vmStateRunning, states()["up"], "reachable VM was not healthy")
+
+	c.stopHealthChecker()
+	c.stopHealthChecker()
+
+	fi, _ := c.getInstance("down")
+	require.False(t, fi.recordHealth(true))
+	require.False(t, fi.isUnhealthy(), "VM stayed unhealthy after a successful check")
+}
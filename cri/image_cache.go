@@ -0,0 +1,100 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// imageCache is the set of function images known to be on the node,
+// which are used without pulling them again
+type imageCache struct {
+	sync.Mutex
+	images map[string]bool
+}
+
+func newImageCache() *imageCache {
+	return &imageCache{images: make(map[string]bool)}
+}
+
+func (c *imageCache) has(image string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.images[image]
+}
+
+func (c *imageCache) add(image string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.images[image] = true
+}
+
+func (c *imageCache) remove(image string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.images, image)
+}
+
+// orchStartVMImage starts a VM without pulling its image if the image is
+// cached or hinted to be on the node with GUEST_IMAGE_CACHED. A cached image
+// that was removed from the node is pulled again, while a wrong hint fails.
+func (c *coordinator) orchStartVMImage(ctx context.Context, vmID, image string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	if err := c.faults.fire(FaultTapCreate); err != nil {
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseNetwork, Err: err}
+	}
+	if err := c.faults.fire(FaultBootHang); err != nil {
+		<-ctx.Done()
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: fmt.Errorf("%v: %w", err, ctx.Err())}
+	}
+
+	hinted := ctriface.NewStartVMOptions(opts...).ImageCached
+	cached := !hinted && c.images.has(image)
+	if cached {
+		opts = append(opts[:len(opts):len(opts)], ctriface.WithImageCached(true))
+	}
+
+	resp, startVMMetric, err := c.orch.StartVM(ctx, vmID, image, opts...)
+	if cached && ctriface.IsImageNotCached(err) {
+		criLog.WithFields(log.Fields{"vmID": vmID, "image": image}).Warn("cached image was removed from the node, pulling it")
+		c.images.remove(image)
+		resp, startVMMetric, err = c.orch.StartVM(ctx, vmID, image, opts[:len(opts)-1]...)
+	}
+
+	if hinted && ctriface.IsImageNotCached(err) {
+		return nil, nil, fmt.Errorf("image %s is not on the node despite %s: %w", image, guestImageCachedEnv, err)
+	}
+	if err == nil {
+		c.images.add(image)
+	}
+
+	return resp, startVMMetric, err
+}
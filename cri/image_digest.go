@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/ease-lab/vhive/ctriface"
+)
+
+// imageResolveTimeout bounds the resolution of the tag of an image
+const imageResolveTimeout = 10 * time.Second
+
+// ImageResolver resolves the references of the function images
+// to the digests of their manifests in their registries
+type ImageResolver interface {
+	ResolveImageDigest(ctx context.Context, imageName string) (string, error)
+}
+
+// imageDigests pins the function images to digests, so that the VMs, warm
+// pools and snapshots of an image are not shared across the images a tag
+// references over time. The digests of the tags are cached for the TTL.
+type imageDigests struct {
+	sync.Mutex
+	resolver ImageResolver
+	ttl      time.Duration
+	digests  map[string]resolvedDigest
+	now      func() time.Time
+}
+
+type resolvedDigest struct {
+	digest   string
+	resolved time.Time
+}
+
+func newImageDigests(resolver ImageResolver, ttl time.Duration) *imageDigests {
+	return &imageDigests{
+		resolver: resolver,
+		ttl:      ttl,
+		digests:  make(map[string]resolvedDigest),
+		now:      time.Now,
+	}
+}
+
+// pin returns the normalized reference of the image pinned to the digest of
+// its manifest and the digest, resolving the tag of an image without digest
+func (d *imageDigests) pin(ctx context.Context, image string) (pinned, digest string, err error) {
+	normalized, err := ctriface.NormalizeImageName(image)
+	if err != nil {
+		return "", "", err
+	}
+	named, err := reference.ParseNormalizedNamed(normalized)
+	if err != nil {
+		return "", "", err
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return normalized, digested.Digest().String(), nil
+	}
+
+	digest, found := d.get(normalized)
+	if !found {
+		ctx, cancel := context.WithTimeout(ctx, imageResolveTimeout)
+		defer cancel()
+
+		if digest, err = d.resolver.ResolveImageDigest(ctx, normalized); err != nil {
+			return "", "", err
+		}
+	}
+
+	ref, err := reference.ParseDockerRef(reference.TrimNamed(named).String() + "@" + digest)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid digest %q resolved for image %s: %w", digest, image, err)
+	}
+	if !found {
+		d.put(normalized, digest)
+	}
+
+	return ref.String(), digest, nil
+}
+
+func (d *imageDigests) get(image string) (string, bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	r, found := d.digests[image]
+	if !found {
+		return "", false
+	}
+	if d.now().Sub(r.resolved) >= d.ttl {
+		delete(d.digests, image)
+		return "", false
+	}
+
+	return r.digest, true
+}
+
+func (d *imageDigests) put(image, digest string) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.digests[image] = resolvedDigest{digest: digest, resolved: d.now()}
+}
+
+// imageDigest returns the digest the image is pinned to, empty if none
+func imageDigest(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String()
+	}
+
+	return ""
+}
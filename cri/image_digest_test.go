@@ -0,0 +1,195 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	testDigest1 = "sha256:" + strings.Repeat("1", 64)
+	testDigest2 = "sha256:" + strings.Repeat("2", 64)
+)
+
+// fakeImageResolver resolves the images to the digests of its registry
+type fakeImageResolver struct {
+	sync.Mutex
+
+	digests  map[string]string
+	err      error
+	resolved map[string]int
+}
+
+func newFakeImageResolver(digests map[string]string) *fakeImageResolver {
+	return &fakeImageResolver{digests: digests, resolved: make(map[string]int)}
+}
+
+func (r *fakeImageResolver) ResolveImageDigest(ctx context.Context, imageName string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.resolved[imageName]++
+	if r.err != nil {
+		return "", r.err
+	}
+	digest, ok := r.digests[imageName]
+	if !ok {
+		return "", errors.New("manifest unknown")
+	}
+
+	return digest, nil
+}
+
+func (r *fakeImageResolver) setDigest(imageName, digest string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.digests[imageName] = digest
+}
+
+func TestPinImage(t *testing.T) {
+	ctx := context.Background()
+	resolver := newFakeImageResolver(map[string]string{
+		"docker.io/library/nginx:latest":           testDigest1,
+		"ghcr.io/ease-lab/helloworld:var_workload": testDigest2,
+	})
+	d := newImageDigests(resolver, time.Minute)
+
+	for _, tc := range []struct {
+		image  string
+		pinned string
+		digest string
+	}{
+		{"nginx", "docker.io/library/nginx@" + testDigest1, testDigest1},
+		{"docker.io/library/nginx:latest", "docker.io/library/nginx@" + testDigest1, testDigest1},
+		{"ghcr.io/ease-lab/helloworld:var_workload", "ghcr.io/ease-lab/helloworld@" + testDigest2, testDigest2},
+		// An image pinned by digest is not resolved
+		{"ghcr.io/ease-lab/pyaes@" + testDigest1, "ghcr.io/ease-lab/pyaes@" + testDigest1, testDigest1},
+	} {
+		pinned, digest, err := d.pin(ctx, tc.image)
+		require.NoError(t, err, "failed to pin image %s", tc.image)
+		require.Equal(t, tc.pinned, pinned, "unexpected pinned reference of %s", tc.image)
+		require.Equal(t, tc.digest, digest, "unexpected digest of %s", tc.image)
+	}
+	require.NotContains(t, resolver.resolved, "ghcr.io/ease-lab/pyaes@"+testDigest1)
+
+	_, _, err := d.pin(ctx, "ease-lab/Hello World")
+	require.Error(t, err, "invalid reference was pinned")
+
+	_, _, err = d.pin(ctx, "ghcr.io/ease-lab/missing:latest")
+	require.Error(t, err, "unresolvable image was pinned")
+}
+
+func TestPinImageCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	const image = "ghcr.io/ease-lab/helloworld:var_workload"
+
+	resolver := newFakeImageResolver(map[string]string{image: testDigest1})
+	d := newImageDigests(resolver, time.Minute)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	_, digest, err := d.pin(ctx, image)
+	require.NoError(t, err)
+	require.Equal(t, testDigest1, digest)
+
+	// The tag moves, but its digest is cached until the TTL expires
+	resolver.setDigest(image, testDigest2)
+	_, digest, err = d.pin(ctx, image)
+	require.NoError(t, err)
+	require.Equal(t, testDigest1, digest, "cached digest was not used")
+	require.Equal(t, 1, resolver.resolved[image])
+
+	now = now.Add(time.Minute)
+	_, digest, err = d.pin(ctx, image)
+	require.NoError(t, err)
+	require.Equal(t, testDigest2, digest, "expired digest was not resolved again")
+	require.Equal(t, 2, resolver.resolved[image])
+}
+
+func TestCreateUserContainerPinsImage(t *testing.T) {
+	ctx := context.Background()
+	const image = "ghcr.io/ease-lab/helloworld:var_workload"
+
+	t.Run("Pinned", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.Images = map[string]bool{}
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+		WithImageDigests(newFakeImageResolver(map[string]string{image: testDigest1}), time.Minute)(s)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", image))
+		require.NoError(t, err, "container creation failed")
+		require.Equal(t, map[string]int{"ghcr.io/ease-lab/helloworld@" + testDigest1: 1}, orch.Pulled,
+			"image was not pulled by digest")
+	})
+
+	t.Run("Unresolvable", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		stock := &fakes.StockRuntimeClient{}
+		s := newTestService(stock, orch)
+		resolver := newFakeImageResolver(nil)
+		resolver.err = errors.New("registry unreachable")
+		WithImageDigests(resolver, time.Minute)(s)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", image))
+		require.Equal(t, codes.Unavailable, status.Code(err), "unexpected error: %v", err)
+		require.Zero(t, orch.NumStarted(), "VM was started for an unresolved image")
+		requireNoLeaks(t, s, orch, stock)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+		resolver := newFakeImageResolver(nil)
+		WithImageDigests(resolver, time.Minute)(s)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", "ease-lab/Hello World"))
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "unexpected error: %v", err)
+		require.Empty(t, resolver.resolved, "invalid image was resolved")
+	})
+}
+
+func TestSnapshotKeyByDigest(t *testing.T) {
+	fi := &funcInstance{vmID: "3", revisionID: "rev1", image: "img", snapshotID: "abc"}
+	require.Equal(t, "rev1/abc/snap_file", snapshotKey(fi, "/fccd/snapshots/3/snap_file"))
+
+	// An image not pinned is keyed by the digest it was booted from
+	fi.startVMResponse = &ctriface.StartVMResponse{ImageDigest: testDigest2}
+	require.Equal(t, "rev1/sha256-"+strings.Repeat("2", 64)+"/abc/snap_file", snapshotKey(fi, "/fccd/snapshots/3/snap_file"))
+
+	fi.image = "ghcr.io/ease-lab/helloworld@" + testDigest1
+	key := snapshotKey(fi, "/fccd/snapshots/3/snap_file")
+	require.Equal(t, "rev1/sha256-"+strings.Repeat("1", 64)+"/abc/snap_file", key)
+	require.NoError(t, validateSnapshotKey(key))
+}
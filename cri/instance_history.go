@@ -0,0 +1,367 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	bootCold     = "cold"
+	bootSnapshot = "snapshot"
+	// bootWarm is a VM adopted from the VMs parked for reuse
+	bootWarm = "warm"
+
+	// maxInstanceEvents bounds the events kept per instance, cut down to
+	// minInstanceEvents once the events of all instances reach maxTotalEvents
+	maxInstanceEvents = 32
+	minInstanceEvents = 8
+	maxTotalEvents    = 4096
+	// maxEventMessageLen bounds the size of each event
+	maxEventMessageLen = 256
+)
+
+// The reasons of the instance events, named after the Kubernetes event reasons
+const (
+	eventCreated       = "Created"
+	eventBooted        = "Booted"
+	eventAttached      = "Attached"
+	eventPaused        = "Paused"
+	eventResumed       = "Resumed"
+	eventSnapshotted   = "Snapshotted"
+	eventOffloaded     = "Offloaded"
+	eventRestored      = "Restored"
+	eventStopped       = "Stopped"
+	eventUnhealthy     = "Unhealthy"
+	eventHealthy       = "Healthy"
+	eventCPUBoostEnded = "CPUBoostEnded"
+	eventResized       = "Resized"
+
+	// eventClockSyncFailed leaves the guest clock of a resumed VM stale
+	eventClockSyncFailed = "ClockSyncFailed"
+	// eventNotReady fails the start of a container whose guest agent is not ready
+	eventNotReady = "NotReady"
+	// eventExited reports a VM that exited without being stopped, e.g., out of memory
+	eventExited = "Exited"
+	// eventRestarted reports a VM restarted in place, e.g., through the debug endpoint
+	eventRestarted = "Restarted"
+	// eventVMStarted reports how the VM was started for a new container
+	eventVMStarted = "VMStarted"
+)
+
+// InstanceEvent is a change in the lifecycle of a function instance
+type InstanceEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	// Warning marks the events reporting a failure of the instance
+	Warning bool `json:"warning"`
+}
+
+// PodRef identifies the pod of a function instance
+type PodRef struct {
+	Name      string
+	Namespace string
+	UID       string
+}
+
+// EventRecorder publishes the events of the instances as Kubernetes events
+// on their pods, e.g., KubeEventRecorder or a client-go record.EventRecorder.
+// eventType is "Normal" or "Warning".
+type EventRecorder interface {
+	Eventf(pod PodRef, eventType, reason, messageFmt string, args ...interface{})
+}
+
+// eventBudget counts the events kept by all the instances
+type eventBudget struct {
+	total int64
+	max   int64
+}
+
+func newEventBudget(max int) *eventBudget {
+	return &eventBudget{max: int64(max)}
+}
+
+func (b *eventBudget) add(n int) {
+	if b != nil {
+		atomic.AddInt64(&b.total, int64(n))
+	}
+}
+
+func (b *eventBudget) exhausted() bool {
+	return b != nil && atomic.LoadInt64(&b.total) >= b.max
+}
+
+// SnapshotRecord describes a snapshot of an instance. The snapshot files are
+// kept per VM, so a new snapshot replaces the previous one of the same VM.
+type SnapshotRecord struct {
+	// Name is the label given to a snapshot taken through the admin API
+	Name    string    `json:"name"`
+	VMID    string    `json:"vmID"`
+	Image   string    `json:"image"`
+	Created time.Time `json:"created"`
+	Loads   uint32    `json:"loads"`
+	// FirecrackerVersion is the firecracker release that took the snapshot,
+	// empty if the releases of the node are not configured
+	FirecrackerVersion string `json:"firecrackerVersion,omitempty"`
+}
+
+// BootInfo is how the VM of an instance was last started for a container:
+// booted (cold), adopted from the parked VMs (warm) or restored from a snapshot
+type BootInfo struct {
+	Type       string  `json:"type"`
+	DurationMs float64 `json:"durationMs"`
+	// SnapshotSource is the snapshot the VM was restored from, nil unless restored
+	SnapshotSource *SnapshotRecord `json:"snapshotSource,omitempty"`
+}
+
+// instanceHistory is the lifecycle metadata of a function instance
+// that outlives the individual VM operations
+type instanceHistory struct {
+	sync.Mutex
+
+	state    string
+	bootType string
+	events   []InstanceEvent
+	lineage  []SnapshotRecord
+	// boot is how the VM was last started, nil until it is known
+	boot *BootInfo
+
+	// budget is shared by the instances of the coordinator, nil if unlimited
+	budget *eventBudget
+
+	// pod and recorder publish the events while the instance has a pod,
+	// unpublished counts the latest events recorded while it had none
+	pod         *PodRef
+	recorder    EventRecorder
+	unpublished int
+}
+
+func newInstanceHistory() *instanceHistory {
+	return &instanceHistory{state: vmStateRunning, bootType: bootCold}
+}
+
+// record appends an event, dropping the oldest ones if the history is full
+func (h *instanceHistory) record(eventType, format string, args ...interface{}) {
+	h.recordEvent(false, eventType, format, args...)
+}
+
+// warn appends an event reporting a failure of the instance
+func (h *instanceHistory) warn(eventType, format string, args ...interface{}) {
+	h.recordEvent(true, eventType, format, args...)
+}
+
+func (h *instanceHistory) recordEvent(warning bool, eventType, format string, args ...interface{}) {
+	h.Lock()
+	publish := h.recordLocked(warning, eventType, fmt.Sprintf(format, args...))
+	h.Unlock()
+
+	publish()
+}
+
+// recordLocked appends an event, returning the function publishing it,
+// which is called once the history is unlocked
+func (h *instanceHistory) recordLocked(warning bool, eventType, message string) func() {
+	if len(message) > maxEventMessageLen {
+		message = message[:maxEventMessageLen-3] + "..."
+	}
+
+	limit := maxInstanceEvents
+	if h.budget.exhausted() {
+		limit = minInstanceEvents
+	}
+
+	if drop := len(h.events) - limit + 1; drop > 0 {
+		h.events = append(h.events[:0], h.events[drop:]...)
+		h.budget.add(-drop)
+	}
+
+	event := InstanceEvent{Time: time.Now(), Type: eventType, Message: message, Warning: warning}
+	h.events = append(h.events, event)
+	h.budget.add(1)
+
+	if h.pod == nil || h.recorder == nil {
+		if h.unpublished < len(h.events) {
+			h.unpublished++
+		}
+		return func() {}
+	}
+
+	pod, recorder := *h.pod, h.recorder
+	return func() { publishEvent(recorder, pod, event) }
+}
+
+func publishEvent(recorder EventRecorder, pod PodRef, event InstanceEvent) {
+	eventType := "Normal"
+	if event.Warning {
+		eventType = "Warning"
+	}
+
+	recorder.Eventf(pod, eventType, event.Type, "%s", event.Message)
+}
+
+// attach publishes the events of the instance on the given pod, starting
+// with the ones recorded since the instance was last detached
+func (h *instanceHistory) attach(pod PodRef, recorder EventRecorder) {
+	h.Lock()
+	h.pod, h.recorder = &pod, recorder
+
+	var pending []InstanceEvent
+	if recorder != nil {
+		if h.unpublished > len(h.events) {
+			h.unpublished = len(h.events)
+		}
+		pending = append(pending, h.events[len(h.events)-h.unpublished:]...)
+		h.unpublished = 0
+	}
+	h.Unlock()
+
+	for _, event := range pending {
+		publishEvent(recorder, pod, event)
+	}
+}
+
+// detach stops publishing the events of the instance on its pod
+func (h *instanceHistory) detach() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.pod = nil
+}
+
+// release gives the events of a stopped instance back to the budget
+func (h *instanceHistory) release() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.budget.add(-len(h.events))
+	h.budget = nil
+}
+
+// setState changes the state of the instance, recording it as an event
+func (h *instanceHistory) setState(state, eventType, format string, args ...interface{}) {
+	h.setStateEvent(false, state, eventType, format, args...)
+}
+
+// failState changes the state of the instance after a failure, recording it as a warning event
+func (h *instanceHistory) failState(state, eventType, format string, args ...interface{}) {
+	h.setStateEvent(true, state, eventType, format, args...)
+}
+
+func (h *instanceHistory) setStateEvent(warning bool, state, eventType, format string, args ...interface{}) {
+	h.Lock()
+	h.state = state
+	publish := h.recordLocked(warning, eventType, fmt.Sprintf(format, args...))
+	h.Unlock()
+
+	publish()
+}
+
+// snapshotCreated records the snapshot taken of the VM of the instance
+func (h *instanceHistory) snapshotCreated(snap SnapshotRecord) {
+	h.Lock()
+	snap.Created = time.Now()
+	h.lineage = append(h.lineage, snap)
+
+	message := "snapshot created"
+	if snap.Name != "" {
+		message = fmt.Sprintf("snapshot %s created", snap.Name)
+	}
+	publish := h.recordLocked(false, eventSnapshotted, message)
+	h.Unlock()
+
+	publish()
+}
+
+// snapshotLoaded records that the instance was restored from its latest snapshot
+func (h *instanceHistory) snapshotLoaded(d time.Duration) {
+	h.Lock()
+	h.state = vmStateRunning
+	h.bootType = bootSnapshot
+
+	message := fmt.Sprintf("restored in %s", d.Round(time.Millisecond))
+	if n := len(h.lineage); n > 0 {
+		h.lineage[n-1].Loads++
+		message = fmt.Sprintf("restored from the snapshot of VM %s taken at %s in %s",
+			h.lineage[n-1].VMID, h.lineage[n-1].Created.Format(time.RFC3339), d.Round(time.Millisecond))
+	}
+	publish := h.recordLocked(false, eventRestored, message)
+	h.Unlock()
+
+	publish()
+}
+
+// started records how the VM was started for a new container, in d
+func (h *instanceHistory) started(bootType string, d time.Duration) {
+	h.Lock()
+	h.boot = &BootInfo{Type: bootType, DurationMs: float64(d) / float64(time.Millisecond)}
+
+	message := fmt.Sprintf("%s start in %s", bootType, d.Round(time.Millisecond))
+	if n := len(h.lineage); bootType == bootSnapshot && n > 0 {
+		snap := h.lineage[n-1]
+		h.boot.SnapshotSource = &snap
+		message = fmt.Sprintf("%s start in %s from the snapshot of VM %s taken at %s",
+			bootType, d.Round(time.Millisecond), snap.VMID, snap.Created.Format(time.RFC3339))
+	}
+	publish := h.recordLocked(false, eventVMStarted, message)
+	h.Unlock()
+
+	publish()
+}
+
+// lastBoot returns a copy of how the VM was last started, nil if unknown
+func (h *instanceHistory) lastBoot() *BootInfo {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.boot == nil {
+		return nil
+	}
+	boot := *h.boot
+
+	return &boot
+}
+
+// get returns the state and boot type of the instance
+func (h *instanceHistory) get() (state, bootType string) {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.state, h.bootType
+}
+
+// copy returns a copy of the snapshot lineage and events of the instance
+func (h *instanceHistory) copy() ([]SnapshotRecord, []InstanceEvent) {
+	h.Lock()
+	defer h.Unlock()
+
+	lineage := make([]SnapshotRecord, len(h.lineage))
+	copy(lineage, h.lineage)
+	events := make([]InstanceEvent, len(h.events))
+	copy(events, h.events)
+
+	return lineage, events
+}
@@ -0,0 +1,198 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecorder struct {
+	sync.Mutex
+	events []string
+}
+
+func (r *fakeRecorder) Eventf(pod PodRef, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.events = append(r.events, fmt.Sprintf("%s/%s %s %s: %s", pod.Namespace, pod.Name, eventType, reason, fmt.Sprintf(messageFmt, args...)))
+}
+
+func messages(events []InstanceEvent) []string {
+	var msgs []string
+	for _, event := range events {
+		msgs = append(msgs, event.Message)
+	}
+	return msgs
+}
+
+func TestInstanceHistoryBounded(t *testing.T) {
+	h := newInstanceHistory()
+
+	for i := 0; i < maxInstanceEvents+5; i++ {
+		h.record("Event", "%d", i)
+	}
+
+	_, events := h.copy()
+	require.Len(t, events, maxInstanceEvents, "history is not bounded")
+
+	for i, event := range events {
+		require.Equal(t, strconv.Itoa(i+5), event.Message, "events are out of order or the newest were dropped")
+	}
+	for i := 1; i < len(events); i++ {
+		require.False(t, events[i].Time.Before(events[i-1].Time), "events are not in time order")
+	}
+}
+
+func TestInstanceHistoryTruncatesMessages(t *testing.T) {
+	h := newInstanceHistory()
+
+	h.record("Event", "%s", strings.Repeat("x", 2*maxEventMessageLen))
+
+	_, events := h.copy()
+	require.Len(t, events[0].Message, maxEventMessageLen, "message was not truncated")
+	require.True(t, strings.HasSuffix(events[0].Message, "..."), "truncation is not marked")
+}
+
+func TestInstanceHistoryTotalBudget(t *testing.T) {
+	budget := newEventBudget(2 * maxInstanceEvents)
+
+	full := newInstanceHistory()
+	full.budget = budget
+	for i := 0; i < 2*maxInstanceEvents; i++ {
+		full.record("Event", "%d", i)
+	}
+
+	// The first history keeps its events until the budget is exhausted
+	other := newInstanceHistory()
+	other.budget = budget
+	for i := 0; i < maxInstanceEvents; i++ {
+		other.record("Event", "%d", i)
+	}
+	require.True(t, budget.exhausted(), "budget is not exhausted")
+
+	// Then each history is cut down on its next event
+	full.record("Event", "last")
+	_, events := full.copy()
+	require.Len(t, events, minInstanceEvents, "history was not cut down")
+	require.Equal(t, "last", events[len(events)-1].Message, "newest event was dropped")
+
+	// The events of a stopped instance are given back
+	other.release()
+	require.False(t, budget.exhausted(), "events of released history are still counted")
+	full.record("Event", "more")
+	_, events = full.copy()
+	require.Len(t, events, minInstanceEvents+1, "history is still cut down")
+}
+
+func TestInstanceHistoryPublishesEvents(t *testing.T) {
+	recorder := &fakeRecorder{}
+	h := newInstanceHistory()
+
+	// The events recorded before the instance has a pod are published on attach
+	h.record(eventCreated, "created")
+	h.record(eventBooted, "booted")
+	h.attach(PodRef{Name: "pod", Namespace: "default"}, recorder)
+	h.warn(eventUnhealthy, "unhealthy")
+
+	h.detach()
+	h.record(eventOffloaded, "offloaded")
+	h.attach(PodRef{Name: "pod2", Namespace: "default"}, recorder)
+
+	require.Equal(t, []string{
+		"default/pod Normal Created: created",
+		"default/pod Normal Booted: booted",
+		"default/pod Warning Unhealthy: unhealthy",
+		"default/pod2 Normal Offloaded: offloaded",
+	}, recorder.events)
+}
+
+func TestCreateUserContainerEvents(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	recorder := &fakeRecorder{}
+	s.eventRecorder = recorder
+
+	r := newUserContainerRequest("pod", "img")
+	r.SandboxConfig = newPodSandboxConfig()
+
+	resp, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	require.Len(t, recorder.events, 4, "events were not published")
+	require.True(t, strings.HasPrefix(recorder.events[0], "default/helloworld-00001-deployment-abc Normal Created: "), recorder.events[0])
+	require.True(t, strings.HasPrefix(recorder.events[1], "default/helloworld-00001-deployment-abc Normal Booted: VM booted in "), recorder.events[1])
+	require.True(t, strings.HasPrefix(recorder.events[2], "default/helloworld-00001-deployment-abc Normal VMStarted: cold start in "), recorder.events[2])
+	require.Equal(t, "default/helloworld-00001-deployment-abc Normal Attached: attached to container "+resp.ContainerId, recorder.events[3])
+}
+
+func TestBootInfoSnapshotStart(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	c := newCoordinator(orch)
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "failed to start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+
+	boot := fi.history.lastBoot()
+	require.NotNil(t, boot, "boot of the VM was not recorded")
+	require.Equal(t, bootCold, boot.Type)
+	require.Nil(t, boot.SnapshotSource, "snapshot source of a cold start")
+
+	// Offloaded to a snapshot and restored for the next container
+	require.NoError(t, c.stopVM(ctx, "ctr1"), "failed to offload VM")
+	restored, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "failed to restore VM")
+	require.Equal(t, fi, restored, "VM was not restored")
+
+	recorder := &fakeRecorder{}
+	restored.history.attach(PodRef{Name: "pod2", Namespace: "default"}, recorder)
+
+	boot = restored.history.lastBoot()
+	require.NotNil(t, boot, "boot of the VM was not recorded")
+	require.Equal(t, bootSnapshot, boot.Type)
+	require.NotNil(t, boot.SnapshotSource, "snapshot source was not recorded")
+	require.Equal(t, fi.vmID, boot.SnapshotSource.VMID)
+	require.Equal(t, "img", boot.SnapshotSource.Image)
+
+	var started []string
+	for _, event := range recorder.events {
+		if strings.Contains(event, " VMStarted: ") {
+			started = append(started, event)
+		}
+	}
+	// The cold start was never published, the VM having no pod then
+	require.Len(t, started, 2, "restore was not published")
+	require.True(t, strings.HasPrefix(started[1], "default/pod2 Normal VMStarted: snapshot start in "), started[1])
+	require.Contains(t, started[1], "from the snapshot of VM "+fi.vmID)
+}
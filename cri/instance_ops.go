@@ -0,0 +1,322 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// instanceOpTimeout bounds each lifecycle operation requested through the admin API
+const instanceOpTimeout = time.Minute
+
+// lockInstance finds the instance with the given container or VM ID and
+// takes its operation lock, failing if it does not exist or was stopped meanwhile
+func (c *coordinator) lockInstance(id string) (string, *funcInstance, error) {
+	containerID, fi := c.findInstance(id)
+	if fi == nil {
+		return "", nil, status.Errorf(codes.NotFound, "instance %s not found", id)
+	}
+
+	fi.opMu.Lock()
+
+	if state, _ := fi.history.get(); state == vmStateStopped {
+		fi.opMu.Unlock()
+		return "", nil, status.Errorf(codes.NotFound, "instance %s not found", id)
+	}
+
+	return containerID, fi, nil
+}
+
+func illegalTransition(fi *funcInstance, op, state string) error {
+	return status.Errorf(codes.FailedPrecondition, "cannot %s VM %s that is %s", op, fi.vmID, state)
+}
+
+// PauseInstance pauses the running VM of an instance
+func (c *coordinator) PauseInstance(ctx context.Context, id string) (*metrics.Metric, error) {
+	_, fi, err := c.lockInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.opMu.Unlock()
+
+	if state, _ := fi.history.get(); state != vmStateRunning {
+		return nil, illegalTransition(fi, "pause", state)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	m := metrics.NewMetric()
+	err = c.pause(ctxTimeout, fi, m)
+	c.auditInstance(ctx, auditVMPaused, fi, err)
+	if err != nil {
+		return nil, err
+	}
+	c.mem.pause(fi.vmID)
+	fi.history.setState(vmStatePaused, eventPaused, "paused through the admin API")
+
+	return m, nil
+}
+
+// ResumeInstance resumes the paused VM of an instance, or loads back the
+// offloaded VM of an instance that still has its container
+func (c *coordinator) ResumeInstance(ctx context.Context, id string) (*metrics.Metric, error) {
+	containerID, fi, err := c.lockInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.opMu.Unlock()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	switch state, _ := fi.history.get(); {
+	case state == vmStatePaused:
+		if err := c.mem.commit(fi.vmID, fi.vmOpts.MemSizeMib); err != nil {
+			return nil, err
+		}
+
+		m, err := c.orch.ResumeVM(ctxTimeout, fi.vmID)
+		c.auditInstance(ctx, auditVMResumed, fi, err)
+		if err != nil {
+			fi.logger.WithError(err).Error("failed to resume VM")
+			c.mem.pause(fi.vmID)
+			return nil, err
+		}
+		fi.history.setState(vmStateRunning, eventResumed, "resumed through the admin API")
+
+		return mergeMetrics(m, c.syncClock(ctxTimeout, fi)), nil
+	case state == vmStateOffloaded && containerID != "":
+		if err := c.mem.commit(fi.vmID, fi.vmOpts.MemSizeMib); err != nil {
+			return nil, err
+		}
+
+		m, err := c.orchLoadInstance(ctxTimeout, fi)
+		if err != nil {
+			c.mem.release(fi.vmID)
+			return nil, err
+		}
+
+		return m, nil
+	case state == vmStateOffloaded:
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot resume idle VM %s, it is loaded for the next container", fi.vmID)
+	default:
+		return nil, illegalTransition(fi, "resume", state)
+	}
+}
+
+// SnapshotInstance creates a snapshot with the given name of the VM of an
+// instance, pausing a running VM for the snapshot and resuming it afterwards
+func (c *coordinator) SnapshotInstance(ctx context.Context, id, name string) (*metrics.Metric, error) {
+	_, fi, err := c.lockInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.opMu.Unlock()
+
+	state, _ := fi.history.get()
+	if state != vmStateRunning && state != vmStatePaused {
+		return nil, illegalTransition(fi, "snapshot", state)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	m := metrics.NewMetric()
+
+	if state == vmStateRunning {
+		if err := c.pause(ctxTimeout, fi, m); err != nil {
+			return nil, err
+		}
+	}
+
+	tStart := time.Now()
+	snapErr := c.orch.CreateSnapshot(ctxTimeout, fi.vmID)
+	rec := instanceAuditRecord(auditSnapshotTaken, fi)
+	rec.Snapshot = name
+	c.audit.record(ctx, rec, snapErr)
+	if snapErr == nil {
+		m.MetricMap[metrics.CreateSnapshot] = metrics.ToUS(time.Since(tStart))
+		fi.history.snapshotCreated(fi.snapshotRecord(name))
+	} else {
+		fi.logger.WithError(snapErr).Error("failed to create snapshot")
+	}
+
+	// The VM is resumed even if the snapshot failed, to leave it as it was
+	if state == vmStateRunning {
+		resumeMetric, err := c.orch.ResumeVM(ctxTimeout, fi.vmID)
+		if err != nil {
+			fi.logger.WithError(err).Error("failed to resume VM after snapshot")
+			fi.history.setState(vmStatePaused, eventPaused, "left paused after snapshot")
+			return nil, err
+		}
+		m = mergeMetrics(m, resumeMetric, c.syncClock(ctxTimeout, fi))
+	}
+
+	if snapErr != nil {
+		return nil, snapErr
+	}
+
+	return m, nil
+}
+
+// OffloadInstance offloads the VM of an instance, creating its snapshot
+// first if it has none. Offloading requires snapshots to be enabled.
+func (c *coordinator) OffloadInstance(ctx context.Context, id string) (*metrics.Metric, error) {
+	_, fi, err := c.lockInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.opMu.Unlock()
+
+	if c.orch == nil || !c.orch.GetSnapshotsEnabled() {
+		return nil, status.Error(codes.FailedPrecondition, "offloading requires snapshots to be enabled")
+	}
+
+	if state, _ := fi.history.get(); state != vmStateRunning && state != vmStatePaused {
+		return nil, illegalTransition(fi, "offload", state)
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	m := metrics.NewMetric()
+
+	// Like when offloaded by the coordinator, the VM is snapshotted only once
+	snapshots, _ := fi.history.copy()
+	tStart := time.Now()
+	if err := c.orchCreateSnapshot(ctxTimeout, fi); err != nil {
+		return nil, err
+	}
+	if lineage, _ := fi.history.copy(); len(lineage) > len(snapshots) {
+		m.MetricMap[metrics.CreateSnapshot] = metrics.ToUS(time.Since(tStart))
+	}
+
+	// The guest keeps running the function, only the control channel is closed
+	if fi.agent != nil {
+		if err := fi.agent.Close(); err != nil {
+			fi.logger.WithError(err).Warn("failed to close guest agent channel")
+		}
+		fi.agent = nil
+	}
+
+	tStart = time.Now()
+	err = c.orch.Offload(ctxTimeout, fi.vmID)
+	c.auditInstance(ctx, auditVMOffloaded, fi, err)
+	if err != nil {
+		fi.logger.WithError(err).Error("failed to offload instance")
+		return nil, err
+	}
+	m.MetricMap[metrics.OffloadVM] = metrics.ToUS(time.Since(tStart))
+
+	c.mem.release(fi.vmID)
+	fi.history.setState(vmStateOffloaded, eventOffloaded, "offloaded through the admin API")
+
+	return m, nil
+}
+
+// KillInstance stops the VM of an instance in any state and forgets the
+// instance. The container of the instance, if any, is left to kubelet.
+func (c *coordinator) KillInstance(ctx context.Context, id string) (*metrics.Metric, error) {
+	containerID, fi, err := c.lockInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.opMu.Unlock()
+
+	c.forgetInstance(containerID, fi)
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	if fi.agent != nil {
+		if err := fi.agent.Close(); err != nil {
+			fi.logger.WithError(err).Warn("failed to close guest agent channel")
+		}
+	}
+
+	m := metrics.NewMetric()
+
+	tStart := time.Now()
+	if err := c.orchStopVM(ctxTimeout, fi); err != nil {
+		return nil, err
+	}
+	m.MetricMap[metrics.StopVM] = metrics.ToUS(time.Since(tStart))
+
+	fi.logger.Info("VM killed through the admin API")
+
+	return m, nil
+}
+
+// forgetInstance removes an instance from the active or idle instances
+func (c *coordinator) forgetInstance(containerID string, fi *funcInstance) {
+	c.Lock()
+	defer c.Unlock()
+
+	if containerID != "" {
+		if c.activeInstances[containerID] == fi {
+			delete(c.activeInstances, containerID)
+		}
+		return
+	}
+
+	idles := c.idleInstances[fi.image]
+	for i, idle := range idles {
+		if idle == fi {
+			c.idleInstances[fi.image] = append(idles[:i:i], idles[i+1:]...)
+			return
+		}
+	}
+}
+
+// pause pauses the VM of an instance, adding the latency to the metric
+func (c *coordinator) pause(ctx context.Context, fi *funcInstance, m *metrics.Metric) error {
+	tStart := time.Now()
+	if err := c.orch.PauseVM(ctx, fi.vmID); err != nil {
+		fi.logger.WithError(err).Error("failed to pause VM")
+		return err
+	}
+	m.MetricMap[metrics.PauseVM] = metrics.ToUS(time.Since(tStart))
+
+	return nil
+}
+
+// mergeMetrics merges the metrics of consecutive operations, any of which may be nil
+func mergeMetrics(ms ...*metrics.Metric) *metrics.Metric {
+	merged := metrics.NewMetric()
+	for _, m := range ms {
+		if m == nil {
+			continue
+		}
+		for name, us := range m.MetricMap {
+			merged.MetricMap[name] += us
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,494 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// kubeEventBurst and kubeEventInterval rate-limit the events posted on each
+	// pod: a pod gets kubeEventBurst events at once, then one per interval
+	kubeEventBurst    = 10
+	kubeEventInterval = 5 * time.Second
+	// kubeEventQueue is the number of events waiting to be posted, the others are dropped
+	kubeEventQueue = 256
+	// kubeEventTimeout is the timeout of posting an event to the API server
+	kubeEventTimeout = 10 * time.Second
+	// kubeEventComponent is the source component of the events
+	kubeEventComponent = "vhive"
+
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// KubeEventRecorder is an event recorder posting the events of the instances
+// as Kubernetes events on their pods through the API server. The events are
+// posted in the background and rate-limited per pod, the events in excess
+// being dropped.
+type KubeEventRecorder struct {
+	server *url.URL
+	token  string
+	client *http.Client
+	host   string
+
+	limiter *podEventLimiter
+	queue   chan kubeEvent
+	done    chan struct{}
+	close   sync.Once
+}
+
+// kubeAPIConfig is how to reach and authenticate to the API server
+type kubeAPIConfig struct {
+	server string
+	token  string
+	tls    *tls.Config
+}
+
+// kubeEvent is a core/v1 Event
+type kubeEvent struct {
+	Metadata           kubeObjectMeta      `json:"metadata"`
+	InvolvedObject     kubeObjectReference `json:"involvedObject"`
+	Reason             string              `json:"reason"`
+	Message            string              `json:"message"`
+	Type               string              `json:"type"`
+	Source             kubeEventSource     `json:"source"`
+	FirstTimestamp     time.Time           `json:"firstTimestamp"`
+	LastTimestamp      time.Time           `json:"lastTimestamp"`
+	Count              int32               `json:"count"`
+	ReportingComponent string              `json:"reportingComponent"`
+	ReportingInstance  string              `json:"reportingInstance"`
+}
+
+type kubeObjectMeta struct {
+	GenerateName string `json:"generateName"`
+	Namespace    string `json:"namespace"`
+}
+
+type kubeObjectReference struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	UID        string `json:"uid,omitempty"`
+}
+
+type kubeEventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host"`
+}
+
+// NewKubeEventRecorder returns an event recorder posting the events to the
+// API server of the given kubeconfig, or of the cluster vHive runs in if
+// kubeconfig is empty. host is the node reported as the source of the events.
+func NewKubeEventRecorder(kubeconfig, host string) (*KubeEventRecorder, error) {
+	var (
+		cfg *kubeAPIConfig
+		err error
+	)
+	if kubeconfig == "" {
+		cfg, err = inClusterConfig()
+	} else {
+		cfg, err = loadKubeconfig(kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := url.Parse(cfg.server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server %q: %v", cfg.server, err)
+	}
+
+	r := &KubeEventRecorder{
+		server:  server,
+		token:   cfg.token,
+		client:  &http.Client{Transport: &http.Transport{TLSClientConfig: cfg.tls}},
+		host:    host,
+		limiter: newPodEventLimiter(kubeEventBurst, kubeEventInterval),
+		queue:   make(chan kubeEvent, kubeEventQueue),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+
+	return r, nil
+}
+
+// Eventf queues an event on the pod if the pod is not over its rate limit
+func (r *KubeEventRecorder) Eventf(pod PodRef, eventType, reason, messageFmt string, args ...interface{}) {
+	if pod.Name == "" || pod.Namespace == "" {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{"pod": pod.Namespace + "/" + pod.Name, "reason": reason})
+	if !r.limiter.allow(pod.Namespace + "/" + pod.Name) {
+		logger.Debug("dropping event of pod over its rate limit")
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	event := kubeEvent{
+		Metadata: kubeObjectMeta{GenerateName: pod.Name + ".", Namespace: pod.Namespace},
+		InvolvedObject: kubeObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Name:       pod.Name,
+			Namespace:  pod.Namespace,
+			UID:        pod.UID,
+		},
+		Reason:             reason,
+		Message:            fmt.Sprintf(messageFmt, args...),
+		Type:               eventType,
+		Source:             kubeEventSource{Component: kubeEventComponent, Host: r.host},
+		FirstTimestamp:     now,
+		LastTimestamp:      now,
+		Count:              1,
+		ReportingComponent: kubeEventComponent,
+		ReportingInstance:  r.host,
+	}
+
+	select {
+	case r.queue <- event:
+	default:
+		logger.Warn("dropping event, too many events waiting to be posted")
+	}
+}
+
+// Close posts the queued events and stops the recorder
+func (r *KubeEventRecorder) Close() {
+	r.close.Do(func() { close(r.queue) })
+	<-r.done
+}
+
+func (r *KubeEventRecorder) run() {
+	defer close(r.done)
+
+	for event := range r.queue {
+		if err := r.post(event); err != nil {
+			log.WithError(err).WithField("pod", event.InvolvedObject.Namespace+"/"+event.InvolvedObject.Name).
+				Warn("failed to post event")
+		}
+	}
+}
+
+func (r *KubeEventRecorder) post(event kubeEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeEventTimeout)
+	defer cancel()
+
+	u := *r.server
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/namespaces/" + url.PathEscape(event.Metadata.Namespace) + "/events"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("API server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// podEventLimiter is a token bucket of the events of each pod
+type podEventLimiter struct {
+	sync.Mutex
+	burst    float64
+	interval time.Duration
+	buckets  map[string]*eventBucket
+	now      func() time.Time
+}
+
+type eventBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newPodEventLimiter(burst int, interval time.Duration) *podEventLimiter {
+	return &podEventLimiter{
+		burst:    float64(burst),
+		interval: interval,
+		buckets:  make(map[string]*eventBucket),
+		now:      time.Now,
+	}
+}
+
+// allow takes a token of the pod, returning false if the pod has none left
+func (l *podEventLimiter) allow(pod string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	b, ok := l.buckets[pod]
+	if !ok {
+		b = &eventBucket{tokens: l.burst, last: now}
+		l.buckets[pod] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+func (l *podEventLimiter) refill(b *eventBucket, now time.Time) float64 {
+	tokens := b.tokens + float64(now.Sub(b.last))/float64(l.interval)
+	if tokens > l.burst {
+		tokens = l.burst
+	}
+	return tokens
+}
+
+// pruneLocked forgets the pods whose bucket refilled, e.g., removed pods
+func (l *podEventLimiter) pruneLocked(now time.Time) {
+	for pod, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, pod)
+		}
+	}
+}
+
+// inClusterConfig returns the config of the API server of the cluster
+// vHive runs in, from the environment and service account of its pod
+func inClusterConfig() (*kubeAPIConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	token, err := ioutil.ReadFile(inClusterTokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := kubeTLSConfig(nil, inClusterCAFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubeAPIConfig{
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  strings.TrimSpace(string(token)),
+		tls:    tlsConfig,
+	}, nil
+}
+
+// kubeconfig is the subset of a kubeconfig file used to post events
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// loadKubeconfig returns the config of the API server of the current
+// context of a kubeconfig file, authenticated by token or client certificate
+func loadKubeconfig(path string) (*kubeAPIConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+	}
+
+	// Relative paths in a kubeconfig are relative to the kubeconfig
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %s: context %q not found", path, kc.CurrentContext)
+	}
+
+	cfg := &kubeAPIConfig{}
+	found := false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+
+		ca, err := decodeKubeconfigData(c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: invalid certificate-authority-data: %v", path, err)
+		}
+		cfg.server = c.Cluster.Server
+		if cfg.tls, err = kubeTLSConfig(ca, resolve(c.Cluster.CertificateAuthority), c.Cluster.InsecureSkipTLSVerify); err != nil {
+			return nil, err
+		}
+	}
+	if !found || cfg.server == "" {
+		return nil, fmt.Errorf("kubeconfig %s: server of cluster %q not found", path, clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil {
+			return nil, fmt.Errorf("kubeconfig %s: exec credential plugins are not supported", path)
+		}
+
+		cfg.token = u.User.Token
+		if u.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(resolve(u.User.TokenFile))
+			if err != nil {
+				return nil, err
+			}
+			cfg.token = strings.TrimSpace(string(token))
+		}
+
+		cert, err := kubeconfigFileOrData(resolve(u.User.ClientCertificate), u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: invalid client certificate: %v", path, err)
+		}
+		key, err := kubeconfigFileOrData(resolve(u.User.ClientKey), u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: invalid client key: %v", path, err)
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: invalid client certificate: %v", path, err)
+			}
+			cfg.tls.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	return cfg, nil
+}
+
+func decodeKubeconfigData(data string) ([]byte, error) {
+	if data == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+func kubeconfigFileOrData(path, data string) ([]byte, error) {
+	if path != "" {
+		return ioutil.ReadFile(path)
+	}
+	return decodeKubeconfigData(data)
+}
+
+// kubeTLSConfig returns the TLS config trusting the CA of the API server,
+// given as PEM or by file, or the system CAs if neither is given
+func kubeTLSConfig(caPEM []byte, caFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+
+	if caPEM == nil && caFile != "" {
+		var err error
+		if caPEM, err = ioutil.ReadFile(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if caPEM != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no valid certificate in the CA of the API server")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,190 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newEventServer returns an API server recording the events posted to it
+// and the kubeconfig of the server
+func newEventServer(t *testing.T) (*[]kubeEvent, *sync.Mutex, string) {
+	var (
+		mu     sync.Mutex
+		events []kubeEvent
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/namespaces/default/events" ||
+			r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request", http.StatusForbidden)
+			return
+		}
+
+		var event kubeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: node
+clusters:
+- name: cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: node
+  context:
+    cluster: cluster
+    user: vhive
+users:
+- name: vhive
+  user:
+    token: secret
+`, server.URL, base64.StdEncoding.EncodeToString(ca))), 0600))
+
+	return &events, &mu, kubeconfig
+}
+
+func TestKubeEventRecorderPostsEvents(t *testing.T) {
+	events, mu, kubeconfig := newEventServer(t)
+
+	r, err := NewKubeEventRecorder(kubeconfig, "node1")
+	require.NoError(t, err, "failed to create recorder")
+
+	pod := PodRef{Name: "helloworld-00001-deployment-abc", Namespace: "default", UID: "uid1"}
+	r.Eventf(pod, "Normal", eventVMStarted, "%s start in %s", bootSnapshot, 10*time.Millisecond)
+	// Events without a pod are not posted
+	r.Eventf(PodRef{}, "Normal", eventVMStarted, "no pod")
+	r.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, *events, 1, "event was not posted")
+	event := (*events)[0]
+	require.Equal(t, kubeObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Name:       pod.Name,
+		Namespace:  pod.Namespace,
+		UID:        pod.UID,
+	}, event.InvolvedObject)
+	require.Equal(t, "default", event.Metadata.Namespace)
+	require.Equal(t, pod.Name+".", event.Metadata.GenerateName)
+	require.Equal(t, "Normal", event.Type)
+	require.Equal(t, eventVMStarted, event.Reason)
+	require.Equal(t, "snapshot start in 10ms", event.Message)
+	require.Equal(t, kubeEventSource{Component: "vhive", Host: "node1"}, event.Source)
+	require.EqualValues(t, 1, event.Count)
+	require.False(t, event.FirstTimestamp.IsZero(), "event has no timestamp")
+}
+
+func TestKubeEventRecorderRateLimited(t *testing.T) {
+	events, mu, kubeconfig := newEventServer(t)
+
+	r, err := NewKubeEventRecorder(kubeconfig, "node1")
+	require.NoError(t, err, "failed to create recorder")
+
+	busy := PodRef{Name: "busy", Namespace: "default"}
+	for i := 0; i < 2*kubeEventBurst; i++ {
+		r.Eventf(busy, "Normal", eventVMStarted, "event %d", i)
+	}
+	// The other pods have their own budget
+	r.Eventf(PodRef{Name: "quiet", Namespace: "default"}, "Normal", eventVMStarted, "event")
+	r.Close()
+
+	perPod := map[string]int{}
+	mu.Lock()
+	for _, event := range *events {
+		perPod[event.InvolvedObject.Name]++
+	}
+	mu.Unlock()
+	require.Equal(t, map[string]int{"busy": kubeEventBurst, "quiet": 1}, perPod)
+}
+
+func TestPodEventLimiter(t *testing.T) {
+	now := time.Now()
+	l := newPodEventLimiter(2, time.Second)
+	l.now = func() time.Time { return now }
+
+	require.True(t, l.allow("pod"))
+	require.True(t, l.allow("pod"))
+	require.False(t, l.allow("pod"), "burst was exceeded")
+
+	now = now.Add(time.Second)
+	require.True(t, l.allow("pod"), "bucket was not refilled")
+	require.False(t, l.allow("pod"), "bucket was refilled beyond the interval")
+
+	// The pods whose bucket refilled are forgotten
+	now = now.Add(time.Minute)
+	require.True(t, l.allow("other"))
+	require.NotContains(t, l.buckets, "pod", "refilled bucket was kept")
+}
+
+func TestLoadKubeconfigUnsupported(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(kubeconfig, []byte(`current-context: node
+clusters:
+- name: cluster
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: node
+  context:
+    cluster: cluster
+    user: vhive
+users:
+- name: vhive
+  user:
+    exec:
+      command: aws
+`), 0600))
+
+	_, err := loadKubeconfig(kubeconfig)
+	require.Error(t, err, "exec credential plugin was accepted")
+
+	_, err = NewKubeEventRecorder(filepath.Join(t.TempDir(), "missing"), "node1")
+	require.Error(t, err, "missing kubeconfig was accepted")
+}
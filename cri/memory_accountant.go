@@ -0,0 +1,320 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const hostMeminfoPath = "/proc/meminfo"
+
+// ErrMemoryBudgetExceeded is returned when starting or resuming a VM would
+// bring the guest memory committed on the node above the TotalMemBudgetMib
+// of the config
+var ErrMemoryBudgetExceeded = errors.New("memory budget of the VMs is exceeded")
+
+// memoryBudgetError is ErrMemoryBudgetExceeded with the memory at stake,
+// returned to kubelet as ResourceExhausted
+type memoryBudgetError struct {
+	committedMib, requestedMib, budgetMib uint64
+}
+
+func (e *memoryBudgetError) Error() string {
+	return fmt.Sprintf("%v: %d MiB committed, %d MiB requested, %d MiB allowed",
+		ErrMemoryBudgetExceeded, e.committedMib, e.requestedMib, e.budgetMib)
+}
+
+func (e *memoryBudgetError) Is(target error) bool {
+	return target == ErrMemoryBudgetExceeded
+}
+
+func (e *memoryBudgetError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// MemoryStats describes the guest memory committed on the node
+type MemoryStats struct {
+	TotalMib uint64 `json:"totalMib"`
+	// CommitRatio is the fraction of the node memory that may be committed,
+	// 0 if admission is disabled
+	CommitRatio  float64 `json:"commitRatio"`
+	CapacityMib  uint64  `json:"capacityMib"`
+	CommittedMib uint64  `json:"committedMib"`
+	// PausedMib is the part of CommittedMib of the paused VMs, which does
+	// not count toward BudgetMib
+	PausedMib    uint64 `json:"pausedMib"`
+	AvailableMib uint64 `json:"availableMib"`
+	// BudgetMib is the TotalMemBudgetMib of the config, 0 if unlimited
+	BudgetMib uint64 `json:"budgetMib"`
+}
+
+// memoryAccountant tracks the guest memory committed to the running and
+// paused VMs, offloaded VMs do not count. Each VM commits its whole configured
+// memory, less the memory reclaimed by its balloon. The paused VMs, e.g.,
+// parked ones, keep their guest memory without a balloon, so they count
+// toward the capacity of the node but not toward the budget of the VMs.
+type memoryAccountant struct {
+	sync.Mutex
+
+	// totalMib is the memory of the node, 0 if unknown
+	totalMib     uint64
+	ratio        float64
+	committed    map[string]uint64
+	committedMib uint64
+	paused       map[string]bool
+	pausedMib    uint64
+
+	// budgetMib returns the memory that may be committed whatever the
+	// memory of the node, 0 or nil for no budget
+	budgetMib func() uint64
+}
+
+func newMemoryAccountant(totalMib uint64, ratio float64) *memoryAccountant {
+	return &memoryAccountant{
+		totalMib:  totalMib,
+		ratio:     ratio,
+		committed: make(map[string]uint64),
+		paused:    make(map[string]bool),
+	}
+}
+
+// capacity returns the memory that may be committed, 0 for no limit
+func (a *memoryAccountant) capacity() uint64 {
+	if a.ratio <= 0 || a.totalMib == 0 {
+		return 0
+	}
+
+	return uint64(float64(a.totalMib) * a.ratio)
+}
+
+// budget returns the memory budget of the VMs, 0 for no budget
+func (a *memoryAccountant) budget() uint64 {
+	if a.budgetMib == nil {
+		return 0
+	}
+
+	return a.budgetMib()
+}
+
+// admitBudget checks that running mib more memory stays within the budget,
+// with the lock held
+func (a *memoryAccountant) admitBudget(mib uint64) error {
+	running := a.committedMib - a.pausedMib
+	if budget := a.budget(); budget != 0 && running+mib > budget {
+		return &memoryBudgetError{committedMib: running, requestedMib: mib, budgetMib: budget}
+	}
+
+	return nil
+}
+
+// admit checks that committing mib more memory stays within the budget and
+// the capacity, with the lock held
+func (a *memoryAccountant) admit(mib uint64) error {
+	if err := a.admitBudget(mib); err != nil {
+		return err
+	}
+
+	if capacity := a.capacity(); capacity != 0 && a.committedMib+mib > capacity {
+		return status.Errorf(codes.ResourceExhausted,
+			"node memory is oversubscribed: %d MiB committed, %d MiB requested, %d MiB allowed",
+			a.committedMib, mib, capacity)
+	}
+
+	return nil
+}
+
+// commit admits a VM with the given memory unless it would exceed the capacity.
+// A paused VM, committed already, is resumed unless it would exceed the budget.
+func (a *memoryAccountant) commit(vmID string, mib uint32) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if old, ok := a.committed[vmID]; ok {
+		if !a.paused[vmID] {
+			return nil
+		}
+		if err := a.admitBudget(old); err != nil {
+			return err
+		}
+
+		delete(a.paused, vmID)
+		a.pausedMib -= old
+		return nil
+	}
+
+	if err := a.admit(uint64(mib)); err != nil {
+		return err
+	}
+
+	a.committed[vmID] = uint64(mib)
+	a.committedMib += uint64(mib)
+
+	return nil
+}
+
+// resize changes the memory committed to a VM, e.g., by its balloon,
+// unless growing it would exceed the capacity
+func (a *memoryAccountant) resize(vmID string, mib uint32) error {
+	a.Lock()
+	defer a.Unlock()
+
+	old, ok := a.committed[vmID]
+	if !ok {
+		return nil
+	}
+
+	if uint64(mib) > old {
+		if err := a.admit(uint64(mib) - old); err != nil {
+			return err
+		}
+	}
+
+	a.committed[vmID] = uint64(mib)
+	a.committedMib += uint64(mib) - old
+	if a.paused[vmID] {
+		a.pausedMib += uint64(mib) - old
+	}
+
+	return nil
+}
+
+// pause exempts the memory committed to a paused VM from the budget, the VM
+// still holding it, until the VM is committed again when resumed
+func (a *memoryAccountant) pause(vmID string) {
+	a.Lock()
+	defer a.Unlock()
+
+	mib, ok := a.committed[vmID]
+	if !ok || a.paused[vmID] {
+		return
+	}
+
+	a.paused[vmID] = true
+	a.pausedMib += mib
+}
+
+// release frees the memory committed to a VM, if any
+func (a *memoryAccountant) release(vmID string) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.paused[vmID] {
+		a.pausedMib -= a.committed[vmID]
+		delete(a.paused, vmID)
+	}
+	a.committedMib -= a.committed[vmID]
+	delete(a.committed, vmID)
+}
+
+func (a *memoryAccountant) stats() MemoryStats {
+	a.Lock()
+	defer a.Unlock()
+
+	s := MemoryStats{
+		TotalMib:     a.totalMib,
+		CommitRatio:  a.ratio,
+		CapacityMib:  a.capacity(),
+		CommittedMib: a.committedMib,
+		PausedMib:    a.pausedMib,
+		BudgetMib:    a.budget(),
+	}
+	if s.CapacityMib == 0 {
+		s.CapacityMib = a.totalMib
+	}
+	if s.CapacityMib > s.CommittedMib {
+		s.AvailableMib = s.CapacityMib - s.CommittedMib
+	}
+
+	// The paused VMs do not count toward the budget
+	if s.BudgetMib != 0 {
+		var left uint64
+		if running := s.CommittedMib - s.PausedMib; s.BudgetMib > running {
+			left = s.BudgetMib - running
+		}
+		if s.CapacityMib == 0 || left < s.AvailableMib {
+			s.AvailableMib = left
+		}
+		if s.CapacityMib == 0 || s.BudgetMib < s.CapacityMib {
+			s.CapacityMib = s.BudgetMib
+		}
+	}
+
+	return s
+}
+
+// writeMemoryMetrics writes the guest memory committed on the node and its
+// budget, if any, in the Prometheus text format
+func writeMemoryMetrics(w io.Writer, stats MemoryStats) error {
+	if _, err := fmt.Fprintf(w, "# HELP vhive_memory_committed_mib Guest memory committed to the running and paused VMs in MiB.\n"+
+		"# TYPE vhive_memory_committed_mib gauge\nvhive_memory_committed_mib %d\n", stats.CommittedMib); err != nil {
+		return err
+	}
+
+	if stats.BudgetMib == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "# HELP vhive_memory_budget_mib Guest memory that may be committed to the VMs in MiB.\n"+
+		"# TYPE vhive_memory_budget_mib gauge\nvhive_memory_budget_mib %d\n", stats.BudgetMib)
+
+	return err
+}
+
+// readHostMemTotal returns the memory of the host from the meminfo,
+// whose lines look like "MemTotal:       16318848 kB"
+func readHostMemTotal(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kib, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, errors.Wrapf(err, "malformed %s", path)
+			}
+
+			return kib / 1024, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.Errorf("no MemTotal in %s", path)
+}
@@ -0,0 +1,253 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadHostMemTotal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meminfo")
+	require.NoError(t, ioutil.WriteFile(path, []byte("MemTotal:        2097152 kB\nMemFree:          524288 kB\n"), 0644))
+
+	total, err := readHostMemTotal(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2048), total)
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	// The VMs have the default 256 MiB
+	start := func(t *testing.T, c *coordinator, containerID string) error {
+		fi, err := c.startVM(context.Background(), "img")
+		if err != nil {
+			return err
+		}
+
+		return c.insertActive("pod", containerID, fi)
+	}
+
+	t.Run("CreateRemove", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+		c.mem = newMemoryAccountant(1024, 0.5)
+
+		require.NoError(t, start(t, c, "ctr1"))
+		require.NoError(t, start(t, c, "ctr2"))
+		require.Equal(t, MemoryStats{TotalMib: 1024, CommitRatio: 0.5, CapacityMib: 512, CommittedMib: 512}, c.mem.stats())
+
+		err := start(t, c, "ctr3")
+		require.Equal(t, codes.ResourceExhausted, status.Code(err), "oversubscribing VM was admitted")
+		require.Equal(t, 2, orch.NumStarted(), "oversubscribing VM was started")
+
+		require.NoError(t, c.stopVM(context.Background(), "ctr1"))
+		require.Equal(t, uint64(256), c.mem.stats().AvailableMib, "memory of the removed VM was not released")
+
+		require.NoError(t, start(t, c, "ctr3"))
+		require.Equal(t, uint64(0), c.mem.stats().AvailableMib)
+	})
+
+	t.Run("OffloadLoad", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.SnapshotsEnabled = true
+		c := newCoordinator(orch)
+		c.mem = newMemoryAccountant(1024, 0.25)
+
+		require.NoError(t, start(t, c, "ctr1"))
+		require.NoError(t, c.stopVM(context.Background(), "ctr1"))
+		require.Equal(t, uint64(0), c.mem.stats().CommittedMib, "memory of the offloaded VM was not released")
+
+		require.NoError(t, start(t, c, "ctr2"))
+		require.Equal(t, 1, orch.NumStarted(), "idle VM was not loaded")
+		require.Equal(t, uint64(256), c.mem.stats().CommittedMib, "memory of the loaded VM was not committed")
+
+		err := start(t, c, "ctr3")
+		require.Equal(t, codes.ResourceExhausted, status.Code(err), "oversubscribing VM was admitted")
+	})
+
+	t.Run("FailedStart", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.StartErr = errInjected
+		c := newCoordinator(orch)
+		c.mem = newMemoryAccountant(1024, 1)
+
+		require.Error(t, start(t, c, "ctr1"))
+		require.Equal(t, uint64(0), c.mem.stats().CommittedMib, "memory of the failed VM was not released")
+	})
+
+	t.Run("FailedStop", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+		c.mem = newMemoryAccountant(1024, 1)
+
+		require.NoError(t, start(t, c, "ctr1"))
+		orch.StopErr = errInjected
+		err := c.stopVM(context.Background(), "ctr1")
+		require.True(t, errors.Is(err, errInjected), "failed stop was not returned: %v", err)
+		require.Equal(t, uint64(0), c.mem.stats().CommittedMib, "memory of the VM that failed to stop was not released")
+	})
+}
+
+func TestMemoryBudget(t *testing.T) {
+	withBudget := func(c *coordinator, mib uint64) {
+		cfg := DefaultConfig()
+		cfg.TotalMemBudgetMib = mib
+		c.config.set(cfg)
+	}
+
+	start := func(t *testing.T, c *coordinator, containerID string) error {
+		fi, err := c.startVM(context.Background(), "img")
+		if err != nil {
+			return err
+		}
+
+		return c.insertActive("pod", containerID, fi)
+	}
+
+	t.Run("BootUpToBudget", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		c := newCoordinator(orch)
+		withBudget(c, 768)
+
+		for _, containerID := range []string{"ctr1", "ctr2", "ctr3"} {
+			require.NoError(t, start(t, c, containerID), "VM within the budget was rejected")
+		}
+		require.EqualValues(t, 768, c.mem.stats().CommittedMib)
+
+		err := start(t, c, "ctr4")
+		require.True(t, errors.Is(err, ErrMemoryBudgetExceeded), "VM beyond the budget was admitted: %v", err)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err), "budget error does not map to ResourceExhausted")
+		require.Equal(t, 3, orch.NumStarted(), "VM beyond the budget was started")
+
+		// A reload of the config changes the budget of the next VMs
+		withBudget(c, 1024)
+		require.NoError(t, start(t, c, "ctr4"), "VM within the reloaded budget was rejected")
+	})
+
+	t.Run("PausedDoNotCount", func(t *testing.T) {
+		c := newCoordinator(fakes.NewOrchestrator())
+		withBudget(c, 512)
+
+		require.NoError(t, start(t, c, "ctr1"))
+		require.NoError(t, start(t, c, "ctr2"))
+
+		_, err := c.PauseInstance(context.Background(), "ctr1")
+		require.NoError(t, err, "failed to pause VM")
+		stats := c.mem.stats()
+		require.EqualValues(t, 512, stats.CommittedMib, "memory held by the paused VM was released")
+		require.EqualValues(t, 256, stats.PausedMib, "paused VM counts toward the budget")
+		require.EqualValues(t, 256, stats.AvailableMib, "budget left by the paused VM is not available")
+
+		require.NoError(t, start(t, c, "ctr3"), "VM within the budget left by the paused VM was rejected")
+
+		_, err = c.ResumeInstance(context.Background(), "ctr1")
+		require.True(t, errors.Is(err, ErrMemoryBudgetExceeded), "paused VM was resumed beyond the budget: %v", err)
+		state, _ := c.activeInstances["ctr1"].history.get()
+		require.Equal(t, vmStatePaused, state, "VM that could not be resumed is not paused")
+
+		require.NoError(t, c.stopVM(context.Background(), "ctr3"))
+		_, err = c.ResumeInstance(context.Background(), "ctr1")
+		require.NoError(t, err, "paused VM within the budget was not resumed")
+		stats = c.mem.stats()
+		require.EqualValues(t, 512, stats.CommittedMib, "memory of the resumed VM was not committed")
+		require.Zero(t, stats.PausedMib, "resumed VM is still exempt from the budget")
+	})
+
+	t.Run("PausedCountTowardCapacity", func(t *testing.T) {
+		c := newCoordinator(fakes.NewOrchestrator())
+		c.mem = newMemoryAccountant(1024, 0.5)
+		withBudget(c, 1024)
+
+		require.NoError(t, start(t, c, "ctr1"))
+		require.NoError(t, start(t, c, "ctr2"))
+		_, err := c.PauseInstance(context.Background(), "ctr1")
+		require.NoError(t, err, "failed to pause VM")
+
+		// The paused VM still holds its guest memory without a balloon
+		err = start(t, c, "ctr3")
+		require.Equal(t, codes.ResourceExhausted, status.Code(err), "VM oversubscribing the node was admitted")
+		require.False(t, errors.Is(err, ErrMemoryBudgetExceeded), "VM within the budget was rejected by it: %v", err)
+		require.Zero(t, c.mem.stats().AvailableMib)
+
+		require.NoError(t, c.stopVM(context.Background(), "ctr1"))
+		require.NoError(t, start(t, c, "ctr3"), "VM within the memory released by the paused VM was rejected")
+	})
+}
+
+func TestCreateUserContainerMemoryBudget(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	cfg := DefaultConfig()
+	cfg.TotalMemBudgetMib = 256
+	s.coordinator.config.set(cfg)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "container beyond the memory budget was created")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "vhive_memory_committed_mib 256\n", "committed memory gauge is missing")
+	require.Contains(t, string(body), "vhive_memory_budget_mib 256\n", "memory budget gauge is missing")
+}
+
+func TestCreateUserContainerOversubscribed(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	s.coordinator.mem = newMemoryAccountant(512, 0.5)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "oversubscribing container was created")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/memory")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	var stats MemoryStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	require.Equal(t, MemoryStats{TotalMib: 512, CommitRatio: 0.5, CapacityMib: 256, CommittedMib: 256}, stats)
+}
@@ -0,0 +1,49 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"time"
+
+	"github.com/ease-lab/vhive/deviceplugin"
+)
+
+// microVMReconcileInterval is how often the slots leaked by the VMs that
+// left without their container being removed, e.g. evicted ones, are freed
+const microVMReconcileInterval = time.Minute
+
+// startMicroVMResource advertises the microVM slots of the node to kubelet
+// and starts reconciling them with the active VMs
+func (s *Service) startMicroVMResource() {
+	slots := int(s.MemoryStats().CapacityMib / s.microVMReservationMib)
+	s.microVMs = deviceplugin.NewAllocator(slots)
+
+	s.devicePlugin = deviceplugin.NewPlugin(s.microVMs, s.devicePluginDir)
+	if err := s.devicePlugin.Start(); err != nil {
+		coordLog.WithError(err).Error("failed to advertise microVM slots to kubelet")
+	}
+
+	s.runPeriodically(microVMReconcileInterval, func() {
+		s.microVMs.Reconcile(s.coordinator.activeContainers())
+	})
+}
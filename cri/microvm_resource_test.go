@@ -0,0 +1,67 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/deviceplugin"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestMicroVMSlots(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	s.microVMs = deviceplugin.NewAllocator(2)
+
+	free := func() int {
+		n := 0
+		for _, d := range s.microVMs.Devices() {
+			if d.GetHealth() == "Healthy" {
+				n++
+			}
+		}
+		return n
+	}
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 1, free(), "slot was not occupied by the VM")
+
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 0, free(), "slot was not occupied by the VM")
+
+	_, err = s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: resp.GetContainerId()})
+	require.NoError(t, err, "container removal failed")
+	require.Eventually(t, func() bool { return free() == 1 }, 5*time.Second, 10*time.Millisecond, "slot was not freed on removal")
+
+	// A VM that left without its container being removed leaks its slot until reconciled
+	require.NoError(t, s.coordinator.stopVM(context.Background(), "ctr2"))
+	require.Equal(t, 1, free())
+	s.microVMs.Reconcile(s.coordinator.activeContainers())
+	require.Equal(t, 2, free(), "leaked slot was not reconciled")
+}
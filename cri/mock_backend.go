@@ -0,0 +1,459 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockLatencies are the latencies the mock backend injects into the
+// operations on its VMs, which stand for the ones of Firecracker, none by default
+type MockLatencies struct {
+	Boot     time.Duration `yaml:"boot"`
+	Stop     time.Duration `yaml:"stop"`
+	Pause    time.Duration `yaml:"pause"`
+	Resume   time.Duration `yaml:"resume"`
+	Snapshot time.Duration `yaml:"snapshot"`
+	Load     time.Duration `yaml:"load"`
+	Offload  time.Duration `yaml:"offload"`
+}
+
+func (l MockLatencies) validate() error {
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"boot", l.Boot},
+		{"stop", l.Stop},
+		{"pause", l.Pause},
+		{"resume", l.Resume},
+		{"snapshot", l.Snapshot},
+		{"load", l.Load},
+		{"offload", l.Offload},
+	} {
+		if d.value < 0 {
+			return errors.Errorf("%s must not be negative", d.name)
+		}
+	}
+
+	return nil
+}
+
+// mockOrchestrator is the backend of the VMs for developing vHive without
+// KVM, whose VMs are in-process gRPC servers standing in for the guests.
+// Each guest serves the helloworld function on its own loopback address, on
+// the PORT of the function or the guest port, and the operations on the VMs
+// only inject the latencies of the config.
+type mockOrchestrator struct {
+	sync.Mutex
+
+	// config is the config of the service, with the latencies
+	config           *configStore
+	snapshotsEnabled bool
+	// snapshotDir holds the empty snapshot files of the VMs
+	snapshotDir string
+	// nextIP numbers the loopback addresses of the guests
+	nextIP uint32
+	vms    map[string]*mockVM
+}
+
+// mockVM is a VM of the mock backend
+type mockVM struct {
+	guestIP string
+	port    string
+	image   string
+	// guest is the server of the function, nil while the VM is offloaded
+	guest  *grpc.Server
+	exited chan ctriface.VMExit
+}
+
+func newMockOrchestrator(snapshotsEnabled bool, snapshotDir string) *mockOrchestrator {
+	return &mockOrchestrator{
+		config:           newConfigStore(DefaultConfig()),
+		snapshotsEnabled: snapshotsEnabled,
+		snapshotDir:      snapshotDir,
+		vms:              make(map[string]*mockVM),
+	}
+}
+
+// mockGreeter is the helloworld function of the guests of the mock backend
+type mockGreeter struct {
+	hpb.UnimplementedGreeterServer
+}
+
+func (*mockGreeter) SayHello(ctx context.Context, req *hpb.HelloRequest) (*hpb.HelloReply, error) {
+	return &hpb.HelloReply{Message: "Hello, " + req.GetName() + "_response!"}, nil
+}
+
+// startGuest starts serving the function of a VM
+func (vm *mockVM) startGuest() error {
+	lis, err := net.Listen("tcp", net.JoinHostPort(vm.guestIP, vm.port))
+	if err != nil {
+		return err
+	}
+
+	vm.guest = grpc.NewServer()
+	hpb.RegisterGreeterServer(vm.guest, &mockGreeter{})
+	go func(guest *grpc.Server) {
+		_ = guest.Serve(lis)
+	}(vm.guest)
+
+	return nil
+}
+
+// stopGuest stops serving the function of a VM, closing its connections
+func (vm *mockVM) stopGuest() {
+	if vm.guest != nil {
+		vm.guest.Stop()
+		vm.guest = nil
+	}
+}
+
+// exit reports the exit of the guest of a stopped VM
+func (vm *mockVM) exit() {
+	vm.exited <- ctriface.VMExit{ExitCode: 137, ExitedAt: time.Now()}
+	close(vm.exited)
+}
+
+func (vm *mockVM) response() *ctriface.StartVMResponse {
+	vm.exited = make(chan ctriface.VMExit, 1)
+
+	return &ctriface.StartVMResponse{
+		GuestIP:     vm.guestIP,
+		ImageDigest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(vm.image))),
+		Exited:      vm.exited,
+		NUMANode:    -1,
+	}
+}
+
+// mockLatency injects the latency of an operation, returning early if ctx is done
+func mockLatency(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (o *mockOrchestrator) latencies() MockLatencies {
+	return o.config.get().MockLatencies
+}
+
+func (o *mockOrchestrator) getVM(vmID string) (*mockVM, error) {
+	vm, ok := o.vms[vmID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "VM %s does not exist", vmID)
+	}
+
+	return vm, nil
+}
+
+// guestPort returns the PORT of the function, or the guest port of the config
+func (o *mockOrchestrator) guestPort(env []string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, portEnv+"=") {
+			return strings.TrimPrefix(kv, portEnv+"=")
+		}
+	}
+
+	return o.config.get().GuestPort
+}
+
+func (o *mockOrchestrator) StartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	vmOpts := ctriface.NewStartVMOptions(opts...)
+	tStart := time.Now()
+
+	if err := mockLatency(ctx, o.latencies().Boot); err != nil {
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: err}
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	if _, ok := o.vms[vmID]; ok {
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseNetwork, Err: errors.Errorf("VM %s already exists", vmID)}
+	}
+
+	// The guests are numbered from 127.1.0.1, clear of the loopback address of the host
+	o.nextIP++
+	vm := &mockVM{
+		guestIP: fmt.Sprintf("127.1.%d.%d", o.nextIP>>8&0xff, o.nextIP&0xff),
+		port:    o.guestPort(vmOpts.Env),
+		image:   imageName,
+	}
+	if err := vm.startGuest(); err != nil {
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: errors.Wrap(err, "failed to start the guest")}
+	}
+	o.vms[vmID] = vm
+
+	vmOpts.PhaseRecorder.Mark(metrics.PhaseFirecrackerAPI)
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.BootVM] = metrics.ToUS(time.Since(tStart))
+
+	log.WithFields(log.Fields{"vmID": vmID, "guestIP": vm.guestIP, "port": vm.port}).Debug("started mock VM")
+
+	return vm.response(), m, nil
+}
+
+func (o *mockOrchestrator) StopSingleVM(ctx context.Context, vmID string) error {
+	if err := mockLatency(ctx, o.latencies().Stop); err != nil {
+		return err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	vm, err := o.getVM(vmID)
+	if err != nil {
+		return err
+	}
+
+	vm.stopGuest()
+	vm.exit()
+	delete(o.vms, vmID)
+
+	if o.snapshotDir != "" {
+		if err := os.RemoveAll(filepath.Join(o.snapshotDir, vmID)); err != nil {
+			return errors.Wrap(err, "failed to remove the snapshot of the VM")
+		}
+	}
+
+	return nil
+}
+
+// RestartVM stops the guest of a VM and starts a fresh one on its address
+func (o *mockOrchestrator) RestartVM(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	tStart := time.Now()
+	if err := mockLatency(ctx, o.latencies().Stop+o.latencies().Boot); err != nil {
+		return nil, nil, err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	vm, err := o.getVM(vmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vm.stopGuest()
+	vm.exit()
+	if err := vm.startGuest(); err != nil {
+		delete(o.vms, vmID)
+		return nil, nil, &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: errors.Wrap(err, "failed to start the guest")}
+	}
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.BootVM] = metrics.ToUS(time.Since(tStart))
+
+	return vm.response(), m, nil
+}
+
+func (o *mockOrchestrator) PauseVM(ctx context.Context, vmID string) error {
+	if err := mockLatency(ctx, o.latencies().Pause); err != nil {
+		return err
+	}
+
+	return o.checkVM(vmID)
+}
+
+func (o *mockOrchestrator) ResumeVM(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	tStart := time.Now()
+	if err := mockLatency(ctx, o.latencies().Resume); err != nil {
+		return nil, err
+	}
+	if err := o.checkVM(vmID); err != nil {
+		return nil, err
+	}
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.FcResume] = metrics.ToUS(time.Since(tStart))
+
+	return m, nil
+}
+
+// CreateSnapshot writes empty snapshot files, for the tools reading them
+func (o *mockOrchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
+	if err := mockLatency(ctx, o.latencies().Snapshot); err != nil {
+		return err
+	}
+	if err := o.checkVM(vmID); err != nil {
+		return err
+	}
+	if o.snapshotDir == "" {
+		return nil
+	}
+
+	snapFile, memFile := o.GetSnapshotFiles(vmID)
+	if err := os.MkdirAll(filepath.Dir(snapFile), 0700); err != nil {
+		return errors.Wrap(err, "failed to create the snapshot directory")
+	}
+	for _, file := range []string{snapFile, memFile} {
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			return errors.Wrap(err, "failed to write the snapshot")
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshot starts serving the function of an offloaded VM again
+func (o *mockOrchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	tStart := time.Now()
+	if err := mockLatency(ctx, o.latencies().Load); err != nil {
+		return nil, err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	vm, err := o.getVM(vmID)
+	if err != nil {
+		return nil, err
+	}
+	if vm.guest == nil {
+		if err := vm.startGuest(); err != nil {
+			return nil, errors.Wrap(err, "failed to start the guest")
+		}
+	}
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.LoadVMM] = metrics.ToUS(time.Since(tStart))
+
+	return m, nil
+}
+
+// Offload stops serving the function of a VM until its snapshot is loaded
+func (o *mockOrchestrator) Offload(ctx context.Context, vmID string) error {
+	if err := mockLatency(ctx, o.latencies().Offload); err != nil {
+		return err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	vm, err := o.getVM(vmID)
+	if err != nil {
+		return err
+	}
+	vm.stopGuest()
+
+	return nil
+}
+
+// PrepareRestore boots a VM and offloads it, for a snapshot to be loaded into it
+func (o *mockOrchestrator) PrepareRestore(ctx context.Context, vmID, imageName string, opts ...ctriface.StartVMOption) (*ctriface.StartVMResponse, *metrics.Metric, error) {
+	resp, m, err := o.StartVM(ctx, vmID, imageName, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := o.Offload(ctx, vmID); err != nil {
+		return nil, nil, err
+	}
+
+	return resp, m, nil
+}
+
+func (o *mockOrchestrator) checkVM(vmID string) error {
+	o.Lock()
+	defer o.Unlock()
+
+	_, err := o.getVM(vmID)
+	return err
+}
+
+func (o *mockOrchestrator) EndCPUBoost(vmID string) (*metrics.Metric, error) {
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.CPUBoost] = 0
+
+	return m, o.checkVM(vmID)
+}
+
+func (o *mockOrchestrator) UpdateVMResources(ctx context.Context, vmID string, res ctriface.VMResources) error {
+	return o.checkVM(vmID)
+}
+
+func (o *mockOrchestrator) GetSnapshotsEnabled() bool {
+	return o.snapshotsEnabled
+}
+
+func (o *mockOrchestrator) GetSnapshotFiles(vmID string) (snapFile, memFile string) {
+	return filepath.Join(o.snapshotDir, vmID, "snap_file"), filepath.Join(o.snapshotDir, vmID, "mem_file")
+}
+
+func (o *mockOrchestrator) GetWorkingSetFile(vmID string) string {
+	return filepath.Join(o.snapshotDir, vmID, "working_set_pages")
+}
+
+func (o *mockOrchestrator) GetWorkingSetCorruptions() uint64 {
+	return 0
+}
+
+func (o *mockOrchestrator) GetWorkingSetPrefetches() (prefetched, missed uint64) {
+	return 0, 0
+}
+
+// WaitWorkingSet returns at once, the guests have no guest memory to install
+func (o *mockOrchestrator) WaitWorkingSet(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	return metrics.NewMetric(), nil
+}
+
+// GetVMStats reports no usage, the guests running in the process of vHive
+func (o *mockOrchestrator) GetVMStats(ctx context.Context, vmID string) (*ctriface.VMStats, error) {
+	if err := o.checkVM(vmID); err != nil {
+		return nil, err
+	}
+
+	return &ctriface.VMStats{Timestamp: time.Now()}, nil
+}
+
+func (o *mockOrchestrator) HasVM(vmID string) bool {
+	return o.checkVM(vmID) == nil
+}
@@ -0,0 +1,143 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// freePort returns a port that is free on the loopback addresses
+func freePort(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+
+	return port
+}
+
+// invokeGuest calls the function of a VM as its queue-proxy, at the address of its env
+func invokeGuest(t *testing.T, qp *criapi.CreateContainerRequest) (string, error) {
+	addr, _ := getEnv(qp, guestIPEnv)
+	port, _ := getEnv(qp, guestPortEnv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort(addr, port), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	resp, err := hpb.NewGreeterClient(conn).SayHello(ctx, &hpb.HelloRequest{Name: "record"})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.GetMessage(), nil
+}
+
+func TestMockBackendEndToEnd(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := DefaultConfig()
+	cfg.GuestPort = freePort(t)
+	cfg.MockLatencies = MockLatencies{
+		Boot:     50 * time.Millisecond,
+		Stop:     5 * time.Millisecond,
+		Pause:    5 * time.Millisecond,
+		Resume:   5 * time.Millisecond,
+		Snapshot: 10 * time.Millisecond,
+		Load:     20 * time.Millisecond,
+		Offload:  5 * time.Millisecond,
+	}
+
+	s, err := NewMockService(true, WithConfig(cfg), WithStockClients(&fakes.StockRuntimeClient{}, &fakes.StockImageClient{}))
+	require.NoError(t, err, "failed to create the service")
+	defer s.Shutdown()
+
+	resp, err := s.CreateContainer(ctx, newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "user container creation failed")
+	containerID := resp.GetContainerId()
+
+	qp := newQueueProxyRequest("pod1")
+	_, err = s.CreateContainer(ctx, qp)
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	addr, _ := getEnv(qp, guestIPEnv)
+	require.Equal(t, "127.1.0.1", addr, "queue-proxy does not reach the guest on its loopback address")
+
+	msg, err := invokeGuest(t, qp)
+	require.NoError(t, err, "function invocation failed")
+	require.Equal(t, "Hello, record_response!", msg)
+
+	active := s.coordinator.ListActive()
+	require.Len(t, active, 1)
+	require.Equal(t, bootCold, active[0].BootType)
+	require.GreaterOrEqual(t, int64(active[0].BootTrace.VMBooted.Sub(active[0].BootTrace.Start)), int64(cfg.MockLatencies.Boot),
+		"boot latency was not injected")
+
+	// Pausing and resuming are no-ops on the guest
+	_, err = s.coordinator.PauseInstance(ctx, containerID)
+	require.NoError(t, err, "pause failed")
+	_, err = s.coordinator.ResumeInstance(ctx, containerID)
+	require.NoError(t, err, "resume failed")
+	msg, err = invokeGuest(t, qp)
+	require.NoError(t, err, "function invocation failed after resume")
+	require.Equal(t, "Hello, record_response!", msg)
+
+	// The removed container offloads the VM, whose guest no longer serves
+	_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: containerID})
+	require.NoError(t, err, "container removal failed")
+	require.Eventually(t, func() bool { return len(s.coordinator.ListInstances()) == 1 && len(s.coordinator.ListActive()) == 0 },
+		time.Second, 10*time.Millisecond, "VM was not offloaded")
+	_, err = invokeGuest(t, qp)
+	require.Error(t, err, "offloaded guest still serves")
+
+	// The next container of the function restores the VM from its snapshot
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "user container creation failed")
+	qp = newQueueProxyRequest("pod2")
+	_, err = s.CreateContainer(ctx, qp)
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	active = s.coordinator.ListActive()
+	require.Len(t, active, 1)
+	require.Equal(t, bootSnapshot, active[0].BootType, "VM was not restored")
+
+	msg, err = invokeGuest(t, qp)
+	require.NoError(t, err, "function invocation failed after restore")
+	require.Equal(t, "Hello, record_response!", msg)
+}
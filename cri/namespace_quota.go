@@ -0,0 +1,199 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultNamespaceQuotaKey is the key of the quota of the namespaces
+// without their own quota in the NamespaceQuotas of the config
+const defaultNamespaceQuotaKey = "*"
+
+// ErrNamespaceQuotaExceeded is returned when creating a user container would
+// bring the active VMs of its namespace above the quota of the namespace
+var ErrNamespaceQuotaExceeded = errors.New("quota of the namespace is exceeded")
+
+// NamespaceQuota bounds the active VMs of a Kubernetes namespace on the node
+type NamespaceQuota struct {
+	// MaxVMs is the number of active VMs, 0 for no limit
+	MaxVMs uint32 `yaml:"maxVMs" json:"maxVMs"`
+	// MaxMemoryMib is the guest memory of the active VMs, 0 for no limit
+	MaxMemoryMib uint64 `yaml:"maxMemoryMib" json:"maxMemoryMib"`
+}
+
+func (q NamespaceQuota) unlimited() bool {
+	return q.MaxVMs == 0 && q.MaxMemoryMib == 0
+}
+
+// NamespaceUsage is the number and the guest memory of the active VMs of a
+// namespace, including the ones being created, with the quota of the namespace
+type NamespaceUsage struct {
+	Namespace string         `json:"namespace"`
+	VMs       uint32         `json:"vms"`
+	MemoryMib uint64         `json:"memoryMib"`
+	Quota     NamespaceQuota `json:"quota"`
+}
+
+// namespaceQuotaError is ErrNamespaceQuotaExceeded with the usage of the
+// namespace, returned to kubelet as ResourceExhausted
+type namespaceQuotaError struct {
+	usage        NamespaceUsage
+	requestedMib uint64
+}
+
+func (e *namespaceQuotaError) Error() string {
+	return fmt.Sprintf("%v: namespace %s has %d VMs and %d MiB active, %d MiB requested, %d VMs and %d MiB allowed",
+		ErrNamespaceQuotaExceeded, e.usage.Namespace, e.usage.VMs, e.usage.MemoryMib, e.requestedMib,
+		e.usage.Quota.MaxVMs, e.usage.Quota.MaxMemoryMib)
+}
+
+func (e *namespaceQuotaError) Is(target error) bool {
+	return target == ErrNamespaceQuotaExceeded
+}
+
+func (e *namespaceQuotaError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// namespaceQuota returns the quota of a namespace, the default one if it has
+// none, and no limit if there is no default one either
+func (c *Config) namespaceQuota(namespace string) NamespaceQuota {
+	if q, ok := c.NamespaceQuotas[namespace]; ok {
+		return q
+	}
+
+	return c.NamespaceQuotas[defaultNamespaceQuotaKey]
+}
+
+// namespaceQuotas tracks the user containers being created, whose VMs
+// count towards the quota of their namespace before they are active
+type namespaceQuotas struct {
+	sync.Mutex
+
+	pending map[string]NamespaceUsage
+}
+
+func newNamespaceQuotas() *namespaceQuotas {
+	return &namespaceQuotas{pending: make(map[string]NamespaceUsage)}
+}
+
+// admitNamespace admits a VM with the given memory in a namespace unless it
+// would exceed the quota of the namespace. The VM counts as being created
+// until the returned function is called, once it is active or failed.
+func (c *coordinator) admitNamespace(namespace string, mib uint32) (release func(), err error) {
+	quota := c.config.get().namespaceQuota(namespace)
+	if quota.unlimited() {
+		return func() {}, nil
+	}
+
+	q := c.quotas
+	q.Lock()
+	defer q.Unlock()
+
+	usage := c.namespaceUsage()[namespace]
+	pending := q.pending[namespace]
+	usage.Namespace = namespace
+	usage.VMs += pending.VMs
+	usage.MemoryMib += pending.MemoryMib
+	usage.Quota = quota
+
+	if (quota.MaxVMs != 0 && usage.VMs+1 > quota.MaxVMs) ||
+		(quota.MaxMemoryMib != 0 && usage.MemoryMib+uint64(mib) > quota.MaxMemoryMib) {
+		return nil, &namespaceQuotaError{usage: usage, requestedMib: uint64(mib)}
+	}
+
+	pending.VMs++
+	pending.MemoryMib += uint64(mib)
+	q.pending[namespace] = pending
+
+	return func() {
+		q.Lock()
+		defer q.Unlock()
+
+		pending := q.pending[namespace]
+		pending.VMs--
+		pending.MemoryMib -= uint64(mib)
+		if pending.VMs == 0 {
+			delete(q.pending, namespace)
+		} else {
+			q.pending[namespace] = pending
+		}
+	}, nil
+}
+
+// namespaceUsage returns the usage of the namespaces by their active VMs
+func (c *coordinator) namespaceUsage() map[string]NamespaceUsage {
+	c.Lock()
+	defer c.Unlock()
+
+	usages := make(map[string]NamespaceUsage)
+	for _, fi := range c.activeInstances {
+		usage := usages[fi.namespace]
+		usage.VMs++
+		usage.MemoryMib += uint64(fi.vmOpts.MemSizeMib)
+		usages[fi.namespace] = usage
+	}
+
+	return usages
+}
+
+// NamespaceUsages returns the usage of the namespaces with active VMs or a
+// quota, sorted by namespace, counting the VMs being created
+func (c *coordinator) NamespaceUsages() []NamespaceUsage {
+	cfg := c.config.get()
+	usages := c.namespaceUsage()
+
+	c.quotas.Lock()
+	for namespace, pending := range c.quotas.pending {
+		usage := usages[namespace]
+		usage.VMs += pending.VMs
+		usage.MemoryMib += pending.MemoryMib
+		usages[namespace] = usage
+	}
+	c.quotas.Unlock()
+
+	for namespace := range cfg.NamespaceQuotas {
+		if _, ok := usages[namespace]; !ok && namespace != defaultNamespaceQuotaKey {
+			usages[namespace] = NamespaceUsage{}
+		}
+	}
+
+	list := make([]NamespaceUsage, 0, len(usages))
+	for namespace, usage := range usages {
+		usage.Namespace = namespace
+		usage.Quota = cfg.namespaceQuota(namespace)
+		list = append(list, usage)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Namespace < list[j].Namespace
+	})
+
+	return list
+}
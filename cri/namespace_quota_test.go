@@ -0,0 +1,222 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	adminpb "github.com/ease-lab/vhive/admin/proto"
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// newNamespacedContainerRequest returns the creation of a user container in a pod of the namespace
+func newNamespacedContainerRequest(podID, image, namespace string) *criapi.CreateContainerRequest {
+	r := newUserContainerRequest(podID, image)
+	r.SandboxConfig = &criapi.PodSandboxConfig{
+		Metadata: &criapi.PodSandboxMetadata{Name: podID, Namespace: namespace},
+	}
+
+	return r
+}
+
+func requireQuotaExceeded(t *testing.T, err error, namespace string) {
+	t.Helper()
+
+	require.Error(t, err, "quota of namespace %s was not enforced", namespace)
+	require.True(t, errors.Is(err, ErrNamespaceQuotaExceeded), "wrong error: %v", err)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "wrong status code")
+	require.Contains(t, err.Error(), "namespace "+namespace, "error does not name the namespace")
+}
+
+func namespaceUsage(c *coordinator, namespace string) NamespaceUsage {
+	for _, usage := range c.NamespaceUsages() {
+		if usage.Namespace == namespace {
+			return usage
+		}
+	}
+
+	return NamespaceUsage{Namespace: namespace}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	cases := []struct {
+		name  string
+		quota NamespaceQuota
+	}{
+		{name: "VMs", quota: NamespaceQuota{MaxVMs: 2}},
+		{name: "Memory", quota: NamespaceQuota{MaxMemoryMib: 2 * defaultMemSizeMib}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+			WithConfig(Config{NamespaceQuotas: map[string]NamespaceQuota{"tenant-a": c.quota}})(s)
+			ctx := context.Background()
+
+			for _, pod := range []string{"pod1", "pod2"} {
+				_, err := s.CreateContainer(ctx, newNamespacedContainerRequest(pod, "img", "tenant-a"))
+				require.NoError(t, err, "container creation within the quota failed")
+			}
+
+			_, err := s.CreateContainer(ctx, newNamespacedContainerRequest("pod3", "img", "tenant-a"))
+			requireQuotaExceeded(t, err, "tenant-a")
+			require.Contains(t, err.Error(), "2 VMs and 512 MiB active")
+
+			// The other namespaces are not limited
+			_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod4", "img", "tenant-b"))
+			require.NoError(t, err, "container creation in another namespace failed")
+
+			usage := namespaceUsage(s.coordinator, "tenant-a")
+			require.EqualValues(t, 2, usage.VMs)
+			require.EqualValues(t, 2*defaultMemSizeMib, usage.MemoryMib)
+			require.Equal(t, c.quota, usage.Quota)
+		})
+	}
+}
+
+func TestNamespaceQuotaDefault(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	WithConfig(Config{NamespaceQuotas: map[string]NamespaceQuota{
+		defaultNamespaceQuotaKey: {MaxVMs: 1},
+		"tenant-a":               {MaxVMs: 2},
+	}})(s)
+	ctx := context.Background()
+
+	_, err := s.CreateContainer(ctx, newNamespacedContainerRequest("pod1", "img", "tenant-b"))
+	require.NoError(t, err, "container creation failed")
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod2", "img", "tenant-b"))
+	requireQuotaExceeded(t, err, "tenant-b")
+
+	for _, pod := range []string{"pod3", "pod4"} {
+		_, err = s.CreateContainer(ctx, newNamespacedContainerRequest(pod, "img", "tenant-a"))
+		require.NoError(t, err, "namespace quota did not override the default one")
+	}
+}
+
+func TestNamespaceQuotaReload(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	ctx := context.Background()
+
+	writeConfig(t, path, "namespaceQuotas:\n  tenant-a: {maxVMs: 1}\n")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload config")
+
+	_, err := s.CreateContainer(ctx, newNamespacedContainerRequest("pod1", "img", "tenant-a"))
+	require.NoError(t, err, "container creation failed")
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod2", "img", "tenant-a"))
+	requireQuotaExceeded(t, err, "tenant-a")
+
+	writeConfig(t, path, "namespaceQuotas:\n  tenant-a: {maxVMs: 2}\n")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload config")
+
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod2", "img", "tenant-a"))
+	require.NoError(t, err, "raised quota was not applied")
+
+	writeConfig(t, path, "")
+	require.NoError(t, s.ReloadConfig(path), "failed to reload config")
+
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod3", "img", "tenant-a"))
+	require.NoError(t, err, "removed quota was still applied")
+}
+
+func TestNamespaceQuotaRemoval(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	WithConfig(Config{NamespaceQuotas: map[string]NamespaceQuota{"tenant-a": {MaxVMs: 1}}})(s)
+	ctx := context.Background()
+
+	_, err := s.CreateContainer(ctx, newNamespacedContainerRequest("pod1", "img", "tenant-a"))
+	require.NoError(t, err, "container creation failed")
+	require.EqualValues(t, 1, namespaceUsage(s.coordinator, "tenant-a").VMs)
+
+	_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: "ctr1"})
+	require.NoError(t, err, "container removal failed")
+	require.Eventually(t, func() bool {
+		return namespaceUsage(s.coordinator, "tenant-a").VMs == 0
+	}, time.Second, 10*time.Millisecond, "removed instance still counts towards the quota")
+
+	// A failed creation does not count towards the quota
+	orch.StartErr = errInjected
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod2", "img", "tenant-a"))
+	require.Error(t, err, "container creation did not fail")
+	require.False(t, errors.Is(err, ErrNamespaceQuotaExceeded), "quota rejected the creation")
+	require.Zero(t, namespaceUsage(s.coordinator, "tenant-a").VMs, "failed creation counts towards the quota")
+	orch.StartErr = nil
+
+	_, err = s.CreateContainer(ctx, newNamespacedContainerRequest("pod2", "img", "tenant-a"))
+	require.NoError(t, err, "quota was not freed by the removal")
+}
+
+func TestAdminListInstancesByNamespace(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	WithConfig(Config{NamespaceQuotas: map[string]NamespaceQuota{
+		"tenant-a": {MaxVMs: 4, MaxMemoryMib: 4096},
+		"tenant-c": {MaxVMs: 1},
+	}})(s)
+	ctx := context.Background()
+
+	for _, r := range []*criapi.CreateContainerRequest{
+		newNamespacedContainerRequest("pod1", "img", "tenant-a"),
+		newNamespacedContainerRequest("pod2", "img", "tenant-a"),
+		newNamespacedContainerRequest("pod3", "img", "tenant-b"),
+	} {
+		_, err := s.CreateContainer(ctx, r)
+		require.NoError(t, err, "container creation failed")
+	}
+
+	client := newAdminClient(t, s)
+
+	resp, err := client.ListInstances(ctx, &adminpb.ListInstancesReq{})
+	require.NoError(t, err, "ListInstances failed")
+	require.Empty(t, resp.Namespaces, "namespaces were listed without being requested")
+	require.Equal(t, "tenant-a", resp.Instances[0].Namespace)
+
+	resp, err = client.ListInstances(ctx, &adminpb.ListInstancesReq{ByNamespace: true})
+	require.NoError(t, err, "ListInstances failed")
+	require.Len(t, resp.Instances, 3)
+
+	var namespaces []string
+	for _, ns := range resp.Namespaces {
+		namespaces = append(namespaces, ns.Namespace)
+	}
+	require.Equal(t, []string{"tenant-a", "tenant-b", "tenant-c"}, namespaces)
+
+	require.EqualValues(t, 2, resp.Namespaces[0].Vms)
+	require.EqualValues(t, 2*defaultMemSizeMib, resp.Namespaces[0].MemSizeMib)
+	require.EqualValues(t, 4, resp.Namespaces[0].MaxVms)
+	require.EqualValues(t, 4096, resp.Namespaces[0].MaxMemSizeMib)
+
+	require.EqualValues(t, 1, resp.Namespaces[1].Vms)
+	require.Zero(t, resp.Namespaces[1].MaxVms, "namespace without a quota is limited")
+
+	require.Zero(t, resp.Namespaces[2].Vms, "namespace without VMs has VMs")
+	require.EqualValues(t, 1, resp.Namespaces[2].MaxVms)
+}
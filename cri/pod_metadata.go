@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"strings"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// defaultMetadataLabels are the pod labels exposed to the guest by default
+var defaultMetadataLabels = []string{
+	"app",
+	"app.kubernetes.io/*",
+	"serving.knative.dev/*",
+}
+
+// podMetadata is the downward-API metadata of a pod, which is served to
+// its VM by MMDS under /vhive/pod
+type podMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	UID         string            `json:"uid"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// mmdsDocument is the MMDS document of a VM
+type mmdsDocument struct {
+	Vhive mmdsVhive `json:"vhive"`
+}
+
+type mmdsVhive struct {
+	Pod *podMetadata `json:"pod"`
+}
+
+// metadataFilter exposes the labels and annotations matching its allow-lists,
+// where an entry ending with "*" matches all keys with the preceding prefix
+type metadataFilter struct {
+	labels      []string
+	annotations []string
+}
+
+// podMetadata returns the metadata of the sandbox with
+// the labels and annotations outside of the allow-lists removed
+func (f *metadataFilter) podMetadata(config *criapi.PodSandboxConfig) *podMetadata {
+	return &podMetadata{
+		Name:        config.GetMetadata().GetName(),
+		Namespace:   config.GetMetadata().GetNamespace(),
+		UID:         config.GetMetadata().GetUid(),
+		Labels:      filterKeys(config.GetLabels(), f.labels),
+		Annotations: filterKeys(config.GetAnnotations(), f.annotations),
+	}
+}
+
+func filterKeys(m map[string]string, allowed []string) map[string]string {
+	filtered := make(map[string]string)
+
+	for k, v := range m {
+		for _, pattern := range allowed {
+			if pattern == k || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(k, strings.TrimSuffix(pattern, "*"))) {
+				filtered[k] = v
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+func (s *Service) insertPodMetadata(podID string, md *podMetadata) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.podMetadata[podID] = md
+}
+
+func (s *Service) removePodMetadata(podID string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.podMetadata, podID)
+}
+
+// getPodMetadata returns the metadata captured when the sandbox was created,
+// falling back to the sandbox config of the request, e.g., after a restart
+func (s *Service) getPodMetadata(r *criapi.CreateContainerRequest) *podMetadata {
+	s.Lock()
+	md, ok := s.podMetadata[r.GetPodSandboxId()]
+	s.Unlock()
+
+	if ok {
+		return md
+	}
+
+	return s.metadataFilter.podMetadata(r.GetSandboxConfig())
+}
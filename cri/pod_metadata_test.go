@@ -0,0 +1,116 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newPodSandboxConfig() *criapi.PodSandboxConfig {
+	return &criapi.PodSandboxConfig{
+		Metadata: &criapi.PodSandboxMetadata{Name: "helloworld-00001-deployment-abc", Namespace: "default", Uid: "pod-uid"},
+		Labels: map[string]string{
+			"app":                          "helloworld",
+			"serving.knative.dev/revision": "helloworld-00001",
+			"pod-template-hash":            "abc",
+		},
+		Annotations: map[string]string{
+			"autoscaling.knative.dev/target": "10",
+			"secret.example.com/token":       "sensitive",
+		},
+	}
+}
+
+// mmdsPod returns the /vhive/pod document as seen by the guest
+func mmdsPod(t *testing.T, metadata interface{}) map[string]interface{} {
+	data, err := json.Marshal(metadata)
+	require.NoError(t, err, "failed to serialize MMDS document")
+
+	var doc map[string]map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &doc), "MMDS document has a wrong structure: %s", data)
+
+	pod, ok := doc["vhive"]["pod"]
+	require.True(t, ok, "MMDS document has no /vhive/pod: %s", data)
+
+	return pod
+}
+
+func TestPodMetadataMMDS(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.metadataFilter = &metadataFilter{
+		labels:      []string{"app", "serving.knative.dev/*"},
+		annotations: []string{"autoscaling.knative.dev/target"},
+	}
+
+	sandbox, err := s.RunPodSandbox(context.Background(), &criapi.RunPodSandboxRequest{Config: newPodSandboxConfig()})
+	require.NoError(t, err, "failed to run pod sandbox")
+
+	r := newUserContainerRequest(sandbox.GetPodSandboxId(), "img")
+	_, err = s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	pod := mmdsPod(t, orch.StartOpts["1"].Metadata)
+	require.Equal(t, map[string]interface{}{
+		"name":      "helloworld-00001-deployment-abc",
+		"namespace": "default",
+		"uid":       "pod-uid",
+		"labels": map[string]interface{}{
+			"app":                          "helloworld",
+			"serving.knative.dev/revision": "helloworld-00001",
+		},
+		"annotations": map[string]interface{}{
+			"autoscaling.knative.dev/target": "10",
+		},
+	}, pod)
+
+	_, err = s.RemovePodSandbox(context.Background(), &criapi.RemovePodSandboxRequest{PodSandboxId: sandbox.GetPodSandboxId()})
+	require.NoError(t, err, "failed to remove pod sandbox")
+	require.Empty(t, s.podMetadata, "pod metadata was leaked")
+}
+
+func TestPodMetadataFallback(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	// The sandbox was created before vHive restarted
+	r := newUserContainerRequest("pod", "img")
+	r.SandboxConfig = newPodSandboxConfig()
+
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	pod := mmdsPod(t, orch.StartOpts["1"].Metadata)
+	require.Equal(t, "helloworld-00001-deployment-abc", pod["name"])
+	require.Equal(t, map[string]interface{}{
+		"app":                          "helloworld",
+		"serving.knative.dev/revision": "helloworld-00001",
+	}, pod["labels"], "default label allow-list is not applied")
+	require.Empty(t, pod["annotations"], "annotations are exposed by default")
+}
@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// RunPodSandbox creates and starts a pod-level sandbox. Runtimes must ensure
+// the sandbox is in the ready state on success.
+func (s *Service) RunPodSandbox(ctx context.Context, r *criapi.RunPodSandboxRequest) (*criapi.RunPodSandboxResponse, error) {
+	criLog.Debugf("RunPodsandbox for %+v", r.GetConfig().GetMetadata())
+
+	if err := s.setRuntimeHandler(r); err != nil {
+		criLog.WithError(err).Error("failed to select the sandbox of the pod")
+		return nil, err
+	}
+
+	resp, err := s.stockRuntimeClient.RunPodSandbox(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.insertPodMetadata(resp.GetPodSandboxId(), s.metadataFilter.podMetadata(r.GetConfig()))
+
+	return resp, nil
+}
+
+// StopPodSandbox stops any running process that is part of the sandbox and
+// reclaims network resources (e.g., IP addresses) allocated to the sandbox.
+// The VMs of its user containers are stopped along with their resources, and
+// the ones still starting are not booted. The other containers of the sandbox
+// are stopped by the stock runtime.
+func (s *Service) StopPodSandbox(ctx context.Context, r *criapi.StopPodSandboxRequest) (*criapi.StopPodSandboxResponse, error) {
+	criLog.Debugf("StopPodSandbox for %q", r.GetPodSandboxId())
+
+	if n := s.creates.cancelPod(r.GetPodSandboxId()); n > 0 {
+		criLog.WithField("sandboxID", r.GetPodSandboxId()).Infof("cancelled the creation of %d containers of the stopped pod", n)
+	}
+	s.removeSandboxVMs(r.GetPodSandboxId())
+
+	return s.stockRuntimeClient.StopPodSandbox(ctx, r)
+}
+
+// RemovePodSandbox removes the sandbox. If there are any running containers
+// in the sandbox, they must be forcibly terminated and removed.
+func (s *Service) RemovePodSandbox(ctx context.Context, r *criapi.RemovePodSandboxRequest) (*criapi.RemovePodSandboxResponse, error) {
+	criLog.Debugf("RemovePodSandbox for %q", r.GetPodSandboxId())
+
+	s.creates.cancelPod(r.GetPodSandboxId())
+	s.removeSandboxVMs(r.GetPodSandboxId())
+
+	resp, err := s.stockRuntimeClient.RemovePodSandbox(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.removePodMetadata(r.GetPodSandboxId())
+
+	return resp, nil
+}
+
+// removeSandboxVMs removes the VMs of the user containers of the sandbox like
+// RemoveContainer does, as kubelet may stop and remove a sandbox without
+// removing its containers first, e.g., on the forced deletion of its pod.
+// The VMs removed already are skipped, so that it can be called again.
+func (s *Service) removeSandboxVMs(sandboxID string) {
+	ctx := withAuditActor(context.Background(), AuditActorCRI)
+
+	for _, containerID := range s.coordinator.sandboxContainers(sandboxID) {
+		criLog.WithFields(log.Fields{"sandboxID": sandboxID, "containerID": containerID}).
+			Info("removing the VM of a container of the sandbox")
+
+		s.creates.forget(containerID)
+		if err := s.coordinator.removeVM(ctx, containerID); err != nil {
+			criLog.WithError(err).Error("failed to stop microVM")
+		}
+
+		if s.microVMs != nil {
+			s.microVMs.Release(containerID)
+		}
+	}
+
+	s.removePodVMConfig(sandboxID)
+}
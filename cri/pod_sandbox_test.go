@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestRemovePodSandboxWithLiveVM(t *testing.T) {
+	ctx := context.Background()
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+	_, err = s.CreateContainer(ctx, newUserContainerRequest("other-pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	// The sandbox is removed on a forced deletion without removing its containers
+	for i := 0; i < 2; i++ {
+		_, err = s.RemovePodSandbox(ctx, &criapi.RemovePodSandboxRequest{PodSandboxId: "pod"})
+		require.NoError(t, err, "sandbox removal failed")
+	}
+
+	orch.Lock()
+	require.Equal(t, map[string]int{"1": 1}, orch.Stopped, "VM of the sandbox was not stopped once")
+	orch.Unlock()
+
+	active := s.coordinator.ListActive()
+	require.Len(t, active, 1, "VM of the sandbox is still active")
+	require.Equal(t, "ctr2", active[0].ContainerID, "VM of another sandbox was removed")
+	require.Empty(t, s.coordinator.sandboxContainers("pod"), "VM of the sandbox is still active")
+
+	_, err = lookupPodVMConfig(s, "pod")
+	require.Error(t, err, "VM config of the sandbox was not dropped")
+	_, err = lookupPodVMConfig(s, "other-pod")
+	require.NoError(t, err, "VM config of another sandbox was dropped")
+
+	// kubelet removing the container afterwards is a no-op
+	_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: "ctr1"})
+	require.NoError(t, err, "container removal failed")
+}
+
+func TestStopPodSandboxWithLiveVM(t *testing.T) {
+	ctx := context.Background()
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, err = s.StopPodSandbox(ctx, &criapi.StopPodSandboxRequest{PodSandboxId: "pod"})
+	require.NoError(t, err, "sandbox stop failed")
+	_, err = s.StopPodSandbox(ctx, &criapi.StopPodSandboxRequest{PodSandboxId: "pod"})
+	require.NoError(t, err, "second sandbox stop failed")
+	_, err = s.RemovePodSandbox(ctx, &criapi.RemovePodSandboxRequest{PodSandboxId: "pod"})
+	require.NoError(t, err, "sandbox removal failed")
+
+	orch.Lock()
+	require.Equal(t, map[string]int{"1": 1}, orch.Stopped, "VM of the sandbox was not stopped once")
+	orch.Unlock()
+	require.Empty(t, s.coordinator.ListActive(), "VM of the sandbox is still active")
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of the VM was leaked")
+}
+
+func TestStopPodSandboxWithPlainContainer(t *testing.T) {
+	ctx := context.Background()
+	orch := fakes.NewOrchestrator()
+	stock := &fakes.StockRuntimeClient{}
+	s := newTestService(stock, orch)
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "user container creation failed")
+	qp, err := s.CreateContainer(ctx, newQueueProxyRequest("pod"))
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	_, err = s.StopPodSandbox(ctx, &criapi.StopPodSandboxRequest{PodSandboxId: "pod"})
+	require.NoError(t, err, "sandbox stop failed")
+
+	orch.Lock()
+	require.Equal(t, map[string]int{"1": 1}, orch.Stopped, "VM of the sandbox was not stopped")
+	orch.Unlock()
+	require.Empty(t, s.coordinator.ListActive(), "VM of the sandbox is still active")
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of the VM was leaked")
+	_, err = lookupPodVMConfig(s, "pod")
+	require.Error(t, err, "VM config of the sandbox was not dropped")
+
+	// The plain container is stopped by the stock runtime with its sandbox
+	stock.Lock()
+	defer stock.Unlock()
+	require.Equal(t, []string{"pod"}, stock.StoppedPods, "sandbox stop was not forwarded")
+	require.NotContains(t, stock.Removed, qp.ContainerId, "plain container was removed")
+}
+
+func TestRemovePodSandboxWithoutVMs(t *testing.T) {
+	ctx := context.Background()
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	_, err = s.StopPodSandbox(ctx, &criapi.StopPodSandboxRequest{PodSandboxId: "empty-pod"})
+	require.NoError(t, err, "sandbox stop failed")
+	_, err = s.RemovePodSandbox(ctx, &criapi.RemovePodSandboxRequest{PodSandboxId: "empty-pod"})
+	require.NoError(t, err, "sandbox removal failed")
+
+	orch.Lock()
+	require.Empty(t, orch.Stopped, "a VM was stopped")
+	orch.Unlock()
+	require.Len(t, s.coordinator.ListActive(), 1, "VM of another sandbox was removed")
+}
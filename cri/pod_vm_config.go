@@ -0,0 +1,191 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultPodVMConfigTTL leaves time for pulling the queue-proxy image
+	defaultPodVMConfigTTL = 10 * time.Minute
+	// maxPodVMConfigSweepInterval bounds how late a stale VM config is evicted
+	maxPodVMConfigSweepInterval = time.Minute
+)
+
+// podVMSignal is closed when the creation of the user container of a pod
+// completes, so that a queue-proxy created first can wait for its VM
+type podVMSignal struct {
+	done chan struct{}
+	// err is why the user container was not created, set before done is closed
+	err     error
+	created time.Time
+}
+
+func newPodVMSignal(now time.Time) *podVMSignal {
+	return &podVMSignal{done: make(chan struct{}), created: now}
+}
+
+func (sig *podVMSignal) fired() bool {
+	select {
+	case <-sig.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// podVMSignalLocked returns the signal of the pod, creating it if needed,
+// with the lock of the service held
+func (s *Service) podVMSignalLocked(podID string) *podVMSignal {
+	sig, ok := s.podVMSignals[podID]
+	if !ok {
+		sig = newPodVMSignal(s.now())
+		s.podVMSignals[podID] = sig
+	}
+
+	return sig
+}
+
+// signalPodVMLocked wakes the queue-proxy waiting for the VM of the pod, with
+// the lock of the service held. A signal already fired by a previous attempt
+// at creating the user container is replaced, so that its outcome is not reused
+func (s *Service) signalPodVMLocked(podID string, err error) {
+	sig := s.podVMSignalLocked(podID)
+	if sig.fired() {
+		sig = newPodVMSignal(s.now())
+		s.podVMSignals[podID] = sig
+	}
+
+	sig.err = err
+	close(sig.done)
+}
+
+// waitPodVMSignal waits up to the timeout for the VM config of the pod,
+// returning early with the error of a failed creation of its user container.
+// A timeout that is not positive waits up to the VMConfigWaitTimeout of the config.
+func (s *Service) waitPodVMSignal(ctx context.Context, podID string, timeout time.Duration) (*VMConfig, error) {
+	if timeout <= 0 {
+		timeout = s.coordinator.config.get().VMConfigWaitTimeout
+	}
+
+	s.Lock()
+	if vmConfig, ok := s.podVMConfigs[podID]; ok {
+		s.Unlock()
+		return vmConfig, nil
+	}
+	sig := s.podVMSignalLocked(podID)
+	s.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-sig.done:
+	case <-timer.C:
+		return nil, errors.Errorf("timed out after %s waiting for the VM of pod %s", timeout, podID)
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "cancelled waiting for the VM of pod %s", podID)
+	}
+
+	if sig.err != nil {
+		return nil, sig.err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	vmConfig, ok := s.podVMConfigs[podID]
+	if !ok {
+		return nil, errors.Errorf("VM config for pod %s does not exist", podID)
+	}
+
+	return vmConfig, nil
+}
+
+// startPodVMConfigSweeper periodically evicts the VM configs of the pods
+// whose queue-proxy was not created within the TTL
+func (s *Service) startPodVMConfigSweeper() {
+	interval := s.podVMConfigTTL / 2
+	if interval > maxPodVMConfigSweepInterval {
+		interval = maxPodVMConfigSweepInterval
+	}
+
+	s.runPeriodically(interval, s.sweepPodVMConfigs)
+}
+
+// sweepPodVMConfigs evicts the VM configs older than the TTL, which were left
+// behind by pods aborted before their queue-proxy was created, and stops their VMs
+func (s *Service) sweepPodVMConfigs() {
+	now := s.now()
+	stale := make(map[string]*VMConfig)
+
+	s.Lock()
+	for podID, vmConfig := range s.podVMConfigs {
+		if now.Sub(vmConfig.created) > s.podVMConfigTTL {
+			stale[podID] = vmConfig
+			delete(s.podVMConfigs, podID)
+			delete(s.podVMSignals, podID)
+		}
+	}
+	// The signals of the pods whose user container failed or was never created
+	for podID, sig := range s.podVMSignals {
+		if _, ok := s.podVMConfigs[podID]; !ok && now.Sub(sig.created) > s.podVMConfigTTL {
+			delete(s.podVMSignals, podID)
+		}
+	}
+	s.Unlock()
+
+	for podID, vmConfig := range stale {
+		logger := coordLog.WithFields(log.Fields{
+			"podID":       podID,
+			"containerID": vmConfig.containerID,
+			"guest":       vmConfig.String(),
+			"age":         now.Sub(vmConfig.created),
+		})
+		logger.Warn("evicting VM config of a pod whose queue-proxy was never created")
+
+		s.stopPodVM(logger, vmConfig.containerID)
+	}
+}
+
+// stopPodVM stops the VM of the user container of an evicted or replaced
+// VM config, doing nothing if the user container was never created
+func (s *Service) stopPodVM(logger *log.Entry, containerID string) {
+	if containerID == "" {
+		return
+	}
+
+	if err := s.coordinator.stopVM(context.Background(), containerID); err != nil {
+		logger.WithError(err).Error("failed to stop the VM of the VM config")
+		return
+	}
+
+	if s.microVMs != nil {
+		s.microVMs.Release(containerID)
+	}
+}
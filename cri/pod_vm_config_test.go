@@ -0,0 +1,244 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepPodVMConfigs(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.podVMConfigTTL = time.Minute
+
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	// The queue-proxy of pod1 is never created
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	now = now.Add(30 * time.Second)
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	now = now.Add(31 * time.Second)
+	s.sweepPodVMConfigs()
+
+	_, err = lookupPodVMConfig(s, "pod1")
+	require.Error(t, err, "stale VM config was not evicted")
+	require.False(t, s.coordinator.isActive("ctr1"), "VM of the stale VM config is active")
+	require.Equal(t, 1, orch.NumStopped("1"), "VM of the stale VM config was not stopped")
+
+	_, err = lookupPodVMConfig(s, "pod2")
+	require.NoError(t, err, "fresh VM config was evicted")
+	require.True(t, s.coordinator.isActive("ctr2"), "VM of the fresh VM config was stopped")
+	require.Zero(t, orch.NumStopped("2"), "VM of the fresh VM config was stopped")
+
+	// The queue-proxy of pod2 consumes its VM config, which is not swept anymore
+	_, err = s.CreateContainer(context.Background(), newQueueProxyRequest("pod2"))
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	now = now.Add(time.Hour)
+	s.sweepPodVMConfigs()
+	require.True(t, s.coordinator.isActive("ctr2"), "VM attached to a queue-proxy was stopped")
+}
+
+func TestInsertPodVMConfigDuplicate(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	// A retry of the creation of the user container boots a second VM for the pod
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Metadata.Attempt = 1
+	_, err = s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	require.False(t, s.coordinator.isActive("ctr1"), "VM of the replaced VM config is active")
+	require.Equal(t, 1, orch.NumStopped("1"), "VM of the replaced VM config was not stopped")
+	require.True(t, s.coordinator.isActive("ctr2"), "VM of the new VM config was stopped")
+
+	vmConfig, err := lookupPodVMConfig(s, "pod")
+	require.NoError(t, err, "VM config was not stored")
+	require.Equal(t, "ctr2", vmConfig.containerID)
+	require.Equal(t, "190.128.0.2", vmConfig.guestIP)
+
+	// A config whose user container was not created yet has no VM to stop
+	require.NoError(t, s.insertPodVMConfig("pod2", &VMConfig{guestIP: "190.128.0.7", guestPort: defaultGuestPort}))
+	require.NoError(t, s.insertPodVMConfig("pod2", &VMConfig{guestIP: "190.128.0.8", guestPort: defaultGuestPort}))
+	require.True(t, s.coordinator.isActive("ctr2"), "unrelated VM was stopped")
+}
+
+func TestPodVMConfigSweeperShutdown(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	s.podVMConfigTTL = 10 * time.Millisecond
+	require.NoError(t, s.insertPodVMConfig("pod", &VMConfig{guestIP: "190.128.0.7", guestPort: defaultGuestPort}))
+
+	s.startPodVMConfigSweeper()
+
+	require.Eventually(t, func() bool {
+		_, err := lookupPodVMConfig(s, "pod")
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond, "stale VM config was not evicted")
+
+	s.Shutdown()
+}
+
+func TestQueueProxyOrdering(t *testing.T) {
+	t.Run("UserContainerFirst", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "user container creation failed")
+
+		r := newQueueProxyRequest("pod")
+		_, err = s.CreateContainer(context.Background(), r)
+		require.NoError(t, err, "queue-proxy creation failed")
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.1", addr, "guest address was not set")
+		require.Empty(t, s.podVMSignals, "signal of the pod was leaked")
+	})
+
+	t.Run("QueueProxyFirst", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		r := newQueueProxyRequest("pod")
+		qpErr := make(chan error, 1)
+		go func() {
+			_, err := s.CreateContainer(context.Background(), r)
+			qpErr <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			s.Lock()
+			defer s.Unlock()
+			return s.podVMSignals["pod"] != nil
+		}, 5*time.Second, 10*time.Millisecond, "queue-proxy is not waiting for the VM")
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "user container creation failed")
+
+		require.NoError(t, <-qpErr, "queue-proxy creation failed")
+
+		addr, _ := getEnv(r, guestIPEnv)
+		require.Equal(t, "190.128.0.1", addr, "queue-proxy did not wait for the VM")
+		require.Empty(t, s.podVMSignals, "signal of the pod was leaked")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+		cfg := DefaultConfig()
+		cfg.VMConfigWaitTimeout = 50 * time.Millisecond
+		s.coordinator.config.set(cfg)
+
+		_, err := s.CreateContainer(context.Background(), newQueueProxyRequest("pod"))
+		require.Error(t, err, "queue-proxy was created without a VM")
+		require.Contains(t, err.Error(), "timed out", "error does not tell the wait timed out")
+	})
+}
+
+func TestQueueProxyNotWokenBeforeRegistration(t *testing.T) {
+	// The VM boots, but the creation fails once its container is created
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	withPostBootHook(s, &fakeHooks{}, true)
+	s.coordinator.runHook = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, errors.New("hook failed")
+	}
+
+	qpErr := make(chan error, 1)
+	go func() {
+		_, err := s.CreateContainer(context.Background(), newQueueProxyRequest("pod"))
+		qpErr <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		s.Lock()
+		defer s.Unlock()
+		return s.podVMSignals["pod"] != nil
+	}, 5*time.Second, 10*time.Millisecond, "queue-proxy is not waiting for the VM")
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.Error(t, err, "user container creation did not fail")
+
+	select {
+	case err := <-qpErr:
+		require.Error(t, err, "queue-proxy was bound to the released VM")
+		require.Contains(t, err.Error(), "hook failed", "error does not carry the failure")
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue-proxy was not woken by the failure")
+	}
+}
+
+func TestQueueProxyWokenByFailure(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.StartErr = errors.New("boot failed")
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	qpErr := make(chan error, 1)
+	go func() {
+		_, err := s.CreateContainer(context.Background(), newQueueProxyRequest("pod"))
+		qpErr <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		s.Lock()
+		defer s.Unlock()
+		return s.podVMSignals["pod"] != nil
+	}, 5*time.Second, 10*time.Millisecond, "queue-proxy is not waiting for the VM")
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.Error(t, err, "user container creation did not fail")
+
+	select {
+	case err := <-qpErr:
+		require.Error(t, err, "queue-proxy was created without a VM")
+		require.Contains(t, err.Error(), "VM of pod pod failed to start", "error does not tell why the VM is missing")
+		require.Contains(t, err.Error(), "boot failed", "error does not carry the failure")
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue-proxy was not woken by the failure")
+	}
+
+	// A retry of the user container is not failed by the previous attempt
+	orch.StartErr = nil
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "retried user container creation failed")
+
+	vmConfig, err := s.getPodVMConfig(context.Background(), "pod")
+	require.NoError(t, err, "VM config of the retry was not found")
+	require.NotEmpty(t, vmConfig.guestIP, "VM config has no guest IP")
+
+	s.removePodVMConfig("pod")
+	s.removePodVMConfig("pod")
+	require.Empty(t, s.podVMSignals, "signal of the pod was not removed")
+}
@@ -0,0 +1,142 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ease-lab/vhive/logging"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// PostBootHook is a command that vHive runs on the host once the VM of a user
+// container is attached to it, e.g., to register the VM in a service mesh
+type PostBootHook struct {
+	// Command is the command and its arguments, not run through a shell,
+	// each a text/template of PostBootHookVars, e.g., {{.GuestIP}}.
+	// There is no hook if it is empty.
+	Command []string `yaml:"command"`
+	// Timeout bounds the hook
+	Timeout time.Duration `yaml:"timeout"`
+	// Fatal fails the creation of the user container if the hook fails,
+	// whose failures are only logged otherwise
+	Fatal bool `yaml:"fatal"`
+}
+
+// PostBootHookVars are the variables substituted in the command of the post-boot hook
+type PostBootHookVars struct {
+	ContainerID string
+	GuestIP     string
+	Revision    string
+}
+
+// args returns the command of the hook with the variables substituted
+func (h PostBootHook) args(vars PostBootHookVars) ([]string, error) {
+	args := make([]string, 0, len(h.Command))
+
+	for _, arg := range h.Command {
+		tmpl, err := template.New("postBootHook").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid argument %q", arg)
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return nil, errors.Wrapf(err, "invalid argument %q", arg)
+		}
+		args = append(args, b.String())
+	}
+
+	return args, nil
+}
+
+// validate checks that the command of the hook only uses PostBootHookVars
+func (h PostBootHook) validate() error {
+	if len(h.Command) == 0 {
+		return nil
+	}
+	if h.Command[0] == "" {
+		return errors.New("the command is empty")
+	}
+
+	_, err := h.args(PostBootHookVars{})
+	return err
+}
+
+// runCommand runs a command, returning its combined output
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// runPostBootHook runs the post-boot hook of the configuration for the VM of a
+// user container, returning its failure only if the hook is fatal
+func (c *coordinator) runPostBootHook(ctx context.Context, vars PostBootHookVars) error {
+	hook := c.config.get().PostBootHook
+	if len(hook.Command) == 0 {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{
+		"hook":        hook.Command[0],
+		"containerID": vars.ContainerID,
+	})
+
+	err := c.execPostBootHook(ctx, hook, vars)
+	switch {
+	case err == nil:
+		logger.Debug("ran the post-boot hook")
+		return nil
+	case hook.Fatal:
+		logger.WithError(err).Error("post-boot hook failed")
+		return err
+	default:
+		logger.WithError(err).Warn("post-boot hook failed, creating the container anyway")
+		return nil
+	}
+}
+
+func (c *coordinator) execPostBootHook(ctx context.Context, hook PostBootHook, vars PostBootHookVars) error {
+	args, err := hook.args(vars)
+	if err != nil {
+		return errors.Wrap(err, "failed to substitute the post-boot hook")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	out, err := c.runHook(ctx, args[0], args[1:]...)
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return errors.Wrapf(err, "post-boot hook %s failed: %s", args[0], out)
+		}
+		return errors.Wrapf(err, "post-boot hook %s failed", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeHooks records the post-boot hooks run by a coordinator
+type fakeHooks struct {
+	sync.Mutex
+	runs [][]string
+	err  error
+}
+
+func (h *fakeHooks) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.runs = append(h.runs, append([]string{name}, args...))
+	if h.err != nil {
+		return []byte("mesh unreachable\n"), h.err
+	}
+
+	return nil, nil
+}
+
+func withPostBootHook(s *Service, h *fakeHooks, fatal bool) {
+	cfg := s.Config()
+	cfg.PostBootHook = PostBootHook{
+		Command: []string{"/usr/bin/register", "--container={{.ContainerID}}", "{{.GuestIP}}", "{{.Revision}}"},
+		Timeout: time.Second,
+		Fatal:   fatal,
+	}
+	s.coordinator.config.set(cfg)
+	s.coordinator.runHook = h.run
+}
+
+func TestPostBootHook(t *testing.T) {
+	h := &fakeHooks{}
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	withPostBootHook(s, h, true)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	require.Equal(t, [][]string{
+		{"/usr/bin/register", "--container=" + resp.ContainerId, "190.128.0.1", "img-00001"},
+	}, h.runs, "hook did not run with the VM of the container")
+}
+
+func TestPostBootHookFailure(t *testing.T) {
+	t.Run("NonFatal", func(t *testing.T) {
+		h := &fakeHooks{err: errors.New("exit status 1")}
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+		withPostBootHook(s, h, false)
+
+		resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "non-fatal hook failure aborted the creation")
+		require.Len(t, h.runs, 1)
+		require.True(t, s.coordinator.isActive(resp.ContainerId), "VM of the container is not active")
+	})
+
+	t.Run("Fatal", func(t *testing.T) {
+		h := &fakeHooks{err: errors.New("exit status 1")}
+		orch := fakes.NewOrchestrator()
+		stock := &fakes.StockRuntimeClient{}
+		s := newTestService(stock, orch)
+		withPostBootHook(s, h, true)
+
+		_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+		require.Equal(t, codes.Internal, status.Code(err), "unexpected error: %v", err)
+		require.Contains(t, err.Error(), "mesh unreachable", "output of the hook was not reported")
+		require.Len(t, h.runs, 1)
+		requireNoLeaks(t, s, orch, stock)
+	})
+}
+
+func TestPostBootHookDisabled(t *testing.T) {
+	h := &fakeHooks{}
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+	s.coordinator.runHook = h.run
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Empty(t, h.runs, "hook ran without a command")
+}
+
+func TestPostBootHookCommand(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	cfg := s.Config()
+	cfg.PostBootHook = PostBootHook{Command: []string{"false"}, Timeout: time.Second, Fatal: true}
+	s.coordinator.config.set(cfg)
+
+	err := s.coordinator.runPostBootHook(context.Background(), PostBootHookVars{ContainerID: "ctr1"})
+	require.Error(t, err, "failing command was not reported")
+
+	cfg.PostBootHook.Command = []string{"true", "{{.GuestIP}}"}
+	s.coordinator.config.set(cfg)
+	require.NoError(t, s.coordinator.runPostBootHook(context.Background(), PostBootHookVars{ContainerID: "ctr1"}))
+}
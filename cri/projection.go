@@ -0,0 +1,289 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/pkg/errors"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// maxProjectionSize is the limit on the size of the projected files
+	maxProjectionSize = 16 * 1024 * 1024
+	projectionImage   = "projection.ext4"
+	projectionStaging = "staging"
+	// projectionOverhead covers the ext4 metadata of the projection image
+	projectionOverhead = 4 * 1024 * 1024
+	projectionBlock    = 4096
+)
+
+// projectedVolumes are the kubelet volume types that are projected into the VM
+var projectedVolumes = []string{
+	"/volumes/kubernetes.io~secret/",
+	"/volumes/kubernetes.io~configmap/",
+	"/volumes/kubernetes.io~projected/",
+	"/volumes/kubernetes.io~downward-api/",
+}
+
+// projection is a read-only ext4 image with the contents of the secrets
+// and config maps mounted into a user container, which is attached to the VM
+// since the volumes of the placeholder container never reach the VM
+type projection struct {
+	dir    string
+	image  string
+	mounts []ctriface.ProjectedMount
+}
+
+// newProjection packages the projected volumes among the mounts into an image
+// in a new directory under rootDir. Returns nil if there is nothing to project.
+func newProjection(rootDir string, mounts []*criapi.Mount) (_ *projection, retErr error) {
+	var projected []*criapi.Mount
+	for _, m := range mounts {
+		if isProjectedVolume(m.GetHostPath()) {
+			projected = append(projected, m)
+		}
+	}
+
+	if len(projected) == 0 {
+		return nil, nil
+	}
+
+	dir, err := ioutil.TempDir(rootDir, "vhive-projection-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create projection directory")
+	}
+
+	p := &projection{
+		dir:   dir,
+		image: filepath.Join(dir, projectionImage),
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := p.remove(); err != nil {
+				coordLog.WithError(err).Error("failed to remove projection after failure")
+			}
+		}
+	}()
+
+	staging := filepath.Join(dir, projectionStaging)
+	stats := &copyStats{}
+
+	for i, m := range projected {
+		source := strconv.Itoa(i)
+		if err := copyTree(m.GetHostPath(), filepath.Join(staging, source), stats); err != nil {
+			return nil, errors.Wrapf(err, "failed to copy %s", m.GetHostPath())
+		}
+
+		p.mounts = append(p.mounts, ctriface.ProjectedMount{
+			Source:        source,
+			ContainerPath: m.GetContainerPath(),
+		})
+	}
+
+	if err := makeExt4Image(p.image, staging, stats); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(staging); err != nil {
+		return nil, errors.Wrap(err, "failed to remove projection staging directory")
+	}
+
+	return p, nil
+}
+
+// vmOption returns the option to attach the projection to a VM
+func (p *projection) vmOption() ctriface.StartVMOption {
+	return ctriface.WithProjection(p.image, p.mounts)
+}
+
+// remove deletes the projection image, which is a no-op for a nil projection
+func (p *projection) remove() error {
+	if p == nil {
+		return nil
+	}
+
+	return os.RemoveAll(p.dir)
+}
+
+func isProjectedVolume(hostPath string) bool {
+	for _, v := range projectedVolumes {
+		if strings.Contains(hostPath, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type copyStats struct {
+	bytes   int64
+	entries int64
+}
+
+// copyTree copies src to dst preserving modes, ownership and symlinks,
+// failing if the copied files exceed maxProjectionSize
+func copyTree(src, dst string, stats *copyStats) error {
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			// Directories are made read-only after their contents are copied
+			dirs = append(dirs, dirMode{path: target, mode: mode.Perm()})
+		case mode.IsRegular():
+			stats.bytes += info.Size()
+			if stats.bytes > maxProjectionSize {
+				return errors.Errorf("projected files exceed %d bytes", maxProjectionSize)
+			}
+			if err := copyFile(path, target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			coordLog.Debugf("skipping projection of %s with mode %s", path, mode)
+			return nil
+		}
+
+		stats.entries++
+		chown(target, info)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+
+	// The mode given to OpenFile is subject to umask
+	if err := out.Chmod(perm); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// chown copies the ownership of the source file, which only succeeds as root
+func chown(target string, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	if err := os.Lchown(target, int(st.Uid), int(st.Gid)); err != nil {
+		coordLog.WithError(err).Debugf("failed to preserve ownership of %s", target)
+	}
+}
+
+// makeExt4Image creates an ext4 image populated with the contents of dir
+func makeExt4Image(image, dir string, stats *copyStats) error {
+	// Every entry takes at least a block
+	size := stats.bytes + (stats.entries+1)*projectionBlock + projectionOverhead
+	size = (size + projectionOverhead - 1) / projectionOverhead * projectionOverhead
+
+	f, err := os.Create(image)
+	if err != nil {
+		return errors.Wrap(err, "failed to create projection image")
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to size projection image")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to create projection image")
+	}
+
+	out, err := exec.Command("mkfs.ext4",
+		"-q", "-F",
+		"-b", strconv.Itoa(projectionBlock),
+		"-N", strconv.FormatInt(stats.entries+16, 10),
+		"-m", "0",
+		"-O", "^has_journal",
+		"-d", dir,
+		image,
+	).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to create projection image: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
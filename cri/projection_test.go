@@ -0,0 +1,186 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func requireExt4Tools(t *testing.T) {
+	for _, tool := range []string{"mkfs.ext4", "debugfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+}
+
+// createSecretVolume creates a kubelet-like secret volume on the host
+func createSecretVolume(t *testing.T, root string) string {
+	vol := filepath.Join(root, "pods", "uid", "volumes", "kubernetes.io~secret", "creds")
+	require.NoError(t, os.MkdirAll(filepath.Join(vol, "nested"), 0755))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(vol, "password"), []byte("hunter2"), 0400))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(vol, "config"), []byte("key=value"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(vol, "nested", "token"), []byte("abc"), 0600))
+	require.NoError(t, os.Symlink("password", filepath.Join(vol, "link")))
+	require.NoError(t, os.Chmod(filepath.Join(vol, "nested"), 0750))
+
+	return vol
+}
+
+// debugfs runs a debugfs request against the image
+func debugfs(t *testing.T, image, request string) string {
+	out, err := exec.Command("debugfs", "-R", request, image).Output()
+	require.NoError(t, err, "debugfs failed")
+
+	return string(out)
+}
+
+// imageModes returns the permission bits of the entries in a directory of the image
+func imageModes(t *testing.T, image, dir string) map[string]os.FileMode {
+	modes := make(map[string]os.FileMode)
+
+	for _, line := range strings.Split(debugfs(t, image, "ls -l "+dir), "\n") {
+		// <inode> <mode> (<type>) <uid> <gid> <size> <date> <time> <name>
+		fields := strings.Fields(line)
+		if len(fields) < 9 {
+			continue
+		}
+
+		mode, err := strconv.ParseUint(fields[1], 8, 32)
+		require.NoError(t, err, "failed to parse mode in %q", line)
+
+		modes[fields[len(fields)-1]] = os.FileMode(mode & 0777)
+	}
+
+	return modes
+}
+
+func TestProjection(t *testing.T) {
+	requireExt4Tools(t)
+
+	host := t.TempDir()
+	projectionDir := t.TempDir()
+	vol := createSecretVolume(t, host)
+
+	mounts := []*criapi.Mount{
+		{ContainerPath: "/etc/hosts", HostPath: filepath.Join(host, "etc-hosts")},
+		{ContainerPath: "/var/secrets", HostPath: vol, Readonly: true},
+	}
+
+	p, err := newProjection(projectionDir, mounts)
+	require.NoError(t, err, "failed to create projection")
+	require.NotNil(t, p, "projection is empty")
+
+	require.Len(t, p.mounts, 1, "non-projected volume was projected")
+	require.Equal(t, "/var/secrets", p.mounts[0].ContainerPath)
+
+	root := "/" + p.mounts[0].Source
+	modes := imageModes(t, p.image, root)
+	require.Equal(t, os.FileMode(0400), modes["password"], "wrong mode of password")
+	require.Equal(t, os.FileMode(0644), modes["config"], "wrong mode of config")
+	require.Equal(t, os.FileMode(0750), modes["nested"], "wrong mode of nested")
+	require.Equal(t, os.FileMode(0600), imageModes(t, p.image, root+"/nested")["token"], "wrong mode of token")
+
+	require.Equal(t, "hunter2", debugfs(t, p.image, "cat "+root+"/password"))
+	require.Equal(t, "abc", debugfs(t, p.image, "cat "+root+"/nested/token"))
+	require.Contains(t, debugfs(t, p.image, "stat "+root+"/link"), `Fast link dest: "password"`)
+
+	_, err = os.Stat(filepath.Join(p.dir, projectionStaging))
+	require.True(t, os.IsNotExist(err), "staging directory was not removed")
+
+	require.NoError(t, p.remove(), "failed to remove projection")
+	entries, err := ioutil.ReadDir(projectionDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "projection was not removed")
+}
+
+func TestProjectionEmpty(t *testing.T) {
+	p, err := newProjection(t.TempDir(), []*criapi.Mount{{ContainerPath: "/etc/hosts", HostPath: "/etc/hosts"}})
+	require.NoError(t, err)
+	require.Nil(t, p, "projection was created without projected volumes")
+	require.NoError(t, p.remove(), "failed to remove empty projection")
+}
+
+func TestProjectionSizeLimit(t *testing.T) {
+	host := t.TempDir()
+	projectionDir := t.TempDir()
+	vol := createSecretVolume(t, host)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(vol, "large"), make([]byte, maxProjectionSize), 0644))
+
+	_, err := newProjection(projectionDir, []*criapi.Mount{{ContainerPath: "/var/secrets", HostPath: vol}})
+	require.Error(t, err, "projection exceeding the size limit was created")
+
+	entries, err := ioutil.ReadDir(projectionDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "failed projection was not removed")
+}
+
+func TestCreateUserContainerProjection(t *testing.T) {
+	requireExt4Tools(t)
+
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.projectionDir = t.TempDir()
+
+	r := newUserContainerRequest("pod", "img")
+	r.Config.Mounts = []*criapi.Mount{{ContainerPath: "/var/secrets", HostPath: createSecretVolume(t, t.TempDir())}}
+
+	resp, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err, "container creation failed")
+
+	image := orch.StartOpts["1"].ProjectionImage
+	require.FileExists(t, image, "projection image was not passed to the orchestrator")
+	require.Len(t, orch.StartOpts["1"].ProjectedMounts, 1)
+
+	require.NoError(t, s.coordinator.stopVM(context.Background(), resp.GetContainerId()))
+	require.NoFileExists(t, image, "projection image was not removed with the VM")
+
+	t.Run("FailedStop", func(t *testing.T) {
+		r := newUserContainerRequest("pod2", "img")
+		r.Config.Mounts = []*criapi.Mount{{ContainerPath: "/var/secrets", HostPath: createSecretVolume(t, t.TempDir())}}
+
+		resp, err := s.CreateContainer(context.Background(), r)
+		require.NoError(t, err, "container creation failed")
+		image := orch.StartOpts["2"].ProjectionImage
+		require.FileExists(t, image)
+
+		orch.StopErr = errInjected
+		err = s.coordinator.stopVM(context.Background(), resp.GetContainerId())
+		require.True(t, errors.Is(err, errInjected), "failed stop was not returned: %v", err)
+		require.NoFileExists(t, image, "projection image of the VM that failed to stop was leaked")
+	})
+}
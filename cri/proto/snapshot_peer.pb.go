@@ -0,0 +1,259 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: snapshot_peer.proto
+
+package proto
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type GetFileReq struct {
+	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetFileReq) Reset()         { *m = GetFileReq{} }
+func (m *GetFileReq) String() string { return proto.CompactTextString(m) }
+func (*GetFileReq) ProtoMessage()    {}
+func (*GetFileReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7b15cb4502cc235c, []int{0}
+}
+
+func (m *GetFileReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetFileReq.Unmarshal(m, b)
+}
+func (m *GetFileReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetFileReq.Marshal(b, m, deterministic)
+}
+func (m *GetFileReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetFileReq.Merge(m, src)
+}
+func (m *GetFileReq) XXX_Size() int {
+	return xxx_messageInfo_GetFileReq.Size(m)
+}
+func (m *GetFileReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetFileReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetFileReq proto.InternalMessageInfo
+
+func (m *GetFileReq) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+type FileChunk struct {
+	Data                 []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileChunk) Reset()         { *m = FileChunk{} }
+func (m *FileChunk) String() string { return proto.CompactTextString(m) }
+func (*FileChunk) ProtoMessage()    {}
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7b15cb4502cc235c, []int{1}
+}
+
+func (m *FileChunk) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileChunk.Unmarshal(m, b)
+}
+func (m *FileChunk) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileChunk.Marshal(b, m, deterministic)
+}
+func (m *FileChunk) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileChunk.Merge(m, src)
+}
+func (m *FileChunk) XXX_Size() int {
+	return xxx_messageInfo_FileChunk.Size(m)
+}
+func (m *FileChunk) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileChunk.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileChunk proto.InternalMessageInfo
+
+func (m *FileChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*GetFileReq)(nil), "vhive.GetFileReq")
+	proto.RegisterType((*FileChunk)(nil), "vhive.FileChunk")
+}
+
+func init() {
+	proto.RegisterFile("snapshot_peer.proto", fileDescriptor_7b15cb4502cc235c)
+}
+
+var fileDescriptor_7b15cb4502cc235c = []byte{
+	// 150 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2e, 0xce, 0x4b, 0x2c,
+	0x28, 0xce, 0xc8, 0x2f, 0x89, 0x2f, 0x48, 0x4d, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17,
+	0x62, 0x2d, 0xcb, 0xc8, 0x2c, 0x4b, 0x55, 0x92, 0xe3, 0xe2, 0x72, 0x4f, 0x2d, 0x71, 0xcb, 0xcc,
+	0x49, 0x0d, 0x4a, 0x2d, 0x14, 0x12, 0xe0, 0x62, 0xce, 0x4e, 0xad, 0x94, 0x60, 0x54, 0x60, 0xd4,
+	0xe0, 0x0c, 0x02, 0x31, 0x95, 0xe4, 0xb9, 0x38, 0x41, 0x92, 0xce, 0x19, 0xa5, 0x79, 0xd9, 0x42,
+	0x42, 0x5c, 0x2c, 0x29, 0x89, 0x25, 0x89, 0x60, 0x79, 0x9e, 0x20, 0x30, 0xdb, 0xc8, 0x89, 0x8b,
+	0x27, 0x18, 0x6a, 0x7c, 0x40, 0x6a, 0x6a, 0x91, 0x90, 0x11, 0x17, 0x3b, 0xd4, 0x40, 0x21, 0x41,
+	0x3d, 0xb0, 0x1d, 0x7a, 0x08, 0x0b, 0xa4, 0x04, 0xa0, 0x42, 0x70, 0x33, 0x95, 0x18, 0x0c, 0x18,
+	0x9d, 0xd8, 0xa3, 0x58, 0xc1, 0x8e, 0x4a, 0x62, 0x03, 0x53, 0xc6, 0x80, 0x01, 0x00, 0x8b, 0x7a,
+	0x3c, 0x75, 0xb2, 0x00, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// SnapshotPeerClient is the client API for SnapshotPeer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SnapshotPeerClient interface {
+	// GetFile streams the snapshot file under a snapshot key in chunks,
+	// followed by its length and CRC-32C in the trailer
+	GetFile(ctx context.Context, in *GetFileReq, opts ...grpc.CallOption) (SnapshotPeer_GetFileClient, error)
+}
+
+type snapshotPeerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSnapshotPeerClient(cc grpc.ClientConnInterface) SnapshotPeerClient {
+	return &snapshotPeerClient{cc}
+}
+
+func (c *snapshotPeerClient) GetFile(ctx context.Context, in *GetFileReq, opts ...grpc.CallOption) (SnapshotPeer_GetFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SnapshotPeer_serviceDesc.Streams[0], "/vhive.SnapshotPeer/GetFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &snapshotPeerGetFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SnapshotPeer_GetFileClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type snapshotPeerGetFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *snapshotPeerGetFileClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SnapshotPeerServer is the server API for SnapshotPeer service.
+type SnapshotPeerServer interface {
+	// GetFile streams the snapshot file under a snapshot key in chunks,
+	// followed by its length and CRC-32C in the trailer
+	GetFile(*GetFileReq, SnapshotPeer_GetFileServer) error
+}
+
+// UnimplementedSnapshotPeerServer can be embedded to have forward compatible implementations.
+type UnimplementedSnapshotPeerServer struct {
+}
+
+func (*UnimplementedSnapshotPeerServer) GetFile(req *GetFileReq, srv SnapshotPeer_GetFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetFile not implemented")
+}
+
+func RegisterSnapshotPeerServer(s *grpc.Server, srv SnapshotPeerServer) {
+	s.RegisterService(&_SnapshotPeer_serviceDesc, srv)
+}
+
+func _SnapshotPeer_GetFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetFileReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SnapshotPeerServer).GetFile(m, &snapshotPeerGetFileServer{stream})
+}
+
+type SnapshotPeer_GetFileServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type snapshotPeerGetFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *snapshotPeerGetFileServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _SnapshotPeer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "vhive.SnapshotPeer",
+	HandlerType: (*SnapshotPeerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetFile",
+			Handler:       _SnapshotPeer_GetFile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "snapshot_peer.proto",
+}
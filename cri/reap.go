@@ -0,0 +1,90 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+const (
+	// reapEager and reapLazy are the REAP modes of the restores, the working
+	// set being installed before the VM is returned or on its first page fault
+	reapEager = "eager"
+	reapLazy  = "lazy"
+)
+
+// reapMode returns the REAP mode of the restores of the VM, empty if it is
+// restored without REAP
+func reapMode(fi *funcInstance) string {
+	switch {
+	case fi.vmOpts == nil || fi.vmOpts.REAPTrace == "":
+		return ""
+	case fi.reapEager:
+		return reapEager
+	default:
+		return reapLazy
+	}
+}
+
+// writeREAPMetrics writes the latency of the restores with REAP by mode and
+// the hit rate of the working set prefetches in the Prometheus text format,
+// nothing if no VM was restored with REAP
+func writeREAPMetrics(w io.Writer, stats ScaleToZeroStats) error {
+	if len(stats.REAPRestoreLatency) == 0 {
+		return nil
+	}
+
+	const name = "vhive_reap_restore_latency_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Latency of the restores of the VMs with REAP by mode.\n# TYPE %s histogram\n", name, name); err != nil {
+		return err
+	}
+
+	modes := make([]string, 0, len(stats.REAPRestoreLatency))
+	for mode := range stats.REAPRestoreLatency {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+
+	for _, mode := range modes {
+		h := stats.REAPRestoreLatency[mode]
+		for i, bound := range h.BucketsMs {
+			le := strconv.FormatFloat(bound/1000, 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s_bucket{mode=%q,le=%q} %d\n", name, mode, le, h.Counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{mode=%q,le=\"+Inf\"} %d\n%s_sum{mode=%q} %s\n%s_count{mode=%q} %d\n",
+			name, mode, h.Count, name, mode, strconv.FormatFloat(h.SumMs/1000, 'g', -1, 64), name, mode, h.Count); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "# HELP vhive_reap_working_set_hit_rate Share of the pages of the restores served by the working set prefetches.\n"+
+		"# TYPE vhive_reap_working_set_hit_rate gauge\nvhive_reap_working_set_hit_rate %s\n",
+		strconv.FormatFloat(stats.WorkingSetHitRate, 'g', -1, 64))
+
+	return err
+}
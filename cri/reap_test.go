@@ -0,0 +1,122 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// newOffloadedREAPInstance returns the coordinator and the offloaded VM of a
+// function restored with REAP in the given mode
+func newOffloadedREAPInstance(t *testing.T, orch *fakes.Orchestrator, eager bool) (*coordinator, *funcInstance) {
+	orch.SnapshotsEnabled = true
+	c := newCoordinator(orch)
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img", ctriface.WithREAP("img-00001"))
+	require.NoError(t, err, "could not start VM")
+	fi.reapEager = eager
+
+	require.NoError(t, c.orchOffloadInstance(ctx, fi), "could not offload VM")
+
+	return c, fi
+}
+
+func TestRestoreREAPEager(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.WorkingSetInstalled = make(chan struct{})
+	c, fi := newOffloadedREAPInstance(t, orch, true)
+
+	restored := make(chan *funcInstance)
+	go func() {
+		fi, err := c.startVM(context.Background(), "img", ctriface.WithREAP("img-00001"))
+		require.NoError(t, err, "could not restore VM")
+		restored <- fi
+	}()
+
+	// The VM is not returned, so not marked ready, until its working set is installed
+	select {
+	case <-restored:
+		t.Fatal("VM was restored before its working set was installed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(orch.WorkingSetInstalled)
+
+	select {
+	case got := <-restored:
+		require.Equal(t, fi.vmID, got.vmID, "offloaded VM was not restored")
+		require.Contains(t, got.restoreMetric.MetricMap, metrics.InstallWorkingSet, "wait for the working set is not in the restore metric")
+	case <-time.After(10 * time.Second):
+		t.Fatal("VM is still waiting for its working set")
+	}
+	require.Equal(t, 1, orch.WorkingSetWaits[fi.vmID], "working set was not waited for")
+
+	stats := c.snapStats.get()
+	require.EqualValues(t, 1, stats.REAPRestoreLatency[reapEager].Count)
+	require.NotContains(t, stats.REAPRestoreLatency, reapLazy)
+}
+
+func TestRestoreREAPLazy(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	// A wait for the working set would block the restore
+	orch.WorkingSetInstalled = make(chan struct{})
+	c, fi := newOffloadedREAPInstance(t, orch, false)
+
+	got, err := c.startVM(context.Background(), "img", ctriface.WithREAP("img-00001"))
+	require.NoError(t, err, "could not restore VM")
+	require.Equal(t, fi.vmID, got.vmID, "offloaded VM was not restored")
+	require.Zero(t, orch.WorkingSetWaits[fi.vmID], "working set was waited for")
+
+	stats := c.snapStats.get()
+	require.EqualValues(t, 1, stats.REAPRestoreLatency[reapLazy].Count)
+	require.NotContains(t, stats.REAPRestoreLatency, reapEager)
+}
+
+func TestWriteREAPMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeREAPMetrics(&buf, ScaleToZeroStats{}))
+	require.Empty(t, buf.String(), "metrics were written without REAP restores")
+
+	stats := newSnapshotStats()
+	stats.restored(20*time.Millisecond, false, reapEager, nil)
+	stats.restored(200*time.Millisecond, false, reapLazy, nil)
+	stats.restored(time.Second, false, "", nil)
+
+	require.NoError(t, writeREAPMetrics(&buf, stats.get()))
+	out := buf.String()
+	require.Contains(t, out, "# TYPE vhive_reap_restore_latency_seconds histogram\n")
+	require.Contains(t, out, `vhive_reap_restore_latency_seconds_bucket{mode="eager",le="0.025"} 1`)
+	require.Contains(t, out, `vhive_reap_restore_latency_seconds_bucket{mode="lazy",le="0.1"} 0`)
+	require.Contains(t, out, `vhive_reap_restore_latency_seconds_bucket{mode="lazy",le="+Inf"} 1`)
+	require.Contains(t, out, `vhive_reap_restore_latency_seconds_count{mode="eager"} 1`)
+	require.Contains(t, out, "vhive_reap_working_set_hit_rate 0\n")
+}
@@ -0,0 +1,318 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ease-lab/vhive/logging"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// sandboxAnnotation selects the sandbox backend running the function of the pod
+	sandboxAnnotation = "vhive.io/sandbox"
+
+	// SandboxFirecracker runs the functions in the Firecracker VMs of vHive, the default
+	SandboxFirecracker = "firecracker"
+	// SandboxKata runs the functions in Kata Containers, through their containerd runtime handler
+	SandboxKata = "kata"
+)
+
+// SandboxCapabilities are the features of vHive that a sandbox backend supports
+type SandboxCapabilities struct {
+	// Snapshots restores the sandboxes from snapshots, with their scale to zero and prefaulting
+	Snapshots bool `json:"snapshots"`
+	// REAP records and prefetches the working set of the restored sandboxes
+	REAP       bool `json:"reap"`
+	Hugepages  bool `json:"hugepages"`
+	ExtraDisks bool `json:"extraDisks"`
+	// SlotReuse parks the sandboxes of the removed containers for the next ones of their revision
+	SlotReuse bool `json:"slotReuse"`
+	// GuestAgent probes the functions through the guest agent in the sandbox
+	GuestAgent bool `json:"guestAgent"`
+	// EgressPolicy restricts the egress of the sandboxes with iptables on their taps
+	EgressPolicy bool `json:"egressPolicy"`
+	// Vsock reaches the functions over the vsock device of the sandboxes
+	Vsock bool `json:"vsock"`
+}
+
+// SandboxInfo is a sandbox backend enabled on the node
+type SandboxInfo struct {
+	Name string `json:"name"`
+	// RuntimeHandler is the containerd runtime handler of the pods, empty for the VMs of vHive
+	RuntimeHandler string              `json:"runtimeHandler,omitempty"`
+	Capabilities   SandboxCapabilities `json:"capabilities"`
+}
+
+// sandboxBackend runs the functions of the user containers in sandboxes
+type sandboxBackend interface {
+	// Name is the value of the sandbox annotation selecting the backend
+	Name() string
+	// RuntimeHandler is the containerd runtime handler the pods of the backend
+	// run with, empty if their functions run in the VMs of vHive
+	RuntimeHandler() string
+	Capabilities() SandboxCapabilities
+}
+
+// firecrackerBackend runs the functions in the Firecracker VMs of vHive
+type firecrackerBackend struct{}
+
+func (firecrackerBackend) Name() string { return SandboxFirecracker }
+
+func (firecrackerBackend) RuntimeHandler() string { return "" }
+
+func (firecrackerBackend) Capabilities() SandboxCapabilities {
+	return SandboxCapabilities{
+		Snapshots:    true,
+		REAP:         true,
+		Hugepages:    true,
+		ExtraDisks:   true,
+		SlotReuse:    true,
+		GuestAgent:   true,
+		EgressPolicy: true,
+		Vsock:        true,
+	}
+}
+
+// kataBackend runs the functions in the Kata Containers VMs of their pods,
+// created by containerd with the kata runtime handler
+type kataBackend struct {
+	handler string
+}
+
+func (kataBackend) Name() string { return SandboxKata }
+
+func (b kataBackend) RuntimeHandler() string { return b.handler }
+
+// Capabilities of Kata Containers, whose VMs are booted by containerd and
+// thus neither snapshotted nor reused by vHive
+func (kataBackend) Capabilities() SandboxCapabilities {
+	return SandboxCapabilities{}
+}
+
+// getSandboxBackend returns the backend selected by the sandbox annotation,
+// Firecracker if there is none
+func (s *Service) getSandboxBackend(annotations map[string]string) (sandboxBackend, error) {
+	name := annotations[sandboxAnnotation]
+	if name == "" || name == SandboxFirecracker {
+		return firecrackerBackend{}, nil
+	}
+
+	if backend, ok := s.sandboxes[name]; ok {
+		return backend, nil
+	}
+
+	if name == SandboxKata {
+		return nil, fmt.Errorf("%s sandboxes are not enabled on the node", name)
+	}
+
+	return nil, fmt.Errorf("invalid %s annotation %q, must be %s or %s", sandboxAnnotation, name, SandboxFirecracker, SandboxKata)
+}
+
+// checkSandboxCapabilities returns the problems of the features of the spec
+// that its sandbox backend does not support, and drops the ignored ones
+func checkSandboxCapabilities(spec *vmSpec) SpecErrors {
+	var (
+		name     = spec.sandbox.Name()
+		caps     = spec.sandbox.Capabilities()
+		problems SpecErrors
+	)
+
+	unsupported := func(field, feature string) {
+		problems = append(problems, SpecProblem{
+			Field:   field,
+			Message: fmt.Sprintf("%s are not supported by %s sandboxes", feature, name),
+		})
+	}
+
+	if spec.hugepages && !caps.Hugepages {
+		unsupported(hugepagesAnnotation, "hugepages")
+	}
+	if spec.disk != nil && !caps.ExtraDisks {
+		unsupported(extraDiskSizeAnnotation, "extra disks")
+		spec.disk = nil
+	}
+	if spec.prefault && !caps.Snapshots {
+		unsupported(guestPrefaultEnv, "prefaulted snapshots")
+	}
+	if spec.reap && !caps.Snapshots {
+		unsupported(guestREAPEnv, "REAP")
+	}
+	if spec.probe != nil && !caps.GuestAgent {
+		unsupported(probeAnnotation, "guest agent probes")
+	}
+	if spec.egressPolicy != nil && !caps.EgressPolicy {
+		unsupported(egressPolicyAnnotation, "egress policies")
+	}
+	if spec.transport == guestTransportVsock && !caps.Vsock {
+		unsupported(guestTransportEnv, "vsock transports")
+	}
+
+	if spec.scaleToZero && !caps.Snapshots {
+		spec.scaleToZero = false
+		spec.warnings = append(spec.warnings,
+			fmt.Sprintf("%s is ignored, %s sandboxes are not snapshotted", scaleToZeroEnv, name))
+	}
+
+	return problems
+}
+
+// WithKata runs the functions of the pods annotated with vhive.io/sandbox: kata
+// in Kata Containers, with the given containerd runtime handler. An empty
+// handler disables them.
+func WithKata(runtimeHandler string) ServiceOption {
+	return func(s *Service) {
+		if runtimeHandler == "" {
+			delete(s.sandboxes, SandboxKata)
+			return
+		}
+		if s.sandboxes == nil {
+			s.sandboxes = make(map[string]sandboxBackend)
+		}
+		s.sandboxes[SandboxKata] = kataBackend{handler: runtimeHandler}
+	}
+}
+
+// Sandboxes returns the sandbox backends enabled on the node with their capabilities
+func (s *Service) Sandboxes() []SandboxInfo {
+	infos := []SandboxInfo{newSandboxInfo(firecrackerBackend{})}
+
+	names := make([]string, 0, len(s.sandboxes))
+	for name := range s.sandboxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		infos = append(infos, newSandboxInfo(s.sandboxes[name]))
+	}
+
+	return infos
+}
+
+func newSandboxInfo(b sandboxBackend) SandboxInfo {
+	return SandboxInfo{Name: b.Name(), RuntimeHandler: b.RuntimeHandler(), Capabilities: b.Capabilities()}
+}
+
+// setRuntimeHandler runs the pod with the runtime handler of its sandbox
+// backend, if any, rejecting the pods whose runtime class selects another one
+func (s *Service) setRuntimeHandler(r *criapi.RunPodSandboxRequest) error {
+	backend, err := s.getSandboxBackend(r.GetConfig().GetAnnotations())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	handler := backend.RuntimeHandler()
+	if handler == "" {
+		return nil
+	}
+
+	if r.GetRuntimeHandler() != "" && r.GetRuntimeHandler() != handler {
+		return status.Errorf(codes.InvalidArgument, "the runtime class of the pod selects runtime handler %q, but %s sandboxes run with %q",
+			r.GetRuntimeHandler(), backend.Name(), handler)
+	}
+	r.RuntimeHandler = handler
+
+	return nil
+}
+
+// createSandboxedContainer creates the user container of a function running
+// in a sandbox of a containerd runtime handler, e.g., Kata Containers. The
+// container runs the function image in the sandbox of its pod, which the
+// queue-proxy reaches at the IP of the pod, and no VM of vHive is started.
+func (s *Service) createSandboxedContainer(ctx context.Context, r *criapi.CreateContainerRequest) (*criapi.CreateContainerResponse, error) {
+	logger := logging.FromContext(ctx, logging.Coordinator)
+
+	spec, err := s.parseFunctionSpec(r, s.coordinator.config.get())
+	if err != nil {
+		return nil, logSpecError(logger, r, err)
+	}
+	for _, warning := range spec.warnings {
+		logger.Warn(warning)
+	}
+
+	logger = logger.WithFields(log.Fields{"sandbox": spec.sandbox.Name(), "image": spec.image})
+
+	podIP, err := s.getPodIP(ctx, r.GetPodSandboxId())
+	if err != nil {
+		logger.WithError(err).Error("failed to get the IP of the sandbox")
+		return nil, err
+	}
+
+	if !spec.imageCached {
+		pull := &criapi.PullImageRequest{Image: &criapi.ImageSpec{Image: spec.image}, SandboxConfig: r.GetSandboxConfig()}
+		if _, err := s.stockImageClient.PullImage(ctx, pull); err != nil {
+			logger.WithError(err).Error("failed to pull the function image")
+			return nil, err
+		}
+	}
+
+	// The container runs the function image instead of the placeholder image
+	config := *r.GetConfig()
+	config.Image = &criapi.ImageSpec{Image: spec.image}
+	req := *r
+	req.Config = &config
+
+	resp, err := s.stockRuntimeClient.CreateContainer(ctx, &req)
+	if err != nil {
+		logger.WithError(err).Error("failed to create container")
+		return nil, err
+	}
+
+	logger = logger.WithField("containerID", resp.GetContainerId())
+
+	if err := s.insertPodVMConfig(r.GetPodSandboxId(), &VMConfig{guestIP: podIP, guestPort: spec.guestPort}); err != nil {
+		logger.WithError(err).Error("failed to store VM config")
+
+		remove := &criapi.RemoveContainerRequest{ContainerId: resp.GetContainerId()}
+		if _, err := s.stockRuntimeClient.RemoveContainer(context.Background(), remove); err != nil {
+			logger.WithError(err).Error("failed to remove container after failure")
+		}
+		return nil, err
+	}
+
+	logger.Debug("created the user container")
+
+	return resp, nil
+}
+
+// getPodIP returns the IP of the sandbox of the pod
+func (s *Service) getPodIP(ctx context.Context, podID string) (string, error) {
+	resp, err := s.stockRuntimeClient.PodSandboxStatus(ctx, &criapi.PodSandboxStatusRequest{PodSandboxId: podID})
+	if err != nil {
+		return "", err
+	}
+
+	ip := resp.GetStatus().GetNetwork().GetIp()
+	if ip == "" {
+		return "", status.Errorf(codes.Unavailable, "sandbox %s has no IP", podID)
+	}
+
+	return ip, nil
+}
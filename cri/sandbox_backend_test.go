@@ -0,0 +1,214 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// fakeSandboxClient records the runtime handlers of the pods and the images
+// of the containers, whose sandboxes all have podIP
+type fakeSandboxClient struct {
+	*fakes.StockRuntimeClient
+
+	podIP string
+
+	mu       sync.Mutex
+	handlers []string
+	images   []string
+}
+
+func (c *fakeSandboxClient) RunPodSandbox(ctx context.Context, r *criapi.RunPodSandboxRequest, opts ...grpc.CallOption) (*criapi.RunPodSandboxResponse, error) {
+	c.mu.Lock()
+	c.handlers = append(c.handlers, r.GetRuntimeHandler())
+	c.mu.Unlock()
+
+	return c.StockRuntimeClient.RunPodSandbox(ctx, r, opts...)
+}
+
+func (c *fakeSandboxClient) CreateContainer(ctx context.Context, r *criapi.CreateContainerRequest, opts ...grpc.CallOption) (*criapi.CreateContainerResponse, error) {
+	c.mu.Lock()
+	c.images = append(c.images, r.GetConfig().GetImage().GetImage())
+	c.mu.Unlock()
+
+	return c.StockRuntimeClient.CreateContainer(ctx, r, opts...)
+}
+
+func (c *fakeSandboxClient) PodSandboxStatus(ctx context.Context, r *criapi.PodSandboxStatusRequest, opts ...grpc.CallOption) (*criapi.PodSandboxStatusResponse, error) {
+	return &criapi.PodSandboxStatusResponse{
+		Status: &criapi.PodSandboxStatus{
+			Id:      r.GetPodSandboxId(),
+			Network: &criapi.PodSandboxNetworkStatus{Ip: c.podIP},
+		},
+	}, nil
+}
+
+func newKataTestService(podIP string) (*Service, *fakeSandboxClient, *fakes.StockImageClient, *fakes.Orchestrator) {
+	stock := &fakeSandboxClient{StockRuntimeClient: &fakes.StockRuntimeClient{}, podIP: podIP}
+	images := &fakes.StockImageClient{}
+	orch := fakes.NewOrchestrator()
+
+	s := newTestService(stock, orch)
+	WithStockClients(stock, images)(s)
+	WithKata("kata-fc")(s)
+
+	return s, stock, images, orch
+}
+
+// withSandbox annotates the pod of the user container with the sandbox
+func withSandbox(r *criapi.CreateContainerRequest, sandbox string) *criapi.CreateContainerRequest {
+	r.SandboxConfig = &criapi.PodSandboxConfig{Annotations: map[string]string{sandboxAnnotation: sandbox}}
+	return r
+}
+
+func TestRunPodSandboxRuntimeHandler(t *testing.T) {
+	s, stock, _, _ := newKataTestService("10.0.0.5")
+
+	run := func(annotations map[string]string, handler string) error {
+		config := newPodSandboxConfig()
+		config.Annotations = annotations
+		_, err := s.RunPodSandbox(context.Background(), &criapi.RunPodSandboxRequest{Config: config, RuntimeHandler: handler})
+		return err
+	}
+
+	require.NoError(t, run(nil, ""))
+	require.NoError(t, run(map[string]string{sandboxAnnotation: SandboxFirecracker}, ""))
+	require.NoError(t, run(map[string]string{sandboxAnnotation: SandboxKata}, ""))
+	require.NoError(t, run(map[string]string{sandboxAnnotation: SandboxKata}, "kata-fc"))
+	require.Equal(t, []string{"", "", "kata-fc", "kata-fc"}, stock.handlers)
+
+	err := run(map[string]string{sandboxAnnotation: SandboxKata}, "runc")
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "a runtime class selecting another handler must be rejected")
+
+	err = run(map[string]string{sandboxAnnotation: "gvisor"}, "")
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	WithKata("")(s)
+	err = run(map[string]string{sandboxAnnotation: SandboxKata}, "")
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "kata must be rejected once disabled")
+	require.Len(t, stock.handlers, 4)
+}
+
+func TestCreateKataContainer(t *testing.T) {
+	s, stock, images, orch := newKataTestService("10.0.0.5")
+
+	resp, err := s.CreateContainer(context.Background(), withSandbox(newUserContainerRequest("pod", "img"), SandboxKata))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, "ctr1", resp.GetContainerId())
+
+	require.Zero(t, orch.NumStarted(), "a kata container must not start a VM")
+	require.Equal(t, []string{"img"}, stock.images, "the container must run the function image")
+	require.Equal(t, []string{"img"}, images.Pulled())
+	_, ok := s.coordinator.getInstance(resp.GetContainerId())
+	require.False(t, ok)
+
+	// The queue-proxy reaches the function at the IP of the pod
+	qp := newQueueProxyRequest("pod")
+	_, err = s.CreateContainer(context.Background(), qp)
+	require.NoError(t, err, "queue-proxy creation failed")
+
+	addr, _ := getEnv(qp, guestIPEnv)
+	port, _ := getEnv(qp, guestPortEnv)
+	require.Equal(t, "10.0.0.5", addr)
+	require.Equal(t, s.coordinator.config.get().GuestPort, port)
+}
+
+func TestCreateKataContainerWithoutPodIP(t *testing.T) {
+	s, stock, _, _ := newKataTestService("")
+
+	_, err := s.CreateContainer(context.Background(), withSandbox(newUserContainerRequest("pod", "img"), SandboxKata))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Empty(t, stock.Leaked())
+}
+
+func TestKataCapabilities(t *testing.T) {
+	s, _, _, _ := newKataTestService("10.0.0.5")
+
+	for _, tc := range []struct {
+		name  string
+		field string
+		setup func(r *criapi.CreateContainerRequest)
+	}{
+		{"Hugepages", hugepagesAnnotation, func(r *criapi.CreateContainerRequest) {
+			r.SandboxConfig.Annotations[hugepagesAnnotation] = "true"
+		}},
+		{"ExtraDisk", extraDiskSizeAnnotation, func(r *criapi.CreateContainerRequest) {
+			r.SandboxConfig.Annotations[extraDiskSizeAnnotation] = "1"
+		}},
+		{"Prefault", guestPrefaultEnv, func(r *criapi.CreateContainerRequest) {
+			r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestPrefaultEnv, Value: "true"})
+		}},
+		{"Probe", probeAnnotation, func(r *criapi.CreateContainerRequest) {
+			r.SandboxConfig.Annotations[probeAnnotation] = probeTCP
+		}},
+		{"EgressPolicy", egressPolicyAnnotation, func(r *criapi.CreateContainerRequest) {
+			r.SandboxConfig.Annotations[egressPolicyAnnotation] = "10.0.0.1"
+		}},
+		{"Vsock", guestTransportEnv, func(r *criapi.CreateContainerRequest) {
+			r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: guestTransportEnv, Value: guestTransportVsock})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := withSandbox(newUserContainerRequest("pod", "img"), SandboxKata)
+			tc.setup(r)
+
+			_, err := s.CreateContainer(context.Background(), r)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			specErr, ok := err.(*SpecValidationError)
+			require.True(t, ok, "expected a spec validation error, got %v", err)
+			require.Equal(t, []string{tc.field}, specErr.Fields())
+		})
+	}
+
+	// The same features are supported by the Firecracker VMs
+	r := withSandbox(newUserContainerRequest("pod", "img"), SandboxFirecracker)
+	r.SandboxConfig.Annotations[probeAnnotation] = probeTCP
+	_, err := s.CreateContainer(context.Background(), r)
+	require.NoError(t, err)
+
+	require.Equal(t, []SandboxInfo{
+		{Name: SandboxFirecracker, Capabilities: SandboxCapabilities{
+			Snapshots: true, REAP: true, Hugepages: true, ExtraDisks: true, SlotReuse: true, GuestAgent: true, EgressPolicy: true, Vsock: true,
+		}},
+		{Name: SandboxKata, RuntimeHandler: "kata-fc"},
+	}, s.Sandboxes())
+}
+
+func TestCreateContainerUnknownSandbox(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), withSandbox(newUserContainerRequest("pod", "img"), SandboxKata))
+	specErr, ok := err.(*SpecValidationError)
+	require.True(t, ok, "expected a spec validation error, got %v", err)
+	require.Equal(t, []string{sandboxAnnotation}, specErr.Fields())
+}
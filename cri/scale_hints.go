@@ -0,0 +1,316 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	// warmPoolAnnotation sets the minimum warm pool hinted to the autoscaler
+	// for the revision: a number of instances, or "auto" to derive it from
+	// the arrival rate and the boot latency of the revision
+	warmPoolAnnotation = "vhive.io/min-warm-pool"
+	warmPoolAuto       = "auto"
+	// maxWarmPoolHint bounds the minimum warm pool of a revision
+	maxWarmPoolHint = 100
+
+	// arrivalRateWindow is the time constant of the decay of the arrival rate
+	arrivalRateWindow = time.Minute
+	// bootLatencyWeight is the weight of the latest boot in the average boot latency
+	bootLatencyWeight = 0.2
+	// minArrivalRate is the arrival rate under which an idle revision is forgotten
+	minArrivalRate = 1e-3
+)
+
+// RevisionScaleHint is the VM-level load of a revision on the node,
+// hinting the autoscaler how to scale it
+type RevisionScaleHint struct {
+	Revision string `json:"revision"`
+	// ActiveInstances is the number of VMs serving containers of the revision
+	ActiveInstances int `json:"activeInstances"`
+	// Concurrency is the number of requests in flight in the active VMs
+	Concurrency int64 `json:"concurrency"`
+	// ArrivalRate is the recent rate of the creations of containers, per second
+	ArrivalRate float64 `json:"arrivalRate"`
+	// BootLatency is the average latency of the recent VM starts
+	BootLatency time.Duration `json:"bootLatency"`
+	// SnapshotsAvailable is the number of idle or parked VMs a new container
+	// of the revision may restore or adopt instead of booting one
+	SnapshotsAvailable int `json:"snapshotsAvailable"`
+	// MinWarmPool is the minimum number of instances to keep warm, set with
+	// the vhive.io/min-warm-pool annotation, 0 if not set
+	MinWarmPool int `json:"minWarmPool"`
+}
+
+// warmPoolPolicy is the minimum warm pool of a revision, set by its annotation
+type warmPoolPolicy struct {
+	auto bool
+	min  int
+}
+
+// getWarmPool returns the minimum warm pool requested for the revision
+func getWarmPool(r *criapi.CreateContainerRequest) (warmPoolPolicy, error) {
+	value, ok := getAnnotations(r)[warmPoolAnnotation]
+	if !ok {
+		return warmPoolPolicy{}, nil
+	}
+	if value == warmPoolAuto {
+		return warmPoolPolicy{auto: true}, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > maxWarmPoolHint {
+		return warmPoolPolicy{}, fmt.Errorf("invalid %s annotation %q, must be %q or between 0 and %d",
+			warmPoolAnnotation, value, warmPoolAuto, maxWarmPoolHint)
+	}
+
+	return warmPoolPolicy{min: n}, nil
+}
+
+// revisionLoad is the arrival rate and the boot latency of a revision.
+// Each revision has its own lock, so that the creations of the containers of
+// different revisions do not contend.
+type revisionLoad struct {
+	sync.Mutex
+
+	// arrivalRate is the rate decayed until lastArrival
+	arrivalRate float64
+	lastArrival time.Time
+	bootLatency time.Duration
+	warmPool    warmPoolPolicy
+}
+
+// rateAt returns the arrival rate decayed until now
+func (l *revisionLoad) rateAt(now time.Time) float64 {
+	if l.lastArrival.IsZero() {
+		return 0
+	}
+
+	elapsed := now.Sub(l.lastArrival)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return l.arrivalRate * math.Exp(-float64(elapsed)/float64(arrivalRateWindow))
+}
+
+// scaleHints aggregates the load of the revisions. The create path only
+// updates the load of its revision, while the instances are counted when
+// the hints are scraped.
+type scaleHints struct {
+	revisions sync.Map
+	now       func() time.Time
+}
+
+func newScaleHints() *scaleHints {
+	return &scaleHints{now: time.Now}
+}
+
+func (h *scaleHints) load(revision string) *revisionLoad {
+	if l, ok := h.revisions.Load(revision); ok {
+		return l.(*revisionLoad)
+	}
+
+	l, _ := h.revisions.LoadOrStore(revision, &revisionLoad{})
+	return l.(*revisionLoad)
+}
+
+// arrived records the creation of a container of the revision
+func (h *scaleHints) arrived(revision string) {
+	if revision == "" {
+		return
+	}
+
+	now := h.now()
+	l := h.load(revision)
+
+	l.Lock()
+	defer l.Unlock()
+
+	// Each arrival adds 1/window to the rate, which decays exponentially,
+	// so that a steady arrival rate converges to itself
+	l.arrivalRate = l.rateAt(now) + float64(time.Second)/float64(arrivalRateWindow)
+	l.lastArrival = now
+}
+
+// setWarmPool records the minimum warm pool requested for the revision
+func (h *scaleHints) setWarmPool(revision string, warmPool warmPoolPolicy) {
+	if revision == "" {
+		return
+	}
+
+	l := h.load(revision)
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.warmPool = warmPool
+}
+
+// booted records the latency of a VM started for a container of the revision
+func (h *scaleHints) booted(revision string, latency time.Duration) {
+	if revision == "" {
+		return
+	}
+
+	l := h.load(revision)
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.bootLatency == 0 {
+		l.bootLatency = latency
+	} else {
+		l.bootLatency = time.Duration(bootLatencyWeight*float64(latency) + (1-bootLatencyWeight)*float64(l.bootLatency))
+	}
+}
+
+// minWarmPool returns the minimum warm pool of a revision: its requested
+// minimum, or with "auto" the containers expected to arrive while a VM boots
+func minWarmPool(policy warmPoolPolicy, arrivalRate float64, bootLatency time.Duration) int {
+	if !policy.auto {
+		return policy.min
+	}
+
+	n := int(math.Ceil(arrivalRate * bootLatency.Seconds()))
+	if n > maxWarmPoolHint {
+		n = maxWarmPoolHint
+	}
+
+	return n
+}
+
+// ScaleHints returns the load of the revisions with instances on the node
+// or containers created recently, sorted by revision
+func (s *Service) ScaleHints() []RevisionScaleHint {
+	c := s.coordinator
+	hints := make(map[string]*RevisionScaleHint)
+	get := func(revision string) *RevisionScaleHint {
+		hint, ok := hints[revision]
+		if !ok {
+			hint = &RevisionScaleHint{Revision: revision}
+			hints[revision] = hint
+		}
+		return hint
+	}
+
+	c.Lock()
+	for _, fi := range c.activeInstances {
+		if fi.revisionID != "" {
+			hint := get(fi.revisionID)
+			hint.ActiveInstances++
+			hint.Concurrency += atomic.LoadInt64(&fi.inFlight)
+		}
+	}
+	for _, idles := range c.idleInstances {
+		for _, fi := range idles {
+			if fi.revisionID != "" {
+				get(fi.revisionID).SnapshotsAvailable++
+			}
+		}
+	}
+	c.Unlock()
+
+	if c.parking != nil {
+		for _, fi := range c.parking.instances() {
+			get(fi.revisionID).SnapshotsAvailable++
+		}
+	}
+
+	now := s.scaleHints.now()
+	s.scaleHints.revisions.Range(func(key, value interface{}) bool {
+		revision, l := key.(string), value.(*revisionLoad)
+
+		l.Lock()
+		rate, latency, warmPool := l.rateAt(now), l.bootLatency, l.warmPool
+		l.Unlock()
+
+		hint, ok := hints[revision]
+		if !ok && rate < minArrivalRate {
+			// The revision left the node, its load is forgotten
+			s.scaleHints.revisions.Delete(revision)
+			return true
+		}
+		if !ok {
+			hint = get(revision)
+		}
+
+		hint.ArrivalRate = rate
+		hint.BootLatency = latency
+		hint.MinWarmPool = minWarmPool(warmPool, rate, latency)
+		return true
+	})
+
+	list := make([]RevisionScaleHint, 0, len(hints))
+	for _, hint := range hints {
+		list = append(list, *hint)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Revision < list[j].Revision })
+
+	return list
+}
+
+// writeScaleHints writes the hints in the Prometheus text format,
+// for the external metrics adapters of the autoscalers to scrape
+func writeScaleHints(w io.Writer, hints []RevisionScaleHint) error {
+	metrics := []struct {
+		name, help string
+		value      func(h *RevisionScaleHint) string
+	}{
+		{"vhive_revision_active_instances", "VMs serving containers of the revision.",
+			func(h *RevisionScaleHint) string { return strconv.Itoa(h.ActiveInstances) }},
+		{"vhive_revision_concurrency", "Requests in flight in the VMs of the revision.",
+			func(h *RevisionScaleHint) string { return strconv.FormatInt(h.Concurrency, 10) }},
+		{"vhive_revision_arrival_rate", "Recent rate of the creations of containers of the revision per second.",
+			func(h *RevisionScaleHint) string { return strconv.FormatFloat(h.ArrivalRate, 'g', -1, 64) }},
+		{"vhive_revision_boot_latency_seconds", "Average latency of the recent VM starts of the revision.",
+			func(h *RevisionScaleHint) string { return strconv.FormatFloat(h.BootLatency.Seconds(), 'g', -1, 64) }},
+		{"vhive_revision_snapshots_available", "Idle or parked VMs of the revision a new container may restore or adopt.",
+			func(h *RevisionScaleHint) string { return strconv.Itoa(h.SnapshotsAvailable) }},
+		{"vhive_revision_min_warm_pool", "Minimum number of instances of the revision to keep warm.",
+			func(h *RevisionScaleHint) string { return strconv.Itoa(h.MinWarmPool) }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for i := range hints {
+			if _, err := fmt.Fprintf(w, "%s{revision=%q} %s\n", m.name, hints[i].Revision, m.value(&hints[i])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestArrivalRate(t *testing.T) {
+	h := newScaleHints()
+	now := time.Unix(0, 0)
+	h.now = func() time.Time { return now }
+
+	// A steady rate of 5 arrivals per second converges to itself
+	for i := 0; i < 5*600; i++ {
+		h.arrived("rev1")
+		now = now.Add(200 * time.Millisecond)
+	}
+
+	l := h.load("rev1")
+	require.InDelta(t, 5, l.rateAt(now), 0.1, "steady arrival rate was not tracked")
+
+	// Without arrivals, the rate decays by e every window
+	require.InDelta(t, 5/2.718281828, l.rateAt(now.Add(arrivalRateWindow)), 0.1, "arrival rate did not decay")
+
+	h.arrived("")
+	_, ok := h.revisions.Load("")
+	require.False(t, ok, "arrival without revision was recorded")
+}
+
+func TestBootLatencyAverage(t *testing.T) {
+	h := newScaleHints()
+
+	h.booted("rev1", time.Second)
+	require.Equal(t, time.Second, h.load("rev1").bootLatency, "first boot was not taken as the average")
+
+	h.booted("rev1", 2*time.Second)
+	require.Equal(t, 1200*time.Millisecond, h.load("rev1").bootLatency, "boot latency was not averaged")
+}
+
+func TestMinWarmPool(t *testing.T) {
+	require.Equal(t, 0, minWarmPool(warmPoolPolicy{}, 10, time.Second))
+	require.Equal(t, 3, minWarmPool(warmPoolPolicy{min: 3}, 10, time.Second))
+	// 4 arrivals per second during a boot of 500ms need 2 warm instances
+	require.Equal(t, 2, minWarmPool(warmPoolPolicy{auto: true}, 4, 500*time.Millisecond))
+	require.Equal(t, 1, minWarmPool(warmPoolPolicy{auto: true}, 0.1, time.Second))
+	require.Equal(t, maxWarmPoolHint, minWarmPool(warmPoolPolicy{auto: true}, 1000, time.Second))
+
+	for value, expected := range map[string]warmPoolPolicy{
+		"auto": {auto: true},
+		"0":    {},
+		"4":    {min: 4},
+	} {
+		r := &criapi.CreateContainerRequest{Config: &criapi.ContainerConfig{
+			Annotations: map[string]string{warmPoolAnnotation: value},
+		}}
+		policy, err := getWarmPool(r)
+		require.NoError(t, err)
+		require.Equal(t, expected, policy)
+	}
+	for _, value := range []string{"-1", "many", "1000"} {
+		r := &criapi.CreateContainerRequest{Config: &criapi.ContainerConfig{
+			Annotations: map[string]string{warmPoolAnnotation: value},
+		}}
+		_, err := getWarmPool(r)
+		require.Error(t, err, "invalid warm pool %q was accepted", value)
+	}
+}
+
+func TestScaleHints(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+	for _, pod := range []string{"pod1", "pod2"} {
+		r := newUserContainerRequest(pod, "img")
+		r.Config.Annotations = map[string]string{warmPoolAnnotation: "5"}
+		_, err := s.CreateContainer(context.Background(), r)
+		require.NoError(t, err, "container creation failed")
+	}
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod3", "other"))
+	require.NoError(t, err, "container creation failed")
+
+	fi, _ := s.coordinator.getInstance("ctr1")
+	atomic.StoreInt64(&fi.inFlight, 3)
+
+	hints := s.ScaleHints()
+	require.Len(t, hints, 2)
+	require.Equal(t, "img-00001", hints[0].Revision)
+	require.Equal(t, 2, hints[0].ActiveInstances)
+	require.EqualValues(t, 3, hints[0].Concurrency)
+	require.Equal(t, 5, hints[0].MinWarmPool)
+	require.Greater(t, hints[0].ArrivalRate, hints[1].ArrivalRate, "arrivals were not counted per revision")
+	require.Equal(t, "other-00001", hints[1].Revision)
+	require.Equal(t, 1, hints[1].ActiveInstances)
+	require.Zero(t, hints[1].MinWarmPool)
+
+	// A revision without instances is forgotten once its arrivals decayed
+	s.coordinator.Lock()
+	delete(s.coordinator.activeInstances, "ctr3")
+	s.coordinator.Unlock()
+	s.scaleHints.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	hints = s.ScaleHints()
+	require.Len(t, hints, 1, "idle revision was not forgotten")
+	require.Equal(t, "img-00001", hints[0].Revision)
+}
+
+func TestScaleHintsEndpoint(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 7*3+5, "expected a help, a type and a sample line per metric and one per admission mode")
+	require.Equal(t, "# HELP vhive_revision_active_instances VMs serving containers of the revision.", lines[0])
+	require.Equal(t, "# TYPE vhive_revision_active_instances gauge", lines[1])
+	require.Equal(t, `vhive_revision_active_instances{revision="img-00001"} 1`, lines[2])
+	require.Equal(t, `vhive_revision_concurrency{revision="img-00001"} 0`, lines[5])
+	require.Equal(t, `vhive_revision_min_warm_pool{revision="img-00001"} 0`, lines[17])
+	require.Equal(t, "vhive_memory_committed_mib 256", lines[20])
+	require.Equal(t, `vhive_admission_mode{mode="open"} 1`, lines[23])
+}
@@ -0,0 +1,273 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// maxScaleToZeroSweepInterval bounds how late an idle VM is offloaded
+	maxScaleToZeroSweepInterval = 10 * time.Second
+)
+
+// restoreLatencyBucketsMs are the upper bounds of the buckets of the
+// restore latency histogram
+var restoreLatencyBucketsMs = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// LatencyHistogram is a cumulative histogram of latencies
+type LatencyHistogram struct {
+	// BucketsMs are the upper bounds of the buckets, Counts[i] counting the
+	// observations up to BucketsMs[i] and the last count all of them
+	BucketsMs []float64 `json:"bucketsMs"`
+	Counts    []uint64  `json:"counts"`
+	Count     uint64    `json:"count"`
+	SumMs     float64   `json:"sumMs"`
+}
+
+func newLatencyHistogram(bucketsMs []float64) LatencyHistogram {
+	return LatencyHistogram{BucketsMs: bucketsMs, Counts: make([]uint64, len(bucketsMs)+1)}
+}
+
+func (h *LatencyHistogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+
+	for i, bound := range h.BucketsMs {
+		if ms <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Counts[len(h.BucketsMs)]++
+
+	h.Count++
+	h.SumMs += ms
+}
+
+// ScaleToZeroStats counts the VMs offloaded to snapshots and restored from them
+type ScaleToZeroStats struct {
+	// Offloads counts all the VMs offloaded, IdleOffloads the ones
+	// offloaded by scale-to-zero after their idle timeout
+	Offloads        uint64           `json:"offloads"`
+	IdleOffloads    uint64           `json:"idleOffloads"`
+	Restores        uint64           `json:"restores"`
+	RestoreFailures uint64           `json:"restoreFailures"`
+	RestoreLatency  LatencyHistogram `json:"restoreLatency"`
+	// VersionFallbacks counts the VMs booted instead of being restored from
+	// a snapshot taken by another firecracker release
+	VersionFallbacks uint64 `json:"versionFallbacks"`
+	// Corruptions counts the snapshot files and metadata pulled from the
+	// snapshot store and the working set files found corrupt, whose VMs
+	// were booted or restored from their full guest memory instead
+	Corruptions uint64 `json:"corruptions"`
+	// PrefetchedRestores and PrefetchedRestoreLatency are the part of the
+	// restores whose snapshot files were prefetched, the others being cold
+	PrefetchedRestores       uint64           `json:"prefetchedRestores"`
+	PrefetchedRestoreLatency LatencyHistogram `json:"prefetchedRestoreLatency"`
+	// PrefetchReads counts the snapshot files read by the prefetches and
+	// PrefetchCoalesced the prefetches served by another read of the file
+	PrefetchReads     uint64 `json:"prefetchReads"`
+	PrefetchCoalesced uint64 `json:"prefetchCoalesced"`
+	// PeerPulls counts the snapshot files pulled from the peer nodes holding
+	// them and PeerFallbacks the snapshots pulled from the snapshot store
+	// after their peer failed
+	PeerPulls     uint64 `json:"peerPulls"`
+	PeerFallbacks uint64 `json:"peerFallbacks"`
+	// WorkingSetPrefetchedPages counts the guest memory pages prefetched from
+	// the working sets recorded by REAP on restores, WorkingSetMissedPages
+	// those faulted outside of them, and WorkingSetHitRate the share of the
+	// pages of the restores served by the prefetches
+	WorkingSetPrefetchedPages uint64  `json:"workingSetPrefetchedPages"`
+	WorkingSetMissedPages     uint64  `json:"workingSetMissedPages"`
+	WorkingSetHitRate         float64 `json:"workingSetHitRate"`
+	// REAPRestoreLatency is the latency of the restores with REAP by mode,
+	// eager or lazy
+	REAPRestoreLatency map[string]LatencyHistogram `json:"reapRestoreLatency,omitempty"`
+}
+
+// snapshotStats accumulates the ScaleToZeroStats of the coordinator
+type snapshotStats struct {
+	sync.Mutex
+	stats ScaleToZeroStats
+}
+
+func newSnapshotStats() *snapshotStats {
+	return &snapshotStats{stats: ScaleToZeroStats{
+		RestoreLatency:           newLatencyHistogram(restoreLatencyBucketsMs),
+		PrefetchedRestoreLatency: newLatencyHistogram(restoreLatencyBucketsMs),
+	}}
+}
+
+func (s *snapshotStats) offloaded() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stats.Offloads++
+}
+
+func (s *snapshotStats) idleOffloaded() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stats.IdleOffloads++
+}
+
+func (s *snapshotStats) restored(d time.Duration, prefetched bool, reapMode string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err != nil {
+		s.stats.RestoreFailures++
+		return
+	}
+
+	s.stats.Restores++
+	s.stats.RestoreLatency.observe(d)
+	if prefetched {
+		s.stats.PrefetchedRestores++
+		s.stats.PrefetchedRestoreLatency.observe(d)
+	}
+	if reapMode != "" {
+		if s.stats.REAPRestoreLatency == nil {
+			s.stats.REAPRestoreLatency = make(map[string]LatencyHistogram)
+		}
+		h, ok := s.stats.REAPRestoreLatency[reapMode]
+		if !ok {
+			h = newLatencyHistogram(restoreLatencyBucketsMs)
+		}
+		h.observe(d)
+		s.stats.REAPRestoreLatency[reapMode] = h
+	}
+}
+
+func (s *snapshotStats) versionFallback() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stats.VersionFallbacks++
+}
+
+func (s *snapshotStats) corrupted() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stats.Corruptions++
+}
+
+func (s *snapshotStats) peerPulled(ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if ok {
+		s.stats.PeerPulls++
+	} else {
+		s.stats.PeerFallbacks++
+	}
+}
+
+func (s *snapshotStats) get() ScaleToZeroStats {
+	s.Lock()
+	defer s.Unlock()
+
+	stats := s.stats
+	stats.RestoreLatency.Counts = append([]uint64(nil), s.stats.RestoreLatency.Counts...)
+	stats.PrefetchedRestoreLatency.Counts = append([]uint64(nil), s.stats.PrefetchedRestoreLatency.Counts...)
+	if s.stats.REAPRestoreLatency != nil {
+		stats.REAPRestoreLatency = make(map[string]LatencyHistogram, len(s.stats.REAPRestoreLatency))
+		for mode, h := range s.stats.REAPRestoreLatency {
+			h.Counts = append([]uint64(nil), h.Counts...)
+			stats.REAPRestoreLatency[mode] = h
+		}
+	}
+
+	return stats
+}
+
+// startScaleToZero periodically offloads the VMs of the functions with
+// scale-to-zero enabled that were idle for longer than the timeout
+func (s *Service) startScaleToZero() {
+	if !s.coordinator.orch.GetSnapshotsEnabled() {
+		snapLog.Debug("scale-to-zero is disabled without snapshots")
+		return
+	}
+
+	interval := s.scaleToZeroTimeout / 2
+	if interval > maxScaleToZeroSweepInterval {
+		interval = maxScaleToZeroSweepInterval
+	}
+
+	s.runPeriodically(interval, s.scaleIdleToZero)
+}
+
+// scaleIdleToZero offloads the idle VMs, detaching them from their
+// containers, which fail the requests until kubelet replaces them
+func (s *Service) scaleIdleToZero() {
+	for _, containerID := range s.coordinator.offloadIdle(context.Background(), s.now(), s.scaleToZeroTimeout) {
+		if s.microVMs != nil {
+			s.microVMs.Release(containerID)
+		}
+	}
+}
+
+// offloadIdle offloads the active VMs with scale-to-zero enabled that have
+// not served requests for longer than the timeout, returning their containers.
+// A new VM of the same image waits for the offloads to restore the VM instead of booting one.
+func (c *coordinator) offloadIdle(ctx context.Context, now time.Time, timeout time.Duration) []string {
+	idle := make(map[string]*funcInstance)
+
+	c.Lock()
+	for containerID, fi := range c.activeInstances {
+		if fi.scaleToZero && !fi.isServing() && now.Sub(fi.getLastInvocation()) > timeout {
+			idle[containerID] = fi
+			delete(c.activeInstances, containerID)
+			c.offloading[fi.image]++
+		}
+	}
+	c.Unlock()
+
+	containerIDs := make([]string, 0, len(idle))
+
+	for containerID, fi := range idle {
+		logger := fi.logger.WithField("containerID", containerID)
+		logger.WithField("idle", now.Sub(fi.getLastInvocation())).Info("scaling idle VM to zero")
+
+		err := c.releaseVM(ctx, fi)
+
+		c.Lock()
+		c.offloading[fi.image]--
+		close(c.offloaded)
+		c.offloaded = make(chan struct{})
+		c.Unlock()
+
+		if err != nil {
+			logger.WithError(err).Error("failed to offload idle VM")
+			continue
+		}
+
+		c.snapStats.idleOffloaded()
+		containerIDs = append(containerIDs, containerID)
+	}
+
+	return containerIDs
+}
@@ -0,0 +1,217 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestScaleIdleToZero(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.scaleToZeroTimeout = time.Minute
+	c := s.coordinator
+	ctx := context.Background()
+
+	instances := make(map[string]*funcInstance)
+	for _, containerID := range []string{"idle", "serving", "opted-out"} {
+		fi, err := c.startVM(ctx, "img")
+		require.NoError(t, err, "could not start VM")
+
+		fi.scaleToZero = containerID != "opted-out"
+		require.NoError(t, c.insertActive("pod", containerID, fi))
+		instances[containerID] = fi
+	}
+
+	done, ok := c.trackInvocation("serving")
+	require.True(t, ok)
+	defer done()
+
+	// Not idle for long enough yet
+	s.scaleIdleToZero()
+	require.Len(t, c.ListActive(), 3, "VM was offloaded before its idle timeout")
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	s.scaleIdleToZero()
+
+	require.False(t, c.isActive("idle"), "idle VM was not offloaded")
+	require.True(t, c.isActive("serving"), "VM serving a request was offloaded")
+	require.True(t, c.isActive("opted-out"), "VM without scale-to-zero was offloaded")
+
+	stats := s.ScaleToZeroStats()
+	require.EqualValues(t, 1, stats.Offloads)
+	require.EqualValues(t, 1, stats.IdleOffloads)
+	require.Zero(t, stats.Restores)
+
+	// The next VM of the function is restored from the snapshot
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not restore VM")
+	require.Equal(t, instances["idle"].vmID, fi.vmID, "VM was not restored")
+	require.Equal(t, 3, orch.NumStarted(), "new VM was booted")
+
+	stats = s.ScaleToZeroStats()
+	require.EqualValues(t, 1, stats.Restores)
+	require.EqualValues(t, 1, stats.RestoreLatency.Count)
+	require.EqualValues(t, 1, stats.RestoreLatency.Counts[len(stats.RestoreLatency.Counts)-1])
+	require.Zero(t, stats.Corruptions)
+
+	// The corrupt working set files are counted by the memory manager
+	orch.WorkingSetCorruptions = 2
+	require.EqualValues(t, 2, s.ScaleToZeroStats().Corruptions)
+
+	// So are the pages prefetched and missed by REAP
+	require.Zero(t, stats.WorkingSetHitRate, "hit rate without prefetches")
+	orch.PrefetchedPages, orch.MissedPages = 90, 10
+	stats = s.ScaleToZeroStats()
+	require.EqualValues(t, 90, stats.WorkingSetPrefetchedPages)
+	require.EqualValues(t, 10, stats.WorkingSetMissedPages)
+	require.InDelta(t, 0.9, stats.WorkingSetHitRate, 1e-9)
+}
+
+func TestRestoreWaitsForOffload(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	c := newCoordinator(orch)
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "could not start VM")
+
+	// The VM is being scaled to zero
+	c.Lock()
+	c.offloading["img"]++
+	c.Unlock()
+
+	restored := make(chan *funcInstance)
+	go func() {
+		fi, err := c.startVM(ctx, "img")
+		require.NoError(t, err, "could not restore VM")
+		restored <- fi
+	}()
+
+	select {
+	case <-restored:
+		t.Fatal("new VM did not wait for the offload")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.setIdleInstance(fi)
+	c.Lock()
+	c.offloading["img"]--
+	close(c.offloaded)
+	c.offloaded = make(chan struct{})
+	c.Unlock()
+
+	select {
+	case got := <-restored:
+		require.Equal(t, fi.vmID, got.vmID, "offloaded VM was not restored")
+	case <-time.After(10 * time.Second):
+		t.Fatal("new VM is still waiting for the offload")
+	}
+	require.Equal(t, 1, orch.NumStarted(), "new VM was booted")
+}
+
+func TestRestoreWaitForOffloadCancelled(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	c := newCoordinator(orch)
+
+	// A VM of the image is being scaled to zero and never completes
+	c.Lock()
+	c.offloading["img"]++
+	c.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := c.startVM(ctx, "img")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.Equal(t, context.DeadlineExceeded, err, "wrong error past the deadline")
+	case <-time.After(10 * time.Second):
+		t.Fatal("new VM is still waiting for the offload past the deadline")
+	}
+	require.Zero(t, orch.NumStarted(), "new VM was booted")
+}
+
+func TestCreateUserContainerScaleToZero(t *testing.T) {
+	cases := []struct {
+		name        string
+		value       string
+		expectErr   bool
+		expectScale bool
+	}{
+		{name: "Unset"},
+		{name: "Enabled", value: "true", expectScale: true},
+		{name: "Disabled", value: "false"},
+		{name: "Invalid", value: "soon", expectErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			r := newUserContainerRequest("pod", "img")
+			if c.value != "" {
+				r.Config.Envs = append(r.Config.Envs, &criapi.KeyValue{Key: scaleToZeroEnv, Value: c.value})
+			}
+
+			resp, err := s.CreateContainer(context.Background(), r)
+			if c.expectErr {
+				require.Error(t, err, "container creation did not fail")
+				require.Zero(t, orch.NumStarted(), "VM was started")
+				return
+			}
+
+			require.NoError(t, err, "container creation failed")
+			fi, ok := s.coordinator.getInstance(resp.ContainerId)
+			require.True(t, ok, "VM is not active")
+			require.Equal(t, c.expectScale, fi.scaleToZero)
+		})
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram([]float64{10, 100})
+
+	for _, d := range []time.Duration{5 * time.Millisecond, 50 * time.Millisecond, time.Second} {
+		h.observe(d)
+	}
+
+	require.Equal(t, []uint64{1, 2, 3}, h.Counts, "wrong cumulative counts")
+	require.EqualValues(t, 3, h.Count)
+	require.InDelta(t, 1055, h.SumMs, 0.001)
+}
@@ -24,12 +24,18 @@ package cri
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
+	"io/ioutil"
 	"net"
+	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/ease-lab/vhive/ctriface"
+	peerpb "github.com/ease-lab/vhive/cri/proto"
+	"github.com/ease-lab/vhive/deviceplugin"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
@@ -43,60 +49,628 @@ const (
 	maxMsgSize = 1024 * 1024 * 16
 )
 
+// The loggers of the components of the CRI service, whose levels are set
+// independently, see Config.LogLevels
+var (
+	// criLog logs the CRI requests passed through to the stock containerd
+	criLog = logging.Logger(logging.CRI)
+	// coordLog logs the lifecycle of the VMs of the functions
+	coordLog = logging.Logger(logging.Coordinator)
+	// snapLog logs the creation, the store and the prefetch of the VM snapshots
+	snapLog = logging.Logger(logging.Snapshots)
+)
+
 // Service contains essential objects for host orchestration.
 type Service struct {
 	sync.Mutex
 
+	// admission is the AdmissionMode of the node, see SetAdmission
+	admission int32
+	// admissionMu serializes the changes of the admission mode with its state file
+	admissionMu sync.Mutex
+
 	criapi.ImageServiceServer
 	criapi.RuntimeServiceServer
-	orch               *ctriface.Orchestrator
-	stockRuntimeClient criapi.RuntimeServiceClient
-	stockImageClient   criapi.ImageServiceClient
+	orch               Orchestrator
+	stockRuntimeClient StockRuntimeClient
+	stockImageClient   StockImageClient
 	coordinator        *coordinator
 
 	// to store mapping from pod to guest image and port temporarily
 	podVMConfigs map[string]*VMConfig
+	// podVMSignals wake the queue-proxies created before the VM of their pod
+	podVMSignals map[string]*podVMSignal
+
+	// projectionDir is where the projection images are created,
+	// the default temporary directory if empty
+	projectionDir string
+
+	// to store the downward-API metadata of the pods
+	podMetadata    map[string]*podMetadata
+	metadataFilter *metadataFilter
+
+	// healthCheckInterval is how often the guest agents of the VMs are
+	// health-checked, 0 if disabled
+	healthCheckInterval time.Duration
+
+	// microVMReservationMib is the memory reserved per microVM slot advertised
+	// to kubelet, 0 if the slots are not advertised
+	microVMReservationMib uint64
+	devicePluginDir       string
+	microVMs              *deviceplugin.Allocator
+	devicePlugin          *deviceplugin.Plugin
+
+	// podVMConfigTTL is how long the VM config of a pod waits for its
+	// queue-proxy before being evicted with its VM, 0 if forever
+	podVMConfigTTL time.Duration
+	now            func() time.Time
+
+	// stop and background control the background tasks of the service
+	stop       chan struct{}
+	background sync.WaitGroup
+
+	// kernelAllowList is the set of guest kernels the user containers may select
+	kernelAllowList map[string]bool
+	// writableVirtiofs allows the user containers to share host directories writable
+	writableVirtiofs bool
+
+	// scaleToZeroTimeout is how long the VMs of the functions with
+	// SCALE_TO_ZERO stay idle before being offloaded, 0 if disabled
+	scaleToZeroTimeout time.Duration
+
+	// eventRecorder publishes the events of the instances on their pods, if any
+	eventRecorder EventRecorder
+
+	// creates deduplicates the retries of the creation of user containers
+	creates *createCache
+	// createLimiter paces the creation of the user containers of each revision,
+	// nil if disabled
+	createLimiter *createLimiter
+	// bootLimiter bounds the VMs booting at once on the node, nil if disabled
+	bootLimiter *bootLimiter
+	// imageDigests pins the function images to digests, nil if disabled
+	imageDigests *imageDigests
+	// firecrackerVersions are the firecracker releases the revisions may
+	// select, nil if not configured
+	firecrackerVersions *firecrackerVersions
+	// scaleHints aggregates the load of the revisions for the autoscaler
+	scaleHints *scaleHints
+	// health runs the liveness and readiness probes of the daemon
+	health *daemonHealth
+	// sandboxes are the sandbox backends enabled on the node besides Firecracker
+	sandboxes map[string]sandboxBackend
+	// vmIDStatePath is the state file of the counter of the vmIDs, empty if
+	// the vmIDs restart from 1 with the daemon
+	vmIDStatePath string
+	// admissionStatePath is the state file of the admission mode, empty if
+	// the node is open when the daemon starts
+	admissionStatePath string
+}
+
+// ServiceOption configures the CRI service
+type ServiceOption func(*Service)
+
+// WithGuestAgent enables the control channel to the guest agent
+// listening on the given vsock port inside each VM
+func WithGuestAgent(port uint32) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.guestAgentPort = port
+	}
+}
+
+// WithExtraDisks sets the directory of the extra disks requested by the
+// user containers and whether they are deleted or retained with their VMs
+func WithExtraDisks(dir string, policy DiskCleanupPolicy) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.disks = newDiskManager(dir, policy)
+	}
+}
+
+// WithEviction enables evicting the least-recently-used VM without requests
+// in flight when a new VM cannot be started for lack of host memory
+func WithEviction(enabled bool) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.evictionEnabled = enabled
+	}
+}
+
+// TrackInvocation marks the start of a request to the VM of the container,
+// for the eviction of the least-recently-used VMs. The returned function
+// marks the end of the request and must be called once it is served.
+func (s *Service) TrackInvocation(containerID string) func() {
+	if done, ok := s.coordinator.trackInvocation(containerID); ok {
+		return done
+	}
+
+	return func() {}
+}
+
+// AdmitInvocation marks the start of a request to the VM of the container like
+// TrackInvocation, but rejects the request with ErrInstanceDraining once the
+// container is stopping, so that the request is sent to another instance.
+// The returned function marks the end of the request.
+func (s *Service) AdmitInvocation(containerID string) (func(), error) {
+	done, err := s.coordinator.admitInvocation(containerID)
+	if err == errNoInstance {
+		return func() {}, nil
+	}
+
+	return done, err
+}
+
+// WithMemoryCommitRatio rejects the user containers whose VM would bring the
+// guest memory committed on the node above the given fraction of its memory,
+// 0 disables admission
+func WithMemoryCommitRatio(ratio float64) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.mem.ratio = ratio
+	}
+}
+
+// MemoryStats returns the guest memory committed on the node, for publishing
+// it to the scheduler
+func (s *Service) MemoryStats() MemoryStats {
+	return s.coordinator.mem.stats()
+}
+
+// CountByRevision returns the number of active VMs of each revision
+func (s *Service) CountByRevision() map[string]int {
+	return s.coordinator.CountByRevision()
+}
+
+// PreparedTapStats returns the hits and misses of the taps created ahead of the VMs
+func (s *Service) PreparedTapStats() taps.PreparedTapStats {
+	orch, ok := s.orch.(interface{ PreparedTapStats() taps.PreparedTapStats })
+	if !ok {
+		return taps.PreparedTapStats{}
+	}
+
+	return orch.PreparedTapStats()
+}
+
+// WithHealthCheck health-checks the guest agents of the active VMs every
+// interval and marks the VMs failing consecutive checks unhealthy, 0 disables it
+func WithHealthCheck(interval time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.healthCheckInterval = interval
+	}
+}
+
+// WithMicroVMResource advertises to kubelet as many vhive.io/microvms slots as
+// VMs with the given memory reservation fit in the node, through the device
+// plugin sockets in dir. A reservation of 0 disables it.
+func WithMicroVMResource(reservationMib uint64, dir string) ServiceOption {
+	return func(s *Service) {
+		s.microVMReservationMib = reservationMib
+		s.devicePluginDir = dir
+	}
+}
+
+// WithPodVMConfigTTL evicts the VM config of a pod whose queue-proxy is not
+// created within the TTL, stopping its VM, 0 disables it
+func WithPodVMConfigTTL(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.podVMConfigTTL = ttl
+	}
+}
+
+// WithMetadataAllowList sets the pod labels and annotations that are exposed to
+// the guests by MMDS. An entry ending with "*" allows all keys with the preceding prefix.
+func WithMetadataAllowList(labels, annotations []string) ServiceOption {
+	return func(s *Service) {
+		s.metadataFilter = &metadataFilter{labels: labels, annotations: annotations}
+	}
+}
+
+// WithKernelAllowList sets the host paths of the guest kernels that the user
+// containers may select instead of the default kernel
+func WithKernelAllowList(paths []string) ServiceOption {
+	return func(s *Service) {
+		s.kernelAllowList = make(map[string]bool, len(paths))
+		for _, path := range paths {
+			s.kernelAllowList[filepath.Clean(path)] = true
+		}
+	}
+}
+
+// WithWritableVirtiofsMounts allows the user containers to share host
+// directories writable with their VM, only read-only ones otherwise
+func WithWritableVirtiofsMounts(allow bool) ServiceOption {
+	return func(s *Service) {
+		s.writableVirtiofs = allow
+	}
+}
+
+// WithScaleToZero offloads the VMs of the functions with SCALE_TO_ZERO once
+// they are idle for the given timeout, restoring them from their snapshot
+// for the next container of the function. It requires snapshots, 0 disables it.
+func WithScaleToZero(idleTimeout time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.scaleToZeroTimeout = idleTimeout
+	}
+}
+
+// WithSnapshotPrefetch reads the snapshot files of the VMs into the page cache
+// before they are restored, once for the restores of a snapshot requested
+// within the given window. 0 disables it.
+func WithSnapshotPrefetch(window time.Duration) ServiceOption {
+	return func(s *Service) {
+		if window > 0 {
+			s.coordinator.prefetcher = newSnapshotPrefetcher(window)
+		}
+	}
+}
+
+// WithConnectionProxy lets the user containers with the vhive.io/connection-proxy
+// annotation route the traffic of their queue-proxy to their VM through a proxy
+// listening on the given host address, e.g., the node IP, which counts the
+// connections to the VM. An empty address disables it.
+func WithConnectionProxy(listenIP string) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.connProxyIP = listenIP
+	}
+}
+
+// WithSlotReuse pauses the VM of a removed user container and parks it for up
+// to ttl, for the next user container of the same revision with the same
+// resources to adopt instead of booting a VM. At most size VMs are parked
+// per revision, 0 disables it.
+func WithSlotReuse(size int, ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		if size > 0 && ttl > 0 {
+			s.coordinator.parking = newVMParking(size, ttl)
+		} else {
+			s.coordinator.parking = nil
+		}
+	}
+}
+
+// SlotReuseStats returns the counts of the VMs parked and adopted,
+// zero if slot reuse is disabled
+func (s *Service) SlotReuseStats() SlotReuseStats {
+	if s.coordinator.parking == nil {
+		return SlotReuseStats{}
+	}
+
+	return s.coordinator.parking.getStats()
+}
+
+// ScaleToZeroStats returns the counts of the VMs offloaded and restored
+// and the latency of the restores
+func (s *Service) ScaleToZeroStats() ScaleToZeroStats {
+	stats := s.coordinator.snapStats.get()
+	if s.coordinator.orch != nil {
+		stats.Corruptions += s.coordinator.orch.GetWorkingSetCorruptions()
+		stats.WorkingSetPrefetchedPages, stats.WorkingSetMissedPages = s.coordinator.orch.GetWorkingSetPrefetches()
+		if total := stats.WorkingSetPrefetchedPages + stats.WorkingSetMissedPages; total > 0 {
+			stats.WorkingSetHitRate = float64(stats.WorkingSetPrefetchedPages) / float64(total)
+		}
+	}
+	if s.coordinator.prefetcher != nil {
+		stats.PrefetchReads, stats.PrefetchCoalesced = s.coordinator.prefetcher.counts()
+	}
+
+	return stats
+}
+
+// StartFailureStats returns the counts of the VMs that failed to start
+// by the phase that failed
+func (s *Service) StartFailureStats() StartFailureStats {
+	return s.coordinator.startFailures.get()
+}
+
+// WithEventRecorder publishes the lifecycle events of the function
+// instances as Kubernetes events on their pods
+func WithEventRecorder(recorder EventRecorder) ServiceOption {
+	return func(s *Service) {
+		s.eventRecorder = recorder
+	}
+}
+
+// WithCreateRateLimit paces the creation of the user containers of each revision
+// to rate per second, in bursts of up to burst containers. Up to maxQueue
+// containers in excess of the rate wait for their turn and the others are
+// rejected with ResourceExhausted, so that kubelet backs off. A rate of 0 disables it.
+func WithCreateRateLimit(rate float64, burst, maxQueue int) ServiceOption {
+	return func(s *Service) {
+		if rate <= 0 {
+			s.createLimiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		s.createLimiter = newCreateLimiter(rate, burst, maxQueue)
+	}
+}
+
+// WithAuditLog records the lifecycle operations on the VMs in the audit log
+func WithAuditLog(audit *AuditLog) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.audit = audit
+	}
+}
+
+// WithBootLatencyLog records the breakdown of the cold start of each VM
+// in the boot latency log
+func WithBootLatencyLog(l *BootLatencyLog) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.bootLatency = l
+	}
+}
+
+// WithStockClients serves the queue-proxies and the placeholders of the user
+// containers with the given stock runtime and image clients instead of dialing
+// the stock containerd, e.g., to test the service without containerd. The
+// other requests are only passed through to clients implementing the whole
+// CRI services.
+func WithStockClients(runtime StockRuntimeClient, image StockImageClient) ServiceOption {
+	return func(s *Service) {
+		s.stockRuntimeClient = runtime
+		s.stockImageClient = image
+	}
+}
+
+// WithSnapshotStore pushes the snapshots of the VMs to store, from which
+// the snapshot files missing on the node are pulled when restoring a VM
+func WithSnapshotStore(store SnapshotStore) ServiceOption {
+	return func(s *Service) {
+		s.coordinator.snapStore = store
+	}
+}
+
+// WithSnapshotPeers serves the snapshots of the VMs to the other nodes with
+// RegisterSnapshotPeer, announcing them in the snapshot store under addr, the
+// address the other nodes reach the peer service on. The snapshot files missing
+// on the node are pulled from the peer holding them before the snapshot store.
+// The files are served at up to bytesPerSec, unlimited if 0. The other nodes
+// are reached over TLS with tlsConfig, e.g., of NewPeerTLS, or in plaintext if
+// nil. An empty addr disables it.
+func WithSnapshotPeers(addr string, bytesPerSec int64, tlsConfig *tls.Config) ServiceOption {
+	return func(s *Service) {
+		if addr == "" {
+			s.coordinator.snapPeer = nil
+			return
+		}
+		s.coordinator.snapPeer = newSnapshotPeer(addr, bytesPerSec, tlsConfig)
+	}
+}
+
+// RegisterSnapshotPeer registers the snapshot peer service on the given gRPC
+// server, on which the other nodes pull the snapshot files of the node
+func (s *Service) RegisterSnapshotPeer(server *grpc.Server) {
+	if s.coordinator.snapPeer != nil {
+		peerpb.RegisterSnapshotPeerServer(server, s.coordinator.snapPeer)
+	}
+}
+
+// WithBootLimit bounds the VMs booted or restored at once for user containers
+// to maxInFlight. Up to maxQueue boots in excess wait up to queueTimeout for
+// their turn and the others are rejected with ResourceExhausted, so that kubelet
+// backs off. The other containers are not limited. A maxInFlight of 0 disables it.
+func WithBootLimit(maxInFlight, maxQueue int, queueTimeout time.Duration) ServiceOption {
+	return func(s *Service) {
+		if maxInFlight <= 0 {
+			s.bootLimiter = nil
+			return
+		}
+		if maxQueue < 0 {
+			maxQueue = 0
+		}
+		s.bootLimiter = newBootLimiter(maxInFlight, maxQueue, queueTimeout)
+	}
 }
 
-// VMConfig wraps the IP and port of the guest VM
-type VMConfig struct {
-	guestIP   string
-	guestPort string
+// WithFirecrackerVersions lets the revisions select the firecracker release
+// running their VMs with GUEST_FC_VERSION among binaries, which maps the
+// releases to their binaries. The VMs of the other revisions run
+// defaultVersion, the newest release if empty, see ParseFirecrackerVersions.
+// The VMs are only restored from the snapshots taken by their release.
+func WithFirecrackerVersions(binaries map[string]string, defaultVersion string) ServiceOption {
+	return func(s *Service) {
+		if len(binaries) == 0 {
+			s.firecrackerVersions = nil
+			return
+		}
+		versions := &firecrackerVersions{binaries: binaries, defaultVersion: defaultVersion}
+		if defaultVersion == "" {
+			versions.defaultVersion = newestFirecrackerVersion(versions.available())
+		}
+		s.firecrackerVersions = versions
+	}
+}
+
+// WithImageDigests pins the image of each user container to the digest its
+// tag references when the container is created, resolved with resolver and
+// cached for ttl, so that the VMs and snapshots of an image are not reused
+// once its tag moves. A nil resolver or a non-positive ttl disables it.
+func WithImageDigests(resolver ImageResolver, ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		if resolver == nil || ttl <= 0 {
+			s.imageDigests = nil
+			return
+		}
+		s.imageDigests = newImageDigests(resolver, ttl)
+	}
+}
+
+// BootLimitStats returns the VM boots in flight and queued,
+// zero if the boots are not limited
+func (s *Service) BootLimitStats() BootLimitStats {
+	if s.bootLimiter == nil {
+		return BootLimitStats{}
+	}
+
+	return s.bootLimiter.getStats()
+}
+
+// CreateThrottleStats returns the counts of the creations of user containers
+// delayed or rejected by the rate limit, by revision
+func (s *Service) CreateThrottleStats() map[string]RevisionThrottleStats {
+	if s.createLimiter == nil {
+		return map[string]RevisionThrottleStats{}
+	}
+
+	return s.createLimiter.getStats()
 }
 
-// NewService initializes the host orchestration state.
-func NewService(orch *ctriface.Orchestrator) (*Service, error) {
+// NewService initializes the host orchestration state with the orchestrator
+// of the VMs, e.g., a ctriface.Orchestrator.
+func NewService(orch Orchestrator, opts ...ServiceOption) (*Service, error) {
 	if orch == nil {
 		return nil, errors.New("orch must be non nil")
 	}
 
-	stockRuntimeClient, err := newStockRuntimeServiceClient()
-	if err != nil {
-		log.WithError(err).Error("failed to create new stock runtime service client")
-		return nil, err
+	return newService(orch, opts...)
+}
+
+// NewMockService initializes the host orchestration state with the mock
+// backend, whose VMs are in-process stand-ins of the guests, to develop and
+// test vHive without KVM. The latencies of the VM operations are the
+// MockLatencies of the config, and the snapshots are empty files.
+func NewMockService(snapshotsEnabled bool, opts ...ServiceOption) (*Service, error) {
+	var snapshotDir string
+	if snapshotsEnabled {
+		var err error
+		if snapshotDir, err = ioutil.TempDir("", "vhive-mock-snapshots"); err != nil {
+			return nil, errors.Wrap(err, "failed to create the snapshot directory of the mock backend")
+		}
 	}
 
-	stockImageClient, err := newStockImageServiceClient()
+	mock := newMockOrchestrator(snapshotsEnabled, snapshotDir)
+	s, err := newService(mock, opts...)
 	if err != nil {
-		log.WithError(err).Error("failed to create new stock image service client")
 		return nil, err
 	}
+	mock.config = s.coordinator.config
 
+	return s, nil
+}
+
+// newService initializes the host orchestration state with the backend of the VMs
+func newService(orch Orchestrator, opts ...ServiceOption) (*Service, error) {
 	cs := &Service{
-		orch:               orch,
-		stockRuntimeClient: stockRuntimeClient,
-		stockImageClient:   stockImageClient,
-		coordinator:        newCoordinator(orch),
-		podVMConfigs:       make(map[string]*VMConfig),
+		orch:           orch,
+		coordinator:    newCoordinator(orch),
+		podVMConfigs:   make(map[string]*VMConfig),
+		podVMSignals:   make(map[string]*podVMSignal),
+		podMetadata:    make(map[string]*podMetadata),
+		metadataFilter: &metadataFilter{labels: defaultMetadataLabels},
+		podVMConfigTTL: defaultPodVMConfigTTL,
+		now:            time.Now,
+		stop:           make(chan struct{}),
+		creates:        newCreateCache(createCacheTTL),
+		scaleHints:     newScaleHints(),
+		health:         newDaemonHealth(),
+	}
+
+	for _, opt := range opts {
+		opt(cs)
+	}
+
+	// The stock containerd is only dialed for the clients that were not injected
+	var err error
+	if cs.stockRuntimeClient == nil {
+		if cs.stockRuntimeClient, err = newStockRuntimeServiceClient(); err != nil {
+			criLog.WithError(err).Error("failed to create new stock runtime service client")
+			return nil, err
+		}
+	}
+
+	if cs.stockImageClient == nil {
+		if cs.stockImageClient, err = newStockImageServiceClient(); err != nil {
+			criLog.WithError(err).Error("failed to create new stock image service client")
+			return nil, err
+		}
+	}
+
+	if err := cs.Config().Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	if cs.vmIDStatePath != "" {
+		if cs.coordinator.vmIDs, err = newVMIDAllocator(cs.vmIDStatePath); err != nil {
+			return nil, err
+		}
+	}
+	if cs.admissionStatePath != "" {
+		mode, err := loadAdmission(cs.admissionStatePath)
+		if err != nil {
+			return nil, err
+		}
+		if mode != AdmissionOpen {
+			criLog.WithField("mode", mode).Warn("restored the admission mode, the node does not accept all the containers")
+		}
+		cs.admission = int32(mode)
+	}
+	applyLogLevels(cs.Config())
+
+	if cs.coordinator.mem.totalMib, err = readHostMemTotal(hostMeminfoPath); err != nil {
+		criLog.WithError(err).Warn("failed to read the host memory, memory admission is disabled")
+	}
+
+	if cs.healthCheckInterval > 0 {
+		cs.coordinator.startHealthChecker(cs.healthCheckInterval)
+	}
+
+	if cs.microVMReservationMib > 0 {
+		cs.startMicroVMResource()
+	}
+
+	if cs.podVMConfigTTL > 0 {
+		cs.startPodVMConfigSweeper()
+	}
+
+	if cs.scaleToZeroTimeout > 0 {
+		cs.startScaleToZero()
+	}
+
+	if cs.coordinator.parking != nil {
+		cs.startSlotReuseSweeper()
 	}
 
 	return cs, nil
 }
 
-// Register registers the criapi servers.
+// Shutdown stops the background tasks of the service
+func (s *Service) Shutdown() {
+	s.coordinator.stopHealthChecker()
+
+	close(s.stop)
+	s.background.Wait()
+
+	if s.devicePlugin != nil {
+		s.devicePlugin.Stop()
+	}
+}
+
+// runPeriodically calls fn every interval in the background until Shutdown
+func (s *Service) runPeriodically(interval time.Duration, fn func()) {
+	s.background.Add(1)
+
+	go func() {
+		defer s.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// Register registers the image and runtime services of both the v1alpha2 and
+// the v1 CRI APIs, so that the kubelets of all the Kubernetes versions are served
 func (s *Service) Register(server *grpc.Server) {
 	criapi.RegisterImageServiceServer(server, s)
 	criapi.RegisterRuntimeServiceServer(server, s)
+	s.registerV1(server)
 }
 
 func newStockImageServiceClient() (criapi.ImageServiceClient, error) {
@@ -135,28 +709,66 @@ func getDialOpts() []grpc.DialOption {
 	}
 }
 
-func (s *Service) insertPodVMConfig(podID string, vmConfig *VMConfig) {
+// insertPodVMConfig stores the VM config of the pod for its queue-proxy,
+// rejecting invalid configs, and wakes the queue-proxy if it is waiting.
+// The VM of a config left behind by a previous user container of the pod,
+// e.g. one whose creation was retried, is stopped so that it does not leak.
+func (s *Service) insertPodVMConfig(podID string, vmConfig *VMConfig) error {
+	if err := vmConfig.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid VM config for pod %s", podID)
+	}
+
 	s.Lock()
-	defer s.Unlock()
+	stale, ok := s.podVMConfigs[podID]
+	var staleContainerID string
+	if ok {
+		staleContainerID = stale.containerID
+	}
 
+	vmConfig.created = s.now()
 	s.podVMConfigs[podID] = vmConfig
+	s.signalPodVMLocked(podID, nil)
+	s.Unlock()
+
+	if ok {
+		logger := criLog.WithFields(log.Fields{
+			"podID":       podID,
+			"containerID": staleContainerID,
+			"guest":       stale.String(),
+		})
+		logger.Warn("replacing VM config of a previous user container of the pod")
+		s.stopPodVM(logger, staleContainerID)
+	}
+
+	return nil
 }
 
-func (s *Service) removePodVMConfig(podID string) {
+// failPodVMConfig wakes the queue-proxy waiting for the VM of the pod
+// with the error that failed the creation of its user container
+func (s *Service) failPodVMConfig(podID string, err error) {
 	s.Lock()
 	defer s.Unlock()
 
-	delete(s.podVMConfigs, podID)
+	s.signalPodVMLocked(podID, errors.Wrapf(err, "VM of pod %s failed to start", podID))
 }
 
-func (s *Service) getPodVMConfig(podID string) (*VMConfig, error) {
+// removePodVMConfig forgets the VM config of the pod and its signal,
+// doing nothing if they were already removed
+func (s *Service) removePodVMConfig(podID string) {
 	s.Lock()
 	defer s.Unlock()
 
-	vmConfig, isPresent := s.podVMConfigs[podID]
-	if !isPresent {
-		log.Errorf("VM config for pod %s does not exist", podID)
-		return nil, errors.New("VM config for pod does not exist")
+	delete(s.podVMConfigs, podID)
+	delete(s.podVMSignals, podID)
+}
+
+// getPodVMConfig returns the VM config of the pod, waiting for the creation of
+// its user container if the queue-proxy is created first
+func (s *Service) getPodVMConfig(ctx context.Context, podID string) (*VMConfig, error) {
+	vmConfig, err := s.waitPodVMSignal(ctx, podID, s.coordinator.config.get().VMConfigWaitTimeout)
+	if err != nil {
+		criLog.WithError(err).Errorf("VM config for pod %s does not exist", podID)
+		return nil, err
 	}
 
 	return vmConfig, nil
@@ -0,0 +1,434 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+)
+
+const (
+	// maxSlotReuseSweepInterval bounds how late an expired parked VM is released
+	maxSlotReuseSweepInterval = 10 * time.Second
+)
+
+// SlotReuseStats counts the VMs parked on the removal of their container
+// and adopted by the next container of the same revision
+type SlotReuseStats struct {
+	// Parked is the number of VMs currently parked
+	Parked int `json:"parked"`
+	// Adoptions counts the containers that adopted a parked VM instead of
+	// booting one, Mismatches the ones that booted one because the parked
+	// VMs of their revision did not have the same resources
+	Adoptions   uint64 `json:"adoptions"`
+	Mismatches  uint64 `json:"mismatches"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// vmShape is what a VM keeps from its boot options when it is restored from
+// its snapshot or adopted, which must match those of the VM it stands in for
+type vmShape struct {
+	vcpuCount  uint32
+	memSizeMib uint32
+	hugepages  bool
+	kernel     string
+	// netRateLimit and ioRateLimit are the rate limits of the network and
+	// the drives of the VM set at boot
+	netRateLimit ctriface.NetRateLimit
+	ioRateLimit  ctriface.IORateLimit
+	// firecracker is the firecracker binary running the VM
+	firecracker string
+	// rootfsDigest is the digest the rootfs was verified against at boot
+	rootfsDigest string
+	// egressPolicy is the egress policy bound to the tap of the VM
+	egressPolicy string
+	// guestSwapMib is the size of the swap file provisioned in the rootfs at boot
+	guestSwapMib uint32
+}
+
+func newVMShape(opts *ctriface.StartVMOptions) vmShape {
+	return vmShape{
+		vcpuCount:    opts.VcpuCount,
+		memSizeMib:   opts.MemSizeMib,
+		hugepages:    opts.Hugepages,
+		kernel:       opts.KernelImagePath,
+		firecracker:  opts.FirecrackerBinary,
+		rootfsDigest: opts.RootfsDigest,
+		netRateLimit: opts.NetRateLimit,
+		ioRateLimit:  opts.IORateLimit,
+		egressPolicy: opts.EgressPolicy.String(),
+		guestSwapMib: opts.GuestSwapMib,
+	}
+}
+
+// slotKey identifies the VMs that the containers of a revision may adopt
+// from each other, the ones booted with the same image and resources
+type slotKey struct {
+	revision  string
+	image     string
+	guestPort string
+	vmShape
+}
+
+func newSlotKey(revision, image, guestPort string, opts *ctriface.StartVMOptions) slotKey {
+	return slotKey{
+		revision:  revision,
+		image:     image,
+		guestPort: guestPort,
+		vmShape:   newVMShape(opts),
+	}
+}
+
+// parkedVM is the paused VM of a removed container
+type parkedVM struct {
+	fi       *funcInstance
+	key      slotKey
+	parkedAt time.Time
+}
+
+// vmParking keeps up to size paused VMs per revision for ttl. The parked VMs
+// stay committed to the memory accountant: without a balloon device their
+// guest memory is not given back to the host while they are paused. They
+// only do not count toward the memory budget of the VMs until adopted.
+type vmParking struct {
+	sync.Mutex
+
+	size   int
+	ttl    time.Duration
+	parked map[string][]*parkedVM
+	stats  SlotReuseStats
+}
+
+func newVMParking(size int, ttl time.Duration) *vmParking {
+	return &vmParking{
+		size:   size,
+		ttl:    ttl,
+		parked: make(map[string][]*parkedVM),
+	}
+}
+
+// full returns true if no more VMs of the revision may be parked
+func (p *vmParking) full(revision string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return len(p.parked[revision]) >= p.size
+}
+
+// park adds a paused VM to the parking, returning false if it is full
+func (p *vmParking) park(fi *funcInstance, key slotKey, now time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.parked[key.revision]) >= p.size {
+		return false
+	}
+
+	p.parked[key.revision] = append(p.parked[key.revision], &parkedVM{fi: fi, key: key, parkedAt: now})
+	p.stats.Parked++
+
+	return true
+}
+
+// take removes the most recently parked VM with the given key, returning
+// nil if the revision has none
+func (p *vmParking) take(key slotKey) *funcInstance {
+	p.Lock()
+	defer p.Unlock()
+
+	parked := p.parked[key.revision]
+	for i := len(parked) - 1; i >= 0; i-- {
+		if parked[i].key != key {
+			continue
+		}
+
+		fi := parked[i].fi
+		p.remove(key.revision, i)
+		p.stats.Adoptions++
+
+		return fi
+	}
+
+	if len(parked) > 0 {
+		p.stats.Mismatches++
+	}
+
+	return nil
+}
+
+// putBack parks again a VM taken for an adoption that failed, returning
+// false if the parking is full
+func (p *vmParking) putBack(fi *funcInstance, key slotKey, now time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.parked[key.revision]) >= p.size {
+		return false
+	}
+
+	p.parked[key.revision] = append(p.parked[key.revision], &parkedVM{fi: fi, key: key, parkedAt: now})
+	p.stats.Parked++
+	p.stats.Adoptions--
+
+	return true
+}
+
+// expire removes the VMs parked for longer than the TTL
+func (p *vmParking) expire(now time.Time) []*funcInstance {
+	p.Lock()
+	defer p.Unlock()
+
+	var expired []*funcInstance
+	for revision, parked := range p.parked {
+		for i := len(parked) - 1; i >= 0; i-- {
+			if now.Sub(parked[i].parkedAt) > p.ttl {
+				expired = append(expired, parked[i].fi)
+				p.remove(revision, i)
+				p.stats.Expirations++
+			}
+		}
+	}
+
+	return expired
+}
+
+// remove drops the i-th parked VM of the revision, with the lock held
+func (p *vmParking) remove(revision string, i int) {
+	parked := p.parked[revision]
+	parked = append(parked[:i:i], parked[i+1:]...)
+	if len(parked) == 0 {
+		delete(p.parked, revision)
+	} else {
+		p.parked[revision] = parked
+	}
+	p.stats.Parked--
+}
+
+// instances returns the parked VMs
+func (p *vmParking) instances() []*funcInstance {
+	p.Lock()
+	defer p.Unlock()
+
+	var instances []*funcInstance
+	for _, parked := range p.parked {
+		for _, vm := range parked {
+			instances = append(instances, vm.fi)
+		}
+	}
+
+	return instances
+}
+
+func (p *vmParking) getStats() SlotReuseStats {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.stats
+}
+
+// removeVM frees the VM of a removed container, parking it for the next
+// container of its revision if slot reuse is enabled
+func (c *coordinator) removeVM(ctx context.Context, containerID string) error {
+	c.Lock()
+	fi, ok := c.activeInstances[containerID]
+	delete(c.activeInstances, containerID)
+	c.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// The next container of a parked VM starts its own proxy
+	fi.opMu.Lock()
+	c.closeConnProxy(fi)
+	fi.opMu.Unlock()
+
+	if c.parkVM(ctx, fi) {
+		return nil
+	}
+
+	return c.releaseVM(ctx, fi)
+}
+
+// parkVM pauses the VM of an instance and parks it, returning false if the VM
+// cannot be parked. The VMs with an extra disk are never parked since their
+// disk belongs to the pod, nor are the unhealthy ones, the debug ones or the
+// ones whose resources were updated.
+func (c *coordinator) parkVM(ctx context.Context, fi *funcInstance) bool {
+	if c.parking == nil || c.withoutOrchestrator || fi.extraDisk != nil || fi.revisionID == "" || fi.isDebugInit() || fi.isResized() {
+		return false
+	}
+
+	fi.opMu.Lock()
+	defer fi.opMu.Unlock()
+
+	if state, _ := fi.history.get(); state != vmStateRunning || fi.isUnhealthy() {
+		return false
+	}
+
+	key := newSlotKey(fi.revisionID, fi.image, fi.guestPort, fi.vmOpts)
+	if c.parking.full(key.revision) {
+		return false
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, instanceOpTimeout)
+	defer cancel()
+
+	err := c.pause(ctxTimeout, fi, metrics.NewMetric())
+	c.auditInstance(ctx, auditVMPaused, fi, err)
+	if err != nil {
+		return false
+	}
+	// A parked VM does not count toward the memory budget until it is adopted,
+	// but still toward the memory of the node it holds
+	c.mem.pause(fi.vmID)
+	fi.history.setState(vmStatePaused, eventPaused, "paused and parked for the next container of revision %s", key.revision)
+	fi.history.detach()
+
+	if !c.parking.park(fi, key, time.Now()) {
+		// The parking filled up meanwhile, the paused VM is released by the caller
+		c.closeParkedAgent(fi)
+		return false
+	}
+
+	fi.logger.WithField("revision", key.revision).Info("parked VM of a removed container")
+
+	return true
+}
+
+// adoptVM resumes a parked VM with the given key, returning nil if there is
+// none, in which case the container boots a new VM. The adopted VM keeps its
+// tap, IP and projection, like a VM restored from its snapshot.
+func (c *coordinator) adoptVM(ctx context.Context, key slotKey) *funcInstance {
+	if c.parking == nil {
+		return nil
+	}
+
+	for {
+		fi := c.parking.take(key)
+		if fi == nil {
+			return nil
+		}
+
+		// Without memory for the VM, it stays parked and the container fails to boot one
+		if err := c.mem.commit(fi.vmID, fi.vmOpts.MemSizeMib); err != nil {
+			fi.logger.WithError(err).Warn("cannot adopt parked VM")
+			c.unparkFailed(ctx, fi, key)
+			return nil
+		}
+
+		if c.resumeParkedVM(ctx, fi) {
+			return fi
+		}
+		c.mem.release(fi.vmID)
+	}
+}
+
+// unparkFailed parks back a VM that could not be adopted, releasing it if
+// the parking filled up meanwhile
+func (c *coordinator) unparkFailed(ctx context.Context, fi *funcInstance, key slotKey) {
+	if c.parking.putBack(fi, key, time.Now()) {
+		return
+	}
+
+	c.closeParkedAgent(fi)
+	if err := c.releaseVM(ctx, fi); err != nil {
+		fi.logger.WithError(err).Error("failed to release parked VM")
+	}
+}
+
+// resumeParkedVM resumes a parked VM, stopping it if it fails to resume
+func (c *coordinator) resumeParkedVM(ctx context.Context, fi *funcInstance) bool {
+	fi.opMu.Lock()
+	defer fi.opMu.Unlock()
+
+	// The VM exited or was killed through the admin API while parked
+	if state, _ := fi.history.get(); state != vmStatePaused {
+		return false
+	}
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, c.config.get().StartTimeout)
+	defer cancel()
+
+	tStart := time.Now()
+	_, err := c.orch.ResumeVM(ctxTimeout, fi.vmID)
+	c.auditInstance(ctx, auditVMResumed, fi, err)
+	if err != nil {
+		fi.logger.WithError(err).Error("failed to resume parked VM")
+		if err := c.orchStopVM(ctx, fi); err != nil {
+			fi.logger.WithError(err).Error("failed to stop parked VM")
+		}
+		return false
+	}
+	fi.history.setState(vmStateRunning, eventResumed, "adopted by a new container of revision %s", fi.revisionID)
+	fi.history.started(bootWarm, time.Since(tStart))
+	c.syncClock(ctx, fi)
+
+	fi.logger.WithField("revision", fi.revisionID).Info("adopted parked VM")
+
+	return true
+}
+
+// releaseExpiredParked releases the VMs parked for longer than the TTL
+func (c *coordinator) releaseExpiredParked(ctx context.Context, now time.Time) {
+	if c.parking == nil {
+		return
+	}
+
+	for _, fi := range c.parking.expire(now) {
+		fi.logger.Info("releasing expired parked VM")
+		c.closeParkedAgent(fi)
+		if err := c.releaseVM(ctx, fi); err != nil {
+			fi.logger.WithError(err).Error("failed to release expired parked VM")
+		}
+	}
+}
+
+// closeParkedAgent closes the control channel to the guest agent of a parked
+// VM, which cannot shut down the function gracefully while the VM is paused
+func (c *coordinator) closeParkedAgent(fi *funcInstance) {
+	if fi.agent == nil {
+		return
+	}
+
+	if err := fi.agent.Close(); err != nil {
+		fi.logger.WithError(err).Warn("failed to close guest agent channel")
+	}
+	fi.agent = nil
+}
+
+// startSlotReuseSweeper periodically releases the expired parked VMs
+func (s *Service) startSlotReuseSweeper() {
+	interval := s.coordinator.parking.ttl / 2
+	if interval > maxSlotReuseSweepInterval {
+		interval = maxSlotReuseSweepInterval
+	}
+
+	s.runPeriodically(interval, func() {
+		s.coordinator.releaseExpiredParked(withAuditActor(context.Background(), AuditActorVhive), s.now())
+	})
+}
@@ -0,0 +1,180 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// createAndPark creates a user container of the pod and removes it,
+// waiting for its VM to be parked
+func createAndPark(t *testing.T, s *Service, podID string) string {
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest(podID, "img"))
+	require.NoError(t, err, "container creation failed")
+	s.removePodVMConfig(podID)
+
+	parked := s.SlotReuseStats().Parked
+	_, err = s.RemoveContainer(context.Background(), &criapi.RemoveContainerRequest{ContainerId: resp.ContainerId})
+	require.NoError(t, err, "container removal failed")
+
+	require.Eventually(t, func() bool {
+		return s.SlotReuseStats().Parked == parked+1
+	}, 5*time.Second, 10*time.Millisecond, "VM was not parked")
+
+	return resp.ContainerId
+}
+
+func TestSlotReuseAdopt(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.parking = newVMParking(2, time.Minute)
+
+	createAndPark(t, s, "pod1")
+	require.Zero(t, orch.NumStopped("1"), "parked VM was stopped")
+	mem := s.MemoryStats()
+	require.EqualValues(t, 256, mem.CommittedMib, "parked VM holding its memory is not committed")
+	require.EqualValues(t, 256, mem.PausedMib, "parked VM is not exempt from the memory budget")
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 1, orch.NumStarted(), "VM was booted instead of adopting the parked one")
+
+	fi, ok := s.coordinator.getInstance(resp.ContainerId)
+	require.True(t, ok, "adopted VM is not active")
+	require.Equal(t, "1", fi.vmID, "parked VM was not adopted")
+	state, _ := fi.history.get()
+	require.Equal(t, vmStateRunning, state, "adopted VM was not resumed")
+	boot := fi.history.lastBoot()
+	require.NotNil(t, boot, "adoption was not recorded as the boot of the VM")
+	require.Equal(t, bootWarm, boot.Type)
+
+	vmConfig, err := s.getPodVMConfig(context.Background(), "pod2")
+	require.NoError(t, err, "VM config of the adopting pod was not stored")
+	require.Equal(t, fi.startVMResponse.GuestIP, vmConfig.guestIP, "queue-proxy is not bound to the adopted VM")
+
+	require.EqualValues(t, 256, s.MemoryStats().CommittedMib, "memory of the adopted VM was not committed")
+
+	stats := s.SlotReuseStats()
+	require.Zero(t, stats.Parked, "adopted VM is still parked")
+	require.EqualValues(t, 1, stats.Adoptions, "adoption was not counted")
+}
+
+func TestSlotReuseMemoryBudget(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.parking = newVMParking(2, time.Minute)
+	cfg := DefaultConfig()
+	cfg.TotalMemBudgetMib = 256
+	s.coordinator.config.set(cfg)
+
+	createAndPark(t, s, "pod1")
+
+	// The parked VM leaves the budget to a VM of another revision
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "other"))
+	require.NoError(t, err, "container creation failed")
+
+	// which leaves none to adopt the parked VM
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod3", "img"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "container beyond the memory budget was created")
+
+	stats := s.SlotReuseStats()
+	require.EqualValues(t, 1, stats.Parked, "VM that could not be adopted is not parked anymore")
+	require.Zero(t, stats.Adoptions, "failed adoption was counted")
+	require.Zero(t, orch.NumStopped("1"), "VM that could not be adopted was stopped")
+	mem := s.MemoryStats()
+	require.EqualValues(t, 512, mem.CommittedMib, "memory of the parked VM is not committed")
+	require.EqualValues(t, 256, mem.PausedMib, "failed adoption left the parked VM running in the budget")
+}
+
+func TestSlotReuseBounded(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.parking = newVMParking(1, time.Minute)
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod1", "img"))
+	require.NoError(t, err, "container creation failed")
+	_, err = s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	require.NoError(t, s.coordinator.removeVM(context.Background(), "ctr1"))
+	require.NoError(t, s.coordinator.removeVM(context.Background(), "ctr2"))
+
+	require.Equal(t, 1, s.SlotReuseStats().Parked, "parking is not bounded")
+	require.Equal(t, 1, orch.NumStopped("2"), "VM beyond the parking size was not stopped")
+}
+
+func TestSlotReuseExpiry(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.parking = newVMParking(2, time.Minute)
+
+	createAndPark(t, s, "pod1")
+
+	s.coordinator.releaseExpiredParked(context.Background(), time.Now().Add(30*time.Second))
+	require.Equal(t, 1, s.SlotReuseStats().Parked, "VM was released before its TTL")
+
+	s.coordinator.releaseExpiredParked(context.Background(), time.Now().Add(2*time.Minute))
+	require.Equal(t, 1, orch.NumStopped("1"), "expired parked VM was not stopped")
+	require.Zero(t, s.MemoryStats().CommittedMib, "memory of the expired parked VM was leaked")
+
+	stats := s.SlotReuseStats()
+	require.Zero(t, stats.Parked, "expired VM is still parked")
+	require.EqualValues(t, 1, stats.Expirations, "expiration was not counted")
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 2, orch.NumStarted(), "expired parked VM was adopted")
+}
+
+func TestSlotReuseResourceMismatch(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	s := newTestService(&fakes.StockRuntimeClient{}, orch)
+	s.coordinator.parking = newVMParking(2, time.Minute)
+
+	createAndPark(t, s, "pod1")
+
+	// The VMs of the revision are resized
+	cfg := DefaultConfig()
+	cfg.MemSizeMib = 512
+	s.coordinator.config.set(cfg)
+
+	resp, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod2", "img"))
+	require.NoError(t, err, "container creation failed")
+	require.Equal(t, 2, orch.NumStarted(), "VM with other resources was adopted")
+
+	fi, _ := s.coordinator.getInstance(resp.ContainerId)
+	require.EqualValues(t, 512, fi.vmOpts.MemSizeMib, "VM was not booted with the new resources")
+
+	stats := s.SlotReuseStats()
+	require.Equal(t, 1, stats.Parked, "mismatching VM was not left parked")
+	require.EqualValues(t, 1, stats.Mismatches, "mismatch was not counted")
+	require.Zero(t, stats.Adoptions, "VM with other resources was adopted")
+}
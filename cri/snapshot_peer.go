@@ -0,0 +1,305 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	peerpb "github.com/ease-lab/vhive/cri/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotPeerChunkSize is the size of the chunks of the snapshot files
+// streamed to the peers
+const snapshotPeerChunkSize = 1 << 20
+
+// snapshotPeerDialTimeout bounds the connection to a peer, after which the
+// snapshot files are pulled from the snapshot store instead
+const snapshotPeerDialTimeout = 2 * time.Second
+
+// Trailers of the length and the CRC-32C of a streamed snapshot file
+const (
+	peerSizeTrailer   = "vhive-snapshot-size"
+	peerCRC32CTrailer = "vhive-snapshot-crc32c"
+)
+
+// snapshotPeer serves the snapshot files of the VMs of the node to the other
+// nodes and fetches theirs, so that a snapshot missing on a node is pulled
+// from a node holding it before the snapshot store. The nodes announce the
+// snapshots they hold in the metadata they push to the snapshot store.
+type snapshotPeer struct {
+	sync.Mutex
+
+	// addr is the address the other nodes reach the peer service of the
+	// node on, announced in the metadata of its snapshots
+	addr    string
+	limiter *byteRateLimiter
+	// creds secure the connections to the other nodes, which are in
+	// plaintext if nil
+	creds credentials.TransportCredentials
+	// files are the local snapshot files served by snapshot key
+	files map[string]string
+}
+
+func newSnapshotPeer(addr string, bytesPerSec int64, tlsConfig *tls.Config) *snapshotPeer {
+	p := &snapshotPeer{
+		addr:    addr,
+		limiter: newByteRateLimiter(bytesPerSec),
+		files:   make(map[string]string),
+	}
+	if tlsConfig != nil {
+		p.creds = credentials.NewTLS(tlsConfig)
+	}
+
+	return p
+}
+
+// announce serves the local snapshot file under key
+func (p *snapshotPeer) announce(key, file string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.files[key] = file
+}
+
+func (p *snapshotPeer) forget(key string) {
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.files, key)
+}
+
+// GetFile streams the snapshot file under the key of the request, followed by
+// its digest in the trailer
+func (p *snapshotPeer) GetFile(req *peerpb.GetFileReq, stream peerpb.SnapshotPeer_GetFileServer) error {
+	key := req.GetKey()
+
+	p.Lock()
+	file, ok := p.files[key]
+	p.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "snapshot file %s is not held by the node", key)
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		// The snapshot was removed with its VM
+		p.forget(key)
+		return status.Errorf(codes.NotFound, "snapshot file %s is not held by the node", key)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to open snapshot file %s: %v", key, err)
+	}
+	defer f.Close()
+
+	h := crc32.New(castagnoli)
+	var size int64
+	for {
+		// A chunk is not reused, the sent messages may still be referenced
+		chunk := make([]byte, snapshotPeerChunkSize)
+		n, err := f.Read(chunk)
+		if n > 0 {
+			if err := p.limiter.wait(stream.Context(), n); err != nil {
+				return status.FromContextError(err).Err()
+			}
+			h.Write(chunk[:n])
+			size += int64(n)
+			if err := stream.Send(&peerpb.FileChunk{Data: chunk[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read snapshot file %s: %v", key, err)
+		}
+	}
+
+	stream.SetTrailer(metadata.Pairs(
+		peerSizeTrailer, strconv.FormatInt(size, 10),
+		peerCRC32CTrailer, strconv.FormatUint(uint64(h.Sum32()), 10),
+	))
+
+	snapLog.WithField("key", key).Debug("served snapshot file to a peer")
+	return nil
+}
+
+// fetch writes the snapshot file under key of the peer at addr to file,
+// which is not written if the bytes received do not match the digest sent
+func (p *snapshotPeer) fetch(ctx context.Context, addr, key, file string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, snapshotPeerDialTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(dialCtx, addr, p.dialOption(), grpc.WithBlock())
+	if err != nil {
+		return fmt.Errorf("failed to dial peer %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := peerpb.NewSnapshotPeerClient(conn).GetFile(ctx, &peerpb.GetFileReq{Key: key})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(file, &peerFileReader{stream: stream, h: crc32.New(castagnoli)}, -1); err != nil {
+		return err
+	}
+
+	snapLog.WithFields(log.Fields{"key": key, "peer": addr}).Debug("pulled snapshot file from peer")
+	return nil
+}
+
+func (p *snapshotPeer) dialOption() grpc.DialOption {
+	if p.creds == nil {
+		return grpc.WithInsecure()
+	}
+	return grpc.WithTransportCredentials(p.creds)
+}
+
+// peerFileReader reads a snapshot file streamed by a peer, failing with
+// ErrSnapshotCorrupt at its end if it does not match the digest of the peer
+type peerFileReader struct {
+	stream peerpb.SnapshotPeer_GetFileClient
+	chunk  []byte
+	size   int64
+	h      hash.Hash32
+}
+
+func (r *peerFileReader) Read(b []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		msg, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, r.verify()
+		} else if err != nil {
+			return 0, err
+		}
+		r.chunk = msg.GetData()
+	}
+
+	n := copy(b, r.chunk)
+	r.chunk = r.chunk[n:]
+	r.size += int64(n)
+	r.h.Write(b[:n])
+
+	return n, nil
+}
+
+// verify returns io.EOF if the file received matches the digest in the trailer
+func (r *peerFileReader) verify() error {
+	trailer := r.stream.Trailer()
+	sizes, crcs := trailer.Get(peerSizeTrailer), trailer.Get(peerCRC32CTrailer)
+	if len(sizes) != 1 || len(crcs) != 1 {
+		return fmt.Errorf("peer sent no digest of the snapshot file: %w", ErrSnapshotCorrupt)
+	}
+
+	size, err := strconv.ParseInt(sizes[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot file size %q: %w", sizes[0], ErrSnapshotCorrupt)
+	}
+	crc, err := strconv.ParseUint(crcs[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot file checksum %q: %w", crcs[0], ErrSnapshotCorrupt)
+	}
+
+	if r.size != size {
+		return fmt.Errorf("received %d bytes of %d: %w", r.size, size, ErrSnapshotCorrupt)
+	}
+	if r.h.Sum32() != uint32(crc) {
+		return fmt.Errorf("received snapshot file does not match its checksum: %w", ErrSnapshotCorrupt)
+	}
+
+	return io.EOF
+}
+
+// byteRateLimiter paces the bytes served to the peers with a token bucket
+// holding up to a chunk, so that the transfers do not saturate the network
+// of the node. A nil limiter does not limit the rate.
+type byteRateLimiter struct {
+	sync.Mutex
+
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newByteRateLimiter(bytesPerSec int64) *byteRateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+
+	return &byteRateLimiter{
+		rate:   float64(bytesPerSec),
+		tokens: snapshotPeerChunkSize,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// wait takes n tokens, waiting until they are refilled if the bucket runs short
+func (l *byteRateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	now := l.now()
+	l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.rate, snapshotPeerChunkSize)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
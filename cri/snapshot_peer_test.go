@@ -0,0 +1,186 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	peerpb "github.com/ease-lab/vhive/cri/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// peerNode is an in-process node serving its snapshots to the peers
+type peerNode struct {
+	c      *coordinator
+	orch   *fakes.Orchestrator
+	server *grpc.Server
+}
+
+func newPeerNode(t *testing.T, store SnapshotStore, bytesPerSec int64) *peerNode {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	orch.SnapshotDir = t.TempDir()
+	c := newCoordinator(orch)
+	c.snapStore = store
+	c.snapPeer = newSnapshotPeer(lis.Addr().String(), bytesPerSec, nil)
+
+	server := grpc.NewServer()
+	peerpb.RegisterSnapshotPeerServer(server, c.snapPeer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return &peerNode{c: c, orch: orch, server: server}
+}
+
+func TestSnapshotPeerTransfer(t *testing.T) {
+	// The snapshots of pinned images of a known revision are restored on the other nodes
+	image := "ghcr.io/ease-lab/helloworld@" + testDigest1
+	ctx := withAuditPod(context.Background(), "", "rev1")
+
+	// nodes starts two nodes sharing a snapshot store, the first of which
+	// offloads a VM of rev1, pushing and announcing its snapshot
+	nodes := func(t *testing.T) (holder, puller *peerNode, store *fakeSnapshotStore, fi *funcInstance) {
+		store = newFakeSnapshotStore()
+		holder, puller = newPeerNode(t, store, 0), newPeerNode(t, store, 0)
+
+		fi, err := holder.c.startVM(ctx, image)
+		require.NoError(t, err, "failed to start VM")
+		fi.revisionID = "rev1"
+		require.NoError(t, holder.c.insertActive("pod", "ctr1", fi))
+		require.NoError(t, holder.c.stopVM(ctx, "ctr1"), "failed to offload VM")
+
+		return holder, puller, store, fi
+	}
+
+	// restore restores the snapshot of fi on the puller, which never ran it
+	restore := func(t *testing.T, puller *peerNode, fi *funcInstance) *funcInstance {
+		restored, err := puller.c.startVM(ctx, image)
+		require.NoError(t, err, "failed to restore VM on the puller")
+		require.Equal(t, fi.snapshotID, restored.snapshotID, "VM was not restored from the snapshot of the holder")
+		require.Equal(t, 1, puller.orch.Prepared[restored.vmID], "VM of the snapshot was not prepared")
+		require.Zero(t, puller.orch.NumStarted(), "VM was booted instead of restored")
+		return restored
+	}
+
+	// requireSnapshot checks that the snapshot files of the puller hold want
+	requireSnapshot := func(t *testing.T, puller *peerNode, fi *funcInstance, want func(file string) []byte) {
+		snapFile, memFile := puller.orch.GetSnapshotFiles(fi.vmID)
+		for _, file := range []string{snapFile, memFile} {
+			data, err := ioutil.ReadFile(file)
+			require.NoError(t, err, "snapshot file was not pulled")
+			require.Equal(t, want(filepath.Base(file)), data, "unexpected snapshot file")
+		}
+	}
+
+	t.Run("Announced", func(t *testing.T) {
+		holder, _, store, fi := nodes(t)
+
+		metadata, err := holder.c.checkSnapshotMetadata(ctx, snapshotKey(fi, snapshotMetadataFile), fi.vmOpts.FirecrackerVersion)
+		require.NoError(t, err)
+		require.Equal(t, holder.c.snapPeer.addr, metadata.Peer, "snapshot was not announced")
+		require.Equal(t, 1, store.gets)
+	})
+
+	t.Run("FromPeer", func(t *testing.T) {
+		holder, puller, store, fi := nodes(t)
+
+		restored := restore(t, puller, fi)
+		requireSnapshot(t, puller, restored, func(file string) []byte {
+			data, err := ioutil.ReadFile(filepath.Join(holder.orch.SnapshotDir, fi.vmID, file))
+			require.NoError(t, err)
+			return data
+		})
+		// The latest snapshot and its metadata on lookup, then the metadata on restore
+		require.Equal(t, 3, store.gets, "snapshot files were pulled from the snapshot store")
+
+		stats := puller.c.snapStats.get()
+		require.EqualValues(t, 2, stats.PeerPulls)
+		require.Zero(t, stats.PeerFallbacks)
+	})
+
+	fallbacks := []struct {
+		name string
+		fail func(t *testing.T, holder *peerNode, fi *funcInstance)
+	}{
+		{"PeerDown", func(t *testing.T, holder *peerNode, fi *funcInstance) {
+			holder.server.Stop()
+		}},
+		{"PeerLostSnapshot", func(t *testing.T, holder *peerNode, fi *funcInstance) {
+			require.NoError(t, os.RemoveAll(filepath.Join(holder.orch.SnapshotDir, fi.vmID)))
+		}},
+		{"PeerCorrupt", func(t *testing.T, holder *peerNode, fi *funcInstance) {
+			_, memFile := holder.orch.GetSnapshotFiles(fi.vmID)
+			require.NoError(t, ioutil.WriteFile(memFile, []byte("corrupt"), 0600))
+		}},
+	}
+
+	for _, tt := range fallbacks {
+		t.Run(tt.name, func(t *testing.T) {
+			holder, puller, store, fi := nodes(t)
+			tt.fail(t, holder, fi)
+
+			restored := restore(t, puller, fi)
+			requireSnapshot(t, puller, restored, func(file string) []byte {
+				return store.files[snapshotKey(fi, file)]
+			})
+
+			stats := puller.c.snapStats.get()
+			require.EqualValues(t, 1, stats.PeerFallbacks, "failed peer was not skipped")
+			require.Zero(t, stats.Corruptions, "peer failure was counted as a corrupt snapshot")
+		})
+	}
+
+	t.Run("Self", func(t *testing.T) {
+		holder, _, store, fi := nodes(t)
+		require.NoError(t, os.RemoveAll(filepath.Join(holder.orch.SnapshotDir, fi.vmID)))
+
+		restored, err := holder.c.startVM(ctx, image)
+		require.NoError(t, err, "failed to restore VM")
+		require.Equal(t, fi, restored, "idle VM was not restored")
+		require.Equal(t, 3, store.gets, "snapshot files were not pulled from the snapshot store")
+		require.Zero(t, holder.c.snapStats.get().PeerFallbacks, "node pulled its own snapshot from itself")
+	})
+}
+
+func TestByteRateLimiter(t *testing.T) {
+	var unlimited *byteRateLimiter
+	require.NoError(t, unlimited.wait(context.Background(), 1<<30))
+	require.Nil(t, newByteRateLimiter(0), "rate of 0 was limited")
+
+	l := newByteRateLimiter(1 << 20)
+	require.NoError(t, l.wait(context.Background(), snapshotPeerChunkSize), "burst of a chunk was delayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, l.wait(ctx, snapshotPeerChunkSize), "bytes in excess of the burst were not delayed")
+}
@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"golang.org/x/sync/singleflight"
+)
+
+// snapshotPrefetcher reads the snapshot files of the VMs being restored into
+// the page cache before they are loaded, rather than each restore faulting
+// them in from disk. The concurrent prefetches of a file are coalesced into
+// one read, and a file read within the window is not read again, e.g., for
+// the restores requested together when a revision scales out.
+type snapshotPrefetcher struct {
+	// reads and coalesced are first for their 64-bit alignment
+	reads     uint64
+	coalesced uint64
+
+	window time.Duration
+	read   func(path string) error
+	now    func() time.Time
+
+	group singleflight.Group
+
+	mu sync.Mutex
+	// fetched is when each file was last read
+	fetched map[string]time.Time
+}
+
+func newSnapshotPrefetcher(window time.Duration) *snapshotPrefetcher {
+	return &snapshotPrefetcher{
+		window:  window,
+		read:    ctriface.PrefetchFile,
+		now:     time.Now,
+		fetched: make(map[string]time.Time),
+	}
+}
+
+// prefetch reads the files into the page cache, waiting for the reads of the
+// files already in flight instead of reading them again. The failures only
+// cost latency to the restores, so they are logged rather than returned.
+func (p *snapshotPrefetcher) prefetch(files ...string) {
+	var wg sync.WaitGroup
+	for _, file := range files {
+		if p.recentlyFetched(file) {
+			atomic.AddUint64(&p.coalesced, 1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(file string) {
+			defer wg.Done()
+
+			read := false
+			_, err, _ := p.group.Do(file, func() (interface{}, error) {
+				read = true
+				atomic.AddUint64(&p.reads, 1)
+				if err := p.read(file); err != nil {
+					return nil, err
+				}
+
+				p.mu.Lock()
+				p.fetched[file] = p.now()
+				p.mu.Unlock()
+				return nil, nil
+			})
+			if !read {
+				atomic.AddUint64(&p.coalesced, 1)
+			}
+			if err != nil {
+				snapLog.WithError(err).WithField("file", file).Warn("failed to prefetch snapshot file")
+			}
+		}(file)
+	}
+	wg.Wait()
+}
+
+// recentlyFetched returns true if the file was read within the window,
+// forgetting the files read before
+func (p *snapshotPrefetcher) recentlyFetched(file string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for f, t := range p.fetched {
+		if now.Sub(t) > p.window {
+			delete(p.fetched, f)
+		}
+	}
+
+	_, ok := p.fetched[file]
+	return ok
+}
+
+// counts returns the number of files read and of prefetches served by
+// another read, in flight or within the window
+func (p *snapshotPrefetcher) counts() (reads, coalesced uint64) {
+	return atomic.LoadUint64(&p.reads), atomic.LoadUint64(&p.coalesced)
+}
@@ -0,0 +1,159 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the reads of each file, blocking them until released
+type countingReader struct {
+	sync.Mutex
+	reads   map[string]int
+	release chan struct{}
+	err     error
+}
+
+func newCountingReader() *countingReader {
+	r := &countingReader{reads: make(map[string]int), release: make(chan struct{})}
+	close(r.release)
+	return r
+}
+
+func (r *countingReader) read(path string) error {
+	r.Lock()
+	r.reads[path]++
+	r.Unlock()
+
+	<-r.release
+	return r.err
+}
+
+func (r *countingReader) count(path string) int {
+	r.Lock()
+	defer r.Unlock()
+	return r.reads[path]
+}
+
+func TestSnapshotPrefetchCoalesces(t *testing.T) {
+	reader := newCountingReader()
+	reader.release = make(chan struct{})
+
+	p := newSnapshotPrefetcher(time.Minute)
+	p.read = reader.read
+
+	// The restores of a scaled-out revision prefetch the same files at once
+	const restores = 10
+	var wg sync.WaitGroup
+	for i := 0; i < restores; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.prefetch("snap_file", "mem_file")
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return reader.count("mem_file") == 1 && reader.count("snap_file") == 1
+	}, time.Second, time.Millisecond, "files were not read")
+	time.Sleep(10 * time.Millisecond)
+	close(reader.release)
+	wg.Wait()
+
+	require.Equal(t, 1, reader.count("snap_file"), "snapshot file was read more than once")
+	require.Equal(t, 1, reader.count("mem_file"), "memory file was read more than once")
+	reads, coalesced := p.counts()
+	require.EqualValues(t, 2, reads)
+	require.EqualValues(t, 2*(restores-1), coalesced)
+}
+
+func TestSnapshotPrefetchWindow(t *testing.T) {
+	reader := newCountingReader()
+	now := time.Now()
+
+	p := newSnapshotPrefetcher(time.Minute)
+	p.read = reader.read
+	p.now = func() time.Time { return now }
+
+	p.prefetch("mem_file")
+	now = now.Add(30 * time.Second)
+	p.prefetch("mem_file")
+	require.Equal(t, 1, reader.count("mem_file"), "file was read again within the window")
+
+	now = now.Add(time.Minute)
+	p.prefetch("mem_file")
+	require.Equal(t, 2, reader.count("mem_file"), "file was not read again after the window")
+	require.Len(t, p.fetched, 1, "expired files were kept")
+
+	// A failed read does not count as fetched
+	reader.err = errors.New("read failed")
+	p.prefetch("other_file")
+	p.prefetch("other_file")
+	require.Equal(t, 2, reader.count("other_file"), "failed read was not retried")
+}
+
+func TestRestoreSnapshotPrefetch(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	orch.SnapshotsEnabled = true
+	orch.SnapshotDir = t.TempDir()
+	s := newTestService(nil, orch)
+	WithSnapshotPrefetch(time.Minute)(s)
+	reader := newCountingReader()
+	s.coordinator.prefetcher.read = reader.read
+	c := s.coordinator
+	ctx := context.Background()
+
+	fi, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "failed to start VM")
+	require.NoError(t, c.insertActive("pod", "ctr1", fi))
+	require.NoError(t, c.stopVM(ctx, "ctr1"), "failed to offload VM")
+	require.Empty(t, reader.reads, "files were prefetched before a restore")
+
+	restored, err := c.startVM(ctx, "img")
+	require.NoError(t, err, "failed to restore VM")
+	require.Equal(t, fi, restored, "VM was not restored")
+
+	var files []string
+	for file, n := range reader.reads {
+		require.Equal(t, 1, n, "file %s was not read once", file)
+		files = append(files, filepath.Base(file))
+		require.Equal(t, filepath.Join(orch.SnapshotDir, fi.vmID), filepath.Dir(file), "file of another VM was prefetched")
+	}
+	sort.Strings(files)
+	require.Equal(t, []string{"mem_file", "snap_file", "working_set_pages"}, files)
+
+	stats := s.ScaleToZeroStats()
+	require.EqualValues(t, 1, stats.Restores)
+	require.EqualValues(t, 1, stats.PrefetchedRestores, "restore was not counted as prefetched")
+	require.EqualValues(t, 1, stats.PrefetchedRestoreLatency.Count, "latency of the restore was not observed")
+	require.EqualValues(t, 3, stats.PrefetchReads)
+}
@@ -0,0 +1,649 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSnapshotNotFound is returned by a SnapshotStore without the requested snapshot file
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// ErrSnapshotIncompatible is returned when restoring a VM from a snapshot
+// taken by another firecracker release, which it would fail to load
+var ErrSnapshotIncompatible = errors.New("snapshot was taken by another firecracker release")
+
+// ErrSnapshotCorrupt is returned when restoring a VM from a snapshot whose
+// files or metadata in the snapshot store are truncated or do not match
+// their checksums, e.g., after a crash mid-push
+var ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+
+// snapshotMetadataFile is the file describing a snapshot in the snapshot
+// store, pushed after its snapshot files
+const snapshotMetadataFile = "metadata.json"
+
+// snapshotLatestFile holds the ID of the latest snapshot of a revision and an
+// image in the snapshot store, pushed after the metadata of the snapshot
+const snapshotLatestFile = "latest"
+
+// corruptSuffix is appended to the name of a corrupt file set aside
+const corruptSuffix = ".corrupt"
+
+// snapshotMetadata describes a snapshot in the snapshot store
+type snapshotMetadata struct {
+	Image string `json:"image"`
+	// FirecrackerVersion is the firecracker release that took the snapshot,
+	// empty if the releases of the node are not configured
+	FirecrackerVersion string `json:"firecrackerVersion"`
+	// Shape describes the resources the VM was booted with, which the VMs
+	// restored from the snapshot on other nodes must request
+	Shape string `json:"shape,omitempty"`
+	// Files are the length and the checksum of the snapshot files by name,
+	// which are not verified if empty
+	Files map[string]snapshotFileDigest `json:"files,omitempty"`
+	// Peer is the address of the peer service of the node holding the
+	// snapshot files, which are pulled from it before the snapshot store
+	Peer string `json:"peer,omitempty"`
+}
+
+// snapshotFileDigest is the length and the CRC-32C of a snapshot file
+type snapshotFileDigest struct {
+	Size   int64  `json:"size"`
+	CRC32C uint32 `json:"crc32c"`
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotStore keeps the snapshot files of the VMs off the node, so that they
+// outlive the local snapshots and are restored on any node sharing the store.
+// The files are keyed by revision, image digest, snapshot ID and file name.
+type SnapshotStore interface {
+	// Put stores the size bytes of r under key, replacing any previous file
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns the file stored under key, or ErrSnapshotNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists returns whether a file is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// snapshotStoreTimeout bounds the transfer of the files of a snapshot
+const snapshotStoreTimeout = 10 * time.Minute
+
+// OpenSnapshotStore opens the snapshot store at location, a directory or an
+// s3://bucket/prefix URL of an S3-compatible store served at endpoint, which
+// is AWS S3 in region if empty. The S3 credentials are read from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func OpenSnapshotStore(location, endpoint, region string) (SnapshotStore, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		store, err := NewLocalSnapshotStore(location)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+
+	bucket, prefix := location[len("s3://"):], ""
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, prefix = bucket[:i], strings.Trim(bucket[i+1:], "/")
+	}
+
+	store, err := NewS3SnapshotStore(S3Config{
+		Endpoint:  endpoint,
+		Region:    region,
+		Bucket:    bucket,
+		Prefix:    prefix,
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// LocalSnapshotStore is a snapshot store in a directory, e.g., on a network file system
+type LocalSnapshotStore struct {
+	dir string
+}
+
+// NewLocalSnapshotStore returns a snapshot store in dir, which is created if needed
+func NewLocalSnapshotStore(dir string) (*LocalSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot store: %w", err)
+	}
+
+	return &LocalSnapshotStore{dir: dir}, nil
+}
+
+// Put stores the size bytes of r under key, atomically replacing any previous file
+func (l *LocalSnapshotStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, r, size)
+}
+
+// Get returns the file stored under key, or ErrSnapshotNotFound
+func (l *LocalSnapshotStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", key, ErrSnapshotNotFound)
+	}
+
+	return f, err
+}
+
+// Exists returns whether a file is stored under key
+func (l *LocalSnapshotStore) Exists(ctx context.Context, key string) (bool, error) {
+	file, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	return fileExists(file)
+}
+
+func (l *LocalSnapshotStore) path(key string) (string, error) {
+	if err := validateSnapshotKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// snapshotKey is the key of a snapshot file of a VM of a revision, under the
+// digest of its image, so that a snapshot is not restored for another image
+// of the same tag, and the ID of its snapshot, which unlike the vmID is unique
+// across the nodes sharing the snapshot store
+func snapshotKey(fi *funcInstance, file string) string {
+	return path.Join(snapshotPrefix(fi.revisionID, snapshotImageDigest(fi)), fi.snapshotID, filepath.Base(file))
+}
+
+// snapshotPrefix is the prefix of the keys of the snapshots of a revision and an image digest
+func snapshotPrefix(revision, digest string) string {
+	if digest == "" {
+		return revision
+	}
+
+	return path.Join(revision, strings.Replace(digest, ":", "-", 1))
+}
+
+// snapshotImageDigest returns the digest of the image of a VM, the one it is
+// pinned to or else the one resolved when it was booted, empty if unknown
+func snapshotImageDigest(fi *funcInstance) string {
+	if digest := imageDigest(fi.image); digest != "" {
+		return digest
+	}
+	if fi.startVMResponse != nil {
+		return fi.startVMResponse.ImageDigest
+	}
+
+	return ""
+}
+
+// newSnapshotID returns a random ID for a snapshot pushed to the snapshot store
+func newSnapshotID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// snapshotShape describes the shape of the VM of a snapshot in its metadata,
+// without the firecracker binary, whose path is specific to the node
+func snapshotShape(opts *ctriface.StartVMOptions) string {
+	shape := newVMShape(opts)
+	shape.firecracker = ""
+
+	return fmt.Sprintf("%+v", shape)
+}
+
+func validateSnapshotKey(key string) error {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid snapshot key %q", key)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes the size bytes of r, or all of them if size is
+// negative, to file through a temporary file, so that a failed write does
+// not leave a truncated file behind
+func writeFileAtomic(file string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("wrote %d bytes of %d", n, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func fileExists(file string) (bool, error) {
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// pushSnapshot stores the snapshot of a VM in the snapshot store, if any, as
+// the latest snapshot of its revision and image. A VM without a revision is
+// not pushed, its snapshot would not be found again.
+func (c *coordinator) pushSnapshot(ctx context.Context, fi *funcInstance) error {
+	if c.snapStore == nil || fi.revisionID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotStoreTimeout)
+	defer cancel()
+
+	snapshotID, err := newSnapshotID()
+	if err != nil {
+		return err
+	}
+	fi.snapshotID = snapshotID
+
+	files := make(map[string]snapshotFileDigest)
+	snapFile, memFile := c.orch.GetSnapshotFiles(fi.vmID)
+	for _, file := range []string{snapFile, memFile} {
+		digest, err := c.pushSnapshotFile(ctx, snapshotKey(fi, file), file)
+		if err != nil {
+			return fmt.Errorf("failed to push snapshot file %s: %w", file, err)
+		}
+		files[filepath.Base(file)] = digest
+	}
+
+	var peer string
+	if c.snapPeer != nil {
+		peer = c.snapPeer.addr
+		for _, file := range []string{snapFile, memFile} {
+			c.snapPeer.announce(snapshotKey(fi, file), file)
+		}
+	}
+
+	metadata, err := json.Marshal(snapshotMetadata{
+		Image:              fi.image,
+		FirecrackerVersion: fi.vmOpts.FirecrackerVersion,
+		Shape:              snapshotShape(fi.vmOpts),
+		Files:              files,
+		Peer:               peer,
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.snapStore.Put(ctx, snapshotKey(fi, snapshotMetadataFile), bytes.NewReader(metadata), int64(len(metadata))); err != nil {
+		return fmt.Errorf("failed to push snapshot metadata: %w", err)
+	}
+
+	// The other nodes restore the latest snapshot once it is complete
+	latest := path.Join(snapshotPrefix(fi.revisionID, snapshotImageDigest(fi)), snapshotLatestFile)
+	if err := c.snapStore.Put(ctx, latest, strings.NewReader(snapshotID), int64(len(snapshotID))); err != nil {
+		return fmt.Errorf("failed to push latest snapshot: %w", err)
+	}
+
+	fi.logger.WithField("revision", fi.revisionID).Debug("pushed snapshot to the snapshot store")
+	return nil
+}
+
+// pushSnapshotFile stores a snapshot file in the snapshot store, returning
+// the digest of the bytes pushed
+func (c *coordinator) pushSnapshotFile(ctx context.Context, key, file string) (snapshotFileDigest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return snapshotFileDigest{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return snapshotFileDigest{}, err
+	}
+
+	h := crc32.New(castagnoli)
+	if err := c.snapStore.Put(ctx, key, io.TeeReader(f, h), info.Size()); err != nil {
+		return snapshotFileDigest{}, err
+	}
+
+	return snapshotFileDigest{Size: info.Size(), CRC32C: h.Sum32()}, nil
+}
+
+// pullSnapshot fetches the files of the snapshot of a VM missing on the node
+// from the peer holding them, if any, or else from the snapshot store, before
+// the VM is restored. The snapshot
+// is not pulled if its metadata tells that another firecracker release took
+// it, e.g., before the node was upgraded, returning ErrSnapshotIncompatible.
+// A pulled file that does not match the digest in the metadata is quarantined,
+// returning ErrSnapshotCorrupt. A snapshot that was never pushed is not pulled.
+func (c *coordinator) pullSnapshot(ctx context.Context, fi *funcInstance) error {
+	if c.snapStore == nil || fi.revisionID == "" || fi.snapshotID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotStoreTimeout)
+	defer cancel()
+
+	var missing []string
+	snapFile, memFile := c.orch.GetSnapshotFiles(fi.vmID)
+	for _, file := range []string{snapFile, memFile} {
+		if local, err := fileExists(file); err == nil && !local {
+			missing = append(missing, file)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	metadata, err := c.checkSnapshotMetadata(ctx, snapshotKey(fi, snapshotMetadataFile), fi.vmOpts.FirecrackerVersion)
+	if err != nil {
+		return err
+	}
+
+	// The other files are not pulled from a peer that failed once, e.g., down
+	fromPeer := true
+	for _, file := range missing {
+		if fromPeer = fromPeer && c.pullSnapshotFileFromPeer(ctx, fi, metadata, file); fromPeer {
+			continue
+		}
+
+		fi.logger.WithField("file", file).Warn("snapshot file is missing on the node, pulling it from the snapshot store")
+		if err := c.pullSnapshotFile(ctx, snapshotKey(fi, file), file); err != nil {
+			return fmt.Errorf("failed to pull snapshot file %s: %w", file, err)
+		}
+
+		if digest, ok := metadata.Files[filepath.Base(file)]; ok {
+			if err := verifySnapshotFile(file, digest); err != nil {
+				c.quarantineSnapshotFile(fi, file)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSnapshotMetadata checks that the snapshot whose metadata is stored under
+// key was taken by the given firecracker release and returns its metadata.
+// The snapshots pushed without metadata are assumed to be compatible.
+func (c *coordinator) checkSnapshotMetadata(ctx context.Context, key, firecrackerVersion string) (snapshotMetadata, error) {
+	var metadata snapshotMetadata
+
+	exists, err := c.snapStore.Exists(ctx, key)
+	if err != nil || !exists {
+		return metadata, err
+	}
+
+	rc, err := c.snapStore.Get(ctx, key)
+	if err != nil {
+		return metadata, err
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(&metadata); err != nil {
+		c.snapStats.corrupted()
+		return metadata, fmt.Errorf("invalid snapshot metadata %s: %v: %w", key, err, ErrSnapshotCorrupt)
+	}
+
+	if metadata.FirecrackerVersion != firecrackerVersion {
+		return metadata, fmt.Errorf("%s taken by firecracker %q, the VM runs %q: %w",
+			key, metadata.FirecrackerVersion, firecrackerVersion, ErrSnapshotIncompatible)
+	}
+
+	return metadata, nil
+}
+
+func (c *coordinator) pullSnapshotFile(ctx context.Context, key, file string) error {
+	exists, err := c.snapStore.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s: %w", key, ErrSnapshotNotFound)
+	}
+
+	rc, err := c.snapStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := writeFileAtomic(file, rc, -1); err != nil {
+		return err
+	}
+
+	snapLog.WithField("key", key).Debug("pulled snapshot file")
+	return nil
+}
+
+// pullSnapshotFileFromPeer fetches a snapshot file from the peer announced in
+// the metadata of the snapshot, returning whether it was pulled. A file that
+// cannot be pulled or does not match its digest is left to the snapshot store.
+func (c *coordinator) pullSnapshotFileFromPeer(ctx context.Context, fi *funcInstance, metadata snapshotMetadata, file string) bool {
+	if c.snapPeer == nil || metadata.Peer == "" || metadata.Peer == c.snapPeer.addr {
+		return false
+	}
+
+	logger := fi.logger.WithFields(log.Fields{"file": file, "peer": metadata.Peer})
+	logger.Info("snapshot file is missing on the node, pulling it from peer")
+
+	err := c.snapPeer.fetch(ctx, metadata.Peer, snapshotKey(fi, file), file)
+	if digest, ok := metadata.Files[filepath.Base(file)]; ok && err == nil {
+		if err = verifySnapshotFile(file, digest); err != nil {
+			os.Remove(file)
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Warn("failed to pull snapshot file from peer, falling back to the snapshot store")
+		c.snapStats.peerPulled(false)
+		return false
+	}
+
+	c.snapStats.peerPulled(true)
+	return true
+}
+
+// verifySnapshotFile checks the length and the checksum of a pulled snapshot file
+func verifySnapshotFile(file string, digest snapshotFileDigest) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := crc32.New(castagnoli)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	if n != digest.Size {
+		return fmt.Errorf("%s holds %d bytes of %d: %w", file, n, digest.Size, ErrSnapshotCorrupt)
+	}
+	if h.Sum32() != digest.CRC32C {
+		return fmt.Errorf("%s does not match its checksum: %w", file, ErrSnapshotCorrupt)
+	}
+
+	return nil
+}
+
+// quarantineSnapshotFile sets a corrupt snapshot file aside, so that it is
+// not restored but can still be inspected
+func (c *coordinator) quarantineSnapshotFile(fi *funcInstance, file string) {
+	c.snapStats.corrupted()
+
+	logger := fi.logger.WithField("file", file)
+	if err := os.Rename(file, file+corruptSuffix); err != nil {
+		logger.WithError(err).Error("failed to quarantine corrupt snapshot file")
+		return
+	}
+
+	logger.Warn("quarantined corrupt snapshot file")
+}
+
+// storedInstance prepares a VM to be restored from the latest snapshot of the
+// revision of ctx and the image in the snapshot store, taken by any node, when
+// the node has no idle VM of the image. It returns nil if the image is not
+// pinned to a digest, there is no snapshot for a VM with the given options or
+// the VM cannot be prepared, for the VM to be booted instead.
+func (c *coordinator) storedInstance(ctx context.Context, image string, vmOpts *ctriface.StartVMOptions, opts ...ctriface.StartVMOption) *funcInstance {
+	revision, digest := auditSourceOf(ctx).revision, imageDigest(image)
+	if c.snapStore == nil || c.withoutOrchestrator || revision == "" || digest == "" {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"image": image, "revision": revision})
+
+	storeCtx, cancel := context.WithTimeout(ctx, snapshotStoreTimeout)
+	snapshotID, err := c.latestSnapshot(storeCtx, snapshotPrefix(revision, digest), vmOpts)
+	cancel()
+	if err != nil {
+		logger.WithError(err).Warn("failed to look up the snapshot store, booting a VM instead")
+		return nil
+	}
+	if snapshotID == "" {
+		return nil
+	}
+
+	vmID, err := c.newVMID(logger)
+	if err != nil {
+		logger.WithError(err).Warn("failed to allocate a vmID to restore a stored snapshot")
+		return nil
+	}
+	logger = logger.WithFields(log.Fields{"vmID": vmID, "snapshot": snapshotID})
+
+	// The VM only holds its memory until it is offloaded, the restore commits it again
+	if err := c.mem.commit(vmID, vmOpts.MemSizeMib); err != nil {
+		logger.WithError(err).Warn("no memory to prepare the VM of a stored snapshot, booting a VM instead")
+		return nil
+	}
+	resp, _, err := c.orch.PrepareRestore(ctx, vmID, image, opts...)
+	c.mem.release(vmID)
+	if err != nil {
+		logger.WithError(err).Warn("failed to prepare the VM of a stored snapshot, booting a VM instead")
+		return nil
+	}
+
+	fi := newFuncInstance(vmID, image, resp)
+	fi.history.budget = c.events
+	fi.vmOpts = vmOpts
+	fi.revisionID = revision
+	fi.snapshotID = snapshotID
+	// The snapshot is in the store already, it is not taken again when the VM is offloaded
+	fi.onceCreateSnapInstance.Do(func() {})
+	atomic.StoreInt32(&fi.exitExpected, 1)
+	fi.history.record(eventCreated, "VM %s created for image %s from stored snapshot %s", vmID, image, snapshotID)
+	fi.history.setState(vmStateOffloaded, eventOffloaded, "prepared to restore a stored snapshot")
+	c.watchVMExit(fi)
+
+	logger.Info("restoring VM from a snapshot of the snapshot store")
+	return fi
+}
+
+// latestSnapshot returns the ID of the latest snapshot under prefix in the
+// snapshot store, empty if there is none, or it was taken by another
+// firecracker release or of a VM of another shape than the given options
+func (c *coordinator) latestSnapshot(ctx context.Context, prefix string, vmOpts *ctriface.StartVMOptions) (string, error) {
+	key := path.Join(prefix, snapshotLatestFile)
+
+	exists, err := c.snapStore.Exists(ctx, key)
+	if err != nil || !exists {
+		return "", err
+	}
+
+	rc, err := c.snapStore.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, 128))
+	if err != nil {
+		return "", err
+	}
+
+	snapshotID := strings.TrimSpace(string(data))
+	if snapshotID == "" || strings.Contains(snapshotID, "/") || validateSnapshotKey(path.Join(prefix, snapshotID)) != nil {
+		c.snapStats.corrupted()
+		return "", fmt.Errorf("invalid latest snapshot %q in %s: %w", snapshotID, key, ErrSnapshotCorrupt)
+	}
+
+	metadata, err := c.checkSnapshotMetadata(ctx, path.Join(prefix, snapshotID, snapshotMetadataFile), vmOpts.FirecrackerVersion)
+	if errors.Is(err, ErrSnapshotIncompatible) {
+		c.snapStats.versionFallback()
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// A snapshot without metadata is incomplete, e.g., its push failed
+	if metadata.Shape != snapshotShape(vmOpts) {
+		return "", nil
+	}
+
+	return snapshotID, nil
+}
@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kinds of failures to start a VM, matched with errors.Is
+var (
+	ErrImagePull      = errors.New("failed to pull the image")
+	ErrNetworkSetup   = errors.New("failed to set up the network")
+	ErrVMBoot         = errors.New("failed to boot the VM")
+	ErrGuestTimeout   = errors.New("guest did not become ready in time")
+	ErrStartCancelled = errors.New("start of the VM was cancelled")
+)
+
+// phaseGuest is the phase of a VM whose guest does not become ready
+const phaseGuest = "guest"
+
+// StartError is a failure to start a VM in one of the phases of its start
+type StartError struct {
+	// Kind is one of ErrImagePull, ErrNetworkSetup, ErrVMBoot, ErrGuestTimeout and ErrStartCancelled
+	Kind  error
+	Phase string
+	// VMID is the VM that failed to start
+	VMID string
+	Err  error
+}
+
+// newStartError classifies an error of the orchestrator starting a VM
+// by the phase that failed, a failure in an unknown phase being a boot failure
+func newStartError(err error) *StartError {
+	phase := ctriface.GetPhase(err)
+	if phase == "" {
+		phase = ctriface.PhaseBoot
+	}
+
+	kind := ErrVMBoot
+	switch {
+	case errors.Is(err, context.Canceled):
+		kind = ErrStartCancelled
+	case phase == ctriface.PhaseImage:
+		kind = ErrImagePull
+	case phase == ctriface.PhaseNetwork:
+		kind = ErrNetworkSetup
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		// The guest never connected back to firecracker-containerd
+		kind, phase = ErrGuestTimeout, phaseGuest
+	}
+
+	return &StartError{Kind: kind, Phase: phase, Err: err}
+}
+
+func (e *StartError) Error() string {
+	if e.VMID == "" {
+		return fmt.Sprintf("%v in phase %s: %v", e.Kind, e.Phase, e.Err)
+	}
+
+	return fmt.Sprintf("VM %s: %v in phase %s: %v", e.VMID, e.Kind, e.Phase, e.Err)
+}
+
+// Is matches the kind of the error
+func (e *StartError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Cause returns the underlying error, for errors.Cause
+func (e *StartError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// StartFailureStats counts the failures to start a VM by phase
+type StartFailureStats struct {
+	Phases map[string]uint64 `json:"phases"`
+	Total  uint64            `json:"total"`
+}
+
+// startFailureStats accumulates the StartFailureStats of the coordinator
+type startFailureStats struct {
+	sync.Mutex
+	phases map[string]uint64
+	total  uint64
+}
+
+func newStartFailureStats() *startFailureStats {
+	return &startFailureStats{phases: make(map[string]uint64)}
+}
+
+func (s *startFailureStats) failed(phase string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.phases[phase]++
+	s.total++
+}
+
+func (s *startFailureStats) get() StartFailureStats {
+	s.Lock()
+	defer s.Unlock()
+
+	stats := StartFailureStats{Phases: make(map[string]uint64, len(s.phases)), Total: s.total}
+	for phase, n := range s.phases {
+		stats.Phases[phase] = n
+	}
+
+	return stats
+}
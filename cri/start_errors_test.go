@@ -0,0 +1,134 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStartErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		startErr    error
+		imageCached bool
+		expectKind  error
+		expectPhase string
+		expectCode  codes.Code
+	}{
+		{
+			name:        "Image pull",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseImage, Err: errInjected},
+			expectKind:  ErrImagePull,
+			expectPhase: ctriface.PhaseImage,
+			expectCode:  codes.Unavailable,
+		},
+		{
+			name:        "Image not cached",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseImage, Err: fmt.Errorf("img: %w", ctriface.ErrImageNotCached)},
+			imageCached: true,
+			expectKind:  ErrImagePull,
+			expectPhase: ctriface.PhaseImage,
+			expectCode:  codes.FailedPrecondition,
+		},
+		{
+			name:        "Tap creation",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseNetwork, Err: errInjected},
+			expectKind:  ErrNetworkSetup,
+			expectPhase: ctriface.PhaseNetwork,
+			expectCode:  codes.Unavailable,
+		},
+		{
+			name:        "Firecracker crash",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: errInjected},
+			expectKind:  ErrVMBoot,
+			expectPhase: ctriface.PhaseBoot,
+			expectCode:  codes.Internal,
+		},
+		{
+			name:        "Out of memory",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: fmt.Errorf("failed to create VM: %w", syscall.ENOMEM)},
+			expectKind:  ErrVMBoot,
+			expectPhase: ctriface.PhaseBoot,
+			expectCode:  codes.ResourceExhausted,
+		},
+		{
+			name:        "Guest timeout",
+			startErr:    &ctriface.PhaseError{Phase: ctriface.PhaseBoot, Err: fmt.Errorf("failed to create VM: %w", context.DeadlineExceeded)},
+			expectKind:  ErrGuestTimeout,
+			expectPhase: phaseGuest,
+			expectCode:  codes.DeadlineExceeded,
+		},
+		{
+			name:        "Unknown phase",
+			startErr:    errInjected,
+			expectKind:  ErrVMBoot,
+			expectPhase: ctriface.PhaseBoot,
+			expectCode:  codes.Internal,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.StartErr = c.startErr
+			s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+			_, err := s.coordinator.startVM(context.Background(), "img", ctriface.WithImageCached(c.imageCached))
+			require.Error(t, err, "VM start did not fail")
+			require.True(t, errors.Is(err, c.expectKind), "unexpected kind of error %v", err)
+			require.True(t, errors.Is(err, c.startErr), "error does not wrap its cause")
+
+			var se *StartError
+			require.True(t, errors.As(err, &se), "error is not a start error")
+			require.Equal(t, c.expectPhase, se.Phase, "unexpected phase")
+			require.Equal(t, "1", se.VMID)
+			require.True(t, strings.HasPrefix(err.Error(), "VM 1: "), "vmID is missing from error %q", err)
+
+			r := newUserContainerRequest("pod", "img")
+			_, err = s.CreateContainer(context.Background(), r)
+			require.Error(t, err, "container creation did not fail")
+			require.Equal(t, c.expectCode, status.Code(err), "unexpected error code")
+			require.True(t, strings.Contains(status.Convert(err).Message(), "in phase "+c.expectPhase),
+				"phase is missing from error %q", status.Convert(err).Message())
+
+			stats := s.StartFailureStats()
+			require.Equal(t, uint64(2), stats.Total, "unexpected number of failures")
+			require.Equal(t, map[string]uint64{c.expectPhase: 2}, stats.Phases, "failures were not counted by phase")
+		})
+	}
+}
+
+func TestStartErrorStatusOtherErrors(t *testing.T) {
+	require.Equal(t, errInjected, startErrorStatus(errInjected), "other error was converted")
+}
@@ -0,0 +1,88 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// StockRuntimeClient is the subset of the stock containerd runtime service
+// that vHive manages the sandboxes and the containers it does not run in VMs
+// with, e.g., the queue-proxies and the placeholders of the user containers.
+// The other requests of kubelet are passed through to the stock containerd if
+// the client implements the whole criapi.RuntimeServiceClient.
+type StockRuntimeClient interface {
+	RunPodSandbox(ctx context.Context, r *criapi.RunPodSandboxRequest, opts ...grpc.CallOption) (*criapi.RunPodSandboxResponse, error)
+	StopPodSandbox(ctx context.Context, r *criapi.StopPodSandboxRequest, opts ...grpc.CallOption) (*criapi.StopPodSandboxResponse, error)
+	RemovePodSandbox(ctx context.Context, r *criapi.RemovePodSandboxRequest, opts ...grpc.CallOption) (*criapi.RemovePodSandboxResponse, error)
+	PodSandboxStatus(ctx context.Context, r *criapi.PodSandboxStatusRequest, opts ...grpc.CallOption) (*criapi.PodSandboxStatusResponse, error)
+	CreateContainer(ctx context.Context, r *criapi.CreateContainerRequest, opts ...grpc.CallOption) (*criapi.CreateContainerResponse, error)
+	StartContainer(ctx context.Context, r *criapi.StartContainerRequest, opts ...grpc.CallOption) (*criapi.StartContainerResponse, error)
+	StopContainer(ctx context.Context, r *criapi.StopContainerRequest, opts ...grpc.CallOption) (*criapi.StopContainerResponse, error)
+	RemoveContainer(ctx context.Context, r *criapi.RemoveContainerRequest, opts ...grpc.CallOption) (*criapi.RemoveContainerResponse, error)
+	ContainerStatus(ctx context.Context, r *criapi.ContainerStatusRequest, opts ...grpc.CallOption) (*criapi.ContainerStatusResponse, error)
+	ContainerStats(ctx context.Context, r *criapi.ContainerStatsRequest, opts ...grpc.CallOption) (*criapi.ContainerStatsResponse, error)
+	ListContainerStats(ctx context.Context, r *criapi.ListContainerStatsRequest, opts ...grpc.CallOption) (*criapi.ListContainerStatsResponse, error)
+	UpdateContainerResources(ctx context.Context, r *criapi.UpdateContainerResourcesRequest, opts ...grpc.CallOption) (*criapi.UpdateContainerResourcesResponse, error)
+	// Version is also the liveness probe of the stock containerd
+	Version(ctx context.Context, r *criapi.VersionRequest, opts ...grpc.CallOption) (*criapi.VersionResponse, error)
+}
+
+// StockImageClient is the subset of the stock containerd image service that
+// vHive pulls the images of the sandboxes it runs in VMs with. The other
+// requests of kubelet are passed through to the stock containerd if the client
+// implements the whole criapi.ImageServiceClient.
+type StockImageClient interface {
+	PullImage(ctx context.Context, r *criapi.PullImageRequest, opts ...grpc.CallOption) (*criapi.PullImageResponse, error)
+}
+
+// errNoPassthrough is the error of the requests passed through to stock
+// clients that only implement the subset of the services vHive relies on
+var errNoPassthrough = status.Error(codes.Unimplemented, "the stock containerd client does not pass requests through")
+
+// stockRuntime returns the stock runtime client the requests of kubelet
+// that vHive does not handle are passed through to
+func (s *Service) stockRuntime() (criapi.RuntimeServiceClient, error) {
+	client, ok := s.stockRuntimeClient.(criapi.RuntimeServiceClient)
+	if !ok {
+		return nil, errNoPassthrough
+	}
+
+	return client, nil
+}
+
+// stockImage returns the stock image client the image requests of kubelet
+// are passed through to
+func (s *Service) stockImage() (criapi.ImageServiceClient, error) {
+	client, ok := s.stockImageClient.(criapi.ImageServiceClient)
+	if !ok {
+		return nil, errNoPassthrough
+	}
+
+	return client, nil
+}
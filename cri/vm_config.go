@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VMConfig wraps the IP and port of the guest VM
+type VMConfig struct {
+	guestIP   string
+	guestPort string
+	// vsockCID and vsockPath are the vsock device of the VM, empty if the
+	// queue-proxy reaches the guest at its IP
+	vsockCID  uint32
+	vsockPath string
+	// containerID is the user container of the VM, empty until it is created
+	containerID string
+	created     time.Time
+}
+
+// Validate checks that the config holds the IP, or the vsock device, and the
+// port of a booted VM, which are empty if the VM failed to boot
+func (c *VMConfig) Validate() error {
+	switch {
+	case c.vsockPath != "":
+		if c.vsockCID < firstGuestCID {
+			return errors.Errorf("guest CID %d is reserved", c.vsockCID)
+		}
+	case c.guestIP == "":
+		return errors.New("guest IP is empty")
+	case net.ParseIP(c.guestIP) == nil:
+		return errors.Errorf("guest IP %q is invalid", c.guestIP)
+	}
+
+	if port, err := strconv.ParseUint(c.guestPort, 10, 16); err != nil || port == 0 {
+		return errors.Errorf("guest port %q is not a valid port number", c.guestPort)
+	}
+
+	return nil
+}
+
+// String returns the address of the guest for logging
+func (c VMConfig) String() string {
+	if c.vsockPath != "" {
+		return c.vsockAddr()
+	}
+
+	return net.JoinHostPort(c.guestIP, c.guestPort)
+}
+
+// vsockAddr returns the vsock address of the guest, in the vsock://<CID>:<port> form
+func (c VMConfig) vsockAddr() string {
+	return fmt.Sprintf("vsock://%d:%s", c.vsockCID, c.guestPort)
+}
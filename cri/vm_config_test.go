@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		ip    string
+		port  string
+		valid bool
+	}{
+		{"valid", "190.128.0.7", "50051", true},
+		{"IPv6", "fd00::7", "50051", true},
+		{"empty IP", "", "50051", false},
+		{"invalid IP", "190.128.0", "50051", false},
+		{"empty port", "190.128.0.7", "", false},
+		{"non-numeric port", "190.128.0.7", "grpc", false},
+		{"zero port", "190.128.0.7", "0", false},
+		{"port out of range", "190.128.0.7", "65536", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&VMConfig{guestIP: tc.ip, guestPort: tc.port}).Validate()
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVMConfigString(t *testing.T) {
+	vmConfig := &VMConfig{guestIP: "190.128.0.7", guestPort: "50051", containerID: "secret-container"}
+
+	require.Equal(t, "190.128.0.7:50051", vmConfig.String())
+	require.Equal(t, "190.128.0.7:50051", fmt.Sprintf("%v", vmConfig))
+	require.Equal(t, "[fd00::7]:50051", (&VMConfig{guestIP: "fd00::7", guestPort: "50051"}).String())
+	require.Equal(t, "vsock://4:50051", (&VMConfig{vsockCID: 4, vsockPath: "/run/fc/1/firecracker.vsock", guestPort: "50051"}).String())
+}
+
+func TestVMConfigValidateVsock(t *testing.T) {
+	const vsockPath = "/run/fc/1/firecracker.vsock"
+
+	require.NoError(t, (&VMConfig{vsockCID: 4, vsockPath: vsockPath, guestPort: "50051"}).Validate(), "vsock needs no guest IP")
+	require.Error(t, (&VMConfig{vsockCID: 2, vsockPath: vsockPath, guestPort: "50051"}).Validate(), "CID of the host was accepted")
+	require.Error(t, (&VMConfig{vsockCID: 4, vsockPath: vsockPath}).Validate(), "empty port was accepted")
+}
+
+func TestInsertInvalidPodVMConfig(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	// A VM that failed to boot has no IP
+	require.Error(t, s.insertPodVMConfig("pod", &VMConfig{guestPort: defaultGuestPort}))
+
+	_, err := lookupPodVMConfig(s, "pod")
+	require.Error(t, err, "invalid VM config was stored")
+
+	require.NoError(t, s.insertPodVMConfig("pod", &VMConfig{guestIP: "190.128.0.7", guestPort: defaultGuestPort}))
+
+	vmConfig, err := lookupPodVMConfig(s, "pod")
+	require.NoError(t, err)
+	require.Equal(t, "190.128.0.7:50051", vmConfig.String())
+}
@@ -0,0 +1,122 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	log "github.com/sirupsen/logrus"
+)
+
+// VMExitEvent reports a VM that exited without being stopped,
+// e.g., after its guest ran out of memory or crashed
+type VMExitEvent struct {
+	// ContainerID is the user container the VM was attached to, empty if none
+	ContainerID string
+	VMID        string
+	Image       string
+	Revision    string
+	// ExitCode is the exit code of the function in the VM, if known
+	ExitCode uint32
+	// Reason describes why the VM exited
+	Reason string
+	Time   time.Time
+}
+
+// OnVMExit registers fn to be called when a VM exits without being stopped,
+// once its instance is marked dead, so that the function can be rescheduled.
+// The dead VM is stopped when its container is removed.
+func (c *coordinator) OnVMExit(fn func(VMExitEvent)) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.exitHandlers = append(c.exitHandlers, fn)
+}
+
+// OnVMExit registers fn to be called when a VM exits without being stopped,
+// e.g., after its guest ran out of memory or crashed
+func (s *Service) OnVMExit(fn func(VMExitEvent)) {
+	s.coordinator.OnVMExit(fn)
+}
+
+// watchVMExit handles the exit of the VM of an instance in the background
+func (c *coordinator) watchVMExit(fi *funcInstance) {
+	if fi.startVMResponse == nil || fi.startVMResponse.Exited == nil {
+		return
+	}
+
+	go func(exited <-chan ctriface.VMExit, boot int32) {
+		if exit, ok := <-exited; ok {
+			c.vmExited(fi, boot, exit)
+		}
+	}(fi.startVMResponse.Exited, atomic.LoadInt32(&fi.boots))
+}
+
+// vmExited marks the instance of a VM that exited dead, unless the VM was being
+// stopped, offloaded or restarted since the given boot, and reports it to the
+// handlers registered with OnVMExit
+func (c *coordinator) vmExited(fi *funcInstance, boot int32, exit ctriface.VMExit) {
+	// The boot is loaded last, as RestartVM counts the boot before expecting exits again
+	if atomic.LoadInt32(&fi.exitExpected) == 1 || atomic.LoadInt32(&fi.boots) != boot {
+		return
+	}
+	if state, _ := fi.history.get(); state == vmStateOffloaded || state == vmStateStopped {
+		return
+	}
+
+	c.Lock()
+	var containerID string
+	for id, active := range c.activeInstances {
+		if active == fi {
+			containerID = id
+			break
+		}
+	}
+	handlers := append([]func(VMExitEvent){}, c.exitHandlers...)
+	c.Unlock()
+
+	event := VMExitEvent{
+		ContainerID: containerID,
+		VMID:        fi.vmID,
+		Image:       fi.image,
+		Revision:    fi.revisionID,
+		ExitCode:    exit.ExitCode,
+		Reason:      exit.Reason(),
+		Time:        exit.ExitedAt,
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	fi.logger.WithFields(log.Fields{"containerID": containerID, "reason": event.Reason}).Error("VM exited unexpectedly")
+	fi.history.failState(vmStateDead, eventExited, "VM exited unexpectedly: %s", event.Reason)
+	c.auditInstance(context.Background(), auditVMExited, fi, errors.New(event.Reason))
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
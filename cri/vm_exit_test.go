@@ -0,0 +1,111 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestVMExit(t *testing.T) {
+	ctx := context.Background()
+
+	for _, snapshots := range []bool{false, true} {
+		name := "Stop"
+		if snapshots {
+			name = "Snapshots"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			orch := fakes.NewOrchestrator()
+			orch.SnapshotsEnabled = snapshots
+			stock := &fakes.StockRuntimeClient{}
+			s := newTestService(stock, orch)
+
+			events := make(chan VMExitEvent, 1)
+			s.OnVMExit(func(event VMExitEvent) { events <- event })
+
+			resp, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+			require.NoError(t, err, "container creation failed")
+			containerID := resp.GetContainerId()
+
+			orch.Exit("1", ctriface.VMExit{ExitCode: 137})
+
+			var event VMExitEvent
+			select {
+			case event = <-events:
+			case <-time.After(time.Second):
+				t.Fatal("VM exit was not reported")
+			}
+			require.Equal(t, containerID, event.ContainerID)
+			require.Equal(t, "1", event.VMID)
+			require.Equal(t, "img-00001", event.Revision)
+			require.EqualValues(t, 137, event.ExitCode)
+			require.Contains(t, event.Reason, "out of memory")
+
+			active := s.coordinator.ListActive()
+			require.Len(t, active, 1, "dead VM is no longer attached to its container")
+			require.Equal(t, vmStateDead, active[0].State, "VM was not marked dead")
+
+			details, ok := s.coordinator.DescribeInstance(containerID)
+			require.True(t, ok)
+			last := details.Events[len(details.Events)-1]
+			require.Equal(t, eventExited, last.Type)
+			require.True(t, last.Warning, "exit of the VM is not a warning")
+
+			// The dead VM is stopped rather than offloaded once kubelet removes its container
+			_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: containerID})
+			require.NoError(t, err, "container removal failed")
+			require.Eventually(t, func() bool { return orch.NumStopped("1") == 1 }, time.Second, 10*time.Millisecond,
+				"dead VM was not stopped")
+			require.Empty(t, s.coordinator.ListInstances(), "dead VM was kept idle")
+		})
+	}
+
+	t.Run("ExpectedExit", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+		events := make(chan VMExitEvent, 1)
+		s.OnVMExit(func(event VMExitEvent) { events <- event })
+
+		resp, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+		_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: resp.GetContainerId()})
+		require.NoError(t, err, "container removal failed")
+		require.Eventually(t, func() bool { return orch.NumStopped("1") == 1 }, time.Second, 10*time.Millisecond,
+			"VM was not stopped")
+
+		select {
+		case event := <-events:
+			t.Fatalf("exit of a stopped VM was reported: %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,157 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// vmIDBlock is the number of vmIDs reserved in the state file at once, so
+	// that it is not written at every start of a VM. The vmIDs reserved but
+	// not allocated before a restart of the daemon are skipped.
+	vmIDBlock = 1000
+	// maxVMIDAttempts bounds the vmIDs skipped for being used by running VMs
+	maxVMIDAttempts = 100
+)
+
+// ErrVMIDCollision is the failure to allocate a vmID unused by the VMs on the node
+var ErrVMIDCollision = errors.New("no unused vmID")
+
+// vmIDAllocator allocates the vmIDs of the VMs as a counter, which keeps
+// increasing across the restarts of the daemon if its state file is set
+type vmIDAllocator struct {
+	sync.Mutex
+
+	// last is the last vmID allocated, and reserved the last one
+	// reserved in the state file
+	last     uint64
+	reserved uint64
+	// path is the state file, empty if the counter is not persisted
+	path string
+}
+
+// newVMIDAllocator returns an allocator continuing from the vmIDs reserved
+// in the state file at path, from 1 if there is none or the path is empty
+func newVMIDAllocator(path string) (*vmIDAllocator, error) {
+	a := &vmIDAllocator{path: path}
+	if path == "" {
+		return a, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		// The first start of the daemon, or one that counted from 1 at every
+		// start, whose VMs still running are skipped as collisions
+		return a, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "failed to read the vmID state")
+	}
+
+	if a.last, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		return nil, errors.Wrapf(err, "invalid vmID state in %s", path)
+	}
+	a.reserved = a.last
+
+	return a, nil
+}
+
+// allocate returns the next vmID, reserving a block of vmIDs in the state
+// file when the reserved ones are used up
+func (a *vmIDAllocator) allocate() (string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	next := a.last + 1
+	if a.path != "" && next > a.reserved {
+		reserved := a.last + vmIDBlock
+		if err := writeFileAtomic(a.path, strings.NewReader(strconv.FormatUint(reserved, 10)+"\n"), -1); err != nil {
+			return "", errors.Wrapf(err, "failed to reserve vmIDs up to %d", reserved)
+		}
+		a.reserved = reserved
+	}
+	a.last = next
+
+	return strconv.FormatUint(next, 10), nil
+}
+
+// newVMID allocates the vmID of a new VM, skipping the ones of the VMs that
+// the orchestrator runs or the coordinator keeps, e.g., the VMs left by a
+// daemon whose vmIDs restarted from 1
+func (c *coordinator) newVMID(logger *log.Entry) (string, error) {
+	for i := 0; i < maxVMIDAttempts; i++ {
+		vmID, err := c.vmIDs.allocate()
+		if err != nil {
+			return "", err
+		}
+
+		if !c.vmIDInUse(vmID) {
+			return vmID, nil
+		}
+		logger.WithField("vmID", vmID).Warn("vmID is used by another VM, skipping it")
+	}
+
+	return "", errors.Wrapf(ErrVMIDCollision, "%d vmIDs in a row are used by other VMs", maxVMIDAttempts)
+}
+
+// vmIDInUse returns whether a VM of the orchestrator or an instance of the
+// coordinator, including the offloaded ones, has the vmID
+func (c *coordinator) vmIDInUse(vmID string) bool {
+	if c.orch != nil && !c.withoutOrchestrator && c.orch.HasVM(vmID) {
+		return true
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, fi := range c.activeInstances {
+		if fi.vmID == vmID {
+			return true
+		}
+	}
+	for _, instances := range c.idleInstances {
+		for _, fi := range instances {
+			if fi.vmID == vmID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WithVMIDState persists the counter of the vmIDs in the state file at path,
+// so that the vmIDs keep increasing across the restarts of the daemon
+func WithVMIDState(path string) ServiceOption {
+	return func(s *Service) {
+		s.vmIDStatePath = path
+	}
+}
@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMIDAllocatorRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vmid")
+
+	a, err := newVMIDAllocator(path)
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		vmID, err := a.allocate()
+		require.NoError(t, err)
+		require.Equal(t, strconv.Itoa(i), vmID)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "1000\n", string(data), "a block of vmIDs must be reserved")
+
+	// The vmIDs reserved before the restart are never allocated again
+	a, err = newVMIDAllocator(path)
+	require.NoError(t, err)
+	vmID, err := a.allocate()
+	require.NoError(t, err)
+	require.Equal(t, "1001", vmID)
+
+	for i := 0; i < vmIDBlock; i++ {
+		_, err = a.allocate()
+		require.NoError(t, err)
+	}
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "3000\n", string(data), "the next block must be reserved once the block is used up")
+}
+
+func TestVMIDAllocatorState(t *testing.T) {
+	dir := t.TempDir()
+
+	// A node without state counted from 1 at every start
+	a, err := newVMIDAllocator(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	vmID, err := a.allocate()
+	require.NoError(t, err)
+	require.Equal(t, "1", vmID)
+
+	path := filepath.Join(dir, "invalid")
+	require.NoError(t, ioutil.WriteFile(path, []byte("not a vmID\n"), 0600))
+	_, err = newVMIDAllocator(path)
+	require.Error(t, err, "an invalid state must be rejected")
+
+	// Without state file, nothing is persisted
+	a, err = newVMIDAllocator("")
+	require.NoError(t, err)
+	vmID, err = a.allocate()
+	require.NoError(t, err)
+	require.Equal(t, "1", vmID)
+}
+
+func TestStartVMRestartContinuity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vmid")
+	orch := fakes.NewOrchestrator()
+
+	c := newCoordinator(orch)
+	var err error
+	c.vmIDs, err = newVMIDAllocator(path)
+	require.NoError(t, err)
+
+	fi, err := c.startVM(context.Background(), "img")
+	require.NoError(t, err)
+	require.Equal(t, "1", fi.vmID)
+
+	// The VM keeps running while the daemon restarts
+	c = newCoordinator(orch)
+	c.vmIDs, err = newVMIDAllocator(path)
+	require.NoError(t, err)
+
+	fi, err = c.startVM(context.Background(), "img")
+	require.NoError(t, err)
+	require.Equal(t, "1001", fi.vmID)
+	require.Equal(t, 1, orch.Started["1"], "the running VM must not be started again")
+}
+
+func TestStartVMIDCollision(t *testing.T) {
+	orch := fakes.NewOrchestrator()
+	// The VMs left by a daemon whose vmIDs restarted from 1
+	orch.Live = map[string]bool{"1": true, "2": true}
+	c := newCoordinator(orch)
+
+	fi, err := c.startVM(context.Background(), "img")
+	require.NoError(t, err)
+	require.Equal(t, "3", fi.vmID, "the vmIDs of the running VMs must be skipped")
+
+	for i := 4; i < 4+maxVMIDAttempts; i++ {
+		orch.Live[strconv.Itoa(i)] = true
+	}
+	_, err = c.startVM(context.Background(), "img")
+	require.True(t, errors.Is(err, ErrVMIDCollision), "unexpected error %v", err)
+	require.Equal(t, 1, orch.NumStarted())
+}
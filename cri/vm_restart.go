@@ -0,0 +1,181 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RestartVM force-restarts the VM of a container in place, stopping its
+// Firecracker process and booting a fresh one from the same revision that
+// keeps the tap and thus the IP of the VM, e.g., to recover a wedged guest.
+// The VM is left as it was if the image of its revision is gone, while a VM
+// that fails to boot again is dead until its container is removed.
+func (c *coordinator) RestartVM(ctx context.Context, containerID string) (*metrics.Metric, error) {
+	c.Lock()
+	fi, ok := c.activeInstances[containerID]
+	c.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %s not found", containerID)
+	}
+
+	fi.opMu.Lock()
+	defer fi.opMu.Unlock()
+
+	switch state, _ := fi.history.get(); state {
+	case vmStateRunning, vmStateDead:
+	case vmStateStopped:
+		return nil, status.Errorf(codes.NotFound, "container %s not found", containerID)
+	default:
+		return nil, illegalTransition(fi, "restart", state)
+	}
+	if c.withoutOrchestrator {
+		return nil, status.Error(codes.FailedPrecondition, "restarting VMs requires the orchestrator")
+	}
+
+	cfg := c.config.get()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, cfg.StartTimeout)
+	defer cancel()
+
+	fi.logger.Info("restarting VM in place")
+
+	// The restarted VM is not boosted, the boost of its cold start having ended
+	opts := []ctriface.StartVMOption{ctriface.WithStartVMOptions(*fi.vmOpts), ctriface.WithCPUBoost(0, 0)}
+
+	tStart := time.Now()
+	atomic.StoreInt32(&fi.exitExpected, 1)
+	resp, m, err := c.orch.RestartVM(ctxTimeout, fi.vmID, fi.image, opts...)
+	c.auditInstance(ctx, auditVMRestarted, fi, err)
+	if err != nil {
+		return nil, c.vmRestartFailed(fi, err)
+	}
+
+	if fi.agent != nil {
+		if err := fi.agent.Close(); err != nil {
+			fi.logger.WithError(err).Warn("failed to close guest agent channel")
+		}
+		fi.agent = nil
+	}
+
+	atomic.AddInt32(&fi.boots, 1)
+	fi.startVMResponse = resp
+	atomic.StoreInt32(&fi.exitExpected, 0)
+
+	// The fresh VM has the resources it was started with and a clean health record
+	atomic.StoreUint32(&fi.memTargetMib, 0)
+	atomic.StoreInt64(&fi.cpuMillis, 0)
+	atomic.StoreInt32(&fi.healthFailures, 0)
+	atomic.StoreInt32(&fi.probeFailures, 0)
+
+	c.connectAgent(fi)
+	if fi.agent != nil {
+		if err := c.waitAgentReady(ctx, fi, cfg.AgentReadyTimeout); err != nil {
+			fi.logger.WithError(err).Warn("guest agent did not become ready")
+		}
+	}
+
+	d := time.Since(tStart)
+	fi.history.setState(vmStateRunning, eventRestarted, "VM restarted in place in %s", d.Round(time.Millisecond))
+	fi.history.started(bootCold, d)
+	c.watchVMExit(fi)
+
+	fi.logger.WithField("guestIP", resp.GuestIP).Info("restarted VM in place")
+
+	return m, nil
+}
+
+// vmRestartFailed handles a VM that failed to restart, which the orchestrator
+// either left as it was or released, and returns the error to report
+func (c *coordinator) vmRestartFailed(fi *funcInstance, err error) error {
+	if c.orch.HasVM(fi.vmID) {
+		atomic.StoreInt32(&fi.exitExpected, 0)
+		fi.logger.WithError(err).Error("failed to restart VM, left as it was")
+
+		if errors.Is(err, ctriface.ErrImageGone) {
+			return status.Errorf(codes.FailedPrecondition, "cannot restart VM %s, the image %s of its revision is gone: %v", fi.vmID, fi.image, err)
+		}
+		return err
+	}
+
+	fi.logger.WithError(err).Error("failed to restart VM, the VM is dead")
+	atomic.StoreInt32(&fi.vmReleased, 1)
+	fi.history.failState(vmStateDead, eventRestarted, "VM failed to restart: %v", err)
+
+	return err
+}
+
+// RestartVM force-restarts the VM of a container in place, keeping its IP
+func (s *Service) RestartVM(ctx context.Context, containerID string) (*metrics.Metric, error) {
+	return s.coordinator.RestartVM(withAuditActor(ctx, AuditActorAdmin), containerID)
+}
+
+// serveRestart restarts the VM of the ?container= in place on POST, and
+// reports the restarted VM as JSON
+func (s *Service) serveRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	containerID := r.FormValue("container")
+	if containerID == "" {
+		http.Error(w, "missing container", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.RestartVM(r.Context(), containerID); err != nil {
+		http.Error(w, err.Error(), restartHTTPStatus(err))
+		return
+	}
+
+	for _, vm := range s.coordinator.ListActive() {
+		if vm.ContainerID == containerID {
+			writeJSON(w, vm)
+			return
+		}
+	}
+
+	http.Error(w, "container "+containerID+" was removed during the restart", http.StatusNotFound)
+}
+
+// restartHTTPStatus returns the HTTP status of the error of a restart
+func restartHTTPStatus(err error) int {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,197 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ease-lab/vhive/cri/fakes"
+	"github.com/ease-lab/vhive/ctriface"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestRestartVM(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("KeepsIP", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+		events := make(chan VMExitEvent, 1)
+		s.OnVMExit(func(event VMExitEvent) { events <- event })
+
+		req := newUserContainerRequest("pod", "img")
+		req.Config.Envs = append(req.Config.Envs, &criapi.KeyValue{Key: guestSwapEnv, Value: "64"})
+		_, err := s.CreateContainer(ctx, req)
+		require.NoError(t, err, "container creation failed")
+
+		fi := s.coordinator.activeInstances["ctr1"]
+		before := fi.startVMResponse
+
+		m, err := s.RestartVM(ctx, "ctr1")
+		require.NoError(t, err, "restart failed")
+		require.Contains(t, m.MetricMap, "StopVM")
+		require.Equal(t, 1, orch.Restarted["1"])
+		require.Equal(t, uint32(64), orch.StartOpts["1"].GuestSwapMib, "VM was restarted with other options")
+
+		require.NotSame(t, before, fi.startVMResponse, "process handle of the VM was not updated")
+		require.NotEqual(t, before.Exited, fi.startVMResponse.Exited)
+		require.Equal(t, before.GuestIP, fi.startVMResponse.GuestIP, "restarted VM got another IP")
+
+		active := s.coordinator.ListActive()
+		require.Len(t, active, 1)
+		require.Equal(t, "190.128.0.1", active[0].GuestIP)
+		require.Equal(t, vmStateRunning, active[0].State)
+
+		details, ok := s.coordinator.DescribeInstance("ctr1")
+		require.True(t, ok)
+		var restarted bool
+		for _, event := range details.Events {
+			restarted = restarted || event.Type == eventRestarted
+		}
+		require.True(t, restarted, "restart was not recorded")
+
+		// The exit of the stopped process is not a crash, unlike the one of the fresh process
+		select {
+		case event := <-events:
+			t.Fatalf("exit of the restarted process was reported: %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		orch.Exit("1", ctriface.VMExit{ExitCode: 137})
+		select {
+		case event := <-events:
+			require.Equal(t, "ctr1", event.ContainerID)
+		case <-time.After(time.Second):
+			t.Fatal("exit of the fresh process was not reported")
+		}
+	})
+
+	t.Run("ImageGone", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		orch.Images = map[string]bool{}
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+		events := make(chan VMExitEvent, 1)
+		s.OnVMExit(func(event VMExitEvent) { events <- event })
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+
+		fi := s.coordinator.activeInstances["ctr1"]
+		before := fi.startVMResponse
+
+		delete(orch.Images, "img")
+		_, err = s.RestartVM(ctx, "ctr1")
+		require.Error(t, err, "VM restarted without its image")
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Contains(t, err.Error(), "image img of its revision is gone")
+
+		require.Same(t, before, fi.startVMResponse, "VM left as it was changed")
+		require.Equal(t, vmStateRunning, s.coordinator.ListActive()[0].State)
+		require.Zero(t, orch.NumStopped("1"))
+
+		// The VM left as it was is still watched
+		orch.Exit("1", ctriface.VMExit{ExitCode: 137})
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("exit of the VM was not reported")
+		}
+	})
+
+	t.Run("BootFails", func(t *testing.T) {
+		orch := fakes.NewOrchestrator()
+		s := newTestService(&fakes.StockRuntimeClient{}, orch)
+
+		_, err := s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+
+		orch.StartErr = errInjected
+		_, err = s.RestartVM(ctx, "ctr1")
+		require.ErrorIs(t, err, errInjected)
+		require.Equal(t, vmStateDead, s.coordinator.ListActive()[0].State, "VM that failed to restart is not dead")
+
+		// The VM released by the orchestrator is not stopped again
+		_, err = s.RemoveContainer(ctx, &criapi.RemoveContainerRequest{ContainerId: "ctr1"})
+		require.NoError(t, err, "container removal failed")
+		require.Eventually(t, func() bool { return len(s.coordinator.ListActive()) == 0 }, time.Second, 10*time.Millisecond,
+			"dead VM was not removed")
+		require.Never(t, func() bool { return orch.NumStopped("1") > 1 }, 50*time.Millisecond, 10*time.Millisecond,
+			"released VM was stopped")
+	})
+
+	t.Run("NotRunning", func(t *testing.T) {
+		s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+		_, err := s.RestartVM(ctx, "ctr1")
+		require.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = s.CreateContainer(ctx, newUserContainerRequest("pod", "img"))
+		require.NoError(t, err, "container creation failed")
+		_, err = s.coordinator.PauseInstance(ctx, "ctr1")
+		require.NoError(t, err, "pause failed")
+
+		_, err = s.RestartVM(ctx, "ctr1")
+		require.Equal(t, codes.FailedPrecondition, status.Code(err), "paused VM was restarted")
+	})
+}
+
+func TestDebugRestart(t *testing.T) {
+	s := newTestService(&fakes.StockRuntimeClient{}, fakes.NewOrchestrator())
+
+	_, err := s.CreateContainer(context.Background(), newUserContainerRequest("pod", "img"))
+	require.NoError(t, err, "container creation failed")
+
+	server := httptest.NewServer(s.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/restart?container=ctr1")
+	require.NoError(t, err, "request failed")
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/debug/restart?container=ctr2", "", nil)
+	require.NoError(t, err, "request failed")
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/debug/restart?container=ctr1", "", nil)
+	require.NoError(t, err, "request failed")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var vm VMInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&vm))
+	require.Equal(t, "ctr1", vm.ContainerID)
+	require.Equal(t, "190.128.0.1", vm.GuestIP)
+	require.Equal(t, vmStateRunning, vm.State)
+}
@@ -0,0 +1,235 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	cpuCgroupRoot = "/sys/fs/cgroup/cpu"
+	// defaultJailerCgroup is the parent cgroup of the jailed VMs in firecracker-containerd
+	defaultJailerCgroup = "/firecracker-containerd"
+	cfsPeriodFile       = "cpu.cfs_period_us"
+	cfsQuotaFile        = "cpu.cfs_quota_us"
+)
+
+// cpuBoost is the state of the boost of a VM, the timer is nil once it ended
+type cpuBoost struct {
+	dir     string
+	steady  int64
+	start   time.Time
+	stop    func() bool
+	boosted time.Duration
+}
+
+// cpuBooster raises the CFS quota of the cgroups of the jailed VMs during
+// their cold start and throttles them down to their vCPU count afterwards
+type cpuBooster struct {
+	sync.Mutex
+
+	root      string
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+	boosts    map[string]*cpuBoost
+}
+
+func newCPUBooster(root string) *cpuBooster {
+	return &cpuBooster{
+		root: root,
+		now:  time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+		boosts: make(map[string]*cpuBoost),
+	}
+}
+
+// start sets the quota of the VM in the given cgroup to factor times its
+// vCPU count until the window elapses or the boost is ended
+func (b *cpuBooster) start(vmID, cgroup string, vcpus uint32, factor float64, window time.Duration) error {
+	dir := filepath.Join(b.root, cgroup)
+
+	period, err := readCgroupInt(filepath.Join(dir, cfsPeriodFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the CFS period")
+	}
+
+	boost := &cpuBoost{dir: dir, steady: int64(vcpus) * period}
+	if err := writeCgroupInt(filepath.Join(dir, cfsQuotaFile), int64(factor*float64(boost.steady))); err != nil {
+		return errors.Wrap(err, "failed to boost the CFS quota")
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	boost.start = b.now()
+	boost.stop = b.afterFunc(window, func() {
+		if _, err := b.end(vmID); err != nil {
+			log.WithError(err).WithField("vmID", vmID).Error("failed to end CPU boost")
+		}
+	})
+	b.boosts[vmID] = boost
+
+	return nil
+}
+
+// end throttles the VM down to its steady quota if it is still boosted
+// and returns how long it was boosted
+func (b *cpuBooster) end(vmID string) (time.Duration, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	boost, ok := b.boosts[vmID]
+	if !ok {
+		return 0, errors.Errorf("VM %s was not boosted", vmID)
+	}
+
+	if boost.stop == nil {
+		return boost.boosted, nil
+	}
+
+	boost.stop()
+	boost.stop = nil
+	boost.boosted = b.now().Sub(boost.start)
+
+	if err := writeCgroupInt(filepath.Join(boost.dir, cfsQuotaFile), boost.steady); err != nil {
+		return boost.boosted, errors.Wrap(err, "failed to restore the CFS quota")
+	}
+
+	return boost.boosted, nil
+}
+
+// setSteady sets the quota the VM in the given cgroup is throttled down to
+// after its boost to the given number of CPUs. The quota is applied right
+// away unless the VM is still boosted.
+func (b *cpuBooster) setSteady(vmID, cgroup string, cpus float64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	boost, ok := b.boosts[vmID]
+	if !ok || boost.stop == nil {
+		return setCPUQuota(filepath.Join(b.root, cgroup), cpus)
+	}
+
+	period, err := readCgroupInt(filepath.Join(boost.dir, cfsPeriodFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the CFS period")
+	}
+	boost.steady = int64(cpus * float64(period))
+
+	return nil
+}
+
+// forget drops the boost of a stopped VM
+func (b *cpuBooster) forget(vmID string) {
+	b.Lock()
+	defer b.Unlock()
+
+	if boost, ok := b.boosts[vmID]; ok && boost.stop != nil {
+		boost.stop()
+	}
+	delete(b.boosts, vmID)
+}
+
+// startCPUBoost boosts the freshly created VM if requested, boosting is best
+// effort since the VM can serve without it
+func (o *Orchestrator) startCPUBoost(vmID string, vmOpts *StartVMOptions, logger *log.Entry) {
+	if vmOpts.CPUBoostFactor <= 1 {
+		return
+	}
+
+	if o.cpuBoost == nil || o.jailer == nil {
+		logger.Warn("CPU boost requires the jailer and CPU boosting, booting without boost")
+		return
+	}
+
+	err := o.cpuBoost.start(vmID, o.vmCgroup(vmID), vmOpts.VcpuCount, vmOpts.CPUBoostFactor, vmOpts.CPUBoostWindow)
+	if err != nil {
+		logger.WithError(err).Warn("failed to boost CPU, booting without boost")
+	}
+}
+
+// EndCPUBoost Throttles down a VM boosted during its cold start, typically
+// once it served its first response, and returns the time spent boosted
+func (o *Orchestrator) EndCPUBoost(vmID string) (*metrics.Metric, error) {
+	if o.cpuBoost == nil {
+		return nil, errors.New("CPU boost is disabled")
+	}
+
+	boosted, err := o.cpuBoost.end(vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := metrics.NewMetric()
+	m.MetricMap[metrics.CPUBoost] = metrics.ToUS(boosted)
+
+	return m, nil
+}
+
+// vmCgroup returns the cgroup of a jailed VM, relative to the cgroup root
+func (o *Orchestrator) vmCgroup(vmID string) string {
+	cgroup := o.jailer.cfg.CgroupPath
+	if cgroup == "" {
+		cgroup = defaultJailerCgroup
+	}
+
+	return filepath.Join(cgroup, vmID)
+}
+
+// setCPUQuota sets the CFS quota of the cgroup in the given directory to the given number of CPUs
+func setCPUQuota(dir string, cpus float64) error {
+	period, err := readCgroupInt(filepath.Join(dir, cfsPeriodFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the CFS period")
+	}
+
+	if err := writeCgroupInt(filepath.Join(dir, cfsQuotaFile), int64(cpus*float64(period))); err != nil {
+		return errors.Wrap(err, "failed to set the CFS quota")
+	}
+
+	return nil
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func writeCgroupInt(path string, value int64) error {
+	return ioutil.WriteFile(path, []byte(strconv.FormatInt(value, 10)), 0644)
+}
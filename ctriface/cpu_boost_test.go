@@ -0,0 +1,151 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock drives the timers of a cpuBooster by hand
+type fakeClock struct {
+	now     time.Time
+	pending map[int]func()
+	nextID  int
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), pending: make(map[int]func())}
+}
+
+func (c *fakeClock) afterFunc(d time.Duration, f func()) func() bool {
+	id := c.nextID
+	c.nextID++
+	c.pending[id] = f
+
+	return func() bool {
+		_, ok := c.pending[id]
+		delete(c.pending, id)
+		return ok
+	}
+}
+
+// advance moves the clock and fires all the pending timers
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+
+	for id, f := range c.pending {
+		delete(c.pending, id)
+		f()
+	}
+}
+
+func newTestCPUBooster(t *testing.T, clock *fakeClock) (*cpuBooster, string) {
+	root := t.TempDir()
+	cgroup := filepath.Join(defaultJailerCgroup, "1")
+
+	dir := filepath.Join(root, cgroup)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, cfsPeriodFile), []byte("100000\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, cfsQuotaFile), []byte("-1\n"), 0644))
+
+	b := newCPUBooster(root)
+	b.now = func() time.Time { return clock.now }
+	b.afterFunc = clock.afterFunc
+
+	return b, dir
+}
+
+func readQuota(t *testing.T, dir string) int64 {
+	quota, err := readCgroupInt(filepath.Join(dir, cfsQuotaFile))
+	require.NoError(t, err, "Failed to read CFS quota")
+
+	return quota
+}
+
+func TestCPUBoostWindowElapses(t *testing.T) {
+	clock := newFakeClock()
+	b, dir := newTestCPUBooster(t, clock)
+
+	require.NoError(t, b.start("1", filepath.Join(defaultJailerCgroup, "1"), 2, 1.5, 10*time.Second))
+	require.Equal(t, int64(300000), readQuota(t, dir), "CPU quota was not boosted")
+
+	clock.advance(10 * time.Second)
+	require.Equal(t, int64(200000), readQuota(t, dir), "CPU quota was not throttled down")
+
+	boosted, err := b.end("1")
+	require.NoError(t, err, "Failed to end CPU boost")
+	require.Equal(t, 10*time.Second, boosted, "Wrong time spent boosted")
+	require.Equal(t, int64(200000), readQuota(t, dir), "CPU quota changed after the boost")
+}
+
+func TestCPUBoostEndsOnFirstResponse(t *testing.T) {
+	clock := newFakeClock()
+	b, dir := newTestCPUBooster(t, clock)
+
+	require.NoError(t, b.start("1", filepath.Join(defaultJailerCgroup, "1"), 1, 4, 10*time.Second))
+	require.Equal(t, int64(400000), readQuota(t, dir), "CPU quota was not boosted")
+
+	clock.now = clock.now.Add(3 * time.Second)
+	boosted, err := b.end("1")
+	require.NoError(t, err, "Failed to end CPU boost")
+	require.Equal(t, 3*time.Second, boosted, "Wrong time spent boosted")
+	require.Equal(t, int64(100000), readQuota(t, dir), "CPU quota was not throttled down")
+	require.Empty(t, clock.pending, "Boost timer was not stopped")
+
+	b.forget("1")
+	_, err = b.end("1")
+	require.Error(t, err, "Boost of a stopped VM was ended")
+}
+
+func TestCPUBoostMissingCgroup(t *testing.T) {
+	b := newCPUBooster(t.TempDir())
+
+	require.Error(t, b.start("1", filepath.Join(defaultJailerCgroup, "1"), 1, 2, time.Second), "VM without cgroup was boosted")
+	_, err := b.end("1")
+	require.Error(t, err, "Boost of a VM without cgroup was ended")
+}
+
+func TestCPUBoostSetSteady(t *testing.T) {
+	clock := newFakeClock()
+	b, dir := newTestCPUBooster(t, clock)
+	cgroup := filepath.Join(defaultJailerCgroup, "1")
+
+	// The steady quota of a boosted VM is applied once the boost ends
+	require.NoError(t, b.start("1", cgroup, 2, 2, 10*time.Second))
+	require.NoError(t, b.setSteady("1", cgroup, 0.5))
+	require.Equal(t, int64(400000), readQuota(t, dir), "boosted CPU quota was changed")
+
+	_, err := b.end("1")
+	require.NoError(t, err, "Failed to end CPU boost")
+	require.Equal(t, int64(50000), readQuota(t, dir), "CPU quota was not throttled down to the new steady quota")
+
+	// The quota of a VM no longer boosted is applied right away
+	require.NoError(t, b.setSteady("1", cgroup, 1.5))
+	require.Equal(t, int64(150000), readQuota(t, dir), "CPU quota was not set")
+}
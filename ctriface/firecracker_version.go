@@ -0,0 +1,47 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runtimeFirecrackerBinary is the firecracker binary of the firecracker-containerd
+// runtime config (firecracker_binary_path), which launches all the VMs
+const runtimeFirecrackerBinary = "/usr/local/bin/firecracker"
+
+// checkFirecrackerBinary rejects the VMs selecting another firecracker binary
+// than the one of the runtime: firecracker-containerd launches the binary of
+// its runtime config and cannot select one per VM
+func checkFirecrackerBinary(vmOpts *StartVMOptions) error {
+	if vmOpts.FirecrackerBinary == "" || filepath.Clean(vmOpts.FirecrackerBinary) == runtimeFirecrackerBinary {
+		return nil
+	}
+
+	return status.Errorf(codes.Unimplemented,
+		"firecracker %s (%s) cannot be selected per VM, firecracker-containerd launches %s",
+		vmOpts.FirecrackerVersion, vmOpts.FirecrackerBinary, runtimeFirecrackerBinary)
+}
@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/pkg/errors"
+)
+
+const (
+	// guestSwapFile is the path of the swap file in the rootfs of a function
+	guestSwapFile = "/swapfile"
+	// guestSwapFileEnv tells the function the path of its swap file, which
+	// the function enables, e.g., with swapon in its entrypoint
+	guestSwapFileEnv = "VHIVE_SWAP_FILE"
+)
+
+// The layout of the header of a Linux swap area, see union swap_header in linux/swap.h
+const (
+	swapSignature      = "SWAPSPACE2"
+	swapVersion        = 1
+	swapVersionOffset  = 1024
+	swapLastPageOffset = swapVersionOffset + 4
+)
+
+// ErrGuestSwapTooLarge is returned by StartVM when the swap file of a VM
+// started WithGuestSwap does not fit in the free space of its rootfs
+var ErrGuestSwapTooLarge = errors.New("guest swap does not fit in the rootfs")
+
+// provisionGuestSwap Creates the swap file of a VM in the rootfs snapshot of
+// its function, before the rootfs is attached to the VM
+func (o *Orchestrator) provisionGuestSwap(ctx context.Context, vmID string, mib uint32) error {
+	if o.rootfsMode == RootfsOverlay {
+		return errors.New("guest swap requires a writable rootfs, not the overlay rootfs mode")
+	}
+
+	mounts, err := o.client.SnapshotService(o.snapshotter).Mounts(ctx, vmID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the mounts of the rootfs")
+	}
+
+	return mount.WithTempMount(ctx, mounts, func(root string) error {
+		return createSwapFile(filepath.Join(root, guestSwapFile), mib)
+	})
+}
+
+// createSwapFile Creates a swap area of the given size in a new file at path,
+// failing with ErrGuestSwapTooLarge if it does not fit in its filesystem
+func createSwapFile(path string, mib uint32) (retErr error) {
+	size := int64(mib) << 20
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(path), &st); err != nil {
+		return errors.Wrap(err, "failed to get the size of the rootfs")
+	}
+	if free := int64(st.Bavail) * int64(st.Bsize); size > free {
+		return errors.Wrapf(ErrGuestSwapTooLarge, "%d MiB requested, %d MiB free", mib, free>>20)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the swap file")
+	}
+	defer func() {
+		if err := f.Close(); retErr == nil {
+			retErr = err
+		}
+		if retErr != nil {
+			os.Remove(path)
+		}
+	}()
+
+	// The kernel refuses swap files with holes, so the file is allocated rather than truncated
+	if err := syscall.Fallocate(int(f.Fd()), 0, 0, size); err != nil {
+		return errors.Wrap(err, "failed to allocate the swap file")
+	}
+
+	if _, err := f.WriteAt(swapHeader(size, os.Getpagesize()), 0); err != nil {
+		return errors.Wrap(err, "failed to write the swap header")
+	}
+
+	return f.Sync()
+}
+
+// swapHeader returns the first page of a swap area of the given size, as mkswap writes it
+func swapHeader(size int64, pageSize int) []byte {
+	header := make([]byte, pageSize)
+	binary.LittleEndian.PutUint32(header[swapVersionOffset:], swapVersion)
+	binary.LittleEndian.PutUint32(header[swapLastPageOffset:], uint32(size/int64(pageSize)-1))
+	copy(header[pageSize-len(swapSignature):], swapSignature)
+
+	return header
+}
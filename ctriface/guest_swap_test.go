@@ -0,0 +1,79 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSwapFile(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, guestSwapFile)
+
+	require.NoError(t, createSwapFile(path, 4), "failed to create swap file")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err, "swap file is missing")
+	require.EqualValues(t, 4<<20, info.Size(), "wrong size of the swap file")
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm(), "swap file is readable by others")
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	pageSize := os.Getpagesize()
+	require.Equal(t, swapSignature, string(data[pageSize-len(swapSignature):pageSize]), "no swap signature")
+	require.EqualValues(t, swapVersion, binary.LittleEndian.Uint32(data[swapVersionOffset:]))
+	require.EqualValues(t, 4<<20/pageSize-1, binary.LittleEndian.Uint32(data[swapLastPageOffset:]), "wrong last page")
+
+	// An existing file is not overwritten
+	require.Error(t, createSwapFile(path, 4), "existing file was overwritten")
+}
+
+func TestCreateSwapFileTooLarge(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, guestSwapFile)
+
+	err := createSwapFile(path, 1<<31)
+	require.True(t, errors.Is(err, ErrGuestSwapTooLarge), "oversized swap file was created: %v", err)
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "oversized swap file was left behind")
+}
+
+func TestGetContainerEnvSwap(t *testing.T) {
+	env := []string{"PORT=50051"}
+
+	require.Equal(t, env, getContainerEnv(NewStartVMOptions(WithEnv(env))), "env changed without swap")
+	require.Equal(t, env, getContainerEnv(NewStartVMOptions(WithEnv(env), WithGuestSwap(0))), "env changed without swap")
+
+	withSwap := getContainerEnv(NewStartVMOptions(WithEnv(env), WithGuestSwap(64)))
+	require.Equal(t, []string{"PORT=50051", guestSwapFileEnv + "=" + guestSwapFile}, withSwap)
+	require.Equal(t, []string{"PORT=50051"}, env, "env of the options was modified")
+}
@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/ease-lab/vhive/taps"
+	"github.com/pkg/errors"
+)
+
+// healthSnapshotKey is the snapshot looked up to check that the snapshotter
+// responds, which is never created
+const healthSnapshotKey = "vhive-health-check"
+
+// CheckSnapshotter checks that the snapshotter of the rootfs of the VMs responds
+func (o *Orchestrator) CheckSnapshotter(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	_, err := o.client.SnapshotService(o.snapshotter).Stat(ctx, healthSnapshotKey)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return errors.Wrapf(err, "snapshotter %s does not respond", o.snapshotter)
+	}
+
+	return nil
+}
+
+// CheckNetwork checks that the subnets of the VMs have addresses left for new
+// VMs, including those of the prepared taps. The addresses allocated by CNI
+// are not checked.
+func (o *Orchestrator) CheckNetwork(ctx context.Context) error {
+	if free, ok := o.vmPool.FreeAddresses(); ok && free+o.vmPool.PreparedTapStats().Ready == 0 {
+		return errors.Wrap(taps.ErrAddressesExhausted, "no address left for new VMs")
+	}
+
+	return nil
+}
+
+// CheckDevmapperPool checks that the data and the metadata of the devmapper
+// thin pool the rootfs of the VMs are snapshotted into are used below the
+// threshold, a fraction of their size
+func CheckDevmapperPool(ctx context.Context, pool string, threshold float64) error {
+	out, err := exec.CommandContext(ctx, "dmsetup", "status", pool).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the status of thin pool %s: %s", pool, strings.TrimSpace(string(out)))
+	}
+
+	data, metadata, err := parseThinPoolUsage(string(out))
+	if err != nil {
+		return errors.Wrapf(err, "thin pool %s", pool)
+	}
+
+	if data >= threshold {
+		return errors.Errorf("thin pool %s has %.1f%% of its data used, above %.1f%%", pool, 100*data, 100*threshold)
+	}
+	if metadata >= threshold {
+		return errors.Errorf("thin pool %s has %.1f%% of its metadata used, above %.1f%%", pool, 100*metadata, 100*threshold)
+	}
+
+	return nil
+}
+
+// parseThinPoolUsage returns the fractions of the data and the metadata
+// blocks of a thin pool in use from its dmsetup status, e.g.,
+// "0 209715200 thin-pool 1 1019/4161600 1/1638400 - rw discard_passdown ..."
+func parseThinPoolUsage(status string) (data, metadata float64, err error) {
+	fields := strings.Fields(status)
+	if len(fields) < 6 || fields[2] != "thin-pool" {
+		return 0, 0, errors.Errorf("unexpected thin pool status %q", strings.TrimSpace(status))
+	}
+
+	if metadata, err = parseBlockUsage(fields[4]); err != nil {
+		return 0, 0, err
+	}
+	if data, err = parseBlockUsage(fields[5]); err != nil {
+		return 0, 0, err
+	}
+
+	return data, metadata, nil
+}
+
+// parseBlockUsage parses <used blocks>/<total blocks> into the fraction in use
+func parseBlockUsage(usage string) (float64, error) {
+	parts := strings.SplitN(usage, "/", 2)
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid block usage %q", usage)
+	}
+
+	used, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid block usage %q", usage)
+	}
+	total, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || total == 0 {
+		return 0, errors.Errorf("invalid block usage %q", usage)
+	}
+
+	return float64(used) / float64(total), nil
+}
@@ -0,0 +1,47 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThinPoolUsage(t *testing.T) {
+	data, metadata, err := parseThinPoolUsage("0 209715200 thin-pool 1 1019/4161600 409600/1638400 - rw discard_passdown queue_if_no_space - 1024\n")
+	require.NoError(t, err, "failed to parse status")
+	require.InDelta(t, 0.25, data, 1e-9, "wrong data usage")
+	require.InDelta(t, 1019.0/4161600, metadata, 1e-9, "wrong metadata usage")
+
+	for _, status := range []string{
+		"",
+		"0 209715200 linear 8:16 0",
+		"0 209715200 thin-pool 1 1019 1/1638400",
+		"0 209715200 thin-pool 1 1019/4161600 1/0",
+		"0 209715200 thin-pool 1 1019/4161600 x/1638400",
+	} {
+		_, _, err := parseThinPoolUsage(status)
+		require.Error(t, err, "invalid status %q was parsed", status)
+	}
+}
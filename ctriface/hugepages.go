@@ -0,0 +1,238 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ease-lab/vhive/misc"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	hugepageSize = 2 << 20
+	// freeHugepagesPath is where the kernel reports the free 2 MiB hugepages
+	freeHugepagesPath = "/sys/kernel/mm/hugepages/hugepages-2048kB/free_hugepages"
+)
+
+// hugepagePool backs the guest memory of VMs restored from snapshots with
+// 2 MiB hugepages, by keeping their memory files on a hugetlbfs mount.
+// Firecracker maps the memory file of a snapshot when loading it,
+// so a memory file on hugetlbfs gives the guest hugepage-backed memory.
+type hugepagePool struct {
+	sync.Mutex
+
+	dir       string
+	freePath  string
+	reserved  map[string]uint64
+	populated map[string]bool
+}
+
+func newHugepagePool(dir, freePath string) *hugepagePool {
+	return &hugepagePool{
+		dir:       dir,
+		freePath:  freePath,
+		reserved:  make(map[string]uint64),
+		populated: make(map[string]bool),
+	}
+}
+
+// memoryFile returns the hugetlbfs memory file of a VM
+func (p *hugepagePool) memoryFile(vmID string) string {
+	return filepath.Join(p.dir, vmID+"_mem_file")
+}
+
+// reserve checks that enough hugepages are free for the guest memory of a VM,
+// counting the hugepages reserved by other VMs whose memory files are not populated yet
+func (p *hugepagePool) reserve(vmID string, memSizeMib uint32) error {
+	if memSizeMib%(hugepageSize>>20) != 0 {
+		return status.Errorf(codes.InvalidArgument, "guest memory of %d MiB is not a multiple of the hugepage size", memSizeMib)
+	}
+	pages := uint64(memSizeMib) / (hugepageSize >> 20)
+
+	p.Lock()
+	defer p.Unlock()
+
+	if _, isPresent := p.reserved[vmID]; isPresent {
+		return errors.Errorf("hugepages of VM %s are already reserved", vmID)
+	}
+
+	free, err := readFreeHugepages(p.freePath)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to read the free hugepages: %v", err)
+	}
+
+	var pending uint64
+	for id, n := range p.reserved {
+		if !p.populated[id] {
+			pending += n
+		}
+	}
+
+	if free < pending+pages {
+		return status.Errorf(codes.ResourceExhausted,
+			"not enough 2 MiB hugepages on the host for %d MiB of guest memory: %d needed, %d free, %d reserved by other VMs (raise vm.nr_hugepages)",
+			memSizeMib, pages, free, pending)
+	}
+
+	p.reserved[vmID] = pages
+
+	return nil
+}
+
+// populate moves the memory file of a snapshot of a VM to hugetlbfs
+func (p *hugepagePool) populate(vmID, memFile string) error {
+	if err := copyToHugetlbfs(memFile, p.memoryFile(vmID)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(memFile); err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.populated[vmID] = true
+	p.Unlock()
+
+	return nil
+}
+
+// isPopulated returns whether the snapshot memory file of a VM is on hugetlbfs
+func (p *hugepagePool) isPopulated(vmID string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.populated[vmID]
+}
+
+// release removes the hugetlbfs memory file of a VM and frees its hugepages
+func (p *hugepagePool) release(vmID string) error {
+	p.Lock()
+	delete(p.reserved, vmID)
+	delete(p.populated, vmID)
+	p.Unlock()
+
+	if err := os.Remove(p.memoryFile(vmID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// checkHugepages rejects hugepages for the VMs whose guest memory cannot be backed by them
+func (o *Orchestrator) checkHugepages(vmOpts *StartVMOptions) error {
+	switch {
+	case !vmOpts.Hugepages:
+		return nil
+	case o.hugepages == nil:
+		return status.Error(codes.FailedPrecondition, "hugepage-backed guest memory is disabled on this host, which has no hugetlbfs mount configured")
+	case !o.GetSnapshotsEnabled():
+		return status.Error(codes.FailedPrecondition, "hugepage-backed guest memory requires snapshots, as only restored VMs map their memory from a file")
+	case o.GetUPFEnabled() || vmOpts.REAPTrace != "":
+		return status.Error(codes.FailedPrecondition, "hugepage-backed guest memory is not supported with user-level page faults (REAP)")
+	}
+
+	return nil
+}
+
+// getLoadMemoryFile returns the memory file a snapshot of a VM is loaded from
+func (o *Orchestrator) getLoadMemoryFile(vm *misc.VM) string {
+	if vm.Hugepages && o.hugepages.isPopulated(vm.ID) {
+		return o.hugepages.memoryFile(vm.ID)
+	}
+
+	return o.getMemoryFile(vm.ID)
+}
+
+func readFreeHugepages(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// copyToHugetlbfs copies a file to hugetlbfs, which does not support write(2),
+// through a shared mapping of the destination sized to whole hugepages
+func copyToHugetlbfs(src, dst string) (retErr error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := (fi.Size() + hugepageSize - 1) / hugepageSize * hugepageSize
+	if size == 0 {
+		return errors.Errorf("memory file %s is empty", src)
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	defer func() {
+		if retErr != nil {
+			if err := os.Remove(dst); err != nil {
+				log.WithError(err).Errorf("failed to remove %s after failure", dst)
+			}
+		}
+	}()
+
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	mem, err := unix.Mmap(int(out.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unix.Munmap(mem); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	if _, err := io.ReadFull(in, mem[:fi.Size()]); err != nil {
+		return err
+	}
+
+	return nil
+}
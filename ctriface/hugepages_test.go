@@ -0,0 +1,153 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ease-lab/vhive/misc"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestHugepagePool(t *testing.T, free string) *hugepagePool {
+	dir, err := ioutil.TempDir("", "hugetlbfs")
+	require.NoError(t, err, "Failed to create hugetlbfs dir")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	freePath := filepath.Join(dir, "free_hugepages")
+	require.NoError(t, ioutil.WriteFile(freePath, []byte(free+"\n"), 0644))
+
+	return newHugepagePool(dir, freePath)
+}
+
+func TestHugepagesReserve(t *testing.T) {
+	// 256 free hugepages back 512 MiB of guest memory
+	p := newTestHugepagePool(t, "256")
+
+	require.NoError(t, p.reserve("1", 256), "Failed to reserve hugepages")
+
+	err := p.reserve("2", 512)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "Hugepages pending for another VM were reserved")
+	require.Contains(t, err.Error(), "for 512 MiB of guest memory: 256 needed, 256 free, 128 reserved by other VMs",
+		"Error does not describe the missing hugepages")
+
+	require.NoError(t, p.reserve("2", 256), "Failed to reserve the remaining hugepages")
+
+	require.NoError(t, p.release("1"), "Failed to release hugepages")
+	require.NoError(t, p.reserve("3", 256), "Released hugepages were not freed")
+
+	err = p.reserve("4", 3)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "Guest memory not in whole hugepages was accepted")
+}
+
+func TestHugepagesReserveUnreadable(t *testing.T) {
+	p := newHugepagePool(t.TempDir(), filepath.Join(t.TempDir(), "missing"))
+
+	err := p.reserve("1", 256)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "Hugepages were reserved without knowing the free ones")
+}
+
+func TestHugepagesRejected(t *testing.T) {
+	hugepages := &StartVMOptions{Hugepages: true}
+
+	cases := []struct {
+		name   string
+		orch   *Orchestrator
+		vmOpts *StartVMOptions
+		code   codes.Code
+	}{
+		{name: "NotRequested", orch: &Orchestrator{}, vmOpts: &StartVMOptions{}, code: codes.OK},
+		{name: "Disabled", orch: &Orchestrator{snapshotsEnabled: true}, vmOpts: hugepages, code: codes.FailedPrecondition},
+		{name: "WithoutSnapshots", orch: &Orchestrator{hugepages: newTestHugepagePool(t, "0")}, vmOpts: hugepages, code: codes.FailedPrecondition},
+		{name: "WithREAP", orch: &Orchestrator{hugepages: newTestHugepagePool(t, "0"), snapshotsEnabled: true, isUPFEnabled: true}, vmOpts: hugepages, code: codes.FailedPrecondition},
+		{name: "WithVMREAP", orch: &Orchestrator{hugepages: newTestHugepagePool(t, "0"), snapshotsEnabled: true}, vmOpts: &StartVMOptions{Hugepages: true, REAPTrace: "fn"}, code: codes.FailedPrecondition},
+		{name: "Supported", orch: &Orchestrator{hugepages: newTestHugepagePool(t, "0"), snapshotsEnabled: true}, vmOpts: hugepages, code: codes.OK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.orch.checkHugepages(c.vmOpts)
+			require.Equal(t, c.code, status.Code(err), "Unexpected error %v", err)
+		})
+	}
+}
+
+func TestHugepagesPopulate(t *testing.T) {
+	p := newTestHugepagePool(t, "256")
+	require.NoError(t, p.reserve("1", 256), "Failed to reserve hugepages")
+
+	memFile := filepath.Join(t.TempDir(), "mem_file")
+	content := bytes.Repeat([]byte("vhive"), hugepageSize/5+1)
+	require.NoError(t, ioutil.WriteFile(memFile, content, 0600))
+
+	require.NoError(t, p.populate("1", memFile), "Failed to move memory file to hugetlbfs")
+	require.True(t, p.isPopulated("1"))
+	require.NoFileExists(t, memFile, "Original memory file was not removed")
+
+	data, err := ioutil.ReadFile(p.memoryFile("1"))
+	require.NoError(t, err, "Failed to read hugetlbfs memory file")
+	require.Len(t, data, 2*hugepageSize, "Memory file is not sized to whole hugepages")
+	require.Equal(t, content, data[:len(content)], "Memory file was corrupted")
+
+	// Populated hugepages are accounted by the kernel, not as pending
+	require.NoError(t, p.reserve("2", 512), "Populated hugepages are still pending")
+
+	require.NoError(t, p.release("1"), "Failed to release hugepages")
+	require.NoFileExists(t, p.memoryFile("1"), "Hugetlbfs memory file was not removed")
+}
+
+func TestReleaseVMResourcesPastFailures(t *testing.T) {
+	numa, err := newNUMAPlacer(twoSocketTopology())
+	require.NoError(t, err, "Failed to create NUMA placer")
+
+	o := &Orchestrator{
+		hugepages: newTestHugepagePool(t, "256"),
+		jailer:    newJailer(JailerConfig{ChrootBaseDir: t.TempDir()}),
+		numa:      numa,
+	}
+
+	vm := misc.NewVM("1")
+	vm.Hugepages = true
+
+	_, err = numa.place(vm.ID, 256)
+	require.NoError(t, err, "Failed to place VM")
+
+	// Neither the jail nor the hugepage memory file can be removed
+	o.jailer.mounts[vm.ID] = []string{t.TempDir()}
+	memFile := o.hugepages.memoryFile(vm.ID)
+	require.NoError(t, os.MkdirAll(filepath.Join(memFile, "busy"), 0755))
+
+	err = o.releaseVMResources(vm, log.NewEntry(log.StandardLogger()))
+	require.Error(t, err, "Teardown failures were not returned")
+	require.Contains(t, err.Error(), "failed to unmount", "Jail failure was not returned")
+	require.Contains(t, err.Error(), memFile, "Hugepages failure was not returned")
+
+	require.Zero(t, numa.committed[0]+numa.committed[1], "NUMA placement was leaked")
+}
@@ -24,32 +24,36 @@ package ctriface
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 	"net"
 	"net/url"
-	"net/http"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/oci"
-	"github.com/containerd/containerd/remotes/docker"
 
 	"github.com/firecracker-microvm/firecracker-containerd/proto" // note: from the original repo
 	"github.com/firecracker-microvm/firecracker-containerd/runtime/firecrackeroci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 
 	_ "google.golang.org/grpc/codes"  //tmp
 	_ "google.golang.org/grpc/status" //tmp
 
+	"github.com/ease-lab/vhive/logging"
 	"github.com/ease-lab/vhive/memory/manager"
 	"github.com/ease-lab/vhive/metrics"
 	"github.com/ease-lab/vhive/misc"
@@ -63,23 +67,101 @@ import (
 type StartVMResponse struct {
 	// GuestIP is the IP of the guest MicroVM
 	GuestIP string
+	// VsockPath is the host-side Unix socket of the guest MicroVM's vsock device
+	VsockPath string
+	// NUMANode is the NUMA node the guest MicroVM is placed on, -1 if it is not placed
+	NUMANode int
+	// ImageDigest is the digest of the image the guest MicroVM runs
+	ImageDigest string
+	// Exited receives how the task of the guest MicroVM exited, once, e.g.,
+	// after it was stopped or after its guest ran out of memory or crashed
+	Exited <-chan VMExit
 }
 
 const (
 	testImageName = "vhiveease/helloworld:var_workload"
+	// vsockName is the name of the vsock socket that firecracker-containerd
+	// creates next to the firecracker API socket
+	vsockName = "firecracker.vsock"
+	// projectionVMPath is where the projection image is mounted inside the VM
+	projectionVMPath = "/vhive/projection"
 )
 
-// StartVM Boots a VM if it does not exist
-func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+// StartVM Boots a VM if it does not exist. Its errors are PhaseErrors
+// reporting the phase that failed. Cancelling ctx aborts the start at its
+// next phase and unwinds the partial work, the error wrapping ctx.Err().
+func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string, opts ...StartVMOption) (*StartVMResponse, *metrics.Metric, error) {
+	return o.startVM(ctx, vmID, imageName, false, opts...)
+}
+
+// startVM boots a VM, either a new one or, to restart it in place, one that
+// was stopped keeping its network interface in the pool
+func (o *Orchestrator) startVM(ctx context.Context, vmID, imageName string, restart bool, opts ...StartVMOption) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
 	var (
 		startVMMetric *metrics.Metric = metrics.NewMetric()
 		tStart        time.Time
+		vmOpts        = NewStartVMOptions(opts...)
+		phase         = PhaseBoot
+		rec           = vmOpts.PhaseRecorder
 	)
 
-	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID, "image": imageName})
 	logger.Debug("StartVM: Received StartVM")
 
-	vm, err := o.vmPool.Allocate(vmID, o.hostIface)
+	// The partial work of a failed start is unwound even if ctx is cancelled
+	cleanupCtx := namespaces.WithNamespace(context.Background(), namespaceName)
+
+	defer func() {
+		if retErr != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(retErr, ctxErr) {
+				retErr = fmt.Errorf("%v: %w", retErr, ctxErr)
+			}
+			retErr = &PhaseError{Phase: phase, Err: retErr}
+		}
+	}()
+
+	if err := o.checkHugepages(vmOpts); err != nil {
+		return nil, nil, err
+	}
+	if err := o.checkREAP(vmOpts); err != nil {
+		return nil, nil, err
+	}
+	if err := checkVirtiofs(vmOpts); err != nil {
+		return nil, nil, err
+	}
+	if err := checkFirecrackerBinary(vmOpts); err != nil {
+		return nil, nil, err
+	}
+	if vmOpts.Hugepages {
+		if err := o.hugepages.reserve(vmID, vmOpts.MemSizeMib); err != nil {
+			return nil, nil, err
+		}
+
+		defer func() {
+			if retErr != nil {
+				if err := o.hugepages.release(vmID); err != nil {
+					logger.WithError(err).Errorf("failed to release hugepages after failure")
+				}
+			}
+		}()
+	}
+
+	phase = PhaseNetwork
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	rec.Mark(metrics.PhaseOther)
+	tStart = time.Now()
+	var (
+		vm  *misc.VM
+		err error
+	)
+	if restart {
+		vm, err = o.vmPool.Reset(vmID)
+	} else {
+		vm, err = o.vmPool.Allocate(vmID, o.hostIface)
+	}
+	startVMMetric.MetricMap[metrics.AllocateVM] = metrics.ToUS(time.Since(tStart))
 	if err != nil {
 		logger.Error("failed to allocate VM in VM pool")
 		return nil, nil, err
@@ -94,57 +176,174 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 		}
 	}()
 
+	// The tap of a VM restarted in place keeps its egress policy
+	if vmOpts.EgressPolicy != nil && !restart {
+		if err := o.vmPool.SetEgressPolicy(vmID, vmOpts.EgressPolicy); err != nil {
+			logger.WithError(err).Error("failed to set the egress policy of the VM")
+			return nil, nil, err
+		}
+	}
+	rec.Mark(metrics.PhaseTapSetup)
+
+	vm.Prefault = vmOpts.Prefault
+	vm.Hugepages = vmOpts.Hugepages
+	vm.REAP = vmOpts.REAPTrace != ""
+
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	phase = PhaseImage
 	tStart = time.Now()
-	if vm.Image, err = o.getImage(ctx, imageName); err != nil {
+	if vmOpts.ImageCached {
+		vm.Image, err = o.getCachedImage(ctx, imageName)
+	} else {
+		vm.Image, err = o.getImage(ctx, imageName)
+	}
+	if err != nil {
 		return nil, nil, errors.Wrapf(err, "Failed to get/pull image")
 	}
+	if vmOpts.RootfsDigest != "" {
+		if err := verifyRootfs(ctx, *vm.Image, vmOpts.RootfsDigest); err != nil {
+			return nil, nil, err
+		}
+	}
 	startVMMetric.MetricMap[metrics.GetImage] = metrics.ToUS(time.Since(tStart))
+	rec.Mark(metrics.PhaseImageResolve)
+	phase = PhaseBoot
+
+	var metadata []byte
+	if vmOpts.Metadata != nil {
+		if metadata, err = json.Marshal(vmOpts.Metadata); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to serialize VM metadata")
+		}
+	}
 
 	tStart = time.Now()
-	conf := o.getVMConfig(vm)
+	conf := o.getVMConfig(vm, vmOpts)
+	conf.DriveMounts = getDriveMounts(vmOpts)
+	if metadata != nil {
+		conf.NetworkInterfaces[0].AllowMMDS = true
+	}
+	if o.jailer != nil {
+		if conf.JailerConfig, err = o.jailer.setup(vmID, getJailedFiles(vmOpts)); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to set up the jail")
+		}
+
+		defer func() {
+			if retErr != nil {
+				if err := o.jailer.cleanup(vmID); err != nil {
+					logger.WithError(err).Errorf("failed to remove jail after failure")
+				}
+			}
+		}()
+	}
+	numaNode := -1
+	if o.numa != nil {
+		// The cpuset of the jail confines both the vCPUs and the memory of the VM
+		if conf.JailerConfig == nil {
+			return nil, nil, errors.New("NUMA placement of VMs requires the jailer")
+		}
+
+		node, err := o.numa.place(vmID, uint64(vmOpts.MemSizeMib))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to place the VM on a NUMA node")
+		}
+
+		defer func() {
+			if retErr != nil {
+				o.numa.release(vmID)
+			}
+		}()
+
+		conf.JailerConfig.CPUs = node.CPUs
+		conf.JailerConfig.Mems = strconv.Itoa(node.ID)
+		numaNode = node.ID
+	}
+	if vm.Ni.NetNS != "" {
+		// Firecracker joins the network namespace of its tap only when jailed
+		if conf.JailerConfig == nil {
+			phase = PhaseNetwork
+			return nil, nil, errors.New("network namespaces of VMs require the jailer")
+		}
+		conf.JailerConfig.NetNS = vm.Ni.NetNS
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	rec.Mark(metrics.PhaseOther)
 	resp, err := o.fcClient.CreateVM(ctx, conf)
 	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
+	rec.Mark(metrics.PhaseFirecrackerAPI)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "failed to create the microVM in firecracker-containerd")
 	}
 
 	defer func() {
 		if retErr != nil {
-			if _, err := o.fcClient.StopVM(ctx, &proto.StopVMRequest{VMID: vmID}); err != nil {
+			if _, err := o.fcClient.StopVM(cleanupCtx, &proto.StopVMRequest{VMID: vmID}); err != nil {
 				logger.WithError(err).Errorf("failed to stop firecracker-containerd VM after failure")
 			}
 		}
 	}()
 
+	// The cgroup of the jail exists once firecracker is launched
+	o.startCPUBoost(vmID, vmOpts, logger)
+	defer func() {
+		if retErr != nil && o.cpuBoost != nil {
+			o.cpuBoost.forget(vmID)
+		}
+	}()
+	rec.Mark(metrics.PhaseOther)
+
+	if metadata != nil {
+		if _, err := o.fcClient.SetVMMetadata(ctx, &proto.SetVMMetadataRequest{VMID: vmID, Metadata: string(metadata)}); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to set the VM metadata")
+		}
+		rec.Mark(metrics.PhaseFirecrackerAPI)
+	}
+
 	logger.Debug("StartVM: Creating a new container")
 	tStart = time.Now()
+	specOpts := append([]oci.SpecOpts{
+		oci.WithImageConfig(*vm.Image),
+		firecrackeroci.WithVMID(vmID),
+		firecrackeroci.WithVMNetwork,
+		oci.WithMounts(getContainerMounts(vmOpts)),
+		oci.WithEnv(getContainerEnv(vmOpts)),
+	}, rootfsSpecOpts(o.rootfsMode)...)
 	container, err := o.client.NewContainer(
 		ctx,
 		vmID,
 		containerd.WithSnapshotter(o.snapshotter),
-		containerd.WithNewSnapshot(vmID, *vm.Image),
-		containerd.WithNewSpec(
-			oci.WithImageConfig(*vm.Image),
-			firecrackeroci.WithVMID(vmID),
-			firecrackeroci.WithVMNetwork,
-		),
+		rootfsSnapshotOpt(o.rootfsMode, vmID, *vm.Image),
+		containerd.WithNewSpec(specOpts...),
 		containerd.WithRuntime("aws.firecracker", nil),
 	)
 	startVMMetric.MetricMap[metrics.NewContainer] = metrics.ToUS(time.Since(tStart))
+	// Creating the container creates the devmapper device of its rootfs
+	rec.Mark(metrics.PhaseDevmapper)
 	vm.Container = &container
 	if err != nil {
+		if err := o.removeRootfsSnapshot(cleanupCtx, vmID); err != nil {
+			logger.WithError(err).Errorf("failed to remove rootfs snapshot after failure")
+		}
 		return nil, nil, errors.Wrap(err, "failed to create a container")
 	}
 
 	defer func() {
 		if retErr != nil {
-			if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+			if err := container.Delete(cleanupCtx, containerd.WithSnapshotCleanup); err != nil {
 				logger.WithError(err).Errorf("failed to delete container after failure")
 			}
 		}
 	}()
 
+	if vmOpts.GuestSwapMib > 0 {
+		logger.Debug("StartVM: Provisioning the guest swap")
+		if err := o.provisionGuestSwap(ctx, vmID, vmOpts.GuestSwapMib); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to provision the guest swap")
+		}
+		rec.Mark(metrics.PhaseDevmapper)
+	}
+
 	logger.Debug("StartVM: Creating a new task")
 	tStart = time.Now()
 	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStdio))
@@ -156,7 +355,7 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 
 	defer func() {
 		if retErr != nil {
-			if _, err := task.Delete(ctx); err != nil {
+			if _, err := task.Delete(cleanupCtx); err != nil {
 				logger.WithError(err).Errorf("failed to delete task after failure")
 			}
 		}
@@ -164,16 +363,23 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 
 	logger.Debug("StartVM: Waiting for the task to get ready")
 	tStart = time.Now()
-	ch, err := task.Wait(ctx)
+	// The exit of the task is waited for as long as the VM runs, not only during its start
+	waitCtx, cancelWait := context.WithCancel(namespaces.WithNamespace(context.Background(), namespaceName))
+	ch, err := task.Wait(waitCtx)
 	startVMMetric.MetricMap[metrics.TaskWait] = metrics.ToUS(time.Since(tStart))
-	vm.TaskCh = ch
 	if err != nil {
+		cancelWait()
 		return nil, nil, errors.Wrap(err, "failed to wait for a task")
 	}
 
+	exited := make(chan VMExit, 1)
+	taskExited := make(chan struct{})
+	vm.TaskExited = taskExited
+	go watchTask(ch, exited, taskExited, cancelWait)
+
 	defer func() {
 		if retErr != nil {
-			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
+			if err := task.Kill(cleanupCtx, syscall.SIGKILL); err != nil {
 				logger.WithError(err).Errorf("failed to kill task after failure")
 			}
 		}
@@ -185,20 +391,27 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 		return nil, nil, errors.Wrap(err, "failed to start a task")
 	}
 	startVMMetric.MetricMap[metrics.TaskStart] = metrics.ToUS(time.Since(tStart))
+	// Creating, waiting for and starting the task go through firecracker-containerd
+	rec.Mark(metrics.PhaseFirecrackerAPI)
 
 	defer func() {
 		if retErr != nil {
-			if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
+			if err := task.Kill(cleanupCtx, syscall.SIGKILL); err != nil {
 				logger.WithError(err).Errorf("failed to kill task after failure")
 			}
 		}
 	}()
 
+	// A start cancelled while the VM booted is unwound rather than returned
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
 	if err := os.MkdirAll(o.getVMBaseDir(vmID), 0777); err != nil {
 		logger.Error("Failed to create VM base dir")
 		return nil, nil, err
 	}
-	if o.GetUPFEnabled() {
+	if o.usesUPF(vm) {
 		logger.Debug("Registering VM with the memory manager")
 
 		stateCfg := manager.SnapshotStateCfg{
@@ -211,6 +424,13 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 			WorkingSetPath:   o.getWorkingSetFile(vmID),
 			InstanceSockAddr: resp.UPFSockPath,
 		}
+		if vmOpts.REAPTrace != "" {
+			stateCfg.TracePath = o.getREAPTraceFile(vmOpts.REAPTrace)
+			if err := os.MkdirAll(filepath.Dir(stateCfg.TracePath), 0777); err != nil {
+				logger.Error("Failed to create REAP trace dir")
+				return nil, nil, err
+			}
+		}
 		if err := o.memoryManager.RegisterVM(stateCfg); err != nil {
 			return nil, nil, errors.Wrap(err, "failed to register VM with memory manager")
 			// NOTE (Plamen): Potentially need a defer(DeregisteVM) here if RegisterVM is not last to execute
@@ -219,13 +439,25 @@ func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *
 
 	logger.Debug("Successfully started a VM")
 
-	return &StartVMResponse{GuestIP: vm.Ni.PrimaryAddress}, startVMMetric, nil
+	return &StartVMResponse{
+		GuestIP:     vm.Ni.PrimaryAddress,
+		VsockPath:   filepath.Join(filepath.Dir(resp.SocketPath), vsockName),
+		NUMANode:    numaNode,
+		ImageDigest: (*vm.Image).Target().Digest.String(),
+		Exited:      exited,
+	}, startVMMetric, nil
 }
 
 // StopSingleVM Shuts down a VM
 // Note: VMs are not quisced before being stopped
 func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	return o.stopVM(ctx, vmID, false)
+}
+
+// stopVM shuts down a VM, keeping its network interface in the pool
+// if it is restarted in place
+func (o *Orchestrator) stopVM(ctx context.Context, vmID string, keepNetwork bool) (retErr error) {
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received StopVM")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
@@ -238,15 +470,30 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 
 	}
 
-	logger = log.WithFields(log.Fields{"vmID": vmID})
+	freed := false
+	defer func() {
+		// The CNI network is released even if the VM crashed and could not be stopped
+		if retErr != nil && !freed && vm.Ni.NetNS != "" && !keepNetwork {
+			if err := o.vmPool.ReleaseNetwork(vmID); err != nil {
+				logger.WithError(err).Error("failed to release the network of the VM")
+			}
+		}
+	}()
+
+	logger = logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID})
 
 	task := *vm.Task
-	if err := task.Kill(ctx, syscall.SIGKILL); err != nil {
+	// The task of a VM that crashed or ran out of memory has exited already
+	if err := task.Kill(ctx, syscall.SIGKILL); err != nil && !errdefs.IsNotFound(err) {
 		logger.WithError(err).Error("Failed to kill the task")
 		return err
 	}
 
-	<-vm.TaskCh
+	select {
+	case <-vm.TaskExited:
+	case <-time.After(taskExitTimeout):
+		logger.Warn("task did not exit after being killed")
+	}
 	//FIXME: Seems like some tasks need some extra time to die Issue#15, lr_training
 	time.Sleep(500 * time.Millisecond)
 
@@ -266,9 +513,24 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 		return err
 	}
 
+	teardownErr := o.releaseVMResources(vm, logger)
+
+	if keepNetwork {
+		if teardownErr != nil {
+			return teardownErr
+		}
+		logger.Debug("Stopped VM successfully, keeping its network")
+		return nil
+	}
+
 	if err := o.vmPool.Free(vmID); err != nil {
 		logger.Error("failed to free VM from VM pool")
-		return err
+		return multierror.Of(teardownErr, err)
+	}
+	freed = true
+
+	if teardownErr != nil {
+		return teardownErr
 	}
 
 	logger.Debug("Stopped VM successfully")
@@ -276,6 +538,43 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 	return nil
 }
 
+// releaseVMResources releases the host resources held by a stopped VM. A failure
+// to release one does not leak the others, the failures are returned together.
+func (o *Orchestrator) releaseVMResources(vm *misc.VM, logger *log.Entry) error {
+	var errs []error
+
+	if o.jailer != nil {
+		if err := o.jailer.cleanup(vm.ID); err != nil {
+			logger.WithError(err).Error("failed to remove jail")
+			errs = append(errs, err)
+		}
+	}
+
+	if o.numa != nil {
+		o.numa.release(vm.ID)
+	}
+
+	if o.cpuBoost != nil {
+		o.cpuBoost.forget(vm.ID)
+	}
+
+	if vm.Hugepages {
+		if err := o.hugepages.release(vm.ID); err != nil {
+			logger.WithError(err).Error("failed to release hugepages")
+			errs = append(errs, err)
+		}
+	}
+
+	// The vmID may be reused by a VM that registers with the memory manager again
+	if o.usesUPF(vm) {
+		if err := o.memoryManager.DeregisterVM(vm.ID); err != nil {
+			logger.WithError(err).Warn("failed to deregister the VM from the memory manager")
+		}
+	}
+
+	return multierror.New(errs)
+}
+
 // Checks whether a URL has a .local domain
 func isLocalDomain(s string) (bool, error) {
 	if ! strings.Contains(s, "://") {
@@ -309,41 +608,27 @@ func getImageURL(image string) string {
 }
 
 func (o *Orchestrator) getImage(ctx context.Context, imageName string) (*containerd.Image, error) {
-	image, found := o.cachedImages[imageName]
-	if !found {
-		var err error
+	image, err := o.images.getOrResolve(imageName, func() (containerd.Image, error) {
 		log.Debug(fmt.Sprintf("Pulling image %s", imageName))
 
 		imageURL := getImageURL(imageName)
-		local, _ := isLocalDomain(imageURL)
-		if local {
-			// Pull local image using HTTP
-			resolver := docker.NewResolver(docker.ResolverOptions{
-				Client: http.DefaultClient,
-				Hosts: docker.ConfigureDefaultRegistries(
-					docker.WithPlainHTTP(docker.MatchAllHosts),
-				),
-			})
-			image, err = o.client.Pull(ctx, imageURL,
-				containerd.WithPullUnpack,
-				containerd.WithPullSnapshotter(o.snapshotter),
-				containerd.WithResolver(resolver),
-			)
-		} else {
-			// Pull remote image
-			image, err = o.client.Pull(ctx, imageURL,
-				containerd.WithPullUnpack,
-				containerd.WithPullSnapshotter(o.snapshotter),
-			)
+		pull := func(ctx context.Context) (containerd.Image, error) {
+			return o.pullImage(ctx, imageURL)
 		}
 
-		if err != nil {
-			return &image, err
-		}
-		o.cachedImages[imageName] = image
-	}
+		logger := log.WithFields(log.Fields{"image": imageName})
+		return pullWithRetry(ctx, pull, o.imagePullRetries, o.imagePullBackoff, logger)
+	})
+
+	return &image, err
+}
 
-	return &image, nil
+func (o *Orchestrator) pullImage(ctx context.Context, imageURL string) (containerd.Image, error) {
+	return o.client.Pull(ctx, imageURL,
+		containerd.WithPullUnpack,
+		containerd.WithPullSnapshotter(o.snapshotter),
+		containerd.WithResolver(newImageResolver(imageURL)),
+	)
 }
 
 func getK8sDNS() []string {
@@ -364,18 +649,176 @@ func getK8sDNS() []string {
 	return dnsIPs
 }
 
-func (o *Orchestrator) getVMConfig(vm *misc.VM) *proto.CreateVMRequest {
-	kernelArgs := "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=/sbin/overlay-init tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
+// getProjectionDriveMount returns the drive mount of the projection image inside the VM
+func getProjectionDriveMount(vmOpts *StartVMOptions) *proto.FirecrackerDriveMount {
+	return &proto.FirecrackerDriveMount{
+		HostPath:       vmOpts.ProjectionImage,
+		VMPath:         projectionVMPath,
+		FilesystemType: "ext4",
+		Options:        []string{"ro"},
+	}
+}
+
+// getDriveMounts returns the drives attached to the VM, the projection image
+// first, rate-limited by the I/O limits of the VM
+func getDriveMounts(vmOpts *StartVMOptions) []*proto.FirecrackerDriveMount {
+	var drives []*proto.FirecrackerDriveMount
+	if vmOpts.ProjectionImage != "" {
+		drives = append(drives, getProjectionDriveMount(vmOpts))
+	}
+	for _, m := range vmOpts.DriveMounts {
+		drives = append(drives, getDriveMount(m))
+	}
+
+	for _, d := range drives {
+		d.RateLimiter = getIORateLimiter(vmOpts.IORateLimit)
+	}
+
+	return drives
+}
+
+// getDriveMount returns the drive mount of an extra image inside the VM
+func getDriveMount(m DriveMount) *proto.FirecrackerDriveMount {
+	options := []string{"rw"}
+	if m.ReadOnly {
+		options = []string{"ro"}
+	}
+
+	return &proto.FirecrackerDriveMount{
+		HostPath:       m.HostPath,
+		VMPath:         m.VMPath,
+		FilesystemType: "ext4",
+		Options:        options,
+		IsWritable:     !m.ReadOnly,
+	}
+}
+
+// getContainerMounts returns the bind mounts of the function container
+// that point into the projection image and the extra drives mounted in the VM
+func getContainerMounts(vmOpts *StartVMOptions) []specs.Mount {
+	var mounts []specs.Mount
+
+	for _, m := range vmOpts.DriveMounts {
+		options := []string{"rbind", "rw"}
+		if m.ReadOnly {
+			options = []string{"rbind", "ro"}
+		}
+
+		mounts = append(mounts, specs.Mount{
+			Source:      m.VMPath,
+			Destination: m.ContainerPath,
+			Type:        "bind",
+			Options:     options,
+		})
+	}
+
+	for _, m := range vmOpts.ProjectedMounts {
+		mounts = append(mounts, specs.Mount{
+			Source:      filepath.Join(projectionVMPath, m.Source),
+			Destination: m.ContainerPath,
+			Type:        "bind",
+			Options:     []string{"rbind", "ro"},
+		})
+	}
+
+	return mounts
+}
+
+// getContainerEnv returns the environment of the function container of a VM
+func getContainerEnv(vmOpts *StartVMOptions) []string {
+	if vmOpts.GuestSwapMib == 0 {
+		return vmOpts.Env
+	}
+
+	env := append([]string(nil), vmOpts.Env...)
+	return append(env, guestSwapFileEnv+"="+guestSwapFile)
+}
+
+// getJailedFiles returns the host files of a VM that are exposed in its jail
+func getJailedFiles(vmOpts *StartVMOptions) []string {
+	var files []string
+	if vmOpts.ProjectionImage != "" {
+		files = append(files, vmOpts.ProjectionImage)
+	}
+	for _, m := range vmOpts.DriveMounts {
+		files = append(files, m.HostPath)
+	}
+
+	return files
+}
+
+// defaultGuestInit is the init of the guest images, which mounts the
+// writable overlay of the rootfs before starting systemd
+const defaultGuestInit = "/sbin/overlay-init"
+
+// getKernelArgs returns the kernel command line of a VM
+func getKernelArgs(vmOpts *StartVMOptions) string {
+	init := defaultGuestInit
+	if len(vmOpts.InitCmd) > 0 {
+		init = vmOpts.InitCmd[0]
+	}
+
+	kernelArgs := "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=" + init + " tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
+
+	if vmOpts.Hostname != "" {
+		kernelArgs += " systemd.hostname=" + vmOpts.Hostname
+	}
+
+	// The kernel passes the arguments after -- to the init
+	if len(vmOpts.InitCmd) > 1 {
+		kernelArgs += " -- " + strings.Join(vmOpts.InitCmd[1:], " ")
+	}
+
+	return kernelArgs
+}
+
+// getRateLimiter returns the Firecracker rate limiter of the given bytes and
+// operations per second, refilled every second, nil if neither is limited
+func getRateLimiter(bytesPerSec, opsPerSec uint64) *proto.FirecrackerRateLimiter {
+	if bytesPerSec == 0 && opsPerSec == 0 {
+		return nil
+	}
+
+	limiter := &proto.FirecrackerRateLimiter{}
+	if bytesPerSec > 0 {
+		limiter.Bandwidth = &proto.FirecrackerTokenBucket{
+			Capacity:   int64(bytesPerSec),
+			RefillTime: 1000,
+		}
+	}
+	if opsPerSec > 0 {
+		limiter.Ops = &proto.FirecrackerTokenBucket{
+			Capacity:   int64(opsPerSec),
+			RefillTime: 1000,
+		}
+	}
+
+	return limiter
+}
+
+// getNetRateLimiter returns the rate limiter of the network interface of a VM
+func getNetRateLimiter(limit NetRateLimit) *proto.FirecrackerRateLimiter {
+	return getRateLimiter(limit.BandwidthMbps*1000*1000/8, limit.OpsPerSec)
+}
+
+// getIORateLimiter returns the rate limiter of each drive of a VM
+func getIORateLimiter(limit IORateLimit) *proto.FirecrackerRateLimiter {
+	return getRateLimiter(limit.BandwidthMBps*1000*1000, limit.OpsPerSec)
+}
 
+func (o *Orchestrator) getVMConfig(vm *misc.VM, vmOpts *StartVMOptions) *proto.CreateVMRequest {
 	return &proto.CreateVMRequest{
-		VMID:           vm.ID,
-		TimeoutSeconds: 100,
-		KernelArgs:     kernelArgs,
+		VMID:            vm.ID,
+		TimeoutSeconds:  100,
+		KernelArgs:      getKernelArgs(vmOpts),
+		KernelImagePath: vmOpts.KernelImagePath,
 		MachineCfg: &proto.FirecrackerMachineConfiguration{
-			VcpuCount:  1,
-			MemSizeMib: 256,
+			VcpuCount:  vmOpts.VcpuCount,
+			MemSizeMib: vmOpts.MemSizeMib,
 		},
 		NetworkInterfaces: []*proto.FirecrackerNetworkInterface{{
+			InRateLimiter:  getNetRateLimiter(vmOpts.NetRateLimit),
+			OutRateLimiter: getNetRateLimiter(vmOpts.NetRateLimit),
 			StaticConfig: &proto.StaticNetworkConfiguration{
 				MacAddress:  vm.Ni.MacAddress,
 				HostDevName: vm.Ni.HostDevName,
@@ -418,7 +861,7 @@ func (o *Orchestrator) StopActiveVMs() error {
 
 // PauseVM Pauses a VM
 func (o *Orchestrator) PauseVM(ctx context.Context, vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received PauseVM")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
@@ -438,7 +881,7 @@ func (o *Orchestrator) ResumeVM(ctx context.Context, vmID string) (*metrics.Metr
 		tStart         time.Time
 	)
 
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received ResumeVM")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
@@ -455,7 +898,7 @@ func (o *Orchestrator) ResumeVM(ctx context.Context, vmID string) (*metrics.Metr
 
 // CreateSnapshot Creates a snapshot of a VM
 func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received CreateSnapshot")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
@@ -471,6 +914,13 @@ func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
 		return err
 	}
 
+	if vm, err := o.vmPool.GetVM(vmID); err == nil && vm.Hugepages {
+		if err := o.hugepages.populate(vmID, req.MemFilePath); err != nil {
+			logger.WithError(err).Error("failed to move the guest memory to hugepages")
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -483,22 +933,36 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 		loadDone             = make(chan int)
 	)
 
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received LoadSnapshot")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
 
+	memFile := o.getMemoryFile(vmID)
+	vm, vmErr := o.vmPool.GetVM(vmID)
+	if vmErr == nil {
+		memFile = o.getLoadMemoryFile(vm)
+	} else {
+		vm = nil
+	}
+	upf := o.usesUPF(vm)
+
 	req := &proto.LoadSnapshotRequest{
 		VMID:             vmID,
 		SnapshotFilePath: o.getSnapshotFile(vmID),
-		MemFilePath:      o.getMemoryFile(vmID),
-		EnableUserPF:     o.GetUPFEnabled(),
+		MemFilePath:      memFile,
+		EnableUserPF:     upf,
 	}
 
-	if o.GetUPFEnabled() {
+	if upf {
 		if err := o.memoryManager.FetchState(vmID); err != nil {
 			return nil, err
 		}
+	} else if vmErr == nil {
+		tStart = time.Now()
+		if o.prefaultSnapshotMemory(vm, logger) {
+			loadSnapshotMetric.MetricMap[metrics.PrefaultMemory] = metrics.ToUS(time.Since(tStart))
+		}
 	}
 
 	tStart = time.Now()
@@ -511,7 +975,7 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 		}
 	}()
 
-	if o.GetUPFEnabled() {
+	if upf {
 		if activateErr = o.memoryManager.Activate(vmID); activateErr != nil {
 			logger.Warn("Failed to activate VM in the memory manager", activateErr)
 		}
@@ -531,12 +995,12 @@ func (o *Orchestrator) LoadSnapshot(ctx context.Context, vmID string) (*metrics.
 
 // Offload Shuts down the VM but leaves shim and other resources running.
 func (o *Orchestrator) Offload(ctx context.Context, vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received Offload")
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
 
-	_, err := o.vmPool.GetVM(vmID)
+	vm, err := o.vmPool.GetVM(vmID)
 	if err != nil {
 		if _, ok := err.(*misc.NonExistErr); ok {
 			logger.Panic("Offload: VM does not exist")
@@ -545,7 +1009,7 @@ func (o *Orchestrator) Offload(ctx context.Context, vmID string) error {
 
 	}
 
-	if o.GetUPFEnabled() {
+	if o.usesUPF(vm) {
 		if err := o.memoryManager.Deactivate(vmID); err != nil {
 			logger.Error("Failed to deactivate VM in the memory manager")
 			return err
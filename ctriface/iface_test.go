@@ -23,6 +23,7 @@ package ctriface
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -121,6 +122,52 @@ func TestStartStopSerial(t *testing.T) {
 	orch.Cleanup()
 }
 
+func TestStartVMCancelled(t *testing.T) {
+	log.SetFormatter(&log.TextFormatter{
+		TimestampFormat: ctrdlog.RFC3339NanoFixed,
+		FullTimestamp:   true,
+	})
+
+	log.SetOutput(os.Stdout)
+
+	log.SetLevel(log.InfoLevel)
+
+	testTimeout := 120 * time.Second
+	ctx, cancel := context.WithTimeout(namespaces.WithNamespace(context.Background(), namespaceName), testTimeout)
+	defer cancel()
+
+	orch := NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+	)
+
+	vmID := "6"
+
+	// The image is pulled beforehand, so that the start is cancelled while the VM boots
+	_, err := orch.getImage(ctx, testImageName)
+	require.NoError(t, err, "Failed to pull image")
+
+	bootCtx, cancelBoot := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancelBoot)
+
+	_, _, err = orch.StartVM(bootCtx, vmID, testImageName)
+	require.Error(t, err, "Cancelled start did not fail")
+	require.True(t, errors.Is(err, context.Canceled), "Error does not report the cancellation: %v", err)
+
+	_, err = orch.vmPool.GetVM(vmID)
+	require.Error(t, err, "Cancelled VM was not freed")
+
+	// The VM can be started again once its partial start is unwound
+	_, _, err = orch.StartVM(ctx, vmID, testImageName)
+	require.NoError(t, err, "Failed to start VM after a cancelled start")
+
+	err = orch.StopSingleVM(ctx, vmID)
+	require.NoError(t, err, "Failed to stop VM")
+
+	orch.Cleanup()
+}
+
 func TestPauseResumeSerial(t *testing.T) {
 	log.SetFormatter(&log.TextFormatter{
 		TimestampFormat: ctrdlog.RFC3339NanoFixed,
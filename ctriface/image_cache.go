@@ -0,0 +1,190 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+)
+
+// defaultImageCacheTTL is how long the image resolved for a tag is reused
+// before the tag is resolved again
+const defaultImageCacheTTL = 5 * time.Minute
+
+// ErrImageNotCached is returned by StartVM when the image of a VM started
+// WithImageCached is not present on the node
+var ErrImageNotCached = errors.New("image is not present on the node")
+
+// IsImageNotCached returns true if the error is caused by ErrImageNotCached
+func IsImageNotCached(err error) bool {
+	return errors.Is(err, ErrImageNotCached)
+}
+
+// ValidateImageName checks that the image name, completed with the default
+// registry as when pulling it, is a valid image reference
+func ValidateImageName(imageName string) error {
+	_, err := NormalizeImageName(imageName)
+	return err
+}
+
+// NormalizeImageName returns the full reference of the image pulled for the
+// image name, with its registry and its tag, latest by default, or its digest
+// (e.g. docker.io/library/nginx:latest for nginx)
+func NormalizeImageName(imageName string) (string, error) {
+	ref, err := reference.ParseDockerRef(getImageURL(imageName))
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image name %q", imageName)
+	}
+
+	return ref.String(), nil
+}
+
+// getCachedImage returns the image from the images already pulled
+// into containerd, without pulling it
+func (o *Orchestrator) getCachedImage(ctx context.Context, imageName string) (*containerd.Image, error) {
+	if image, found := o.images.get(imageName); found {
+		return &image, nil
+	}
+
+	image, err := o.client.GetImage(ctx, getImageURL(imageName))
+	if errdefs.IsNotFound(err) {
+		return nil, errors.Wrap(ErrImageNotCached, imageName)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up image %s", imageName)
+	}
+
+	// An image pre-pulled without unpacking is unpacked locally
+	unpacked, err := image.IsUnpacked(ctx, o.snapshotter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to check whether image %s is unpacked", imageName)
+	}
+	if !unpacked {
+		if err := image.Unpack(ctx, o.snapshotter); err != nil {
+			return nil, errors.Wrapf(err, "failed to unpack image %s", imageName)
+		}
+	}
+
+	o.images.put(imageName, image)
+
+	return &image, nil
+}
+
+// FlushImageCache drops the resolved image of the given name, or of all the
+// images if the name is empty, so that the next VM resolves it again
+func (o *Orchestrator) FlushImageCache(imageName string) {
+	o.images.flush(imageName)
+}
+
+// imageHandle is an image resolved and unpacked by containerd
+type imageHandle struct {
+	image    containerd.Image
+	resolved time.Time
+}
+
+// imageHandleCache keeps the images resolved by name, so that VMs of the same
+// image do not resolve it again. The images named by digest are immutable and
+// kept until flushed, while the ones named by tag expire after the TTL so that
+// a tag pushed again is picked up. A non-positive TTL keeps tags until flushed.
+type imageHandleCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	handles map[string]imageHandle
+	now     func() time.Time
+}
+
+func newImageHandleCache(ttl time.Duration) *imageHandleCache {
+	return &imageHandleCache{
+		ttl:     ttl,
+		handles: make(map[string]imageHandle),
+		now:     time.Now,
+	}
+}
+
+func (c *imageHandleCache) get(imageName string) (containerd.Image, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	h, found := c.handles[imageName]
+	if !found {
+		return nil, false
+	}
+	if c.ttl > 0 && !isDigestPinned(imageName) && c.now().Sub(h.resolved) >= c.ttl {
+		delete(c.handles, imageName)
+		return nil, false
+	}
+
+	return h.image, true
+}
+
+func (c *imageHandleCache) put(imageName string, image containerd.Image) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.handles[imageName] = imageHandle{image: image, resolved: c.now()}
+}
+
+func (c *imageHandleCache) flush(imageName string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if imageName == "" {
+		c.handles = make(map[string]imageHandle)
+		return
+	}
+	delete(c.handles, imageName)
+}
+
+// getOrResolve returns the cached image of the given name, resolving and
+// caching it on a miss. Concurrent misses of an image may resolve it twice,
+// which containerd tolerates, rather than serializing all the pulls.
+func (c *imageHandleCache) getOrResolve(imageName string, resolve func() (containerd.Image, error)) (containerd.Image, error) {
+	if image, found := c.get(imageName); found {
+		return image, nil
+	}
+
+	image, err := resolve()
+	if err != nil {
+		return image, err
+	}
+	c.put(imageName, image)
+
+	return image, nil
+}
+
+// isDigestPinned returns true if the image name references its content by digest
+func isDigestPinned(imageName string) bool {
+	ref, err := reference.ParseDockerRef(getImageURL(imageName))
+	if err != nil {
+		return strings.Contains(imageName, "@")
+	}
+	_, ok := ref.(reference.Digested)
+	return ok
+}
@@ -0,0 +1,152 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeImage stands for a resolved image, only compared by identity
+type fakeImage struct {
+	containerd.Image
+	name string
+}
+
+type countingResolver struct {
+	calls int
+	err   error
+}
+
+func (r *countingResolver) resolve(name string) func() (containerd.Image, error) {
+	return func() (containerd.Image, error) {
+		r.calls++
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &fakeImage{name: name}, nil
+	}
+}
+
+func newTestImageHandleCache(ttl time.Duration) (*imageHandleCache, *time.Time) {
+	now := time.Unix(0, 0)
+	c := newImageHandleCache(ttl)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestImageHandleCacheHit(t *testing.T) {
+	c, _ := newTestImageHandleCache(time.Minute)
+	r := &countingResolver{}
+
+	first, err := c.getOrResolve("ghcr.io/ease-lab/helloworld:var_workload", r.resolve("a"))
+	require.NoError(t, err)
+	second, err := c.getOrResolve("ghcr.io/ease-lab/helloworld:var_workload", r.resolve("b"))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, r.calls, "cache hit should not resolve the image again")
+	require.Same(t, first, second)
+}
+
+func TestImageHandleCacheTTL(t *testing.T) {
+	const (
+		tagged = "ghcr.io/ease-lab/helloworld:var_workload"
+		pinned = "ghcr.io/ease-lab/helloworld@sha256:4d6a4a4a8a0e8e4e5b4f3f8d39d3c1a1d5d0c6ab0b3a0d77d5c6c0d3e0f1a2b3"
+	)
+
+	c, now := newTestImageHandleCache(time.Minute)
+	r := &countingResolver{}
+
+	_, err := c.getOrResolve(tagged, r.resolve(tagged))
+	require.NoError(t, err)
+	_, err = c.getOrResolve(pinned, r.resolve(pinned))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.calls)
+
+	*now = now.Add(59 * time.Second)
+	_, err = c.getOrResolve(tagged, r.resolve(tagged))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.calls, "tag should be cached within the TTL")
+
+	*now = now.Add(time.Hour)
+	_, err = c.getOrResolve(tagged, r.resolve(tagged))
+	require.NoError(t, err)
+	require.Equal(t, 3, r.calls, "expired tag should be resolved again")
+
+	_, err = c.getOrResolve(pinned, r.resolve(pinned))
+	require.NoError(t, err)
+	require.Equal(t, 3, r.calls, "image pinned by digest should not expire")
+}
+
+func TestImageHandleCacheFlush(t *testing.T) {
+	c, _ := newTestImageHandleCache(0)
+	r := &countingResolver{}
+
+	for _, name := range []string{"a:1", "b:1"} {
+		_, err := c.getOrResolve(name, r.resolve(name))
+		require.NoError(t, err)
+	}
+
+	c.flush("a:1")
+	_, found := c.get("a:1")
+	require.False(t, found)
+	_, found = c.get("b:1")
+	require.True(t, found, "tag should be kept until flushed without a TTL")
+
+	c.flush("")
+	_, found = c.get("b:1")
+	require.False(t, found)
+}
+
+func TestImageHandleCacheResolveError(t *testing.T) {
+	c, _ := newTestImageHandleCache(time.Minute)
+	r := &countingResolver{err: errors.New("registry unavailable")}
+
+	_, err := c.getOrResolve("a:1", r.resolve("a:1"))
+	require.Error(t, err)
+
+	r.err = nil
+	_, err = c.getOrResolve("a:1", r.resolve("a:1"))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.calls, "failed resolution should not be cached")
+}
+
+func TestNormalizeImageName(t *testing.T) {
+	for image, expected := range map[string]string{
+		"nginx":                            "docker.io/library/nginx:latest",
+		"ease-lab/helloworld:var_workload": "docker.io/ease-lab/helloworld:var_workload",
+		"ghcr.io/ease-lab/helloworld:var_workload": "ghcr.io/ease-lab/helloworld:var_workload",
+		"localhost.localdomain:5000/pyaes":         "localhost.localdomain:5000/pyaes:latest",
+	} {
+		normalized, err := NormalizeImageName(image)
+		require.NoError(t, err, "failed to normalize %s", image)
+		require.Equal(t, expected, normalized)
+	}
+
+	_, err := NormalizeImageName("ease-lab/Hello World")
+	require.Error(t, err, "invalid image name was normalized")
+}
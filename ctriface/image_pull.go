@@ -0,0 +1,122 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultImagePullRetries = 3
+	defaultImagePullBackoff = time.Second
+)
+
+// statusCodeRe matches the HTTP status in the errors of the containerd docker resolver,
+// e.g., "unexpected status code https://registry/v2/...: 503 Service Unavailable"
+var statusCodeRe = regexp.MustCompile(`unexpected status.*?: (\d{3})\b`)
+
+type imagePuller func(ctx context.Context) (containerd.Image, error)
+
+// pullWithRetry pulls an image, retrying up to retries times on registry (5xx)
+// and network errors with an exponential backoff, but not on client (4xx) errors
+func pullWithRetry(ctx context.Context, pull imagePuller, retries int, backoff time.Duration, logger *log.Entry) (containerd.Image, error) {
+	for attempt := 0; ; attempt++ {
+		image, err := pull(ctx)
+		if err == nil {
+			return image, nil
+		}
+
+		if attempt >= retries || !isRetryablePullError(err) {
+			return nil, err
+		}
+
+		delay := backoff << uint(attempt)
+		logger.WithError(err).Warnf("image pull failed, retrying in %s (%d/%d)", delay, attempt+1, retries)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Wrap(err, "image pull retries cancelled")
+		}
+	}
+}
+
+// isRetryablePullError returns false for the errors that a retry cannot fix,
+// i.e., client errors, such as a missing image or failed authorization
+func isRetryablePullError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded {
+		return false
+	}
+
+	if errdefs.IsNotFound(err) || errdefs.IsInvalidArgument(err) || cause == docker.ErrInvalidAuthorization {
+		return false
+	}
+
+	if m := statusCodeRe.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		// Timeouts and throttling are worth retrying even though they are client errors
+		if code >= 400 && code < 500 && code != 408 && code != 429 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newImageResolver returns the resolver of the registry of the image,
+// which is reached with plain HTTP if it is local
+func newImageResolver(imageURL string) remotes.Resolver {
+	opts := docker.ResolverOptions{Client: http.DefaultClient}
+	if local, _ := isLocalDomain(imageURL); local {
+		opts.Hosts = docker.ConfigureDefaultRegistries(
+			docker.WithPlainHTTP(docker.MatchAllHosts),
+		)
+	}
+
+	return docker.NewResolver(opts)
+}
+
+// ResolveImageDigest returns the digest of the manifest the image name
+// references in its registry, without pulling the image
+func (o *Orchestrator) ResolveImageDigest(ctx context.Context, imageName string) (string, error) {
+	imageURL := getImageURL(imageName)
+
+	_, desc, err := newImageResolver(imageURL).Resolve(ctx, imageURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve image %s", imageName)
+	}
+
+	return desc.Digest.String(), nil
+}
@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPuller fails with the given errors before succeeding
+type stubPuller struct {
+	errs  []error
+	calls int
+}
+
+func (p *stubPuller) pull(ctx context.Context) (containerd.Image, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return nil, p.errs[p.calls-1]
+	}
+
+	return nil, nil
+}
+
+func statusErr(status string) error {
+	return errors.Errorf("unexpected status code https://registry:5000/v2/img/manifests/latest: %s", status)
+}
+
+func TestPullWithRetry(t *testing.T) {
+	logger := log.WithFields(log.Fields{"image": "img"})
+
+	t.Run("Retryable errors", func(t *testing.T) {
+		p := &stubPuller{errs: []error{statusErr("503 Service Unavailable"), errors.New("connection reset by peer")}}
+
+		_, err := pullWithRetry(context.Background(), p.pull, 3, time.Millisecond, logger)
+		require.NoError(t, err, "pull did not succeed after retries")
+		require.Equal(t, 3, p.calls, "wrong number of pull attempts")
+	})
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		p := &stubPuller{errs: []error{statusErr("500 Internal Server Error"), statusErr("502 Bad Gateway"), statusErr("503 Service Unavailable")}}
+
+		_, err := pullWithRetry(context.Background(), p.pull, 2, time.Millisecond, logger)
+		require.Error(t, err, "pull succeeded")
+		require.Equal(t, 3, p.calls, "wrong number of pull attempts")
+	})
+
+	t.Run("Client error", func(t *testing.T) {
+		p := &stubPuller{errs: []error{statusErr("403 Forbidden")}}
+
+		_, err := pullWithRetry(context.Background(), p.pull, 3, time.Millisecond, logger)
+		require.Error(t, err, "pull succeeded")
+		require.Equal(t, 1, p.calls, "client error was retried")
+	})
+
+	t.Run("Cancelled backoff", func(t *testing.T) {
+		p := &stubPuller{errs: []error{statusErr("503 Service Unavailable")}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := pullWithRetry(ctx, p.pull, 3, time.Hour, logger)
+		require.Error(t, err, "pull succeeded")
+		require.Equal(t, 1, p.calls, "pull was retried after cancellation")
+	})
+}
+
+func TestIsRetryablePullError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: statusErr("500 Internal Server Error"), retryable: true},
+		{err: statusErr("503 Service Unavailable"), retryable: true},
+		{err: statusErr("429 Too Many Requests"), retryable: true},
+		{err: statusErr("408 Request Timeout"), retryable: true},
+		{err: errors.New("dial tcp: i/o timeout"), retryable: true},
+		{err: errors.Errorf("unexpected status: %s", "401 Unauthorized"), retryable: false},
+		{err: statusErr("404 Not Found"), retryable: false},
+		{err: errors.Wrap(errdefs.ErrNotFound, "docker.io/library/img:latest"), retryable: false},
+		{err: errors.Wrap(docker.ErrInvalidAuthorization, "failed to fetch anonymous token"), retryable: false},
+		{err: errors.Wrap(context.DeadlineExceeded, "failed to resolve"), retryable: false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.err), func(t *testing.T) {
+			require.Equal(t, c.retryable, isRetryablePullError(c.err))
+		})
+	}
+}
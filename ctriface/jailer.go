@@ -0,0 +1,218 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/firecracker-microvm/firecracker-containerd/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// jailerExecName is the name of the binary run by the jailer,
+// which is part of the path of the jails
+const jailerExecName = "firecracker"
+
+// JailerConfig configures the jailer that launches each firecracker
+// in a dedicated chroot, under a dedicated uid and cgroup
+type JailerConfig struct {
+	// ChrootBaseDir is the directory of the jails,
+	// each VM is jailed in <ChrootBaseDir>/firecracker/<vmID>/root
+	ChrootBaseDir string
+	// UIDBase and UIDCount define the range of uids given to the VMs,
+	// each running VM gets a distinct uid of the range
+	UIDBase  uint32
+	UIDCount uint32
+	// GID is the group of all the jailed VMs
+	GID uint32
+	// CgroupPath is the parent cgroup of the VMs,
+	// the firecracker-containerd default if empty
+	CgroupPath string
+	// NetNS is the network namespace the VMs are joined to,
+	// the host namespace if empty
+	NetNS string
+}
+
+// jailer keeps track of the jails of the VMs
+type jailer struct {
+	sync.Mutex
+
+	cfg    JailerConfig
+	uids   map[string]uint32
+	used   map[uint32]bool
+	mounts map[string][]string
+}
+
+func newJailer(cfg JailerConfig) *jailer {
+	return &jailer{
+		cfg:    cfg,
+		uids:   make(map[string]uint32),
+		used:   make(map[uint32]bool),
+		mounts: make(map[string][]string),
+	}
+}
+
+// jailDir returns the directory of the jail of a VM
+func (j *jailer) jailDir(vmID string) string {
+	return filepath.Join(j.cfg.ChrootBaseDir, jailerExecName, vmID)
+}
+
+// rootDir returns the chroot of a VM
+func (j *jailer) rootDir(vmID string) string {
+	return filepath.Join(j.jailDir(vmID), "root")
+}
+
+// allocateUID returns the lowest free uid of the range for a VM
+func (j *jailer) allocateUID(vmID string) (uint32, error) {
+	j.Lock()
+	defer j.Unlock()
+
+	if _, isPresent := j.uids[vmID]; isPresent {
+		return 0, errors.Errorf("VM %s is already jailed", vmID)
+	}
+
+	for i := uint32(0); i < j.cfg.UIDCount; i++ {
+		uid := j.cfg.UIDBase + i
+		if !j.used[uid] {
+			j.used[uid] = true
+			j.uids[vmID] = uid
+			return uid, nil
+		}
+	}
+
+	return 0, errors.Errorf("no free uid in the range of %d uids from %d", j.cfg.UIDCount, j.cfg.UIDBase)
+}
+
+// freeUID returns the uid of a VM to the range
+func (j *jailer) freeUID(vmID string) {
+	j.Lock()
+	defer j.Unlock()
+
+	if uid, isPresent := j.uids[vmID]; isPresent {
+		delete(j.used, uid)
+		delete(j.uids, vmID)
+	}
+}
+
+// setup creates the jail of a VM and exposes the given host files in it
+// at the same paths, returning the jailer configuration of the VM.
+// The jail is removed if it cannot be fully set up.
+func (j *jailer) setup(vmID string, files []string) (_ *proto.JailerConfig, retErr error) {
+	uid, err := j.allocateUID(vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := j.cleanup(vmID); err != nil {
+				log.WithFields(log.Fields{"vmID": vmID}).WithError(err).Error("failed to remove jail after failure")
+			}
+		}
+	}()
+
+	root := j.rootDir(vmID)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create jail")
+	}
+	if err := os.Chown(root, int(uid), int(j.cfg.GID)); err != nil {
+		return nil, errors.Wrap(err, "failed to chown jail")
+	}
+
+	for _, file := range files {
+		if err := j.exposeFile(vmID, file, uid); err != nil {
+			return nil, errors.Wrapf(err, "failed to expose %s in jail", file)
+		}
+	}
+
+	return &proto.JailerConfig{
+		NetNS:      j.cfg.NetNS,
+		UID:        uid,
+		GID:        j.cfg.GID,
+		CgroupPath: j.cfg.CgroupPath,
+	}, nil
+}
+
+// exposeFile hard links a host file into the jail of a VM,
+// bind mounting it if the jail is on another filesystem
+func (j *jailer) exposeFile(vmID, file string, uid uint32) error {
+	dst := filepath.Join(j.rootDir(vmID), file)
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+
+	err := os.Link(file, dst)
+	if err == nil {
+		return os.Chown(dst, int(uid), int(j.cfg.GID))
+	}
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if err := syscall.Mount(file, dst, "", syscall.MS_BIND, ""); err != nil {
+		return err
+	}
+
+	j.Lock()
+	j.mounts[vmID] = append(j.mounts[vmID], dst)
+	j.Unlock()
+
+	return nil
+}
+
+// cleanup unmounts the files bind mounted in the jail of a VM,
+// removes the jail and frees the uid of the VM
+func (j *jailer) cleanup(vmID string) error {
+	j.Lock()
+	mounts := j.mounts[vmID]
+	delete(j.mounts, vmID)
+	j.Unlock()
+
+	for i, m := range mounts {
+		if err := syscall.Unmount(m, syscall.MNT_DETACH); err != nil {
+			j.Lock()
+			j.mounts[vmID] = mounts[i:]
+			j.Unlock()
+			return errors.Wrapf(err, "failed to unmount %s", m)
+		}
+	}
+
+	// The bind mounts are gone, so removing the jail never reaches the host files
+	if err := os.RemoveAll(j.jailDir(vmID)); err != nil {
+		return errors.Wrap(err, "failed to remove jail")
+	}
+
+	j.freeUID(vmID)
+
+	return nil
+}
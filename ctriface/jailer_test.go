@@ -0,0 +1,120 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJailerPaths(t *testing.T) {
+	j := newJailer(JailerConfig{ChrootBaseDir: "/srv/jailer"})
+
+	require.Equal(t, "/srv/jailer/firecracker/42", j.jailDir("42"))
+	require.Equal(t, "/srv/jailer/firecracker/42/root", j.rootDir("42"))
+}
+
+func TestJailerAllocateUID(t *testing.T) {
+	j := newJailer(JailerConfig{UIDBase: 1000, UIDCount: 2})
+
+	uid, err := j.allocateUID("1")
+	require.NoError(t, err, "Failed to allocate uid")
+	require.Equal(t, uint32(1000), uid)
+
+	_, err = j.allocateUID("1")
+	require.Error(t, err, "VM got two uids")
+
+	uid, err = j.allocateUID("2")
+	require.NoError(t, err, "Failed to allocate uid")
+	require.Equal(t, uint32(1001), uid)
+
+	_, err = j.allocateUID("3")
+	require.Error(t, err, "uid was allocated beyond the range")
+
+	j.freeUID("1")
+
+	uid, err = j.allocateUID("3")
+	require.NoError(t, err, "Failed to reuse a freed uid")
+	require.Equal(t, uint32(1000), uid)
+}
+
+func requireRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("jails can only be set up by root")
+	}
+}
+
+func TestJailerSetup(t *testing.T) {
+	requireRoot(t)
+
+	hostDir, err := ioutil.TempDir("", "host")
+	require.NoError(t, err, "Failed to create host dir")
+	defer os.RemoveAll(hostDir)
+
+	chrootBase, err := ioutil.TempDir("", "jailer")
+	require.NoError(t, err, "Failed to create chroot base dir")
+	defer os.RemoveAll(chrootBase)
+
+	file := filepath.Join(hostDir, "disk.img")
+	require.NoError(t, ioutil.WriteFile(file, []byte("disk"), 0600), "Failed to create host file")
+
+	j := newJailer(JailerConfig{ChrootBaseDir: chrootBase, UIDBase: 200000, UIDCount: 1, GID: 200000, NetNS: "/var/run/netns/vhive"})
+
+	cfg, err := j.setup("1", []string{file})
+	require.NoError(t, err, "Failed to set up jail")
+	require.Equal(t, uint32(200000), cfg.UID)
+	require.Equal(t, uint32(200000), cfg.GID)
+	require.Equal(t, "/var/run/netns/vhive", cfg.NetNS)
+
+	data, err := ioutil.ReadFile(filepath.Join(j.rootDir("1"), file))
+	require.NoError(t, err, "File was not exposed in jail")
+	require.Equal(t, "disk", string(data))
+
+	require.NoError(t, j.cleanup("1"), "Failed to remove jail")
+	require.NoDirExists(t, j.jailDir("1"), "Jail was not removed")
+	require.FileExists(t, file, "Host file was removed with the jail")
+
+	_, err = j.allocateUID("2")
+	require.NoError(t, err, "uid was not freed with the jail")
+}
+
+func TestJailerSetupCleansUpOnFailure(t *testing.T) {
+	requireRoot(t)
+
+	chrootBase, err := ioutil.TempDir("", "jailer")
+	require.NoError(t, err, "Failed to create chroot base dir")
+	defer os.RemoveAll(chrootBase)
+
+	j := newJailer(JailerConfig{ChrootBaseDir: chrootBase, UIDBase: 200000, UIDCount: 1})
+
+	_, err = j.setup("1", []string{filepath.Join(chrootBase, "missing.img")})
+	require.Error(t, err, "Jail was set up with a missing file")
+	require.NoDirExists(t, j.jailDir("1"), "Jail was not removed after failure")
+
+	_, err = j.allocateUID("2")
+	require.NoError(t, err, "uid was not freed after failure")
+}
@@ -0,0 +1,202 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// sysfsNodeDir is where the kernel describes the NUMA nodes of the host
+const sysfsNodeDir = "/sys/devices/system/node"
+
+// NUMANode is a NUMA node of the host
+type NUMANode struct {
+	ID int
+	// CPUs is the list of the cores of the node, in the cpuset list format
+	CPUs string
+	// MemoryMib is the memory of the node
+	MemoryMib uint64
+}
+
+// topologyProvider returns the NUMA nodes of the host
+type topologyProvider interface {
+	Nodes() ([]NUMANode, error)
+}
+
+// sysfsTopology reads the NUMA nodes of the host from sysfs
+type sysfsTopology struct {
+	root string
+}
+
+// Nodes Returns the NUMA nodes that have both cores and memory
+func (s sysfsTopology) Nodes() ([]NUMANode, error) {
+	dirs, err := filepath.Glob(filepath.Join(s.root, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []NUMANode
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+
+		cpus, err := ioutil.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+
+		memoryMib, err := readNodeMemTotal(filepath.Join(dir, "meminfo"))
+		if err != nil {
+			return nil, err
+		}
+
+		node := NUMANode{ID: id, CPUs: strings.TrimSpace(string(cpus)), MemoryMib: memoryMib}
+		if node.CPUs == "" || node.MemoryMib == 0 {
+			continue
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		return nil, errors.Errorf("no NUMA nodes with cores and memory in %s", s.root)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes, nil
+}
+
+// readNodeMemTotal returns the memory of a node from its meminfo,
+// whose lines look like "Node 0 MemTotal:        6147400 kB"
+func readNodeMemTotal(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[2] == "MemTotal:" {
+			kib, err := strconv.ParseUint(fields[3], 10, 64)
+			if err != nil {
+				return 0, errors.Wrapf(err, "malformed %s", path)
+			}
+
+			return kib / 1024, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.Errorf("no MemTotal in %s", path)
+}
+
+// numaPlacer places each VM on the NUMA node with the least committed memory,
+// so that the vCPUs and the memory of a VM are on the same node
+type numaPlacer struct {
+	sync.Mutex
+
+	nodes []NUMANode
+	// the guest memory committed on each node
+	committed map[int]uint64
+	// the node and the guest memory of each placed VM
+	placements map[string]placement
+}
+
+type placement struct {
+	node      int
+	memoryMib uint64
+}
+
+func newNUMAPlacer(topology topologyProvider) (*numaPlacer, error) {
+	nodes, err := topology.Nodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the NUMA topology")
+	}
+
+	return &numaPlacer{
+		nodes:      nodes,
+		committed:  make(map[int]uint64),
+		placements: make(map[string]placement),
+	}, nil
+}
+
+// place commits the guest memory of a VM to the least loaded node that fits it
+func (p *numaPlacer) place(vmID string, memoryMib uint64) (*NUMANode, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, isPresent := p.placements[vmID]; isPresent {
+		return nil, errors.Errorf("VM %s is already placed", vmID)
+	}
+
+	var best *NUMANode
+	for i := range p.nodes {
+		node := &p.nodes[i]
+		if p.committed[node.ID]+memoryMib > node.MemoryMib {
+			continue
+		}
+
+		// Compare the committed fractions of the nodes, which may differ in size
+		if best == nil || p.committed[node.ID]*best.MemoryMib < p.committed[best.ID]*node.MemoryMib {
+			best = node
+		}
+	}
+
+	if best == nil {
+		return nil, errors.Errorf("no NUMA node has %d MiB of uncommitted memory", memoryMib)
+	}
+
+	p.committed[best.ID] += memoryMib
+	p.placements[vmID] = placement{node: best.ID, memoryMib: memoryMib}
+
+	node := *best
+	return &node, nil
+}
+
+// release returns the guest memory of a VM to its node
+func (p *numaPlacer) release(vmID string) {
+	p.Lock()
+	defer p.Unlock()
+
+	if pl, isPresent := p.placements[vmID]; isPresent {
+		p.committed[pl.node] -= pl.memoryMib
+		delete(p.placements, vmID)
+	}
+}
@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTopology is a host with the given NUMA nodes
+type fakeTopology []NUMANode
+
+func (f fakeTopology) Nodes() ([]NUMANode, error) {
+	return f, nil
+}
+
+func twoSocketTopology() fakeTopology {
+	return fakeTopology{
+		{ID: 0, CPUs: "0-7,16-23", MemoryMib: 1024},
+		{ID: 1, CPUs: "8-15,24-31", MemoryMib: 1024},
+	}
+}
+
+func TestNUMAPlacementLeastLoaded(t *testing.T) {
+	p, err := newNUMAPlacer(twoSocketTopology())
+	require.NoError(t, err, "Failed to create NUMA placer")
+
+	var nodes []int
+	for i := 0; i < 4; i++ {
+		node, err := p.place(fmt.Sprint(i), 256)
+		require.NoError(t, err, "Failed to place VM")
+		nodes = append(nodes, node.ID)
+	}
+	require.Equal(t, []int{0, 1, 0, 1}, nodes, "VMs were not spread over the nodes")
+
+	node, err := p.place("4", 256)
+	require.NoError(t, err, "Failed to place VM")
+	require.Equal(t, "0-7,16-23", node.CPUs, "Node has the wrong cores")
+
+	_, err = p.place("4", 256)
+	require.Error(t, err, "VM was placed twice")
+}
+
+func TestNUMAPlacementRebalancesWhenNodeFills(t *testing.T) {
+	p, err := newNUMAPlacer(twoSocketTopology())
+	require.NoError(t, err, "Failed to create NUMA placer")
+
+	// Node 0 has room for one more 256 MiB VM only
+	node, err := p.place("big", 768)
+	require.NoError(t, err, "Failed to place VM")
+	require.Equal(t, 0, node.ID)
+
+	var nodes []int
+	for i := 0; i < 5; i++ {
+		node, err := p.place(fmt.Sprint(i), 256)
+		require.NoError(t, err, "Failed to place VM")
+		nodes = append(nodes, node.ID)
+	}
+	require.Equal(t, []int{1, 1, 1, 0, 1}, nodes, "VMs were not placed on the least loaded node with room")
+
+	_, err = p.place("full", 256)
+	require.Error(t, err, "VM was placed on a full host")
+
+	p.release("big")
+
+	node, err = p.place("after-release", 512)
+	require.NoError(t, err, "Released memory was not returned to the node")
+	require.Equal(t, 0, node.ID)
+}
+
+func TestNUMAPlacementUnevenNodes(t *testing.T) {
+	p, err := newNUMAPlacer(fakeTopology{
+		{ID: 0, CPUs: "0-3", MemoryMib: 512},
+		{ID: 1, CPUs: "4-15", MemoryMib: 2048},
+	})
+	require.NoError(t, err, "Failed to create NUMA placer")
+
+	var nodes []int
+	for i := 0; i < 5; i++ {
+		node, err := p.place(fmt.Sprint(i), 256)
+		require.NoError(t, err, "Failed to place VM")
+		nodes = append(nodes, node.ID)
+	}
+	// Node 1 is four times larger, so it takes VMs until it is as loaded as node 0
+	require.Equal(t, []int{0, 1, 1, 1, 1}, nodes, "VMs were not placed by committed fraction")
+}
+
+func TestSysfsTopology(t *testing.T) {
+	root, err := ioutil.TempDir("", "node")
+	require.NoError(t, err, "Failed to create sysfs dir")
+	defer os.RemoveAll(root)
+
+	writeNode := func(id int, cpus string, memKiB int) {
+		dir := filepath.Join(root, fmt.Sprintf("node%d", id))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpus+"\n"), 0644))
+		meminfo := fmt.Sprintf("Node %d MemTotal:       %d kB\nNode %d MemFree:        1024 kB\n", id, memKiB, id)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0644))
+	}
+
+	writeNode(1, "8-15", 2*1024*1024)
+	writeNode(0, "0-7", 1024*1024)
+	// A memory-only node cannot run vCPUs
+	writeNode(2, "", 1024*1024)
+
+	nodes, err := sysfsTopology{root: root}.Nodes()
+	require.NoError(t, err, "Failed to read topology")
+	require.Equal(t, []NUMANode{
+		{ID: 0, CPUs: "0-7", MemoryMib: 1024},
+		{ID: 1, CPUs: "8-15", MemoryMib: 2048},
+	}, nodes)
+
+	_, err = sysfsTopology{root: filepath.Join(root, "missing")}.Nodes()
+	require.Error(t, err, "Topology was read from a missing dir")
+}
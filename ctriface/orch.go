@@ -39,9 +39,11 @@ import (
 	_ "google.golang.org/grpc/codes"  //tmp
 	_ "google.golang.org/grpc/status" //tmp
 
+	"github.com/ease-lab/vhive/logging"
 	"github.com/ease-lab/vhive/memory/manager"
 	"github.com/ease-lab/vhive/metrics"
 	"github.com/ease-lab/vhive/misc"
+	"github.com/ease-lab/vhive/taps"
 
 	_ "github.com/davecgh/go-spew/spew" //tmp
 )
@@ -54,11 +56,11 @@ const (
 
 // Orchestrator Drives all VMs
 type Orchestrator struct {
-	vmPool       *misc.VMPool
-	cachedImages map[string]containerd.Image
-	snapshotter  string
-	client       *containerd.Client
-	fcClient     *fcclient.Client
+	vmPool      *misc.VMPool
+	images      *imageHandleCache
+	snapshotter string
+	client      *containerd.Client
+	fcClient    *fcclient.Client
 	// store *skv.KVStore
 	snapshotsEnabled bool
 	isUPFEnabled     bool
@@ -66,6 +68,17 @@ type Orchestrator struct {
 	snapshotsDir     string
 	isMetricsMode    bool
 	hostIface        string
+	imagePullRetries int
+	imagePullBackoff time.Duration
+	rootfsMode       RootfsMode
+	jailer           *jailer
+	cniConfig        *taps.CNIConfig
+	vmSubnets        []taps.SubnetConfig
+	preparedTaps     int
+	isNUMAEnabled    bool
+	numa             *numaPlacer
+	hugepages        *hugepagePool
+	cpuBoost         *cpuBooster
 
 	memoryManager *manager.MemoryManager
 }
@@ -75,16 +88,40 @@ func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption)
 	var err error
 
 	o := new(Orchestrator)
-	o.vmPool = misc.NewVMPool()
-	o.cachedImages = make(map[string]containerd.Image)
+	o.images = newImageHandleCache(defaultImageCacheTTL)
 	o.snapshotter = snapshotter
 	o.snapshotsDir = "/fccd/snapshots"
 	o.hostIface = hostIface
+	o.imagePullRetries = defaultImagePullRetries
+	o.imagePullBackoff = defaultImagePullBackoff
+	o.rootfsMode = RootfsCopy
 
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	if o.cniConfig != nil {
+		if o.vmPool, err = misc.NewCNIVMPool(*o.cniConfig); err != nil {
+			log.Fatal("Failed to load CNI network", err)
+		}
+	} else if o.vmSubnets != nil {
+		if o.vmPool, err = misc.NewVMPoolWithSubnets(o.vmSubnets); err != nil {
+			log.Fatal("Failed to configure the subnets of the VMs", err)
+		}
+	} else {
+		o.vmPool = misc.NewVMPool()
+	}
+
+	if o.preparedTaps > 0 && !o.vmPool.EnablePreparedTaps(o.preparedTaps, o.hostIface) {
+		log.Warn("Prepared taps are not supported with CNI, creating the taps with the VMs")
+	}
+
+	if o.isNUMAEnabled {
+		if o.numa, err = newNUMAPlacer(sysfsTopology{root: sysfsNodeDir}); err != nil {
+			log.Fatal("Failed to set up NUMA placement", err)
+		}
+	}
+
 	if _, err := os.Stat(o.snapshotsDir); err != nil {
 		if !os.IsNotExist(err) {
 			log.Panicf("Snapshot dir %s exists", o.snapshotsDir)
@@ -95,7 +132,8 @@ func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption)
 		log.Panicf("Failed to create snapshots dir %s", o.snapshotsDir)
 	}
 
-	if o.GetUPFEnabled() {
+	// The memory manager serves all the VMs in the UPF mode, or only those with REAP
+	if o.GetUPFEnabled() || o.GetSnapshotsEnabled() {
 		managerCfg := manager.MemoryManagerCfg{
 			MetricsModeOn: o.isMetricsMode,
 		}
@@ -139,6 +177,16 @@ func (o *Orchestrator) Cleanup() {
 	}
 }
 
+// HasVM Returns whether the orchestrator runs a VM with the vmID
+func (o *Orchestrator) HasVM(vmID string) bool {
+	return o.vmPool.HasVM(vmID)
+}
+
+// PreparedTapStats Returns the hits and misses of the taps created ahead of the VMs
+func (o *Orchestrator) PreparedTapStats() taps.PreparedTapStats {
+	return o.vmPool.PreparedTapStats()
+}
+
 // GetSnapshotsEnabled Returns the snapshots mode of the orchestrator
 func (o *Orchestrator) GetSnapshotsEnabled() bool {
 	return o.snapshotsEnabled
@@ -152,7 +200,7 @@ func (o *Orchestrator) GetUPFEnabled() bool {
 // DumpUPFPageStats Dumps the memory manager's stats about the number of
 // the unique pages and the number of the pages that are reused across invocations
 func (o *Orchestrator) DumpUPFPageStats(vmID, functionName, metricsOutFilePath string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.Logger(logging.MemoryManager).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received DumpUPFPageStats")
 
 	return o.memoryManager.DumpUPFPageStats(vmID, functionName, metricsOutFilePath)
@@ -160,7 +208,7 @@ func (o *Orchestrator) DumpUPFPageStats(vmID, functionName, metricsOutFilePath s
 
 // DumpUPFLatencyStats Dumps the memory manager's latency stats
 func (o *Orchestrator) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePath string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.Logger(logging.MemoryManager).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received DumpUPFPageStats")
 
 	return o.memoryManager.DumpUPFLatencyStats(vmID, functionName, latencyOutFilePath)
@@ -168,12 +216,38 @@ func (o *Orchestrator) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePat
 
 // GetUPFLatencyStats Returns the memory manager's latency stats
 func (o *Orchestrator) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, error) {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := logging.Logger(logging.MemoryManager).WithFields(log.Fields{"vmID": vmID})
 	logger.Debug("Orchestrator received DumpUPFPageStats")
 
 	return o.memoryManager.GetUPFLatencyStats(vmID)
 }
 
+// GetWorkingSetCorruptions Returns the number of corrupt working set files
+// quarantined by the memory manager, whose VMs recorded their working set again
+func (o *Orchestrator) GetWorkingSetCorruptions() uint64 {
+	if o.memoryManager == nil {
+		return 0
+	}
+
+	return o.memoryManager.Corruptions()
+}
+
+// GetSnapshotFiles Returns the files a snapshot of a VM is stored in and loaded from
+func (o *Orchestrator) GetSnapshotFiles(vmID string) (snapFile, memFile string) {
+	memFile = o.getMemoryFile(vmID)
+	if vm, err := o.vmPool.GetVM(vmID); err == nil {
+		memFile = o.getLoadMemoryFile(vm)
+	}
+
+	return o.getSnapshotFile(vmID), memFile
+}
+
+// GetWorkingSetFile Returns the file of the working set of the guest memory
+// of a VM recorded by the user-level page faults, which may not exist
+func (o *Orchestrator) GetWorkingSetFile(vmID string) string {
+	return o.getWorkingSetFile(vmID)
+}
+
 func (o *Orchestrator) getSnapshotFile(vmID string) string {
 	return filepath.Join(o.getVMBaseDir(vmID), "snap_file")
 }
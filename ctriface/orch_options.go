@@ -22,6 +22,12 @@
 
 package ctriface
 
+import (
+	"time"
+
+	"github.com/ease-lab/vhive/taps"
+)
+
 // OrchestratorOption Options to pass to Orchestrator
 type OrchestratorOption func(*Orchestrator)
 
@@ -80,3 +86,95 @@ func WithCustomHostIface(hostIface string) OrchestratorOption {
 		o.hostIface = hostIface
 	}
 }
+
+// WithImagePullRetries Sets the number of times a failed image pull
+// is retried, unless the registry rejected the request
+func WithImagePullRetries(retries int) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.imagePullRetries = retries
+	}
+}
+
+// WithImagePullBackoff Sets the delay before the first retry of a failed
+// image pull, which doubles with every retry
+func WithImagePullBackoff(backoff time.Duration) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.imagePullBackoff = backoff
+	}
+}
+
+// WithImageCacheTTL Sets how long the image resolved for a tag is reused
+// before the tag is resolved again, images pinned by digest never expire
+func WithImageCacheTTL(ttl time.Duration) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.images.ttl = ttl
+	}
+}
+
+// WithRootfsMode Sets whether each VM gets a writable copy of the image
+// or shares it read-only with a writable overlay
+func WithRootfsMode(mode RootfsMode) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.rootfsMode = mode
+	}
+}
+
+// WithJailer Launches each firecracker with the jailer in a dedicated
+// chroot, under a dedicated uid and cgroup
+func WithJailer(cfg JailerConfig) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.jailer = newJailer(cfg)
+	}
+}
+
+// WithCNI Runs each VM in its own network namespace wired by
+// the given CNI plugin chain, instead of the host bridges
+func WithCNI(cfg taps.CNIConfig) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.cniConfig = &cfg
+	}
+}
+
+// WithVMSubnets Assigns the addresses of the VMs from the given subnets,
+// with a bridge per subnet, instead of the default ones
+func WithVMSubnets(subnets []taps.SubnetConfig) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.vmSubnets = subnets
+	}
+}
+
+// WithNUMAPlacement Places each VM on the NUMA node with the least committed
+// memory, confining its vCPUs and memory to the node with the cpuset of its jail
+func WithNUMAPlacement(enabled bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.isNUMAEnabled = enabled
+	}
+}
+
+// WithCPUBoosting Allows the VMs to be booted with a boosted CFS quota on
+// the cgroups of their jails, throttled down after their cold start
+func WithCPUBoosting(enabled bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		if enabled {
+			o.cpuBoost = newCPUBooster(cpuCgroupRoot)
+		}
+	}
+}
+
+// WithHugetlbfs Sets the hugetlbfs mount that backs the guest memory of
+// the VMs requesting hugepages, an empty dir disables hugepages
+func WithHugetlbfs(dir string) OrchestratorOption {
+	return func(o *Orchestrator) {
+		if dir != "" {
+			o.hugepages = newHugepagePool(dir, freeHugepagesPath)
+		}
+	}
+}
+
+// WithPreparedTaps Keeps the given number of taps created ahead of the VMs,
+// so that booting a VM does not wait for its tap, 0 disables them
+func WithPreparedTaps(n int) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.preparedTaps = n
+	}
+}
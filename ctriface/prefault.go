@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"errors"
+	"os"
+
+	"github.com/ease-lab/vhive/misc"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// errPrefaultUnsupported is returned when the guest memory backing cannot be pre-faulted
+var errPrefaultUnsupported = errors.New("guest memory backing does not support pre-faulting")
+
+// prefaultSnapshotMemory pre-faults the guest memory of a VM being restored
+// from a snapshot if it asked for it, and returns whether it did. Hugepages are
+// resident already, so only page-cache backed memory is pre-faulted.
+func (o *Orchestrator) prefaultSnapshotMemory(vm *misc.VM, logger *log.Entry) bool {
+	if !vm.Prefault || vm.Hugepages {
+		return false
+	}
+
+	o.prefaultGuestMemory(vm.ID, logger)
+	return true
+}
+
+// prefaultGuestMemory pre-faults the guest memory backing file of the VM,
+// failures only cost latency so they are not propagated
+func (o *Orchestrator) prefaultGuestMemory(vmID string, logger *log.Entry) {
+	err := prefaultMemoryFile(o.getMemoryFile(vmID))
+	switch {
+	case err == errPrefaultUnsupported:
+		logger.Debug("guest memory backing does not support pre-faulting, skipping")
+	case err != nil:
+		logger.WithError(err).Warn("failed to pre-fault guest memory")
+	}
+}
+
+// PrefetchFile Reads a snapshot file into the page cache, e.g., once for the
+// restores of the VMs that load it. Missing and empty files are skipped.
+func PrefetchFile(path string) error {
+	if err := prefaultMemoryFile(path); err != errPrefaultUnsupported {
+		return err
+	}
+	return nil
+}
+
+// prefaultMemoryFile populates the page cache with the guest memory backing file
+// and advises transparent huge pages for it
+func prefaultMemoryFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errPrefaultUnsupported
+		}
+		return err
+	}
+
+	if !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return errPrefaultUnsupported
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// MAP_POPULATE reads the whole file in, so that the pages are
+	// in the page cache when the VMM maps the file
+	mem, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unix.Munmap(mem); err != nil {
+			log.WithError(err).Warn("failed to munmap guest memory file")
+		}
+	}()
+
+	if err := unix.Madvise(mem, unix.MADV_WILLNEED); err != nil {
+		return err
+	}
+
+	// Huge pages for file-backed memory depend on the kernel config, so this is only a hint
+	if err := unix.Madvise(mem, unix.MADV_HUGEPAGE); err != nil {
+		log.WithError(err).Debug("transparent huge pages are not available for guest memory file")
+	}
+
+	return nil
+}
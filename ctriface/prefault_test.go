@@ -0,0 +1,159 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/ease-lab/vhive/misc"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const prefaultFileSize = 16 * 1024 * 1024
+
+// createEvictedFile creates a memory file whose pages are not in the page cache
+func createEvictedFile(tb testing.TB) string {
+	path := filepath.Join(tb.TempDir(), "mem_file")
+
+	f, err := os.Create(path)
+	require.NoError(tb, err, "failed to create memory file")
+	defer f.Close()
+
+	_, err = f.Write(make([]byte, prefaultFileSize))
+	require.NoError(tb, err, "failed to write memory file")
+	require.NoError(tb, f.Sync(), "failed to sync memory file")
+	evictFile(tb, f)
+
+	return path
+}
+
+func evictFile(tb testing.TB, f *os.File) {
+	err := unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	require.NoError(tb, err, "failed to evict memory file from page cache")
+}
+
+// residentPages returns the number of pages of the file in the page cache
+func residentPages(t *testing.T, path string) (resident, total int) {
+	f, err := os.Open(path)
+	require.NoError(t, err, "failed to open memory file")
+	defer f.Close()
+
+	mem, err := unix.Mmap(int(f.Fd()), 0, prefaultFileSize, unix.PROT_READ, unix.MAP_SHARED)
+	require.NoError(t, err, "failed to mmap memory file")
+	defer unix.Munmap(mem)
+
+	vec := make([]byte, (prefaultFileSize+os.Getpagesize()-1)/os.Getpagesize())
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE,
+		uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)), uintptr(unsafe.Pointer(&vec[0])))
+	require.Zero(t, errno, "failed to query page residency")
+
+	for _, v := range vec {
+		if v&1 != 0 {
+			resident++
+		}
+	}
+
+	return resident, len(vec)
+}
+
+func TestPrefaultMemoryFile(t *testing.T) {
+	path := createEvictedFile(t)
+
+	require.NoError(t, prefaultMemoryFile(path), "failed to prefault memory file")
+
+	resident, total := residentPages(t, path)
+	require.Equal(t, total, resident, "memory file is not fully in the page cache")
+}
+
+func TestPrefaultMemoryFileUnsupported(t *testing.T) {
+	dir := t.TempDir()
+
+	require.Equal(t, errPrefaultUnsupported, prefaultMemoryFile(filepath.Join(dir, "mem_file")), "missing file is prefaulted")
+	require.Equal(t, errPrefaultUnsupported, prefaultMemoryFile(dir), "directory is prefaulted")
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, ioutil.WriteFile(empty, nil, 0644))
+	require.Equal(t, errPrefaultUnsupported, prefaultMemoryFile(empty), "empty file is prefaulted")
+}
+
+func TestPrefaultSnapshotMemory(t *testing.T) {
+	cases := []struct {
+		name             string
+		prefault         bool
+		hugepages        bool
+		expectPrefaulted bool
+	}{
+		{name: "Enabled", prefault: true, expectPrefaulted: true},
+		{name: "Disabled"},
+		{name: "Hugepages", prefault: true, hugepages: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := createEvictedFile(t)
+			vmDir := filepath.Dir(path)
+			o := &Orchestrator{snapshotsDir: filepath.Dir(vmDir)}
+
+			vm := misc.NewVM(filepath.Base(vmDir))
+			vm.Prefault, vm.Hugepages = c.prefault, c.hugepages
+			require.Equal(t, path, o.getMemoryFile(vm.ID))
+
+			prefaulted := o.prefaultSnapshotMemory(vm, log.NewEntry(log.StandardLogger()))
+			require.Equal(t, c.expectPrefaulted, prefaulted, "wrong pre-faulting decision")
+
+			resident, total := residentPages(t, path)
+			if c.expectPrefaulted {
+				require.Equal(t, total, resident, "memory file is not fully in the page cache")
+			} else {
+				require.Less(t, resident, total, "memory file was pre-faulted")
+			}
+		})
+	}
+}
+
+func BenchmarkPrefaultMemoryFile(b *testing.B) {
+	path := createEvictedFile(b)
+
+	f, err := os.Open(path)
+	require.NoError(b, err, "failed to open memory file")
+	defer f.Close()
+
+	b.SetBytes(prefaultFileSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		evictFile(b, f)
+		b.StartTimer()
+
+		if err := prefaultMemoryFile(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
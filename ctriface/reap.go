@@ -0,0 +1,104 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reapTraceDir is the directory of the snapshots directory keeping the traces
+// shared by the VMs of the functions restored with REAP
+const reapTraceDir = "reap"
+
+// checkREAP rejects REAP for the VMs that are never restored from a snapshot
+func (o *Orchestrator) checkREAP(vmOpts *StartVMOptions) error {
+	switch trace := vmOpts.REAPTrace; {
+	case trace == "":
+		return nil
+	case !o.GetSnapshotsEnabled():
+		return status.Error(codes.FailedPrecondition, "REAP requires snapshots, as only restored VMs record and prefetch their working set")
+	case trace != filepath.Base(trace) || trace == "." || trace == "..":
+		return status.Errorf(codes.InvalidArgument, "invalid REAP trace name %q", trace)
+	}
+
+	return nil
+}
+
+// usesUPF returns whether the guest memory of the VM is served by user-level
+// page faults, for all the VMs in the UPF mode or for those with REAP
+func (o *Orchestrator) usesUPF(vm *misc.VM) bool {
+	return o.GetUPFEnabled() || (vm != nil && vm.REAP)
+}
+
+func (o *Orchestrator) getREAPTraceFile(trace string) string {
+	return filepath.Join(o.snapshotsDir, reapTraceDir, trace)
+}
+
+// WaitWorkingSet Waits until the working set recorded by REAP is installed in
+// the guest memory of a VM restored from a snapshot, which happens on its first
+// page fault once it is resumed, so that its first request faults none of it in
+func (o *Orchestrator) WaitWorkingSet(ctx context.Context, vmID string) (*metrics.Metric, error) {
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received WaitWorkingSet")
+
+	vm, err := o.vmPool.GetVM(vmID)
+	if err != nil {
+		return nil, err
+	}
+	if !o.usesUPF(vm) {
+		return nil, fmt.Errorf("VM %s is not restored with REAP", vmID)
+	}
+
+	tStart := time.Now()
+	pages, err := o.memoryManager.WaitWorkingSet(ctx, vmID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to wait for the working set")
+		return nil, err
+	}
+
+	waitMetric := metrics.NewMetric()
+	waitMetric.MetricMap[metrics.InstallWorkingSet] = metrics.ToUS(time.Since(tStart))
+	logger.WithField("pages", pages).Debug("Working set installed")
+
+	return waitMetric, nil
+}
+
+// GetWorkingSetPrefetches Returns the number of pages prefetched from the
+// working set files on the loads of the VMs and of those missing from them
+func (o *Orchestrator) GetWorkingSetPrefetches() (prefetched, missed uint64) {
+	if o.memoryManager == nil {
+		return 0, 0
+	}
+
+	return o.memoryManager.PrefetchStats()
+}
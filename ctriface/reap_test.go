@@ -0,0 +1,63 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"testing"
+
+	"github.com/ease-lab/vhive/misc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestREAPRejected(t *testing.T) {
+	cases := []struct {
+		name  string
+		orch  *Orchestrator
+		trace string
+		code  codes.Code
+	}{
+		{name: "NotRequested", orch: &Orchestrator{}, code: codes.OK},
+		{name: "WithoutSnapshots", orch: &Orchestrator{}, trace: "helloworld-00001", code: codes.FailedPrecondition},
+		{name: "InvalidName", orch: &Orchestrator{snapshotsEnabled: true}, trace: "../helloworld", code: codes.InvalidArgument},
+		{name: "Supported", orch: &Orchestrator{snapshotsEnabled: true}, trace: "helloworld-00001", code: codes.OK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.orch.checkREAP(NewStartVMOptions(WithREAP(c.trace)))
+			require.Equal(t, c.code, status.Code(err), "Unexpected error %v", err)
+		})
+	}
+}
+
+func TestUsesUPF(t *testing.T) {
+	o := &Orchestrator{snapshotsEnabled: true}
+	require.False(t, o.usesUPF(&misc.VM{}), "VM without REAP uses UPFs")
+	require.True(t, o.usesUPF(&misc.VM{REAP: true}), "VM with REAP does not use UPFs")
+	require.False(t, o.usesUPF(nil), "unknown VM uses UPFs")
+
+	o.isUPFEnabled = true
+	require.True(t, o.usesUPF(&misc.VM{}), "VM does not use UPFs in the UPF mode")
+}
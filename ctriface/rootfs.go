@@ -0,0 +1,100 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// RootfsMode defines how the rootfs of a function container is derived from its image
+type RootfsMode string
+
+const (
+	// RootfsCopy gives each VM a writable snapshot of the image
+	RootfsCopy RootfsMode = "copy"
+	// RootfsOverlay shares the read-only image across the VMs of the same image,
+	// each VM mounting a read-only view of it with a writable tmpfs overlay on
+	// the paths that functions write to
+	RootfsOverlay RootfsMode = "overlay"
+)
+
+// overlayTmpfsSize is the size limit of each writable tmpfs in the overlay mode
+const overlayTmpfsSize = "size=64m"
+
+// overlayWritablePaths are the paths of the rootfs that stay writable in the overlay mode
+var overlayWritablePaths = []string{"/tmp", "/var/tmp", "/run"}
+
+// ParseRootfsMode Returns the rootfs mode with the given name
+func ParseRootfsMode(mode string) (RootfsMode, error) {
+	switch m := RootfsMode(mode); m {
+	case RootfsCopy, RootfsOverlay:
+		return m, nil
+	default:
+		return "", errors.Errorf("unknown rootfs mode %q", mode)
+	}
+}
+
+// rootfsSnapshotOpt returns the option that creates the snapshot of the VM rootfs
+func rootfsSnapshotOpt(mode RootfsMode, vmID string, image containerd.Image) containerd.NewContainerOpts {
+	if mode == RootfsOverlay {
+		return containerd.WithNewSnapshotView(vmID, image)
+	}
+
+	return containerd.WithNewSnapshot(vmID, image)
+}
+
+// rootfsSpecOpts returns the spec options that make the rootfs usable in the given mode
+func rootfsSpecOpts(mode RootfsMode) []oci.SpecOpts {
+	if mode != RootfsOverlay {
+		return nil
+	}
+
+	var mounts []specs.Mount
+	for _, path := range overlayWritablePaths {
+		mounts = append(mounts, specs.Mount{
+			Source:      "tmpfs",
+			Destination: path,
+			Type:        "tmpfs",
+			Options:     []string{"nosuid", "nodev", "mode=1777", overlayTmpfsSize},
+		})
+	}
+
+	return []oci.SpecOpts{oci.WithRootFSReadonly(), oci.WithMounts(mounts)}
+}
+
+// removeRootfsSnapshot removes the rootfs snapshot of a VM whose container
+// could not be created, since the snapshot is created before the container
+func (o *Orchestrator) removeRootfsSnapshot(ctx context.Context, vmID string) error {
+	err := o.client.SnapshotService(o.snapshotter).Remove(ctx, vmID)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
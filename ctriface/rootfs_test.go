@@ -0,0 +1,73 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRootfsMode(t *testing.T) {
+	for _, mode := range []RootfsMode{RootfsCopy, RootfsOverlay} {
+		parsed, err := ParseRootfsMode(string(mode))
+		require.NoError(t, err, "Failed to parse rootfs mode")
+		require.Equal(t, mode, parsed)
+	}
+
+	_, err := ParseRootfsMode("bind")
+	require.Error(t, err, "Unknown rootfs mode must be rejected")
+}
+
+func TestRootfsSpecOpts(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+
+	for _, mode := range []RootfsMode{RootfsCopy, RootfsOverlay} {
+		spec, err := oci.GenerateSpec(ctx, nil, &containers.Container{ID: "1"}, rootfsSpecOpts(mode)...)
+		require.NoError(t, err, "Failed to generate spec in %s mode", mode)
+		require.NotNil(t, spec.Root, "Spec has no rootfs in %s mode", mode)
+		require.NotEmpty(t, spec.Root.Path, "Spec has no rootfs path in %s mode", mode)
+		require.NotNil(t, spec.Process, "Spec has no process in %s mode", mode)
+
+		tmpfs := map[string]bool{}
+		for _, m := range spec.Mounts {
+			if m.Type == "tmpfs" {
+				tmpfs[m.Destination] = true
+			}
+		}
+
+		switch mode {
+		case RootfsCopy:
+			require.False(t, spec.Root.Readonly, "Rootfs must be writable in copy mode")
+		case RootfsOverlay:
+			require.True(t, spec.Root.Readonly, "Rootfs must be read-only in overlay mode")
+			for _, path := range overlayWritablePaths {
+				require.True(t, tmpfs[path], "%s must be writable in overlay mode", path)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/containerd/containerd"
+	"github.com/pkg/errors"
+)
+
+// ErrRootfsIntegrity is returned by StartVM when the rootfs of the image of
+// a VM started WithRootfsDigest does not match the expected digest
+var ErrRootfsIntegrity = errors.New("guest rootfs does not match its expected digest")
+
+var rootfsDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// IsRootfsIntegrity returns true if the error is caused by ErrRootfsIntegrity
+func IsRootfsIntegrity(err error) bool {
+	return errors.Is(err, ErrRootfsIntegrity)
+}
+
+// ValidateRootfsDigest checks that the digest is a sha256 digest, as the
+// chain ID of the rootfs of an image (e.g. sha256:<64 hex digits>)
+func ValidateRootfsDigest(digest string) error {
+	if !rootfsDigestRegexp.MatchString(digest) {
+		return errors.Errorf("invalid rootfs digest %q, expected sha256:<64 hex digits>", digest)
+	}
+
+	return nil
+}
+
+// rootfsChainID returns the chain ID of the layers of a rootfs, given by the
+// digests of their uncompressed content from the bottom up, which identifies
+// the snapshot the layers are unpacked into as specified by the OCI image spec
+func rootfsChainID(diffIDs []string) string {
+	if len(diffIDs) == 0 {
+		return ""
+	}
+
+	chainID := diffIDs[0]
+	for _, diffID := range diffIDs[1:] {
+		sum := sha256.Sum256([]byte(chainID + " " + diffID))
+		chainID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return chainID
+}
+
+// checkRootfsDigest returns ErrRootfsIntegrity if the chain ID of the layers
+// of a rootfs is not the expected digest
+func checkRootfsDigest(diffIDs []string, expected string) error {
+	if chainID := rootfsChainID(diffIDs); chainID != expected {
+		return errors.Wrapf(ErrRootfsIntegrity, "chain ID %s, expected %s", chainID, expected)
+	}
+
+	return nil
+}
+
+// verifyRootfs checks the rootfs of the image against the expected digest
+// before it is snapshotted for a VM. containerd checks the uncompressed
+// content of each layer against its digest in the image config when
+// unpacking it, so that the chain ID pins the content of the whole rootfs.
+func verifyRootfs(ctx context.Context, image containerd.Image, expected string) error {
+	diffIDs, err := image.RootFS(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the layers of the image")
+	}
+
+	ids := make([]string, len(diffIDs))
+	for i, id := range diffIDs {
+		ids[i] = id.String()
+	}
+
+	return checkRootfsDigest(ids, expected)
+}
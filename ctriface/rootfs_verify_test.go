@@ -0,0 +1,76 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestValidateRootfsDigest(t *testing.T) {
+	require.NoError(t, ValidateRootfsDigest("sha256:"+sha256Hex("a")))
+
+	for _, digest := range []string{"", "sha256:", "sha512:" + sha256Hex("a"), sha256Hex("a"), "sha256:" + sha256Hex("a")[1:]} {
+		require.Error(t, ValidateRootfsDigest(digest), "digest %q is valid", digest)
+	}
+}
+
+func TestCheckRootfsDigest(t *testing.T) {
+	base := "sha256:" + sha256Hex("base layer")
+	top := "sha256:" + sha256Hex("top layer")
+	// The chain ID of two layers, as computed by the OCI image spec
+	chainID := "sha256:" + sha256Hex(base+" "+top)
+
+	cases := []struct {
+		name     string
+		diffIDs  []string
+		expected string
+		match    bool
+	}{
+		{name: "Single layer", diffIDs: []string{base}, expected: base, match: true},
+		{name: "Layers", diffIDs: []string{base, top}, expected: chainID, match: true},
+		{name: "Tampered layer", diffIDs: []string{base, "sha256:" + sha256Hex("tampered")}, expected: chainID},
+		{name: "Reordered layers", diffIDs: []string{top, base}, expected: chainID},
+		{name: "Missing layer", diffIDs: []string{base}, expected: chainID},
+		{name: "No layers", expected: base},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkRootfsDigest(c.diffIDs, c.expected)
+			if c.match {
+				require.NoError(t, err, "matching rootfs was rejected")
+				return
+			}
+			require.True(t, IsRootfsIntegrity(err), "mismatching rootfs was accepted: %v", err)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// PrepareRestore Readies a VM to load a snapshot taken on another node into.
+// The firecracker-containerd shim only loads snapshots into a VM it runs, so
+// the VM is booted from the image, creating its shim, tap and rootfs, and
+// offloaded right away, as the VMs of the node are before they are restored.
+// The snapshot files are then expected at the paths of GetSnapshotFiles.
+func (o *Orchestrator) PrepareRestore(ctx context.Context, vmID, imageName string, opts ...StartVMOption) (*StartVMResponse, *metrics.Metric, error) {
+	logger := logging.FromContext(ctx, logging.Snapshots).WithFields(log.Fields{"vmID": vmID, "image": imageName})
+	logger.Debug("Orchestrator received PrepareRestore")
+
+	resp, startMetric, err := o.StartVM(ctx, vmID, imageName, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := o.Offload(ctx, vmID); err != nil {
+		logger.WithError(err).Error("failed to offload the VM prepared for a restore")
+		if err := o.StopSingleVM(ctx, vmID); err != nil {
+			logger.WithError(err).Error("failed to stop the VM prepared for a restore")
+		}
+		return nil, nil, err
+	}
+
+	return resp, startMetric, nil
+}
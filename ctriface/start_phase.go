@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"github.com/pkg/errors"
+)
+
+// The phases of StartVM, reported by its errors
+const (
+	// PhaseImage gets or pulls the image of the function
+	PhaseImage = "image"
+	// PhaseNetwork allocates the tap and the IP of the VM
+	PhaseNetwork = "network"
+	// PhaseBoot creates the microVM and starts the function in it
+	PhaseBoot = "boot"
+)
+
+// PhaseError is an error of StartVM in one of its phases
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error, for errors.Cause
+func (e *PhaseError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// GetPhase returns the phase of StartVM that failed with the error,
+// empty if it is unknown
+func GetPhase(err error) string {
+	var pe *PhaseError
+	if errors.As(err, &pe) {
+		return pe.Phase
+	}
+
+	return ""
+}
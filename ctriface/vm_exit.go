@@ -0,0 +1,72 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd"
+)
+
+const (
+	// exitCodeKilled is the exit code of a function killed by SIGKILL,
+	// typically by the OOM killer of its guest
+	exitCodeKilled = 128 + 9
+	// taskExitTimeout bounds the wait for the task of a VM to exit once killed
+	taskExitTimeout = 10 * time.Second
+)
+
+// VMExit describes how the task of a VM exited
+type VMExit struct {
+	// ExitCode is the exit code of the function, containerd.UnknownExitStatus if it is unknown
+	ExitCode uint32
+	// ExitedAt is when the task exited, zero if it is unknown
+	ExitedAt time.Time
+	// Err is why the exit status of the task is unknown, e.g., the VM crashed
+	Err error
+}
+
+// Reason describes why the task of the VM exited
+func (e VMExit) Reason() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("exit status lost: %v", e.Err)
+	case e.ExitCode == exitCodeKilled:
+		return fmt.Sprintf("killed with exit code %d, e.g., out of memory", e.ExitCode)
+	default:
+		return fmt.Sprintf("exited with code %d", e.ExitCode)
+	}
+}
+
+// watchTask sends the exit of the task of a VM on exited once it is received
+// from statusCh, then closes done and cancels the wait for the exit status
+func watchTask(statusCh <-chan containerd.ExitStatus, exited chan<- VMExit, done chan<- struct{}, cancel context.CancelFunc) {
+	defer cancel()
+
+	status := <-statusCh
+	code, exitedAt, err := status.Result()
+	exited <- VMExit{ExitCode: code, ExitedAt: exitedAt, Err: err}
+	close(done)
+}
@@ -0,0 +1,65 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchTask(t *testing.T) {
+	exitedAt := time.Now()
+	statusCh := make(chan containerd.ExitStatus, 1)
+	exited := make(chan VMExit, 1)
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go watchTask(statusCh, exited, done, cancel)
+
+	select {
+	case <-done:
+		t.Fatal("task exited before its exit status was received")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	statusCh <- *containerd.NewExitStatus(exitCodeKilled, exitedAt, nil)
+
+	exit := <-exited
+	require.Equal(t, uint32(exitCodeKilled), exit.ExitCode)
+	require.Equal(t, exitedAt, exit.ExitedAt)
+	require.NoError(t, exit.Err)
+	require.Contains(t, exit.Reason(), "out of memory")
+
+	<-done
+	<-ctx.Done()
+}
+
+func TestVMExitReason(t *testing.T) {
+	require.Equal(t, "exited with code 1", VMExit{ExitCode: 1}.Reason())
+	require.Contains(t, VMExit{ExitCode: containerd.UnknownExitStatus, Err: errors.New("VM crashed")}.Reason(), "VM crashed")
+}
@@ -0,0 +1,368 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"time"
+
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/taps"
+)
+
+const (
+	defaultVcpuCount  = 1
+	defaultMemSizeMib = 256
+)
+
+// StartVMOptions Per-VM options passed to StartVM
+type StartVMOptions struct {
+	// VcpuCount is the number of vCPUs of the VM
+	VcpuCount uint32
+	// MemSizeMib is the guest memory size of the VM
+	MemSizeMib uint32
+	// Prefault populates the guest memory on snapshot restores, see WithPrefault
+	Prefault bool
+	// Hugepages backs the guest memory with hugepages, see WithHugepages
+	Hugepages bool
+	// REAPTrace is the name of the trace of the page accesses shared by the VMs
+	// of the function, REAP is off for the VM if empty, see WithREAP
+	REAPTrace string
+	// CPUBoostFactor multiplies the CPU quota of the VM during its cold start,
+	// no boost if at most 1, see WithCPUBoost
+	CPUBoostFactor float64
+	// CPUBoostWindow is the longest the VM stays boosted
+	CPUBoostWindow time.Duration
+	// KernelImagePath is the guest kernel, the default one of firecracker-containerd if empty
+	KernelImagePath string
+	// ImageCached uses the image already on the node without pulling it, see WithImageCached
+	ImageCached bool
+	// ProjectionImage is the host path of a read-only ext4 image
+	// attached to the VM as a secondary drive, see WithProjection
+	ProjectionImage string
+	// ProjectedMounts are the mounts of the function container
+	// that are served from the projection image
+	ProjectedMounts []ProjectedMount
+	// DriveMounts are the ext4 images attached to the VM as extra drives
+	DriveMounts []DriveMount
+	// VirtiofsMounts are the host directories shared with the VM, see WithVirtiofsMounts
+	VirtiofsMounts []VirtiofsMount
+	// Env is the environment of the function process, in the KEY=VALUE form,
+	// which overrides the environment of the image
+	Env []string
+	// Metadata is the JSON-serializable document served to the guest by MMDS
+	Metadata interface{}
+	// Hostname is the hostname of the guest, the one of the guest image if empty,
+	// see WithHostname
+	Hostname string
+	// InitCmd is the init of the guest and its arguments, the overlay init of
+	// the guest image if empty, see WithInitCmd
+	InitCmd []string
+	// FirecrackerVersion is the name of the firecracker release running
+	// the VM and FirecrackerBinary its binary, the one of the runtime if empty,
+	// see WithFirecracker
+	FirecrackerVersion string
+	FirecrackerBinary  string
+	// RootfsDigest is the expected chain ID of the rootfs of the image, not
+	// verified if empty, see WithRootfsDigest
+	RootfsDigest string
+	// NetRateLimit limits the network traffic of the VM, see WithNetRateLimit
+	NetRateLimit NetRateLimit
+	// IORateLimit limits the I/O of the drives of the VM, see WithIORateLimit
+	IORateLimit IORateLimit
+	// EgressPolicy restricts the destinations the VM can reach, all of them
+	// if nil, see WithEgressPolicy
+	EgressPolicy *taps.EgressPolicy
+	// GuestSwapMib is the size of the swap file of the function, none if 0,
+	// see WithGuestSwap
+	GuestSwapMib uint32
+	// PhaseRecorder records the time spent in each phase of the start,
+	// nothing if nil, see WithPhaseRecorder
+	PhaseRecorder *metrics.PhaseRecorder
+}
+
+// NetRateLimit The limits of the traffic of the network interface of a VM,
+// applied to each direction, no limit if zero
+type NetRateLimit struct {
+	// BandwidthMbps is the bandwidth in megabits per second
+	BandwidthMbps uint64
+	// OpsPerSec is the number of packets per second
+	OpsPerSec uint64
+}
+
+// IORateLimit The limits of the I/O of each drive attached to a VM, no limit if zero
+type IORateLimit struct {
+	// BandwidthMBps is the bandwidth in megabytes per second
+	BandwidthMBps uint64
+	// OpsPerSec is the number of I/O operations per second
+	OpsPerSec uint64
+}
+
+// DriveMount An ext4 image attached to the VM and bind-mounted into the function container
+type DriveMount struct {
+	// HostPath is the path of the image on the host
+	HostPath string
+	// VMPath is the path at which the image is mounted inside the VM
+	VMPath string
+	// ContainerPath is the path at which the image appears in the function container
+	ContainerPath string
+	// ReadOnly mounts the image read-only
+	ReadOnly bool
+}
+
+// VirtiofsMount A host directory shared with the VM over virtio-fs
+type VirtiofsMount struct {
+	// HostPath is the directory on the host
+	HostPath string
+	// GuestPath is the path at which the directory is mounted inside the VM
+	GuestPath string
+	// ReadOnly mounts the directory read-only
+	ReadOnly bool
+}
+
+// ProjectedMount A container mount served from the projection image
+type ProjectedMount struct {
+	// Source is the path inside the projection image
+	Source string
+	// ContainerPath is the path at which the mount appears in the function container
+	ContainerPath string
+}
+
+// StartVMOption Options to pass to StartVM
+type StartVMOption func(*StartVMOptions)
+
+// NewStartVMOptions Returns the options with all opts applied
+func NewStartVMOptions(opts ...StartVMOption) *StartVMOptions {
+	o := &StartVMOptions{
+		VcpuCount:  defaultVcpuCount,
+		MemSizeMib: defaultMemSizeMib,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithMachineConfig Sets the number of vCPUs and the guest memory size of the VM
+func WithMachineConfig(vcpuCount, memSizeMib uint32) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.VcpuCount = vcpuCount
+		o.MemSizeMib = memSizeMib
+	}
+}
+
+// WithPrefault Sets the guest memory pre-faulting on or off.
+// When on, the guest memory backing file is brought into the page cache,
+// with transparent huge pages advised, before the VM is restored
+// from a snapshot, so that the first request does not pay the page-fault cost.
+// This costs host RAM equal to the guest memory size for as long as the pages
+// stay in the page cache. It only applies to snapshot restores: StartVM boots
+// the VM with anonymous guest memory, which has no backing file to pre-fault.
+// It is also a no-op when the memory file is missing or is managed by user-level page faults.
+func WithPrefault(prefault bool) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.Prefault = prefault
+	}
+}
+
+// WithHugepages Backs the guest memory of the VM with 2 MiB hugepages once it is
+// restored from a snapshot, which requires snapshots without user-level page faults.
+// StartVM fails with ResourceExhausted if the host does not have enough free hugepages.
+func WithHugepages(hugepages bool) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.Hugepages = hugepages
+	}
+}
+
+// WithREAP Restores the VM with user-level page faults (REAP), whatever the UPF
+// mode of the orchestrator. The first load of a VM of the function records its
+// page accesses in the trace of the given name, e.g., its revision, and the next
+// loads of its VMs prefetch the pages of that trace from their guest memory.
+// StartVM fails with FailedPrecondition if snapshots are disabled.
+func WithREAP(trace string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.REAPTrace = trace
+	}
+}
+
+// WithCPUBoost Boosts the CPU quota of the VM by the given factor during its
+// cold start, until it serves its first response or the window elapses
+func WithCPUBoost(factor float64, window time.Duration) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.CPUBoostFactor = factor
+		o.CPUBoostWindow = window
+	}
+}
+
+// WithKernelImage Boots the VM with the guest kernel at the given host path
+// instead of the default kernel configured in firecracker-containerd
+func WithKernelImage(path string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.KernelImagePath = path
+	}
+}
+
+// WithImageCached Uses the function image already pulled on the node, e.g. by
+// a node agent, instead of pulling it. StartVM fails with ErrImageNotCached
+// if the image is not on the node.
+func WithImageCached(cached bool) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.ImageCached = cached
+	}
+}
+
+// WithProjection Attaches the ext4 image at imagePath to the VM,
+// bind-mounting its contents read-only into the function container
+// at the given container paths
+func WithProjection(imagePath string, mounts []ProjectedMount) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.ProjectionImage = imagePath
+		o.ProjectedMounts = mounts
+	}
+}
+
+// WithDriveMount Attaches an ext4 image to the VM, mounting it in the function container
+func WithDriveMount(m DriveMount) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.DriveMounts = append(o.DriveMounts, m)
+	}
+}
+
+// WithVirtiofsMounts Shares host directories with the VM over virtio-fs.
+// StartVM fails with Unimplemented as long as Firecracker has no virtio-fs device.
+func WithVirtiofsMounts(mounts []VirtiofsMount) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.VirtiofsMounts = mounts
+	}
+}
+
+// WithEnv Sets the environment variables of the function process in the VM
+func WithEnv(env []string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.Env = env
+	}
+}
+
+// WithMetadata Sets the document that the guest can read from
+// the Firecracker microVM metadata service (MMDS)
+func WithMetadata(metadata interface{}) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.Metadata = metadata
+	}
+}
+
+// WithHostname Sets the hostname the guest boots with, which the function
+// container shares. The hostname must be valid, e.g., a DNS label, as it is
+// passed on the kernel command line. A VM restored from a snapshot keeps
+// the hostname it was booted with.
+func WithHostname(hostname string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.Hostname = hostname
+	}
+}
+
+// WithInitCmd Boots the guest into the given command and arguments instead of
+// its overlay init, e.g., a shell for debugging. The command must be an absolute
+// path in the guest image and the arguments must not contain spaces or quotes,
+// as they are passed on the kernel command line.
+func WithInitCmd(cmd []string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.InitCmd = cmd
+	}
+}
+
+// WithRootfsDigest Aborts the start of the VM with ErrRootfsIntegrity unless
+// the rootfs of its image has the given chain ID, e.g., for the workloads that
+// must prove that their guest was not tampered with
+func WithRootfsDigest(digest string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.RootfsDigest = digest
+	}
+}
+
+// WithFirecracker Runs the VM with the given firecracker release and binary.
+// Only the binary of the firecracker-containerd runtime can run VMs, the
+// others fail to start with Unimplemented.
+func WithFirecracker(version, binary string) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.FirecrackerVersion = version
+		o.FirecrackerBinary = binary
+	}
+}
+
+// WithNetRateLimit Limits the egress and the ingress of the network interface
+// of the VM with the rate limiter of Firecracker, e.g., so that a function does
+// not saturate the NIC of the node. A zero limit does not limit the traffic.
+// A VM restored from a snapshot keeps the limits it was booted with.
+func WithNetRateLimit(limit NetRateLimit) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.NetRateLimit = limit
+	}
+}
+
+// WithIORateLimit Limits the I/O of each drive attached to the VM, i.e., its
+// extra drives and projection image, with the rate limiter of Firecracker.
+// The rootfs of the function container is not limited, firecracker-containerd
+// attaching it without a rate limiter. A zero limit does not limit the I/O.
+func WithIORateLimit(limit IORateLimit) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.IORateLimit = limit
+	}
+}
+
+// WithEgressPolicy Restricts the egress traffic of the VM to the destinations
+// allowed by the policy, enforced by iptables on its tap. The replies to
+// the connections opened from outside the VM are always allowed.
+func WithEgressPolicy(policy *taps.EgressPolicy) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.EgressPolicy = policy
+	}
+}
+
+// WithGuestSwap Provisions a swap file of the given size in the rootfs of the
+// function before it starts, whose path is passed to the function in the
+// VHIVE_SWAP_FILE environment variable. The start fails with ErrGuestSwapTooLarge
+// if the swap file does not fit in the rootfs. A size of 0 provisions no swap.
+func WithGuestSwap(mib uint32) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.GuestSwapMib = mib
+	}
+}
+
+// WithPhaseRecorder Records the time spent in each phase of the start of the
+// VM, e.g., resolving its image or calling firecracker-containerd, into the
+// recorder, which the caller keeps marking for the phases after StartVM
+func WithPhaseRecorder(r *metrics.PhaseRecorder) StartVMOption {
+	return func(o *StartVMOptions) {
+		o.PhaseRecorder = r
+	}
+}
+
+// WithStartVMOptions Sets all the options to the given ones, e.g., to restart
+// a VM with the options it was started with. The options after it override them.
+func WithStartVMOptions(opts StartVMOptions) StartVMOption {
+	return func(o *StartVMOptions) {
+		*o = opts
+	}
+}
@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/firecracker-microvm/firecracker-containerd/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKernelArgsHostname(t *testing.T) {
+	kernelArgs := getKernelArgs(NewStartVMOptions())
+	require.NotContains(t, kernelArgs, "systemd.hostname", "hostname of the guest image was overridden")
+
+	kernelArgs = getKernelArgs(NewStartVMOptions(WithHostname("helloworld-00001.default")))
+	require.True(t, strings.HasSuffix(kernelArgs, " systemd.hostname=helloworld-00001.default"), "hostname was not passed to the guest")
+}
+
+func TestKernelArgsInitCmd(t *testing.T) {
+	kernelArgs := getKernelArgs(NewStartVMOptions())
+	require.Contains(t, kernelArgs, " init="+defaultGuestInit+" ", "default init was not used")
+
+	kernelArgs = getKernelArgs(NewStartVMOptions(WithInitCmd([]string{"/bin/sh"})))
+	require.Contains(t, kernelArgs, " init=/bin/sh ", "init was not overridden")
+	require.NotContains(t, kernelArgs, defaultGuestInit)
+	require.NotContains(t, kernelArgs, " -- ", "init without arguments got arguments")
+
+	kernelArgs = getKernelArgs(NewStartVMOptions(WithHostname("fn"), WithInitCmd([]string{"/bin/busybox", "sh", "-i"})))
+	require.True(t, strings.HasSuffix(kernelArgs, " systemd.hostname=fn -- sh -i"), "init arguments were not passed last: %s", kernelArgs)
+}
+
+func TestCheckFirecrackerBinary(t *testing.T) {
+	require.NoError(t, checkFirecrackerBinary(NewStartVMOptions()))
+	require.NoError(t, checkFirecrackerBinary(NewStartVMOptions(WithFirecracker("v0.24.0", runtimeFirecrackerBinary))))
+
+	err := checkFirecrackerBinary(NewStartVMOptions(WithFirecracker("v0.25.0", "/opt/firecracker/v0.25.0/firecracker")))
+	require.Equal(t, codes.Unimplemented, status.Code(err), "unexpected error: %v", err)
+}
+
+func TestNetRateLimiter(t *testing.T) {
+	require.Nil(t, getNetRateLimiter(NetRateLimit{}), "traffic was limited without limits")
+
+	limiter := getNetRateLimiter(NetRateLimit{BandwidthMbps: 100})
+	require.Equal(t, &proto.FirecrackerTokenBucket{Capacity: 12500000, RefillTime: 1000}, limiter.Bandwidth)
+	require.Nil(t, limiter.Ops, "packets were limited without a limit")
+
+	limiter = getNetRateLimiter(NetRateLimit{BandwidthMbps: 8, OpsPerSec: 1000})
+	require.Equal(t, &proto.FirecrackerTokenBucket{Capacity: 1000000, RefillTime: 1000}, limiter.Bandwidth)
+	require.Equal(t, &proto.FirecrackerTokenBucket{Capacity: 1000, RefillTime: 1000}, limiter.Ops)
+}
+
+func TestDriveMountsIORateLimit(t *testing.T) {
+	opts := NewStartVMOptions(
+		WithProjection("/var/lib/vhive/projection.img", nil),
+		WithDriveMount(DriveMount{HostPath: "/var/lib/vhive/disks/fn.img", VMPath: "/mnt/disk"}),
+	)
+	drives := getDriveMounts(opts)
+	require.Len(t, drives, 2)
+	for _, d := range drives {
+		require.Nil(t, d.RateLimiter, "I/O was limited without limits")
+	}
+
+	WithIORateLimit(IORateLimit{BandwidthMBps: 50, OpsPerSec: 2000})(opts)
+	drives = getDriveMounts(opts)
+	require.Equal(t, "/var/lib/vhive/projection.img", drives[0].HostPath, "projection image is not the first drive")
+	for _, d := range drives {
+		require.Equal(t, &proto.FirecrackerRateLimiter{
+			Bandwidth: &proto.FirecrackerTokenBucket{Capacity: 50000000, RefillTime: 1000},
+			Ops:       &proto.FirecrackerTokenBucket{Capacity: 2000, RefillTime: 1000},
+		}, d.RateLimiter, "I/O limit was not applied to drive %s", d.HostPath)
+	}
+}
+
+func TestWithStartVMOptions(t *testing.T) {
+	started := NewStartVMOptions(WithMachineConfig(2, 512), WithHostname("fn"), WithGuestSwap(64))
+
+	restarted := NewStartVMOptions(WithStartVMOptions(*started), WithImageCached(true))
+	require.Equal(t, uint32(2), restarted.VcpuCount)
+	require.Equal(t, uint32(512), restarted.MemSizeMib)
+	require.Equal(t, "fn", restarted.Hostname)
+	require.Equal(t, uint32(64), restarted.GuestSwapMib)
+	require.True(t, restarted.ImageCached, "later option was not applied")
+	require.False(t, started.ImageCached, "options of the previous start were modified")
+}
@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/ease-lab/vhive/logging"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VMResources are the resources of a running VM that can be changed without restarting it
+type VMResources struct {
+	// MemSizeMib is the guest memory left to the VM by its balloon,
+	// at most its boot memory, 0 leaves the memory unchanged
+	MemSizeMib uint32
+	// CPUQuota is the CPU time of the VM in CPUs, 0 leaves the quota unchanged
+	CPUQuota float64
+}
+
+// UpdateVMResources Changes the resources of a running VM. The CPU quota is
+// the CFS quota of the cgroup of the jailed VM. The guest memory is reclaimed
+// with a balloon device, which the firecracker-containerd release of vHive
+// does not have, so memory changes are rejected with Unimplemented.
+func (o *Orchestrator) UpdateVMResources(ctx context.Context, vmID string, res VMResources) error {
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID})
+
+	if _, err := o.vmPool.GetVM(vmID); err != nil {
+		return status.Errorf(codes.NotFound, "VM %s does not exist", vmID)
+	}
+
+	if res.MemSizeMib != 0 {
+		return status.Errorf(codes.Unimplemented,
+			"the guest memory of VM %s cannot be resized to %d MiB, Firecracker VMs have no balloon device", vmID, res.MemSizeMib)
+	}
+
+	if res.CPUQuota != 0 {
+		if o.jailer == nil {
+			return status.Errorf(codes.FailedPrecondition,
+				"the CPU quota of VM %s cannot be set, it requires the jailer", vmID)
+		}
+
+		var err error
+		if o.cpuBoost != nil {
+			err = o.cpuBoost.setSteady(vmID, o.vmCgroup(vmID), res.CPUQuota)
+		} else {
+			err = setCPUQuota(filepath.Join(cpuCgroupRoot, o.vmCgroup(vmID)), res.CPUQuota)
+		}
+		if err != nil {
+			return err
+		}
+
+		logger.WithField("cpuQuota", res.CPUQuota).Debug("set the CPU quota of the VM")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/ease-lab/vhive/logging"
+	"github.com/ease-lab/vhive/metrics"
+	"github.com/ease-lab/vhive/misc"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrImageGone is returned by RestartVM when the image of the VM was removed
+// from the node and cannot be pulled again, the VM being left as it was
+var ErrImageGone = errors.New("image is gone from the node and cannot be pulled")
+
+// RestartVM Stops the Firecracker process of a VM and boots a fresh one from
+// the image, keeping the tap and thus the IP of the VM. The image is resolved
+// before the VM is stopped, so that the VM is left running if the image is
+// gone. A VM that fails to stop or to boot again is released from the pool.
+func (o *Orchestrator) RestartVM(ctx context.Context, vmID, imageName string, opts ...StartVMOption) (*StartVMResponse, *metrics.Metric, error) {
+	logger := logging.FromContext(ctx, logging.Coordinator).WithFields(log.Fields{"vmID": vmID, "image": imageName})
+	logger.Debug("Orchestrator received RestartVM")
+
+	if !o.vmPool.HasVM(vmID) {
+		return nil, nil, misc.NonExistErr("RestartVM: VM " + vmID)
+	}
+
+	// The image may have been removed since it was resolved for the VM
+	o.images.flush(imageName)
+	imgCtx := namespaces.WithNamespace(ctx, namespaceName)
+	if _, err := o.getCachedImage(imgCtx, imageName); err != nil {
+		if !IsImageNotCached(err) {
+			return nil, nil, &PhaseError{Phase: PhaseImage, Err: err}
+		}
+		if _, err := o.getImage(imgCtx, imageName); err != nil {
+			logger.WithError(err).Error("image of the VM is gone, leaving the VM running")
+			return nil, nil, &PhaseError{Phase: PhaseImage, Err: errors.Wrapf(ErrImageGone, "%s: %v", imageName, err)}
+		}
+	}
+
+	tStart := time.Now()
+	if err := o.stopVM(ctx, vmID, true); err != nil {
+		if err := o.vmPool.Free(vmID); err != nil {
+			logger.WithError(err).Error("failed to free VM from pool after failure")
+		}
+		return nil, nil, errors.Wrap(err, "failed to stop VM for restart")
+	}
+	stopDuration := time.Since(tStart)
+
+	// The image was resolved above, the VM does not pull it again
+	opts = append(opts[:len(opts):len(opts)], WithImageCached(true))
+	resp, startVMMetric, err := o.startVM(ctx, vmID, imageName, true, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	startVMMetric.MetricMap[metrics.StopVM] = metrics.ToUS(stopDuration)
+
+	logger.Debug("Restarted VM successfully")
+
+	return resp, startVMMetric, nil
+}
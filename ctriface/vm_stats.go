@@ -0,0 +1,178 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/firecracker-microvm/firecracker-containerd/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// procRoot is where procfs is mounted on the host
+	procRoot = "/proc"
+	// clockTicks is USER_HZ, the unit of the CPU times in procfs
+	clockTicks = 100
+)
+
+// VMStats is the resource usage of the firecracker process of a VM,
+// which covers the guest and the VMM
+type VMStats struct {
+	// CPUUsageNanos is the CPU time used by the VM since it started
+	CPUUsageNanos uint64
+	// MemoryRSSBytes is the memory of the VM resident on the host,
+	// i.e., the part of the guest memory the guest touched
+	MemoryRSSBytes uint64
+	Timestamp      time.Time
+}
+
+// GetVMStats Returns the CPU and the memory usage of the firecracker process of a VM
+func (o *Orchestrator) GetVMStats(ctx context.Context, vmID string) (*VMStats, error) {
+	if _, err := o.vmPool.GetVM(vmID); err != nil {
+		return nil, status.Errorf(codes.NotFound, "VM %s does not exist", vmID)
+	}
+
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+	info, err := o.fcClient.GetVMInfo(ctx, &proto.GetVMInfoRequest{VMID: vmID})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the info of VM %s", vmID)
+	}
+
+	pid, err := findFirecrackerProcess(procRoot, vmID, info.GetSocketPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return readProcessStats(procRoot, pid, time.Now())
+}
+
+// findFirecrackerProcess returns the PID of the firecracker process of a VM,
+// which is passed the API socket of the VM, or its ID if jailed
+func findFirecrackerProcess(proc, vmID, socketPath string) (int, error) {
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// The processes may exit while they are listed
+		cmdline, err := ioutil.ReadFile(filepath.Join(proc, entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+
+		args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		if filepath.Base(args[0]) != "firecracker" {
+			continue
+		}
+
+		for i, arg := range args {
+			if (socketPath != "" && arg == socketPath) || (arg == "--id" && i+1 < len(args) && args[i+1] == vmID) {
+				return pid, nil
+			}
+		}
+	}
+
+	return 0, errors.Errorf("firecracker process of VM %s not found", vmID)
+}
+
+// readProcessStats reads the CPU time and the resident memory of a process
+func readProcessStats(proc string, pid int, now time.Time) (*VMStats, error) {
+	dir := filepath.Join(proc, strconv.Itoa(pid))
+
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command in parentheses may contain spaces, the fields after it
+	// start with the state, the third field of the line
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, errors.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 13 {
+		return nil, errors.Errorf("invalid stat of process %d", pid)
+	}
+
+	// utime and stime are the 14th and the 15th fields
+	var ticks uint64
+	for _, field := range fields[11:13] {
+		t, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid stat of process %d", pid)
+		}
+		ticks += t
+	}
+
+	procStatus, err := ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	rss, err := parseStatusKB(string(procStatus), "VmRSS")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid status of process %d", pid)
+	}
+
+	return &VMStats{
+		CPUUsageNanos:  ticks * uint64(time.Second/clockTicks),
+		MemoryRSSBytes: rss * 1024,
+		Timestamp:      now,
+	}, nil
+}
+
+// parseStatusKB returns the value of a field in kB of /proc/<pid>/status,
+// e.g., "VmRSS:	  123456 kB"
+func parseStatusKB(status, field string) (uint64, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, field+":") {
+			continue
+		}
+
+		value := strings.Fields(strings.TrimPrefix(line, field+":"))
+		if len(value) != 2 || value[1] != "kB" {
+			return 0, errors.Errorf("invalid %s %q", field, line)
+		}
+
+		return strconv.ParseUint(value[0], 10, 64)
+	}
+
+	return 0, errors.Errorf("%s not found", field)
+}
@@ -0,0 +1,103 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeProc writes the files of a process in a fake procfs
+func writeProc(t *testing.T, proc, pid string, files map[string]string) {
+	dir := filepath.Join(proc, pid)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestFindFirecrackerProcess(t *testing.T) {
+	proc := t.TempDir()
+
+	writeProc(t, proc, "1", map[string]string{"cmdline": "/sbin/init\x00"})
+	writeProc(t, proc, "20", map[string]string{"cmdline": "/usr/local/bin/firecracker\x00--api-sock\x00/srv/1/fc.sock\x00"})
+	writeProc(t, proc, "30", map[string]string{"cmdline": "/usr/local/bin/firecracker\x00--id\x002\x00--api-sock\x00api.socket\x00"})
+	// A process that is not firecracker but is passed the socket of VM 3
+	writeProc(t, proc, "40", map[string]string{"cmdline": "socat\x00/srv/3/fc.sock\x00"})
+	writeProc(t, proc, "self", map[string]string{"cmdline": "go\x00"})
+
+	pid, err := findFirecrackerProcess(proc, "1", "/srv/1/fc.sock")
+	require.NoError(t, err)
+	require.Equal(t, 20, pid)
+
+	// A jailed VM is found by its ID
+	pid, err = findFirecrackerProcess(proc, "2", "/var/lib/jailer/2/root/api.socket")
+	require.NoError(t, err)
+	require.Equal(t, 30, pid)
+
+	_, err = findFirecrackerProcess(proc, "3", "/srv/3/fc.sock")
+	require.Error(t, err, "process that is not firecracker was found")
+}
+
+func TestReadProcessStats(t *testing.T) {
+	proc := t.TempDir()
+	now := time.Unix(1000, 0)
+
+	writeProc(t, proc, "20", map[string]string{
+		"stat":   "20 (fc_vcpu 0) S 1 20 20 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 3 0 100 1000000 300\n",
+		"status": "Name:\tfirecracker\nVmPeak:\t  200000 kB\nVmRSS:\t  131072 kB\nThreads:\t3\n",
+	})
+
+	stats, err := readProcessStats(proc, 20, now)
+	require.NoError(t, err)
+	require.Equal(t, &VMStats{
+		CPUUsageNanos:  3 * uint64(time.Second),
+		MemoryRSSBytes: 128 << 20,
+		Timestamp:      now,
+	}, stats)
+
+	writeProc(t, proc, "21", map[string]string{"stat": "21 (firecracker) S 1\n", "status": "VmRSS:\t1 kB\n"})
+	_, err = readProcessStats(proc, 21, now)
+	require.Error(t, err, "truncated stat was parsed")
+
+	_, err = readProcessStats(proc, 22, now)
+	require.Error(t, err, "stats of a missing process were read")
+}
+
+func TestParseStatusKB(t *testing.T) {
+	kb, err := parseStatusKB("VmHWM:\t  10 kB\nVmRSS:\t  42 kB\n", "VmRSS")
+	require.NoError(t, err)
+	require.EqualValues(t, 42, kb)
+
+	_, err = parseStatusKB("VmHWM:\t  10 kB\n", "VmRSS")
+	require.Error(t, err)
+
+	_, err = parseStatusKB("VmRSS:\t  42\n", "VmRSS")
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package deviceplugin advertises the microVM capacity of the node to
+// kubelet as an extended resource, with the device plugin API
+package deviceplugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/ease-lab/vhive/deviceplugin/proto"
+)
+
+const (
+	// healthy slots are free and counted as allocatable by kubelet
+	healthy   = "Healthy"
+	unhealthy = "Unhealthy"
+)
+
+// Allocator binds the microVM slots of the node to the containers of the VMs
+// occupying them. Occupied slots are reported unhealthy, so that kubelet
+// advertises only the free ones.
+type Allocator struct {
+	sync.Mutex
+
+	slots []string
+	// owners maps the occupied slots to the container IDs
+	owners map[string]string
+	// watchers are notified when a slot is occupied or freed
+	watchers map[chan struct{}]struct{}
+}
+
+// NewAllocator Creates an allocator of n microVM slots
+func NewAllocator(n int) *Allocator {
+	a := &Allocator{
+		owners:   make(map[string]string),
+		watchers: make(map[chan struct{}]struct{}),
+	}
+
+	for i := 0; i < n; i++ {
+		a.slots = append(a.slots, fmt.Sprintf("microvm-%d", i))
+	}
+
+	return a
+}
+
+// Acquire Occupies a free slot with the VM of the container, returning false
+// if all slots are occupied
+func (a *Allocator) Acquire(containerID string) bool {
+	a.Lock()
+	defer a.Unlock()
+
+	free := ""
+	for _, slot := range a.slots {
+		owner, ok := a.owners[slot]
+		if ok && owner == containerID {
+			return true
+		}
+		if !ok && free == "" {
+			free = slot
+		}
+	}
+
+	if free == "" {
+		return false
+	}
+
+	a.owners[free] = containerID
+	a.notify()
+
+	return true
+}
+
+// Release Frees the slot of the container, if any
+func (a *Allocator) Release(containerID string) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.release(func(owner string) bool { return owner == containerID }) {
+		a.notify()
+	}
+}
+
+// Reconcile Frees the slots of the containers that are not active,
+// which were leaked by a missed release
+func (a *Allocator) Reconcile(active map[string]bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.release(func(owner string) bool { return !active[owner] }) {
+		a.notify()
+	}
+}
+
+// Devices Returns the slots as devices, free ones being healthy
+func (a *Allocator) Devices() []*pb.Device {
+	a.Lock()
+	defer a.Unlock()
+
+	devices := make([]*pb.Device, 0, len(a.slots))
+	for _, slot := range a.slots {
+		health := healthy
+		if _, ok := a.owners[slot]; ok {
+			health = unhealthy
+		}
+
+		devices = append(devices, &pb.Device{ID: slot, Health: health})
+	}
+
+	return devices
+}
+
+// watch returns a channel signalled when the slots change and the function
+// that stops watching
+func (a *Allocator) watch() (<-chan struct{}, func()) {
+	a.Lock()
+	defer a.Unlock()
+
+	ch := make(chan struct{}, 1)
+	a.watchers[ch] = struct{}{}
+
+	return ch, func() {
+		a.Lock()
+		defer a.Unlock()
+
+		delete(a.watchers, ch)
+	}
+}
+
+// release frees the slots whose owner matches, with the lock held
+func (a *Allocator) release(match func(owner string) bool) bool {
+	var released []string
+	for slot, owner := range a.owners {
+		if match(owner) {
+			released = append(released, slot)
+		}
+	}
+
+	sort.Strings(released)
+	for _, slot := range released {
+		log.WithFields(log.Fields{"slot": slot, "containerID": a.owners[slot]}).Debug("freeing microVM slot")
+		delete(a.owners, slot)
+	}
+
+	return len(released) != 0
+}
+
+// notify signals the watchers without blocking, with the lock held
+func (a *Allocator) notify() {
+	for ch := range a.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package deviceplugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/ease-lab/vhive/deviceplugin/proto"
+)
+
+func countHealthy(devices []*pb.Device) int {
+	n := 0
+	for _, d := range devices {
+		if d.GetHealth() == healthy {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestAllocator(t *testing.T) {
+	a := NewAllocator(2)
+	require.Equal(t, 2, countHealthy(a.Devices()))
+
+	require.True(t, a.Acquire("ctr1"))
+	require.True(t, a.Acquire("ctr1"), "slot was not reused for the same container")
+	require.True(t, a.Acquire("ctr2"))
+	require.False(t, a.Acquire("ctr3"), "slot was acquired beyond the capacity")
+	require.Equal(t, 0, countHealthy(a.Devices()))
+
+	a.Release("ctr1")
+	require.Equal(t, 1, countHealthy(a.Devices()), "slot was not released")
+
+	a.Release("ctr1")
+	require.Equal(t, 1, countHealthy(a.Devices()), "slot was released twice")
+
+	require.True(t, a.Acquire("ctr3"))
+	a.Reconcile(map[string]bool{"ctr3": true})
+	require.Equal(t, 1, countHealthy(a.Devices()), "leaked slot was not reconciled")
+	require.False(t, a.Acquire("ctr4") && a.Acquire("ctr5"), "active slot was reconciled")
+}
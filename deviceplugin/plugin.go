@@ -0,0 +1,185 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package deviceplugin
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	pb "github.com/ease-lab/vhive/deviceplugin/proto"
+)
+
+const (
+	// ResourceName is the extended resource of the microVM slots
+	ResourceName = "vhive.io/microvms"
+	// DefaultDir is where kubelet and the device plugins put their sockets
+	DefaultDir = "/var/lib/kubelet/device-plugins"
+
+	apiVersion     = "v1beta1"
+	kubeletSocket  = "kubelet.sock"
+	endpointSocket = "vhive.sock"
+	defaultTimeout = 5 * time.Second
+)
+
+// Plugin serves the device plugin API of the microVM slots to kubelet
+type Plugin struct {
+	pb.UnimplementedDevicePluginServer
+
+	alloc  *Allocator
+	dir    string
+	server *grpc.Server
+	stop   chan struct{}
+	// registerTimeout bounds the registration with kubelet
+	registerTimeout time.Duration
+}
+
+// NewPlugin Creates the device plugin of the slots of the allocator,
+// with its socket and the one of kubelet in dir
+func NewPlugin(alloc *Allocator, dir string) *Plugin {
+	return &Plugin{
+		alloc:           alloc,
+		dir:             dir,
+		stop:            make(chan struct{}),
+		registerTimeout: defaultTimeout,
+	}
+}
+
+// Start Serves the device plugin API and registers the plugin with kubelet.
+// Kubelet forgets the plugins when it restarts, after which vHive has to be restarted too.
+func (p *Plugin) Start() error {
+	endpoint := filepath.Join(p.dir, endpointSocket)
+	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove stale device plugin socket")
+	}
+
+	lis, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen on device plugin socket")
+	}
+
+	p.server = grpc.NewServer()
+	pb.RegisterDevicePluginServer(p.server, p)
+
+	go func() {
+		if err := p.server.Serve(lis); err != nil {
+			log.WithError(err).Error("device plugin server failed")
+		}
+	}()
+
+	if err := p.register(); err != nil {
+		p.Stop()
+		return err
+	}
+
+	log.WithFields(log.Fields{"resource": ResourceName, "slots": len(p.alloc.Devices())}).Info("registered device plugin with kubelet")
+
+	return nil
+}
+
+// Stop Stops serving the device plugin API
+func (p *Plugin) Stop() {
+	select {
+	case <-p.stop:
+		return
+	default:
+		close(p.stop)
+	}
+
+	if p.server != nil {
+		p.server.Stop()
+	}
+}
+
+func (p *Plugin) register() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.registerTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, filepath.Join(p.dir, kubeletSocket),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to dial kubelet")
+	}
+	defer conn.Close()
+
+	_, err = pb.NewRegistrationClient(conn).Register(ctx, &pb.RegisterRequest{
+		Version:      apiVersion,
+		Endpoint:     endpointSocket,
+		ResourceName: ResourceName,
+		Options:      &pb.DevicePluginOptions{},
+	})
+
+	return errors.Wrap(err, "failed to register with kubelet")
+}
+
+// GetDevicePluginOptions Returns the options of the plugin
+func (p *Plugin) GetDevicePluginOptions(ctx context.Context, req *pb.Empty) (*pb.DevicePluginOptions, error) {
+	return &pb.DevicePluginOptions{}, nil
+}
+
+// ListAndWatch Streams the slots to kubelet whenever they change
+func (p *Plugin) ListAndWatch(req *pb.Empty, stream pb.DevicePlugin_ListAndWatchServer) error {
+	changed, unwatch := p.alloc.watch()
+	defer unwatch()
+
+	for {
+		if err := stream.Send(&pb.ListAndWatchResponse{Devices: p.alloc.Devices()}); err != nil {
+			return err
+		}
+
+		select {
+		case <-changed:
+		case <-p.stop:
+			return nil
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Allocate Admits the pods requesting slots. The slots are only a scheduling
+// hint, they are occupied by the VMs when the user containers are created.
+func (p *Plugin) Allocate(ctx context.Context, req *pb.AllocateRequest) (*pb.AllocateResponse, error) {
+	resp := &pb.AllocateResponse{}
+	for range req.GetContainerRequests() {
+		resp.ContainerResponses = append(resp.ContainerResponses, &pb.ContainerAllocateResponse{})
+	}
+
+	return resp, nil
+}
+
+// PreStartContainer Is not required by the plugin
+func (p *Plugin) PreStartContainer(ctx context.Context, req *pb.PreStartContainerRequest) (*pb.PreStartContainerResponse, error) {
+	return &pb.PreStartContainerResponse{}, nil
+}
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package deviceplugin
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	pb "github.com/ease-lab/vhive/deviceplugin/proto"
+)
+
+// fakeKubelet is the plugin registry of kubelet
+type fakeKubelet struct {
+	registered chan *pb.RegisterRequest
+}
+
+func (k *fakeKubelet) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Empty, error) {
+	k.registered <- req
+	return &pb.Empty{}, nil
+}
+
+func startFakeKubelet(t *testing.T, dir string) *fakeKubelet {
+	lis, err := net.Listen("unix", filepath.Join(dir, kubeletSocket))
+	require.NoError(t, err, "failed to listen on kubelet socket")
+
+	k := &fakeKubelet{registered: make(chan *pb.RegisterRequest, 1)}
+
+	server := grpc.NewServer()
+	pb.RegisterRegistrationServer(server, k)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	return k
+}
+
+func dialPlugin(t *testing.T, dir string) pb.DevicePluginClient {
+	conn, err := grpc.Dial(filepath.Join(dir, endpointSocket),
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	require.NoError(t, err, "failed to dial the plugin")
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewDevicePluginClient(conn)
+}
+
+func TestPluginRegistersAndWatches(t *testing.T) {
+	dir := t.TempDir()
+	kubelet := startFakeKubelet(t, dir)
+
+	alloc := NewAllocator(3)
+	p := NewPlugin(alloc, dir)
+	require.NoError(t, p.Start(), "failed to start the plugin")
+	defer p.Stop()
+
+	select {
+	case req := <-kubelet.registered:
+		require.Equal(t, apiVersion, req.GetVersion())
+		require.Equal(t, endpointSocket, req.GetEndpoint())
+		require.Equal(t, ResourceName, req.GetResourceName())
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not register with kubelet")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := dialPlugin(t, dir).ListAndWatch(ctx, &pb.Empty{})
+	require.NoError(t, err, "failed to watch the devices")
+
+	next := func() int {
+		resp, err := stream.Recv()
+		require.NoError(t, err, "failed to receive the devices")
+		require.Len(t, resp.GetDevices(), 3)
+		return countHealthy(resp.GetDevices())
+	}
+
+	require.Equal(t, 3, next(), "free slots were not advertised")
+
+	require.True(t, alloc.Acquire("ctr1"))
+	require.Equal(t, 2, next(), "occupied slot was advertised")
+
+	alloc.Release("ctr1")
+	require.Equal(t, 3, next(), "released slot was not advertised")
+}
+
+func TestPluginAllocate(t *testing.T) {
+	dir := t.TempDir()
+	startFakeKubelet(t, dir)
+
+	p := NewPlugin(NewAllocator(2), dir)
+	require.NoError(t, p.Start(), "failed to start the plugin")
+	defer p.Stop()
+
+	resp, err := dialPlugin(t, dir).Allocate(context.Background(), &pb.AllocateRequest{
+		ContainerRequests: []*pb.ContainerAllocateRequest{{DevicesIDs: []string{"microvm-0"}}},
+	})
+	require.NoError(t, err, "allocation failed")
+	require.Len(t, resp.GetContainerResponses(), 1)
+}
+
+func TestPluginWithoutKubelet(t *testing.T) {
+	p := NewPlugin(NewAllocator(1), t.TempDir())
+	p.registerTimeout = 100 * time.Millisecond
+	require.Error(t, p.Start(), "plugin registered without kubelet")
+	p.Stop()
+}
@@ -0,0 +1,826 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: api.proto
+
+package proto
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type DevicePluginOptions struct {
+	PreStartRequired     bool     `protobuf:"varint,1,opt,name=pre_start_required,json=preStartRequired,proto3" json:"pre_start_required,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DevicePluginOptions) Reset()         { *m = DevicePluginOptions{} }
+func (m *DevicePluginOptions) String() string { return proto.CompactTextString(m) }
+func (*DevicePluginOptions) ProtoMessage()    {}
+func (*DevicePluginOptions) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{0}
+}
+
+func (m *DevicePluginOptions) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DevicePluginOptions.Unmarshal(m, b)
+}
+func (m *DevicePluginOptions) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DevicePluginOptions.Marshal(b, m, deterministic)
+}
+func (m *DevicePluginOptions) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DevicePluginOptions.Merge(m, src)
+}
+func (m *DevicePluginOptions) XXX_Size() int {
+	return xxx_messageInfo_DevicePluginOptions.Size(m)
+}
+func (m *DevicePluginOptions) XXX_DiscardUnknown() {
+	xxx_messageInfo_DevicePluginOptions.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DevicePluginOptions proto.InternalMessageInfo
+
+func (m *DevicePluginOptions) GetPreStartRequired() bool {
+	if m != nil {
+		return m.PreStartRequired
+	}
+	return false
+}
+
+type RegisterRequest struct {
+	Version              string               `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Endpoint             string               `protobuf:"bytes,2,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	ResourceName         string               `protobuf:"bytes,3,opt,name=resource_name,json=resourceName,proto3" json:"resource_name,omitempty"`
+	Options              *DevicePluginOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
+func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
+func (*RegisterRequest) ProtoMessage()    {}
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{1}
+}
+
+func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterRequest.Unmarshal(m, b)
+}
+func (m *RegisterRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterRequest.Marshal(b, m, deterministic)
+}
+func (m *RegisterRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterRequest.Merge(m, src)
+}
+func (m *RegisterRequest) XXX_Size() int {
+	return xxx_messageInfo_RegisterRequest.Size(m)
+}
+func (m *RegisterRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterRequest proto.InternalMessageInfo
+
+func (m *RegisterRequest) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetEndpoint() string {
+	if m != nil {
+		return m.Endpoint
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetResourceName() string {
+	if m != nil {
+		return m.ResourceName
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetOptions() *DevicePluginOptions {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{2}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type ListAndWatchResponse struct {
+	Devices              []*Device `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListAndWatchResponse) Reset()         { *m = ListAndWatchResponse{} }
+func (m *ListAndWatchResponse) String() string { return proto.CompactTextString(m) }
+func (*ListAndWatchResponse) ProtoMessage()    {}
+func (*ListAndWatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{3}
+}
+
+func (m *ListAndWatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListAndWatchResponse.Unmarshal(m, b)
+}
+func (m *ListAndWatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListAndWatchResponse.Marshal(b, m, deterministic)
+}
+func (m *ListAndWatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListAndWatchResponse.Merge(m, src)
+}
+func (m *ListAndWatchResponse) XXX_Size() int {
+	return xxx_messageInfo_ListAndWatchResponse.Size(m)
+}
+func (m *ListAndWatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListAndWatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListAndWatchResponse proto.InternalMessageInfo
+
+func (m *ListAndWatchResponse) GetDevices() []*Device {
+	if m != nil {
+		return m.Devices
+	}
+	return nil
+}
+
+type Device struct {
+	ID                   string   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Health               string   `protobuf:"bytes,2,opt,name=health,proto3" json:"health,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Device) Reset()         { *m = Device{} }
+func (m *Device) String() string { return proto.CompactTextString(m) }
+func (*Device) ProtoMessage()    {}
+func (*Device) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{4}
+}
+
+func (m *Device) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Device.Unmarshal(m, b)
+}
+func (m *Device) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Device.Marshal(b, m, deterministic)
+}
+func (m *Device) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Device.Merge(m, src)
+}
+func (m *Device) XXX_Size() int {
+	return xxx_messageInfo_Device.Size(m)
+}
+func (m *Device) XXX_DiscardUnknown() {
+	xxx_messageInfo_Device.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Device proto.InternalMessageInfo
+
+func (m *Device) GetID() string {
+	if m != nil {
+		return m.ID
+	}
+	return ""
+}
+
+func (m *Device) GetHealth() string {
+	if m != nil {
+		return m.Health
+	}
+	return ""
+}
+
+type PreStartContainerRequest struct {
+	DevicesIDs           []string `protobuf:"bytes,1,rep,name=devicesIDs,proto3" json:"devicesIDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PreStartContainerRequest) Reset()         { *m = PreStartContainerRequest{} }
+func (m *PreStartContainerRequest) String() string { return proto.CompactTextString(m) }
+func (*PreStartContainerRequest) ProtoMessage()    {}
+func (*PreStartContainerRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{5}
+}
+
+func (m *PreStartContainerRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PreStartContainerRequest.Unmarshal(m, b)
+}
+func (m *PreStartContainerRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PreStartContainerRequest.Marshal(b, m, deterministic)
+}
+func (m *PreStartContainerRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PreStartContainerRequest.Merge(m, src)
+}
+func (m *PreStartContainerRequest) XXX_Size() int {
+	return xxx_messageInfo_PreStartContainerRequest.Size(m)
+}
+func (m *PreStartContainerRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PreStartContainerRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PreStartContainerRequest proto.InternalMessageInfo
+
+func (m *PreStartContainerRequest) GetDevicesIDs() []string {
+	if m != nil {
+		return m.DevicesIDs
+	}
+	return nil
+}
+
+type PreStartContainerResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PreStartContainerResponse) Reset()         { *m = PreStartContainerResponse{} }
+func (m *PreStartContainerResponse) String() string { return proto.CompactTextString(m) }
+func (*PreStartContainerResponse) ProtoMessage()    {}
+func (*PreStartContainerResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{6}
+}
+
+func (m *PreStartContainerResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PreStartContainerResponse.Unmarshal(m, b)
+}
+func (m *PreStartContainerResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PreStartContainerResponse.Marshal(b, m, deterministic)
+}
+func (m *PreStartContainerResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PreStartContainerResponse.Merge(m, src)
+}
+func (m *PreStartContainerResponse) XXX_Size() int {
+	return xxx_messageInfo_PreStartContainerResponse.Size(m)
+}
+func (m *PreStartContainerResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PreStartContainerResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PreStartContainerResponse proto.InternalMessageInfo
+
+type AllocateRequest struct {
+	ContainerRequests    []*ContainerAllocateRequest `protobuf:"bytes,1,rep,name=container_requests,json=containerRequests,proto3" json:"container_requests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                    `json:"-"`
+	XXX_unrecognized     []byte                      `json:"-"`
+	XXX_sizecache        int32                       `json:"-"`
+}
+
+func (m *AllocateRequest) Reset()         { *m = AllocateRequest{} }
+func (m *AllocateRequest) String() string { return proto.CompactTextString(m) }
+func (*AllocateRequest) ProtoMessage()    {}
+func (*AllocateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{7}
+}
+
+func (m *AllocateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AllocateRequest.Unmarshal(m, b)
+}
+func (m *AllocateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AllocateRequest.Marshal(b, m, deterministic)
+}
+func (m *AllocateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AllocateRequest.Merge(m, src)
+}
+func (m *AllocateRequest) XXX_Size() int {
+	return xxx_messageInfo_AllocateRequest.Size(m)
+}
+func (m *AllocateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AllocateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AllocateRequest proto.InternalMessageInfo
+
+func (m *AllocateRequest) GetContainerRequests() []*ContainerAllocateRequest {
+	if m != nil {
+		return m.ContainerRequests
+	}
+	return nil
+}
+
+type ContainerAllocateRequest struct {
+	DevicesIDs           []string `protobuf:"bytes,1,rep,name=devicesIDs,proto3" json:"devicesIDs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ContainerAllocateRequest) Reset()         { *m = ContainerAllocateRequest{} }
+func (m *ContainerAllocateRequest) String() string { return proto.CompactTextString(m) }
+func (*ContainerAllocateRequest) ProtoMessage()    {}
+func (*ContainerAllocateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{8}
+}
+
+func (m *ContainerAllocateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ContainerAllocateRequest.Unmarshal(m, b)
+}
+func (m *ContainerAllocateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ContainerAllocateRequest.Marshal(b, m, deterministic)
+}
+func (m *ContainerAllocateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ContainerAllocateRequest.Merge(m, src)
+}
+func (m *ContainerAllocateRequest) XXX_Size() int {
+	return xxx_messageInfo_ContainerAllocateRequest.Size(m)
+}
+func (m *ContainerAllocateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ContainerAllocateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ContainerAllocateRequest proto.InternalMessageInfo
+
+func (m *ContainerAllocateRequest) GetDevicesIDs() []string {
+	if m != nil {
+		return m.DevicesIDs
+	}
+	return nil
+}
+
+type AllocateResponse struct {
+	ContainerResponses   []*ContainerAllocateResponse `protobuf:"bytes,1,rep,name=container_responses,json=containerResponses,proto3" json:"container_responses,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *AllocateResponse) Reset()         { *m = AllocateResponse{} }
+func (m *AllocateResponse) String() string { return proto.CompactTextString(m) }
+func (*AllocateResponse) ProtoMessage()    {}
+func (*AllocateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{9}
+}
+
+func (m *AllocateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AllocateResponse.Unmarshal(m, b)
+}
+func (m *AllocateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AllocateResponse.Marshal(b, m, deterministic)
+}
+func (m *AllocateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AllocateResponse.Merge(m, src)
+}
+func (m *AllocateResponse) XXX_Size() int {
+	return xxx_messageInfo_AllocateResponse.Size(m)
+}
+func (m *AllocateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AllocateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AllocateResponse proto.InternalMessageInfo
+
+func (m *AllocateResponse) GetContainerResponses() []*ContainerAllocateResponse {
+	if m != nil {
+		return m.ContainerResponses
+	}
+	return nil
+}
+
+type ContainerAllocateResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ContainerAllocateResponse) Reset()         { *m = ContainerAllocateResponse{} }
+func (m *ContainerAllocateResponse) String() string { return proto.CompactTextString(m) }
+func (*ContainerAllocateResponse) ProtoMessage()    {}
+func (*ContainerAllocateResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_00212fb1f9d3bf1c, []int{10}
+}
+
+func (m *ContainerAllocateResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ContainerAllocateResponse.Unmarshal(m, b)
+}
+func (m *ContainerAllocateResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ContainerAllocateResponse.Marshal(b, m, deterministic)
+}
+func (m *ContainerAllocateResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ContainerAllocateResponse.Merge(m, src)
+}
+func (m *ContainerAllocateResponse) XXX_Size() int {
+	return xxx_messageInfo_ContainerAllocateResponse.Size(m)
+}
+func (m *ContainerAllocateResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ContainerAllocateResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ContainerAllocateResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*DevicePluginOptions)(nil), "v1beta1.DevicePluginOptions")
+	proto.RegisterType((*RegisterRequest)(nil), "v1beta1.RegisterRequest")
+	proto.RegisterType((*Empty)(nil), "v1beta1.Empty")
+	proto.RegisterType((*ListAndWatchResponse)(nil), "v1beta1.ListAndWatchResponse")
+	proto.RegisterType((*Device)(nil), "v1beta1.Device")
+	proto.RegisterType((*PreStartContainerRequest)(nil), "v1beta1.PreStartContainerRequest")
+	proto.RegisterType((*PreStartContainerResponse)(nil), "v1beta1.PreStartContainerResponse")
+	proto.RegisterType((*AllocateRequest)(nil), "v1beta1.AllocateRequest")
+	proto.RegisterType((*ContainerAllocateRequest)(nil), "v1beta1.ContainerAllocateRequest")
+	proto.RegisterType((*AllocateResponse)(nil), "v1beta1.AllocateResponse")
+	proto.RegisterType((*ContainerAllocateResponse)(nil), "v1beta1.ContainerAllocateResponse")
+}
+
+func init() {
+	proto.RegisterFile("api.proto", fileDescriptor_00212fb1f9d3bf1c)
+}
+
+var fileDescriptor_00212fb1f9d3bf1c = []byte{
+	// 497 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x54, 0x5d, 0x6b, 0x1a, 0x41,
+	0x14, 0xcd, 0x9a, 0xc6, 0xd5, 0x1b, 0x1b, 0x93, 0x49, 0x09, 0x1b, 0xfb, 0x81, 0x9d, 0xbe, 0x58,
+	0x28, 0x92, 0x58, 0xc8, 0x43, 0xdf, 0xb6, 0xb1, 0x1f, 0x42, 0x69, 0x65, 0xf2, 0x50, 0x28, 0x05,
+	0x99, 0xac, 0x17, 0x1d, 0xd0, 0x99, 0xed, 0xcc, 0x28, 0xf4, 0xff, 0xf4, 0x67, 0xf4, 0xc7, 0x15,
+	0x77, 0x77, 0xd6, 0x65, 0xb3, 0xda, 0x27, 0xb9, 0x1f, 0xe7, 0xec, 0x39, 0x77, 0x8f, 0x0b, 0x4d,
+	0x1e, 0x8b, 0x7e, 0xac, 0x95, 0x55, 0xc4, 0x5f, 0x5f, 0xdf, 0xa3, 0xe5, 0xd7, 0xf4, 0x16, 0xce,
+	0x87, 0xb8, 0x16, 0x11, 0x8e, 0x17, 0xab, 0x99, 0x90, 0xdf, 0x62, 0x2b, 0x94, 0x34, 0xe4, 0x0d,
+	0x90, 0x58, 0xe3, 0xc4, 0x58, 0xae, 0xed, 0x44, 0xe3, 0xaf, 0x95, 0xd0, 0x38, 0x0d, 0xbc, 0xae,
+	0xd7, 0x6b, 0xb0, 0xd3, 0x58, 0xe3, 0xdd, 0x66, 0xc0, 0xb2, 0x3e, 0xfd, 0xe3, 0x41, 0x9b, 0xe1,
+	0x4c, 0x18, 0x8b, 0x7a, 0xd3, 0x44, 0x63, 0x49, 0x00, 0xfe, 0x1a, 0xb5, 0x11, 0x4a, 0x26, 0xb0,
+	0x26, 0x73, 0x25, 0xe9, 0x40, 0x03, 0xe5, 0x34, 0x56, 0x42, 0xda, 0xa0, 0x96, 0x8c, 0xf2, 0x9a,
+	0xbc, 0x82, 0xc7, 0x1a, 0x8d, 0x5a, 0xe9, 0x08, 0x27, 0x92, 0x2f, 0x31, 0x38, 0x4c, 0x16, 0x5a,
+	0xae, 0xf9, 0x95, 0x2f, 0x91, 0xdc, 0x80, 0xaf, 0x52, 0x9d, 0xc1, 0xa3, 0xae, 0xd7, 0x3b, 0x1e,
+	0x3c, 0xeb, 0x67, 0x76, 0xfa, 0x15, 0x5e, 0x98, 0x5b, 0xa6, 0x3e, 0x1c, 0x7d, 0x58, 0xc6, 0xf6,
+	0x37, 0x0d, 0xe1, 0xc9, 0x17, 0x61, 0x6c, 0x28, 0xa7, 0xdf, 0xb9, 0x8d, 0xe6, 0x0c, 0x4d, 0xac,
+	0xa4, 0x41, 0xf2, 0x1a, 0xfc, 0x69, 0x42, 0x60, 0x02, 0xaf, 0x7b, 0xd8, 0x3b, 0x1e, 0xb4, 0x4b,
+	0xc4, 0xcc, 0xcd, 0xe9, 0x15, 0xd4, 0xd3, 0x16, 0x39, 0x81, 0xda, 0x68, 0x98, 0x79, 0xac, 0x8d,
+	0x86, 0xe4, 0x02, 0xea, 0x73, 0xe4, 0x0b, 0x3b, 0xcf, 0xcc, 0x65, 0x15, 0x7d, 0x07, 0xc1, 0x38,
+	0x3b, 0xdc, 0xad, 0x92, 0x96, 0x0b, 0xb9, 0x3d, 0xd6, 0x0b, 0x80, 0x8c, 0x78, 0x34, 0x4c, 0x9f,
+	0xdd, 0x64, 0x85, 0x0e, 0x7d, 0x0a, 0x97, 0x15, 0xd8, 0x54, 0x35, 0x8d, 0xa0, 0x1d, 0x2e, 0x16,
+	0x2a, 0xe2, 0x16, 0x1d, 0xdf, 0x18, 0x48, 0xe4, 0xf6, 0x92, 0xd7, 0x87, 0xc6, 0x3a, 0x4f, 0x2f,
+	0x73, 0x4f, 0x39, 0x55, 0x09, 0xce, 0xce, 0xa2, 0x92, 0x40, 0xb3, 0x51, 0xbf, 0x6b, 0xfd, 0xbf,
+	0xea, 0x67, 0x70, 0xba, 0x85, 0x64, 0xa7, 0xbe, 0x83, 0xf3, 0xa2, 0xc2, 0xb4, 0xeb, 0x24, 0xd2,
+	0x7d, 0x12, 0xd3, 0x55, 0x46, 0xa2, 0xf2, 0x21, 0x92, 0x33, 0xed, 0x04, 0x0c, 0x3e, 0x42, 0x2b,
+	0xcd, 0xa8, 0xe6, 0x9b, 0x38, 0x90, 0x1b, 0x68, 0xb8, 0xcc, 0x92, 0x20, 0x7f, 0x60, 0x29, 0xc6,
+	0x9d, 0x93, 0x7c, 0x92, 0x46, 0xe7, 0x60, 0xf0, 0xb7, 0x06, 0xad, 0x62, 0xcc, 0xc8, 0x67, 0xb8,
+	0xf8, 0x84, 0xb6, 0xea, 0x5f, 0x54, 0x02, 0x77, 0xf6, 0xe6, 0x94, 0x1e, 0x90, 0x10, 0x5a, 0xc5,
+	0x5c, 0x3e, 0xc0, 0x3f, 0xcf, 0xeb, 0xaa, 0xf8, 0xd2, 0x83, 0x2b, 0x8f, 0x84, 0xd0, 0x70, 0xce,
+	0x0b, 0xae, 0x4a, 0x6f, 0xac, 0x73, 0x59, 0x31, 0x71, 0x24, 0xe4, 0x27, 0x9c, 0x3d, 0x08, 0x1b,
+	0xd9, 0xa6, 0x66, 0x57, 0x88, 0x3b, 0x74, 0xdf, 0x8a, 0x63, 0x7f, 0xef, 0xff, 0x38, 0x4a, 0x3e,
+	0x41, 0xf7, 0xf5, 0xe4, 0xe7, 0xed, 0xbf, 0x01, 0x00, 0x96, 0xde, 0xba, 0xa4, 0x96, 0x04, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// RegistrationClient is the client API for Registration service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type RegistrationClient interface {
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type registrationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRegistrationClient(cc grpc.ClientConnInterface) RegistrationClient {
+	return &registrationClient{cc}
+}
+
+func (c *registrationClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/v1beta1.Registration/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RegistrationServer is the server API for Registration service.
+type RegistrationServer interface {
+	Register(context.Context, *RegisterRequest) (*Empty, error)
+}
+
+// UnimplementedRegistrationServer can be embedded to have forward compatible implementations.
+type UnimplementedRegistrationServer struct {
+}
+
+func (*UnimplementedRegistrationServer) Register(ctx context.Context, req *RegisterRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+
+func RegisterRegistrationServer(s *grpc.Server, srv RegistrationServer) {
+	s.RegisterService(&_Registration_serviceDesc, srv)
+}
+
+func _Registration_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegistrationServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1beta1.Registration/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegistrationServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Registration_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "v1beta1.Registration",
+	HandlerType: (*RegistrationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Registration_Register_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api.proto",
+}
+
+// DevicePluginClient is the client API for DevicePlugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type DevicePluginClient interface {
+	GetDevicePluginOptions(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*DevicePluginOptions, error)
+	ListAndWatch(ctx context.Context, in *Empty, opts ...grpc.CallOption) (DevicePlugin_ListAndWatchClient, error)
+	Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*AllocateResponse, error)
+	PreStartContainer(ctx context.Context, in *PreStartContainerRequest, opts ...grpc.CallOption) (*PreStartContainerResponse, error)
+}
+
+type devicePluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDevicePluginClient(cc grpc.ClientConnInterface) DevicePluginClient {
+	return &devicePluginClient{cc}
+}
+
+func (c *devicePluginClient) GetDevicePluginOptions(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*DevicePluginOptions, error) {
+	out := new(DevicePluginOptions)
+	err := c.cc.Invoke(ctx, "/v1beta1.DevicePlugin/GetDevicePluginOptions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *devicePluginClient) ListAndWatch(ctx context.Context, in *Empty, opts ...grpc.CallOption) (DevicePlugin_ListAndWatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_DevicePlugin_serviceDesc.Streams[0], "/v1beta1.DevicePlugin/ListAndWatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &devicePluginListAndWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DevicePlugin_ListAndWatchClient interface {
+	Recv() (*ListAndWatchResponse, error)
+	grpc.ClientStream
+}
+
+type devicePluginListAndWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *devicePluginListAndWatchClient) Recv() (*ListAndWatchResponse, error) {
+	m := new(ListAndWatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *devicePluginClient) Allocate(ctx context.Context, in *AllocateRequest, opts ...grpc.CallOption) (*AllocateResponse, error) {
+	out := new(AllocateResponse)
+	err := c.cc.Invoke(ctx, "/v1beta1.DevicePlugin/Allocate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *devicePluginClient) PreStartContainer(ctx context.Context, in *PreStartContainerRequest, opts ...grpc.CallOption) (*PreStartContainerResponse, error) {
+	out := new(PreStartContainerResponse)
+	err := c.cc.Invoke(ctx, "/v1beta1.DevicePlugin/PreStartContainer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DevicePluginServer is the server API for DevicePlugin service.
+type DevicePluginServer interface {
+	GetDevicePluginOptions(context.Context, *Empty) (*DevicePluginOptions, error)
+	ListAndWatch(*Empty, DevicePlugin_ListAndWatchServer) error
+	Allocate(context.Context, *AllocateRequest) (*AllocateResponse, error)
+	PreStartContainer(context.Context, *PreStartContainerRequest) (*PreStartContainerResponse, error)
+}
+
+// UnimplementedDevicePluginServer can be embedded to have forward compatible implementations.
+type UnimplementedDevicePluginServer struct {
+}
+
+func (*UnimplementedDevicePluginServer) GetDevicePluginOptions(ctx context.Context, req *Empty) (*DevicePluginOptions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevicePluginOptions not implemented")
+}
+func (*UnimplementedDevicePluginServer) ListAndWatch(req *Empty, srv DevicePlugin_ListAndWatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListAndWatch not implemented")
+}
+func (*UnimplementedDevicePluginServer) Allocate(ctx context.Context, req *AllocateRequest) (*AllocateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Allocate not implemented")
+}
+func (*UnimplementedDevicePluginServer) PreStartContainer(ctx context.Context, req *PreStartContainerRequest) (*PreStartContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PreStartContainer not implemented")
+}
+
+func RegisterDevicePluginServer(s *grpc.Server, srv DevicePluginServer) {
+	s.RegisterService(&_DevicePlugin_serviceDesc, srv)
+}
+
+func _DevicePlugin_GetDevicePluginOptions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevicePluginServer).GetDevicePluginOptions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1beta1.DevicePlugin/GetDevicePluginOptions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevicePluginServer).GetDevicePluginOptions(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DevicePlugin_ListAndWatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DevicePluginServer).ListAndWatch(m, &devicePluginListAndWatchServer{stream})
+}
+
+type DevicePlugin_ListAndWatchServer interface {
+	Send(*ListAndWatchResponse) error
+	grpc.ServerStream
+}
+
+type devicePluginListAndWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *devicePluginListAndWatchServer) Send(m *ListAndWatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _DevicePlugin_Allocate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AllocateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevicePluginServer).Allocate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1beta1.DevicePlugin/Allocate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevicePluginServer).Allocate(ctx, req.(*AllocateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DevicePlugin_PreStartContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreStartContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DevicePluginServer).PreStartContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1beta1.DevicePlugin/PreStartContainer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DevicePluginServer).PreStartContainer(ctx, req.(*PreStartContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _DevicePlugin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "v1beta1.DevicePlugin",
+	HandlerType: (*DevicePluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDevicePluginOptions",
+			Handler:    _DevicePlugin_GetDevicePluginOptions_Handler,
+		},
+		{
+			MethodName: "Allocate",
+			Handler:    _DevicePlugin_Allocate_Handler,
+		},
+		{
+			MethodName: "PreStartContainer",
+			Handler:    _DevicePlugin_PreStartContainer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListAndWatch",
+			Handler:       _DevicePlugin_ListAndWatch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api.proto",
+}
@@ -0,0 +1,202 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package guestagent
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+
+	pb "github.com/ease-lab/vhive/guestagent/proto"
+)
+
+const (
+	defaultHealthInterval = 2 * time.Second
+	healthTimeout         = time.Second
+)
+
+// Channel is the control channel between the host and the agent inside
+// a guest. Health checks, shutdown requests and log streaming are multiplexed
+// over a single connection that is re-established if the agent restarts.
+type Channel struct {
+	conn           *grpc.ClientConn
+	client         pb.GuestAgentClient
+	healthInterval time.Duration
+	reachable      int32
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ChannelOption Options to pass to NewChannel
+type ChannelOption func(*Channel)
+
+// WithHealthInterval Sets how often the agent is health-checked in the background
+func WithHealthInterval(interval time.Duration) ChannelOption {
+	return func(c *Channel) {
+		c.healthInterval = interval
+	}
+}
+
+// NewChannel Creates a control channel to the guest agent reachable
+// with the given dialer. The connection is established lazily.
+func NewChannel(dial Dialer, opts ...ChannelOption) (*Channel, error) {
+	c := &Channel{
+		healthInterval: defaultHealthInterval,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := grpc.Dial("guest-agent",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return dial(ctx)
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  100 * time.Millisecond,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   c.healthInterval,
+			},
+			MinConnectTimeout: healthTimeout,
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create guest agent channel")
+	}
+
+	c.conn = conn
+	c.client = pb.NewGuestAgentClient(conn)
+
+	go c.watch()
+
+	return c, nil
+}
+
+// Reachable Returns whether the last health check reached the agent
+func (c *Channel) Reachable() bool {
+	return atomic.LoadInt32(&c.reachable) == 1
+}
+
+// Health Checks that the agent is reachable and serving
+func (c *Channel) Health(ctx context.Context) error {
+	resp, err := c.client.Health(ctx, &pb.HealthReq{})
+	if err != nil {
+		atomic.StoreInt32(&c.reachable, 0)
+		return errors.Wrap(err, "guest agent unreachable")
+	}
+
+	atomic.StoreInt32(&c.reachable, 1)
+
+	if !resp.GetServing() {
+		return errors.Errorf("guest agent is not serving: %s", resp.GetMessage())
+	}
+
+	return nil
+}
+
+// Shutdown Asks the agent to shut the guest down within the timeout
+func (c *Channel) Shutdown(ctx context.Context, timeout time.Duration) error {
+	_, err := c.client.Shutdown(ctx, &pb.ShutdownReq{TimeoutSeconds: uint32(timeout.Seconds())})
+	return err
+}
+
+// SyncClock Sets the clock of the guest to now, e.g., after the VM was
+// restored from a snapshot, returning how far behind the guest clock was.
+// It waits for the agent to be reachable until the context is done.
+func (c *Channel) SyncClock(ctx context.Context, now time.Time) (time.Duration, error) {
+	resp, err := c.client.SyncClock(ctx, &pb.SyncClockReq{UnixNano: now.UnixNano()}, grpc.WaitForReady(true))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to sync guest clock")
+	}
+
+	return time.Duration(resp.GetSkewNs()), nil
+}
+
+// StreamLogs Calls fn on every log line of the guest until the stream ends,
+// which happens only on error or context cancellation if follow is set
+func (c *Channel) StreamLogs(ctx context.Context, follow bool, fn func(*pb.LogLine)) error {
+	stream, err := c.client.StreamLogs(ctx, &pb.StreamLogsReq{Follow: follow})
+	if err != nil {
+		return err
+	}
+
+	for {
+		line, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(line)
+	}
+}
+
+// Close Stops the background health checks and closes the connection
+func (c *Channel) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// watch health-checks the agent periodically, which also keeps
+// the connection being re-established after the agent restarts
+func (c *Channel) watch() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+		_ = c.Health(ctx)
+		cancel()
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
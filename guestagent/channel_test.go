@@ -0,0 +1,230 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package guestagent
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	pb "github.com/ease-lab/vhive/guestagent/proto"
+)
+
+const (
+	testInterval = 50 * time.Millisecond
+	testWait     = 5 * time.Second
+)
+
+// startAgent serves a guest agent on a Unix socket standing in for vsock
+func startAgent(t *testing.T, sockPath string, agent *Server) *grpc.Server {
+	lis, err := net.Listen("unix", sockPath)
+	require.NoError(t, err, "failed to listen on agent socket")
+
+	server := grpc.NewServer()
+	agent.Register(server)
+
+	go func() {
+		_ = server.Serve(lis)
+	}()
+
+	return server
+}
+
+func TestChannelHealth(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agent.sock")
+	server := startAgent(t, sockPath, NewServer(nil))
+	defer server.Stop()
+
+	c, err := NewChannel(UnixDialer(sockPath), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	require.Eventually(t, c.Reachable, testWait, testInterval, "agent is not reachable")
+	require.NoError(t, c.Health(context.Background()), "agent is not healthy")
+}
+
+func TestChannelReconnect(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agent.sock")
+	server := startAgent(t, sockPath, NewServer(nil))
+
+	c, err := NewChannel(UnixDialer(sockPath), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	require.Eventually(t, c.Reachable, testWait, testInterval, "agent is not reachable")
+
+	// Agent restart
+	server.Stop()
+	require.Eventually(t, func() bool { return !c.Reachable() }, testWait, testInterval, "agent is still reachable")
+
+	server = startAgent(t, sockPath, NewServer(nil))
+	defer server.Stop()
+
+	require.Eventually(t, c.Reachable, testWait, testInterval, "channel did not reconnect")
+}
+
+func TestChannelShutdown(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agent.sock")
+	shutdownCh := make(chan time.Duration, 1)
+	server := startAgent(t, sockPath, NewServer(func(timeout time.Duration) {
+		shutdownCh <- timeout
+	}))
+	defer server.Stop()
+
+	c, err := NewChannel(UnixDialer(sockPath), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	require.NoError(t, c.Shutdown(context.Background(), 3*time.Second), "failed to request shutdown")
+
+	select {
+	case timeout := <-shutdownCh:
+		require.Equal(t, 3*time.Second, timeout, "wrong shutdown timeout")
+	case <-time.After(testWait):
+		t.Fatal("agent did not receive shutdown")
+	}
+}
+
+func TestChannelSyncClock(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agent.sock")
+	clockCh := make(chan time.Time, 1)
+	server := startAgent(t, sockPath, NewServer(nil, WithClockSetter(func(now time.Time) error {
+		clockCh <- now
+		return nil
+	})))
+	defer server.Stop()
+
+	c, err := NewChannel(UnixDialer(sockPath), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	// A guest clock that stood still while the VM was paused
+	now := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), testWait)
+	defer cancel()
+
+	skew, err := c.SyncClock(ctx, now)
+	require.NoError(t, err, "failed to sync clock")
+	require.True(t, skew > 59*time.Minute && skew <= time.Hour, "wrong clock skew %s", skew)
+
+	select {
+	case set := <-clockCh:
+		require.True(t, set.Equal(now), "wrong clock set")
+	case <-time.After(testWait):
+		t.Fatal("agent did not set the clock")
+	}
+}
+
+func TestChannelStreamLogs(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "agent.sock")
+	agent := NewServer(nil)
+	server := startAgent(t, sockPath, agent)
+	defer server.Stop()
+
+	agent.Log("stdout", []byte("line 1"))
+	agent.Log("stderr", []byte("line 2"))
+
+	c, err := NewChannel(UnixDialer(sockPath), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	var lines []*pb.LogLine
+	err = c.StreamLogs(context.Background(), false, func(l *pb.LogLine) {
+		lines = append(lines, l)
+	})
+	require.NoError(t, err, "failed to stream logs")
+
+	require.Len(t, lines, 2, "wrong number of log lines")
+	require.Equal(t, "stdout", lines[0].GetStream())
+	require.Equal(t, []byte("line 1"), lines[0].GetLine())
+	require.Equal(t, "stderr", lines[1].GetStream())
+	require.Equal(t, []byte("line 2"), lines[1].GetLine())
+}
+
+func TestVsockDialer(t *testing.T) {
+	dir := t.TempDir()
+	agentPath := filepath.Join(dir, "agent.sock")
+	vsockPath := filepath.Join(dir, "firecracker.vsock")
+
+	server := startAgent(t, agentPath, NewServer(nil))
+	defer server.Stop()
+
+	// Fake Firecracker vsock device that accepts connections to port 52 only
+	lis, err := net.Listen("unix", vsockPath)
+	require.NoError(t, err, "failed to listen on vsock socket")
+	defer lis.Close()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				msg, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil || msg != "CONNECT 52\n" {
+					return
+				}
+
+				agentConn, err := net.Dial("unix", agentPath)
+				if err != nil {
+					return
+				}
+				defer agentConn.Close()
+
+				if _, err := io.WriteString(conn, "OK 1073741824\n"); err != nil {
+					return
+				}
+
+				go func() {
+					_, _ = io.Copy(agentConn, conn)
+				}()
+				_, _ = io.Copy(conn, agentConn)
+			}(conn)
+		}
+	}()
+
+	c, err := NewChannel(VsockDialer(vsockPath, 52), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer c.Close()
+
+	require.Eventually(t, c.Reachable, testWait, testInterval, "agent is not reachable over vsock")
+
+	wrongPort, err := NewChannel(VsockDialer(vsockPath, 53), WithHealthInterval(testInterval))
+	require.NoError(t, err, "failed to create channel")
+	defer wrongPort.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Error(t, wrongPort.Health(ctx), "agent is reachable on a wrong port")
+}
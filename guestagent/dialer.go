@@ -0,0 +1,105 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package guestagent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxAckLen is the upper bound on the length of Firecracker's "OK <port>" ack
+const maxAckLen = 32
+
+// Dialer opens a connection to the guest agent
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// VsockDialer returns a dialer that reaches the guest agent through
+// the host side of a Firecracker (hybrid) vsock device, i.e.,
+// the Unix socket at udsPath, asking Firecracker to forward the connection
+// to the given guest port
+func VsockDialer(udsPath string, port uint32) Dialer {
+	return func(ctx context.Context) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", udsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		if err := vsockHandshake(conn, port); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		_ = conn.SetDeadline(time.Time{})
+
+		return conn, nil
+	}
+}
+
+// UnixDialer returns a dialer that connects to the guest agent
+// over a plain Unix socket, e.g., a stand-in for vsock in tests
+func UnixDialer(path string) Dialer {
+	return func(ctx context.Context) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}
+}
+
+// vsockHandshake performs the Firecracker host-initiated vsock
+// connection protocol: "CONNECT <port>\n" is answered with "OK <host port>\n"
+func vsockHandshake(conn net.Conn, port uint32) error {
+	if _, err := fmt.Fprintf(conn, "CONNECT %d\n", port); err != nil {
+		return errors.Wrap(err, "failed to send vsock connect message")
+	}
+
+	// Read byte by byte not to consume any data that follows the ack
+	var (
+		ack strings.Builder
+		buf = make([]byte, 1)
+	)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			return errors.Wrap(err, "failed to read vsock connect ack")
+		}
+		if buf[0] == '\n' {
+			break
+		}
+		if ack.Len() > maxAckLen {
+			return errors.New("vsock connect ack is too long")
+		}
+		ack.WriteByte(buf[0])
+	}
+
+	if !strings.HasPrefix(ack.String(), "OK ") {
+		return errors.Errorf("unexpected vsock connect ack %q", ack.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,626 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: agent.proto
+
+package proto
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type HealthReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthReq) Reset()         { *m = HealthReq{} }
+func (m *HealthReq) String() string { return proto.CompactTextString(m) }
+func (*HealthReq) ProtoMessage()    {}
+func (*HealthReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{0}
+}
+
+func (m *HealthReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthReq.Unmarshal(m, b)
+}
+func (m *HealthReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthReq.Marshal(b, m, deterministic)
+}
+func (m *HealthReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthReq.Merge(m, src)
+}
+func (m *HealthReq) XXX_Size() int {
+	return xxx_messageInfo_HealthReq.Size(m)
+}
+func (m *HealthReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthReq proto.InternalMessageInfo
+
+type HealthResp struct {
+	Serving              bool     `protobuf:"varint,1,opt,name=serving,proto3" json:"serving,omitempty"`
+	Message              string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthResp) Reset()         { *m = HealthResp{} }
+func (m *HealthResp) String() string { return proto.CompactTextString(m) }
+func (*HealthResp) ProtoMessage()    {}
+func (*HealthResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{1}
+}
+
+func (m *HealthResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthResp.Unmarshal(m, b)
+}
+func (m *HealthResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthResp.Marshal(b, m, deterministic)
+}
+func (m *HealthResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthResp.Merge(m, src)
+}
+func (m *HealthResp) XXX_Size() int {
+	return xxx_messageInfo_HealthResp.Size(m)
+}
+func (m *HealthResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthResp proto.InternalMessageInfo
+
+func (m *HealthResp) GetServing() bool {
+	if m != nil {
+		return m.Serving
+	}
+	return false
+}
+
+func (m *HealthResp) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type ShutdownReq struct {
+	TimeoutSeconds       uint32   `protobuf:"varint,1,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShutdownReq) Reset()         { *m = ShutdownReq{} }
+func (m *ShutdownReq) String() string { return proto.CompactTextString(m) }
+func (*ShutdownReq) ProtoMessage()    {}
+func (*ShutdownReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{2}
+}
+
+func (m *ShutdownReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShutdownReq.Unmarshal(m, b)
+}
+func (m *ShutdownReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShutdownReq.Marshal(b, m, deterministic)
+}
+func (m *ShutdownReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShutdownReq.Merge(m, src)
+}
+func (m *ShutdownReq) XXX_Size() int {
+	return xxx_messageInfo_ShutdownReq.Size(m)
+}
+func (m *ShutdownReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShutdownReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShutdownReq proto.InternalMessageInfo
+
+func (m *ShutdownReq) GetTimeoutSeconds() uint32 {
+	if m != nil {
+		return m.TimeoutSeconds
+	}
+	return 0
+}
+
+type ShutdownResp struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ShutdownResp) Reset()         { *m = ShutdownResp{} }
+func (m *ShutdownResp) String() string { return proto.CompactTextString(m) }
+func (*ShutdownResp) ProtoMessage()    {}
+func (*ShutdownResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{3}
+}
+
+func (m *ShutdownResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ShutdownResp.Unmarshal(m, b)
+}
+func (m *ShutdownResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ShutdownResp.Marshal(b, m, deterministic)
+}
+func (m *ShutdownResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShutdownResp.Merge(m, src)
+}
+func (m *ShutdownResp) XXX_Size() int {
+	return xxx_messageInfo_ShutdownResp.Size(m)
+}
+func (m *ShutdownResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShutdownResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShutdownResp proto.InternalMessageInfo
+
+type StreamLogsReq struct {
+	Follow               bool     `protobuf:"varint,1,opt,name=follow,proto3" json:"follow,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamLogsReq) Reset()         { *m = StreamLogsReq{} }
+func (m *StreamLogsReq) String() string { return proto.CompactTextString(m) }
+func (*StreamLogsReq) ProtoMessage()    {}
+func (*StreamLogsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{4}
+}
+
+func (m *StreamLogsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamLogsReq.Unmarshal(m, b)
+}
+func (m *StreamLogsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamLogsReq.Marshal(b, m, deterministic)
+}
+func (m *StreamLogsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamLogsReq.Merge(m, src)
+}
+func (m *StreamLogsReq) XXX_Size() int {
+	return xxx_messageInfo_StreamLogsReq.Size(m)
+}
+func (m *StreamLogsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamLogsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamLogsReq proto.InternalMessageInfo
+
+func (m *StreamLogsReq) GetFollow() bool {
+	if m != nil {
+		return m.Follow
+	}
+	return false
+}
+
+type LogLine struct {
+	TimestampNs          int64    `protobuf:"varint,1,opt,name=timestamp_ns,json=timestampNs,proto3" json:"timestamp_ns,omitempty"`
+	Stream               string   `protobuf:"bytes,2,opt,name=stream,proto3" json:"stream,omitempty"`
+	Line                 []byte   `protobuf:"bytes,3,opt,name=line,proto3" json:"line,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LogLine) Reset()         { *m = LogLine{} }
+func (m *LogLine) String() string { return proto.CompactTextString(m) }
+func (*LogLine) ProtoMessage()    {}
+func (*LogLine) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{5}
+}
+
+func (m *LogLine) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogLine.Unmarshal(m, b)
+}
+func (m *LogLine) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogLine.Marshal(b, m, deterministic)
+}
+func (m *LogLine) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogLine.Merge(m, src)
+}
+func (m *LogLine) XXX_Size() int {
+	return xxx_messageInfo_LogLine.Size(m)
+}
+func (m *LogLine) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogLine.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogLine proto.InternalMessageInfo
+
+func (m *LogLine) GetTimestampNs() int64 {
+	if m != nil {
+		return m.TimestampNs
+	}
+	return 0
+}
+
+func (m *LogLine) GetStream() string {
+	if m != nil {
+		return m.Stream
+	}
+	return ""
+}
+
+func (m *LogLine) GetLine() []byte {
+	if m != nil {
+		return m.Line
+	}
+	return nil
+}
+
+type SyncClockReq struct {
+	UnixNano             int64    `protobuf:"varint,1,opt,name=unix_nano,json=unixNano,proto3" json:"unix_nano,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SyncClockReq) Reset()         { *m = SyncClockReq{} }
+func (m *SyncClockReq) String() string { return proto.CompactTextString(m) }
+func (*SyncClockReq) ProtoMessage()    {}
+func (*SyncClockReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{6}
+}
+
+func (m *SyncClockReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncClockReq.Unmarshal(m, b)
+}
+func (m *SyncClockReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncClockReq.Marshal(b, m, deterministic)
+}
+func (m *SyncClockReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncClockReq.Merge(m, src)
+}
+func (m *SyncClockReq) XXX_Size() int {
+	return xxx_messageInfo_SyncClockReq.Size(m)
+}
+func (m *SyncClockReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncClockReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncClockReq proto.InternalMessageInfo
+
+func (m *SyncClockReq) GetUnixNano() int64 {
+	if m != nil {
+		return m.UnixNano
+	}
+	return 0
+}
+
+type SyncClockResp struct {
+	SkewNs               int64    `protobuf:"varint,1,opt,name=skew_ns,json=skewNs,proto3" json:"skew_ns,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SyncClockResp) Reset()         { *m = SyncClockResp{} }
+func (m *SyncClockResp) String() string { return proto.CompactTextString(m) }
+func (*SyncClockResp) ProtoMessage()    {}
+func (*SyncClockResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_56ede974c0020f77, []int{7}
+}
+
+func (m *SyncClockResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncClockResp.Unmarshal(m, b)
+}
+func (m *SyncClockResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncClockResp.Marshal(b, m, deterministic)
+}
+func (m *SyncClockResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncClockResp.Merge(m, src)
+}
+func (m *SyncClockResp) XXX_Size() int {
+	return xxx_messageInfo_SyncClockResp.Size(m)
+}
+func (m *SyncClockResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncClockResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncClockResp proto.InternalMessageInfo
+
+func (m *SyncClockResp) GetSkewNs() int64 {
+	if m != nil {
+		return m.SkewNs
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*HealthReq)(nil), "guestagent.HealthReq")
+	proto.RegisterType((*HealthResp)(nil), "guestagent.HealthResp")
+	proto.RegisterType((*ShutdownReq)(nil), "guestagent.ShutdownReq")
+	proto.RegisterType((*ShutdownResp)(nil), "guestagent.ShutdownResp")
+	proto.RegisterType((*StreamLogsReq)(nil), "guestagent.StreamLogsReq")
+	proto.RegisterType((*LogLine)(nil), "guestagent.LogLine")
+	proto.RegisterType((*SyncClockReq)(nil), "guestagent.SyncClockReq")
+	proto.RegisterType((*SyncClockResp)(nil), "guestagent.SyncClockResp")
+}
+
+func init() {
+	proto.RegisterFile("agent.proto", fileDescriptor_56ede974c0020f77)
+}
+
+var fileDescriptor_56ede974c0020f77 = []byte{
+	// 380 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x52, 0x41, 0x8f, 0x9a, 0x40,
+	0x18, 0x15, 0x6d, 0x41, 0x3e, 0xd0, 0x26, 0xd3, 0x54, 0x91, 0x5e, 0xec, 0x5c, 0x24, 0x69, 0x62,
+	0x9a, 0x36, 0x69, 0xd2, 0x53, 0xad, 0x3d, 0xec, 0x1e, 0x8c, 0x07, 0xb8, 0x6c, 0xf6, 0x62, 0x58,
+	0x9d, 0x45, 0x22, 0xcc, 0xa0, 0xdf, 0xb0, 0xee, 0xfe, 0x89, 0xfd, 0xcd, 0x9b, 0x41, 0x10, 0x4c,
+	0xdc, 0x13, 0xbc, 0xf7, 0x3e, 0xde, 0x3c, 0xde, 0x37, 0x60, 0x85, 0x11, 0xe3, 0x72, 0x9a, 0x1d,
+	0x84, 0x14, 0x04, 0xa2, 0x9c, 0xa1, 0x2c, 0x18, 0x6a, 0x81, 0x79, 0xcb, 0xc2, 0x44, 0x6e, 0x7d,
+	0xb6, 0xa7, 0x33, 0x80, 0x0a, 0x60, 0x46, 0x1c, 0x30, 0x90, 0x1d, 0x9e, 0x62, 0x1e, 0x39, 0xda,
+	0x58, 0xf3, 0xba, 0x7e, 0x05, 0x95, 0x92, 0x32, 0xc4, 0x30, 0x62, 0x4e, 0x7b, 0xac, 0x79, 0xa6,
+	0x5f, 0x41, 0xfa, 0x1b, 0xac, 0x60, 0x9b, 0xcb, 0x8d, 0x38, 0x72, 0x9f, 0xed, 0xc9, 0x04, 0x3e,
+	0xc9, 0x38, 0x65, 0x22, 0x97, 0x2b, 0x64, 0x6b, 0xc1, 0x37, 0x58, 0x58, 0xf5, 0xfc, 0x7e, 0x49,
+	0x07, 0x27, 0x96, 0xf6, 0xc1, 0xae, 0xbf, 0xc3, 0x8c, 0x4e, 0xa0, 0x17, 0xc8, 0x03, 0x0b, 0xd3,
+	0x85, 0x88, 0x50, 0x39, 0x0d, 0x40, 0x7f, 0x14, 0x49, 0x22, 0x8e, 0x65, 0x96, 0x12, 0xd1, 0x3b,
+	0x30, 0x16, 0x22, 0x5a, 0xc4, 0x9c, 0x91, 0x6f, 0x60, 0x2b, 0x57, 0x94, 0x61, 0x9a, 0xad, 0xf8,
+	0xe9, 0xa4, 0x8e, 0x6f, 0x9d, 0xb9, 0x25, 0x2a, 0x17, 0x2c, 0x6c, 0xcb, 0xdc, 0x25, 0x22, 0x04,
+	0x3e, 0x24, 0x31, 0x67, 0x4e, 0x67, 0xac, 0x79, 0xb6, 0x5f, 0xbc, 0xd3, 0xef, 0x60, 0x07, 0x2f,
+	0x7c, 0xfd, 0x3f, 0x11, 0xeb, 0x9d, 0x4a, 0xf0, 0x15, 0xcc, 0x9c, 0xc7, 0xcf, 0x2b, 0x1e, 0x72,
+	0x51, 0x7a, 0x77, 0x15, 0xb1, 0x0c, 0xb9, 0xa0, 0x1e, 0xf4, 0x1a, 0xc3, 0x98, 0x91, 0x21, 0x18,
+	0xb8, 0x63, 0xc7, 0x3a, 0x87, 0xae, 0xe0, 0x12, 0x7f, 0xbe, 0xb6, 0x01, 0x6e, 0x54, 0xff, 0xff,
+	0x54, 0xff, 0xe4, 0x0f, 0xe8, 0xa7, 0xca, 0xc9, 0x97, 0x69, 0xbd, 0x96, 0xe9, 0x79, 0x27, 0xee,
+	0xe0, 0x1a, 0x8d, 0x19, 0x6d, 0x91, 0xbf, 0xd0, 0xad, 0x3a, 0x23, 0xc3, 0xe6, 0x54, 0x63, 0x03,
+	0xae, 0x73, 0x5d, 0x28, 0x0c, 0x66, 0x00, 0x75, 0xc9, 0x64, 0x74, 0x31, 0xd9, 0x2c, 0xdf, 0xfd,
+	0xdc, 0x94, 0xca, 0xba, 0x69, 0xeb, 0x87, 0x46, 0xe6, 0x60, 0x9e, 0x7f, 0x9b, 0x5c, 0x1e, 0xd5,
+	0xa8, 0xce, 0x1d, 0xbd, 0xa3, 0xa8, 0x14, 0x73, 0xe3, 0xfe, 0x63, 0x71, 0x2d, 0x1f, 0xf4, 0xe2,
+	0xf1, 0xeb, 0x6d, 0x00, 0xed, 0xa1, 0x3b, 0x70, 0xac, 0x02, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// GuestAgentClient is the client API for GuestAgent service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type GuestAgentClient interface {
+	Health(ctx context.Context, in *HealthReq, opts ...grpc.CallOption) (*HealthResp, error)
+	Shutdown(ctx context.Context, in *ShutdownReq, opts ...grpc.CallOption) (*ShutdownResp, error)
+	StreamLogs(ctx context.Context, in *StreamLogsReq, opts ...grpc.CallOption) (GuestAgent_StreamLogsClient, error)
+	SyncClock(ctx context.Context, in *SyncClockReq, opts ...grpc.CallOption) (*SyncClockResp, error)
+}
+
+type guestAgentClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGuestAgentClient(cc grpc.ClientConnInterface) GuestAgentClient {
+	return &guestAgentClient{cc}
+}
+
+func (c *guestAgentClient) Health(ctx context.Context, in *HealthReq, opts ...grpc.CallOption) (*HealthResp, error) {
+	out := new(HealthResp)
+	err := c.cc.Invoke(ctx, "/guestagent.GuestAgent/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestAgentClient) Shutdown(ctx context.Context, in *ShutdownReq, opts ...grpc.CallOption) (*ShutdownResp, error) {
+	out := new(ShutdownResp)
+	err := c.cc.Invoke(ctx, "/guestagent.GuestAgent/Shutdown", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestAgentClient) StreamLogs(ctx context.Context, in *StreamLogsReq, opts ...grpc.CallOption) (GuestAgent_StreamLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GuestAgent_serviceDesc.Streams[0], "/guestagent.GuestAgent/StreamLogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &guestAgentStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GuestAgent_StreamLogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type guestAgentStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *guestAgentStreamLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *guestAgentClient) SyncClock(ctx context.Context, in *SyncClockReq, opts ...grpc.CallOption) (*SyncClockResp, error) {
+	out := new(SyncClockResp)
+	err := c.cc.Invoke(ctx, "/guestagent.GuestAgent/SyncClock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GuestAgentServer is the server API for GuestAgent service.
+type GuestAgentServer interface {
+	Health(context.Context, *HealthReq) (*HealthResp, error)
+	Shutdown(context.Context, *ShutdownReq) (*ShutdownResp, error)
+	StreamLogs(*StreamLogsReq, GuestAgent_StreamLogsServer) error
+	SyncClock(context.Context, *SyncClockReq) (*SyncClockResp, error)
+}
+
+// UnimplementedGuestAgentServer can be embedded to have forward compatible implementations.
+type UnimplementedGuestAgentServer struct {
+}
+
+func (*UnimplementedGuestAgentServer) Health(ctx context.Context, req *HealthReq) (*HealthResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (*UnimplementedGuestAgentServer) Shutdown(ctx context.Context, req *ShutdownReq) (*ShutdownResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Shutdown not implemented")
+}
+func (*UnimplementedGuestAgentServer) StreamLogs(req *StreamLogsReq, srv GuestAgent_StreamLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+func (*UnimplementedGuestAgentServer) SyncClock(ctx context.Context, req *SyncClockReq) (*SyncClockResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SyncClock not implemented")
+}
+
+func RegisterGuestAgentServer(s *grpc.Server, srv GuestAgentServer) {
+	s.RegisterService(&_GuestAgent_serviceDesc, srv)
+}
+
+func _GuestAgent_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestAgentServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/guestagent.GuestAgent/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestAgentServer).Health(ctx, req.(*HealthReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestAgent_Shutdown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShutdownReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestAgentServer).Shutdown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/guestagent.GuestAgent/Shutdown",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestAgentServer).Shutdown(ctx, req.(*ShutdownReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestAgent_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GuestAgentServer).StreamLogs(m, &guestAgentStreamLogsServer{stream})
+}
+
+type GuestAgent_StreamLogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type guestAgentStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *guestAgentStreamLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GuestAgent_SyncClock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncClockReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestAgentServer).SyncClock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/guestagent.GuestAgent/SyncClock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestAgentServer).SyncClock(ctx, req.(*SyncClockReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _GuestAgent_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "guestagent.GuestAgent",
+	HandlerType: (*GuestAgentServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Health",
+			Handler:    _GuestAgent_Health_Handler,
+		},
+		{
+			MethodName: "Shutdown",
+			Handler:    _GuestAgent_Shutdown_Handler,
+		},
+		{
+			MethodName: "SyncClock",
+			Handler:    _GuestAgent_SyncClock_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _GuestAgent_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "agent.proto",
+}
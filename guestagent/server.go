@@ -0,0 +1,173 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package guestagent
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/ease-lab/vhive/guestagent/proto"
+)
+
+// maxLogHistory is the number of log lines the agent keeps for new subscribers
+const maxLogHistory = 1000
+
+// Server is a reference implementation of the agent that runs inside the guest
+type Server struct {
+	pb.UnimplementedGuestAgentServer
+
+	sync.Mutex
+	onShutdown  func(timeout time.Duration)
+	setClock    func(t time.Time) error
+	history     []*pb.LogLine
+	subscribers map[chan *pb.LogLine]struct{}
+}
+
+// ServerOption Options to pass to NewServer
+type ServerOption func(*Server)
+
+// WithClockSetter Sets the function setting the clock of the guest upon
+// a clock sync request, which is the system clock by default
+func WithClockSetter(setClock func(t time.Time) error) ServerOption {
+	return func(s *Server) {
+		s.setClock = setClock
+	}
+}
+
+// NewServer Creates a guest agent that calls onShutdown upon a shutdown request
+func NewServer(onShutdown func(timeout time.Duration), opts ...ServerOption) *Server {
+	s := &Server{
+		onShutdown:  onShutdown,
+		setClock:    setSystemClock,
+		subscribers: make(map[chan *pb.LogLine]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// setSystemClock sets the wall clock of the guest, which requires CAP_SYS_TIME
+func setSystemClock(t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	return syscall.Settimeofday(&tv)
+}
+
+// Register Registers the guest agent service with the gRPC server
+func (s *Server) Register(server *grpc.Server) {
+	pb.RegisterGuestAgentServer(server, s)
+}
+
+// Log Publishes a log line of the given stream (e.g., stdout) to the host
+func (s *Server) Log(stream string, line []byte) {
+	l := &pb.LogLine{TimestampNs: time.Now().UnixNano(), Stream: stream, Line: line}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.history = append(s.history, l)
+	if len(s.history) > maxLogHistory {
+		s.history = s.history[len(s.history)-maxLogHistory:]
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub <- l:
+		default:
+			// Drop the line for subscribers that do not keep up
+		}
+	}
+}
+
+// Health Reports that the agent is serving
+func (s *Server) Health(ctx context.Context, req *pb.HealthReq) (*pb.HealthResp, error) {
+	return &pb.HealthResp{Serving: true}, nil
+}
+
+// Shutdown Shuts the guest down
+func (s *Server) Shutdown(ctx context.Context, req *pb.ShutdownReq) (*pb.ShutdownResp, error) {
+	if s.onShutdown != nil {
+		go s.onShutdown(time.Duration(req.GetTimeoutSeconds()) * time.Second)
+	}
+
+	return &pb.ShutdownResp{}, nil
+}
+
+// SyncClock Sets the clock of the guest to the wall clock of the host,
+// reporting how far behind the guest clock was
+func (s *Server) SyncClock(ctx context.Context, req *pb.SyncClockReq) (*pb.SyncClockResp, error) {
+	now := time.Unix(0, req.GetUnixNano())
+	skew := now.Sub(time.Now())
+
+	if err := s.setClock(now); err != nil {
+		return nil, err
+	}
+
+	return &pb.SyncClockResp{SkewNs: int64(skew)}, nil
+}
+
+// StreamLogs Streams the log history and, if asked to follow, the new lines
+func (s *Server) StreamLogs(req *pb.StreamLogsReq, stream pb.GuestAgent_StreamLogsServer) error {
+	sub := make(chan *pb.LogLine, maxLogHistory)
+
+	s.Lock()
+	history := make([]*pb.LogLine, len(s.history))
+	copy(history, s.history)
+	if req.GetFollow() {
+		s.subscribers[sub] = struct{}{}
+	}
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.subscribers, sub)
+		s.Unlock()
+	}()
+
+	for _, l := range history {
+		if err := stream.Send(l); err != nil {
+			return err
+		}
+	}
+
+	if !req.GetFollow() {
+		return nil
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case l := <-sub:
+			if err := stream.Send(l); err != nil {
+				return err
+			}
+		}
+	}
+}
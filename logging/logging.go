@@ -0,0 +1,204 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package logging holds the loggers of the components of vHive, whose levels
+// are set independently so that debugging one component does not flood the
+// node with the logs of the others
+package logging
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The components of vHive with their own logger
+const (
+	// CRI is the passthrough of the CRI requests to the stock containerd
+	CRI = "cri"
+	// Coordinator manages the lifecycle of the VMs of the functions
+	Coordinator = "coordinator"
+	// Network manages the taps and the CNI networks of the VMs
+	Network = "network"
+	// Snapshots creates, loads, stores and prefetches the VM snapshots
+	Snapshots = "snapshots"
+	// MemoryManager serves the page faults of the VMs loaded from snapshots
+	MemoryManager = "memory-manager"
+)
+
+var (
+	mu sync.Mutex
+	// defaultLevel is the level of the components without a level of their own
+	defaultLevel = log.InfoLevel
+	loggers      = map[string]*log.Logger{}
+)
+
+func init() {
+	for _, component := range []string{CRI, Coordinator, Network, Snapshots, MemoryManager} {
+		loggers[component] = log.New()
+	}
+}
+
+// Components returns the names of the components, sorted
+func Components() []string {
+	components := make([]string, 0, len(loggers))
+	for component := range loggers {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	return components
+}
+
+// Setup sets the output, the format and the level of the standard logger and
+// of the loggers of all the components
+func Setup(out io.Writer, formatter log.Formatter, level log.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultLevel = level
+	for _, l := range append([]*log.Logger{log.StandardLogger()}, values()...) {
+		l.SetOutput(out)
+		l.SetFormatter(formatter)
+		l.SetLevel(level)
+	}
+}
+
+func values() []*log.Logger {
+	ls := make([]*log.Logger, 0, len(loggers))
+	for _, l := range loggers {
+		ls = append(ls, l)
+	}
+
+	return ls
+}
+
+// Logger returns the entry logging for a component, with the component as a field.
+// It panics if the component is unknown.
+func Logger(component string) *log.Entry {
+	l, ok := loggers[component]
+	if !ok {
+		panic("unknown logging component " + component)
+	}
+
+	return log.NewEntry(l).WithField("component", component)
+}
+
+// ParseLevel parses the level of a component
+func ParseLevel(component, level string) (log.Level, error) {
+	if _, ok := loggers[component]; !ok {
+		return 0, errors.Errorf("unknown logging component %q", component)
+	}
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid log level of %s", component)
+	}
+
+	return lvl, nil
+}
+
+// ParseLevels parses the levels of the components, by component
+func ParseLevels(levels map[string]string) (map[string]log.Level, error) {
+	parsed := make(map[string]log.Level, len(levels))
+	for component, level := range levels {
+		lvl, err := ParseLevel(component, level)
+		if err != nil {
+			return nil, err
+		}
+		parsed[component] = lvl
+	}
+
+	return parsed, nil
+}
+
+// SetLevel changes the level of a component at runtime
+func SetLevel(component string, level log.Level) error {
+	l, ok := loggers[component]
+	if !ok {
+		return errors.Errorf("unknown logging component %q", component)
+	}
+
+	l.SetLevel(level)
+
+	return nil
+}
+
+// ResetLevels sets the levels of the components to the given ones, and the
+// levels of the other components to the level passed to Setup
+func ResetLevels(levels map[string]log.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for component, l := range loggers {
+		if level, ok := levels[component]; ok {
+			l.SetLevel(level)
+		} else {
+			l.SetLevel(defaultLevel)
+		}
+	}
+}
+
+// Levels returns the current levels of the components, by component
+func Levels() map[string]log.Level {
+	levels := make(map[string]log.Level, len(loggers))
+	for component, l := range loggers {
+		levels[component] = l.GetLevel()
+	}
+
+	return levels
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying the fields of its parent and the
+// given ones, added to the entries of the loggers taken from it
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	merged := make(log.Fields, len(fields))
+	for k, v := range Fields(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields returns the fields carried by a context
+func Fields(ctx context.Context) log.Fields {
+	if fields, ok := ctx.Value(fieldsKey{}).(log.Fields); ok {
+		return fields
+	}
+
+	return log.Fields{}
+}
+
+// FromContext returns the entry logging for a component with the fields
+// carried by the context
+func FromContext(ctx context.Context, component string) *log.Entry {
+	return Logger(component).WithFields(Fields(ctx))
+}
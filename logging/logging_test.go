@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs records the entries of a component until the end of the test
+func captureLogs(t *testing.T, component string) *test.Hook {
+	l := Logger(component).Logger
+	hook := test.NewLocal(l)
+	old := l.ReplaceHooks(log.LevelHooks{})
+	l.AddHook(hook)
+
+	t.Cleanup(func() {
+		l.ReplaceHooks(old)
+		ResetLevels(nil)
+	})
+
+	return hook
+}
+
+func TestComponentLevels(t *testing.T) {
+	coordinator := captureLogs(t, Coordinator)
+	cri := captureLogs(t, CRI)
+
+	require.NoError(t, SetLevel(Coordinator, log.DebugLevel), "failed to set the level of the coordinator")
+
+	Logger(Coordinator).Debug("coordinator debug")
+	Logger(CRI).Debug("cri debug")
+	Logger(CRI).Info("cri info")
+
+	require.Len(t, coordinator.AllEntries(), 1, "debug entry of the coordinator was not logged")
+	require.Equal(t, Coordinator, coordinator.LastEntry().Data["component"], "entry does not carry its component")
+	require.Len(t, cri.AllEntries(), 1, "debug entry of the CRI was logged at the info level")
+	require.Equal(t, "cri info", cri.LastEntry().Message)
+
+	levels := Levels()
+	require.Equal(t, log.DebugLevel, levels[Coordinator], "level of the coordinator was not changed")
+	require.Equal(t, log.InfoLevel, levels[CRI], "level of the CRI was changed")
+
+	// Lowering the level at runtime silences the component again
+	require.NoError(t, SetLevel(Coordinator, log.WarnLevel), "failed to set the level of the coordinator")
+	Logger(Coordinator).Info("coordinator info")
+	require.Len(t, coordinator.AllEntries(), 1, "info entry of the coordinator was logged at the warn level")
+
+	require.Error(t, SetLevel("scheduler", log.DebugLevel), "level of an unknown component was set")
+}
+
+func TestResetLevels(t *testing.T) {
+	captureLogs(t, Network)
+
+	require.NoError(t, SetLevel(Network, log.TraceLevel), "failed to set the level of the network")
+	require.NoError(t, SetLevel(Snapshots, log.ErrorLevel), "failed to set the level of the snapshots")
+
+	ResetLevels(map[string]log.Level{Snapshots: log.DebugLevel})
+
+	levels := Levels()
+	require.Equal(t, log.InfoLevel, levels[Network], "level of the network was not reset to the default one")
+	require.Equal(t, log.DebugLevel, levels[Snapshots], "level of the snapshots was not set")
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels(map[string]string{MemoryManager: "debug", CRI: "warn"})
+	require.NoError(t, err, "failed to parse valid levels")
+	require.Equal(t, map[string]log.Level{MemoryManager: log.DebugLevel, CRI: log.WarnLevel}, levels)
+
+	_, err = ParseLevels(map[string]string{"scheduler": "debug"})
+	require.Error(t, err, "level of an unknown component was parsed")
+
+	_, err = ParseLevels(map[string]string{CRI: "verbose"})
+	require.Error(t, err, "unknown level was parsed")
+}
+
+func TestContextFields(t *testing.T) {
+	hook := captureLogs(t, Coordinator)
+
+	ctx := WithFields(context.Background(), log.Fields{"sandboxID": "pod", "revision": "rev"})
+	child := WithFields(ctx, log.Fields{"vmID": "1", "revision": "rev-2"})
+
+	FromContext(child, Coordinator).Info("started VM")
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry, "entry was not logged")
+	require.Equal(t, "pod", entry.Data["sandboxID"], "field of the parent context was not propagated")
+	require.Equal(t, "1", entry.Data["vmID"], "field of the context was not added")
+	require.Equal(t, "rev-2", entry.Data["revision"], "field of the context did not override the one of its parent")
+
+	require.NotContains(t, Fields(ctx), "vmID", "field of the child context leaked into its parent")
+	require.Empty(t, Fields(context.Background()), "context without fields has fields")
+}
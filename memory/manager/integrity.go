@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+const (
+	// workingSetMagic identifies the working set files with an integrity header
+	workingSetMagic   = "VHWS"
+	workingSetVersion = 1
+	// corruptSuffix is appended to the name of a corrupt file set aside
+	corruptSuffix = ".corrupt"
+)
+
+// ErrWorkingSetCorrupt is returned when a working set file is truncated or
+// its pages do not match their checksum, e.g., after a crash mid-write
+var ErrWorkingSetCorrupt = errors.New("working set file is corrupt")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// workingSetHeader is the first page of a working set file, which keeps
+// the pages after it aligned for direct I/O
+type workingSetHeader struct {
+	// length is the size in bytes of the pages after the header
+	length uint64
+	// checksum is the CRC-32C of the pages
+	checksum uint32
+}
+
+func (h workingSetHeader) encode() []byte {
+	buf := make([]byte, os.Getpagesize())
+
+	copy(buf, workingSetMagic)
+	binary.LittleEndian.PutUint32(buf[4:], workingSetVersion)
+	binary.LittleEndian.PutUint64(buf[8:], h.length)
+	binary.LittleEndian.PutUint32(buf[16:], h.checksum)
+
+	return buf
+}
+
+// verifyWorkingSet Checks the pages read from a working set file against its header
+func verifyWorkingSet(header, pages []byte) error {
+	if len(header) < 20 || string(header[:4]) != workingSetMagic {
+		return fmt.Errorf("%w: missing header", ErrWorkingSetCorrupt)
+	}
+
+	if version := binary.LittleEndian.Uint32(header[4:]); version != workingSetVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrWorkingSetCorrupt, version)
+	}
+
+	if length := binary.LittleEndian.Uint64(header[8:]); length != uint64(len(pages)) {
+		return fmt.Errorf("%w: holds %d bytes of pages, %d expected", ErrWorkingSetCorrupt, length, len(pages))
+	}
+
+	if sum := crc32.Checksum(pages, castagnoli); sum != binary.LittleEndian.Uint32(header[16:]) {
+		return fmt.Errorf("%w: checksum mismatch", ErrWorkingSetCorrupt)
+	}
+
+	return nil
+}
+
+// quarantineFile Sets a corrupt file aside, so that it is not loaded again
+// but can still be inspected
+func quarantineFile(path string) (string, error) {
+	corrupt := path + corruptSuffix
+
+	return corrupt, os.Rename(path, corrupt)
+}
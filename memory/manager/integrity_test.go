@@ -0,0 +1,141 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newRecordedState returns the state of a VM whose working set, pages 0, 1
+// and 3 of its guest memory, is recorded and written to its working set file
+func newRecordedState(t *testing.T) (*SnapshotState, []byte) {
+	dir, err := ioutil.TempDir("", "working_set")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	pageSize := os.Getpagesize()
+	guestMem := make([]byte, 4*pageSize)
+	rand.New(rand.NewSource(1)).Read(guestMem)
+
+	cfg := SnapshotStateCfg{
+		VMID:           "1",
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		VMMStatePath:   filepath.Join(dir, "snap_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+	}
+	require.NoError(t, ioutil.WriteFile(cfg.GuestMemPath, guestMem, 0600))
+	require.NoError(t, ioutil.WriteFile(cfg.VMMStatePath, []byte("state"), 0600))
+
+	s := NewSnapshotState(cfg)
+	for _, page := range []int{3, 0, 1} {
+		s.trace.AppendRecord(Record{offset: uint64(page * pageSize)})
+	}
+	s.trace.ProcessRecord(cfg.GuestMemPath, cfg.WorkingSetPath)
+	s.isRecordReady = true
+
+	workingSet := append(append([]byte(nil), guestMem[:2*pageSize]...), guestMem[3*pageSize:]...)
+
+	return s, workingSet
+}
+
+func TestFetchWorkingSet(t *testing.T) {
+	s, workingSet := newRecordedState(t)
+
+	require.NoError(t, s.fetchState(), "failed to fetch working set")
+	require.True(t, bytes.Equal(workingSet, s.workingSet), "working set does not match the guest memory")
+
+	_, err := os.Stat(s.WorkingSetPath + ".tmp")
+	require.True(t, os.IsNotExist(err), "temporary working set file was left behind")
+}
+
+func TestFetchCorruptWorkingSet(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"Truncated", func(data []byte) []byte { return data[:len(data)-100] }},
+		{"TruncatedHeader", func(data []byte) []byte { return data[:10] }},
+		{"BitFlip", func(data []byte) []byte {
+			data[2*pageSize+7] ^= 0x10
+			return data
+		}},
+		{"WrongLength", func(data []byte) []byte {
+			data[8]++
+			return data
+		}},
+		{"NoHeader", func(data []byte) []byte { return data[pageSize:] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newRecordedState(t)
+
+			data, err := ioutil.ReadFile(s.WorkingSetPath)
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(s.WorkingSetPath, tt.corrupt(data), 0600))
+
+			err = s.fetchState()
+			require.True(t, errors.Is(err, ErrWorkingSetCorrupt), "corruption was not detected: %v", err)
+		})
+	}
+}
+
+func TestQuarantineCorruptWorkingSet(t *testing.T) {
+	s, _ := newRecordedState(t)
+
+	m := NewMemoryManager(MemoryManagerCfg{})
+	m.instances[s.VMID] = s
+
+	data, err := ioutil.ReadFile(s.WorkingSetPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(s.WorkingSetPath, data[:len(data)/2], 0600))
+
+	require.NoError(t, m.FetchState(s.VMID), "corrupt working set was not handled")
+	require.Equal(t, uint64(1), m.Corruptions())
+
+	_, err = os.Stat(s.WorkingSetPath)
+	require.True(t, os.IsNotExist(err), "corrupt working set file was not quarantined")
+	quarantined, err := ioutil.ReadFile(s.WorkingSetPath + ".corrupt")
+	require.NoError(t, err, "corrupt working set file was not kept")
+	require.Equal(t, data[:len(data)/2], quarantined)
+
+	// The next activation records the working set again from the full guest memory
+	require.False(t, s.isRecordReady, "working set is not recorded again")
+	require.Empty(t, s.trace.trace, "stale trace was kept")
+	require.Nil(t, s.workingSet)
+
+	// Until it is recorded again, nothing is fetched
+	require.NoError(t, m.FetchState(s.VMID))
+	require.Equal(t, uint64(1), m.Corruptions())
+}
@@ -23,20 +23,26 @@
 package manager
 
 import (
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ease-lab/vhive/metrics"
 	"gonum.org/v1/gonum/stat"
 
+	"github.com/ease-lab/vhive/logging"
 	log "github.com/sirupsen/logrus"
 )
 
+// memLog logs the serving of the page faults of the VMs
+var memLog = logging.Logger(logging.MemoryManager)
+
 const (
 	serveUniqueMetric = "ServeUnique"
 	installWSMetric   = "InstallWS"
@@ -53,11 +59,17 @@ type MemoryManager struct {
 	sync.Mutex
 	MemoryManagerCfg
 	instances map[string]*SnapshotState // Indexed by vmID
+	// corruptions counts the corrupt working set files quarantined
+	corruptions uint64
+	// prefetchedPages counts the pages installed from the working set files
+	// on the loads of the VMs, and missedPages the pages faulted outside them
+	prefetchedPages uint64
+	missedPages     uint64
 }
 
 // NewMemoryManager Initializes a new memory manager
 func NewMemoryManager(cfg MemoryManagerCfg) *MemoryManager {
-	log.Debug("Initializing the memory manager")
+	memLog.Debug("Initializing the memory manager")
 
 	m := new(MemoryManager)
 	m.instances = make(map[string]*SnapshotState)
@@ -73,7 +85,7 @@ func (m *MemoryManager) RegisterVM(cfg SnapshotStateCfg) error {
 
 	vmID := cfg.VMID
 
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Registering the VM with the memory manager")
 
@@ -95,7 +107,7 @@ func (m *MemoryManager) DeregisterVM(vmID string) error {
 	m.Lock()
 	defer m.Unlock()
 
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Deregistering VM from the memory manager")
 
@@ -117,7 +129,7 @@ func (m *MemoryManager) DeregisterVM(vmID string) error {
 
 // Activate Creates an epoller to serve page faults for the VM
 func (m *MemoryManager) Activate(vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Activating instance in the memory manager")
 
@@ -161,9 +173,44 @@ func (m *MemoryManager) Activate(vmID string) error {
 	return nil
 }
 
+// WaitWorkingSet Waits until the working set of the VM is installed in its guest
+// memory, on its first page fault after its activation. Returns the number of
+// pages installed, none if the VM records its working set or serves it lazily.
+func (m *MemoryManager) WaitWorkingSet(ctx context.Context, vmID string) (int, error) {
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
+
+	logger.Debug("Waiting for the working set to be installed")
+
+	m.Lock()
+	state, ok := m.instances[vmID]
+	m.Unlock()
+
+	if !ok {
+		logger.Error("VM not registered with the memory manager")
+		return 0, errors.New("VM not registered with the memory manager")
+	}
+
+	if !state.isActive {
+		logger.Error("VM not activated")
+		return 0, errors.New("VM not activated")
+	}
+
+	select {
+	case <-state.wsInstalled:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	if !state.isRecordReady || state.IsLazyMode {
+		return 0, nil
+	}
+
+	return len(state.trace.trace), nil
+}
+
 // FetchState Fetches the working set file (or the whole guest memory) and the VMM state file
 func (m *MemoryManager) FetchState(vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Activating instance in the memory manager")
 
@@ -184,6 +231,10 @@ func (m *MemoryManager) FetchState(vmID string) error {
 
 	m.Unlock()
 
+	if state.isTraceShared && !state.isRecordReady {
+		state.prepareReplay()
+	}
+
 	if state.isRecordReady && !state.IsLazyMode {
 		if state.metricsModeOn {
 			tStart = time.Now()
@@ -194,12 +245,44 @@ func (m *MemoryManager) FetchState(vmID string) error {
 		}
 	}
 
+	if errors.Is(err, ErrWorkingSetCorrupt) {
+		// The VM is restored from the full guest memory instead, which records the working set again
+		logger.WithError(err).Warn("Quarantining the working set file, recording it again")
+		m.quarantineWorkingSet(state)
+		err = nil
+	}
+
 	return err
 }
 
+// quarantineWorkingSet Sets the corrupt working set file of the VM aside
+// and schedules recording it again on the next activation
+func (m *MemoryManager) quarantineWorkingSet(state *SnapshotState) {
+	atomic.AddUint64(&m.corruptions, 1)
+
+	if corrupt, err := quarantineFile(state.WorkingSetPath); err != nil {
+		memLog.WithFields(log.Fields{"vmID": state.VMID}).WithError(err).Error("Failed to quarantine the working set file")
+	} else {
+		memLog.WithFields(log.Fields{"vmID": state.VMID, "file": corrupt}).Debug("Quarantined the working set file")
+	}
+
+	state.resetRecord()
+}
+
+// Corruptions Returns the number of corrupt working set files found on load
+func (m *MemoryManager) Corruptions() uint64 {
+	return atomic.LoadUint64(&m.corruptions)
+}
+
+// PrefetchStats Returns the number of pages prefetched from the working set
+// files on the loads of the VMs, and the number of pages missing from them
+func (m *MemoryManager) PrefetchStats() (prefetched, missed uint64) {
+	return atomic.LoadUint64(&m.prefetchedPages), atomic.LoadUint64(&m.missedPages)
+}
+
 // Deactivate Removes the epoller which serves page faults for the VM
 func (m *MemoryManager) Deactivate(vmID string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Deactivating instance from the memory manager")
 
@@ -236,16 +319,34 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 	state.processMetrics()
 
 	state.userFaultFD.Close()
-	if !state.isRecordReady && !state.IsLazyMode {
-		state.trace.ProcessRecord(state.GuestMemPath, state.WorkingSetPath)
-	}
-
-	state.isRecordReady = true
+	m.finishActivation(state)
 	state.isActive = false
 
 	return nil
 }
 
+// finishActivation Prepares the replay of the working set recorded by the VM,
+// sharing its trace with the other VMs of the function if configured, or
+// accounts for the pages prefetched and missed by the replay
+func (m *MemoryManager) finishActivation(state *SnapshotState) {
+	switch {
+	case !state.isRecordReady:
+		if !state.IsLazyMode {
+			state.trace.ProcessRecord(state.GuestMemPath, state.WorkingSetPath)
+		}
+		if state.TracePath != "" {
+			if err := state.trace.WriteTrace(); err != nil {
+				memLog.WithFields(log.Fields{"vmID": state.VMID}).WithError(err).Error("Failed to write the shared trace")
+			}
+		}
+	case !state.IsLazyMode:
+		atomic.AddUint64(&m.prefetchedPages, uint64(len(state.trace.trace)))
+		atomic.AddUint64(&m.missedPages, uint64(state.missedNum))
+	}
+
+	state.isRecordReady = true
+}
+
 // DumpUPFPageStats Saves the per VM stats
 func (m *MemoryManager) DumpUPFPageStats(vmID, functionName, metricsOutFilePath string) error {
 	var (
@@ -253,7 +354,7 @@ func (m *MemoryManager) DumpUPFPageStats(vmID, functionName, metricsOutFilePath
 		stats      []string
 	)
 
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Dumping stats about number of page faults")
 
@@ -288,7 +389,7 @@ func (m *MemoryManager) DumpUPFPageStats(vmID, functionName, metricsOutFilePath
 
 // DumpUPFLatencyStats Dumps latency stats collected for the VM
 func (m *MemoryManager) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePath string) error {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Dumping stats about latency of UPFs")
 
@@ -318,7 +419,7 @@ func (m *MemoryManager) DumpUPFLatencyStats(vmID, functionName, latencyOutFilePa
 
 // GetUPFLatencyStats Returns the gathered metrics for the VM
 func (m *MemoryManager) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, error) {
-	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger := memLog.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("returning stats about latency of UPFs")
 
@@ -400,7 +501,7 @@ func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string,
 func writeUPFPageStats(metricsOutFilePath string, statHeader, stats []string) error {
 	csvFile, err := os.OpenFile(metricsOutFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Error("Failed to create csv file for writing stats")
+		memLog.Error("Failed to create csv file for writing stats")
 		return err
 	}
 	defer csvFile.Close()
@@ -410,19 +511,19 @@ func writeUPFPageStats(metricsOutFilePath string, statHeader, stats []string) er
 
 	fileInfo, err := csvFile.Stat()
 	if err != nil {
-		log.Errorf("Failed to stat csv file: %v", err)
+		memLog.Errorf("Failed to stat csv file: %v", err)
 		return err
 	}
 
 	if fileInfo.Size() == 0 {
 		if err := writer.Write(statHeader); err != nil {
-			log.Errorf("Failed to write header to csv file: %v", err)
+			memLog.Errorf("Failed to write header to csv file: %v", err)
 			return err
 		}
 	}
 
 	if err := writer.Write(stats); err != nil {
-		log.Errorf("Failed to write to csv file: %v ", err)
+		memLog.Errorf("Failed to write to csv file: %v ", err)
 		return err
 	}
 
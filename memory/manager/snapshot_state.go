@@ -32,6 +32,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -59,6 +60,7 @@ type SnapshotStateCfg struct {
 	InstanceSockAddr string
 	BaseDir          string // base directory for the instance
 	MetricsPath      string // path to csv file where the metrics should be stored
+	TracePath        string // path to the trace shared by the VMs of the function, not shared if empty
 	IsLazyMode       bool
 	GuestMemSize     int
 	metricsModeOn    bool
@@ -82,6 +84,11 @@ type SnapshotState struct {
 	isActive bool
 
 	isRecordReady bool
+	// isTraceShared is set if the trace was recorded by another VM of the function
+	isTraceShared bool
+	// wsInstalled is closed once the working set is installed in the guest
+	// memory after the activation, at once if there is none to install
+	wsInstalled chan struct{}
 
 	guestMem   []byte
 	workingSet []byte
@@ -95,6 +102,9 @@ type SnapshotState struct {
 	replayedNum   int // only valid for lazy serving
 	uniqueNum     int
 	currentMetric *metrics.Metric
+	// missedNum counts the pages faulted outside the working set since the
+	// activation, regardless of the metrics mode
+	missedNum int
 }
 
 // NewSnapshotState Initializes a snapshot state
@@ -103,6 +113,9 @@ func NewSnapshotState(cfg SnapshotStateCfg) *SnapshotState {
 	s.SnapshotStateCfg = cfg
 
 	s.trace = initTrace(s.getTraceFile())
+	if s.TracePath != "" {
+		s.loadSharedTrace()
+	}
 	if s.metricsModeOn {
 		s.totalPFServed = make([]float64, 0)
 		s.uniquePFServed = make([]float64, 0)
@@ -118,6 +131,11 @@ func (s *SnapshotState) setupStateOnActivate() {
 	s.isEverActivated = true
 	s.firstPageFaultOnce = new(sync.Once)
 	s.quitCh = make(chan int)
+	s.missedNum = 0
+	s.wsInstalled = make(chan struct{})
+	if !s.isRecordReady || s.IsLazyMode {
+		close(s.wsInstalled)
+	}
 
 	if s.metricsModeOn {
 		s.uniqueNum = 0
@@ -135,7 +153,7 @@ func (s *SnapshotState) getUFFD() error {
 		c, err := d.DialContext(ctx, "unix", s.InstanceSockAddr)
 		if err != nil {
 			if ctx.Err() != nil {
-				log.Error("Failed to dial within the context timeout")
+				memLog.Error("Failed to dial within the context timeout")
 				return err
 			}
 			time.Sleep(1 * time.Millisecond)
@@ -148,7 +166,7 @@ func (s *SnapshotState) getUFFD() error {
 
 		fs, err := fd.Get(sendfdConn, 1, []string{"a file"})
 		if err != nil {
-			log.Error("Failed to receive the uffd")
+			memLog.Error("Failed to receive the uffd")
 			return err
 		}
 
@@ -175,19 +193,54 @@ func (s *SnapshotState) processMetrics() {
 }
 
 func (s *SnapshotState) getTraceFile() string {
+	if s.TracePath != "" {
+		return s.TracePath
+	}
+
 	return filepath.Join(s.BaseDir, "trace")
 }
 
+// loadSharedTrace Loads the trace recorded by another VM of the function, if
+// any, so that the VM prefetches its working set from its first load
+func (s *SnapshotState) loadSharedTrace() {
+	trace := initTrace(s.TracePath)
+	if err := trace.readTrace(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			memLog.WithFields(log.Fields{"vmID": s.VMID}).WithError(err).Warn("Failed to read the shared trace, recording it again")
+		}
+		return
+	}
+
+	if len(trace.trace) == 0 {
+		return
+	}
+
+	s.trace = trace
+	s.isTraceShared = true
+}
+
+// prepareReplay Writes the working set file of the VM from its guest memory
+// and the shared trace, so that its first load replays the trace
+func (s *SnapshotState) prepareReplay() {
+	memLog.WithFields(log.Fields{"vmID": s.VMID}).Debug("Preparing the replay of the shared trace")
+
+	if !s.IsLazyMode {
+		s.trace.ProcessRecord(s.GuestMemPath, s.WorkingSetPath)
+	}
+
+	s.isRecordReady = true
+}
+
 func (s *SnapshotState) mapGuestMemory() error {
 	fd, err := os.OpenFile(s.GuestMemPath, os.O_RDONLY, 0444)
 	if err != nil {
-		log.Errorf("Failed to open guest memory file: %v", err)
+		memLog.Errorf("Failed to open guest memory file: %v", err)
 		return err
 	}
 
 	s.guestMem, err = unix.Mmap(int(fd.Fd()), 0, s.GuestMemSize, unix.PROT_READ, unix.MAP_PRIVATE)
 	if err != nil {
-		log.Errorf("Failed to mmap guest memory file: %v", err)
+		memLog.Errorf("Failed to mmap guest memory file: %v", err)
 		return err
 	}
 
@@ -196,7 +249,7 @@ func (s *SnapshotState) mapGuestMemory() error {
 
 func (s *SnapshotState) unmapGuestMemory() error {
 	if err := unix.Munmap(s.guestMem); err != nil {
-		log.Errorf("Failed to munmap guest memory file: %v", err)
+		memLog.Errorf("Failed to munmap guest memory file: %v", err)
 		return err
 	}
 
@@ -233,7 +286,7 @@ func AlignedBlock(blockSize int) []byte {
 	if blockSize != 0 {
 		a = alignment(block, alignSize)
 		if a != 0 {
-			log.Fatal("Failed to align block")
+			memLog.Fatal("Failed to align block")
 		}
 	}
 	return block
@@ -242,37 +295,54 @@ func AlignedBlock(blockSize int) []byte {
 // fetchState Fetches the working set file (or the whole guest memory) and the VMM state file
 func (s *SnapshotState) fetchState() error {
 	if _, err := ioutil.ReadFile(s.VMMStatePath); err != nil {
-		log.Errorf("Failed to fetch VMM state: %v\n", err)
+		memLog.Errorf("Failed to fetch VMM state: %v\n", err)
 		return err
 	}
 
 	size := len(s.trace.trace) * os.Getpagesize()
+	headerSize := os.Getpagesize()
 
 	// O_DIRECT allows to fully leverage disk bandwidth by bypassing the OS page cache
 	f, err := os.OpenFile(s.WorkingSetPath, os.O_RDONLY|syscall.O_DIRECT, 0600)
 	if err != nil {
-		log.Errorf("Failed to open the working set file for direct-io: %v\n", err)
+		memLog.Errorf("Failed to open the working set file for direct-io: %v\n", err)
 		return err
 	}
+	defer f.Close()
 
-	s.workingSet = AlignedBlock(size) // direct io requires aligned buffer
+	block := AlignedBlock(headerSize + size) // direct io requires aligned buffer
 
-	if n, err := f.Read(s.workingSet); n != size || err != nil {
-		log.Errorf("Reading working set file failed: %v\n", err)
+	n, err := f.Read(block)
+	if err != nil && !errors.Is(err, io.EOF) {
+		memLog.Errorf("Reading working set file failed: %v\n", err)
 		return err
 	}
+	if n != len(block) {
+		return fmt.Errorf("%w: read %d bytes of %d", ErrWorkingSetCorrupt, n, len(block))
+	}
 
-	log.Debug("Fetched the entire working set")
-	if err := f.Close(); err != nil {
-		log.Errorf("Failed to close the working set file: %v\n", err)
+	if err := verifyWorkingSet(block[:headerSize], block[headerSize:]); err != nil {
 		return err
 	}
 
+	s.workingSet = block[headerSize:]
+
+	memLog.Debug("Fetched the entire working set")
+
 	return nil
 }
 
+// resetRecord Drops the working set, so that the next activation serves the
+// whole guest memory and records the working set again
+func (s *SnapshotState) resetRecord() {
+	s.isRecordReady = false
+	s.isTraceShared = false
+	s.trace = initTrace(s.getTraceFile())
+	s.workingSet = nil
+}
+
 func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
-	logger := log.WithFields(log.Fields{"vmID": s.VMID})
+	logger := memLog.WithFields(log.Fields{"vmID": s.VMID})
 
 	var events [1]syscall.EpollEvent
 
@@ -317,19 +387,19 @@ func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
 
 				if nread, err := syscall.Read(fd, goMsg); err != nil || nread != len(goMsg) {
 					if !errors.Is(err, syscall.EBADF) {
-						log.Fatalf("Read uffd_msg failed: %v", err)
+						memLog.Fatalf("Read uffd_msg failed: %v", err)
 					}
 					break
 				}
 
 				if event := uint8(goMsg[0]); event != uffdPageFault() {
-					log.Fatal("Received wrong event type")
+					memLog.Fatal("Received wrong event type")
 				}
 
 				address := binary.LittleEndian.Uint64(goMsg[16:])
 
 				if err := s.servePageFault(fd, address); err != nil {
-					log.Fatalf("Failed to serve page fault")
+					memLog.Fatalf("Failed to serve page fault")
 				}
 			}
 		}
@@ -337,7 +407,7 @@ func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
 }
 
 func (s *SnapshotState) registerEpoller() error {
-	logger := log.WithFields(log.Fields{"vmID": s.VMID})
+	logger := memLog.WithFields(log.Fields{"vmID": s.VMID})
 
 	var (
 		err   error
@@ -387,6 +457,7 @@ func (s *SnapshotState) servePageFault(fd int, address uint64) error {
 				if s.metricsModeOn {
 					s.currentMetric.MetricMap[installWSMetric] = metrics.ToUS(time.Since(tStart))
 				}
+				close(s.wsInstalled)
 
 				workingSetInstalled = true
 			}
@@ -409,7 +480,8 @@ func (s *SnapshotState) servePageFault(fd int, address uint64) error {
 	if !s.isRecordReady {
 		s.trace.AppendRecord(rec)
 	} else {
-		log.Debug("Serving a page that is missing from the working set")
+		memLog.Debug("Serving a page that is missing from the working set")
+		s.missedNum++
 	}
 
 	if s.metricsModeOn {
@@ -438,7 +510,7 @@ func (s *SnapshotState) servePageFault(fd int, address uint64) error {
 }
 
 func (s *SnapshotState) installWorkingSetPages(fd int) {
-	log.Debug("Installing the working set pages")
+	memLog.Debug("Installing the working set pages")
 
 	// build a list of sorted regions
 	keys := make([]uint64, 0)
@@ -459,7 +531,7 @@ func (s *SnapshotState) installWorkingSetPages(fd int) {
 		dst := regAddress
 
 		if err := installRegion(fd, src, dst, mode, uint64(regLength)); err != nil {
-			log.Fatalf("install_region: %v", err)
+			memLog.Fatalf("install_region: %v", err)
 		}
 
 		srcOffset += uint64(regLength) * 4096
@@ -510,7 +582,7 @@ func wake(fd int, startAddress uint64, len int) {
 
 	err := ioctl(uintptr(fd), int(C.const_UFFDIO_WAKE), unsafe.Pointer(&cUR))
 	if err != nil {
-		log.Fatalf("ioctl failed: %v", err)
+		memLog.Fatalf("ioctl failed: %v", err)
 	}
 }
 
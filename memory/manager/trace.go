@@ -24,12 +24,13 @@ package manager
 
 import (
 	"encoding/csv"
+	"hash/crc32"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"sync"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // Record A tuple with an address
@@ -67,61 +68,75 @@ func (t *Trace) AppendRecord(r Record) {
 	t.containedOffsets[r.offset] = 0
 }
 
-// WriteTrace Writes all the records to a file
-func (t *Trace) WriteTrace() {
+// WriteTrace Writes all the records to a file.
+// The records are written to a temporary file, which replaces the trace file
+// once complete, as the VMs sharing the trace file may write it concurrently
+func (t *Trace) WriteTrace() error {
 	t.Lock()
 	defer t.Unlock()
 
-	file, err := os.Create(t.traceFileName)
+	file, err := ioutil.TempFile(filepath.Dir(t.traceFileName), filepath.Base(t.traceFileName)+".tmp")
 	if err != nil {
-		log.Fatalf("Failed to open trace file for writing: %v", err)
+		return err
 	}
+	defer os.Remove(file.Name())
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
 	for _, rec := range t.trace {
-		err := writer.Write([]string{
-			strconv.FormatUint(rec.offset, 16)})
-		if err != nil {
-			log.Fatalf("Failed to write trace: %v", err)
+		if err := writer.Write([]string{strconv.FormatUint(rec.offset, 16)}); err != nil {
+			return err
 		}
 	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), t.traceFileName)
 }
 
 // readTrace Reads all the records from a CSV file
-//nolint:deadcode,unused
-func (t *Trace) readTrace() {
+func (t *Trace) readTrace() error {
 	f, err := os.Open(t.traceFileName)
 	if err != nil {
-		log.Fatalf("Failed to open trace file for reading: %v", err)
+		return err
 	}
 	defer f.Close()
 
 	lines, err := csv.NewReader(f).ReadAll()
 	if err != nil {
-		log.Fatalf("Failed to read from the trace file: %v", err)
+		return err
 	}
 
 	for _, line := range lines {
-		rec := readRecord(line)
+		rec, err := readRecord(line)
+		if err != nil {
+			return err
+		}
 		t.AppendRecord(rec)
 	}
+
+	return nil
 }
 
 // readRecord Parses a record from a line
-//nolint:deadcode,unused
-func readRecord(line []string) Record {
+func readRecord(line []string) (Record, error) {
 	offset, err := strconv.ParseUint(line[0], 16, 64)
 	if err != nil {
-		log.Fatalf("Failed to convert string to offset: %v", err)
+		return Record{}, err
 	}
 
 	rec := Record{
 		offset: offset,
 	}
-	return rec
+	return rec, nil
 }
 
 // Search trace for the record with the same offset
@@ -134,7 +149,7 @@ func (t *Trace) containsRecord(rec Record) bool {
 // ProcessRecord Prepares the trace, the regions map, and the working set file for replay
 // Must be called when record is done (i.e., it is not concurrency-safe vs. AppendRecord)
 func (t *Trace) ProcessRecord(GuestMemPath, WorkingSetPath string) {
-	log.Debug("Preparing replay structures")
+	memLog.Debug("Preparing replay structures")
 
 	// sort trace records in the ascending order by offset
 	sort.Slice(t.trace, func(i, j int) bool {
@@ -158,22 +173,27 @@ func (t *Trace) ProcessRecord(GuestMemPath, WorkingSetPath string) {
 }
 
 func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath string) {
-	log.Debug("Writing the working set pages to a disk")
+	memLog.Debug("Writing the working set pages to a disk")
 
 	fSrc, err := os.Open(guestMemFileName)
 	if err != nil {
-		log.Fatalf("Failed to open guest memory file for reading")
+		memLog.Fatalf("Failed to open guest memory file for reading")
 	}
 	defer fSrc.Close()
-	fDst, err := os.Create(WorkingSetPath)
+	// The pages are written after a header page to a temporary file, which
+	// replaces the working set file once complete, so that a crash mid-write
+	// does not leave a truncated working set file behind
+	tmpPath := WorkingSetPath + ".tmp"
+	fDst, err := os.Create(tmpPath)
 	if err != nil {
-		log.Fatalf("Failed to open ws file for writing")
+		memLog.Fatalf("Failed to open ws file for writing")
 	}
 	defer fDst.Close()
 
 	var (
-		dstOffset int64
+		dstOffset = int64(os.Getpagesize())
 		count     int
+		checksum  uint32
 	)
 
 	// Form a sorted slice of keys to access the map in a predetermined order
@@ -190,19 +210,29 @@ func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath stri
 		buf := make([]byte, copyLen)
 
 		if n, err := fSrc.ReadAt(buf, int64(offset)); n != copyLen || err != nil {
-			log.Fatalf("Read file failed for src")
+			memLog.Fatalf("Read file failed for src")
 		}
 
 		if n, err := fDst.WriteAt(buf, dstOffset); n != copyLen || err != nil {
-			log.Fatalf("Write file failed for dst")
+			memLog.Fatalf("Write file failed for dst")
 		}
 
+		checksum = crc32.Update(checksum, castagnoli, buf)
 		dstOffset += int64(copyLen)
 
 		count += regLength
 	}
 
+	header := workingSetHeader{length: uint64(count * os.Getpagesize()), checksum: checksum}
+	if _, err := fDst.WriteAt(header.encode(), 0); err != nil {
+		memLog.Fatalf("Write header failed for dst")
+	}
+
 	if err := fDst.Sync(); err != nil {
-		log.Fatalf("Sync file failed for dst")
+		memLog.Fatalf("Sync file failed for dst")
+	}
+
+	if err := os.Rename(tmpPath, WorkingSetPath); err != nil {
+		memLog.Fatalf("Rename file failed for dst")
 	}
 }
@@ -0,0 +1,176 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newSharedTraceState returns the state of a VM of 4 pages of random guest
+// memory, sharing the trace in the traceDir with the other VMs of the function
+func newSharedTraceState(t *testing.T, vmID, traceDir string, seed int64) (*SnapshotState, []byte) {
+	dir, err := ioutil.TempDir("", "shared_trace")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	guestMem := make([]byte, 4*os.Getpagesize())
+	rand.New(rand.NewSource(seed)).Read(guestMem)
+
+	cfg := SnapshotStateCfg{
+		VMID:           vmID,
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		VMMStatePath:   filepath.Join(dir, "snap_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		TracePath:      filepath.Join(traceDir, "trace"),
+	}
+	require.NoError(t, ioutil.WriteFile(cfg.GuestMemPath, guestMem, 0600))
+	require.NoError(t, ioutil.WriteFile(cfg.VMMStatePath, []byte("state"), 0600))
+
+	return NewSnapshotState(cfg), guestMem
+}
+
+func TestSharedTrace(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	traceDir, err := ioutil.TempDir("", "trace")
+	require.NoError(t, err)
+	defer os.RemoveAll(traceDir)
+
+	m := NewMemoryManager(MemoryManagerCfg{})
+
+	// The first VM of the function records its page faults on its first load
+	recorder, _ := newSharedTraceState(t, "1", traceDir, 1)
+	require.False(t, recorder.isTraceShared, "trace is shared before it is recorded")
+	m.instances[recorder.VMID] = recorder
+
+	require.NoError(t, m.FetchState(recorder.VMID))
+	require.Nil(t, recorder.workingSet, "working set was fetched before it is recorded")
+
+	for _, page := range []int{3, 0, 1} {
+		recorder.trace.AppendRecord(Record{offset: uint64(page * pageSize)})
+	}
+	m.finishActivation(recorder)
+
+	require.True(t, recorder.isRecordReady)
+	require.FileExists(t, recorder.WorkingSetPath, "working set of the recorder was not written")
+	require.FileExists(t, recorder.TracePath, "trace was not shared")
+
+	// The next VMs of the function prefetch the pages of the trace from their own guest memory
+	replayer, guestMem := newSharedTraceState(t, "2", traceDir, 2)
+	require.True(t, replayer.isTraceShared, "shared trace was not loaded")
+	m.instances[replayer.VMID] = replayer
+
+	require.NoError(t, m.FetchState(replayer.VMID), "failed to fetch the working set")
+	workingSet := append(append([]byte(nil), guestMem[:2*pageSize]...), guestMem[3*pageSize:]...)
+	require.True(t, bytes.Equal(workingSet, replayer.workingSet), "working set does not match the guest memory of the VM")
+
+	replayer.missedNum = 1
+	m.finishActivation(replayer)
+
+	prefetched, missed := m.PrefetchStats()
+	require.EqualValues(t, 3, prefetched)
+	require.EqualValues(t, 1, missed)
+}
+
+func TestSharedTraceInvalid(t *testing.T) {
+	traceDir, err := ioutil.TempDir("", "trace")
+	require.NoError(t, err)
+	defer os.RemoveAll(traceDir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(traceDir, "trace"), []byte("not an offset\n"), 0600))
+
+	s, _ := newSharedTraceState(t, "1", traceDir, 1)
+	require.False(t, s.isTraceShared, "invalid trace was loaded")
+	require.False(t, s.isRecordReady, "working set is not recorded again")
+	require.Empty(t, s.trace.trace)
+}
+
+func TestWaitWorkingSet(t *testing.T) {
+	m := NewMemoryManager(MemoryManagerCfg{})
+
+	t.Run("Replay", func(t *testing.T) {
+		s, _ := newRecordedState(t)
+		s.VMID = "replay"
+		m.instances[s.VMID] = s
+		s.setupStateOnActivate()
+
+		installed := make(chan int)
+		go func() {
+			pages, err := m.WaitWorkingSet(context.Background(), s.VMID)
+			require.NoError(t, err)
+			installed <- pages
+		}()
+
+		select {
+		case <-installed:
+			t.Fatal("wait returned before the working set was installed")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// The first page fault of the VM installs its working set
+		close(s.wsInstalled)
+		require.Equal(t, 3, <-installed, "the whole working set was not installed")
+	})
+
+	t.Run("Record", func(t *testing.T) {
+		s, _ := newSharedTraceState(t, "record", t.TempDir(), 1)
+		m.instances[s.VMID] = s
+		s.setupStateOnActivate()
+
+		pages, err := m.WaitWorkingSet(context.Background(), s.VMID)
+		require.NoError(t, err, "a VM recording its working set waited")
+		require.Zero(t, pages)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		s, _ := newRecordedState(t)
+		s.VMID = "cancelled"
+		m.instances[s.VMID] = s
+		s.setupStateOnActivate()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := m.WaitWorkingSet(ctx, s.VMID)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("NotActive", func(t *testing.T) {
+		s, _ := newRecordedState(t)
+		s.VMID = "inactive"
+		m.instances[s.VMID] = s
+
+		_, err := m.WaitWorkingSet(context.Background(), s.VMID)
+		require.Error(t, err, "wait for an inactive VM succeeded")
+	})
+}
@@ -42,6 +42,11 @@ const (
 
 	// LoadVMM Name of LoadVMM metric
 	LoadVMM = "LoadVMM"
+	// PrefaultMemory Time to pre-fault guest memory before loading a snapshot
+	PrefaultMemory = "PrefaultMemory"
+	// InstallWorkingSet Time waiting for the working set to be installed in
+	// the guest memory of a VM restored with eager REAP
+	InstallWorkingSet = "InstallWorkingSet"
 
 	// AddInstance Time to add instance - load snap or start vm
 	AddInstance = "AddInstance"
@@ -50,6 +55,8 @@ const (
 	// RetireOld Time to offload/stop instance if threshold exceeded
 	RetireOld = "RetireOld"
 
+	// AllocateVM Time to allocate the network of a VM
+	AllocateVM = "AllocateVM"
 	// GetImage Time to pull docker image
 	GetImage = "GetImage"
 	// FcCreateVM Time to create VM
@@ -62,6 +69,22 @@ const (
 	TaskWait = "TaskWait"
 	// TaskStart Time to start task
 	TaskStart = "TaskStart"
+	// CPUBoost Time the CPU quota of a VM was boosted during its cold start
+	CPUBoost = "CPUBoost"
+	// PauseVM Time to pause a VM
+	PauseVM = "PauseVM"
+	// CreateSnapshot Time to create the snapshot of a VM
+	CreateSnapshot = "CreateSnapshot"
+	// OffloadVM Time to offload a VM
+	OffloadVM = "OffloadVM"
+	// StopVM Time to stop a VM
+	StopVM = "StopVM"
+	// SyncClock Time to sync the guest clock of a resumed VM
+	SyncClock = "SyncClock"
+	// BootVM Time to boot a VM once its network and image are ready
+	BootVM = "BootVM"
+	// GuestReady Time for the guest agent of a booted VM to become ready
+	GuestReady = "GuestReady"
 )
 
 // Metric A general metric
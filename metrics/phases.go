@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"time"
+)
+
+// Phase is a step of the boot of a VM measured by a PhaseRecorder
+type Phase uint8
+
+// The phases of the boot of a VM
+const (
+	// PhaseImageResolve gets or pulls the image of the function
+	PhaseImageResolve Phase = iota
+	// PhaseTapSetup creates the tap of the VM and allocates its IP
+	PhaseTapSetup
+	// PhaseDevmapper creates the devmapper device of the rootfs of the VM
+	PhaseDevmapper
+	// PhaseFirecrackerAPI creates the microVM and starts the function in it
+	// through firecracker-containerd
+	PhaseFirecrackerAPI
+	// PhaseGuestReady waits for the guest agent of the VM
+	PhaseGuestReady
+	// PhaseOther is the time spent between the other phases, e.g.,
+	// setting up the jail of the VM
+	PhaseOther
+	// NumPhases is the number of phases
+	NumPhases
+)
+
+var phaseNames = [NumPhases]string{
+	PhaseImageResolve:   "imageResolve",
+	PhaseTapSetup:       "tapSetup",
+	PhaseDevmapper:      "devmapper",
+	PhaseFirecrackerAPI: "firecrackerAPI",
+	PhaseGuestReady:     "guestReady",
+	PhaseOther:          "other",
+}
+
+func (p Phase) String() string {
+	if p >= NumPhases {
+		return "unknown"
+	}
+
+	return phaseNames[p]
+}
+
+// PhaseRecorder Attributes the time of the boot of a VM to its phases. Each
+// mark attributes the time elapsed since the previous mark to a phase, so
+// that the phases sum to the total. The durations are kept in a fixed array
+// and marking does not allocate. A nil PhaseRecorder records nothing.
+// A PhaseRecorder is not safe for concurrent use.
+type PhaseRecorder struct {
+	start     time.Time
+	last      time.Time
+	durations [NumPhases]time.Duration
+}
+
+// NewPhaseRecorder Creates a recorder of a boot started at start
+func NewPhaseRecorder(start time.Time) *PhaseRecorder {
+	return &PhaseRecorder{start: start, last: start}
+}
+
+// Mark Attributes the time elapsed since the previous mark to the phase
+func (r *PhaseRecorder) Mark(p Phase) {
+	r.MarkAt(p, time.Now())
+}
+
+// MarkAt Attributes the time elapsed from the previous mark until now to the phase
+func (r *PhaseRecorder) MarkAt(p Phase, now time.Time) {
+	if r == nil || p >= NumPhases {
+		return
+	}
+
+	if d := now.Sub(r.last); d > 0 {
+		r.durations[p] += d
+		r.last = now
+	}
+}
+
+// Duration Returns the time attributed to the phase
+func (r *PhaseRecorder) Duration(p Phase) time.Duration {
+	if r == nil || p >= NumPhases {
+		return 0
+	}
+
+	return r.durations[p]
+}
+
+// Start Returns when the boot started
+func (r *PhaseRecorder) Start() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+
+	return r.start
+}
+
+// Total Returns the time from the start of the boot to the last mark
+func (r *PhaseRecorder) Total() time.Duration {
+	if r == nil {
+		return 0
+	}
+
+	return r.last.Sub(r.start)
+}
+
+// Milliseconds Returns the time attributed to each phase in milliseconds, by phase name
+func (r *PhaseRecorder) Milliseconds() map[string]float64 {
+	ms := make(map[string]float64, NumPhases)
+	for p := Phase(0); p < NumPhases; p++ {
+		ms[p.String()] = float64(r.Duration(p)) / float64(time.Millisecond)
+	}
+
+	return ms
+}
@@ -0,0 +1,85 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhaseRecorder(t *testing.T) {
+	start := time.Unix(1000, 0)
+	r := NewPhaseRecorder(start)
+
+	r.MarkAt(PhaseOther, start.Add(1*time.Millisecond))
+	r.MarkAt(PhaseTapSetup, start.Add(3*time.Millisecond))
+	r.MarkAt(PhaseImageResolve, start.Add(10*time.Millisecond))
+	r.MarkAt(PhaseFirecrackerAPI, start.Add(40*time.Millisecond))
+	r.MarkAt(PhaseDevmapper, start.Add(45*time.Millisecond))
+	r.MarkAt(PhaseFirecrackerAPI, start.Add(60*time.Millisecond))
+	r.MarkAt(PhaseGuestReady, start.Add(100*time.Millisecond))
+
+	require.Equal(t, start, r.Start())
+	require.Equal(t, 100*time.Millisecond, r.Total())
+	require.Equal(t, 45*time.Millisecond, r.Duration(PhaseFirecrackerAPI), "durations of a phase are not summed")
+
+	var sum time.Duration
+	for p := Phase(0); p < NumPhases; p++ {
+		sum += r.Duration(p)
+	}
+	require.Equal(t, r.Total(), sum, "phases do not sum to the total")
+
+	require.Equal(t, map[string]float64{
+		"imageResolve":   7,
+		"tapSetup":       2,
+		"devmapper":      5,
+		"firecrackerAPI": 45,
+		"guestReady":     40,
+		"other":          1,
+	}, r.Milliseconds())
+
+	// A clock going backwards is not attributed
+	r.MarkAt(PhaseOther, start)
+	require.Equal(t, 1*time.Millisecond, r.Duration(PhaseOther))
+}
+
+func TestPhaseRecorderNil(t *testing.T) {
+	var r *PhaseRecorder
+
+	r.Mark(PhaseOther)
+	require.Zero(t, r.Duration(PhaseOther))
+	require.Zero(t, r.Total())
+	require.Len(t, r.Milliseconds(), int(NumPhases))
+}
+
+func TestPhaseRecorderAllocations(t *testing.T) {
+	r := NewPhaseRecorder(time.Now())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Mark(PhaseFirecrackerAPI)
+		_ = r.Duration(PhaseFirecrackerAPI)
+	})
+	require.Zero(t, allocs, "marking a phase allocates")
+}
@@ -32,3 +32,10 @@ type NonExistErr string
 func (e NonExistErr) Error() string {
 	return fmt.Sprintf("%v does not exist", string(e))
 }
+
+// ExistErr VM, funcClient, etc already exists.
+type ExistErr string
+
+func (e ExistErr) Error() string {
+	return fmt.Sprintf("%v already exists", string(e))
+}
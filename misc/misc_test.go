@@ -32,6 +32,8 @@ import (
 	ctrdlog "github.com/containerd/containerd/log"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ease-lab/vhive/taps"
 )
 
 func TestMain(m *testing.M) {
@@ -146,3 +148,52 @@ func TestRecreateParallel(t *testing.T) {
 
 	vmPool.RemoveBridges()
 }
+
+// fakeTapManager hands out a fresh address for each tap
+type fakeTapManager struct {
+	added map[string]int
+	freed map[string]int
+}
+
+func (m *fakeTapManager) AddTap(tapName, hostIface string) (*taps.NetworkInterface, error) {
+	m.added[tapName]++
+	return &taps.NetworkInterface{HostDevName: tapName, PrimaryAddress: fmt.Sprintf("190.128.0.%d", len(m.added))}, nil
+}
+
+func (m *fakeTapManager) RemoveTap(tapName string) error {
+	return nil
+}
+
+func (m *fakeTapManager) FreeTap(tapName string) error {
+	m.freed[tapName]++
+	return nil
+}
+
+func (m *fakeTapManager) RemoveBridges() {}
+
+func TestResetKeepsNetwork(t *testing.T) {
+	tm := &fakeTapManager{added: make(map[string]int), freed: make(map[string]int)}
+	vmPool := &VMPool{tapManager: tm}
+
+	_, err := vmPool.Reset("test1")
+	require.Error(t, err, "reset a VM that does not exist")
+
+	vm, err := vmPool.Allocate("test1", "")
+	require.NoError(t, err, "Failed to allocate VM")
+	vm.Prefault = true
+
+	fresh, err := vmPool.Reset("test1")
+	require.NoError(t, err, "Failed to reset VM")
+	require.NotSame(t, vm, fresh)
+	require.Same(t, vm.Ni, fresh.Ni, "reset VM must keep its network interface")
+	require.False(t, fresh.Prefault)
+	require.Equal(t, 1, tm.added["test1_tap"])
+	require.Zero(t, tm.freed["test1_tap"])
+
+	got, err := vmPool.GetVM("test1")
+	require.NoError(t, err)
+	require.Same(t, fresh, got)
+
+	require.NoError(t, vmPool.Free("test1"), "Failed to free a VM")
+	require.Equal(t, 1, tm.freed["test1_tap"])
+}
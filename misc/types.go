@@ -36,14 +36,50 @@ type VM struct {
 	Image     *containerd.Image
 	Container *containerd.Container
 	Task      *containerd.Task
-	TaskCh    <-chan containerd.ExitStatus
-	Ni        *taps.NetworkInterface
+	// TaskExited is closed once the task of the VM exited
+	TaskExited <-chan struct{}
+	Ni         *taps.NetworkInterface
+	// Prefault is set if the guest memory should be pre-faulted on snapshot loads
+	Prefault bool
+	// Hugepages is set if the guest memory is backed by hugepages on snapshot loads
+	Hugepages bool
+	// REAP is set if the guest memory is served by user-level page faults on
+	// snapshot loads, whatever the UPF mode of the orchestrator
+	REAP bool
 }
 
 // VMPool Pool of active VMs (can be in several states though)
 type VMPool struct {
 	vmMap      sync.Map
-	tapManager *taps.TapManager
+	tapManager tapManager
+}
+
+// tapManager creates the network interfaces of the VMs
+type tapManager interface {
+	AddTap(tapName, hostIface string) (*taps.NetworkInterface, error)
+	RemoveTap(tapName string) error
+	FreeTap(tapName string) error
+	RemoveBridges()
+}
+
+// addressCounter is implemented by the tap managers that allocate the
+// addresses of the VMs themselves, unlike CNI
+type addressCounter interface {
+	FreeAddresses() int
+}
+
+// tapPreparer is implemented by the tap managers that can create the taps
+// ahead of the VMs, unlike CNI
+type tapPreparer interface {
+	EnablePreparedTaps(size int, hostIface string)
+	AcquirePreparedTap(tapName, hostIface string) (*taps.NetworkInterface, error)
+	PreparedTapStats() taps.PreparedTapStats
+}
+
+// egressEnforcer is implemented by the tap managers that can restrict the
+// traffic of the VMs on their taps, unlike CNI
+type egressEnforcer interface {
+	SetEgressPolicy(tapName string, policy *taps.EgressPolicy) error
 }
 
 // NewVM Initialize a VM
@@ -23,6 +23,8 @@
 package misc
 
 import (
+	"errors"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/ease-lab/vhive/taps"
@@ -36,6 +38,33 @@ func NewVMPool() *VMPool {
 	return p
 }
 
+// NewVMPoolWithSubnets Initializes a pool of VMs with a bridge per subnet
+func NewVMPoolWithSubnets(subnets []taps.SubnetConfig) (*VMPool, error) {
+	tm, err := taps.NewTapManagerWithSubnets(subnets)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(VMPool)
+	p.tapManager = tm
+
+	return p, nil
+}
+
+// NewCNIVMPool Initializes a pool of VMs, each in its own network
+// namespace wired by the given CNI plugin chain
+func NewCNIVMPool(cfg taps.CNIConfig) (*VMPool, error) {
+	cm, err := taps.NewCNIManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(VMPool)
+	p.tapManager = cm
+
+	return p, nil
+}
+
 // Allocate Initializes a VM, activates it and then adds it to VM map
 func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 
@@ -44,13 +73,18 @@ func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 	logger.Debug("Allocating a VM instance")
 
 	if _, isPresent := p.vmMap.Load(vmID); isPresent {
-		logger.Panic("Allocate (VM): VM exists in the map")
+		logger.Error("Allocate (VM): VM exists in the map")
+		return nil, ExistErr("Allocate (VM): VM " + vmID)
 	}
 
 	vm := NewVM(vmID)
 
 	var err error
-	vm.Ni, err = p.tapManager.AddTap(vmID+"_tap", hostIface)
+	if preparer, ok := p.tapManager.(tapPreparer); ok {
+		vm.Ni, err = preparer.AcquirePreparedTap(vmID+"_tap", hostIface)
+	} else {
+		vm.Ni, err = p.tapManager.AddTap(vmID+"_tap", hostIface)
+	}
 	if err != nil {
 		logger.Warn("Ni allocation failed")
 		return nil, err
@@ -73,7 +107,7 @@ func (p *VMPool) Free(vmID string) error {
 		return nil
 	}
 
-	if err := p.tapManager.RemoveTap(vmID + "_tap"); err != nil {
+	if err := p.tapManager.FreeTap(vmID + "_tap"); err != nil {
 		logger.Error("Could not delete tap")
 		return err
 	}
@@ -83,6 +117,29 @@ func (p *VMPool) Free(vmID string) error {
 	return nil
 }
 
+// Reset Replaces a VM in the pool with a fresh one that keeps the network
+// interface of the VM, to boot the VM again in place once it was stopped
+func (p *VMPool) Reset(vmID string) (*VM, error) {
+	old, isPresent := p.vmMap.Load(vmID)
+	if !isPresent {
+		log.WithFields(log.Fields{"vmID": vmID}).Error("Reset (VM): VM does not exist in the map")
+		return nil, NonExistErr("Reset (VM): VM " + vmID)
+	}
+
+	vm := NewVM(vmID)
+	vm.Ni = old.(*VM).Ni
+
+	p.vmMap.Store(vmID, vm)
+
+	return vm, nil
+}
+
+// ReleaseNetwork Removes the network interface of a VM that could not be stopped,
+// e.g., because it crashed, so that the network is not leaked
+func (p *VMPool) ReleaseNetwork(vmID string) error {
+	return p.tapManager.FreeTap(vmID + "_tap")
+}
+
 // RecreateTap Deletes and creates the tap for a VM
 func (p *VMPool) RecreateTap(vmID, hostIface string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
@@ -120,6 +177,12 @@ func (p *VMPool) GetVMMap() map[string]*VM {
 	return m
 }
 
+// HasVM Returns whether the VM is in the pool
+func (p *VMPool) HasVM(vmID string) bool {
+	_, found := p.vmMap.Load(vmID)
+	return found
+}
+
 // GetVM Returns a pointer to the VM
 func (p *VMPool) GetVM(vmID string) (*VM, error) {
 	vm, found := p.vmMap.Load(vmID)
@@ -131,6 +194,51 @@ func (p *VMPool) GetVM(vmID string) (*VM, error) {
 	return vm.(*VM), nil
 }
 
+// FreeAddresses Returns the number of addresses left for new VMs, false if
+// they are allocated by CNI
+func (p *VMPool) FreeAddresses() (int, bool) {
+	counter, ok := p.tapManager.(addressCounter)
+	if !ok {
+		return 0, false
+	}
+
+	return counter.FreeAddresses(), true
+}
+
+// SetEgressPolicy Restricts the traffic the VM sends off the node to the
+// policy, until the VM is freed
+func (p *VMPool) SetEgressPolicy(vmID string, policy *taps.EgressPolicy) error {
+	enforcer, ok := p.tapManager.(egressEnforcer)
+	if !ok {
+		return errors.New("egress policies are not supported with CNI networking")
+	}
+
+	return enforcer.SetEgressPolicy(vmID+"_tap", policy)
+}
+
+// EnablePreparedTaps Keeps size taps created ahead of the VMs, false if
+// the network interfaces are created by CNI
+func (p *VMPool) EnablePreparedTaps(size int, hostIface string) bool {
+	preparer, ok := p.tapManager.(tapPreparer)
+	if !ok {
+		return false
+	}
+
+	preparer.EnablePreparedTaps(size, hostIface)
+
+	return true
+}
+
+// PreparedTapStats Returns the hits and misses of the taps created ahead of the VMs
+func (p *VMPool) PreparedTapStats() taps.PreparedTapStats {
+	preparer, ok := p.tapManager.(tapPreparer)
+	if !ok {
+		return taps.PreparedTapStats{}
+	}
+
+	return preparer.PreparedTapStats()
+}
+
 // RemoveBridges Removes the bridges created by the tap manager
 func (p *VMPool) RemoveBridges() {
 	p.tapManager.RemoveBridges()
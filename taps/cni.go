@@ -0,0 +1,212 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cniAdd = "ADD"
+	cniDel = "DEL"
+)
+
+// cniNetwork is a CNI plugin chain loaded from a .conflist file
+type cniNetwork struct {
+	Name       string
+	CNIVersion string
+	plugins    []map[string]interface{}
+	binDir     string
+}
+
+// cniResult is the part of the CNI result of an ADD that configures the VM
+type cniResult struct {
+	Interfaces []struct {
+		Name    string `json:"name"`
+		Mac     string `json:"mac"`
+		Sandbox string `json:"sandbox"`
+	} `json:"interfaces"`
+	IPs []struct {
+		Version   string `json:"version"`
+		Address   string `json:"address"`
+		Gateway   string `json:"gateway"`
+		Interface *int   `json:"interface"`
+	} `json:"ips"`
+	DNS struct {
+		Nameservers []string `json:"nameservers"`
+	} `json:"dns"`
+}
+
+// cniError is the error printed by a failing CNI plugin
+type cniError struct {
+	Code    uint   `json:"code"`
+	Msg     string `json:"msg"`
+	Details string `json:"details"`
+}
+
+// loadCNINetwork loads the network with the given name from the .conflist
+// files of confDir, or the first one in lexical order if name is empty
+func loadCNINetwork(confDir, binDir, name string) (*cniNetwork, error) {
+	files, err := filepath.Glob(filepath.Join(confDir, "*.conflist"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var conf struct {
+			Name       string                   `json:"name"`
+			CNIVersion string                   `json:"cniVersion"`
+			Plugins    []map[string]interface{} `json:"plugins"`
+		}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file)
+		}
+
+		if name != "" && conf.Name != name {
+			continue
+		}
+
+		if len(conf.Plugins) == 0 {
+			return nil, errors.Errorf("no plugins in %s", file)
+		}
+		for _, plugin := range conf.Plugins {
+			if _, ok := plugin["type"].(string); !ok {
+				return nil, errors.Errorf("plugin without type in %s", file)
+			}
+		}
+
+		return &cniNetwork{
+			Name:       conf.Name,
+			CNIVersion: conf.CNIVersion,
+			plugins:    conf.Plugins,
+			binDir:     binDir,
+		}, nil
+	}
+
+	if name != "" {
+		return nil, errors.Errorf("no CNI network %q in %s", name, confDir)
+	}
+
+	return nil, errors.Errorf("no CNI network in %s", confDir)
+}
+
+// add runs the ADD of the plugins of the chain in order, each getting the
+// result of the previous one, and returns the result of the last plugin.
+// A failed ADD is undone by a DEL, as required by the CNI spec.
+func (n *cniNetwork) add(containerID, netnsPath, ifName string) (*cniResult, []byte, error) {
+	var prevResult []byte
+	for _, plugin := range n.plugins {
+		out, err := n.exec(cniAdd, plugin, prevResult, containerID, netnsPath, ifName)
+		if err != nil {
+			if delErr := n.del(containerID, netnsPath, ifName, prevResult); delErr != nil {
+				err = errors.Wrapf(err, "failed to undo after failure (%v)", delErr)
+			}
+			return nil, nil, err
+		}
+
+		prevResult = out
+	}
+
+	result := new(cniResult)
+	if err := json.Unmarshal(prevResult, result); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse CNI result")
+	}
+
+	return result, prevResult, nil
+}
+
+// del runs the DEL of the plugins of the chain in reverse order. It does
+// not stop on failures, so that every plugin can release its resources,
+// and succeeds even if the network namespace does not exist any more.
+func (n *cniNetwork) del(containerID, netnsPath, ifName string, prevResult []byte) error {
+	if _, err := os.Stat(netnsPath); err != nil {
+		netnsPath = ""
+	}
+
+	var firstErr error
+	for i := len(n.plugins) - 1; i >= 0; i-- {
+		if _, err := n.exec(cniDel, n.plugins[i], prevResult, containerID, netnsPath, ifName); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// exec runs a CNI plugin as specified by the CNI spec
+func (n *cniNetwork) exec(command string, plugin map[string]interface{}, prevResult []byte, containerID, netnsPath, ifName string) ([]byte, error) {
+	pluginType := plugin["type"].(string)
+
+	conf := make(map[string]interface{}, len(plugin)+3)
+	for k, v := range plugin {
+		conf[k] = v
+	}
+	conf["name"] = n.Name
+	conf["cniVersion"] = n.CNIVersion
+	if prevResult != nil {
+		conf["prevResult"] = json.RawMessage(prevResult)
+	}
+
+	stdin, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(filepath.Join(n.binDir, pluginType))
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"CNI_COMMAND="+command,
+		"CNI_CONTAINERID="+containerID,
+		"CNI_NETNS="+netnsPath,
+		"CNI_IFNAME="+ifName,
+		"CNI_PATH="+n.binDir,
+	)
+
+	if err := cmd.Run(); err != nil {
+		var cniErr cniError
+		if jsonErr := json.Unmarshal(stdout.Bytes(), &cniErr); jsonErr == nil && cniErr.Msg != "" {
+			return nil, errors.Errorf("CNI plugin %s %s failed: %s %s", pluginType, command, cniErr.Msg, cniErr.Details)
+		}
+		return nil, errors.Wrapf(err, "CNI plugin %s %s failed: %s", pluginType, command, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,296 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	// cniIfName is the interface created by the CNI plugins in the netns of a VM
+	cniIfName = "eth0"
+	// cniTapName is the tap of a VM, created in its netns
+	cniTapName = "tap0"
+	// netnsDir is where the named network namespaces are mounted
+	netnsDir = "/var/run/netns"
+)
+
+// CNIConfig configures the CNI plugins that wire the network namespaces of the VMs
+type CNIConfig struct {
+	// ConfDir is the directory of the .conflist files
+	ConfDir string
+	// BinDir is the directory of the CNI plugin binaries
+	BinDir string
+	// NetworkName selects the network of ConfDir, the first one if empty
+	NetworkName string
+	// TapGroup is the group of the taps, so that jailed VMs can open them
+	TapGroup uint32
+}
+
+// CNIManager Runs each VM in its own network namespace wired by a CNI plugin chain
+type CNIManager struct {
+	sync.Mutex
+	network  *cniNetwork
+	tapGroup uint32
+	// the CNI results of the attached VMs, passed to their DELs
+	results map[string][]byte
+}
+
+// NewCNIManager Creates a new CNI manager
+func NewCNIManager(cfg CNIConfig) (*CNIManager, error) {
+	network, err := loadCNINetwork(cfg.ConfDir, cfg.BinDir, cfg.NetworkName)
+	if err != nil {
+		return nil, err
+	}
+
+	netLog.Infof("Using CNI network %s", network.Name)
+
+	return &CNIManager{
+		network:  network,
+		tapGroup: cfg.TapGroup,
+		results:  make(map[string][]byte),
+	}, nil
+}
+
+// getNetNSPath returns the path of the network namespace of a tap
+func getNetNSPath(tapName string) string {
+	return filepath.Join(netnsDir, tapName)
+}
+
+// AddTap Creates the network namespace of a tap, wires it with the CNI
+// plugins and creates the tap in it, returning the network interface
+// with the address assigned by the plugins
+func (cm *CNIManager) AddTap(tapName, hostIface string) (_ *NetworkInterface, retErr error) {
+	logger := netLog.WithFields(log.Fields{"tap": tapName, "network": cm.network.Name})
+	logger.Debug("Creating network namespace")
+
+	netnsPath := getNetNSPath(tapName)
+	if out, err := exec.Command("ip", "netns", "add", tapName).CombinedOutput(); err != nil {
+		return nil, errors.Wrapf(err, "failed to create network namespace: %s", out)
+	}
+
+	defer func() {
+		if retErr != nil {
+			if out, err := exec.Command("ip", "netns", "del", tapName).CombinedOutput(); err != nil {
+				logger.WithError(err).Errorf("Network namespace could not be removed after failure: %s", out)
+			}
+		}
+	}()
+
+	result, rawResult, err := cm.network.add(tapName, netnsPath, cniIfName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := cm.network.del(tapName, netnsPath, cniIfName, rawResult); err != nil {
+				logger.WithError(err).Error("CNI network could not be removed after failure")
+			}
+		}
+	}()
+
+	ni, err := getCNINetworkInterface(result)
+	if err != nil {
+		return nil, err
+	}
+	ni.NetNS = netnsPath
+
+	if err := cm.addRedirectedTap(netnsPath); err != nil {
+		return nil, errors.Wrap(err, "failed to create tap")
+	}
+
+	cm.Lock()
+	cm.results[tapName] = rawResult
+	cm.Unlock()
+
+	return ni, nil
+}
+
+// getCNINetworkInterface returns the network interface of the VM from the CNI
+// result. The VM takes the MAC address of the CNI interface, whose traffic is
+// redirected to the tap, so that it is reachable at the address of the interface.
+func getCNINetworkInterface(result *cniResult) (*NetworkInterface, error) {
+	for _, ip := range result.IPs {
+		if ip.Version != "" && ip.Version != "4" {
+			continue
+		}
+
+		addr, ipNet, err := net.ParseCIDR(ip.Address)
+		if err != nil || addr.To4() == nil {
+			continue
+		}
+
+		mac := ""
+		if ip.Interface != nil && *ip.Interface >= 0 && *ip.Interface < len(result.Interfaces) {
+			mac = result.Interfaces[*ip.Interface].Mac
+		} else {
+			for _, iface := range result.Interfaces {
+				if iface.Name == cniIfName && iface.Sandbox != "" {
+					mac = iface.Mac
+				}
+			}
+		}
+		if mac == "" {
+			return nil, errors.New("CNI result has no MAC address for the VM")
+		}
+
+		ones, _ := ipNet.Mask.Size()
+
+		return &NetworkInterface{
+			MacAddress:     mac,
+			HostDevName:    cniTapName,
+			PrimaryAddress: addr.String(),
+			Subnet:         fmt.Sprintf("/%d", ones),
+			GatewayAddress: ip.Gateway,
+		}, nil
+	}
+
+	return nil, errors.New("CNI result has no IPv4 address")
+}
+
+// addRedirectedTap creates the tap in a network namespace
+// and redirects all traffic between the tap and the CNI interface
+func (cm *CNIManager) addRedirectedTap(netnsPath string) error {
+	// The tap is created by ioctls in the network namespace of the thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origNS, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer origNS.Close()
+
+	ns, err := netns.GetFromPath(netnsPath)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+
+	if err := netns.Set(ns); err != nil {
+		return err
+	}
+	defer func() {
+		if err := netns.Set(origNS); err != nil {
+			netLog.WithError(err).Panic("Could not return to the host network namespace")
+		}
+	}()
+
+	la := netlink.NewLinkAttrs()
+	la.Name = cniTapName
+	tap := &netlink.Tuntap{LinkAttrs: la, Mode: netlink.TUNTAP_MODE_TAP, Group: cm.tapGroup}
+	if err := netlink.LinkAdd(tap); err != nil {
+		return err
+	}
+	if err := netlink.LinkSetUp(tap); err != nil {
+		return err
+	}
+
+	iface, err := netlink.LinkByName(cniIfName)
+	if err != nil {
+		return err
+	}
+
+	if err := redirect(iface, tap); err != nil {
+		return err
+	}
+
+	return redirect(tap, iface)
+}
+
+// redirect redirects the ingress traffic of a link to another
+func redirect(from, to netlink.Link) error {
+	qdisc := &netlink.Ingress{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: from.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_INGRESS,
+		},
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil {
+		return err
+	}
+
+	filter := &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: from.Attrs().Index,
+			Parent:    netlink.MakeHandle(0xffff, 0),
+			Protocol:  0x0003, // ETH_P_ALL
+		},
+		Actions: []netlink.Action{netlink.NewMirredAction(to.Attrs().Index)},
+	}
+
+	return netlink.FilterAdd(filter)
+}
+
+// RemoveTap Removes the CNI network and the network namespace of a tap.
+// The CNI DEL is run even if the network namespace is already gone.
+func (cm *CNIManager) RemoveTap(tapName string) error {
+	logger := netLog.WithFields(log.Fields{"tap": tapName, "network": cm.network.Name})
+	logger.Debug("Removing CNI network")
+
+	cm.Lock()
+	rawResult, isPresent := cm.results[tapName]
+	cm.Unlock()
+
+	if !isPresent {
+		logger.Warn("Could not find tap")
+		return nil
+	}
+
+	netnsPath := getNetNSPath(tapName)
+	if err := cm.network.del(tapName, netnsPath, cniIfName, rawResult); err != nil {
+		logger.WithError(err).Error("CNI network could not be removed")
+		return err
+	}
+
+	cm.Lock()
+	delete(cm.results, tapName)
+	cm.Unlock()
+
+	if out, err := exec.Command("ip", "netns", "del", tapName).CombinedOutput(); err != nil {
+		logger.WithError(err).Warnf("Network namespace could not be removed: %s", out)
+	}
+
+	return nil
+}
+
+// FreeTap Removes the CNI network and the network namespace of a tap,
+// the CNI plugins release its address
+func (cm *CNIManager) FreeTap(tapName string) error {
+	return cm.RemoveTap(tapName)
+}
+
+// RemoveBridges Does nothing, as the CNI plugins own the host side of the network
+func (cm *CNIManager) RemoveBridges() {}
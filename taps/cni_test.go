@@ -0,0 +1,194 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePlugin records its invocations in the log file of its directory
+// and prints a result assigning the address of the bridge plugin
+const fakePlugin = `#!/bin/sh
+dir=$(dirname "$0")
+name=$(basename "$0")
+stdin=$(cat)
+echo "$CNI_COMMAND $name $CNI_CONTAINERID $CNI_IFNAME netns=$CNI_NETNS $stdin" >> "$dir/invocations.log"
+if [ -e "$dir/fail-$name" ]; then
+	echo '{"code": 11, "msg": "injected failure"}'
+	exit 1
+fi
+if [ "$CNI_COMMAND" = "ADD" ]; then
+	echo '{"cniVersion": "0.4.0", "interfaces": [{"name": "cni0"}, {"name": "eth0", "mac": "0a:58:0a:01:00:05", "sandbox": "'"$CNI_NETNS"'"}], "ips": [{"version": "4", "address": "10.1.0.5/24", "gateway": "10.1.0.1", "interface": 1}]}'
+fi
+`
+
+const fakeConflist = `{
+	"cniVersion": "0.4.0",
+	"name": "vhive",
+	"plugins": [
+		{"type": "loopback"},
+		{"type": "bridge", "bridge": "cni0"}
+	]
+}`
+
+type invocation struct {
+	command, plugin, containerID, ifName, netns string
+	conf                                        map[string]interface{}
+}
+
+func setupFakeCNI(t *testing.T) (confDir, binDir string) {
+	dir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err, "Failed to create CNI dir")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	confDir = filepath.Join(dir, "net.d")
+	binDir = filepath.Join(dir, "bin")
+	require.NoError(t, os.MkdirAll(confDir, 0755))
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(confDir, "10-vhive.conflist"), []byte(fakeConflist), 0644))
+	for _, plugin := range []string{"loopback", "bridge"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(binDir, plugin), []byte(fakePlugin), 0755))
+	}
+
+	return confDir, binDir
+}
+
+func readInvocations(t *testing.T, binDir string) []invocation {
+	data, err := ioutil.ReadFile(filepath.Join(binDir, "invocations.log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err, "Failed to read invocations")
+
+	var invs []invocation
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.SplitN(line, " ", 6)
+		require.Len(t, fields, 6, "Malformed invocation %q", line)
+
+		inv := invocation{
+			command:     fields[0],
+			plugin:      fields[1],
+			containerID: fields[2],
+			ifName:      fields[3],
+			netns:       strings.TrimPrefix(fields[4], "netns="),
+		}
+		require.NoError(t, json.Unmarshal([]byte(fields[5]), &inv.conf), "Malformed plugin config")
+		invs = append(invs, inv)
+	}
+
+	return invs
+}
+
+func TestLoadCNINetwork(t *testing.T) {
+	confDir, binDir := setupFakeCNI(t)
+
+	n, err := loadCNINetwork(confDir, binDir, "")
+	require.NoError(t, err, "Failed to load CNI network")
+	require.Equal(t, "vhive", n.Name)
+	require.Len(t, n.plugins, 2)
+
+	_, err = loadCNINetwork(confDir, binDir, "other")
+	require.Error(t, err, "Missing network was loaded")
+
+	_, err = loadCNINetwork(binDir, binDir, "")
+	require.Error(t, err, "Network was loaded from an empty dir")
+}
+
+func TestCNIAddDel(t *testing.T) {
+	confDir, binDir := setupFakeCNI(t)
+	netnsDir, err := ioutil.TempDir("", "netns")
+	require.NoError(t, err)
+	defer os.RemoveAll(netnsDir)
+
+	netnsPath := filepath.Join(netnsDir, "vm1_tap")
+	require.NoError(t, ioutil.WriteFile(netnsPath, nil, 0644))
+
+	n, err := loadCNINetwork(confDir, binDir, "")
+	require.NoError(t, err, "Failed to load CNI network")
+
+	result, rawResult, err := n.add("vm1_tap", netnsPath, cniIfName)
+	require.NoError(t, err, "CNI ADD failed")
+
+	ni, err := getCNINetworkInterface(result)
+	require.NoError(t, err, "Failed to get network interface from CNI result")
+	require.Equal(t, "10.1.0.5", ni.PrimaryAddress)
+	require.Equal(t, "/24", ni.Subnet)
+	require.Equal(t, "10.1.0.1", ni.GatewayAddress)
+	require.Equal(t, "0a:58:0a:01:00:05", ni.MacAddress)
+	require.Equal(t, cniTapName, ni.HostDevName)
+
+	// The VM crashed and its network namespace is gone
+	require.NoError(t, os.Remove(netnsPath))
+	require.NoError(t, n.del("vm1_tap", netnsPath, cniIfName, rawResult), "CNI DEL failed")
+
+	invs := readInvocations(t, binDir)
+	require.Len(t, invs, 4)
+
+	order := []string{"ADD loopback", "ADD bridge", "DEL bridge", "DEL loopback"}
+	for i, inv := range invs {
+		require.Equal(t, order[i], inv.command+" "+inv.plugin, "Plugins were run out of order")
+		require.Equal(t, "vm1_tap", inv.containerID)
+		require.Equal(t, cniIfName, inv.ifName)
+		require.Equal(t, "vhive", inv.conf["name"])
+		require.Equal(t, "0.4.0", inv.conf["cniVersion"])
+	}
+
+	require.Equal(t, netnsPath, invs[0].netns)
+	require.Nil(t, invs[0].conf["prevResult"], "First plugin got a previous result")
+	require.NotNil(t, invs[1].conf["prevResult"], "Chained plugin did not get the previous result")
+	require.Equal(t, "cni0", invs[1].conf["bridge"], "Plugin config was not passed")
+	require.Empty(t, invs[2].netns, "DEL got a missing network namespace")
+	require.NotNil(t, invs[2].conf["prevResult"], "DEL did not get the result of the ADD")
+}
+
+func TestCNIAddFailureIsUndone(t *testing.T) {
+	confDir, binDir := setupFakeCNI(t)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(binDir, "fail-bridge"), nil, 0644))
+
+	n, err := loadCNINetwork(confDir, binDir, "")
+	require.NoError(t, err, "Failed to load CNI network")
+
+	_, _, err = n.add("vm1_tap", "/nonexistent", cniIfName)
+	require.Error(t, err, "Failed CNI ADD succeeded")
+	require.Contains(t, err.Error(), "injected failure", "Plugin error was not reported")
+
+	var cmds []string
+	for _, inv := range readInvocations(t, binDir) {
+		cmds = append(cmds, fmt.Sprintf("%s %s", inv.command, inv.plugin))
+	}
+	require.Equal(t, []string{"ADD loopback", "ADD bridge", "DEL bridge", "DEL loopback"}, cmds, "Failed ADD was not undone")
+}
+
+func TestCNIResultWithoutAddress(t *testing.T) {
+	_, err := getCNINetworkInterface(&cniResult{})
+	require.Error(t, err, "Network interface without address")
+}
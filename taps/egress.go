@@ -0,0 +1,256 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// egressChainPrefix is the prefix of the iptables chain of the egress policy
+// of a VM, followed by the name of its tap device, 28 characters at most
+const egressChainPrefix = "VHIVE-EGRESS-"
+
+// EgressRule allows a VM to reach the destinations in a subnet, only on a
+// port if set, with the TCP or UDP protocol if set, both if empty
+type EgressRule struct {
+	Dest     *net.IPNet
+	Port     uint16
+	Protocol string
+}
+
+// EgressPolicy is the traffic a VM may send off the node, only to the
+// destinations allowed by its rules. A VM without a policy may send any traffic.
+type EgressPolicy struct {
+	Allow []EgressRule
+}
+
+// ParseEgressPolicy parses a comma-separated list of allowed destinations as
+// <CIDR or IPv4>[:<port>[/<tcp|udp>]], e.g., "10.96.0.10:53/udp,10.20.0.0/16:5432/tcp"
+func ParseEgressPolicy(s string) (*EgressPolicy, error) {
+	policy := &EgressPolicy{}
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, fmt.Errorf("empty destination in egress policy %q", s)
+		}
+
+		var rule EgressRule
+		dest := entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			dest = entry[:i]
+			port := entry[i+1:]
+			if j := strings.Index(port, "/"); j >= 0 {
+				port, rule.Protocol = port[:j], port[j+1:]
+				if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+					return nil, fmt.Errorf("invalid protocol %q of %q, must be tcp or udp", rule.Protocol, entry)
+				}
+			}
+			n, err := strconv.ParseUint(port, 10, 16)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid port %q of %q", port, entry)
+			}
+			rule.Port = uint16(n)
+		}
+
+		if !strings.Contains(dest, "/") {
+			dest += "/32"
+		}
+		ip, subnet, err := net.ParseCIDR(dest)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid destination %q, must be an IPv4 address or subnet", entry)
+		}
+		rule.Dest = subnet
+
+		policy.Allow = append(policy.Allow, rule)
+	}
+
+	return policy, nil
+}
+
+// String returns the policy in the format of ParseEgressPolicy
+func (p *EgressPolicy) String() string {
+	if p == nil {
+		return ""
+	}
+
+	entries := make([]string, 0, len(p.Allow))
+	for _, rule := range p.Allow {
+		entry := rule.Dest.String()
+		if rule.Port != 0 {
+			entry += ":" + strconv.Itoa(int(rule.Port))
+			if rule.Protocol != "" {
+				entry += "/" + rule.Protocol
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return strings.Join(entries, ",")
+}
+
+// egressChain returns the chain of the egress policy of the tap device
+func egressChain(devName string) string {
+	return egressChainPrefix + devName
+}
+
+// egressRules returns the iptables commands installing the policy of the tap
+// device in its chain, jumped to by the traffic the VM forwards. The destinations
+// are matched before the DNAT of the connections, e.g., to the cluster IP of
+// a service rather than its pods, and the replies of the connections to the
+// VM are allowed.
+func egressRules(devName string, policy *EgressPolicy) [][]string {
+	chain := egressChain(devName)
+
+	rules := [][]string{
+		{"-N", chain},
+		{"-A", chain, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+	}
+
+	for _, rule := range policy.Allow {
+		match := []string{"-A", chain, "-m", "conntrack", "--ctorigdst", rule.Dest.String()}
+		if rule.Port == 0 {
+			rules = append(rules, append(match, "-j", "RETURN"))
+			continue
+		}
+
+		protocols := []string{"tcp", "udp"}
+		if rule.Protocol != "" {
+			protocols = []string{rule.Protocol}
+		}
+		for _, protocol := range protocols {
+			r := append(append([]string(nil), match...), "--ctproto", protocol, "--ctorigdstport", strconv.Itoa(int(rule.Port)), "-j", "RETURN")
+			rules = append(rules, r)
+		}
+	}
+
+	return append(rules,
+		[]string{"-A", chain, "-j", "DROP"},
+		[]string{"-I", "FORWARD", "-i", devName, "-j", chain},
+	)
+}
+
+// runIPTables runs an iptables command, waiting for the lock of the tables
+func runIPTables(args ...string) ([]byte, error) {
+	return exec.Command("sudo", append([]string{"iptables", "--wait"}, args...)...).CombinedOutput()
+}
+
+// SetEgressPolicy restricts the traffic the VM of the tap sends off the node to
+// the policy, replacing its previous policy, if any. The policy is removed with the tap.
+func (tm *TapManager) SetEgressPolicy(tapName string, policy *EgressPolicy) error {
+	tm.Lock()
+	ni, ok := tm.createdTaps[tapName]
+	tm.Unlock()
+
+	if !ok {
+		return fmt.Errorf("tap %s does not exist", tapName)
+	}
+
+	tm.removeEgress(ni.HostDevName)
+
+	logger := netLog.WithFields(log.Fields{"tap": tapName, "policy": policy.String()})
+	logger.Debug("Installing egress policy")
+
+	for _, rule := range egressRules(ni.HostDevName, policy) {
+		if out, err := tm.iptables(rule...); err != nil {
+			logger.WithError(err).Errorf("Failed to install egress policy: %s", out)
+			tm.removeEgress(ni.HostDevName)
+			return fmt.Errorf("failed to install the egress policy of tap %s: %v: %s", tapName, err, bytes.TrimSpace(out))
+		}
+	}
+
+	tm.Lock()
+	tm.egressTaps[ni.HostDevName] = true
+	tm.Unlock()
+
+	return nil
+}
+
+// removeEgress removes the egress policy of the tap device, if any, whose rules
+// may be partially installed
+func (tm *TapManager) removeEgress(devName string) {
+	tm.Lock()
+	delete(tm.egressTaps, devName)
+	tm.Unlock()
+
+	chain := egressChain(devName)
+	for _, rule := range [][]string{
+		{"-D", "FORWARD", "-i", devName, "-j", chain},
+		{"-F", chain},
+		{"-X", chain},
+	} {
+		// The rules of a policy that was never installed do not exist
+		_, _ = tm.iptables(rule...)
+	}
+}
+
+// freeEgress removes the egress policy of the tap device if it has one
+func (tm *TapManager) freeEgress(devName string) {
+	tm.Lock()
+	installed := tm.egressTaps[devName]
+	tm.Unlock()
+
+	if installed {
+		tm.removeEgress(devName)
+	}
+}
+
+// ReconcileEgress removes the egress policies of the tap devices that the tap
+// manager did not create, e.g., left by a previous run of the daemon
+func (tm *TapManager) ReconcileEgress() error {
+	out, err := tm.iptables("-S")
+	if err != nil {
+		return fmt.Errorf("failed to list the iptables rules: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	live := make(map[string]bool)
+	tm.Lock()
+	for _, ni := range tm.createdTaps {
+		live[ni.HostDevName] = true
+	}
+	tm.Unlock()
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "-N" || !strings.HasPrefix(fields[1], egressChainPrefix) {
+			continue
+		}
+
+		devName := strings.TrimPrefix(fields[1], egressChainPrefix)
+		if !live[devName] {
+			netLog.WithField("tap", devName).Info("Removing stale egress policy")
+			tm.removeEgress(devName)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,248 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIPTables records the iptables commands of a tap manager, listing the
+// chains of rules as iptables -S does
+type fakeIPTables struct {
+	sync.Mutex
+	cmds  []string
+	rules string
+	// fail makes the commands containing it fail
+	fail string
+}
+
+func (f *fakeIPTables) run(args ...string) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	cmd := strings.Join(args, " ")
+	f.cmds = append(f.cmds, cmd)
+
+	if f.fail != "" && strings.Contains(cmd, f.fail) {
+		return []byte("iptables: No chain/target/match by that name."), errors.New("exit status 1")
+	}
+	if cmd == "-S" {
+		return []byte(f.rules), nil
+	}
+
+	return nil, nil
+}
+
+func (f *fakeIPTables) commands() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	cmds := f.cmds
+	f.cmds = nil
+
+	return cmds
+}
+
+func newEgressTapManager(ipt *fakeIPTables, tapNames ...string) *TapManager {
+	tm := newFakeTapManager(&fakeTaps{})
+	tm.iptables = ipt.run
+	tm.egressTaps = make(map[string]bool)
+
+	for _, tapName := range tapNames {
+		tm.createdTaps[tapName] = &NetworkInterface{HostDevName: tapName}
+	}
+
+	return tm
+}
+
+func mustParseEgressPolicy(t *testing.T, s string) *EgressPolicy {
+	policy, err := ParseEgressPolicy(s)
+	require.NoError(t, err)
+
+	return policy
+}
+
+func TestParseEgressPolicy(t *testing.T) {
+	policy := mustParseEgressPolicy(t, "10.96.0.10:53/udp, 10.20.0.0/16:5432, 192.168.1.7")
+	require.Len(t, policy.Allow, 3)
+
+	require.Equal(t, "10.96.0.10/32", policy.Allow[0].Dest.String())
+	require.Equal(t, uint16(53), policy.Allow[0].Port)
+	require.Equal(t, "udp", policy.Allow[0].Protocol)
+
+	require.Equal(t, "10.20.0.0/16", policy.Allow[1].Dest.String())
+	require.Equal(t, uint16(5432), policy.Allow[1].Port)
+	require.Empty(t, policy.Allow[1].Protocol)
+
+	require.Equal(t, "192.168.1.7/32", policy.Allow[2].Dest.String())
+	require.Zero(t, policy.Allow[2].Port)
+
+	require.Equal(t, "10.96.0.10/32:53/udp,10.20.0.0/16:5432,192.168.1.7/32", policy.String())
+	require.Equal(t, policy, mustParseEgressPolicy(t, policy.String()))
+
+	var none *EgressPolicy
+	require.Empty(t, none.String())
+}
+
+func TestParseEgressPolicyInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"10.0.0.1,",
+		"10.0.0.1:0",
+		"10.0.0.1:65536",
+		"10.0.0.1:80/sctp",
+		"10.0.0.1:http",
+		"10.0.0.0/33",
+		"example.com:443",
+		"fd00::1",
+	} {
+		_, err := ParseEgressPolicy(s)
+		require.Error(t, err, "Policy %q must be invalid", s)
+	}
+}
+
+func TestEgressRules(t *testing.T) {
+	policy := mustParseEgressPolicy(t, "10.96.0.10:53/udp,10.20.0.0/16:5432,192.168.1.7")
+
+	var rules []string
+	for _, rule := range egressRules("1_tap", policy) {
+		rules = append(rules, strings.Join(rule, " "))
+	}
+
+	require.Equal(t, []string{
+		"-N VHIVE-EGRESS-1_tap",
+		"-A VHIVE-EGRESS-1_tap -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+		"-A VHIVE-EGRESS-1_tap -m conntrack --ctorigdst 10.96.0.10/32 --ctproto udp --ctorigdstport 53 -j RETURN",
+		"-A VHIVE-EGRESS-1_tap -m conntrack --ctorigdst 10.20.0.0/16 --ctproto tcp --ctorigdstport 5432 -j RETURN",
+		"-A VHIVE-EGRESS-1_tap -m conntrack --ctorigdst 10.20.0.0/16 --ctproto udp --ctorigdstport 5432 -j RETURN",
+		"-A VHIVE-EGRESS-1_tap -m conntrack --ctorigdst 192.168.1.7/32 -j RETURN",
+		"-A VHIVE-EGRESS-1_tap -j DROP",
+		"-I FORWARD -i 1_tap -j VHIVE-EGRESS-1_tap",
+	}, rules)
+}
+
+func TestEgressChainsUnique(t *testing.T) {
+	ipt := &fakeIPTables{}
+	tm := newEgressTapManager(ipt, "1_tap", "2_tap")
+	policy := mustParseEgressPolicy(t, "10.0.0.1")
+
+	require.NoError(t, tm.SetEgressPolicy("1_tap", policy))
+	require.NoError(t, tm.SetEgressPolicy("2_tap", policy))
+
+	var chains []string
+	for _, cmd := range ipt.commands() {
+		if strings.HasPrefix(cmd, "-N ") {
+			chains = append(chains, strings.TrimPrefix(cmd, "-N "))
+		}
+	}
+	require.Equal(t, []string{"VHIVE-EGRESS-1_tap", "VHIVE-EGRESS-2_tap"}, chains)
+
+	// Replacing the policy of a tap removes its chain before creating it again
+	require.NoError(t, tm.SetEgressPolicy("1_tap", mustParseEgressPolicy(t, "10.0.0.2")))
+	cmds := ipt.commands()
+	require.Equal(t, []string{
+		"-D FORWARD -i 1_tap -j VHIVE-EGRESS-1_tap",
+		"-F VHIVE-EGRESS-1_tap",
+		"-X VHIVE-EGRESS-1_tap",
+		"-N VHIVE-EGRESS-1_tap",
+	}, cmds[:4])
+	for _, cmd := range cmds {
+		require.NotContains(t, cmd, "2_tap", "The chain of another tap must not be touched")
+	}
+}
+
+func TestSetEgressPolicyUnknownTap(t *testing.T) {
+	ipt := &fakeIPTables{}
+	tm := newEgressTapManager(ipt)
+
+	require.Error(t, tm.SetEgressPolicy("1_tap", mustParseEgressPolicy(t, "10.0.0.1")))
+	require.Empty(t, ipt.commands())
+}
+
+func TestSetEgressPolicyFailure(t *testing.T) {
+	ipt := &fakeIPTables{fail: "DROP"}
+	tm := newEgressTapManager(ipt, "1_tap")
+
+	err := tm.SetEgressPolicy("1_tap", mustParseEgressPolicy(t, "10.0.0.1"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "No chain/target/match")
+
+	// The partially installed chain is removed
+	cmds := ipt.commands()
+	require.Equal(t, []string{
+		"-D FORWARD -i 1_tap -j VHIVE-EGRESS-1_tap",
+		"-F VHIVE-EGRESS-1_tap",
+		"-X VHIVE-EGRESS-1_tap",
+	}, cmds[len(cmds)-3:])
+	require.Empty(t, tm.egressTaps)
+}
+
+func TestFreeTapRemovesEgress(t *testing.T) {
+	ipt := &fakeIPTables{}
+	tm := newEgressTapManager(ipt, "1_tap", "2_tap")
+
+	require.NoError(t, tm.SetEgressPolicy("1_tap", mustParseEgressPolicy(t, "10.0.0.1")))
+	ipt.commands()
+
+	require.NoError(t, tm.FreeTap("1_tap"))
+	require.Equal(t, []string{
+		"-D FORWARD -i 1_tap -j VHIVE-EGRESS-1_tap",
+		"-F VHIVE-EGRESS-1_tap",
+		"-X VHIVE-EGRESS-1_tap",
+	}, ipt.commands())
+	require.Empty(t, tm.egressTaps)
+
+	// A tap without a policy is freed without touching iptables
+	require.NoError(t, tm.FreeTap("2_tap"))
+	require.Empty(t, ipt.commands())
+}
+
+func TestReconcileEgress(t *testing.T) {
+	ipt := &fakeIPTables{rules: strings.Join([]string{
+		"-P INPUT ACCEPT",
+		"-P FORWARD ACCEPT",
+		"-N KUBE-FORWARD",
+		"-N VHIVE-EGRESS-1_tap",
+		"-N VHIVE-EGRESS-7_tap",
+		"-A FORWARD -i 1_tap -j VHIVE-EGRESS-1_tap",
+		"-A FORWARD -i 7_tap -j VHIVE-EGRESS-7_tap",
+		"-A VHIVE-EGRESS-7_tap -j DROP",
+	}, "\n")}
+	tm := newEgressTapManager(ipt, "1_tap")
+
+	require.NoError(t, tm.ReconcileEgress())
+	require.Equal(t, []string{
+		"-S",
+		"-D FORWARD -i 7_tap -j VHIVE-EGRESS-7_tap",
+		"-F VHIVE-EGRESS-7_tap",
+		"-X VHIVE-EGRESS-7_tap",
+	}, ipt.commands())
+
+	ipt.fail = "-S"
+	require.Error(t, tm.ReconcileEgress())
+}
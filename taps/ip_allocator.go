@@ -0,0 +1,364 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// minSubnetPrefix is the prefix length of the widest subnet of an allocator,
+// wider ones are misconfigurations and the size of a /0 overflows 32 bits
+const minSubnetPrefix = 8
+
+// ErrAddressesExhausted is returned by Allocate when all the addresses of the subnet are taken
+var ErrAddressesExhausted = errors.New("no free address in the subnet")
+
+// IPAllocator assigns the guest addresses of the VMs of a bridge
+type IPAllocator interface {
+	// Allocate returns a free address, or ErrAddressesExhausted
+	Allocate() (net.IP, error)
+	// Release gives back an address returned by Allocate
+	Release(ip net.IP) error
+	// Free returns the number of addresses left to allocate
+	Free() int
+}
+
+// SubnetConfig configures the addresses of the VMs of a bridge
+type SubnetConfig struct {
+	// CIDR is the IPv4 subnet of the VMs, e.g., 190.128.0.0/10
+	CIDR string
+	// Gateway is the address of the bridge, the first address of the subnet if empty
+	Gateway string
+	// Reserved are the ranges never assigned to VMs, e.g., to avoid collisions with
+	// the host networks, as CIDRs, first-last ranges or single addresses
+	Reserved []string
+	// Limit caps the number of addresses allocated at once, 0 for the size of the subnet
+	Limit int
+}
+
+// DefaultSubnets returns the subnets of the bridges of the tap manager
+// without a subnet configuration
+func DefaultSubnets() []SubnetConfig {
+	subnets := make([]SubnetConfig, NumBridges)
+	for i := range subnets {
+		subnets[i] = SubnetConfig{
+			CIDR:    fmt.Sprintf("19%d.128.0.0%s", i, Subnet),
+			Gateway: getGatewayAddr(i),
+			Limit:   TapsPerBridge,
+		}
+	}
+
+	return subnets
+}
+
+// ParseSubnets parses a comma-separated list of subnets with an optional
+// gateway, e.g., "10.0.0.0/16@10.0.0.254,10.1.0.0/16", and a comma-separated
+// list of reserved ranges applied to all of them, e.g., "10.0.0.0/24,10.1.0.5-10.1.0.9".
+// Without subnets, the ranges are reserved in the default subnets.
+func ParseSubnets(subnets, reserved string) ([]SubnetConfig, error) {
+	var reservedRanges []string
+	if reserved != "" {
+		reservedRanges = strings.Split(reserved, ",")
+	}
+
+	var configs []SubnetConfig
+	if subnets == "" {
+		configs = DefaultSubnets()
+	} else {
+		for _, subnet := range strings.Split(subnets, ",") {
+			cidr, gateway := subnet, ""
+			if i := strings.Index(subnet, "@"); i >= 0 {
+				cidr, gateway = subnet[:i], subnet[i+1:]
+			}
+			configs = append(configs, SubnetConfig{CIDR: cidr, Gateway: gateway})
+		}
+	}
+
+	for i := range configs {
+		configs[i].Reserved = reservedRanges
+		if _, err := NewCIDRAllocator(configs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return configs, nil
+}
+
+// ipRange is an inclusive range of offsets in a subnet
+type ipRange struct {
+	first, last uint32
+}
+
+// CIDRAllocator allocates the addresses of an IPv4 subnet, other than its
+// network, broadcast and gateway addresses and its reserved ranges. The
+// released addresses are reused after the ones never allocated, so that a
+// stale ARP entry of a stopped VM does not point to a new one right away.
+type CIDRAllocator struct {
+	sync.Mutex
+	subnet  *net.IPNet
+	gateway net.IP
+	// base is the network address, the offsets of the addresses are relative to it
+	base     uint32
+	size     uint32
+	reserved []ipRange
+	limit    int
+	// next is the offset the search for a free address starts from
+	next      uint32
+	allocated map[uint32]bool
+}
+
+// NewCIDRAllocator Creates an allocator of the addresses of the subnet
+func NewCIDRAllocator(cfg SubnetConfig) (*CIDRAllocator, error) {
+	_, subnet, err := net.ParseCIDR(cfg.CIDR)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid subnet %q", cfg.CIDR)
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits != 32 || subnet.IP.To4() == nil {
+		return nil, errors.Errorf("subnet %s is not an IPv4 subnet", cfg.CIDR)
+	}
+	if ones > 30 {
+		return nil, errors.Errorf("subnet %s is too small for a gateway and a VM", cfg.CIDR)
+	}
+	if ones < minSubnetPrefix {
+		return nil, errors.Errorf("subnet %s is too large, its prefix must be at least /%d", cfg.CIDR, minSubnetPrefix)
+	}
+	if cfg.Limit < 0 {
+		return nil, errors.Errorf("negative limit of subnet %s", cfg.CIDR)
+	}
+
+	a := &CIDRAllocator{
+		subnet:    subnet,
+		base:      ipToUint32(subnet.IP),
+		size:      1 << uint(bits-ones),
+		limit:     cfg.Limit,
+		next:      1,
+		allocated: make(map[uint32]bool),
+	}
+
+	a.gateway = a.ipAt(1)
+	if cfg.Gateway != "" {
+		if a.gateway = net.ParseIP(cfg.Gateway).To4(); a.gateway == nil {
+			return nil, errors.Errorf("invalid gateway %q", cfg.Gateway)
+		}
+		if !a.isHost(a.gateway) {
+			return nil, errors.Errorf("gateway %s is not a host address of subnet %s", cfg.Gateway, cfg.CIDR)
+		}
+	}
+
+	for _, r := range cfg.Reserved {
+		reserved, err := a.parseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		// A range out of the subnet reserves nothing in it
+		if reserved != nil {
+			a.reserved = append(a.reserved, *reserved)
+		}
+	}
+
+	return a, nil
+}
+
+// Subnet returns the subnet of the addresses
+func (a *CIDRAllocator) Subnet() *net.IPNet {
+	return a.subnet
+}
+
+// Gateway returns the address of the bridge of the subnet
+func (a *CIDRAllocator) Gateway() net.IP {
+	return a.gateway
+}
+
+// Allocate returns a free address of the subnet
+func (a *CIDRAllocator) Allocate() (net.IP, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.limit > 0 && len(a.allocated) >= a.limit {
+		return nil, ErrAddressesExhausted
+	}
+
+	// The host addresses are the offsets from 1 to size-2
+	hosts := a.size - 2
+	for i := uint32(0); i < hosts; i++ {
+		offset := (a.next-1+i)%hosts + 1
+		if a.allocated[offset] || a.isReserved(offset) {
+			continue
+		}
+
+		a.allocated[offset] = true
+		a.next = offset%hosts + 1
+
+		return a.ipAt(offset), nil
+	}
+
+	return nil, ErrAddressesExhausted
+}
+
+// Release gives back an allocated address of the subnet
+func (a *CIDRAllocator) Release(ip net.IP) error {
+	a.Lock()
+	defer a.Unlock()
+
+	ip4 := ip.To4()
+	if ip4 == nil || !a.subnet.Contains(ip4) {
+		return errors.Errorf("address %s is not in subnet %s", ip, a.subnet)
+	}
+
+	offset := ipToUint32(ip4) - a.base
+	if !a.allocated[offset] {
+		return errors.Errorf("address %s is not allocated", ip)
+	}
+	delete(a.allocated, offset)
+
+	return nil
+}
+
+// Free returns the number of addresses left to allocate, within the limit
+func (a *CIDRAllocator) Free() int {
+	a.Lock()
+	defer a.Unlock()
+
+	// The reserved addresses are never allocated, the gateway counting as a
+	// reserved range unless it is in one already
+	gateway := ipToUint32(a.gateway) - a.base
+	ranges := append([]ipRange{{first: gateway, last: gateway}}, a.reserved...)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].first < ranges[j].first })
+
+	free := int64(a.size-2) - int64(len(a.allocated))
+	end := int64(0)
+	for _, r := range ranges {
+		// Only the host addresses, from 1 to size-2, may be reserved
+		first, last := int64(r.first), int64(r.last)
+		if first < 1 {
+			first = 1
+		}
+		if last > int64(a.size-2) {
+			last = int64(a.size - 2)
+		}
+		if first <= end {
+			first = end + 1
+		}
+		if first > last {
+			continue
+		}
+		free -= last - first + 1
+		end = last
+	}
+
+	if a.limit > 0 && int64(a.limit-len(a.allocated)) < free {
+		free = int64(a.limit - len(a.allocated))
+	}
+	if free < 0 {
+		return 0
+	}
+
+	return int(free)
+}
+
+func (a *CIDRAllocator) isReserved(offset uint32) bool {
+	if a.ipAt(offset).Equal(a.gateway) {
+		return true
+	}
+
+	for _, r := range a.reserved {
+		if offset >= r.first && offset <= r.last {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHost returns true if the address is in the subnet but is not its network or broadcast address
+func (a *CIDRAllocator) isHost(ip net.IP) bool {
+	if !a.subnet.Contains(ip) {
+		return false
+	}
+
+	offset := ipToUint32(ip) - a.base
+	return offset != 0 && offset != a.size-1
+}
+
+// parseRange parses a reserved range as a CIDR, a first-last range or a single
+// address, returning its offsets in the subnet or nil if it does not overlap it
+func (a *CIDRAllocator) parseRange(r string) (*ipRange, error) {
+	var first, last uint32
+
+	switch {
+	case strings.Contains(r, "/"):
+		_, n, err := net.ParseCIDR(r)
+		if err != nil || n.IP.To4() == nil {
+			return nil, errors.Errorf("invalid reserved range %q", r)
+		}
+		ones, _ := n.Mask.Size()
+		first = ipToUint32(n.IP)
+		last = first + uint32(1<<uint(32-ones)-1)
+	case strings.Contains(r, "-"):
+		bounds := strings.SplitN(r, "-", 2)
+		firstIP, lastIP := net.ParseIP(bounds[0]).To4(), net.ParseIP(bounds[1]).To4()
+		if firstIP == nil || lastIP == nil || ipToUint32(firstIP) > ipToUint32(lastIP) {
+			return nil, errors.Errorf("invalid reserved range %q", r)
+		}
+		first, last = ipToUint32(firstIP), ipToUint32(lastIP)
+	default:
+		ip := net.ParseIP(r).To4()
+		if ip == nil {
+			return nil, errors.Errorf("invalid reserved range %q", r)
+		}
+		first = ipToUint32(ip)
+		last = first
+	}
+
+	subnetLast := a.base + a.size - 1
+	if last < a.base || first > subnetLast {
+		return nil, nil
+	}
+	if first < a.base {
+		first = a.base
+	}
+	if last > subnetLast {
+		last = subnetLast
+	}
+
+	return &ipRange{first: first - a.base, last: last - a.base}, nil
+}
+
+func (a *CIDRAllocator) ipAt(offset uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, a.base+offset)
+	return ip
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
@@ -0,0 +1,177 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func allocateAll(t *testing.T, a IPAllocator) []string {
+	t.Helper()
+
+	var ips []string
+	for {
+		ip, err := a.Allocate()
+		if err == ErrAddressesExhausted {
+			return ips
+		}
+		require.NoError(t, err, "failed to allocate address")
+		ips = append(ips, ip.String())
+	}
+}
+
+func TestCIDRAllocatorExhaustion(t *testing.T) {
+	a, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/29"})
+	require.NoError(t, err, "failed to create allocator")
+	require.Equal(t, "10.0.0.1", a.Gateway().String(), "gateway is not the first address")
+
+	// The network, gateway and broadcast addresses are never allocated
+	require.Equal(t, []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}, allocateAll(t, a))
+
+	_, err = a.Allocate()
+	require.Equal(t, ErrAddressesExhausted, err, "exhausted subnet allocated an address")
+
+	limited, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/24", Limit: 2})
+	require.NoError(t, err, "failed to create allocator")
+	require.Len(t, allocateAll(t, limited), 2, "limit was not enforced")
+}
+
+func TestCIDRAllocatorReleaseReuse(t *testing.T) {
+	a, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/29", Gateway: "10.0.0.6"})
+	require.NoError(t, err, "failed to create allocator")
+
+	ips := allocateAll(t, a)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}, ips)
+
+	require.NoError(t, a.Release(net.ParseIP("10.0.0.3")), "failed to release address")
+	require.Error(t, a.Release(net.ParseIP("10.0.0.3")), "address was released twice")
+	require.Error(t, a.Release(net.ParseIP("10.0.1.3")), "address out of the subnet was released")
+
+	ip, err := a.Allocate()
+	require.NoError(t, err, "released address was not reused")
+	require.Equal(t, "10.0.0.3", ip.String(), "released address was not reused")
+
+	// The released addresses are reused after the ones never allocated
+	b, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/24"})
+	require.NoError(t, err, "failed to create allocator")
+
+	first, err := b.Allocate()
+	require.NoError(t, err, "failed to allocate address")
+	require.NoError(t, b.Release(first), "failed to release address")
+
+	second, err := b.Allocate()
+	require.NoError(t, err, "failed to allocate address")
+	require.Equal(t, "10.0.0.3", second.String(), "released address was reused right away")
+}
+
+func TestCIDRAllocatorReservedRanges(t *testing.T) {
+	a, err := NewCIDRAllocator(SubnetConfig{
+		CIDR:     "10.0.0.0/28",
+		Reserved: []string{"10.0.0.2", "10.0.0.4-10.0.0.6", "10.0.0.8/30", "192.168.0.0/16"},
+	})
+	require.NoError(t, err, "failed to create allocator")
+
+	require.Equal(t, []string{"10.0.0.3", "10.0.0.7", "10.0.0.12", "10.0.0.13", "10.0.0.14"}, allocateAll(t, a))
+}
+
+func TestCIDRAllocatorInvalidConfig(t *testing.T) {
+	for _, cfg := range []SubnetConfig{
+		{CIDR: "10.0.0.0"},
+		{CIDR: "fd00::/64"},
+		{CIDR: "10.0.0.0/31"},
+		{CIDR: "0.0.0.0/0"},
+		{CIDR: "10.0.0.0/7"},
+		{CIDR: "10.0.0.0/24", Gateway: "10.0.1.1"},
+		{CIDR: "10.0.0.0/24", Gateway: "10.0.0.255"},
+		{CIDR: "10.0.0.0/24", Reserved: []string{"10.0.0.9-10.0.0.2"}},
+		{CIDR: "10.0.0.0/24", Reserved: []string{"host"}},
+		{CIDR: "10.0.0.0/24", Limit: -1},
+	} {
+		_, err := NewCIDRAllocator(cfg)
+		require.Error(t, err, "invalid config %+v was accepted", cfg)
+	}
+}
+
+func TestParseSubnets(t *testing.T) {
+	subnets, err := ParseSubnets("10.0.0.0/16@10.0.0.254,10.1.0.0/16", "10.0.0.0/24")
+	require.NoError(t, err, "failed to parse subnets")
+	require.Equal(t, []SubnetConfig{
+		{CIDR: "10.0.0.0/16", Gateway: "10.0.0.254", Reserved: []string{"10.0.0.0/24"}},
+		{CIDR: "10.1.0.0/16", Reserved: []string{"10.0.0.0/24"}},
+	}, subnets)
+
+	subnets, err = ParseSubnets("", "190.128.0.0/24")
+	require.NoError(t, err, "failed to parse reserved ranges")
+	require.Len(t, subnets, NumBridges, "default subnets were not used")
+	require.Equal(t, []string{"190.128.0.0/24"}, subnets[0].Reserved, "ranges were not reserved in the default subnets")
+
+	_, err = ParseSubnets("10.0.0.0/16@10.1.0.1", "")
+	require.Error(t, err, "gateway out of the subnet was accepted")
+}
+
+func TestDefaultSubnets(t *testing.T) {
+	for i, cfg := range DefaultSubnets() {
+		a, err := NewCIDRAllocator(cfg)
+		require.NoError(t, err, "invalid default subnet")
+		require.Equal(t, getGatewayAddr(i), a.Gateway().String(), "unexpected gateway")
+
+		// The addresses are the ones of the fixed scheme of the taps
+		ips := allocateAll(t, a)
+		require.Len(t, ips, TapsPerBridge, "unexpected number of addresses")
+		require.Equal(t, fmt.Sprintf("19%d.128.0.2", i), ips[0], "unexpected first address")
+	}
+
+	require.Equal(t, "02:FC:BE:80:00:02", getMacAddress(net.ParseIP("190.128.0.2")), "unexpected MAC address")
+}
+
+func TestCIDRAllocatorFree(t *testing.T) {
+	a, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/29"})
+	require.NoError(t, err, "failed to create allocator")
+	require.Equal(t, 5, a.Free(), "wrong free addresses of an empty subnet")
+
+	ip, err := a.Allocate()
+	require.NoError(t, err)
+	require.Equal(t, 4, a.Free(), "allocated address is free")
+	require.NoError(t, a.Release(ip))
+	require.Equal(t, 5, a.Free(), "released address is not free")
+
+	allocateAll(t, a)
+	require.Zero(t, a.Free(), "exhausted subnet has free addresses")
+
+	// The gateway in a reserved range and overlapping ranges are counted once
+	reserved, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/24", Reserved: []string{"10.0.0.0/28", "10.0.0.8-10.0.0.20", "10.0.0.200"}})
+	require.NoError(t, err, "failed to create allocator")
+	free := reserved.Free()
+	require.Equal(t, 254-20-1, free, "wrong free addresses with reserved ranges")
+	require.Len(t, allocateAll(t, reserved), free, "free addresses were not allocatable")
+
+	limited, err := NewCIDRAllocator(SubnetConfig{CIDR: "10.0.0.0/24", Limit: 2})
+	require.NoError(t, err, "failed to create allocator")
+	require.Equal(t, 2, limited.Free(), "limit was not applied")
+	allocateAll(t, limited)
+	require.Zero(t, limited.Free(), "limited subnet has free addresses")
+}
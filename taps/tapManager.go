@@ -29,8 +29,8 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
-	"sync/atomic"
 
+	"github.com/ease-lab/vhive/logging"
 	log "github.com/sirupsen/logrus"
 
 	"net"
@@ -38,6 +38,9 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
+// netLog logs the taps and the networks of the VMs
+var netLog = logging.Logger(logging.Network)
+
 // getGatewayAddr Creates the gateway address (first address in pool)
 func getGatewayAddr(bridgeID int) string {
 	return fmt.Sprintf("19%d.128.0.1", bridgeID)
@@ -48,34 +51,66 @@ func getBridgeName(id int) string {
 	return fmt.Sprintf("br%d", id)
 }
 
-// getPrimaryAddress Creates the primary address for a tap
-func getPrimaryAddress(curTaps, bridgeID int) string {
-	return fmt.Sprintf("19%d.128.%d.%d", bridgeID, (curTaps+2)/256, (curTaps+2)%256)
+// getMacAddress Creates the MAC address of a tap from its primary address
+func getMacAddress(ip net.IP) string {
+	ip = ip.To4()
+	return fmt.Sprintf("02:FC:%02X:%02X:%02X:%02X", ip[0], ip[1], ip[2], ip[3])
 }
 
-// NewTapManager Creates a new tap manager
+// NewTapManager Creates a new tap manager with the default subnets
 func NewTapManager() *TapManager {
+	tm, err := NewTapManagerWithSubnets(DefaultSubnets())
+	if err != nil {
+		netLog.Panic(err)
+	}
+
+	return tm
+}
+
+// NewTapManagerWithSubnets Creates a new tap manager with a bridge per subnet
+func NewTapManagerWithSubnets(subnets []SubnetConfig) (*TapManager, error) {
+	if len(subnets) == 0 {
+		return nil, errors.New("no subnet for the taps")
+	}
+
 	tm := new(TapManager)
 
-	tm.numBridges = NumBridges
-	tm.TapCountsPerBridge = make([]int64, NumBridges)
+	tm.numBridges = len(subnets)
 	tm.createdTaps = make(map[string]*NetworkInterface)
+	tm.create = tm.createTap
+	tm.iptables = runIPTables
+	tm.egressTaps = make(map[string]bool)
 
-	log.Info("Registering bridges for tap manager")
+	for _, cfg := range subnets {
+		allocator, err := NewCIDRAllocator(cfg)
+		if err != nil {
+			return nil, err
+		}
 
-	for i := 0; i < NumBridges; i++ {
-		brName := getBridgeName(i)
-		gatewayAddr := getGatewayAddr(i)
+		ones, _ := allocator.Subnet().Mask.Size()
+		tm.bridges = append(tm.bridges, tapBridge{
+			gateway:   allocator.Gateway().String(),
+			subnet:    fmt.Sprintf("/%d", ones),
+			allocator: allocator,
+		})
+	}
 
-		createBridge(brName, gatewayAddr)
+	netLog.Info("Registering bridges for tap manager")
+
+	for i, br := range tm.bridges {
+		createBridge(getBridgeName(i), br.gateway+br.subnet)
 	}
 
-	return tm
+	if err := tm.ReconcileEgress(); err != nil {
+		netLog.WithError(err).Warn("Failed to remove the stale egress policies")
+	}
+
+	return tm, nil
 }
 
 // Creates the bridge, add a gateway to it, and enables it
-func createBridge(bridgeName, gatewayAddr string) {
-	logger := log.WithFields(log.Fields{"bridge": bridgeName})
+func createBridge(bridgeName, bridgeAddress string) {
+	logger := netLog.WithFields(log.Fields{"bridge": bridgeName})
 
 	logger.Debug("Creating bridge")
 
@@ -92,11 +127,9 @@ func createBridge(bridgeName, gatewayAddr string) {
 		logger.Panic("Bridge could not be enabled")
 	}
 
-	bridgeAddress := gatewayAddr + Subnet
-
 	addr, err := netlink.ParseAddr(bridgeAddress)
 	if err != nil {
-		log.Panic(fmt.Sprintf("could not parse bridge address %s", bridgeAddress))
+		netLog.Panic(fmt.Sprintf("could not parse bridge address %s", bridgeAddress))
 	}
 
 	if err := netlink.AddrAdd(br, addr); err != nil {
@@ -112,7 +145,7 @@ func ConfigIPtables(tapName, hostIface string) error {
 			"route",
 		).Output()
 		if err != nil {
-			log.Warnf("Failed to fetch host net interfaces %v\n%s\n", err, out)
+			netLog.Warnf("Failed to fetch host net interfaces %v\n%s\n", err, out)
 			return err
 		}
 		scanner := bufio.NewScanner(bytes.NewReader(out))
@@ -128,7 +161,7 @@ func ConfigIPtables(tapName, hostIface string) error {
 	)
 	stdoutStderr, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Warnf("Failed to configure NAT %v\n%s\n", err, stdoutStderr)
+		netLog.Warnf("Failed to configure NAT %v\n%s\n", err, stdoutStderr)
 		return err
 	}
 	cmd = exec.Command(
@@ -136,7 +169,7 @@ func ConfigIPtables(tapName, hostIface string) error {
 	)
 	stdoutStderr, err = cmd.CombinedOutput()
 	if err != nil {
-		log.Warnf("Failed to setup forwarding into tap %v\n%s\n", err, stdoutStderr)
+		netLog.Warnf("Failed to setup forwarding into tap %v\n%s\n", err, stdoutStderr)
 		return err
 	}
 	cmd = exec.Command(
@@ -144,7 +177,7 @@ func ConfigIPtables(tapName, hostIface string) error {
 	)
 	stdoutStderr, err = cmd.CombinedOutput()
 	if err != nil {
-		log.Warnf("Failed to setup forwarding out from tap %v\n%s\n", err, stdoutStderr)
+		netLog.Warnf("Failed to setup forwarding out from tap %v\n%s\n", err, stdoutStderr)
 		return err
 	}
 	cmd = exec.Command(
@@ -152,7 +185,7 @@ func ConfigIPtables(tapName, hostIface string) error {
 	)
 	stdoutStderr, err = cmd.CombinedOutput()
 	if err != nil {
-		log.Warnf("Failed to configure conntrack %v\n%s\n", err, stdoutStderr)
+		netLog.Warnf("Failed to configure conntrack %v\n%s\n", err, stdoutStderr)
 		return err
 	}
 	return nil
@@ -169,35 +202,91 @@ func (tm *TapManager) AddTap(tapName, hostIface string) (*NetworkInterface, erro
 
 	tm.Unlock()
 
+	ni, err := tm.create(tapName, hostIface)
+	if err != nil {
+		return nil, err
+	}
+
+	tm.Lock()
+	tm.createdTaps[tapName] = ni
+	tm.Unlock()
+
+	return ni, nil
+}
+
+// createTap creates a tap with an address of the first bridge that has some left,
+// and configures its iptables rules
+func (tm *TapManager) createTap(tapName, hostIface string) (*NetworkInterface, error) {
 	for i := 0; i < tm.numBridges; i++ {
-		tapsInBridge := atomic.AddInt64(&tm.TapCountsPerBridge[i], 1)
-		if tapsInBridge-1 < TapsPerBridge {
-			// Create a tap with this bridge
-			ni, err := tm.addTap(tapName, i, int(tapsInBridge-1))
-			if err == nil {
-				tm.Lock()
-				tm.createdTaps[tapName] = ni
-				tm.Unlock()
-				err := ConfigIPtables(tapName, hostIface)
-				if err != nil {
-					return nil, err
+		ip, err := tm.bridges[i].allocator.Allocate()
+		if err == ErrAddressesExhausted {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Create a tap with this bridge
+		ni, err := tm.addTap(tapName, i, ip)
+		if err == nil {
+			if err = ConfigIPtables(tapName, hostIface); err != nil {
+				// Do not leave a half-configured tap behind
+				if err := tm.RemoveTap(tapName); err != nil {
+					netLog.WithFields(log.Fields{"tap": tapName}).Error("Failed to remove tap after failure")
 				}
 			}
-
-			return ni, err
 		}
+		if err != nil {
+			tm.releaseAddress(i, ip)
+			return nil, err
+		}
+
+		return ni, nil
 	}
-	log.Error("No space for creating taps")
+	netLog.Error("No space for creating taps")
 	return nil, errors.New("No space for creating taps")
 }
 
+// FreeTap Removes the tap and releases its address, unlike RemoveTap
+// after which the next AddTap of the tap reconnects it with the same address
+func (tm *TapManager) FreeTap(tapName string) error {
+	if err := tm.RemoveTap(tapName); err != nil {
+		return err
+	}
+
+	tm.Lock()
+	ni, ok := tm.createdTaps[tapName]
+	delete(tm.createdTaps, tapName)
+	tm.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	tm.freeEgress(ni.HostDevName)
+
+	for i := 0; i < tm.numBridges; i++ {
+		if getBridgeName(i) == ni.BridgeName {
+			tm.releaseAddress(i, net.ParseIP(ni.PrimaryAddress))
+		}
+	}
+
+	return nil
+}
+
+func (tm *TapManager) releaseAddress(bridgeID int, ip net.IP) {
+	if err := tm.bridges[bridgeID].allocator.Release(ip); err != nil {
+		netLog.WithError(err).Error("Failed to release the address of a tap")
+	}
+}
+
 // Reconnects a single tap with the same network interface that it was
 // create with previously
 func (tm *TapManager) reconnectTap(tapName string, ni *NetworkInterface) error {
-	logger := log.WithFields(log.Fields{"tap": tapName, "bridge": ni.BridgeName})
+	logger := netLog.WithFields(log.Fields{"tap": tapName, "bridge": ni.BridgeName})
 
 	la := netlink.NewLinkAttrs()
-	la.Name = tapName
+	// A prepared tap keeps the name of its device
+	la.Name = ni.HostDevName
 
 	logger.Debug("Reconnecting tap")
 
@@ -239,10 +328,10 @@ func (tm *TapManager) reconnectTap(tapName string, ni *NetworkInterface) error {
 }
 
 // Creates a single tap and connects it to the corresponding bridge
-func (tm *TapManager) addTap(tapName string, bridgeID, currentNumTaps int) (*NetworkInterface, error) {
+func (tm *TapManager) addTap(tapName string, bridgeID int, ip net.IP) (_ *NetworkInterface, retErr error) {
 	bridgeName := getBridgeName(bridgeID)
 
-	logger := log.WithFields(log.Fields{"tap": tapName, "bridge": bridgeName})
+	logger := netLog.WithFields(log.Fields{"tap": tapName, "bridge": bridgeName})
 
 	la := netlink.NewLinkAttrs()
 	la.Name = tapName
@@ -256,6 +345,15 @@ func (tm *TapManager) addTap(tapName string, bridgeID, currentNumTaps int) (*Net
 		return nil, err
 	}
 
+	defer func() {
+		// Delete the tap if it could not be fully configured
+		if retErr != nil {
+			if err := netlink.LinkDel(tap); err != nil {
+				logger.WithError(err).Error("Tap could not be removed after failure")
+			}
+		}
+	}()
+
 	br, err := netlink.LinkByName(bridgeName)
 	if err != nil {
 		logger.Error("Could not create tap, because corresponding bridge does not exist")
@@ -267,8 +365,7 @@ func (tm *TapManager) addTap(tapName string, bridgeID, currentNumTaps int) (*Net
 		return nil, err
 	}
 
-	macIndex := bridgeID*TapsPerBridge + currentNumTaps
-	macAddress := fmt.Sprintf("02:FC:00:00:%02X:%02X", macIndex/256, macIndex%256)
+	macAddress := getMacAddress(ip)
 
 	hwAddr, err := net.ParseMAC(macAddress)
 	if err != nil {
@@ -289,20 +386,33 @@ func (tm *TapManager) addTap(tapName string, bridgeID, currentNumTaps int) (*Net
 	return &NetworkInterface{
 		BridgeName:     bridgeName,
 		MacAddress:     macAddress,
-		PrimaryAddress: getPrimaryAddress(currentNumTaps, bridgeID),
+		PrimaryAddress: ip.String(),
 		HostDevName:    tapName,
-		Subnet:         Subnet,
-		GatewayAddress: getGatewayAddr(bridgeID),
+		Subnet:         tm.bridges[bridgeID].subnet,
+		GatewayAddress: tm.bridges[bridgeID].gateway,
 	}, nil
 }
 
 // RemoveTap Removes the tap
 func (tm *TapManager) RemoveTap(tapName string) error {
-	logger := log.WithFields(log.Fields{"tap": tapName})
+	devName := tapName
+
+	tm.Lock()
+	if ni, ok := tm.createdTaps[tapName]; ok {
+		devName = ni.HostDevName
+	}
+	tm.Unlock()
+
+	return removeLink(devName)
+}
+
+// removeLink removes the device of a tap
+func removeLink(devName string) error {
+	logger := netLog.WithFields(log.Fields{"tap": devName})
 
 	logger.Debug("Removing tap")
 
-	tap, err := netlink.LinkByName(tapName)
+	tap, err := netlink.LinkByName(devName)
 	if err != nil {
 		logger.Warn("Could not find tap")
 		return nil
@@ -316,13 +426,25 @@ func (tm *TapManager) RemoveTap(tapName string) error {
 	return nil
 }
 
+// FreeAddresses Returns the number of addresses left for new taps on all the bridges
+func (tm *TapManager) FreeAddresses() int {
+	free := 0
+	for _, br := range tm.bridges {
+		free += br.allocator.Free()
+	}
+
+	return free
+}
+
 // RemoveBridges Removes the bridges created by the tap manager
 func (tm *TapManager) RemoveBridges() {
-	log.Info("Removing bridges")
+	tm.stopPreparedTaps()
+
+	netLog.Info("Removing bridges")
 	for i := 0; i < tm.numBridges; i++ {
 		bridgeName := getBridgeName(i)
 
-		logger := log.WithFields(log.Fields{"bridge": bridgeName})
+		logger := netLog.WithFields(log.Fields{"bridge": bridgeName})
 
 		br, err := netlink.LinkByName(bridgeName)
 		if err != nil {
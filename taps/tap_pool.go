@@ -0,0 +1,218 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PreparedTapStats are the taps created ahead of the VMs, and how many VMs
+// got one rather than creating theirs
+type PreparedTapStats struct {
+	// Size is the number of taps kept ready, 0 if disabled
+	Size   int    `json:"size"`
+	Ready  int    `json:"ready"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// tapPool keeps taps created, attached to their bridge and with their iptables
+// rules, for the next VMs, replenished in the background. A prepared tap keeps
+// the name it was created with when a VM takes it.
+type tapPool struct {
+	sync.Mutex
+
+	size      int
+	hostIface string
+	ready     []*NetworkInterface
+	nextID    int
+	stats     PreparedTapStats
+
+	refill chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// EnablePreparedTaps keeps size taps ready for the VMs with the given host
+// interface, replenished in the background as the VMs take them
+func (tm *TapManager) EnablePreparedTaps(size int, hostIface string) {
+	p := &tapPool{
+		size:      size,
+		hostIface: hostIface,
+		refill:    make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	tm.Lock()
+	tm.prepared = p
+	tm.Unlock()
+
+	go tm.replenish(p)
+	p.signal()
+}
+
+// AcquirePreparedTap gives a prepared tap to the VM with the given tap name,
+// creating a fresh tap if none is ready
+func (tm *TapManager) AcquirePreparedTap(tapName, hostIface string) (*NetworkInterface, error) {
+	tm.Lock()
+	p := tm.prepared
+	tm.Unlock()
+
+	if p != nil {
+		if ni := p.take(hostIface); ni != nil {
+			netLog.WithFields(log.Fields{"tap": tapName, "device": ni.HostDevName}).Debug("Acquired prepared tap")
+
+			tm.Lock()
+			tm.createdTaps[tapName] = ni
+			tm.Unlock()
+
+			return ni, nil
+		}
+	}
+
+	return tm.AddTap(tapName, hostIface)
+}
+
+// PreparedTapStats returns the hits and misses of the prepared taps
+func (tm *TapManager) PreparedTapStats() PreparedTapStats {
+	tm.Lock()
+	p := tm.prepared
+	tm.Unlock()
+
+	if p == nil {
+		return PreparedTapStats{}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	stats := p.stats
+	stats.Size = p.size
+	stats.Ready = len(p.ready)
+
+	return stats
+}
+
+// take returns a prepared tap, nil if none is ready for the host interface
+func (p *tapPool) take(hostIface string) *NetworkInterface {
+	p.Lock()
+	defer p.Unlock()
+
+	if hostIface != p.hostIface || len(p.ready) == 0 {
+		p.stats.Misses++
+		return nil
+	}
+
+	ni := p.ready[0]
+	p.ready = p.ready[1:]
+	p.stats.Hits++
+	p.signal()
+
+	return ni
+}
+
+func (p *tapPool) signal() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+// replenish creates the missing prepared taps whenever the pool is signaled,
+// until it is stopped
+func (tm *TapManager) replenish(p *tapPool) {
+	defer close(p.done)
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.refill:
+		}
+
+		for {
+			p.Lock()
+			missing := len(p.ready) < p.size
+			name := fmt.Sprintf("pool%d_tap", p.nextID)
+			p.nextID++
+			p.Unlock()
+
+			if !missing {
+				break
+			}
+
+			ni, err := tm.create(name, p.hostIface)
+			if err != nil {
+				// Retried when the next prepared tap is taken
+				netLog.WithError(err).WithField("tap", name).Warn("Failed to prepare tap")
+				break
+			}
+
+			p.Lock()
+			p.ready = append(p.ready, ni)
+			p.Unlock()
+
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// stopPreparedTaps stops replenishing the prepared taps and removes the ready ones
+func (tm *TapManager) stopPreparedTaps() {
+	tm.Lock()
+	p := tm.prepared
+	tm.prepared = nil
+	tm.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	close(p.stop)
+	<-p.done
+
+	p.Lock()
+	ready := p.ready
+	p.ready = nil
+	p.Unlock()
+
+	for _, ni := range ready {
+		if err := removeLink(ni.HostDevName); err != nil {
+			continue
+		}
+		for i := 0; i < tm.numBridges; i++ {
+			if getBridgeName(i) == ni.BridgeName {
+				tm.releaseAddress(i, net.ParseIP(ni.PrimaryAddress))
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// MIT License
+//
+// Copyright (c) 2021 EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTaps records the taps created by a tap manager without touching the host
+type fakeTaps struct {
+	sync.Mutex
+	created []string
+	// failPrepared makes the creation of the prepared taps fail
+	failPrepared bool
+}
+
+func (f *fakeTaps) create(tapName, hostIface string) (*NetworkInterface, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.failPrepared && strings.HasPrefix(tapName, "pool") {
+		return nil, errors.New("no space for creating taps")
+	}
+	f.created = append(f.created, tapName)
+
+	return &NetworkInterface{HostDevName: tapName, BridgeName: getBridgeName(0)}, nil
+}
+
+func (f *fakeTaps) createdTaps() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	return append([]string(nil), f.created...)
+}
+
+func newFakeTapManager(f *fakeTaps) *TapManager {
+	tm := &TapManager{createdTaps: make(map[string]*NetworkInterface)}
+	tm.create = f.create
+
+	return tm
+}
+
+func TestAcquirePreparedTap(t *testing.T) {
+	f := &fakeTaps{}
+	tm := newFakeTapManager(f)
+	tm.EnablePreparedTaps(2, "eth0")
+	defer tm.stopPreparedTaps()
+
+	require.Eventually(t, func() bool { return tm.PreparedTapStats().Ready == 2 }, time.Second, time.Millisecond)
+
+	ni, err := tm.AcquirePreparedTap("1_tap", "eth0")
+	require.NoError(t, err)
+	require.Equal(t, "pool0_tap", ni.HostDevName)
+	require.NotContains(t, f.createdTaps(), "1_tap", "A prepared tap must not be created again")
+	require.Equal(t, ni, tm.createdTaps["1_tap"])
+
+	// The taken tap is replaced in the background
+	require.Eventually(t, func() bool { return tm.PreparedTapStats().Ready == 2 }, time.Second, time.Millisecond)
+
+	stats := tm.PreparedTapStats()
+	require.Equal(t, PreparedTapStats{Size: 2, Ready: 2, Hits: 1}, stats)
+	require.Len(t, f.createdTaps(), 3)
+}
+
+func TestAcquirePreparedTapEmpty(t *testing.T) {
+	f := &fakeTaps{failPrepared: true}
+	tm := newFakeTapManager(f)
+	tm.EnablePreparedTaps(2, "eth0")
+	defer tm.stopPreparedTaps()
+
+	ni, err := tm.AcquirePreparedTap("1_tap", "eth0")
+	require.NoError(t, err)
+	require.Equal(t, "1_tap", ni.HostDevName, "An empty pool must fall back to creating the tap")
+	require.Equal(t, []string{"1_tap"}, f.createdTaps())
+
+	// Another host interface than the prepared taps' also falls back
+	f.Lock()
+	f.failPrepared = false
+	f.Unlock()
+	ni, err = tm.AcquirePreparedTap("2_tap", "eth1")
+	require.NoError(t, err)
+	require.Equal(t, "2_tap", ni.HostDevName)
+
+	stats := tm.PreparedTapStats()
+	require.Equal(t, uint64(0), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestAcquirePreparedTapDisabled(t *testing.T) {
+	f := &fakeTaps{}
+	tm := newFakeTapManager(f)
+
+	ni, err := tm.AcquirePreparedTap("1_tap", "eth0")
+	require.NoError(t, err)
+	require.Equal(t, "1_tap", ni.HostDevName)
+	require.Equal(t, PreparedTapStats{}, tm.PreparedTapStats())
+}
@@ -38,9 +38,24 @@ const (
 // TapManager A Tap Manager
 type TapManager struct {
 	sync.Mutex
-	numBridges         int
-	TapCountsPerBridge []int64
-	createdTaps        map[string]*NetworkInterface
+	numBridges  int
+	bridges     []tapBridge
+	createdTaps map[string]*NetworkInterface
+	// create creates a tap, replaced in the tests
+	create   func(tapName, hostIface string) (*NetworkInterface, error)
+	prepared *tapPool
+	// iptables runs an iptables command, replaced in the tests
+	iptables func(args ...string) ([]byte, error)
+	// egressTaps are the tap devices with an egress policy
+	egressTaps map[string]bool
+}
+
+// tapBridge is a bridge of the taps and the allocator of the addresses of its VMs
+type tapBridge struct {
+	gateway string
+	// subnet is the mask length of the subnet of the bridge, e.g., /10
+	subnet    string
+	allocator IPAllocator
 }
 
 // NetworkInterface Network interface type, NI names are generated based on expected tap names
@@ -51,4 +66,6 @@ type NetworkInterface struct {
 	PrimaryAddress string
 	Subnet         string
 	GatewayAddress string
+	// NetNS is the network namespace of the tap, the host namespace if empty
+	NetNS string
 }
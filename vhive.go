@@ -24,20 +24,30 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	ctrdlog "github.com/containerd/containerd/log"
 	fccdcri "github.com/ease-lab/vhive/cri"
 	ctriface "github.com/ease-lab/vhive/ctriface"
+	"github.com/ease-lab/vhive/deviceplugin"
 	hpb "github.com/ease-lab/vhive/examples/protobuf/helloworld"
+	"github.com/ease-lab/vhive/logging"
 	pb "github.com/ease-lab/vhive/proto"
+	"github.com/ease-lab/vhive/taps"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -45,6 +55,10 @@ const (
 	fwdPort = ":3334"
 
 	testImageName = "vhiveease/helloworld:var_workload"
+
+	// The backends of the VMs of the functions
+	backendFirecracker = "firecracker"
+	backendMock        = "mock"
 )
 
 var (
@@ -61,6 +75,81 @@ var (
 	pinnedFuncNum      *int
 	criSock            *string
 	hostIface          *string
+	guestAgentPort     *uint
+	configPath         *string
+	kubeEvents         *bool
+	kubeconfig         *string
+	createRate         *float64
+	createBurst        *int
+	createQueue        *int
+	maxBoots           *int
+	bootQueue          *int
+	bootQueueTimeout   *time.Duration
+	auditLogPath       *string
+	auditLogMaxSize    *int
+	auditLogBackups    *int
+	bootLatencyLogPath *string
+	bootLatencyMaxSize *int
+	bootLatencyBackups *int
+	faultInjection     *bool
+	snapStoreLocation  *string
+	snapStoreEndpoint  *string
+	snapStoreRegion    *string
+	snapPeerAddr       *string
+	snapPeerAdvertise  *string
+	snapPeerRate       *int
+	debugAddr          *string
+	healthAddr         *string
+	devmapperPool      *string
+	devmapperThreshold *float64
+	adminSock          *string
+	tlsCert            *string
+	tlsKey             *string
+	tlsClientCA        *string
+	tlsRequireClient   *bool
+	snapshotPrefetch   *time.Duration
+	extraDiskDir       *string
+	vmIDState          *string
+	admissionState     *string
+	extraDiskPolicy    *string
+	mmdsLabels         *string
+	mmdsAnnotations    *string
+	imagePullRetries   *int
+	imagePullBackoff   *time.Duration
+	imageCacheTTL      *time.Duration
+	imageDigestTTL     *time.Duration
+	rootfsMode         *string
+	jailerChrootBase   *string
+	jailerUIDBase      *uint
+	jailerUIDCount     *uint
+	jailerGID          *uint
+	jailerCgroup       *string
+	jailerNetNS        *string
+	cniConfDir         *string
+	cniBinDir          *string
+	cniNetwork         *string
+	kataHandler        *string
+	vmSubnets          *string
+	vmReservedRanges   *string
+	preparedTaps       *int
+	isNUMAEnabled      *bool
+	isCPUBoostEnabled  *bool
+	hugetlbfsDir       *string
+	guestKernels       *string
+	virtiofsWritable   *bool
+	fcVersions         *string
+	fcDefaultVersion   *string
+	evictVMs           *bool
+	memCommitRatio     *float64
+	healthCheck        *time.Duration
+	microVMReservation *uint64
+	devicePluginDir    *string
+	podVMConfigTTL     *time.Duration
+	scaleToZeroTimeout *time.Duration
+	slotReuse          *int
+	slotReuseTTL       *time.Duration
+	connProxyIP        *string
+	backend            *string
 )
 
 func main() {
@@ -79,10 +168,95 @@ func main() {
 	pinnedFuncNum = flag.Int("hn", 0, "Number of functions pinned in memory (IDs from 0 to X)")
 	isLazyMode = flag.Bool("lazy", false, "Enable lazy serving mode when UPFs are enabled")
 	criSock = flag.String("criSock", "/etc/firecracker-containerd/fccd-cri.sock", "Socket address for CRI service")
+	backend = flag.String("backend", backendFirecracker, "Backend of the VMs of the functions, firecracker or mock, whose in-process stand-ins of the guests need no KVM (development and testing only)")
 	hostIface = flag.String("hostIface", "", "Host net-interface for the VMs to bind to for internet access")
+	mmdsLabels = flag.String("mmdsLabels", "app,app.kubernetes.io/*,serving.knative.dev/*", "Comma-separated pod labels exposed to the guests by MMDS (a trailing * matches a prefix)")
+	mmdsAnnotations = flag.String("mmdsAnnotations", "", "Comma-separated pod annotations exposed to the guests by MMDS (a trailing * matches a prefix)")
+	imagePullRetries = flag.Int("imagePullRetries", 3, "Number of retries of a failed guest image pull (registry and network errors only)")
+	imagePullBackoff = flag.Duration("imagePullBackoff", time.Second, "Delay before the first retry of a failed guest image pull, doubled with every retry")
+	imageDigestTTL = flag.Duration("imageDigestTTL", 0, "Pin the guest images of the user containers to the digests of their tags at creation, caching the digest of a tag for this long (0 disables pinning)")
+	imageCacheTTL = flag.Duration("imageCacheTTL", 5*time.Minute, "Time the guest image resolved for a tag is reused before the tag is resolved again, images pinned by digest are reused until restart (0 reuses tags until restart)")
+	rootfsMode = flag.String("rootfsMode", string(ctriface.RootfsCopy), "Whether each VM gets a writable copy of the function image or shares it read-only with a writable tmpfs overlay (copy or overlay)")
+	jailerChrootBase = flag.String("jailerChrootBase", "", "Directory of the jails of the VMs (empty launches firecracker without the jailer)")
+	jailerUIDBase = flag.Uint("jailerUIDBase", 100000, "First uid of the range given to the jailed VMs")
+	jailerUIDCount = flag.Uint("jailerUIDCount", 1000, "Number of uids given to the jailed VMs (the maximum number of running VMs)")
+	jailerGID = flag.Uint("jailerGID", 100000, "Group of the jailed VMs")
+	jailerCgroup = flag.String("jailerCgroup", "", "Parent cgroup of the jailed VMs (empty uses the firecracker-containerd default)")
+	jailerNetNS = flag.String("jailerNetNS", "", "Network namespace of the jailed VMs (empty uses the host namespace)")
+	cniConfDir = flag.String("cniConfDir", "", "Directory of the CNI network of the VMs (empty keeps the VMs in the host network namespace)")
+	cniBinDir = flag.String("cniBinDir", "/opt/cni/bin", "Directory of the CNI plugins")
+	cniNetwork = flag.String("cniNetwork", "", "Name of the CNI network of the VMs (empty uses the first network of -cniConfDir)")
+	kataHandler = flag.String("kataRuntimeHandler", "", "Containerd runtime handler of the pods annotated with vhive.io/sandbox: kata (empty disables Kata Containers)")
+	vmSubnets = flag.String("vmSubnets", "", "Comma-separated subnets of the VMs, one bridge each, as <CIDR>[@<gateway>] (empty uses 190.128.0.0/10 and 191.128.0.0/10)")
+	vmReservedRanges = flag.String("vmReservedRanges", "", "Comma-separated ranges of the subnets of the VMs never assigned to VMs, e.g., host networks, as CIDRs, <first>-<last> ranges or addresses")
+	preparedTaps = flag.Int("preparedTaps", 0, "Number of taps created ahead of the VMs, replenished in the background, for the VMs to boot without waiting for their tap (0 disables them)")
+	isNUMAEnabled = flag.Bool("numa", false, "Place each jailed VM on the NUMA node with the least committed memory")
+	isCPUBoostEnabled = flag.Bool("cpuBoost", false, "Boost the CPU quota of the jailed VMs with the vhive.io/cpu-boost annotation during their cold start")
+	hugetlbfsDir = flag.String("hugetlbfsDir", "", "Hugetlbfs mount backing the guest memory of the functions with the vhive.io/hugepages annotation (empty disables hugepages)")
+	guestKernels = flag.String("guestKernels", "", "Comma-separated host paths of the guest kernels the functions may select with GUEST_KERNEL_IMAGE")
+	fcVersions = flag.String("firecrackerVersions", "", "Comma-separated firecracker releases the functions may select with GUEST_FC_VERSION, as <version>=<binary path>")
+	fcDefaultVersion = flag.String("firecrackerDefaultVersion", "", "Firecracker release of the functions without GUEST_FC_VERSION, one of -firecrackerVersions (empty uses the newest)")
+	virtiofsWritable = flag.Bool("virtiofsWritable", false, "Allow the functions to share host directories writable with GUEST_VIRTIOFS_MOUNTS")
+	evictVMs = flag.Bool("evictVMs", false, "Evict the least-recently-used idle VM when a new VM cannot be started for lack of memory")
+	memCommitRatio = flag.Float64("memCommitRatio", 0, "Fraction of the host memory that may be committed to guest memory, beyond which functions are rejected (0 disables admission)")
+	healthCheck = flag.Duration("healthCheck", 0, "Interval of the health checks of the guest agents, the VMs failing consecutive checks are marked unhealthy (0 disables them)")
+	microVMReservation = flag.Uint64("microVMReservation", 0, "Memory in MiB reserved per microVM slot advertised to kubelet as the vhive.io/microvms resource (0 disables it)")
+	devicePluginDir = flag.String("devicePluginDir", deviceplugin.DefaultDir, "Directory of the kubelet device plugin sockets")
+	podVMConfigTTL = flag.Duration("podVMConfigTTL", 10*time.Minute, "Time after which a VM whose queue-proxy was not created is stopped (0 disables it)")
+	scaleToZeroTimeout = flag.Duration("scaleToZeroTimeout", 5*time.Minute, "Idle time after which the VMs of the functions with SCALE_TO_ZERO=true are offloaded to their snapshot (requires -snapshots, 0 disables it)")
+	snapshotPrefetch = flag.Duration("snapshotPrefetch", 0, "Read the snapshot files of the VMs into the page cache before restoring them, once for the restores of a snapshot within this window (requires -snapshots, 0 disables it)")
+	slotReuse = flag.Int("slotReuse", 0, "Number of VMs of removed user containers parked per revision for the next containers of the revision to adopt (0 disables it)")
+	slotReuseTTL = flag.Duration("slotReuseTTL", time.Minute, "Time after which a parked VM that was not adopted is released")
+	connProxyIP = flag.String("connProxyIP", "", "Host address the queue-proxies reach the connection proxies of the VMs on, e.g., the node IP (empty disables vhive.io/connection-proxy)")
+	debugAddr = flag.String("debugAddr", "127.0.0.1:3335", "Address of the debug HTTP endpoints (empty disables them)")
+	healthAddr = flag.String("healthAddr", "127.0.0.1:3336", "Address of the /healthz and /readyz probes of vHive (empty disables them)")
+	devmapperPool = flag.String("devmapperPool", "fc-dev-thinpool", "Devmapper thin pool of the VM rootfs checked by /readyz (empty disables the check)")
+	devmapperThreshold = flag.Float64("devmapperPoolThreshold", 0.9, "Fraction of the data or metadata of -devmapperPool in use beyond which vHive is not ready")
+	adminSock = flag.String("adminSock", "/etc/firecracker-containerd/vhive-admin.sock", "Socket address of the admin service used by vhivectl (empty disables it)")
+	tlsCert = flag.String("tlsCert", "", "Certificate of the admin service, the debug endpoints and the snapshot peers, served over TLS if set, reloaded when the file changes")
+	tlsKey = flag.String("tlsKey", "", "Key of -tlsCert, reloaded when the file changes")
+	tlsClientCA = flag.String("tlsClientCA", "", "CA the client certificates of the admin service, the debug endpoints and the snapshot peers, and the certificates of the peers of the other nodes, are verified against (empty does not authenticate the clients)")
+	tlsRequireClient = flag.Bool("tlsRequireClientCert", false, "Reject the clients of the admin service, the debug endpoints and the snapshot peers without a certificate of -tlsClientCA")
+	extraDiskDir = flag.String("extraDiskDir", "/var/lib/vhive/disks", "Directory of the extra disks requested by functions")
+	vmIDState = flag.String("vmIDState", "/var/lib/vhive/vmid", "State file of the counter of the vmIDs, which keep increasing across restarts (empty restarts them from 1)")
+	admissionState = flag.String("admissionState", "/var/lib/vhive/admission", "State file of the admission mode set through the admin API, which is kept across restarts (empty opens the node at start)")
+	extraDiskPolicy = flag.String("extraDiskPolicy", string(fccdcri.DiskCleanupDelete), "Whether extra disks are deleted or retained when their VM stops (delete or retain)")
+	createRate = flag.Float64("createRate", 0, "Rate per second of the creation of the user containers of each revision (0 disables rate limiting)")
+	createBurst = flag.Int("createBurst", 5, "Number of user containers of a revision created at once before -createRate applies")
+	createQueue = flag.Int("createQueue", 20, "Number of user containers of a revision waiting for -createRate before the others are rejected")
+	maxBoots = flag.Int("maxBoots", 0, "Number of VMs of user containers booting at once on the node (0 disables the limit)")
+	bootQueue = flag.Int("bootQueue", 20, "Number of VM boots waiting for -maxBoots before the others are rejected")
+	bootQueueTimeout = flag.Duration("bootQueueTimeout", 30*time.Second, "Time a VM boot waits for -maxBoots before it is rejected")
+	auditLogPath = flag.String("auditLog", "", "File of the audit log of the VM lifecycle operations, - for stdout (empty disables it)")
+	auditLogMaxSize = flag.Int("auditLogMaxSize", 100, "Size in MiB at which the audit log is rotated (0 disables rotation)")
+	auditLogBackups = flag.Int("auditLogBackups", 5, "Number of rotated audit logs kept")
+	bootLatencyLogPath = flag.String("bootLatencyLog", "", "File of the breakdown of the cold start of each VM as JSON lines, - for stdout (empty disables it)")
+	bootLatencyMaxSize = flag.Int("bootLatencyLogMaxSize", 100, "Size in MiB at which the boot latency log is rotated (0 disables rotation)")
+	bootLatencyBackups = flag.Int("bootLatencyLogBackups", 5, "Number of rotated boot latency logs kept")
+	faultInjection = flag.Bool("faultInjection", false, "Serve /debug/faults to inject failures in the VM lifecycle (testing only)")
+	snapStoreLocation = flag.String("snapshotStore", "", "Directory or s3://bucket/prefix the VM snapshots are pushed to and pulled from if lost on the node (empty disables it)")
+	snapStoreEndpoint = flag.String("snapshotStoreEndpoint", "", "URL of the S3-compatible store of -snapshotStore, e.g., http://minio:9000 (empty for AWS S3)")
+	snapStoreRegion = flag.String("snapshotStoreRegion", "us-east-1", "Region of the bucket of -snapshotStore")
+	snapPeerAddr = flag.String("snapshotPeerAddr", "", "Address of the peer service the other nodes pull the VM snapshots of the node from before -snapshotStore, e.g., :3337 (empty disables it). The nodes authenticate each other over TLS with -tlsCert and -tlsClientCA, without which the service is in plaintext and must be bound to an address only the nodes reach, e.g., of their private network")
+	snapPeerAdvertise = flag.String("snapshotPeerAdvertise", "", "Address of -snapshotPeerAddr announced to the other nodes in -snapshotStore, e.g., the node IP and port (empty uses the hostname and the port of -snapshotPeerAddr)")
+	snapPeerRate = flag.Int("snapshotPeerRate", 0, "Rate in MiB/s at which the VM snapshots are served to the other nodes (0 disables the limit)")
+	configPath = flag.String("config", "", "YAML file of the configuration of the VMs, reloaded on SIGHUP (empty uses the defaults)")
+	kubeEvents = flag.Bool("kubeEvents", false, "Post the lifecycle events of the VMs, e.g., how they were started, as Kubernetes events on their pods")
+	kubeconfig = flag.String("kubeconfig", "", "Kubeconfig of the API server the events of -kubeEvents are posted to (empty uses the in-cluster config)")
+	guestAgentPort = flag.Uint("guestAgentPort", 0, "Vsock port of the guest agent in the VMs (0 disables the guest agent channel)")
 
 	flag.Parse()
 
+	if *backend != backendFirecracker && *backend != backendMock {
+		log.Errorf("Unknown backend %q", *backend)
+		return
+	}
+
+	if *backend == backendMock && (*isUPFEnabled || *snapStoreLocation != "" || *jailerChrootBase != "" || *cniConfDir != "") {
+		log.Error("REAP, the snapshot store, the jailer and CNI networking are not supported with the mock backend")
+		return
+	}
+
 	if *isUPFEnabled && !*isSnapshotsEnabled {
 		log.Error("User-level page faults are not supported without snapshots")
 		return
@@ -93,41 +267,152 @@ func main() {
 		return
 	}
 
+	if policy := fccdcri.DiskCleanupPolicy(*extraDiskPolicy); policy != fccdcri.DiskCleanupDelete && policy != fccdcri.DiskCleanupRetain {
+		log.Errorf("Unknown extra disk cleanup policy %q", *extraDiskPolicy)
+		return
+	}
+
+	if *snapStoreLocation != "" && !*isSnapshotsEnabled {
+		log.Error("The snapshot store is not supported without snapshots")
+		return
+	}
+
+	if *snapPeerAddr != "" && *snapStoreLocation == "" {
+		log.Error("The snapshot peers are announced in the snapshot store, which is required")
+		return
+	}
+
+	if *snapPeerAddr != "" && *snapPeerAdvertise == "" {
+		_, port, err := net.SplitHostPort(*snapPeerAddr)
+		if err != nil {
+			log.Errorf("Invalid -snapshotPeerAddr: %v", err)
+			return
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Errorf("Failed to get the hostname announced to the snapshot peers: %v", err)
+			return
+		}
+		*snapPeerAdvertise = net.JoinHostPort(hostname, port)
+	}
+
+	if *jailerChrootBase != "" && *isSnapshotsEnabled {
+		log.Error("Snapshots are not supported with the jailer")
+		return
+	}
+
+	if *cniConfDir != "" && (*jailerChrootBase == "" || *isSnapshotsEnabled) {
+		log.Error("CNI networking requires the jailer and is not supported with snapshots")
+		return
+	}
+
+	if (*vmSubnets != "" || *vmReservedRanges != "") && *cniConfDir != "" {
+		log.Error("The subnets of the VMs are assigned by the CNI plugins with CNI networking")
+		return
+	}
+
+	if *preparedTaps < 0 {
+		log.Error("The number of prepared taps cannot be negative")
+		return
+	}
+
+	if *preparedTaps > 0 && *cniConfDir != "" {
+		log.Error("The taps of the VMs are created by the CNI plugins with CNI networking")
+		return
+	}
+
+	if *isNUMAEnabled && *jailerChrootBase == "" {
+		log.Error("NUMA placement requires the jailer")
+		return
+	}
+
+	if *isCPUBoostEnabled && *jailerChrootBase == "" {
+		log.Error("CPU boost requires the jailer")
+		return
+	}
+
+	vmRootfsMode, err := ctriface.ParseRootfsMode(*rootfsMode)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
 	if flog, err = os.Create("/tmp/fccd.log"); err != nil {
 		panic(err)
 	}
 	defer flog.Close()
 
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: ctrdlog.RFC3339NanoFixed,
-		FullTimestamp:   true,
-	})
 	//log.SetReportCaller(true) // FIXME: make sure it's false unless debugging
 
-	log.SetOutput(os.Stdout)
-
+	// The components log at this level unless the config file sets their own
+	logLevel := log.InfoLevel
 	if *debug {
-		log.SetLevel(log.DebugLevel)
-		log.Debug("Debug logging is enabled")
-	} else {
-		log.SetLevel(log.InfoLevel)
+		logLevel = log.DebugLevel
 	}
+	logging.Setup(os.Stdout, &log.TextFormatter{
+		TimestampFormat: ctrdlog.RFC3339NanoFixed,
+		FullTimestamp:   true,
+	}, logLevel)
+	log.Debug("Debug logging is enabled")
 
 	if *isSaveMemory {
 		log.Info(fmt.Sprintf("Creating orchestrator for pinned=%d functions", *pinnedFuncNum))
 	}
 
+	// The mock backend only serves the CRI, without the orchestrator of the legacy API
+	if *backend == backendMock {
+		log.Warn("Using the mock backend, the functions do not run in VMs")
+		criServe()
+		return
+	}
+
 	testModeOn := false
 
-	orch = ctriface.NewOrchestrator(
-		*snapshotter,
-		*hostIface,
+	orchOpts := []ctriface.OrchestratorOption{
 		ctriface.WithTestModeOn(testModeOn),
 		ctriface.WithSnapshots(*isSnapshotsEnabled),
 		ctriface.WithUPF(*isUPFEnabled),
 		ctriface.WithMetricsMode(*isMetricsMode),
 		ctriface.WithLazyMode(*isLazyMode),
-	)
+		ctriface.WithImagePullRetries(*imagePullRetries),
+		ctriface.WithImagePullBackoff(*imagePullBackoff),
+		ctriface.WithImageCacheTTL(*imageCacheTTL),
+		ctriface.WithRootfsMode(vmRootfsMode),
+		ctriface.WithNUMAPlacement(*isNUMAEnabled),
+		ctriface.WithCPUBoosting(*isCPUBoostEnabled),
+		ctriface.WithHugetlbfs(*hugetlbfsDir),
+		ctriface.WithPreparedTaps(*preparedTaps),
+	}
+	if *jailerChrootBase != "" {
+		orchOpts = append(orchOpts, ctriface.WithJailer(ctriface.JailerConfig{
+			ChrootBaseDir: *jailerChrootBase,
+			UIDBase:       uint32(*jailerUIDBase),
+			UIDCount:      uint32(*jailerUIDCount),
+			GID:           uint32(*jailerGID),
+			CgroupPath:    *jailerCgroup,
+			NetNS:         *jailerNetNS,
+		}))
+	}
+
+	if *cniConfDir != "" {
+		orchOpts = append(orchOpts, ctriface.WithCNI(taps.CNIConfig{
+			ConfDir:     *cniConfDir,
+			BinDir:      *cniBinDir,
+			NetworkName: *cniNetwork,
+			TapGroup:    uint32(*jailerGID),
+		}))
+	}
+
+	if *vmSubnets != "" || *vmReservedRanges != "" {
+		subnets, err := taps.ParseSubnets(*vmSubnets, *vmReservedRanges)
+		if err != nil {
+			log.Errorf("invalid -vmSubnets: %v", err)
+			return
+		}
+		orchOpts = append(orchOpts, ctriface.WithVMSubnets(subnets))
+	}
+
+	orch = ctriface.NewOrchestrator(*snapshotter, *hostIface, orchOpts...)
 
 	funcPool = NewFuncPool(*isSaveMemory, *servedThreshold, *pinnedFuncNum, testModeOn)
 
@@ -152,18 +437,284 @@ func criServe() {
 
 	s := grpc.NewServer()
 
-	criService, err := fccdcri.NewService(orch)
+	config := fccdcri.DefaultConfig()
+	if *configPath != "" {
+		if config, err = fccdcri.LoadConfig(*configPath); err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+	}
+
+	var auditLog *fccdcri.AuditLog
+	if *auditLogPath != "" {
+		if auditLog, err = fccdcri.OpenAuditLog(*auditLogPath, *auditLogMaxSize, *auditLogBackups); err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+	}
+
+	var bootLatencyLog *fccdcri.BootLatencyLog
+	if *bootLatencyLogPath != "" {
+		if bootLatencyLog, err = fccdcri.OpenBootLatencyLog(*bootLatencyLogPath, *bootLatencyMaxSize, *bootLatencyBackups); err != nil {
+			log.Fatalf("failed to open boot latency log: %v", err)
+		}
+		defer bootLatencyLog.Close()
+	}
+
+	var snapStore fccdcri.SnapshotStore
+	if *snapStoreLocation != "" {
+		if snapStore, err = fccdcri.OpenSnapshotStore(*snapStoreLocation, *snapStoreEndpoint, *snapStoreRegion); err != nil {
+			log.Fatalf("failed to open snapshot store: %v", err)
+		}
+	}
+
+	var eventRecorder fccdcri.EventRecorder
+	if *kubeEvents {
+		nodeName, _ := os.Hostname()
+		recorder, err := fccdcri.NewKubeEventRecorder(*kubeconfig, nodeName)
+		if err != nil {
+			log.Fatalf("failed to create Kubernetes event recorder: %v", err)
+		}
+		defer recorder.Close()
+		eventRecorder = recorder
+	}
+
+	fcBinaries, err := fccdcri.ParseFirecrackerVersions(splitList(*fcVersions), *fcDefaultVersion)
+	if err != nil {
+		log.Fatalf("invalid -firecrackerVersions: %v", err)
+	}
+
+	// The digests of the images are resolved by the orchestrator, without which they are not pinned
+	var imageResolver fccdcri.ImageResolver
+	if orch != nil {
+		imageResolver = orch
+	}
+
+	// The snapshot peers of the nodes authenticate each other with the TLS of the endpoints
+	var endpointTLS, peerTLS *tls.Config
+	if cfg := (fccdcri.EndpointTLS{
+		CertFile:          *tlsCert,
+		KeyFile:           *tlsKey,
+		ClientCAFile:      *tlsClientCA,
+		RequireClientCert: *tlsRequireClient,
+	}); cfg.Enabled() {
+		if endpointTLS, err = fccdcri.NewEndpointTLS(cfg); err != nil {
+			log.Fatalf("invalid TLS configuration of the admin and debug endpoints: %v", err)
+		}
+		if peerTLS, err = fccdcri.NewPeerTLS(cfg); err != nil {
+			log.Fatalf("invalid TLS configuration of the snapshot peers: %v", err)
+		}
+	}
+
+	serviceOpts := []fccdcri.ServiceOption{
+		fccdcri.WithConfig(config),
+		fccdcri.WithGuestAgent(uint32(*guestAgentPort)),
+		fccdcri.WithExtraDisks(*extraDiskDir, fccdcri.DiskCleanupPolicy(*extraDiskPolicy)),
+		fccdcri.WithMetadataAllowList(splitList(*mmdsLabels), splitList(*mmdsAnnotations)),
+		fccdcri.WithKernelAllowList(splitList(*guestKernels)),
+		fccdcri.WithWritableVirtiofsMounts(*virtiofsWritable),
+		fccdcri.WithFirecrackerVersions(fcBinaries, *fcDefaultVersion),
+		fccdcri.WithEviction(*evictVMs),
+		fccdcri.WithMemoryCommitRatio(*memCommitRatio),
+		fccdcri.WithHealthCheck(*healthCheck),
+		fccdcri.WithMicroVMResource(*microVMReservation, *devicePluginDir),
+		fccdcri.WithPodVMConfigTTL(*podVMConfigTTL),
+		fccdcri.WithScaleToZero(*scaleToZeroTimeout),
+		fccdcri.WithSlotReuse(*slotReuse, *slotReuseTTL),
+		fccdcri.WithSnapshotPrefetch(*snapshotPrefetch),
+		fccdcri.WithConnectionProxy(*connProxyIP),
+		fccdcri.WithCreateRateLimit(*createRate, *createBurst, *createQueue),
+		fccdcri.WithBootLimit(*maxBoots, *bootQueue, *bootQueueTimeout),
+		fccdcri.WithImageDigests(imageResolver, *imageDigestTTL),
+		fccdcri.WithAuditLog(auditLog),
+		fccdcri.WithBootLatencyLog(bootLatencyLog),
+		fccdcri.WithFaultInjection(*faultInjection),
+		fccdcri.WithSnapshotStore(snapStore),
+		fccdcri.WithSnapshotPeers(*snapPeerAdvertise, int64(*snapPeerRate)<<20, peerTLS),
+		fccdcri.WithHealthChecks(livenessChecks(), readinessChecks()),
+		fccdcri.WithEventRecorder(eventRecorder),
+		fccdcri.WithKata(*kataHandler),
+		fccdcri.WithVMIDState(*vmIDState),
+		fccdcri.WithAdmissionState(*admissionState),
+	}
+
+	var criService *fccdcri.Service
+	if *backend == backendMock {
+		criService, err = fccdcri.NewMockService(*isSnapshotsEnabled, serviceOpts...)
+	} else {
+		criService, err = fccdcri.NewService(orch, serviceOpts...)
+	}
 	if err != nil {
 		log.Fatalf("failed to create CRI service %v", err)
 	}
+	defer criService.Shutdown()
 
 	criService.Register(s)
 
+	if *configPath != "" {
+		go reloadConfigOnHangup(criService)
+	}
+
+	if *debugAddr != "" {
+		go debugServe(criService, endpointTLS)
+	}
+
+	if *healthAddr != "" {
+		go healthServe(criService)
+	}
+
+	if *adminSock != "" {
+		go adminServe(criService, endpointTLS)
+	}
+
+	if *snapPeerAddr != "" {
+		go snapshotPeerServe(criService, endpointTLS)
+	}
+
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
 
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// reloadConfigOnHangup reloads the config file whenever vHive receives SIGHUP
+func reloadConfigOnHangup(criService *fccdcri.Service) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		// An invalid config is logged and the current one is kept
+		_ = criService.ReloadConfig(*configPath)
+	}
+}
+
+func debugServe(criService *fccdcri.Service, tlsConfig *tls.Config) {
+	srv := &http.Server{
+		Addr:      *debugAddr,
+		Handler:   criService.DebugHandler(),
+		TLSConfig: tlsConfig,
+	}
+
+	var err error
+	if tlsConfig != nil {
+		log.Println("Debug endpoints listening with TLS on " + *debugAddr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Println("Debug endpoints listening on " + *debugAddr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		log.Fatalf("failed to serve debug endpoints: %v", err)
+	}
+}
+
+func healthServe(criService *fccdcri.Service) {
+	log.Println("Health probes listening on " + *healthAddr)
+	if err := http.ListenAndServe(*healthAddr, criService.HealthHandler()); err != nil {
+		log.Fatalf("failed to serve health probes: %v", err)
+	}
+}
+
+// livenessChecks are the checks of /healthz on top of the built-in ones
+func livenessChecks() []fccdcri.HealthCheck {
+	return []fccdcri.HealthCheck{{
+		// The CRI server is serving if it completes the handshake of a connection
+		Name: "cri_server",
+		Check: func(ctx context.Context) error {
+			conn, err := grpc.DialContext(ctx, *criSock,
+				grpc.WithInsecure(),
+				grpc.WithBlock(),
+				grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+				}),
+			)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}}
+}
+
+// readinessChecks are the checks of /readyz on top of the built-in ones
+func readinessChecks() []fccdcri.HealthCheck {
+	// The mock backend has neither a snapshotter nor a network to check
+	if orch == nil {
+		return nil
+	}
+
+	checks := []fccdcri.HealthCheck{
+		{Name: "snapshotter", Check: orch.CheckSnapshotter},
+		{Name: "network", Check: orch.CheckNetwork},
+	}
+
+	if *devmapperPool != "" {
+		checks = append(checks, fccdcri.HealthCheck{
+			Name: "devmapper_pool",
+			Check: func(ctx context.Context) error {
+				return ctriface.CheckDevmapperPool(ctx, *devmapperPool, *devmapperThreshold)
+			},
+		})
+	}
+
+	return checks
+}
+
+func adminServe(criService *fccdcri.Service, tlsConfig *tls.Config) {
+	if err := os.Remove(*adminSock); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("failed to remove stale admin socket: %v", err)
+	}
+
+	lis, err := net.Listen("unix", *adminSock)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	s := grpc.NewServer(opts...)
+	criService.RegisterAdmin(s)
+
+	log.Println("Admin service listening on " + *adminSock)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve admin service: %v", err)
+	}
+}
+
+func snapshotPeerServe(criService *fccdcri.Service, tlsConfig *tls.Config) {
+	lis, err := net.Listen("tcp", *snapPeerAddr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		log.Warn("The snapshot peer service is served in plaintext, -snapshotPeerAddr must only be reachable by the nodes")
+	}
+
+	s := grpc.NewServer(opts...)
+	criService.RegisterSnapshotPeer(s)
+
+	log.Println("Snapshot peer service listening on " + *snapPeerAddr)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve snapshot peer service: %v", err)
+	}
+}
+
 func orchServe() {
 	lis, err := net.Listen("tcp", port)
 	if err != nil {